@@ -0,0 +1,190 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package accounts
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/crypto"
+	"github.com/ur-technology/go-ur/crypto/secp256k1"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// DefaultHDPath is the BIP-44 derivation path of the first account generated by
+// most mobile wallets.
+const DefaultHDPath = "m/44'/60'/0'/0/0"
+
+// hardenedKeyStart is the index of the first hardened BIP-32 child key.
+const hardenedKeyStart = 0x80000000
+
+var (
+	errMnemonicWordCount = errors.New("mnemonic must consist of 12, 15, 18, 21 or 24 words")
+	errMnemonicNonASCII  = errors.New("only ASCII mnemonics and passphrases are supported")
+	errMnemonicChecksum  = errors.New("invalid mnemonic checksum, check the words for typos")
+	errInvalidHDKey      = errors.New("derived key is invalid, use another path")
+)
+
+// ParseDerivationPath converts a BIP-32 derivation path such as m/44'/60'/0'/0/0
+// into the list of child indexes it consists of. Hardened components may be
+// suffixed with either ' or H.
+func ParseDerivationPath(path string) ([]uint32, error) {
+	components := strings.Split(strings.TrimSpace(path), "/")
+	if components[0] == "m" {
+		components = components[1:]
+	}
+	if len(components) == 0 {
+		return nil, fmt.Errorf("empty derivation path %q", path)
+	}
+	indexes := make([]uint32, len(components))
+	for i, component := range components {
+		var offset uint32
+		if trimmed := strings.TrimRight(component, "'hH"); trimmed != component {
+			if len(component)-len(trimmed) != 1 {
+				return nil, fmt.Errorf("invalid path component %q", component)
+			}
+			component, offset = trimmed, hardenedKeyStart
+		}
+		index, err := strconv.ParseUint(component, 10, 32)
+		if err != nil || index >= hardenedKeyStart {
+			return nil, fmt.Errorf("invalid path component %q", components[i])
+		}
+		indexes[i] = uint32(index) + offset
+	}
+	return indexes, nil
+}
+
+// FormatDerivationPath is the inverse of ParseDerivationPath, marking hardened
+// components with '.
+func FormatDerivationPath(indexes []uint32) string {
+	path := "m"
+	for _, index := range indexes {
+		if index >= hardenedKeyStart {
+			path += fmt.Sprintf("/%d'", index-hardenedKeyStart)
+		} else {
+			path += fmt.Sprintf("/%d", index)
+		}
+	}
+	return path
+}
+
+// MnemonicSeed computes the BIP-39 seed of a mnemonic sentence and an optional
+// passphrase. The words of the mnemonic must be from the English wordlist and
+// its checksum must match, so mistyped words don't silently derive the keys of
+// a different wallet.
+func MnemonicSeed(mnemonic, passphrase string) ([]byte, error) {
+	for _, s := range []string{mnemonic, passphrase} {
+		for _, c := range s {
+			if c > unicode.MaxASCII {
+				return nil, errMnemonicNonASCII
+			}
+		}
+	}
+	words := strings.Fields(mnemonic)
+	if len(words) < 12 || len(words) > 24 || len(words)%3 != 0 {
+		return nil, errMnemonicWordCount
+	}
+	if err := verifyMnemonic(words); err != nil {
+		return nil, err
+	}
+	sentence := strings.Join(words, " ")
+	return pbkdf2.Key([]byte(sentence), []byte("mnemonic"+passphrase), 2048, 64, sha512.New), nil
+}
+
+// verifyMnemonic checks that all words of a mnemonic are in the wordlist and
+// that the checksum in its last bits matches the entropy encoded by the rest.
+func verifyMnemonic(words []string) error {
+	bits := new(big.Int)
+	for _, word := range words {
+		index, ok := mnemonicWords[word]
+		if !ok {
+			return fmt.Errorf("unknown mnemonic word %q", word)
+		}
+		bits.Lsh(bits, 11)
+		bits.Or(bits, big.NewInt(int64(index)))
+	}
+	// Every 3 words carry 32 bits of entropy and 1 bit of checksum
+	checksumBits := uint(len(words) / 3)
+	checksum := new(big.Int).And(bits, big.NewInt(1<<checksumBits-1)).Uint64()
+	entropy := common.LeftPadBytes(bits.Rsh(bits, checksumBits).Bytes(), len(words)/3*4)
+
+	if hash := sha256.Sum256(entropy); uint64(hash[0]>>(8-checksumBits)) != checksum {
+		return errMnemonicChecksum
+	}
+	return nil
+}
+
+// DeriveHDKey derives the private key at the given BIP-32 path from a seed.
+func DeriveHDKey(seed []byte, path []uint32) (*ecdsa.PrivateKey, error) {
+	key, chain, err := hdChild([]byte("Bitcoin seed"), seed, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, index := range path {
+		var data []byte
+		if index >= hardenedKeyStart {
+			data = append([]byte{0}, common.LeftPadBytes(key.Bytes(), 32)...)
+		} else {
+			data = compressedPubkey(key)
+		}
+		data = append(data, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(data[len(data)-4:], index)
+
+		if key, chain, err = hdChild(chain, data, key); err != nil {
+			return nil, err
+		}
+	}
+	return crypto.ToECDSA(common.LeftPadBytes(key.Bytes(), 32)), nil
+}
+
+// hdChild runs a single BIP-32 derivation step, returning the private key and
+// chain code derived from the HMAC of data, tweaking parent if given.
+func hdChild(chain, data []byte, parent *big.Int) (*big.Int, []byte, error) {
+	mac := hmac.New(sha512.New, chain)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+
+	n := secp256k1.S256().N
+	key := new(big.Int).SetBytes(sum[:32])
+	if key.Cmp(n) >= 0 {
+		return nil, nil, errInvalidHDKey
+	}
+	if parent != nil {
+		key.Add(key, parent)
+		key.Mod(key, n)
+	}
+	if key.Sign() == 0 {
+		return nil, nil, errInvalidHDKey
+	}
+	return key, sum[32:], nil
+}
+
+// compressedPubkey returns the SEC1 compressed public key of a private key.
+func compressedPubkey(key *big.Int) []byte {
+	x, y := secp256k1.S256().ScalarBaseMult(common.LeftPadBytes(key.Bytes(), 32))
+	return append([]byte{byte(2 + y.Bit(0))}, common.LeftPadBytes(x.Bytes(), 32)...)
+}
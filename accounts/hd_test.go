@@ -0,0 +1,139 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package accounts
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/crypto"
+)
+
+func TestParseDerivationPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		indexes []uint32
+	}{
+		{"m/44'/60'/0'/0/0", []uint32{hardenedKeyStart + 44, hardenedKeyStart + 60, hardenedKeyStart, 0, 0}},
+		{"m/0H/1", []uint32{hardenedKeyStart, 1}},
+		{"0/2147483647", []uint32{0, 2147483647}},
+		{"m", nil},
+		{"m/0''", nil},
+		{"m/2147483648", nil},
+		{"m/x", nil},
+	}
+	for i, tt := range tests {
+		indexes, err := ParseDerivationPath(tt.path)
+		if tt.indexes == nil {
+			if err == nil {
+				t.Errorf("test %d: expected error for %q, got %v", i, tt.path, indexes)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: failed to parse %q: %v", i, tt.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(indexes, tt.indexes) {
+			t.Errorf("test %d: indexes mismatch: have %v, want %v", i, indexes, tt.indexes)
+		}
+	}
+	if have, _ := ParseDerivationPath(DefaultHDPath); FormatDerivationPath(have) != DefaultHDPath {
+		t.Errorf("path round trip mismatch: have %s, want %s", FormatDerivationPath(have), DefaultHDPath)
+	}
+}
+
+// Tests key derivation against the first BIP-32 test vector.
+func TestDeriveHDKey(t *testing.T) {
+	seed := common.Hex2Bytes("000102030405060708090a0b0c0d0e0f")
+	tests := []struct {
+		path string
+		key  string
+	}{
+		{"m", "e8f32e723decf4051aefac8e2c93c9c5b214313817cdb01a1494b917c8436b35"},
+		{"m/0H", "edb2e14f9ee77d26dd93b4ecede8d16ed408ce149b6cd80b0715a2d911a0afea"},
+		{"m/0H/1", "3c6cb8d0f6a264c91ea8b5030fadaa8e538b020f0a387421a12de9319dc93368"},
+		{"m/0H/1/2H", "cbce0d719ecf7431d88e6a89fa1483e02e35092af60c042b1df2ff59fa424dca"},
+	}
+	for _, tt := range tests {
+		var path []uint32
+		if tt.path != "m" {
+			var err error
+			if path, err = ParseDerivationPath(tt.path); err != nil {
+				t.Fatalf("%s: invalid path: %v", tt.path, err)
+			}
+		}
+		key, err := DeriveHDKey(seed, path)
+		if err != nil {
+			t.Fatalf("%s: derivation failed: %v", tt.path, err)
+		}
+		if have := hex.EncodeToString(common.LeftPadBytes(key.D.Bytes(), 32)); have != tt.key {
+			t.Errorf("%s: key mismatch: have %s, want %s", tt.path, have, tt.key)
+		}
+	}
+}
+
+// Tests the BIP-39 seed computation and a full derivation from a mnemonic to an
+// account address on the default path.
+func TestMnemonicSeed(t *testing.T) {
+	seed, err := MnemonicSeed("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", "TREZOR")
+	if err != nil {
+		t.Fatalf("failed to compute seed: %v", err)
+	}
+	want := "c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04"
+	if have := hex.EncodeToString(seed); have != want {
+		t.Errorf("seed mismatch: have %s, want %s", have, want)
+	}
+	// Extra whitespace must not change the seed
+	seed, err = MnemonicSeed("  test test test test test test\ttest test test test test junk\n", "")
+	if err != nil {
+		t.Fatalf("failed to compute seed: %v", err)
+	}
+	path, _ := ParseDerivationPath(DefaultHDPath)
+	key, err := DeriveHDKey(seed, path)
+	if err != nil {
+		t.Fatalf("derivation failed: %v", err)
+	}
+	if have, want := crypto.PubkeyToAddress(key.PublicKey), common.HexToAddress("0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266"); have != want {
+		t.Errorf("address mismatch: have %x, want %x", have, want)
+	}
+	// Invalid mnemonics must be rejected
+	if _, err := MnemonicSeed("abandon abandon about", ""); err != errMnemonicWordCount {
+		t.Errorf("short mnemonic error mismatch: have %v, want %v", err, errMnemonicWordCount)
+	}
+	if _, err := MnemonicSeed("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", "pässword"); err != errMnemonicNonASCII {
+		t.Errorf("non ASCII passphrase error mismatch: have %v, want %v", err, errMnemonicNonASCII)
+	}
+	if _, err := MnemonicSeed("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon", ""); err != errMnemonicChecksum {
+		t.Errorf("bad checksum error mismatch: have %v, want %v", err, errMnemonicChecksum)
+	}
+	if _, err := MnemonicSeed("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abuot", ""); err == nil {
+		t.Errorf("mnemonic with an unknown word accepted")
+	}
+	// Checksums of all mnemonic lengths must verify
+	for _, mnemonic := range []string{
+		"legal winner thank year wave sausage worth useful legal winner thank yellow",
+		"letter advice cage absurd amount doctor acoustic avoid letter advice cage absurd amount doctor acoustic avoid letter always",
+		"zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo vote",
+	} {
+		if _, err := MnemonicSeed(mnemonic, ""); err != nil {
+			t.Errorf("valid mnemonic %q rejected: %v", mnemonic, err)
+		}
+	}
+}
@@ -23,7 +23,7 @@ Usage: go run ci.go <command> <command flags/arguments>
 
 Available commands are:
 
-   install    [-arch architecture] [ packages... ]                                           -- builds packages and executables
+   install    [-arch architecture] [ -channel name ] [ -signerkeys keys ] [ packages... ]    -- builds packages and executables
    test       [ -coverage ] [ -vet ] [ packages... ]                                         -- runs the tests
    archive    [-arch architecture] [ -type zip|tar ] [ -signer key-envvar ] [ -upload dest ] -- archives build artefacts
    importkeys                                                                                -- imports signing keys from env
@@ -31,10 +31,14 @@ Available commands are:
    nsis                                                                                      -- creates a Windows NSIS installer
    aar        [ -local ] [ -sign key-id ] [-deploy repo] [ -upload dest ]                    -- creates an Android archive
    xcode      [ -local ] [ -sign key-id ] [-deploy repo] [ -upload dest ]                    -- creates an iOS XCode framework
-   xgo        [ options ]                                                                    -- cross builds according to options
+   xgo        [ -channel name ] [ -signerkeys keys ] [ options ]                             -- cross builds according to options
 
 For all commands, -n prevents execution of external programs (dry run mode).
 
+Official release builds pass -channel with the packaging channel and -signerkeys
+with the comma separated fingerprints of the release signing keys, both embedded
+into the binaries at link time.
+
 */
 package main
 
@@ -159,7 +163,8 @@ func main() {
 
 func doInstall(cmdline []string) {
 	var (
-		arch = flag.String("arch", "", "Architecture to cross build for")
+		arch                = flag.String("arch", "", "Architecture to cross build for")
+		channel, signerKeys = releaseFlags()
 	)
 	flag.CommandLine.Parse(cmdline)
 	env := build.Env()
@@ -178,7 +183,7 @@ func doInstall(cmdline []string) {
 		packages = flag.Args()
 	}
 	if *arch == "" || *arch == runtime.GOARCH {
-		goinstall := goTool("install", buildFlags(env)...)
+		goinstall := goTool("install", buildFlags(env, *channel, *signerKeys)...)
 		goinstall.Args = append(goinstall.Args, "-v")
 		goinstall.Args = append(goinstall.Args, packages...)
 		build.MustRun(goinstall)
@@ -192,7 +197,7 @@ func doInstall(cmdline []string) {
 		}
 	}
 	// Seems we are cross compiling, work around forbidden GOBIN
-	goinstall := goToolArch(*arch, "install", buildFlags(env)...)
+	goinstall := goToolArch(*arch, "install", buildFlags(env, *channel, *signerKeys)...)
 	goinstall.Args = append(goinstall.Args, "-v")
 	goinstall.Args = append(goinstall.Args, []string{"-buildmode", "archive"}...)
 	goinstall.Args = append(goinstall.Args, packages...)
@@ -206,7 +211,7 @@ func doInstall(cmdline []string) {
 			}
 			for name, _ := range pkgs {
 				if name == "main" {
-					gobuild := goToolArch(*arch, "build", buildFlags(env)...)
+					gobuild := goToolArch(*arch, "build", buildFlags(env, *channel, *signerKeys)...)
 					gobuild.Args = append(gobuild.Args, "-v")
 					gobuild.Args = append(gobuild.Args, []string{"-o", executablePath(cmd.Name())}...)
 					gobuild.Args = append(gobuild.Args, "."+string(filepath.Separator)+filepath.Join("cmd", cmd.Name()))
@@ -218,7 +223,15 @@ func doInstall(cmdline []string) {
 	}
 }
 
-func buildFlags(env build.Environment) (flags []string) {
+// releaseFlags registers the flags of the release packaging metadata embedded
+// into the official builds.
+func releaseFlags() (channel, signerKeys *string) {
+	channel = flag.String("channel", "", "Packaging channel of an official release build (e.g. archive, ppa, docker)")
+	signerKeys = flag.String("signerkeys", "", "Comma separated fingerprints of the release signing keys of an official build")
+	return channel, signerKeys
+}
+
+func buildFlags(env build.Environment, channel, signerKeys string) (flags []string) {
 	if os.Getenv("GO_OPENCL") != "" {
 		flags = append(flags, "-tags", "opencl")
 	}
@@ -230,9 +243,20 @@ func buildFlags(env build.Environment) (flags []string) {
 	if runtime.Version() > "go1.5" || strings.Contains(runtime.Version(), "devel") {
 		sep = "="
 	}
-	// Set gitCommit constant via link-time assignment.
+	// Set gitCommit constant and the release packaging metadata via link-time
+	// assignment.
+	var ld []string
 	if env.Commit != "" {
-		flags = append(flags, "-ldflags", "-X main.gitCommit"+sep+env.Commit)
+		ld = append(ld, "-X main.gitCommit"+sep+env.Commit)
+	}
+	if channel != "" {
+		ld = append(ld, "-X github.com/ur-technology/go-ur/params.BuildChannel"+sep+channel)
+	}
+	if signerKeys != "" {
+		ld = append(ld, "-X github.com/ur-technology/go-ur/params.BuildSignerKeys"+sep+signerKeys)
+	}
+	if len(ld) > 0 {
+		flags = append(flags, "-ldflags", strings.Join(ld, " "))
 	}
 	return flags
 }
@@ -879,6 +903,7 @@ func newPodMetadata(env build.Environment, archive string) podMetadata {
 // Cross compilation
 
 func doXgo(cmdline []string) {
+	channel, signerKeys := releaseFlags()
 	flag.CommandLine.Parse(cmdline)
 	env := build.Env()
 
@@ -887,7 +912,7 @@ func doXgo(cmdline []string) {
 	build.MustRun(gogetxgo)
 
 	// Execute the actual cross compilation
-	xgo := xgoTool(append(buildFlags(env), flag.Args()...))
+	xgo := xgoTool(append(buildFlags(env, *channel, *signerKeys), flag.Args()...))
 	build.MustRun(xgo)
 }
 
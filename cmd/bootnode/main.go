@@ -14,13 +14,17 @@
 // You should have received a copy of the GNU General Public License
 // along with go-ur. If not, see <http://www.gnu.org/licenses/>.
 
-// bootnode runs a bootstrap node for the Ethereum Discovery Protocol.
+// bootnode runs a bootstrap node for the Ethereum Discovery Protocol. It runs
+// node discovery only, without any chain, and can report the size and churn of
+// its node table over HTTP.
 package main
 
 import (
 	"crypto/ecdsa"
 	"flag"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
 
 	"github.com/ur-technology/go-ur/cmd/utils"
@@ -39,9 +43,10 @@ func main() {
 		writeAddr   = flag.Bool("writeaddress", false, "write out the node's pubkey hash and quit")
 		nodeKeyFile = flag.String("nodekey", "", "private key filename")
 		nodeKeyHex  = flag.String("nodekeyhex", "", "private key as hex (for testing)")
-		natdesc     = flag.String("nat", "none", "port mapping mechanism (any|none|upnp|pmp|extip:<IP>)")
+		natdesc     = flag.String("nat", "none", "port mapping mechanism (auto|any|none|upnp|pmp|extip:<IP>)")
 		netrestrict = flag.String("netrestrict", "", "restrict network communication to the given IP networks (CIDR masks)")
 		runv5       = flag.Bool("v5", false, "run a v5 topic discovery bootnode")
+		httpAddr    = flag.String("http", "", "HTTP listen address serving the node table stats at /stats (e.g. :8080)")
 
 		nodeKey *ecdsa.PrivateKey
 		err     error
@@ -91,14 +96,30 @@ func main() {
 		}
 	}
 
+	if *runv5 && *httpAddr != "" {
+		utils.Fatalf("-http: node table stats not supported by v5 bootnodes")
+	}
+	var listener net.Listener
+	if *httpAddr != "" {
+		if listener, err = net.Listen("tcp", *httpAddr); err != nil {
+			utils.Fatalf("-http: %v", err)
+		}
+	}
+
 	if *runv5 {
 		if _, err := discv5.ListenUDP(nodeKey, *listenAddr, natm, "", restrictList); err != nil {
 			utils.Fatalf("%v", err)
 		}
 	} else {
-		if _, err := discover.ListenUDP(nodeKey, *listenAddr, natm, "", restrictList); err != nil {
+		tab, err := discover.ListenUDP(nodeKey, *listenAddr, natm, "", restrictList)
+		if err != nil {
 			utils.Fatalf("%v", err)
 		}
+		if listener != nil {
+			mux := http.NewServeMux()
+			mux.Handle("/stats", newStatsServer(tab))
+			go http.Serve(listener, mux)
+		}
 	}
 
 	select {}
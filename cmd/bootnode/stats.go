@@ -0,0 +1,105 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of go-ur.
+//
+// go-ur is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ur is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ur. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ur-technology/go-ur/p2p/discover"
+)
+
+const (
+	churnInterval = time.Minute // Interval between the samples of the table churn
+	churnSamples  = 60          // Number of samples the churn is reported over
+)
+
+// bootnodeStats is the report of the stats endpoint.
+type bootnodeStats struct {
+	Enode  string              `json:"enode"`  // Enode URL of the bootnode
+	Uptime string              `json:"uptime"` // Time since the bootnode started
+	Table  discover.TableStats `json:"table"`  // Size of the node table and churn since the start
+	Churn  struct {
+		Window  string `json:"window"`  // Time the recent churn is measured over
+		Added   uint64 `json:"added"`   // Nodes added to the table within the window
+		Removed uint64 `json:"removed"` // Nodes deleted from the table within the window
+	} `json:"churn"`
+}
+
+// statsServer serves the stats of the node table over HTTP, sampling them to
+// report the churn over the last hour.
+type statsServer struct {
+	tab     *discover.Table
+	started time.Time
+
+	samples []discover.TableStats // Table stats sampled every churnInterval, oldest first
+	times   []time.Time           // Times the samples were taken
+	lock    sync.Mutex
+}
+
+func newStatsServer(tab *discover.Table) *statsServer {
+	s := &statsServer{tab: tab, started: time.Now()}
+	s.sample(s.started)
+	go s.loop()
+	return s
+}
+
+// loop samples the table stats until the process exits.
+func (s *statsServer) loop() {
+	ticker := time.NewTicker(churnInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		s.sample(now)
+	}
+}
+
+// sample records the current table stats, dropping the ones out of the window.
+func (s *statsServer) sample(now time.Time) {
+	stats := s.tab.Stats()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.samples = append(s.samples, stats)
+	s.times = append(s.times, now)
+	if len(s.samples) > churnSamples+1 {
+		s.samples, s.times = s.samples[1:], s.times[1:]
+	}
+}
+
+// ServeHTTP implements http.Handler, reporting the stats as JSON.
+func (s *statsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	report := bootnodeStats{
+		Enode:  s.tab.Self().String(),
+		Uptime: now.Sub(s.started).String(),
+		Table:  s.tab.Stats(),
+	}
+	s.lock.Lock()
+	oldest, since := s.samples[0], s.times[0]
+	s.lock.Unlock()
+
+	report.Churn.Window = now.Sub(since).String()
+	report.Churn.Added = report.Table.Added - oldest.Added
+	report.Churn.Removed = report.Table.Removed - oldest.Removed
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
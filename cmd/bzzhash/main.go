@@ -14,36 +14,182 @@
 // You should have received a copy of the GNU General Public License
 // along with go-ur. If not, see <http://www.gnu.org/licenses/>.
 
-// Command bzzhash computes a swarm tree hash.
+// Command bzzhash computes the swarm tree hashes of files.
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/mattn/go-isatty"
+	"github.com/ur-technology/go-ur/common"
 	"github.com/ur-technology/go-ur/swarm/storage"
 )
 
+// progressInterval is the time between two redraws of the progress bar.
+const progressInterval = 250 * time.Millisecond
+
+// result is the outcome of hashing a single file.
+type result struct {
+	Path  string `json:"path"`
+	Size  int64  `json:"size"`
+	Key   string `json:"key,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
 func main() {
+	var (
+		jsonOut  = flag.Bool("json", false, "print the results as a JSON array")
+		workers  = flag.Int("workers", runtime.NumCPU(), "number of files hashed concurrently")
+		progress = flag.Bool("progress", isatty.IsTerminal(os.Stderr.Fd()), "show a progress bar on stderr")
+	)
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: bzzhash [options] <file>...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
 	runtime.GOMAXPROCS(runtime.NumCPU())
 
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: bzzhash <file name>")
-		os.Exit(0)
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
 	}
-	f, err := os.Open(os.Args[1])
-	if err != nil {
-		fmt.Println("Error opening file " + os.Args[1])
+	if *workers < 1 {
+		*workers = 1
+	}
+	results := make([]result, flag.NArg())
+	sizes := make([]int64, flag.NArg())
+	var total int64
+	for i, path := range flag.Args() {
+		results[i].Path = path
+		if stat, err := os.Stat(path); err != nil {
+			results[i].Error = err.Error()
+		} else if stat.IsDir() {
+			results[i].Error = "is a directory"
+		} else {
+			sizes[i] = stat.Size()
+			total += sizes[i]
+		}
+	}
+	// Hash the files concurrently, counting the bytes read for the progress bar
+	var (
+		read, done int64
+		pending    = make(chan int)
+		wg         sync.WaitGroup
+	)
+	for i := 0; i < *workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range pending {
+				results[i].Size = sizes[i]
+				if results[i].Error == "" {
+					key, err := hashFile(results[i].Path, sizes[i], &read)
+					if err != nil {
+						results[i].Error = err.Error()
+					} else {
+						results[i].Key = key.String()
+					}
+				}
+				atomic.AddInt64(&done, 1)
+			}
+		}()
+	}
+	finished := make(chan struct{})
+	go func() {
+		for i := range results {
+			pending <- i
+		}
+		close(pending)
+		wg.Wait()
+		close(finished)
+	}()
+	if *progress {
+		ticker := time.NewTicker(progressInterval)
+	loop:
+		for {
+			select {
+			case <-ticker.C:
+				drawProgress(atomic.LoadInt64(&read), total, atomic.LoadInt64(&done), len(results))
+			case <-finished:
+				break loop
+			}
+		}
+		ticker.Stop()
+		drawProgress(atomic.LoadInt64(&read), total, atomic.LoadInt64(&done), len(results))
+		fmt.Fprintln(os.Stderr)
+	} else {
+		<-finished
+	}
+	// Report the results in the order of the arguments
+	failed := false
+	for _, res := range results {
+		failed = failed || res.Error != ""
+	}
+	if *jsonOut {
+		out, _ := json.MarshalIndent(results, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		for _, res := range results {
+			if res.Error != "" {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", res.Path, res.Error)
+			} else {
+				fmt.Printf("%s  %s\n", res.Key, res.Path)
+			}
+		}
+	}
+	if failed {
 		os.Exit(1)
 	}
+}
 
-	stat, _ := f.Stat()
-	chunker := storage.NewTreeChunker(storage.NewChunkerParams())
-	key, err := chunker.Split(f, stat.Size(), nil, nil, nil)
+// hashFile computes the swarm tree hash of a file of the given size, adding the
+// bytes read to the counter.
+func hashFile(path string, size int64, read *int64) (storage.Key, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%v\n", err)
-	} else {
-		fmt.Printf("%v\n", key)
+		return nil, err
+	}
+	defer f.Close()
+
+	chunker := storage.NewTreeChunker(storage.NewChunkerParams())
+	return chunker.Split(&countingReader{r: f, n: read}, size, nil, nil, nil)
+}
+
+// countingReader counts the bytes read through it into a shared counter.
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	atomic.AddInt64(r.n, int64(n))
+	return n, err
+}
+
+// drawProgress redraws the progress bar on stderr.
+func drawProgress(read, total, done int64, files int) {
+	const width = 40
+
+	ratio := 1.0
+	if total > 0 {
+		ratio = float64(read) / float64(total)
+		if ratio > 1 {
+			ratio = 1
+		}
 	}
+	filled := int(ratio * width)
+	fmt.Fprintf(os.Stderr, "\r[%s%s] %3.0f%% %v / %v, %d/%d files",
+		strings.Repeat("=", filled), strings.Repeat(" ", width-filled), ratio*100,
+		common.StorageSize(read), common.StorageSize(total), done, files)
 }
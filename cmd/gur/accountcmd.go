@@ -19,6 +19,7 @@ package main
 import (
 	"fmt"
 	"io/ioutil"
+	"strconv"
 
 	"github.com/ur-technology/go-ur/accounts"
 	"github.com/ur-technology/go-ur/cmd/utils"
@@ -172,6 +173,32 @@ Note:
 As you can directly copy your encrypted accounts to another ethereum instance,
 this import mechanism is not needed when you transfer an account between
 nodes.
+`,
+			},
+			{
+				Action:    accountImportMnemonic,
+				Name:      "import-mnemonic",
+				Usage:     "Import accounts derived from a BIP-39 mnemonic",
+				ArgsUsage: "[<hdPath>] [<count>]",
+				Description: `
+    gur account import-mnemonic [<hdPath>] [<count>]
+
+Prompts for a BIP-39 mnemonic sentence and an optional mnemonic passphrase,
+derives private keys from it along the given BIP-32 path and stores them as new
+accounts. Prints the path and address of every derived account.
+
+The path defaults to m/44'/60'/0'/0/0, the first account of most mobile wallets.
+If a count is given, that many consecutive accounts are imported by incrementing
+the last path component.
+
+Mnemonics with words outside the English BIP-39 wordlist or a mismatching
+checksum are rejected. Only English (ASCII) mnemonics are supported.
+
+The accounts are saved in encrypted format, you are prompted for a passphrase.
+
+For non-interactive use the passphrase can be specified with the --password flag:
+
+    gur --password <passwordfile> account import-mnemonic
 `,
 			},
 		},
@@ -336,3 +363,55 @@ func accountImport(ctx *cli.Context) error {
 	fmt.Printf("Address: {%x}\n", acct.Address)
 	return nil
 }
+
+// accountImportMnemonic derives accounts from a BIP-39 mnemonic and imports them
+// into the keystore.
+func accountImportMnemonic(ctx *cli.Context) error {
+	path := accounts.DefaultHDPath
+	if arg := ctx.Args().First(); arg != "" {
+		path = arg
+	}
+	indexes, err := accounts.ParseDerivationPath(path)
+	if err != nil {
+		utils.Fatalf("Invalid derivation path: %v", err)
+	}
+	count := 1
+	if arg := ctx.Args().Get(1); arg != "" {
+		if count, err = strconv.Atoi(arg); err != nil || count < 1 {
+			utils.Fatalf("Account count must be a positive integer")
+		}
+	}
+	mnemonic, err := console.Stdin.PromptPassword("Mnemonic: ")
+	if err != nil {
+		utils.Fatalf("Failed to read mnemonic: %v", err)
+	}
+	seedPassphrase, err := console.Stdin.PromptPassword("Mnemonic passphrase (empty if none): ")
+	if err != nil {
+		utils.Fatalf("Failed to read mnemonic passphrase: %v", err)
+	}
+	seed, err := accounts.MnemonicSeed(mnemonic, seedPassphrase)
+	if err != nil {
+		utils.Fatalf("Invalid mnemonic: %v", err)
+	}
+	stack := utils.MakeNode(ctx, clientIdentifier, gitCommit)
+	passphrase := getPassPhrase("Your new accounts are locked with a password. Please give a password. Do not forget this password.", true, 0, utils.MakePasswordList(ctx))
+
+	last := len(indexes) - 1
+	for i := 0; i < count; i++ {
+		key, err := accounts.DeriveHDKey(seed, indexes)
+		if err != nil {
+			utils.Fatalf("Failed to derive %s: %v", accounts.FormatDerivationPath(indexes), err)
+		}
+		address := crypto.PubkeyToAddress(key.PublicKey)
+		if stack.AccountManager().HasAddress(address) {
+			fmt.Printf("Path %s: {%x} already present, skipping\n", accounts.FormatDerivationPath(indexes), address)
+		} else {
+			if _, err := stack.AccountManager().ImportECDSA(key, passphrase); err != nil {
+				utils.Fatalf("Could not create the account: %v", err)
+			}
+			fmt.Printf("Path %s: {%x}\n", accounts.FormatDerivationPath(indexes), address)
+		}
+		indexes[last]++
+	}
+	return nil
+}
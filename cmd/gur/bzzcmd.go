@@ -0,0 +1,134 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of go-ur.
+//
+// go-ur is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ur is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ur. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ur-technology/go-ur/cmd/utils"
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/swarm/api"
+	"github.com/ur-technology/go-ur/swarm/storage"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	bzzCommandDirFlag = cli.StringFlag{
+		Name:  "bzzdir",
+		Usage: "Swarm node directory holding config.json (default = the only bzz-* directory in <datadir>/bzzd)",
+	}
+	bzzCommand = cli.Command{
+		Name:      "bzz",
+		Usage:     "Maintain the local swarm chunk store",
+		ArgsUsage: "",
+		Category:  "SWARM COMMANDS",
+		Description: `
+Offline operations on the chunk store of a swarm node. The bzzd daemon using the
+store must not be running while these commands are used.
+`,
+		Subcommands: []cli.Command{
+			{
+				Action:    bzzAudit,
+				Name:      "audit",
+				Usage:     "Verify the integrity of stored content",
+				ArgsUsage: "<root-key>",
+				Flags: []cli.Flag{
+					bzzCommandDirFlag,
+				},
+				Description: `
+Walks the chunk tree of the content under the root key, re-hashing every chunk
+of the local store. If the root is a manifest, all its entries are audited too.
+Missing and corrupted chunks are reported with the manifest path of the file
+they belong to and the offset of their data within it, and make the command
+exit with a non-zero status, allowing scheduled checks of pinned content.
+
+Corrupted chunks are dropped from the store, so that the node may fetch them
+again from the network.
+`,
+			},
+		},
+	}
+)
+
+// bzzDir returns the swarm node directory to operate on.
+func bzzDir(ctx *cli.Context) string {
+	if dir := ctx.String(bzzCommandDirFlag.Name); dir != "" {
+		return dir
+	}
+	dirs, _ := filepath.Glob(filepath.Join(utils.MakeDataDir(ctx), "bzzd", "bzz-*"))
+	if len(dirs) != 1 {
+		utils.Fatalf("Found %d swarm directories, please select one with --%s", len(dirs), bzzCommandDirFlag.Name)
+	}
+	return dirs[0]
+}
+
+func bzzAudit(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("This command requires an argument.")
+	}
+	root := storage.Key(common.FromHex(ctx.Args().First()))
+	if len(root) != common.HashLength {
+		utils.Fatalf("Invalid root key %q", ctx.Args().First())
+	}
+	dir := bzzDir(ctx)
+	config, err := api.LoadConfig(dir)
+	if err != nil {
+		utils.Fatalf("Failed to load swarm config from %s: %v", dir, err)
+	}
+	store, err := storage.NewLocalStore(storage.MakeHashFunc(config.ChunkerParams.Hash), config.StoreParams)
+	if err != nil {
+		utils.Fatalf("Failed to open chunk store: %v", err)
+	}
+	dpa := storage.NewDPA(store, config.ChunkerParams)
+	dpa.Start()
+	defer dpa.Stop()
+
+	var (
+		start  = time.Now()
+		trees  int
+		chunks int
+		faults int
+	)
+	err = api.NewApi(dpa, nil).Audit(root, func(result *api.AuditResult) {
+		trees++
+		chunks += result.Chunks
+		faults += len(result.Faults)
+
+		path := result.Path
+		if path == "" {
+			path = "/"
+		}
+		for _, fault := range result.Faults {
+			kind := "corrupted"
+			if fault.Err == storage.ErrChunkMissing {
+				kind = "missing"
+			}
+			fmt.Printf("%-10s %s %s @%d\n", kind, fault.Key, path, fault.Offset)
+		}
+	})
+	if err != nil {
+		utils.Fatalf("Audit failed: %v", err)
+	}
+	fmt.Printf("Audited %d trees, %d chunks intact, %d faulty, in %v.\n", trees, chunks, faults, time.Since(start))
+	if faults > 0 {
+		os.Exit(1)
+	}
+	return nil
+}
@@ -17,7 +17,9 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -31,8 +33,10 @@ import (
 	"github.com/ur-technology/go-ur/core"
 	"github.com/ur-technology/go-ur/core/state"
 	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/crypto"
 	"github.com/ur-technology/go-ur/ethdb"
 	"github.com/ur-technology/go-ur/logger/glog"
+	"github.com/ur-technology/go-ur/params"
 	"github.com/ur-technology/go-ur/trie"
 	"github.com/syndtr/goleveldb/leveldb/util"
 	"gopkg.in/urfave/cli.v1"
@@ -43,12 +47,27 @@ var (
 		Action:    importChain,
 		Name:      "import",
 		Usage:     "Import a blockchain file",
-		ArgsUsage: "<filename>",
+		ArgsUsage: "<filename> [<blockNumFirst> <blockNumLast>]",
 		Category:  "BLOCKCHAIN COMMANDS",
 		Description: `
-TODO: Please write this
+Requires a first argument of the file to read from. Gzip and snappy
+compressed files are detected and decompressed on the fly. If the
+argument is a directory, the files of a chunked export in it are
+imported in order.
+Optional second and third arguments restrict the import to the blocks
+numbered between first and last. Blocks already present in the local
+chain are skipped, so an interrupted import can be resumed by running
+the same command again.
 `,
 	}
+	exportCommandCompressFlag = cli.StringFlag{
+		Name:  "compress",
+		Usage: "Compression of the export: none, gzip or snappy (default = by file extension, .gz or .sz)",
+	}
+	exportCommandChunkFlag = cli.Uint64Flag{
+		Name:  "chunk",
+		Usage: "Split the export into files of this many blocks each, written into the <filename> directory",
+	}
 	exportCommand = cli.Command{
 		Action:    exportChain,
 		Name:      "export",
@@ -56,11 +75,21 @@ TODO: Please write this
 		ArgsUsage: "<filename> [<blockNumFirst> <blockNumLast>]",
 		Category:  "BLOCKCHAIN COMMANDS",
 		Description: `
-Requires a first argument of the file to write to.
+Requires a first argument of the file to write to. If the file name
+ends with .gz or .sz, the output is gzip or snappy compressed, unless
+another compression is selected with --compress.
 Optional second and third arguments control the first and
 last block to write. In this mode, the file will be appended
 if already existing.
+
+With --chunk, the first argument is a directory instead, which the
+blocks are exported into as files of at most the given number of
+blocks each. The directory can be imported as a whole.
 `,
+		Flags: []cli.Flag{
+			exportCommandCompressFlag,
+			exportCommandChunkFlag,
+		},
 	}
 	upgradedbCommand = cli.Command{
 		Action:    upgradeDB,
@@ -72,6 +101,18 @@ if already existing.
 TODO: Please write this
 `,
 	}
+	removedbCommandStateFlag = cli.BoolFlag{
+		Name:  "state",
+		Usage: "Only remove the state, keeping the blocks and receipts",
+	}
+	removedbCommandChainFlag = cli.BoolFlag{
+		Name:  "chain",
+		Usage: "Remove the full node chain database",
+	}
+	removedbCommandLightFlag = cli.BoolFlag{
+		Name:  "light",
+		Usage: "Remove the light client chain database",
+	}
 	removedbCommand = cli.Command{
 		Action:    removeDB,
 		Name:      "removedb",
@@ -79,8 +120,50 @@ TODO: Please write this
 		ArgsUsage: " ",
 		Category:  "BLOCKCHAIN COMMANDS",
 		Description: `
-TODO: Please write this
+Removes the chain database of the node, the light client one if --light is
+given as a global flag. Parts can be selected with:
+
+    --chain  the full node chain database, blocks and state alike
+    --light  the light client chain database
+    --state  the state of the full node chain database only
+
+Removing only the state deletes the state tries, contract codes and trie key
+preimages, except for the genesis state, and rewinds the head block to the
+genesis. The blocks and receipts are kept, so a node recovering from state
+corruption regenerates the state by syncing without downloading the chain
+again. The keystore and node key are never touched. Every removal asks for
+confirmation, and the node must not be running.
 `,
+		Flags: []cli.Flag{
+			removedbCommandStateFlag,
+			removedbCommandChainFlag,
+			removedbCommandLightFlag,
+		},
+	}
+	pruneStateCommandKeepFlag = cli.Uint64Flag{
+		Name:  "keep",
+		Usage: "Number of most recent block states to retain",
+		Value: core.DefaultPruneKeep,
+	}
+	pruneStateCommand = cli.Command{
+		Action:    pruneState,
+		Name:      "prune-state",
+		Usage:     "Discard the historical state tries",
+		ArgsUsage: " ",
+		Category:  "BLOCKCHAIN COMMANDS",
+		Description: `
+Deletes the state trie nodes and contract codes not reachable from the states
+of the genesis block and the --keep most recent canonical blocks, shrinking the
+database of a non-archive node. Older states can no longer be queried, nor can
+the chain reorganise deeper than the states kept. Blocks and receipts are left
+untouched. The node must not be running.
+
+The space of the deleted entries is reclaimed by LevelDB over time, or at once
+by running "gur db compact" afterwards.
+`,
+		Flags: []cli.Flag{
+			pruneStateCommandKeepFlag,
+		},
 	}
 	dumpCommand = cli.Command{
 		Action:    dump,
@@ -91,13 +174,54 @@ TODO: Please write this
 		Description: `
 The arguments are interpreted as block numbers or hashes.
 Use "ethereum dump 0" to dump the genesis block.
+`,
+	}
+	dumpGenesisCommand = cli.Command{
+		Action:    dumpGenesis,
+		Name:      "dumpgenesis",
+		Usage:     "Dump the genesis specification in JSON format",
+		ArgsUsage: " ",
+		Category:  "BLOCKCHAIN COMMANDS",
+		Description: `
+The dumpgenesis command prints the genesis specification the node runs with,
+along with its effective chain configuration, as JSON suitable for "gur init"
+on another machine.
+
+If the data directory has already been initialized, the specification is
+reconstructed from the stored genesis block and state. Otherwise the built-in
+genesis of the selected network is printed.
+`,
+	}
+	verifyGenesisCommand = cli.Command{
+		Action:    verifyGenesis,
+		Name:      "verify-genesis",
+		Usage:     "Verify a genesis file against the data directory",
+		ArgsUsage: "<genesisPath>",
+		Category:  "BLOCKCHAIN COMMANDS",
+		Description: `
+The verify-genesis command computes the genesis block hash and chain configuration
+digest of the given JSON genesis file, along with the digest of the UR reward
+specification compiled into this binary, and prints them.
+
+If the data directory has already been initialized, the values are compared with
+the stored genesis block and chain configuration and the command exits with a
+non-zero status on any mismatch.
 `,
 	}
 )
 
 func importChain(ctx *cli.Context) error {
-	if len(ctx.Args()) != 1 {
-		utils.Fatalf("This command requires an argument.")
+	if len(ctx.Args()) != 1 && len(ctx.Args()) != 3 {
+		utils.Fatalf("This command requires a file argument and optionally a block range.")
+	}
+	first, last := uint64(0), uint64(math.MaxUint64)
+	if len(ctx.Args()) == 3 {
+		var ferr, lerr error
+		first, ferr = strconv.ParseUint(ctx.Args().Get(1), 10, 64)
+		last, lerr = strconv.ParseUint(ctx.Args().Get(2), 10, 64)
+		if ferr != nil || lerr != nil {
+			utils.Fatalf("Import error in parsing parameters: block number not an integer\n")
+		}
 	}
 	stack := makeFullNode(ctx)
 	chain, chainDb := utils.MakeChain(ctx, stack)
@@ -120,7 +244,7 @@ func importChain(ctx *cli.Context) error {
 	}()
 	// Import the chain
 	start := time.Now()
-	if err := utils.ImportChain(chain, ctx.Args().First()); err != nil {
+	if err := utils.ImportChainRange(chain, ctx.Args().First(), first, last); err != nil {
 		utils.Fatalf("Import error: %v", err)
 	}
 	fmt.Printf("Import done in %v.\n\n", time.Since(start))
@@ -170,21 +294,29 @@ func exportChain(ctx *cli.Context) error {
 	chain, _ := utils.MakeChain(ctx, stack)
 	start := time.Now()
 
-	var err error
 	fp := ctx.Args().First()
-	if len(ctx.Args()) < 3 {
-		err = utils.ExportChain(chain, fp)
-	} else {
+	compression := utils.CompressionByName(fp)
+	if ctx.IsSet(exportCommandCompressFlag.Name) {
+		compression = ctx.String(exportCommandCompressFlag.Name)
+	}
+	ranged, first, last := false, uint64(0), chain.CurrentBlock().NumberU64()
+	if len(ctx.Args()) >= 3 {
 		// This can be improved to allow for numbers larger than 9223372036854775807
-		first, ferr := strconv.ParseInt(ctx.Args().Get(1), 10, 64)
-		last, lerr := strconv.ParseInt(ctx.Args().Get(2), 10, 64)
+		f, ferr := strconv.ParseInt(ctx.Args().Get(1), 10, 64)
+		l, lerr := strconv.ParseInt(ctx.Args().Get(2), 10, 64)
 		if ferr != nil || lerr != nil {
 			utils.Fatalf("Export error in parsing parameters: block number not an integer\n")
 		}
-		if first < 0 || last < 0 {
+		if f < 0 || l < 0 {
 			utils.Fatalf("Export error: block number must be greater than 0\n")
 		}
-		err = utils.ExportAppendChain(chain, fp, uint64(first), uint64(last))
+		ranged, first, last = true, uint64(f), uint64(l)
+	}
+	var err error
+	if chunk := ctx.Uint64(exportCommandChunkFlag.Name); chunk > 0 {
+		err = utils.ExportChainChunks(chain, fp, first, last, chunk, compression)
+	} else {
+		err = utils.ExportChainFile(chain, fp, first, last, compression, ranged)
 	}
 
 	if err != nil {
@@ -195,13 +327,37 @@ func exportChain(ctx *cli.Context) error {
 }
 
 func removeDB(ctx *cli.Context) error {
+	var (
+		removeState = ctx.Bool(removedbCommandStateFlag.Name)
+		removeChain = ctx.Bool(removedbCommandChainFlag.Name)
+		removeLight = ctx.Bool(removedbCommandLightFlag.Name)
+	)
+	if removeState && removeChain {
+		utils.Fatalf("The --%s and --%s flags are mutually exclusive", removedbCommandStateFlag.Name, removedbCommandChainFlag.Name)
+	}
 	stack := utils.MakeNode(ctx, clientIdentifier, gitCommit)
-	dbdir := stack.ResolvePath(utils.ChainDbName(ctx))
-	if !common.FileExist(dbdir) {
-		fmt.Println(dbdir, "does not exist")
+	if !removeState && !removeChain && !removeLight {
+		removeDatabase(stack.ResolvePath(utils.ChainDbName(ctx)))
 		return nil
 	}
+	if removeChain {
+		removeDatabase(stack.ResolvePath("chaindata"))
+	}
+	if removeLight {
+		removeDatabase(stack.ResolvePath("lightchaindata"))
+	}
+	if removeState {
+		removeChainState(ctx, stack.ResolvePath("chaindata"))
+	}
+	return nil
+}
 
+// removeDatabase deletes a database directory after interactive confirmation.
+func removeDatabase(dbdir string) {
+	if !common.FileExist(dbdir) {
+		fmt.Println(dbdir, "does not exist")
+		return
+	}
 	fmt.Println(dbdir)
 	confirm, err := console.Stdin.PromptConfirm("Remove this database?")
 	switch {
@@ -215,6 +371,59 @@ func removeDB(ctx *cli.Context) error {
 		os.RemoveAll(dbdir)
 		fmt.Printf("Removed in %v\n", time.Since(start))
 	}
+}
+
+// removeChainState deletes the state from the chain database after interactive
+// confirmation, keeping the chain data.
+func removeChainState(ctx *cli.Context, dbdir string) {
+	if !common.FileExist(dbdir) {
+		fmt.Println(dbdir, "does not exist")
+		return
+	}
+	fmt.Println(dbdir)
+	confirm, err := console.Stdin.PromptConfirm("Remove the state from this database?")
+	switch {
+	case err != nil:
+		utils.Fatalf("%v", err)
+	case !confirm:
+		fmt.Println("Operation aborted")
+		return
+	}
+	var (
+		cache   = ctx.GlobalInt(utils.CacheFlag.Name)
+		handles = utils.MakeDatabaseHandles()
+		db      *ethdb.LDBDatabase
+	)
+	if key := utils.MakeDatabaseKey(ctx); key != nil {
+		db, err = ethdb.NewEncryptedLDBDatabase(dbdir, cache, handles, key)
+	} else {
+		db, err = ethdb.NewLDBDatabase(dbdir, cache, handles)
+	}
+	if err != nil {
+		utils.Fatalf("Could not open database: %v", err)
+	}
+	defer db.Close()
+
+	fmt.Println("Removing state...")
+	start := time.Now()
+	count, size, err := core.DeleteState(db)
+	if err != nil {
+		utils.Fatalf("Failed to remove state: %v", err)
+	}
+	fmt.Printf("Removed %d entries (%v) in %v, head rewound to genesis\n", count, size, time.Since(start))
+}
+
+func pruneState(ctx *cli.Context) error {
+	db := openChainDatabase(ctx)
+	defer db.Close()
+
+	fmt.Println("Pruning state...")
+	start := time.Now()
+	roots, count, size, err := core.PruneState(db, ctx.Uint64(pruneStateCommandKeepFlag.Name))
+	if err != nil {
+		utils.Fatalf("Failed to prune state: %v", err)
+	}
+	fmt.Printf("Removed %d entries (%v) in %v, %d states retained\n", count, size, time.Since(start), roots)
 	return nil
 }
 
@@ -287,6 +496,116 @@ func dump(ctx *cli.Context) error {
 	return nil
 }
 
+func verifyGenesis(ctx *cli.Context) error {
+	genesisPath := ctx.Args().First()
+	if len(genesisPath) == 0 {
+		utils.Fatalf("must supply path to genesis JSON file")
+	}
+	genesisFile, err := os.Open(genesisPath)
+	if err != nil {
+		utils.Fatalf("failed to read genesis file: %v", err)
+	}
+	defer genesisFile.Close()
+
+	genesis, config, err := core.ParseGenesisBlock(genesisFile)
+	if err != nil {
+		utils.Fatalf("invalid genesis file: %v", err)
+	}
+	if config != nil {
+		// The reward spec hash must reflect the rewards of the genesis file
+		if err := core.ValidateURConfig(config.UR); err != nil {
+			utils.Fatalf("invalid genesis file: %v", err)
+		}
+	}
+	fmt.Printf("Genesis hash:        %x\n", genesis.Hash())
+	fmt.Printf("Reward spec hash:    %x\n", core.RewardSpecHash(config))
+	fmt.Printf("Chain config digest: %x\n", chainConfigDigest(config))
+
+	// Compare against the data directory if it was already initialized
+	stack := utils.MakeNode(ctx, clientIdentifier, gitCommit)
+	chainDb := utils.MakeChainDatabase(ctx, stack)
+	defer chainDb.Close()
+
+	stored := core.GetCanonicalHash(chainDb, 0)
+	if stored == (common.Hash{}) {
+		fmt.Println("Data directory not initialized, nothing to compare against")
+		return nil
+	}
+	if stored != genesis.Hash() {
+		utils.Fatalf("genesis hash mismatch: have %x, datadir %x", genesis.Hash(), stored)
+	}
+	storedConfig, err := core.GetChainConfig(chainDb, stored)
+	switch {
+	case err == core.ChainConfigNotFoundErr:
+		storedConfig = nil
+	case err != nil:
+		utils.Fatalf("failed to read stored chain configuration: %v", err)
+	}
+	if have, want := chainConfigDigest(config), chainConfigDigest(storedConfig); have != want {
+		utils.Fatalf("chain config digest mismatch: have %x, datadir %x", have, want)
+	}
+	fmt.Println("Genesis matches the data directory")
+	return nil
+}
+
+func dumpGenesis(ctx *cli.Context) error {
+	stack := utils.MakeNode(ctx, clientIdentifier, gitCommit)
+	chainDb := utils.MakeChainDatabase(ctx, stack)
+	defer chainDb.Close()
+
+	var (
+		spec *core.GenesisSpec
+		err  error
+	)
+	if builtin := builtinGenesis(ctx); builtin == "" && core.GetCanonicalHash(chainDb, 0) != (common.Hash{}) {
+		spec, err = core.ReadGenesisSpec(chainDb)
+	} else {
+		if builtin == "" {
+			builtin = core.DefaultGenesisBlock()
+		}
+		spec = new(core.GenesisSpec)
+		err = json.Unmarshal([]byte(builtin), spec)
+	}
+	if err != nil {
+		utils.Fatalf("failed to assemble genesis specification: %v", err)
+	}
+	spec.ChainConfig = utils.MakeChainConfigFromDb(ctx, chainDb)
+
+	blob, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		utils.Fatalf("failed to encode genesis specification: %v", err)
+	}
+	fmt.Println(string(blob))
+	return nil
+}
+
+// builtinGenesis returns the built-in genesis specification forced by the network
+// selection flags, or an empty string if the data directory decides.
+func builtinGenesis(ctx *cli.Context) string {
+	switch {
+	case ctx.GlobalBool(utils.OlympicFlag.Name):
+		return core.OlympicGenesisBlock()
+	case ctx.GlobalBool(utils.DevModeFlag.Name):
+		return core.DevGenesisBlock()
+	case ctx.GlobalBool(utils.TestNetFlag.Name):
+		return core.DefaultTestnetGenesisBlock()
+	}
+	return ""
+}
+
+// chainConfigDigest hashes the canonical JSON encoding of a chain configuration,
+// returning the zero hash if no configuration is given.
+func chainConfigDigest(config *params.ChainConfig) common.Hash {
+	if config == nil {
+		return common.Hash{}
+	}
+	blob, err := json.Marshal(config)
+	if err != nil {
+		utils.Fatalf("failed to encode chain configuration: %v", err)
+	}
+	return crypto.Keccak256Hash(blob)
+}
+
 // hashish returns true for strings that look like hashes.
 func hashish(x string) bool {
 	_, err := strconv.Atoi(x)
@@ -0,0 +1,284 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of go-ur.
+//
+// go-ur is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ur is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ur. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ur-technology/go-ur/cmd/utils"
+	"github.com/ur-technology/go-ur/eth"
+	"github.com/ur-technology/go-ur/logger"
+	"github.com/ur-technology/go-ur/logger/glog"
+	"github.com/ur-technology/go-ur/node"
+	"github.com/ur-technology/go-ur/p2p/discover"
+	"github.com/ur-technology/go-ur/params"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var dumpConfigCommand = cli.Command{
+	Action:    dumpConfig,
+	Name:      "dumpconfig",
+	Usage:     "Show the effective configuration as a TOML file",
+	ArgsUsage: " ",
+	Category:  "MISCELLANEOUS COMMANDS",
+	Description: `
+Prints every option accepted on the command line in the TOML format read by
+--config, grouped by the sections of the help output. Options set on the
+command line or in the loaded config file are listed with their values, all
+others are commented out, showing their defaults.
+`,
+}
+
+// unconfigurableFlags lists the flags that can't be set from a config file.
+var unconfigurableFlags = map[string]bool{
+	utils.ConfigFileFlag.Name: true,
+	"help":                    true,
+}
+
+// reloadableOptions lists the options that take effect when the config file is
+// reloaded, all others are only applied on restart. The log levels are set by
+// the flags of internal/debug themselves.
+var reloadableOptions = map[string]bool{
+	"verbosity":                            true,
+	"vmodule":                              true,
+	utils.TxPoolAccountSlotsFlag.Name:      true,
+	utils.TxPoolGlobalSlotsFlag.Name:       true,
+	utils.TxPoolAccountQueueFlag.Name:      true,
+	utils.TxPoolGlobalQueueFlag.Name:       true,
+	utils.TxPoolLifetimeFlag.Name:          true,
+	utils.TxPoolPriceBumpFlag.Name:         true,
+	utils.MinerExtraDataFlag.Name:          true,
+	utils.MinerRecommitFlag.Name:           true,
+	utils.GpoMinGasPriceFlag.Name:          true,
+	utils.GpoMaxGasPriceFlag.Name:          true,
+	utils.GpoFullBlockRatioFlag.Name:       true,
+	utils.GpobaseStepDownFlag.Name:         true,
+	utils.GpobaseStepUpFlag.Name:           true,
+	utils.GpobaseCorrectionFactorFlag.Name: true,
+	utils.GpoBlocksFlag.Name:               true,
+	utils.GpoPercentileFlag.Name:           true,
+	utils.RPCTimeoutsFlag.Name:             true,
+	utils.RPCBatchRequestLimitFlag.Name:    true,
+	utils.RPCBatchResponseMaxSizeFlag.Name: true,
+	utils.StaticNodesFlag.Name:             true,
+	utils.TrustedNodesFlag.Name:            true,
+}
+
+// configFileOptions tracks the options set from the config file rather than on
+// the command line, only those are overridden by reloads.
+var configFileOptions = make(map[string]bool)
+
+// flagName returns the primary name of a flag, without its aliases.
+func flagName(flag cli.Flag) string {
+	return strings.TrimSpace(strings.Split(flag.GetName(), ",")[0])
+}
+
+// configSections returns the flags that can be set in a config file, grouped
+// into sections the same way they are in the help output.
+func configSections() []flagGroup {
+	var (
+		groups      []flagGroup
+		categorized = make(map[string]bool)
+	)
+	for _, group := range AppHelpFlagGroups {
+		section := flagGroup{Name: strings.ToLower(strings.Replace(group.Name, " ", "-", -1))}
+		for _, flag := range group.Flags {
+			if name := flagName(flag); !unconfigurableFlags[name] && !categorized[name] {
+				section.Flags = append(section.Flags, flag)
+				categorized[name] = true
+			}
+		}
+		groups = append(groups, section)
+	}
+	// Uncategorized flags end up in the last section, as in the help output
+	for _, flag := range app.Flags {
+		if name := flagName(flag); !unconfigurableFlags[name] && !categorized[name] {
+			groups[len(groups)-1].Flags = append(groups[len(groups)-1].Flags, flag)
+			categorized[name] = true
+		}
+	}
+	return groups
+}
+
+// checkConfigSections verifies that every entry names a known option and is
+// listed under the section the option belongs to.
+func checkConfigSections(entries []utils.ConfigEntry) error {
+	sections := make(map[string]string)
+	for _, section := range configSections() {
+		for _, flag := range section.Flags {
+			sections[flagName(flag)] = section.Name
+		}
+	}
+	for _, entry := range entries {
+		section, ok := sections[entry.Key]
+		if !ok {
+			return fmt.Errorf("line %d: unknown option %q", entry.Line, entry.Key)
+		}
+		if entry.Section != section {
+			return fmt.Errorf("line %d: option %q belongs in section [%s]", entry.Line, entry.Key, section)
+		}
+	}
+	return nil
+}
+
+// loadConfigFile sets all flags listed in the --config file that weren't given
+// on the command line. It must run before any other code inspects the flags, as
+// the flags set by the file are indistinguishable from command line ones after.
+func loadConfigFile(ctx *cli.Context) {
+	path := ctx.GlobalString(utils.ConfigFileFlag.Name)
+	if path == "" {
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		utils.Fatalf("Failed to open config file: %v", err)
+	}
+	defer file.Close()
+
+	entries, err := utils.ReadConfig(file)
+	if err != nil {
+		utils.Fatalf("Invalid config file %s: %v", path, err)
+	}
+	if err := checkConfigSections(entries); err != nil {
+		utils.Fatalf("Invalid config file %s: %v", path, err)
+	}
+	for _, entry := range entries {
+		if ctx.IsSet(entry.Key) {
+			continue
+		}
+		if err := ctx.GlobalSet(entry.Key, fmt.Sprint(entry.Value)); err != nil {
+			utils.Fatalf("Invalid config file %s: line %d: option %q: %v", path, entry.Line, entry.Key, err)
+		}
+		configFileOptions[entry.Key] = true
+	}
+}
+
+// reloadConfigFile re-reads the --config file and applies its reloadable options
+// to the running node. Options given on the command line keep precedence, while
+// options removed from the file keep their current values.
+func reloadConfigFile(ctx *cli.Context, stack *node.Node) error {
+	path := ctx.GlobalString(utils.ConfigFileFlag.Name)
+	if path == "" {
+		return errors.New("no config file specified")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	entries, err := utils.ReadConfig(file)
+	if err != nil {
+		return fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+	// Validate the options that can't be checked by the flags before changing any
+	if err := checkConfigSections(entries); err != nil {
+		return fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+	for _, entry := range entries {
+		if entry.Key == utils.RPCTimeoutsFlag.Name {
+			if _, err := utils.ParseRPCTimeouts(fmt.Sprint(entry.Value)); err != nil {
+				return fmt.Errorf("invalid config file %s: line %d: option %q: %v", path, entry.Line, entry.Key, err)
+			}
+		}
+		if entry.Key == utils.MinerExtraDataFlag.Name {
+			if size := len(fmt.Sprint(entry.Value)); uint64(size) > params.MaximumExtraDataSize.Uint64() {
+				return fmt.Errorf("invalid config file %s: line %d: option %q: %d bytes exceed the maximum of %v", path, entry.Line, entry.Key, size, params.MaximumExtraDataSize)
+			}
+		}
+		if entry.Key == utils.StaticNodesFlag.Name || entry.Key == utils.TrustedNodesFlag.Name {
+			for _, url := range utils.SplitNodeURLs(fmt.Sprint(entry.Value)) {
+				if _, err := discover.ParseNode(url); err != nil {
+					return fmt.Errorf("invalid config file %s: line %d: option %q: node URL %s: %v", path, entry.Line, entry.Key, url, err)
+				}
+			}
+		}
+	}
+	for _, entry := range entries {
+		if !reloadableOptions[entry.Key] {
+			glog.V(logger.Debug).Infof("Config option %q only applies on restart", entry.Key)
+			continue
+		}
+		if ctx.GlobalIsSet(entry.Key) && !configFileOptions[entry.Key] {
+			continue
+		}
+		if err := ctx.GlobalSet(entry.Key, fmt.Sprint(entry.Value)); err != nil {
+			return fmt.Errorf("invalid config file %s: line %d: option %q: %v", path, entry.Line, entry.Key, err)
+		}
+		configFileOptions[entry.Key] = true
+	}
+	// Log levels are already applied, push the rest to the running services
+	var ethereum *eth.Ethereum
+	if err := stack.Service(&ethereum); err == nil {
+		ethereum.TxPool().SetLimits(utils.MakeTxPoolLimits(ctx))
+		ethereum.GasPriceOracle().SetParams(utils.MakeGasPriceOracleParams(ctx))
+		ethereum.Miner().SetRecommitInterval(ctx.GlobalDuration(utils.MinerRecommitFlag.Name))
+		if ctx.GlobalIsSet(utils.MinerExtraDataFlag.Name) {
+			ethereum.Miner().SetExtra([]byte(ctx.GlobalString(utils.MinerExtraDataFlag.Name)))
+		}
+	}
+	static, trusted := utils.SplitNodeURLs(ctx.GlobalString(utils.StaticNodesFlag.Name)), utils.SplitNodeURLs(ctx.GlobalString(utils.TrustedNodesFlag.Name))
+	if err := stack.SetPersistentNodes(static, trusted); err != nil && err != node.ErrNodeStopped {
+		return err
+	}
+	timeouts, _ := utils.ParseRPCTimeouts(ctx.GlobalString(utils.RPCTimeoutsFlag.Name))
+	stack.SetRPCLimits(timeouts, ctx.GlobalInt(utils.RPCBatchRequestLimitFlag.Name), ctx.GlobalInt(utils.RPCBatchResponseMaxSizeFlag.Name))
+
+	glog.V(logger.Info).Infof("Reloaded configuration from %s", path)
+	return nil
+}
+
+func dumpConfig(ctx *cli.Context) error {
+	if err := writeConfigFile(ctx, os.Stdout); err != nil {
+		utils.Fatalf("Failed to write config: %v", err)
+	}
+	return nil
+}
+
+// writeConfigFile writes the effective value of every configurable option in the
+// format read by loadConfigFile, commenting out the ones left at their defaults.
+func writeConfigFile(ctx *cli.Context, w io.Writer) error {
+	var entries []utils.ConfigEntry
+	for _, section := range configSections() {
+		for _, flag := range section.Flags {
+			name := flagName(flag)
+			entry := utils.ConfigEntry{
+				Section: section.Name,
+				Key:     name,
+				Default: !ctx.GlobalIsSet(name),
+			}
+			switch flag.(type) {
+			case cli.BoolFlag:
+				entry.Value = ctx.GlobalBool(name)
+			case cli.IntFlag:
+				entry.Value = ctx.GlobalInt(name)
+			case cli.Uint64Flag:
+				entry.Value = ctx.GlobalUint64(name)
+			case cli.DurationFlag:
+				entry.Value = ctx.GlobalDuration(name).String()
+			default:
+				entry.Value = ctx.GlobalString(name)
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return utils.WriteConfig(w, entries)
+}
@@ -0,0 +1,215 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of go-ur.
+//
+// go-ur is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ur is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ur. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ur-technology/go-ur/cmd/utils"
+	"github.com/ur-technology/go-ur/node"
+	"gopkg.in/urfave/cli.v1"
+)
+
+const testConfig = `
+# Options given on the command line take precedence
+[networking]
+maxpeers = 7
+
+[api-and-console]
+rpc = true
+rpcport = 1234
+`
+
+func writeTestConfig(t *testing.T, dir, config string) string {
+	path := filepath.Join(dir, "config.toml")
+	if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDumpConfig(t *testing.T) {
+	datadir := tmpdir(t)
+	defer os.RemoveAll(datadir)
+
+	config := writeTestConfig(t, datadir, testConfig)
+	gur := runGur(t, "--datadir", datadir, "--config", config, "--rpcport", "5555", "dumpconfig")
+	defer gur.expectExit()
+
+	gur.expectRegexp(`(?s)^\[ur\]\ndatadir = "` + regexp.QuoteMeta(datadir) + `"\n.*` +
+		`\[api-and-console\]\nrpc = true\n.*# rpcaddr = "localhost"\nrpcport = 5555\n.*` +
+		`\[networking\]\n.*maxpeers = 7\n.*$`)
+}
+
+func TestConfigUnknownOption(t *testing.T) {
+	datadir := tmpdir(t)
+	defer os.RemoveAll(datadir)
+
+	config := writeTestConfig(t, datadir, testConfig+"nosuchflag = 1\n")
+	gur := runGur(t, "--datadir", datadir, "--config", config, "dumpconfig")
+	defer gur.expectExit()
+
+	gur.setTemplateFunc("config", func() string { return config })
+	gur.expect(`
+Fatal: Invalid config file {{config}}: line 9: unknown option "nosuchflag"
+`)
+}
+
+func TestConfigWrongSection(t *testing.T) {
+	datadir := tmpdir(t)
+	defer os.RemoveAll(datadir)
+
+	config := writeTestConfig(t, datadir, testConfig+"maxpeers = 1\n")
+	gur := runGur(t, "--datadir", datadir, "--config", config, "dumpconfig")
+	defer gur.expectExit()
+
+	gur.setTemplateFunc("config", func() string { return config })
+	gur.expect(`
+Fatal: Invalid config file {{config}}: line 9: option "maxpeers" belongs in section [networking]
+`)
+}
+
+// newConfigContext parses the given command line into a context of the app,
+// forgetting the options loaded from config files by earlier tests.
+func newConfigContext(t *testing.T, args ...string) *cli.Context {
+	configFileOptions = make(map[string]bool)
+
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	for _, f := range app.Flags {
+		f.Apply(set)
+	}
+	if err := set.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return cli.NewContext(app, set, nil)
+}
+
+func TestDumpConfigRoundTrip(t *testing.T) {
+	datadir := tmpdir(t)
+	defer os.RemoveAll(datadir)
+
+	// Dump the defaults, uncommenting them so every option is loaded back
+	dump := new(bytes.Buffer)
+	if err := writeConfigFile(newConfigContext(t, "--datadir", datadir), dump); err != nil {
+		t.Fatalf("failed to dump config: %v", err)
+	}
+	want := strings.Replace(dump.String(), "# ", "", -1)
+	config := writeTestConfig(t, datadir, want)
+
+	ctx := newConfigContext(t, "--config", config)
+	loadConfigFile(ctx)
+
+	have := new(bytes.Buffer)
+	if err := writeConfigFile(ctx, have); err != nil {
+		t.Fatalf("failed to dump loaded config: %v", err)
+	}
+	if have.String() != want {
+		t.Errorf("config changed by round trip:\nhave:\n%s\nwant:\n%s", have, want)
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	datadir := tmpdir(t)
+	defer os.RemoveAll(datadir)
+
+	config := writeTestConfig(t, datadir, `
+[api-and-console]
+"rpc.batch-request-limit" = 10
+"rpc.batch-response-max-size" = 2000
+`)
+	ctx := newConfigContext(t, "--config", config, "--rpc.batch-request-limit", "7")
+	loadConfigFile(ctx)
+
+	stack, err := node.New(&node.Config{DataDir: datadir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Reloadable options are updated, unless given on the command line
+	writeTestConfig(t, datadir, `
+[api-and-console]
+"rpc.batch-request-limit" = 20
+"rpc.batch-response-max-size" = 3000
+
+[networking]
+maxpeers = 99
+`)
+	if err := reloadConfigFile(ctx, stack); err != nil {
+		t.Fatalf("failed to reload config: %v", err)
+	}
+	if limit := ctx.GlobalInt(utils.RPCBatchRequestLimitFlag.Name); limit != 7 {
+		t.Errorf("command line option overridden: have %d, want %d", limit, 7)
+	}
+	if size := ctx.GlobalInt(utils.RPCBatchResponseMaxSizeFlag.Name); size != 3000 {
+		t.Errorf("config file option not reloaded: have %d, want %d", size, 3000)
+	}
+	if peers := ctx.GlobalInt(utils.MaxPeersFlag.Name); peers == 99 {
+		t.Errorf("non-reloadable option reloaded")
+	}
+	// Invalid files are rejected without changing anything
+	writeTestConfig(t, datadir, `
+[api-and-console]
+"rpc.batch-response-max-size" = 4000
+rpctimeouts = "eth"
+`)
+	if err := reloadConfigFile(ctx, stack); err == nil {
+		t.Fatalf("invalid config reloaded")
+	}
+	if size := ctx.GlobalInt(utils.RPCBatchResponseMaxSizeFlag.Name); size != 3000 {
+		t.Errorf("invalid config partially applied: have %d, want %d", size, 3000)
+	}
+	// Extra data too long for a block header is rejected
+	writeTestConfig(t, datadir, `
+[miner]
+"miner.extradata" = "this extra data is way longer than the 32 bytes allowed"
+`)
+	if err := reloadConfigFile(ctx, stack); err == nil {
+		t.Fatalf("oversized extra data reloaded")
+	}
+	if extra := ctx.GlobalString(utils.MinerExtraDataFlag.Name); extra != "" {
+		t.Errorf("oversized extra data applied: %q", extra)
+	}
+	// Static and trusted nodes are reloaded, unless malformed
+	enode := "enode://a979fb575495b8d6db44f750317d0f4622bf4c2aa3365d6af7c284339968eef29b69ad0dce72a4d8db5ebb4968de0e3bec910127f134779fbcb0cb6d3331163c@52.16.188.185:30303"
+	writeTestConfig(t, datadir, `
+[networking]
+staticnodes = "`+enode+`"
+trustednodes = "enode://nosuchnode@127.0.0.1:30303"
+`)
+	if err := reloadConfigFile(ctx, stack); err == nil {
+		t.Fatalf("malformed trusted node reloaded")
+	}
+	if static := ctx.GlobalString(utils.StaticNodesFlag.Name); static != "" {
+		t.Errorf("static nodes of invalid config applied: %q", static)
+	}
+	writeTestConfig(t, datadir, `
+[networking]
+staticnodes = "`+enode+`"
+`)
+	if err := reloadConfigFile(ctx, stack); err != nil {
+		t.Fatalf("failed to reload static nodes: %v", err)
+	}
+	if static := ctx.GlobalString(utils.StaticNodesFlag.Name); static != enode {
+		t.Errorf("static nodes not reloaded: have %q, want %q", static, enode)
+	}
+}
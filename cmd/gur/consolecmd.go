@@ -29,11 +29,14 @@ import (
 )
 
 var (
+	consoleFlags = []cli.Flag{utils.JSpathFlag, utils.ExecFlag, utils.PreloadJSFlag}
+
 	consoleCommand = cli.Command{
-		Action:    localConsole,
+		Action:    utils.MigrateFlags(localConsole),
 		Name:      "console",
 		Usage:     "Start an interactive JavaScript environment",
 		ArgsUsage: "", // TODO: Write this!
+		Flags:     consoleFlags,
 		Category:  "CONSOLE COMMANDS",
 		Description: `
 The Gur console is an interactive shell for the JavaScript runtime environment
@@ -42,16 +45,23 @@ See https://github.com/ur-technology/go-ur/wiki/Javascipt-Console
 `,
 	}
 	attachCommand = cli.Command{
-		Action:    remoteConsole,
+		Action:    utils.MigrateFlags(remoteConsole),
 		Name:      "attach",
 		Usage:     "Start an interactive JavaScript environment (connect to node)",
-		ArgsUsage: "", // TODO: Write this!
+		ArgsUsage: "[endpoint]",
+		Flags:     consoleFlags,
 		Category:  "CONSOLE COMMANDS",
 		Description: `
 The Gur console is an interactive shell for the JavaScript runtime environment
 which exposes a node admin interface as well as the Ðapp JavaScript API.
 See https://github.com/ur-technology/go-ur/wiki/Javascipt-Console.
 This command allows to open a console on a running gur node.
+
+    gur attach --preload checks.js --exec 'checkPeers(3)' [endpoint]
+
+With --exec the statement is evaluated and the console exits, with a non-zero
+exit status if the statement throws. Scripts listed in --preload are loaded
+first, so they can define helper functions for such one-shot checks.
 `,
 	}
 	javascriptCommand = cli.Command{
@@ -94,7 +104,10 @@ func localConsole(ctx *cli.Context) error {
 
 	// If only a short execution was requested, evaluate and return
 	if script := ctx.GlobalString(utils.ExecFlag.Name); script != "" {
-		console.Evaluate(script)
+		if err := console.Evaluate(script); err != nil {
+			console.Stop(false)
+			utils.Fatalf("Failed to evaluate --%s statement: %v", utils.ExecFlag.Name, err)
+		}
 		return nil
 	}
 	// Otherwise print the welcome screen and enter interactive mode
@@ -126,7 +139,10 @@ func remoteConsole(ctx *cli.Context) error {
 
 	// If only a short execution was requested, evaluate and return
 	if script := ctx.GlobalString(utils.ExecFlag.Name); script != "" {
-		console.Evaluate(script)
+		if err := console.Evaluate(script); err != nil {
+			console.Stop(false)
+			utils.Fatalf("Failed to evaluate --%s statement: %v", utils.ExecFlag.Name, err)
+		}
 		return nil
 	}
 	// Otherwise print the welcome screen and enter interactive mode
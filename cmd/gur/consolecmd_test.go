@@ -18,6 +18,7 @@ package main
 
 import (
 	"crypto/rand"
+	"io/ioutil"
 	"math/big"
 	"os"
 	"path/filepath"
@@ -49,7 +50,7 @@ func TestConsoleWelcome(t *testing.T) {
 	gur.setTemplateFunc("gurver", func() string { return params.Version })
 	gur.setTemplateFunc("niltime", func() string { return time.Unix(0x5800E836, 0).Format(time.RFC1123) })
 	gur.setTemplateFunc("apis", func() []string {
-		apis := append(strings.Split(rpc.DefaultIPCApis, ","), rpc.MetadataApi)
+		apis := append(strings.Split(rpc.DefaultIPCApis, ","), rpc.MetadataApi, "urext")
 		sort.Strings(apis)
 		return apis
 	})
@@ -140,7 +141,7 @@ func testAttachWelcome(t *testing.T, gur *testgur, endpoint string) {
 	attach.setTemplateFunc("apis", func() []string {
 		var apis []string
 		if strings.HasPrefix(endpoint, "ipc") {
-			apis = append(strings.Split(rpc.DefaultIPCApis, ","), rpc.MetadataApi)
+			apis = append(strings.Split(rpc.DefaultIPCApis, ","), rpc.MetadataApi, "urext")
 		} else {
 			apis = append(strings.Split(rpc.DefaultHTTPApis, ","), rpc.MetadataApi)
 		}
@@ -163,6 +164,46 @@ at block: 0 ({{niltime}}){{if ipc}}
 	attach.expectExit()
 }
 
+// Tests that one-shot statements can be run against a running node, using the
+// helpers defined by preloaded scripts, with failures reported in the exit status.
+func TestAttachExec(t *testing.T) {
+	ws := tmpdir(t)
+	defer os.RemoveAll(ws)
+	ipc := filepath.Join(ws, "gur.ipc")
+	if runtime.GOOS == "windows" {
+		ipc = `\\.\pipe\gur` + strconv.Itoa(trulyRandInt(100000, 999999))
+	}
+	gur := runGur(t,
+		"--port", "0", "--maxpeers", "0", "--nodiscover", "--nat", "none", "--ipcpath", ipc)
+	defer func() {
+		gur.interrupt()
+		gur.expectExit()
+	}()
+	time.Sleep(2 * time.Second) // Simple way to wait for the RPC endpoint to open
+
+	preload := filepath.Join(ws, "checks.js")
+	script := "function checkHead(min) { if (eth.blockNumber < min) throw 'head behind'; return 'ok'; }"
+	if err := ioutil.WriteFile(preload, []byte(script), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// A passing check prints its result and exits cleanly
+	attach := runGur(t, "attach", "--preload", preload, "--exec", "checkHead(0)", "ipc:"+ipc)
+	attach.expect(`
+"ok"
+`)
+	attach.expectExit()
+	if !attach.cmd.ProcessState.Success() {
+		t.Errorf("passing check exited with failure")
+	}
+	// A throwing check fails the command
+	attach = runGur(t, "attach", "--preload", preload, "--exec", "checkHead(1)", "ipc:"+ipc)
+	attach.expectRegexp(`(?s)^.*head behind.*$`)
+	attach.expectExit()
+	if attach.cmd.ProcessState.Success() {
+		t.Errorf("failing check exited successfully")
+	}
+}
+
 // trulyRandInt generates a crypto random integer used by the console tests to
 // not clash network ports with other tests running cocurrently.
 func trulyRandInt(lo, hi int) int {
@@ -0,0 +1,174 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of go-ur.
+//
+// go-ur is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ur is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ur. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"github.com/ur-technology/go-ur/cmd/utils"
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core"
+	"github.com/ur-technology/go-ur/ethdb"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	dbCommand = cli.Command{
+		Name:      "db",
+		Usage:     "Inspect and maintain the chain database",
+		ArgsUsage: "",
+		Category:  "BLOCKCHAIN COMMANDS",
+		Description: `
+Low level operations on the chain database of the node. The node must not be
+running while these commands are used.
+`,
+		Subcommands: []cli.Command{
+			{
+				Action: dbStats,
+				Name:   "stats",
+				Usage:  "Print the LevelDB internal statistics",
+				Description: `
+Prints the per level table counts, sizes and compaction statistics maintained
+by LevelDB, without scanning the database.
+`,
+			},
+			{
+				Action: dbInspect,
+				Name:   "inspect",
+				Usage:  "Break the database contents down by key space",
+				Description: `
+Iterates over the entire database and reports the number of entries and their
+total size for every kind of data stored (headers, bodies, receipts, state,
+etc). This may take a long time on large databases.
+`,
+			},
+			{
+				Action: dbCompact,
+				Name:   "compact",
+				Usage:  "Compact the entire database",
+				Description: `
+Triggers a manual compaction of the whole key space, reclaiming the space of
+deleted and overwritten entries.
+`,
+			},
+			{
+				Action: dbFreeze,
+				Name:   "freeze",
+				Usage:  "Move old chain segments into the ancient store",
+				Description: `
+Moves the headers, bodies and receipts of all canonical blocks older than
+--ancient.threshold blocks from LevelDB into the ancient store, migrating a
+database created before the ancient store existed. The node does the same in
+the background while running, in smaller batches.
+`,
+			},
+		},
+	}
+)
+
+// openChainDatabase opens the LevelDB chain database of the configured node.
+func openChainDatabase(ctx *cli.Context) *ethdb.LDBDatabase {
+	stack := makeFullNode(ctx)
+	db, ok := utils.MakeChainDatabase(ctx, stack).(*ethdb.LDBDatabase)
+	if !ok {
+		utils.Fatalf("Chain database is not a LevelDB database")
+	}
+	return db
+}
+
+func dbStats(ctx *cli.Context) error {
+	db := openChainDatabase(ctx)
+	defer db.Close()
+
+	stats, err := db.LDB().GetProperty("leveldb.stats")
+	if err != nil {
+		utils.Fatalf("Failed to read database stats: %v", err)
+	}
+	fmt.Println(stats)
+	return nil
+}
+
+func dbInspect(ctx *cli.Context) error {
+	db := openChainDatabase(ctx)
+	defer db.Close()
+
+	start := time.Now()
+	stats, err := core.InspectDatabase(db)
+	if err != nil {
+		utils.Fatalf("Failed to inspect database: %v", err)
+	}
+	var (
+		count uint64
+		size  common.StorageSize
+	)
+	fmt.Printf("%-24s %12s %14s\n", "Category", "Entries", "Size")
+	for _, stat := range stats {
+		fmt.Printf("%-24s %12d %14v\n", stat.Category, stat.Count, stat.Size)
+		count += stat.Count
+		size += stat.Size
+	}
+	fmt.Printf("%-24s %12d %14v\n", "Total", count, size)
+	fmt.Printf("\nInspection done in %v.\n", time.Since(start))
+	return nil
+}
+
+func dbCompact(ctx *cli.Context) error {
+	db := openChainDatabase(ctx)
+	defer db.Close()
+
+	start := time.Now()
+	fmt.Println("Compacting entire database...")
+	if err := db.LDB().CompactRange(util.Range{}); err != nil {
+		utils.Fatalf("Compaction failed: %v", err)
+	}
+	fmt.Printf("Compaction done in %v.\n\n", time.Since(start))
+
+	stats, err := db.LDB().GetProperty("leveldb.stats")
+	if err != nil {
+		utils.Fatalf("Failed to read database stats: %v", err)
+	}
+	fmt.Println(stats)
+	return nil
+}
+
+func dbFreeze(ctx *cli.Context) error {
+	db := openChainDatabase(ctx)
+	defer db.Close()
+
+	var (
+		threshold = ctx.GlobalUint64(utils.AncientThresholdFlag.Name)
+		start     = time.Now()
+		total     uint64
+	)
+	fmt.Println("Freezing ancient chain segments...")
+	for {
+		// Freeze in batches so an interrupted run keeps its progress
+		frozen, err := core.FreezeAncients(db, threshold, 65536)
+		total += frozen
+		if err != nil {
+			utils.Fatalf("Freezing failed after %d blocks: %v", total, err)
+		}
+		if frozen == 0 {
+			break
+		}
+		fmt.Printf("Froze %d blocks, %d in the ancient store\n", total, db.Ancients())
+	}
+	fmt.Printf("Froze %d blocks in %v, ancient store size %v.\n", total, time.Since(start), common.StorageSize(db.Freezer().Size()))
+	return nil
+}
@@ -0,0 +1,397 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of go-ur.
+//
+// go-ur is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ur is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ur. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ur-technology/go-ur/cmd/utils"
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/ethdb"
+	"github.com/ur-technology/go-ur/p2p/discover"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var doctorCommand = cli.Command{
+	Action:    doctor,
+	Name:      "doctor",
+	Usage:     "Diagnose common connectivity and setup problems",
+	ArgsUsage: " ",
+	Category:  "MISCELLANEOUS COMMANDS",
+	Description: `
+Checks the environment the node runs in for the usual causes of a node not
+finding peers or not syncing, using the same flags as the node itself:
+
+    - the data directory exists, is writable and isn't locked by another node
+    - the disk sustains the write throughput needed to keep up with the chain
+    - the P2P, HTTP-RPC and WS-RPC ports can be bound
+    - the NAT configuration yields an external address peers can dial
+    - the system clock is in sync, as peers reject a drifting node
+    - the bootnodes resolve and are reachable
+
+Every problem found is printed along with a suggested fix. The command exits
+with a failure if any check fails, warnings alone don't fail it.
+`,
+}
+
+const (
+	doctorDialTimeout   = 5 * time.Second
+	doctorDiskTestSize  = 64 * 1024 * 1024 // Bytes written to measure disk throughput
+	doctorDiskMinSpeed  = 20               // MB/s below which the disk is reported slow
+	doctorNATMaxTimeout = 10 * time.Second // Time allowed for discovering a NAT device
+)
+
+// doctorStatus is the outcome of a single diagnostic check.
+type doctorStatus int
+
+const (
+	doctorOK doctorStatus = iota
+	doctorWarn
+	doctorFail
+)
+
+func (s doctorStatus) String() string {
+	switch s {
+	case doctorOK:
+		return " OK "
+	case doctorWarn:
+		return "WARN"
+	default:
+		return "FAIL"
+	}
+}
+
+// doctorFinding is the result of a diagnostic check, along with the suggested fix
+// if it found a problem.
+type doctorFinding struct {
+	status  doctorStatus
+	message string
+	fix     string
+}
+
+func doctorOk(format string, args ...interface{}) doctorFinding {
+	return doctorFinding{status: doctorOK, message: fmt.Sprintf(format, args...)}
+}
+
+func doctorProblem(status doctorStatus, fix string, format string, args ...interface{}) doctorFinding {
+	return doctorFinding{status: status, message: fmt.Sprintf(format, args...), fix: fix}
+}
+
+func doctor(ctx *cli.Context) error {
+	checks := []struct {
+		name string
+		run  func(*cli.Context) []doctorFinding
+	}{
+		{"Data directory", doctorDataDir},
+		{"Disk throughput", doctorDisk},
+		{"Port bindings", doctorPorts},
+		{"NAT reachability", doctorNAT},
+		{"Clock drift", doctorClock},
+		{"Bootnodes", doctorBootnodes},
+	}
+	var warnings, failures int
+	for _, check := range checks {
+		fmt.Printf("%s:\n", check.name)
+		for _, finding := range check.run(ctx) {
+			fmt.Printf("  [%v] %s\n", finding.status, finding.message)
+			if finding.fix != "" {
+				fmt.Printf("         -> %s\n", finding.fix)
+			}
+			switch finding.status {
+			case doctorWarn:
+				warnings++
+			case doctorFail:
+				failures++
+			}
+		}
+	}
+	fmt.Printf("\n%d failures, %d warnings\n", failures, warnings)
+	if failures > 0 {
+		return fmt.Errorf("%d checks failed", failures)
+	}
+	return nil
+}
+
+// doctorDataDir checks that the data directory is usable and not in use by a
+// running node.
+func doctorDataDir(ctx *cli.Context) []doctorFinding {
+	datadir := utils.MakeDataDir(ctx)
+	if !common.FileExist(datadir) {
+		return []doctorFinding{doctorProblem(doctorWarn, `Initialise the chain with "gur init" or start the node to create it, or point --datadir to the existing one`,
+			"%s does not exist", datadir)}
+	}
+	findings := []doctorFinding{}
+
+	file, err := ioutil.TempFile(datadir, "doctor")
+	if err != nil {
+		return append(findings, doctorProblem(doctorFail, "Fix the permissions of the directory or run gur as its owner",
+			"%s is not writable: %v", datadir, err))
+	}
+	file.Close()
+	os.Remove(file.Name())
+	findings = append(findings, doctorOk("%s is writable", datadir))
+
+	chaindata := filepath.Join(datadir, utils.ChainDbName(ctx))
+	if !common.FileExist(chaindata) {
+		return append(findings, doctorProblem(doctorWarn, `Initialise the chain with "gur init" or let the node sync from scratch`,
+			"No chain database in %s", chaindata))
+	}
+	return append(findings, doctorChainDatabase(chaindata, utils.MakeDatabaseKey(ctx)))
+}
+
+// doctorChainDatabase checks that the chain database opens cleanly, decrypting
+// it with the given key if set.
+func doctorChainDatabase(chaindata string, key []byte) doctorFinding {
+	err := ethdb.CheckLDBDatabase(chaindata, key)
+	switch {
+	case err == nil:
+		return doctorOk("Chain database %s opens cleanly", chaindata)
+
+	case err == ethdb.ErrDatabaseEncrypted:
+		return doctorProblem(doctorWarn, "Pass the key of the database with --datadir.key to check it",
+			"Chain database %s is encrypted", chaindata)
+
+	case err == ethdb.ErrDatabaseKey:
+		return doctorProblem(doctorFail, "Pass the key the database was created with to --datadir.key",
+			"Chain database %s can't be decrypted with the given key", chaindata)
+
+	case err == ethdb.ErrDatabaseNotEncrypted:
+		return doctorProblem(doctorWarn, "Drop --datadir.key, the database is stored in plaintext",
+			"Chain database %s is not encrypted", chaindata)
+
+	case strings.Contains(err.Error(), "resource temporarily unavailable") || strings.Contains(err.Error(), "locked"):
+		return doctorProblem(doctorWarn, "Stop the running node for accurate port checks, or use another --datadir for a second node",
+			"Chain database %s is in use by a running node", chaindata)
+	}
+	return doctorProblem(doctorFail, `Repair the database, or remove it with "gur removedb" and sync again`,
+		"Chain database %s can't be opened: %v", chaindata, err)
+}
+
+// doctorDisk measures the sustained synced write throughput of the data
+// directory's disk.
+func doctorDisk(ctx *cli.Context) []doctorFinding {
+	datadir := utils.MakeDataDir(ctx)
+	if !common.FileExist(datadir) {
+		datadir = os.TempDir()
+	}
+	file, err := ioutil.TempFile(datadir, "doctor")
+	if err != nil {
+		return []doctorFinding{doctorProblem(doctorWarn, "", "Can't measure throughput: %v", err)}
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	chunk := make([]byte, 1024*1024)
+	start := time.Now()
+	for written := 0; written < doctorDiskTestSize; written += len(chunk) {
+		if _, err := file.Write(chunk); err != nil {
+			return []doctorFinding{doctorProblem(doctorFail, "Free up disk space or move --datadir to a larger disk",
+				"Writing to %s failed: %v", datadir, err)}
+		}
+	}
+	if err := file.Sync(); err != nil {
+		return []doctorFinding{doctorProblem(doctorFail, "Check the disk for hardware or filesystem errors", "Syncing to %s failed: %v", datadir, err)}
+	}
+	speed := float64(doctorDiskTestSize) / 1024 / 1024 / time.Since(start).Seconds()
+	if speed < doctorDiskMinSpeed {
+		return []doctorFinding{doctorProblem(doctorWarn, "Move --datadir to a faster disk (preferably an SSD), a slow disk can't keep up with the chain during sync",
+			"Disk writes at %.1f MB/s", speed)}
+	}
+	return []doctorFinding{doctorOk("Disk writes at %.1f MB/s", speed)}
+}
+
+// doctorPorts checks that the listening ports of the node can be bound.
+func doctorPorts(ctx *cli.Context) []doctorFinding {
+	port := ctx.GlobalInt(utils.ListenPortFlag.Name)
+	findings := []doctorFinding{
+		doctorListen("tcp", fmt.Sprintf(":%d", port), "P2P", utils.ListenPortFlag.Name),
+	}
+	if !ctx.GlobalBool(utils.NoDiscoverFlag.Name) {
+		findings = append(findings, doctorListen("udp", fmt.Sprintf(":%d", port), "discovery", utils.ListenPortFlag.Name))
+	}
+	if host := utils.MakeHTTPRpcHost(ctx); host != "" {
+		addr := net.JoinHostPort(host, strconv.Itoa(ctx.GlobalInt(utils.RPCPortFlag.Name)))
+		findings = append(findings, doctorListen("tcp", addr, "HTTP-RPC", utils.RPCPortFlag.Name))
+	}
+	if host := utils.MakeWSRpcHost(ctx); host != "" {
+		addr := net.JoinHostPort(host, strconv.Itoa(ctx.GlobalInt(utils.WSPortFlag.Name)))
+		findings = append(findings, doctorListen("tcp", addr, "WS-RPC", utils.WSPortFlag.Name))
+	}
+	return findings
+}
+
+// doctorListen checks that the given address can be bound.
+func doctorListen(network, addr, what, flag string) doctorFinding {
+	var err error
+	if network == "udp" {
+		var conn net.PacketConn
+		if conn, err = net.ListenPacket(network, addr); err == nil {
+			conn.Close()
+		}
+	} else {
+		var listener net.Listener
+		if listener, err = net.Listen(network, addr); err == nil {
+			listener.Close()
+		}
+	}
+	if err != nil {
+		return doctorProblem(doctorFail, fmt.Sprintf("Stop the process using the port (another node?) or choose another one with --%s", flag),
+			"Can't bind %s %s port %s: %v", what, strings.ToUpper(network), addr, err)
+	}
+	return doctorOk("%s %s port %s is free", what, strings.ToUpper(network), addr)
+}
+
+// doctorNAT checks whether the node has an external address other nodes can
+// connect to.
+func doctorNAT(ctx *cli.Context) []doctorFinding {
+	local := doctorPublicAddress()
+	natif := utils.MakeNAT(ctx)
+	if natif == nil {
+		if local != nil {
+			return []doctorFinding{doctorOk("No NAT traversal, but the host has the public address %v", local)}
+		}
+		return []doctorFinding{doctorProblem(doctorWarn, "Enable NAT traversal with --nat any, or forward the P2P port on the router and set --nat extip:<ip>",
+			"NAT traversal disabled and the host has no public address, other nodes can't connect to it")}
+	}
+	type result struct {
+		ip  net.IP
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		ip, err := natif.ExternalIP()
+		done <- result{ip, err}
+	}()
+	select {
+	case res := <-done:
+		if res.err != nil {
+			return []doctorFinding{doctorProblem(doctorWarn, "Enable UPnP or NAT-PMP on the router, or forward the P2P port and set --nat extip:<ip>",
+				"%v found no external address: %v", natif, res.err)}
+		}
+		return []doctorFinding{doctorOk("%v reports the external address %v", natif, res.ip)}
+	case <-time.After(doctorNATMaxTimeout):
+		return []doctorFinding{doctorProblem(doctorWarn, "Enable UPnP or NAT-PMP on the router, or forward the P2P port and set --nat extip:<ip>",
+			"%v found no NAT device in %v", natif, doctorNATMaxTimeout)}
+	}
+}
+
+// doctorPublicAddress returns the first publicly routable address of the local
+// network interfaces, or nil if there's none.
+func doctorPublicAddress() net.IP {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		ip := ipnet.IP.To4()
+		if ip == nil || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip[0] == 10 ||
+			(ip[0] == 172 && ip[1]&0xf0 == 16) || (ip[0] == 192 && ip[1] == 168) || (ip[0] == 100 && ip[1]&0xc0 == 64) {
+			continue
+		}
+		return ip
+	}
+	return nil
+}
+
+// doctorClock checks the system clock against an NTP server.
+func doctorClock(ctx *cli.Context) []doctorFinding {
+	drift, off, err := discover.ClockDrift()
+	switch {
+	case err != nil:
+		return []doctorFinding{doctorProblem(doctorWarn, "Allow DNS lookups and outbound UDP to port 123 to have the clock checked",
+			"Can't reach an NTP server: %v", err)}
+	case off:
+		return []doctorFinding{doctorProblem(doctorFail, "Enable network time synchronisation in the system settings",
+			"System clock is off by %v, peers will reject the node", drift)}
+	default:
+		return []doctorFinding{doctorOk("System clock is off by %v", drift)}
+	}
+}
+
+// doctorBootnodes checks that the bootnodes resolve and accept connections.
+func doctorBootnodes(ctx *cli.Context) []doctorFinding {
+	var urls []string
+	if ctx.GlobalIsSet(utils.BootnodesFlag.Name) {
+		for _, url := range strings.Split(ctx.GlobalString(utils.BootnodesFlag.Name), ",") {
+			if url = strings.TrimSpace(url); url != "" {
+				urls = append(urls, url)
+			}
+		}
+	} else {
+		for _, node := range utils.MakeBootstrapNodes(ctx) {
+			urls = append(urls, node.String())
+		}
+	}
+	if len(urls) == 0 {
+		return []doctorFinding{doctorProblem(doctorFail, "Set the bootnodes of the network with --bootnodes", "No bootnodes configured")}
+	}
+	var (
+		findings  []doctorFinding
+		reachable int
+	)
+	for _, raw := range urls {
+		finding := doctorBootnode(raw)
+		if finding.status == doctorOK {
+			reachable++
+		}
+		findings = append(findings, finding)
+	}
+	if reachable == 0 {
+		findings = append(findings, doctorProblem(doctorFail, "Allow outbound TCP and UDP connections, or set reachable bootnodes with --bootnodes",
+			"None of the %d bootnodes is reachable, the node can't find peers", len(urls)))
+	}
+	return findings
+}
+
+// doctorBootnode resolves the host of a bootnode URL and dials its TCP port.
+func doctorBootnode(raw string) doctorFinding {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "enode" || u.Host == "" {
+		return doctorProblem(doctorFail, "Fix the bootnode URL, the format is enode://<id>@<host>:<port>", "Invalid bootnode %q", raw)
+	}
+	host, port := u.Hostname(), u.Port()
+	if port == "" {
+		port = "30303"
+	}
+	if net.ParseIP(host) == nil {
+		addrs, err := net.LookupHost(host)
+		if err != nil || len(addrs) == 0 {
+			return doctorProblem(doctorFail, "Check the DNS configuration of the host, or use the IP address of the bootnode",
+				"Bootnode host %s doesn't resolve: %v", host, err)
+		}
+		host = addrs[0]
+	}
+	addr := net.JoinHostPort(host, port)
+	conn, err := net.DialTimeout("tcp", addr, doctorDialTimeout)
+	if err != nil {
+		return doctorProblem(doctorWarn, "The bootnode may be down, otherwise check the firewall for outbound connections", "Bootnode %s unreachable: %v", addr, err)
+	}
+	conn.Close()
+	return doctorOk("Bootnode %s reachable", addr)
+}
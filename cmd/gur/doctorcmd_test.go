@@ -0,0 +1,118 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of go-ur.
+//
+// go-ur is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ur is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ur. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ur-technology/go-ur/ethdb"
+)
+
+// Tests that ports in use are reported as such.
+func TestDoctorListen(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+
+	if finding := doctorListen("tcp", addr, "P2P", "port"); finding.status != doctorFail || finding.fix == "" {
+		t.Errorf("bound port: have status %v fix %q, want failure with fix", finding.status, finding.fix)
+	}
+	listener.Close()
+	if finding := doctorListen("tcp", addr, "P2P", "port"); finding.status != doctorOK {
+		t.Errorf("free port: have status %v (%s), want ok", finding.status, finding.message)
+	}
+}
+
+// Tests that bootnodes are checked for validity and reachability.
+func TestDoctorBootnode(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	id := "a979fb575495b8d6db44f750317d0f4622bf4c2aa3365d6af7c284339968eef29b69ad0dce72a4d8db5ebb4968de0e3bec910127f134779fbcb0cb6d3331163c"
+	tests := []struct {
+		url    string
+		status doctorStatus
+	}{
+		{"enode://" + id + "@" + listener.Addr().String(), doctorOK},
+		{"http://" + listener.Addr().String(), doctorFail},
+		{"enode://" + id + "@host.invalid:30303", doctorFail},
+	}
+	for i, tt := range tests {
+		if finding := doctorBootnode(tt.url); finding.status != tt.status {
+			t.Errorf("test %d: status mismatch: have %v (%s), want %v", i, finding.status, finding.message, tt.status)
+		}
+	}
+}
+
+// Tests that encrypted chain databases are opened through their encryption and
+// not reported as corrupted.
+func TestDoctorChainDatabase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gur-doctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		encrypted = filepath.Join(dir, "encrypted")
+		plain     = filepath.Join(dir, "plain")
+		secret    = []byte("secret")
+	)
+	db, err := ethdb.NewEncryptedLDBDatabase(encrypted, 16, 16, secret)
+	if err != nil {
+		t.Fatalf("failed to create encrypted database: %v", err)
+	}
+	db.Put([]byte("key"), []byte("value"))
+	db.Close()
+
+	if db, err = ethdb.NewLDBDatabase(plain, 16, 16); err != nil {
+		t.Fatalf("failed to create plaintext database: %v", err)
+	}
+	db.Put([]byte("key"), []byte("value"))
+	db.Close()
+
+	tests := []struct {
+		path   string
+		key    []byte
+		status doctorStatus
+	}{
+		{encrypted, secret, doctorOK},
+		{encrypted, nil, doctorWarn},
+		{encrypted, []byte("wrong"), doctorFail},
+		{plain, nil, doctorOK},
+		{plain, secret, doctorWarn},
+	}
+	for i, tt := range tests {
+		finding := doctorChainDatabase(tt.path, tt.key)
+		if finding.status != tt.status {
+			t.Errorf("test %d: status mismatch: have %v (%s), want %v", i, finding.status, finding.message, tt.status)
+		}
+	}
+	// Neither check may have touched the plaintext database
+	if _, err := os.Stat(filepath.Join(plain, "ENCRYPTION")); err == nil {
+		t.Errorf("plaintext database initialized for encryption")
+	}
+}
@@ -82,6 +82,34 @@ var customGenesisTests = []struct {
 		query:  "eth.getBlock(0).nonce",
 		result: "0x0000000000000032",
 	},
+	// Genesis file with seeded signup totals and UR reward parameters
+	{
+		genesis: `{
+			"alloc"      : {},
+			"coinbase"   : "0x0000000000000000000000000000000000000000",
+			"difficulty" : "0x20000",
+			"extraData"  : "",
+			"gasLimit"   : "0x2fefd8",
+			"nonce"      : "0x0000000000000032",
+			"mixhash"    : "0x0000000000000000000000000000000000000000000000000000000000000000",
+			"parentHash" : "0x0000000000000000000000000000000000000000000000000000000000000000",
+			"timestamp"  : "0x00",
+			"nSignups"   : "0x2a",
+			"totalWei"   : "0x10000",
+			"config"     : {
+				"ur": {
+					"blockReward": 1000000000000000000,
+					"privileged" : [{
+						"address" : "0x0000000000000000000000000000000000000001",
+						"receiver": "0x0000000000000000000000000000000000000002",
+						"urff"    : "0x0000000000000000000000000000000000000003"
+					}]
+				}
+			}
+		}`,
+		query:  "eth.getBlock(0).nSignups",
+		result: "42",
+	},
 }
 
 // Tests that initializing Gur with a custom genesis block and chain definitions
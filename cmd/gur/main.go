@@ -19,6 +19,7 @@ package main
 
 import (
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -30,6 +31,7 @@ import (
 
 	"github.com/ur-technology/go-ur/cmd/utils"
 	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/common/workers"
 	"github.com/ur-technology/go-ur/console"
 	"github.com/ur-technology/go-ur/contracts/release"
 	"github.com/ur-technology/go-ur/core"
@@ -56,6 +58,11 @@ var (
 	relOracle = common.HexToAddress("0xfa7b9770ca4cb04296cac84f37736d4041251cdf")
 	// The app that holds all commands and flags.
 	app = utils.NewApp(gitCommit, "the go-ur command line interface")
+
+	versionCommandJSONFlag = cli.BoolFlag{
+		Name:  "json",
+		Usage: "Print the version and build metadata as JSON",
+	}
 )
 
 func init() {
@@ -68,13 +75,24 @@ func init() {
 		exportCommand,
 		upgradedbCommand,
 		removedbCommand,
+		pruneStateCommand,
 		dumpCommand,
+		snapshotCommand,
+		dbCommand,
+		bzzCommand,
+		replayCommand,
+		dumpGenesisCommand,
+		verifyGenesisCommand,
 		monitorCommand,
 		accountCommand,
 		walletCommand,
 		consoleCommand,
 		attachCommand,
 		javascriptCommand,
+		dumpConfigCommand,
+		genRewardVectorsCommand,
+		doctorCommand,
+		nodekeyCommand,
 		{
 			Action:    makedag,
 			Name:      "makedag",
@@ -94,8 +112,14 @@ Regular users do not need to execute it.
 			Usage:     "Print version numbers",
 			ArgsUsage: " ",
 			Category:  "MISCELLANEOUS COMMANDS",
+			Flags: []cli.Flag{
+				versionCommandJSONFlag,
+			},
 			Description: `
-The output of this command is supposed to be machine-readable.
+The output of this command is supposed to be machine-readable. With --json it
+also reports the target platform, packaging channel and release signature
+verification keys the binary was built with, which tell official releases
+apart from self-compiled ones.
 `,
 		},
 		{
@@ -108,6 +132,23 @@ The output of this command is supposed to be machine-readable.
 The init command initializes a new genesis block and definition for the network.
 This is a destructive action and changes the network in which you will be
 participating.
+
+Besides the standard fields, the genesis JSON may seed the signup totals of the
+network with "nSignups" and "totalWei", and override the UR reward parameters
+in the "ur" section of its "config":
+
+    "ur": {
+      "blockReward": 7000000000000000000,
+      "signupReward": 2000000000000000000000,
+      "membersSignupRewards": [...seven tiers, one per referral level...],
+      "totalSignupRewards": 2000000000000000000000,
+      "urFutureFundFee": 5000000000000000000000,
+      "managementFee": 1000000000000000000000,
+      "managementFeeCap": 10000000000000000000000,
+      "privileged": [{"address": "0x...", "receiver": "0x...", "urff": "0x..."}]
+    }
+
+Omitted parameters keep their built-in values.
 `,
 		},
 		{
@@ -120,20 +161,49 @@ participating.
 	}
 
 	app.Flags = []cli.Flag{
+		utils.ConfigFileFlag,
 		utils.IdentityFlag,
 		utils.UnlockedAccountFlag,
 		utils.PasswordFileFlag,
 		utils.BootnodesFlag,
+		utils.StaticNodesFlag,
+		utils.TrustedNodesFlag,
 		utils.DataDirFlag,
 		utils.KeyStoreDirFlag,
+		utils.AncientDirFlag,
+		utils.DatabaseKeyFlag,
+		utils.AncientThresholdFlag,
 		utils.OlympicFlag,
 		utils.FastSyncFlag,
+		utils.CheckpointFlag,
+		utils.CheckpointSignerFlag,
 		utils.LightModeFlag,
 		utils.LightServFlag,
 		utils.LightPeersFlag,
 		utils.LightKDFFlag,
+		utils.TxPoolAccountSlotsFlag,
+		utils.TxPoolGlobalSlotsFlag,
+		utils.TxPoolAccountQueueFlag,
+		utils.TxPoolGlobalQueueFlag,
+		utils.TxPoolLifetimeFlag,
+		utils.TxPoolPriceBumpFlag,
+		utils.TxPoolLocalsFlag,
+		utils.TxPoolJournalFlag,
+		utils.TxPoolRejournalFlag,
 		utils.CacheFlag,
+		utils.TrieCacheFlag,
+		utils.TrieCommitIntervalFlag,
+		utils.FlatStateFlag,
+		utils.StateHistoryFlag,
+		utils.TxLookupLimitFlag,
+		utils.GCModeFlag,
 		utils.TrieCacheGenFlag,
+		utils.WorkersFlag,
+		utils.PowCachesFlag,
+		utils.PowDagDirFlag,
+		utils.PowModeFlag,
+		utils.PowVerifiersFlag,
+		utils.PowLightVerifyFlag,
 		utils.JSpathFlag,
 		utils.ListenPortFlag,
 		utils.MaxPeersFlag,
@@ -145,9 +215,25 @@ participating.
 		utils.OpposeDAOFork,
 		utils.MinerThreadsFlag,
 		utils.MiningEnabledFlag,
+		utils.MinerGasTargetFlag,
+		utils.MinerGasLimitFlag,
+		utils.MinerSignupsFirstFlag,
+		utils.MinerRecommitFlag,
+		utils.MinerNotifyFlag,
+		utils.MinerCoinbasesFlag,
+		utils.MinerRotationFlag,
+		utils.StratumAddrFlag,
+		utils.StratumHTTPAddrFlag,
+		utils.StratumShareDiffFlag,
+		utils.StratumPayoutFlag,
+		utils.StratumPayoutDepthFlag,
+		utils.StratumPayoutThresholdFlag,
+		utils.StratumPayoutStateFlag,
 		utils.AutoDAGFlag,
 		utils.TargetGasLimitFlag,
 		utils.NATFlag,
+		utils.NATExtIPFlag,
+		utils.NATGatewayFlag,
 		utils.NatspecEnabledFlag,
 		utils.NoDiscoverFlag,
 		utils.DiscoveryV5Flag,
@@ -158,6 +244,13 @@ participating.
 		utils.RPCListenAddrFlag,
 		utils.RPCPortFlag,
 		utils.RPCApiFlag,
+		utils.RPCTimeoutsFlag,
+		utils.RPCBatchRequestLimitFlag,
+		utils.RPCBatchResponseMaxSizeFlag,
+		utils.RPCLogsCapFlag,
+		utils.RPCTraceCapFlag,
+		utils.RPCUpstreamFlag,
+		utils.RPCUpstreamForwardFlag,
 		utils.WSEnabledFlag,
 		utils.WSListenAddrFlag,
 		utils.WSPortFlag,
@@ -169,6 +262,12 @@ participating.
 		utils.ExecFlag,
 		utils.PreloadJSFlag,
 		utils.WhisperEnabledFlag,
+		utils.WhisperSignupsFlag,
+		utils.FinalityFlag,
+		utils.FinalityValidatorsFlag,
+		utils.FinalityThresholdFlag,
+		utils.FinalityIntervalFlag,
+		utils.FinalitySignerFlag,
 		utils.DevModeFlag,
 		utils.TestNetFlag,
 		utils.VMForceJitFlag,
@@ -177,6 +276,14 @@ participating.
 		utils.NetworkIdFlag,
 		utils.RPCCORSDomainFlag,
 		utils.EthStatsURLFlag,
+		utils.ExplorerAddrFlag,
+		utils.TelemetryURLFlag,
+		utils.WatchlistFlag,
+		utils.RewardMonitorFlag,
+		utils.RewardMonitorCeilingFlag,
+		utils.ReleaseManifestFlag,
+		utils.ReleaseSignerFlag,
+		utils.MetricsEnabledFlag,
 		utils.FakePoWFlag,
 		utils.SolcPathFlag,
 		utils.GpoMinGasPriceFlag,
@@ -185,12 +292,16 @@ participating.
 		utils.GpobaseStepDownFlag,
 		utils.GpobaseStepUpFlag,
 		utils.GpobaseCorrectionFactorFlag,
-		// utils.ExtraDataFlag,
+		utils.GpoBlocksFlag,
+		utils.GpoPercentileFlag,
+		utils.MinerExtraDataFlag,
 	}
 	app.Flags = append(app.Flags, debug.Flags...)
 
 	app.Before = func(ctx *cli.Context) error {
+		loadConfigFile(ctx)
 		runtime.GOMAXPROCS(runtime.NumCPU())
+		workers.SetLimit(ctx.GlobalInt(utils.WorkersFlag.Name))
 		if err := debug.Setup(ctx); err != nil {
 			return err
 		}
@@ -282,10 +393,44 @@ func makeFullNode(ctx *cli.Context) *node.Node {
 	if shhEnabled || shhAutoEnabled {
 		utils.RegisterShhService(stack)
 	}
+	// Add the whisper signup broadcaster if requested
+	if ctx.GlobalBool(utils.WhisperSignupsFlag.Name) {
+		if !shhEnabled && !shhAutoEnabled {
+			utils.Fatalf("Option %q requires --%s", utils.WhisperSignupsFlag.Name, utils.WhisperEnabledFlag.Name)
+		}
+		utils.RegisterSignupcastService(stack)
+	}
+	// Add the checkpoint finality layer if requested
+	if ctx.GlobalBool(utils.FinalityFlag.Name) {
+		if !shhEnabled && !shhAutoEnabled {
+			utils.Fatalf("Option %q requires --%s", utils.FinalityFlag.Name, utils.WhisperEnabledFlag.Name)
+		}
+		utils.RegisterFinalityService(stack, utils.MakeFinalityConfig(ctx, stack.AccountManager()))
+	}
+	// Add the UR wire protocol extensions to full nodes
+	if !ctx.GlobalBool(utils.LightModeFlag.Name) {
+		utils.RegisterURExtService(stack, ctx.GlobalBool(utils.WhisperSignupsFlag.Name))
+	}
 	// Add the Ethereum Stats daemon if requested
 	if url := ctx.GlobalString(utils.EthStatsURLFlag.Name); url != "" {
 		utils.RegisterEthStatsService(stack, url)
 	}
+	// Add the built-in chain explorer if requested
+	if addr := ctx.GlobalString(utils.ExplorerAddrFlag.Name); addr != "" {
+		utils.RegisterExplorerService(stack, addr)
+	}
+	// Add the opt-in telemetry daemon if requested
+	if url := ctx.GlobalString(utils.TelemetryURLFlag.Name); url != "" {
+		utils.RegisterTelemetryService(stack, url)
+	}
+	// Add the address watchlist daemon if requested
+	if ctx.GlobalBool(utils.WatchlistFlag.Name) {
+		utils.RegisterWatchlistService(stack)
+	}
+	// Add the reward engine circuit breaker if requested
+	if ctx.GlobalBool(utils.RewardMonitorFlag.Name) {
+		utils.RegisterRewardMonitorService(ctx, stack)
+	}
 	// Add the release oracle service so it boots along with node.
 	if err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
 		config := release.Config{
@@ -300,6 +445,27 @@ func makeFullNode(ctx *cli.Context) *node.Node {
 	}); err != nil {
 		utils.Fatalf("Failed to register the Gur release oracle service: %v", err)
 	}
+	// Add the opt-in release manifest checker if requested
+	if url := ctx.GlobalString(utils.ReleaseManifestFlag.Name); url != "" {
+		signer := ctx.GlobalString(utils.ReleaseSignerFlag.Name)
+		if !common.IsHexAddress(signer) {
+			utils.Fatalf("Option %q: invalid release signer address %q", utils.ReleaseSignerFlag.Name, signer)
+		}
+		config := release.ManifestConfig{
+			URL:    url,
+			Signer: common.HexToAddress(signer),
+			Major:  uint32(params.VersionMajor),
+			Minor:  uint32(params.VersionMinor),
+			Patch:  uint32(params.VersionPatch),
+		}
+		if err := stack.Register(func(*node.ServiceContext) (node.Service, error) {
+			return release.NewManifestService(config)
+		}); err != nil {
+			utils.Fatalf("Failed to register the release manifest service: %v", err)
+		}
+	}
+	// Allow reloading parts of the config file on SIGHUP or admin_reloadConfig
+	stack.SetConfigReloader(func() error { return reloadConfigFile(ctx, stack) })
 	return stack
 }
 
@@ -309,6 +475,7 @@ func makeFullNode(ctx *cli.Context) *node.Node {
 func startNode(ctx *cli.Context, stack *node.Node) {
 	// Start up the node itself
 	utils.StartNode(stack)
+	glog.V(logger.Info).Infof("Node enode URL: %v", stack.Server().Self())
 
 	// Unlock any account specifically requested
 	accman := stack.AccountManager()
@@ -319,13 +486,19 @@ func startNode(ctx *cli.Context, stack *node.Node) {
 			unlockAccount(ctx, accman, trimmed, i, passwords)
 		}
 	}
-	// Start auxiliary services if enabled
-	if ctx.GlobalBool(utils.MiningEnabledFlag.Name) {
+	// Start auxiliary services if enabled, the developer mode always seals and
+	// a stratum server hands work out even without local mining threads
+	stratum := ctx.GlobalString(utils.StratumAddrFlag.Name) != "" || ctx.GlobalString(utils.StratumHTTPAddrFlag.Name) != ""
+	if ctx.GlobalBool(utils.MiningEnabledFlag.Name) || ctx.GlobalBool(utils.DevModeFlag.Name) || stratum {
 		var ethereum *eth.Ethereum
 		if err := stack.Service(&ethereum); err != nil {
 			utils.Fatalf("ethereum service not running: %v", err)
 		}
-		if err := ethereum.StartMining(ctx.GlobalInt(utils.MinerThreadsFlag.Name)); err != nil {
+		threads := ctx.GlobalInt(utils.MinerThreadsFlag.Name)
+		if !ctx.GlobalBool(utils.MiningEnabledFlag.Name) && !ctx.GlobalBool(utils.DevModeFlag.Name) {
+			threads = 0
+		}
+		if err := ethereum.StartMining(threads); err != nil {
 			utils.Fatalf("Failed to start mining: %v", err)
 		}
 	}
@@ -362,6 +535,20 @@ func makedag(ctx *cli.Context) error {
 }
 
 func version(ctx *cli.Context) error {
+	build := params.Build(gitCommit)
+	if ctx.Bool(versionCommandJSONFlag.Name) {
+		out, err := json.MarshalIndent(struct {
+			*params.BuildInfo
+			Client           string `json:"client"`
+			ProtocolVersions []uint `json:"protocolVersions"`
+			NetworkId        int    `json:"networkId"`
+		}{build, clientIdentifier, eth.ProtocolVersions, ctx.GlobalInt(utils.NetworkIdFlag.Name)}, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	}
 	fmt.Println(strings.Title(clientIdentifier))
 	fmt.Println("Version:", params.Version)
 	if gitCommit != "" {
@@ -371,6 +558,14 @@ func version(ctx *cli.Context) error {
 	fmt.Println("Network Id:", ctx.GlobalInt(utils.NetworkIdFlag.Name))
 	fmt.Println("Go Version:", runtime.Version())
 	fmt.Println("OS:", runtime.GOOS)
+	fmt.Println("Architecture:", runtime.GOARCH)
+	if build.Channel != "" {
+		fmt.Println("Channel:", build.Channel)
+	}
+	if len(build.SignerKeys) > 0 {
+		fmt.Println("Signer Keys:", strings.Join(build.SignerKeys, ", "))
+	}
+	fmt.Println("Official Build:", build.Official)
 	fmt.Printf("GOPATH=%s\n", os.Getenv("GOPATH"))
 	fmt.Printf("GOROOT=%s\n", runtime.GOROOT())
 	return nil
@@ -0,0 +1,207 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of go-ur.
+//
+// go-ur is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ur is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ur. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ur-technology/go-ur/cmd/utils"
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/crypto"
+	"github.com/ur-technology/go-ur/node"
+	"github.com/ur-technology/go-ur/p2p/discover"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	nodekeyForceFlag = cli.BoolFlag{
+		Name:  "force",
+		Usage: "Overwrite an existing node key",
+	}
+	nodekeyPrivateFlag = cli.BoolFlag{
+		Name:  "private",
+		Usage: "Print the private key too, as hex",
+	}
+
+	nodekeyCommand = cli.Command{
+		Name:      "nodekey",
+		Usage:     "Manage the persistent node key",
+		ArgsUsage: "",
+		Category:  "MISCELLANEOUS COMMANDS",
+		Description: `
+The node key identifies the node on the network: its public key is the node ID
+in the enode URL other nodes use to connect to it, e.g. in their static node
+lists. It is kept in the "nodekey" file of the data directory and generated on
+the first start if missing.
+`,
+		Subcommands: []cli.Command{
+			{
+				Action:    generateNodeKey,
+				Name:      "generate",
+				Usage:     "Generate a new node key",
+				ArgsUsage: "[<keyfile>]",
+				Flags:     []cli.Flag{nodekeyForceFlag},
+				Description: `
+Generates a new node key into the given file, or into the data directory if
+omitted, and prints the resulting enode URL. An existing key is only replaced
+with --force, which changes the identity of the node.
+`,
+			},
+			{
+				Action:    printNodeKey,
+				Name:      "print",
+				Usage:     "Print the node ID and enode URL",
+				ArgsUsage: " ",
+				Flags:     []cli.Flag{nodekeyPrivateFlag},
+				Description: `
+Prints the node ID and the full enode URL of the node key in use, the one given
+by --nodekey or --nodekeyhex or else the one in the data directory. The IP of
+the URL is the external one resolved through the --nat mechanism, the ports are
+the --port listening ones.
+`,
+			},
+			{
+				Action:    importNodeKey,
+				Name:      "import",
+				Usage:     "Import a node key into the data directory",
+				ArgsUsage: "<keyfile | hexkey>",
+				Flags:     []cli.Flag{nodekeyForceFlag},
+				Description: `
+Imports the node key from the given file, or given as hex, into the data
+directory, so a node keeps its identity when moved to another machine. An
+existing key is only replaced with --force.
+`,
+			},
+		},
+	}
+)
+
+// nodekeyNATTimeout is the maximum time to wait for the NAT mechanism to report
+// the external IP of the node.
+const nodekeyNATTimeout = 10 * time.Second
+
+func generateNodeKey(ctx *cli.Context) error {
+	keyfile := ctx.Args().First()
+	if keyfile == "" {
+		keyfile = nodeKeyFile(ctx)
+	}
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		utils.Fatalf("Failed to generate node key: %v", err)
+	}
+	saveNodeKey(ctx, keyfile, key)
+
+	fmt.Println("Node key:", keyfile)
+	fmt.Println("Enode:   ", enodeURL(ctx, key))
+	return nil
+}
+
+func printNodeKey(ctx *cli.Context) error {
+	key := utils.MakeNodeKey(ctx)
+	if key == nil {
+		keyfile := nodeKeyFile(ctx)
+		if !common.FileExist(keyfile) {
+			utils.Fatalf("No node key in %s, generate one with 'gur nodekey generate'", keyfile)
+		}
+		var err error
+		if key, err = crypto.LoadECDSA(keyfile); err != nil {
+			utils.Fatalf("Failed to load node key: %v", err)
+		}
+	}
+	fmt.Println("Node ID:", discover.PubkeyID(&key.PublicKey))
+	fmt.Println("Enode:  ", enodeURL(ctx, key))
+	if ctx.Bool(nodekeyPrivateFlag.Name) {
+		fmt.Printf("Private: %x\n", crypto.FromECDSA(key))
+	}
+	return nil
+}
+
+func importNodeKey(ctx *cli.Context) error {
+	source := ctx.Args().First()
+	if source == "" {
+		utils.Fatalf("This command requires an argument.")
+	}
+	key, err := crypto.LoadECDSA(source)
+	if err != nil {
+		if common.FileExist(source) {
+			utils.Fatalf("Failed to load node key: %v", err)
+		}
+		if key, err = crypto.HexToECDSA(source); err != nil {
+			utils.Fatalf("Neither a key file nor a hex key: %v", err)
+		}
+	}
+	keyfile := nodeKeyFile(ctx)
+	saveNodeKey(ctx, keyfile, key)
+
+	fmt.Println("Node key:", keyfile)
+	fmt.Println("Enode:   ", enodeURL(ctx, key))
+	return nil
+}
+
+// nodeKeyFile returns the path of the node key in the data directory.
+func nodeKeyFile(ctx *cli.Context) string {
+	config := &node.Config{DataDir: utils.MakeDataDir(ctx), Name: clientIdentifier}
+	return config.NodeKeyFile()
+}
+
+// saveNodeKey writes a node key to a file, refusing to replace an existing one
+// unless forced.
+func saveNodeKey(ctx *cli.Context, keyfile string, key *ecdsa.PrivateKey) {
+	if common.FileExist(keyfile) && !ctx.Bool(nodekeyForceFlag.Name) {
+		utils.Fatalf("Node key %s already exists, replace it with --%s", keyfile, nodekeyForceFlag.Name)
+	}
+	if err := os.MkdirAll(filepath.Dir(keyfile), 0700); err != nil {
+		utils.Fatalf("Failed to create node key directory: %v", err)
+	}
+	if err := crypto.SaveECDSA(keyfile, key); err != nil {
+		utils.Fatalf("Failed to save node key: %v", err)
+	}
+}
+
+// enodeURL assembles the enode URL of the node with the given key, listening on
+// the configured port at its external IP. If the IP can't be resolved through
+// the NAT mechanism the loopback one is used.
+func enodeURL(ctx *cli.Context, key *ecdsa.PrivateKey) string {
+	ip := net.IP{127, 0, 0, 1}
+	if natif := utils.MakeNAT(ctx); natif != nil {
+		done := make(chan net.IP, 1)
+		go func() {
+			ext, err := natif.ExternalIP()
+			if err != nil {
+				ext = nil
+			}
+			done <- ext
+		}()
+		select {
+		case ext := <-done:
+			if ext != nil {
+				ip = ext
+			}
+		case <-time.After(nodekeyNATTimeout):
+		}
+	}
+	if ip.IsLoopback() {
+		fmt.Fprintln(os.Stderr, "External IP unknown, set it with --nat extip:<IP> for a URL usable by remote nodes")
+	}
+	port := uint16(ctx.GlobalInt(utils.ListenPortFlag.Name))
+	return discover.NewNode(discover.PubkeyID(&key.PublicKey), ip, port, port).String()
+}
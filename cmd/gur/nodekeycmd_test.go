@@ -0,0 +1,58 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of go-ur.
+//
+// go-ur is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ur is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ur. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/ur-technology/go-ur/crypto"
+	"github.com/ur-technology/go-ur/p2p/discover"
+)
+
+// Tests that node keys are generated and imported into the data directory, and
+// that existing ones are only replaced when forced.
+func TestNodeKeyGenerateImport(t *testing.T) {
+	datadir := tmpdir(t)
+	defer os.RemoveAll(datadir)
+
+	gur := runGur(t, "--datadir", datadir, "--nat", "extip:77.12.33.4", "nodekey", "generate")
+	gur.expectRegexp(`Node key: .*nodekey\nEnode:    enode://[0-9a-f]{128}@77\.12\.33\.4:19595\n`)
+	gur.expectExit()
+
+	gur = runGur(t, "--datadir", datadir, "nodekey", "generate")
+	gur.expect("Fatal: Node key {{.Datadir}}/gur/nodekey already exists, replace it with --force\n")
+	gur.expectExit()
+
+	hex := "b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291"
+	key, _ := crypto.HexToECDSA(hex)
+	id := discover.PubkeyID(&key.PublicKey).String()
+
+	gur = runGur(t, "--datadir", datadir, "--nat", "none", "nodekey", "import", "--force", hex)
+	gur.expect(`
+Node key: {{.Datadir}}/gur/nodekey
+Enode:    enode://` + id + `@127.0.0.1:19595
+`)
+	gur.expectExit()
+
+	gur = runGur(t, "--datadir", datadir, "--nat", "extip:77.12.33.4", "--port", "30310", "nodekey", "print")
+	gur.expect(`
+Node ID: ` + id + `
+Enode:   enode://` + id + `@77.12.33.4:30310
+`)
+	gur.expectExit()
+}
@@ -0,0 +1,174 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of go-ur.
+//
+// go-ur is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ur is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ur. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ur-technology/go-ur/cmd/utils"
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core"
+	"github.com/ur-technology/go-ur/rlp"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	replayCommandBlockFlag = cli.Uint64Flag{
+		Name:  "block",
+		Usage: "Number of the block to record or run",
+	}
+	replayCommandRecordFlag = cli.StringFlag{
+		Name:  "record",
+		Usage: "Directory to record the block into",
+	}
+	replayCommandRunFlag = cli.StringFlag{
+		Name:  "run",
+		Usage: "Recording file or directory to re-execute",
+	}
+	replayCommand = cli.Command{
+		Action:    replay,
+		Name:      "replay",
+		Usage:     "Record and re-execute blocks outside the node",
+		ArgsUsage: " ",
+		Category:  "BLOCKCHAIN COMMANDS",
+		Description: `
+    gur replay --block <n> --record <dir>
+
+Processes canonical block <n> of the local chain and records every database
+entry read along the way, along with the chain configuration, into the file
+block-<n>.replay in <dir>. The chain database is not modified.
+
+    gur replay --run <file|dir> [--block <n>]
+
+Re-executes recorded blocks using nothing but the recording, reporting whether
+they pass validation. If a directory is given, the recording of block <n> in it
+is run, or all of them if no block is specified. No data directory is needed,
+which makes this suitable for running consensus failures under a debugger.
+`,
+		Flags: []cli.Flag{
+			replayCommandBlockFlag,
+			replayCommandRecordFlag,
+			replayCommandRunFlag,
+		},
+	}
+)
+
+// replayFileExt is the file extension of block recordings.
+const replayFileExt = ".replay"
+
+func replay(ctx *cli.Context) error {
+	switch {
+	case ctx.IsSet(replayCommandRecordFlag.Name) && ctx.IsSet(replayCommandRunFlag.Name):
+		utils.Fatalf("Only one of --record and --run may be given")
+	case ctx.IsSet(replayCommandRecordFlag.Name):
+		if !ctx.IsSet(replayCommandBlockFlag.Name) {
+			utils.Fatalf("Recording requires a --block to be specified")
+		}
+		recordBlock(ctx, ctx.Uint64(replayCommandBlockFlag.Name), ctx.String(replayCommandRecordFlag.Name))
+	case ctx.IsSet(replayCommandRunFlag.Name):
+		runRecordings(ctx, ctx.String(replayCommandRunFlag.Name))
+	default:
+		utils.Fatalf("Either --record or --run must be given")
+	}
+	return nil
+}
+
+// recordBlock records the canonical block with the given number into dir.
+func recordBlock(ctx *cli.Context, number uint64, dir string) {
+	stack := makeFullNode(ctx)
+	chainDb := utils.MakeChainDatabase(ctx, stack)
+	defer chainDb.Close()
+
+	hash := core.GetCanonicalHash(chainDb, number)
+	if hash == (common.Hash{}) {
+		utils.Fatalf("Block #%d not found in the canonical chain", number)
+	}
+	start := time.Now()
+	record, result, err := core.RecordBlock(chainDb, utils.MakeChainConfigFromDb(ctx, chainDb), hash)
+	if err != nil {
+		utils.Fatalf("Failed to record block: %v", err)
+	}
+	blob, err := rlp.EncodeToBytes(record)
+	if err != nil {
+		utils.Fatalf("Failed to encode recording: %v", err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		utils.Fatalf("Failed to create recording directory: %v", err)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("block-%d%s", number, replayFileExt))
+	if err := ioutil.WriteFile(path, blob, 0644); err != nil {
+		utils.Fatalf("Failed to write recording: %v", err)
+	}
+	fmt.Printf("Recorded %d entries (%v) in %v: %s\n", len(record.Entries), common.StorageSize(len(blob)), time.Since(start), path)
+	printReplayResult(result)
+}
+
+// runRecordings re-executes the recording at path, or the recordings in it if
+// path is a directory, failing if any of the blocks is invalid.
+func runRecordings(ctx *cli.Context, path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		utils.Fatalf("Failed to access recording: %v", err)
+	}
+	paths := []string{path}
+	if info.IsDir() {
+		if ctx.IsSet(replayCommandBlockFlag.Name) {
+			paths = []string{filepath.Join(path, fmt.Sprintf("block-%d%s", ctx.Uint64(replayCommandBlockFlag.Name), replayFileExt))}
+		} else if paths, err = filepath.Glob(filepath.Join(path, "*"+replayFileExt)); err != nil || len(paths) == 0 {
+			utils.Fatalf("No recordings found in %s", path)
+		}
+	}
+	failed := 0
+	for _, path := range paths {
+		blob, err := ioutil.ReadFile(path)
+		if err != nil {
+			utils.Fatalf("Failed to read recording: %v", err)
+		}
+		record := new(core.BlockRecord)
+		if err := rlp.DecodeBytes(blob, record); err != nil {
+			utils.Fatalf("Invalid recording %s: %v", path, err)
+		}
+		start := time.Now()
+		result, err := record.Replay()
+		if err != nil {
+			utils.Fatalf("Failed to replay %s: %v", path, err)
+		}
+		fmt.Printf("Replayed %s in %v\n", path, time.Since(start))
+		printReplayResult(result)
+		if result.Err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		utils.Fatalf("%d of %d blocks failed validation", failed, len(paths))
+	}
+}
+
+// printReplayResult reports the outcome of processing a block.
+func printReplayResult(result *core.ReplayResult) {
+	block := result.Block
+	fmt.Printf("Block #%d [%x…]: %d txs, gas used %v, state root %x\n", block.NumberU64(), block.Hash().Bytes()[:4], len(block.Transactions()), result.UsedGas, result.Root)
+	if result.Err != nil {
+		fmt.Printf("Block invalid: %v\n", result.Err)
+	} else {
+		fmt.Println("Block valid")
+	}
+}
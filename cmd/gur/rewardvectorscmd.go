@@ -0,0 +1,311 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of go-ur.
+//
+// go-ur is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ur is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ur. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"math/rand"
+	"os"
+
+	"github.com/ur-technology/go-ur/cmd/utils"
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/common/hexutil"
+	"github.com/ur-technology/go-ur/core"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/crypto"
+	"github.com/ur-technology/go-ur/ethdb"
+	"github.com/ur-technology/go-ur/event"
+	"github.com/ur-technology/go-ur/params"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	rewardVectorsSeedFlag = cli.Int64Flag{
+		Name:  "seed",
+		Usage: "Seed of the keys and referral tree generated",
+		Value: 1,
+	}
+	rewardVectorsDepthFlag = cli.IntFlag{
+		Name:  "depth",
+		Usage: "Depth of the referral tree",
+		Value: 9,
+	}
+	rewardVectorsWidthFlag = cli.IntFlag{
+		Name:  "width",
+		Usage: "Maximum number of members signed up by every member",
+		Value: 2,
+	}
+	rewardVectorsOutputFlag = cli.StringFlag{
+		Name:  "output",
+		Usage: "File to write the vectors to (default = stdout)",
+	}
+	genRewardVectorsCommand = cli.Command{
+		Action:    genRewardVectors,
+		Name:      "gen-reward-vectors",
+		Usage:     "Generate JSON test vectors of the rewards engine",
+		ArgsUsage: " ",
+		Category:  "MISCELLANEOUS COMMANDS",
+		Description: `
+Builds an in-memory chain signing up a random referral tree of members, one
+signup per block, and writes it out as JSON test vectors: the chain and reward
+configuration, the genesis allocation, the referral tree and, for every block,
+its transactions, signup totals and the balances of all addresses involved so
+far once the block is processed.
+
+The reward parameters are the compiled in ones, the privileged sender and all
+members are derived from --seed. The transactions are signed deterministically,
+so the output only depends on the flags and the reward rules of the binary,
+regenerating it yields the exact same file. Alternative
+implementations of the rewards engine can be validated against it without
+running a node.
+`,
+		Flags: []cli.Flag{
+			rewardVectorsSeedFlag,
+			rewardVectorsDepthFlag,
+			rewardVectorsWidthFlag,
+			rewardVectorsOutputFlag,
+		},
+	}
+)
+
+// signupGas is the gas limit of the signup transactions, covering their data.
+var signupGas = new(big.Int).Mul(params.TxGas, big.NewInt(2))
+
+// rewardVectors is the JSON representation of the generated test vectors.
+type rewardVectors struct {
+	Seed           int64                 `json:"seed"`
+	RewardSpecHash common.Hash           `json:"rewardSpecHash"`
+	ChainConfig    *params.ChainConfig   `json:"chainConfig"`
+	Genesis        rewardVectorsGenesis  `json:"genesis"`
+	Members        []rewardVectorsMember `json:"members"`
+	Blocks         []rewardVectorsBlock  `json:"blocks"`
+}
+
+type rewardVectorsGenesis struct {
+	Hash  common.Hash             `json:"hash"`
+	Alloc map[string]*hexutil.Big `json:"alloc"`
+}
+
+// rewardVectorsMember is a member of the referral tree along with the member
+// who signed it up, the privileged sender for the roots of the tree.
+type rewardVectorsMember struct {
+	Address  common.Address `json:"address"`
+	Referrer common.Address `json:"referrer"`
+	Block    hexutil.Uint64 `json:"block"`
+	Tx       common.Hash    `json:"tx"`
+}
+
+type rewardVectorsBlock struct {
+	Number       hexutil.Uint64          `json:"number"`
+	Hash         common.Hash             `json:"hash"`
+	Coinbase     common.Address          `json:"coinbase"`
+	Transactions []*types.Transaction    `json:"transactions"`
+	NSignups     *hexutil.Big            `json:"nSignups"`
+	TotalWei     *hexutil.Big            `json:"totalWei"`
+	Balances     map[string]*hexutil.Big `json:"balances"`
+}
+
+// rewardVectorsMemberNode is a member of the referral tree being generated.
+type rewardVectorsMemberNode struct {
+	addr    common.Address
+	signups []*rewardVectorsMemberNode
+
+	block uint64      // Number of the block signing up the member
+	tx    common.Hash // Hash of the transaction signing up the member
+}
+
+func genRewardVectors(ctx *cli.Context) error {
+	var (
+		seed  = ctx.Int64(rewardVectorsSeedFlag.Name)
+		depth = ctx.Int(rewardVectorsDepthFlag.Name)
+		width = ctx.Int(rewardVectorsWidthFlag.Name)
+	)
+	if depth < 1 || width < 1 {
+		utils.Fatalf("Referral tree depth and width must be positive")
+	}
+	vectors, err := makeRewardVectors(seed, depth, width)
+	if err != nil {
+		utils.Fatalf("Failed to generate vectors: %v", err)
+	}
+	out, err := json.MarshalIndent(vectors, "", "  ")
+	if err != nil {
+		utils.Fatalf("Failed to encode vectors: %v", err)
+	}
+	out = append(out, '\n')
+
+	if path := ctx.String(rewardVectorsOutputFlag.Name); path != "" {
+		if err := ioutil.WriteFile(path, out, 0644); err != nil {
+			utils.Fatalf("Failed to write vectors: %v", err)
+		}
+		return nil
+	}
+	_, err = os.Stdout.Write(out)
+	return err
+}
+
+// signDeterministic signs the transaction without randomizing the signature, so
+// the transaction and block hashes of the vectors only depend on the seed.
+func signDeterministic(signer types.Signer, tx *types.Transaction, key *ecdsa.PrivateKey) *types.Transaction {
+	hash := signer.Hash(tx)
+	sig, err := crypto.SignDeterministic(hash[:], key)
+	if err != nil {
+		panic(err)
+	}
+	sig[64] += 27 // as expected by the signers
+	signed, err := tx.WithSignature(signer, sig)
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+// makeRewardVectors generates the test vectors of a referral tree of the given
+// depth, every member signing up between one and width others.
+func makeRewardVectors(seed int64, depth, width int) (*rewardVectors, error) {
+	var (
+		random  = rand.New(rand.NewSource(seed))
+		counter uint64
+	)
+	newKey := func() (*ecdsa.PrivateKey, common.Address) {
+		var blob [16]byte
+		binary.BigEndian.PutUint64(blob[:], uint64(seed))
+		binary.BigEndian.PutUint64(blob[8:], counter)
+		counter++
+
+		key := crypto.ToECDSA(crypto.Keccak256(blob[:]))
+		return key, crypto.PubkeyToAddress(key.PublicKey)
+	}
+	privKey, privAddr := newKey()
+	_, receiver := newKey()
+	_, urff := newKey()
+	_, coinbase := newKey()
+
+	// Use the compiled in rewards along with a privileged sender of our own
+	ur := &params.URConfig{
+		BlockReward:          core.BlockReward,
+		SignupReward:         core.SignupReward,
+		MembersSignupRewards: core.MembersSingupRewards,
+		TotalSignupRewards:   core.TotalSingupRewards,
+		URFutureFundFee:      core.URFutureFundFee,
+		ManagementFee:        core.ManagementFee,
+		ManagementFeeCap:     core.Big10k,
+		Privileged:           []params.URPrivilegedSender{{Address: privAddr, Receiver: receiver, URFF: urff}},
+	}
+	config := *params.TestChainConfig
+	config.UR = ur
+
+	// Generate the referral tree, signing up members depth first
+	root := &rewardVectorsMemberNode{addr: privAddr}
+	var grow func(node *rewardVectorsMemberNode, depth int)
+	grow = func(node *rewardVectorsMemberNode, depth int) {
+		if depth == 0 {
+			return
+		}
+		for i := random.Intn(width) + 1; i > 0; i-- {
+			_, addr := newKey()
+			child := &rewardVectorsMemberNode{addr: addr}
+			node.signups = append(node.signups, child)
+			grow(child, depth-1)
+		}
+	}
+	grow(root, depth)
+
+	db, _ := ethdb.NewMemDatabase()
+	alloc := core.GenesisAccount{Address: privAddr, Balance: new(big.Int).Set(common.Ether)}
+	genesis := core.WriteGenesisBlockForTesting(db, alloc)
+
+	blockchain, err := core.NewBlockChain(db, &config, core.FakePow{}, new(event.TypeMux))
+	if err != nil {
+		return nil, err
+	}
+	defer blockchain.Stop()
+
+	vectors := &rewardVectors{
+		Seed:           seed,
+		RewardSpecHash: core.RewardSpecHash(&config),
+		ChainConfig:    &config,
+		Genesis: rewardVectorsGenesis{
+			Hash:  genesis.Hash(),
+			Alloc: map[string]*hexutil.Big{privAddr.Hex(): (*hexutil.Big)(alloc.Balance)},
+		},
+	}
+	tracked := []common.Address{privAddr, receiver, urff, coinbase}
+
+	var signup func(node *rewardVectorsMemberNode) error
+	signup = func(node *rewardVectorsMemberNode) error {
+		for _, child := range node.signups {
+			data := []byte{1}
+			if node != root {
+				data = make([]byte, 41)
+				data[0] = 1
+				binary.BigEndian.PutUint64(data[1:], node.block)
+				copy(data[9:], node.tx[:])
+			}
+			var tx *types.Transaction
+			blocks, _ := core.GenerateChain(&config, blockchain, blockchain.CurrentBlock(), db, 1, func(i int, gen *core.BlockGen) {
+				gen.SetCoinbase(coinbase)
+				signer := types.MakeSigner(&config, gen.Number())
+				tx = signDeterministic(signer, types.NewTransaction(gen.TxNonce(privAddr), child.addr, big.NewInt(1), signupGas, nil, data), privKey)
+				gen.AddTx(tx)
+			})
+			if _, err := blockchain.InsertChain(blocks); err != nil {
+				return fmt.Errorf("member %x signup: %v", child.addr, err)
+			}
+			block := blocks[0]
+			child.block, child.tx = block.NumberU64(), tx.Hash()
+
+			vectors.Members = append(vectors.Members, rewardVectorsMember{
+				Address:  child.addr,
+				Referrer: node.addr,
+				Block:    hexutil.Uint64(child.block),
+				Tx:       child.tx,
+			})
+			tracked = append(tracked, child.addr)
+
+			statedb, err := blockchain.State()
+			if err != nil {
+				return err
+			}
+			balances := make(map[string]*hexutil.Big, len(tracked))
+			for _, addr := range tracked {
+				balances[addr.Hex()] = (*hexutil.Big)(statedb.GetBalance(addr))
+			}
+			vectors.Blocks = append(vectors.Blocks, rewardVectorsBlock{
+				Number:       hexutil.Uint64(block.NumberU64()),
+				Hash:         block.Hash(),
+				Coinbase:     block.Coinbase(),
+				Transactions: block.Transactions(),
+				NSignups:     (*hexutil.Big)(block.NSignups()),
+				TotalWei:     (*hexutil.Big)(block.TotalWei()),
+				Balances:     balances,
+			})
+			if err := signup(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := signup(root); err != nil {
+		return nil, err
+	}
+	return vectors, nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of go-ur.
+//
+// go-ur is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ur is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ur. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ur-technology/go-ur/core"
+)
+
+// Tests that the reward vectors only depend on the seed and are consistent with
+// the rewards paid.
+func TestRewardVectors(t *testing.T) {
+	first, err := makeRewardVectors(7, 4, 2)
+	if err != nil {
+		t.Fatalf("failed to generate vectors: %v", err)
+	}
+	second, err := makeRewardVectors(7, 4, 2)
+	if err != nil {
+		t.Fatalf("failed to regenerate vectors: %v", err)
+	}
+	if len(first.Members) == 0 || len(first.Members) != len(first.Blocks) {
+		t.Fatalf("member/block count mismatch: %d members, %d blocks", len(first.Members), len(first.Blocks))
+	}
+	if len(first.Members) != len(second.Members) {
+		t.Fatalf("member count not deterministic: %d != %d", len(first.Members), len(second.Members))
+	}
+	if first.Genesis.Hash != second.Genesis.Hash {
+		t.Errorf("genesis not deterministic")
+	}
+	firstJSON, _ := json.Marshal(first)
+	secondJSON, _ := json.Marshal(second)
+	if !bytes.Equal(firstJSON, secondJSON) {
+		t.Errorf("vectors not deterministic")
+	}
+	for i, member := range first.Members {
+		block := first.Blocks[i]
+		if other := second.Members[i]; member.Address != other.Address || member.Referrer != other.Referrer {
+			t.Errorf("member %d: referral tree not deterministic", i)
+		}
+		if other := second.Blocks[i]; !reflect.DeepEqual(block.Balances, other.Balances) || (*big.Int)(block.TotalWei).Cmp((*big.Int)(other.TotalWei)) != 0 {
+			t.Errorf("block #%d: balances not deterministic", block.Number)
+		}
+		if uint64(block.Number) != uint64(member.Block) {
+			t.Errorf("member %d: block mismatch: have #%d, want #%d", i, member.Block, block.Number)
+		}
+		if signups := (*big.Int)(block.NSignups); signups.Int64() != int64(i+1) {
+			t.Errorf("block #%d: signup count mismatch: have %v, want %d", block.Number, signups, i+1)
+		}
+		if balance := (*big.Int)(block.Balances[member.Address.Hex()]); balance.Cmp(core.SignupReward) < 0 {
+			t.Errorf("member %d: signup reward missing, balance %v", i, balance)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of go-ur.
+//
+// go-ur is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ur is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ur. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ur-technology/go-ur/cmd/utils"
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core"
+	"github.com/ur-technology/go-ur/core/state"
+	"github.com/ur-technology/go-ur/ethdb"
+	"github.com/ur-technology/go-ur/rlp"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	snapshotCommand = cli.Command{
+		Name:      "snapshot",
+		Usage:     "Manage flat state snapshots",
+		ArgsUsage: "",
+		Category:  "BLOCKCHAIN COMMANDS",
+		Description: `
+A state snapshot is a flat dump of all accounts, contract code and storage at
+a given block. Snapshots are self verifying: loading one rebuilds the state
+trie, whose root must match the state root of the block it was taken at.
+Snapshot files whose name ends with .gz are gzip compressed.
+`,
+		Subcommands: []cli.Command{
+			{
+				Action:    createSnapshot,
+				Name:      "create",
+				Usage:     "Create a state snapshot",
+				ArgsUsage: "<filename> [<blockHash> | <blockNum>]",
+				Description: `
+Writes the state at the given block, or at the current head if omitted, into
+the given file.
+`,
+			},
+			{
+				Action:    verifySnapshot,
+				Name:      "verify",
+				Usage:     "Verify a state snapshot",
+				ArgsUsage: "<filename>",
+				Description: `
+Rebuilds the state contained in the snapshot in memory and checks that it
+matches the state root recorded in the snapshot. If the local chain contains
+the snapshot block, the root is also checked against it.
+`,
+			},
+			{
+				Action:    loadSnapshot,
+				Name:      "load",
+				Usage:     "Bootstrap the node state from a state snapshot",
+				ArgsUsage: "<filename>",
+				Description: `
+Rebuilds the state contained in the snapshot into the node database. If the
+local chain contains the snapshot block ahead of the current head block, e.g.
+after its headers and receipts were fast synced, the snapshot block becomes the
+new head and the node continues from it without downloading the state. Else the
+loaded state is still reused by a later fast sync, which skips the trie nodes
+already present in the database.
+`,
+			},
+			{
+				Action:    pruneSnapshots,
+				Name:      "prune",
+				Usage:     "Remove old state snapshots",
+				ArgsUsage: "<directory> [<keep>]",
+				Description: `
+Removes all snapshots in the given directory except the most recent ones by
+block number. The number of snapshots to keep defaults to 2.
+`,
+			},
+		},
+	}
+)
+
+// defaultSnapshotsKept is the number of snapshots retained by prune if not
+// explicitly specified.
+const defaultSnapshotsKept = 2
+
+func createSnapshot(ctx *cli.Context) error {
+	if len(ctx.Args()) < 1 {
+		utils.Fatalf("This command requires an argument.")
+	}
+	stack := makeFullNode(ctx)
+	chain, chainDb := utils.MakeChain(ctx, stack)
+	defer chainDb.Close()
+
+	block := chain.CurrentBlock()
+	if arg := ctx.Args().Get(1); arg != "" {
+		if hashish(arg) {
+			block = chain.GetBlockByHash(common.HexToHash(arg))
+		} else {
+			num, err := strconv.ParseUint(arg, 10, 64)
+			if err != nil {
+				utils.Fatalf("Snapshot error in parsing parameters: block number not an integer\n")
+			}
+			block = chain.GetBlockByNumber(num)
+		}
+		if block == nil {
+			utils.Fatalf("Snapshot error: block %s not found", arg)
+		}
+	}
+	fn := ctx.Args().First()
+	fh, err := os.OpenFile(fn, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		utils.Fatalf("Snapshot error: %v", err)
+	}
+	defer fh.Close()
+
+	var (
+		writer io.Writer = fh
+		gz     *gzip.Writer
+	)
+	if strings.HasSuffix(fn, ".gz") {
+		gz = gzip.NewWriter(fh)
+		writer = gz
+	}
+	start := time.Now()
+	header := &state.SnapshotHeader{Number: block.NumberU64(), Hash: block.Hash(), Root: block.Root()}
+	count, err := state.WriteSnapshot(writer, chainDb, header)
+	if err != nil {
+		utils.Fatalf("Snapshot error: %v", err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			utils.Fatalf("Snapshot error: %v", err)
+		}
+	}
+	fmt.Printf("Snapshot of block #%d [%x…] with %d accounts done in %v\n", header.Number, header.Hash[:4], count, time.Since(start))
+	return nil
+}
+
+func verifySnapshot(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("This command requires an argument.")
+	}
+	reader, err := openSnapshot(ctx.Args().First())
+	if err != nil {
+		utils.Fatalf("Snapshot error: %v", err)
+	}
+	defer reader.Close()
+
+	db, _ := ethdb.NewMemDatabase()
+	start := time.Now()
+	header, err := state.LoadSnapshot(reader, db)
+	if err != nil {
+		utils.Fatalf("Invalid snapshot: %v", err)
+	}
+	// Cross check against the local chain if it knows the snapshot block
+	stack := makeFullNode(ctx)
+	chain, chainDb := utils.MakeChain(ctx, stack)
+	defer chainDb.Close()
+
+	if block := chain.GetBlockByHash(header.Hash); block != nil {
+		if block.NumberU64() != header.Number || block.Root() != header.Root {
+			utils.Fatalf("Invalid snapshot: block #%d [%x…] has state root %x, snapshot has %x",
+				block.NumberU64(), block.Hash().Bytes()[:4], block.Root(), header.Root)
+		}
+	} else {
+		fmt.Printf("Block #%d [%x…] unknown locally, only the state root was checked\n", header.Number, header.Hash[:4])
+	}
+	fmt.Printf("Snapshot of block #%d [%x…] verified in %v\n", header.Number, header.Hash[:4], time.Since(start))
+	return nil
+}
+
+func loadSnapshot(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("This command requires an argument.")
+	}
+	reader, err := openSnapshot(ctx.Args().First())
+	if err != nil {
+		utils.Fatalf("Snapshot error: %v", err)
+	}
+	defer reader.Close()
+
+	stack := makeFullNode(ctx)
+	chain, chainDb := utils.MakeChain(ctx, stack)
+	defer chainDb.Close()
+
+	start := time.Now()
+	header, committed, err := bootstrapSnapshot(chain, chainDb, reader)
+	if err != nil {
+		utils.Fatalf("Snapshot error: %v", err)
+	}
+	fmt.Printf("State of block #%d [%x…] loaded in %v\n", header.Number, header.Hash[:4], time.Since(start))
+	if committed {
+		fmt.Printf("Block #%d [%x…] is the new head block\n", header.Number, header.Hash[:4])
+	} else {
+		head := chain.CurrentBlock()
+		fmt.Printf("Head block #%d [%x…] unchanged, the state will be reused by fast sync\n", head.NumberU64(), head.Hash().Bytes()[:4])
+	}
+	return nil
+}
+
+// bootstrapSnapshot loads the state snapshot read from r into the chain database
+// and, if the snapshot block is a canonical block ahead of the current head block
+// whose state was missing, makes it the new head block. The returned flag reports
+// whether the head was moved.
+func bootstrapSnapshot(chain *core.BlockChain, db ethdb.Database, r io.Reader) (*state.SnapshotHeader, bool, error) {
+	header, err := state.LoadSnapshot(r, db)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid snapshot: %v", err)
+	}
+	block := chain.GetBlockByHash(header.Hash)
+	if block == nil {
+		return header, false, nil
+	}
+	if block.NumberU64() != header.Number || block.Root() != header.Root {
+		return nil, false, fmt.Errorf("invalid snapshot: block #%d [%x…] has state root %x, snapshot has %x",
+			block.NumberU64(), block.Hash().Bytes()[:4], block.Root(), header.Root)
+	}
+	if core.GetCanonicalHash(db, header.Number) != header.Hash || header.Number <= chain.CurrentBlock().NumberU64() {
+		return header, false, nil
+	}
+	if err := chain.FastSyncCommitHead(header.Hash); err != nil {
+		return nil, false, err
+	}
+	if err := core.WriteHeadBlockHash(db, header.Hash); err != nil {
+		return nil, false, err
+	}
+	return header, true, nil
+}
+
+func pruneSnapshots(ctx *cli.Context) error {
+	if len(ctx.Args()) < 1 {
+		utils.Fatalf("This command requires an argument.")
+	}
+	keep := defaultSnapshotsKept
+	if arg := ctx.Args().Get(1); arg != "" {
+		var err error
+		if keep, err = strconv.Atoi(arg); err != nil || keep < 0 {
+			utils.Fatalf("Snapshot error in parsing parameters: keep count not a non-negative integer\n")
+		}
+	}
+	dir := ctx.Args().First()
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		utils.Fatalf("Snapshot error: %v", err)
+	}
+	// Collect all the snapshots in the directory along with their block numbers
+	var snapshots snapshotFiles
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		header, err := readSnapshotHeader(path)
+		if err != nil {
+			continue // not a snapshot, leave it alone
+		}
+		snapshots = append(snapshots, snapshotFile{path, header.Number})
+	}
+	sort.Sort(snapshots)
+
+	for i := keep; i < len(snapshots); i++ {
+		if err := os.Remove(snapshots[i].path); err != nil {
+			utils.Fatalf("Snapshot error: %v", err)
+		}
+		fmt.Printf("Removed snapshot of block #%d: %s\n", snapshots[i].number, snapshots[i].path)
+	}
+	return nil
+}
+
+// snapshotFile is a snapshot found on disk along with the block it was taken at.
+type snapshotFile struct {
+	path   string
+	number uint64
+}
+
+// snapshotFiles implements sort.Interface, ordering snapshots newest first.
+type snapshotFiles []snapshotFile
+
+func (s snapshotFiles) Len() int           { return len(s) }
+func (s snapshotFiles) Less(i, j int) bool { return s[i].number > s[j].number }
+func (s snapshotFiles) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// openSnapshot opens a snapshot file for reading, transparently decompressing
+// it if its name ends in ".gz".
+func openSnapshot(fn string) (io.ReadCloser, error) {
+	fh, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(fn, ".gz") {
+		return fh, nil
+	}
+	gz, err := gzip.NewReader(fh)
+	if err != nil {
+		fh.Close()
+		return nil, err
+	}
+	return &gzipFile{gz, fh}, nil
+}
+
+// gzipFile is a decompressing reader closing the underlying file too.
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (f *gzipFile) Close() error {
+	f.Reader.Close()
+	return f.file.Close()
+}
+
+// readSnapshotHeader decodes the header of the given snapshot file.
+func readSnapshotHeader(fn string) (*state.SnapshotHeader, error) {
+	reader, err := openSnapshot(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	header := new(state.SnapshotHeader)
+	if err := rlp.NewStream(reader, 0).Decode(header); err != nil {
+		return nil, err
+	}
+	// Reject anything that merely happens to start with a valid RLP list
+	if header.Root == (common.Hash{}) || header.Hash == (common.Hash{}) {
+		return nil, fmt.Errorf("not a snapshot: %s", fn)
+	}
+	return header, nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of go-ur.
+//
+// go-ur is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ur is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ur. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core"
+	"github.com/ur-technology/go-ur/core/state"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/crypto"
+	"github.com/ur-technology/go-ur/ethdb"
+	"github.com/ur-technology/go-ur/event"
+	"github.com/ur-technology/go-ur/params"
+)
+
+// Tests that loading a snapshot into a node which fast synced the chain without
+// its state makes the snapshot block the head, while a node whose head is past
+// the snapshot block only stores the state.
+func TestSnapshotBootstrap(t *testing.T) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		funds   = big.NewInt(1000000000)
+		config  = &params.ChainConfig{HomesteadBlock: big.NewInt(0)}
+		signer  = types.MakeSigner(config, big.NewInt(0))
+	)
+	// Create a full chain to take a snapshot from
+	fullDb, _ := ethdb.NewMemDatabase()
+	genesis := core.WriteGenesisBlockForTesting(fullDb, core.GenesisAccount{Address: address, Balance: funds})
+	full, _ := core.NewBlockChain(fullDb, config, new(core.FakePow), new(event.TypeMux))
+
+	blocks, receipts := core.GenerateChain(config, full, genesis, fullDb, 8, func(i int, gen *core.BlockGen) {
+		tx, _ := types.NewTransaction(gen.TxNonce(address), common.Address{0x01}, big.NewInt(1000), params.TxGas, nil, nil).SignECDSA(signer, key)
+		gen.AddTx(tx)
+	})
+	if _, err := full.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert full chain: %v", err)
+	}
+	pivot := blocks[5]
+
+	snapshot := new(bytes.Buffer)
+	if _, err := state.WriteSnapshot(snapshot, fullDb, &state.SnapshotHeader{Number: pivot.NumberU64(), Hash: pivot.Hash(), Root: pivot.Root()}); err != nil {
+		t.Fatalf("failed to create snapshot: %v", err)
+	}
+	// Fast sync the headers and receipts without any state into a new node
+	fastDb, _ := ethdb.NewMemDatabase()
+	core.WriteGenesisBlockForTesting(fastDb, core.GenesisAccount{Address: address, Balance: funds})
+	fast, _ := core.NewBlockChain(fastDb, config, new(core.FakePow), new(event.TypeMux))
+
+	headers := make([]*types.Header, len(blocks))
+	for i, block := range blocks {
+		headers[i] = block.Header()
+	}
+	if n, err := fast.InsertHeaderChain(headers, 1); err != nil {
+		t.Fatalf("failed to insert header %d: %v", n, err)
+	}
+	if n, err := fast.InsertReceiptChain(blocks, receipts); err != nil {
+		t.Fatalf("failed to insert receipt %d: %v", n, err)
+	}
+	header, committed, err := bootstrapSnapshot(fast, fastDb, bytes.NewReader(snapshot.Bytes()))
+	if err != nil {
+		t.Fatalf("failed to bootstrap from snapshot: %v", err)
+	}
+	if !committed || header.Hash != pivot.Hash() {
+		t.Fatalf("snapshot block not committed as head")
+	}
+	if head := core.GetHeadBlockHash(fastDb); head != pivot.Hash() {
+		t.Errorf("persisted head mismatch: have %x, want %x", head, pivot.Hash())
+	}
+	statedb, err := fast.State()
+	if err != nil {
+		t.Fatalf("head state unavailable: %v", err)
+	}
+	if have, want := statedb.GetBalance(address), new(big.Int).Sub(funds, big.NewInt(6*1000)); have.Cmp(want) != 0 {
+		t.Errorf("balance mismatch: have %v, want %v", have, want)
+	}
+	// Loading the snapshot into the full node must leave its head alone
+	_, committed, err = bootstrapSnapshot(full, fullDb, bytes.NewReader(snapshot.Bytes()))
+	if err != nil {
+		t.Fatalf("failed to load snapshot into full node: %v", err)
+	}
+	if committed || full.CurrentBlock().Hash() != blocks[len(blocks)-1].Hash() {
+		t.Errorf("head of the full node moved to the snapshot block")
+	}
+}
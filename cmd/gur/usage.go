@@ -64,25 +64,57 @@ var AppHelpFlagGroups = []flagGroup{
 	{
 		Name: "UR",
 		Flags: []cli.Flag{
+			utils.ConfigFileFlag,
 			utils.DataDirFlag,
 			utils.KeyStoreDirFlag,
+			utils.AncientDirFlag,
+			utils.DatabaseKeyFlag,
+			utils.AncientThresholdFlag,
 			utils.NetworkIdFlag,
 			utils.OlympicFlag,
 			utils.TestNetFlag,
 			utils.DevModeFlag,
 			utils.IdentityFlag,
 			utils.FastSyncFlag,
+			utils.CheckpointFlag,
+			utils.CheckpointSignerFlag,
 			utils.LightModeFlag,
 			utils.LightServFlag,
 			utils.LightPeersFlag,
 			utils.LightKDFFlag,
 		},
 	},
+	{
+		Name: "TRANSACTION POOL",
+		Flags: []cli.Flag{
+			utils.TxPoolAccountSlotsFlag,
+			utils.TxPoolGlobalSlotsFlag,
+			utils.TxPoolAccountQueueFlag,
+			utils.TxPoolGlobalQueueFlag,
+			utils.TxPoolLifetimeFlag,
+			utils.TxPoolPriceBumpFlag,
+			utils.TxPoolLocalsFlag,
+			utils.TxPoolJournalFlag,
+			utils.TxPoolRejournalFlag,
+		},
+	},
 	{
 		Name: "PERFORMANCE TUNING",
 		Flags: []cli.Flag{
 			utils.CacheFlag,
+			utils.TrieCacheFlag,
+			utils.TrieCommitIntervalFlag,
+			utils.FlatStateFlag,
+			utils.StateHistoryFlag,
+			utils.TxLookupLimitFlag,
+			utils.GCModeFlag,
 			utils.TrieCacheGenFlag,
+			utils.WorkersFlag,
+			utils.PowCachesFlag,
+			utils.PowDagDirFlag,
+			utils.PowModeFlag,
+			utils.PowVerifiersFlag,
+			utils.PowLightVerifyFlag,
 		},
 	},
 	{
@@ -99,6 +131,13 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.RPCListenAddrFlag,
 			utils.RPCPortFlag,
 			utils.RPCApiFlag,
+			utils.RPCTimeoutsFlag,
+			utils.RPCBatchRequestLimitFlag,
+			utils.RPCBatchResponseMaxSizeFlag,
+			utils.RPCLogsCapFlag,
+			utils.RPCTraceCapFlag,
+			utils.RPCUpstreamFlag,
+			utils.RPCUpstreamForwardFlag,
 			utils.WSEnabledFlag,
 			utils.WSListenAddrFlag,
 			utils.WSPortFlag,
@@ -117,10 +156,14 @@ var AppHelpFlagGroups = []flagGroup{
 		Name: "NETWORKING",
 		Flags: []cli.Flag{
 			utils.BootnodesFlag,
+			utils.StaticNodesFlag,
+			utils.TrustedNodesFlag,
 			utils.ListenPortFlag,
 			utils.MaxPeersFlag,
 			utils.MaxPendingPeersFlag,
 			utils.NATFlag,
+			utils.NATExtIPFlag,
+			utils.NATGatewayFlag,
 			utils.NoDiscoverFlag,
 			utils.DiscoveryV5Flag,
 			utils.NodeKeyFileFlag,
@@ -132,12 +175,26 @@ var AppHelpFlagGroups = []flagGroup{
 		Flags: []cli.Flag{
 			utils.MiningEnabledFlag,
 			utils.MinerThreadsFlag,
+			utils.StratumAddrFlag,
+			utils.StratumHTTPAddrFlag,
+			utils.StratumShareDiffFlag,
+			utils.StratumPayoutFlag,
+			utils.StratumPayoutDepthFlag,
+			utils.StratumPayoutThresholdFlag,
+			utils.StratumPayoutStateFlag,
 			utils.AutoDAGFlag,
 			utils.EtherbaseFlag,
 			utils.UrbaseFlag,
 			utils.TargetGasLimitFlag,
+			utils.MinerGasTargetFlag,
+			utils.MinerGasLimitFlag,
+			utils.MinerSignupsFirstFlag,
+			utils.MinerRecommitFlag,
+			utils.MinerNotifyFlag,
+			utils.MinerCoinbasesFlag,
+			utils.MinerRotationFlag,
 			utils.GasPriceFlag,
-			// utils.ExtraDataFlag,
+			utils.MinerExtraDataFlag,
 		},
 	},
 	{
@@ -149,6 +206,8 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.GpobaseStepDownFlag,
 			utils.GpobaseStepUpFlag,
 			utils.GpobaseCorrectionFactorFlag,
+			utils.GpoBlocksFlag,
+			utils.GpoPercentileFlag,
 		},
 	},
 	{
@@ -163,6 +222,13 @@ var AppHelpFlagGroups = []flagGroup{
 		Name: "LOGGING AND DEBUGGING",
 		Flags: append([]cli.Flag{
 			utils.EthStatsURLFlag,
+			utils.ExplorerAddrFlag,
+			utils.TelemetryURLFlag,
+			utils.WatchlistFlag,
+			utils.RewardMonitorFlag,
+			utils.RewardMonitorCeilingFlag,
+			utils.ReleaseManifestFlag,
+			utils.ReleaseSignerFlag,
 			utils.MetricsEnabledFlag,
 			utils.FakePoWFlag,
 		}, debug.Flags...),
@@ -171,6 +237,12 @@ var AppHelpFlagGroups = []flagGroup{
 		Name: "EXPERIMENTAL",
 		Flags: []cli.Flag{
 			utils.WhisperEnabledFlag,
+			utils.WhisperSignupsFlag,
+			utils.FinalityFlag,
+			utils.FinalityValidatorsFlag,
+			utils.FinalityThresholdFlag,
+			utils.FinalityIntervalFlag,
+			utils.FinalitySignerFlag,
 			utils.NatspecEnabledFlag,
 		},
 	},
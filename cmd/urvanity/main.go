@@ -0,0 +1,208 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of go-ur.
+//
+// go-ur is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ur is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ur. If not, see <http://www.gnu.org/licenses/>.
+
+// Command urvanity grinds keypairs until one has an address matching a vanity
+// prefix and/or suffix, and stores the key encrypted into a keystore. The key
+// never leaves the process in plain text.
+package main
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ur-technology/go-ur/accounts"
+	"github.com/ur-technology/go-ur/cmd/utils"
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/console"
+	"github.com/ur-technology/go-ur/crypto"
+	"github.com/ur-technology/go-ur/node"
+)
+
+// progressInterval is the time between two progress reports.
+const progressInterval = 5 * time.Second
+
+func main() {
+	var (
+		prefix   = flag.String("prefix", "", "hex characters the address must start with")
+		suffix   = flag.String("suffix", "", "hex characters the address must end with")
+		threads  = flag.Int("threads", runtime.NumCPU(), "number of keypairs ground concurrently")
+		keystore = flag.String("keystore", filepath.Join(node.DefaultDataDir(), "keystore"), "keystore directory to store the key in")
+		password = flag.String("password", "", "file containing the passphrase to encrypt the key with (prompted if empty)")
+		lightKDF = flag.Bool("lightkdf", false, "encrypt the key with a weaker KDF, cheaper on memory and CPU")
+	)
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: urvanity [options]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	runtime.GOMAXPROCS(runtime.NumCPU())
+
+	pattern, err := newPattern(*prefix, *suffix)
+	if err != nil {
+		utils.Fatalf("%v", err)
+	}
+	if *threads < 1 {
+		*threads = 1
+	}
+	// Ask for the passphrase before grinding, the search may take long
+	passphrase := readPassphrase(*password)
+
+	fmt.Printf("Searching for an address matching 0x%s…%s with %d threads, %.0f attempts expected\n", pattern.prefix, pattern.suffix, *threads, pattern.difficulty())
+	key, attempts := grind(pattern, *threads)
+
+	scryptN, scryptP := accounts.StandardScryptN, accounts.StandardScryptP
+	if *lightKDF {
+		scryptN, scryptP = accounts.LightScryptN, accounts.LightScryptP
+	}
+	account, err := accounts.NewManager(*keystore, scryptN, scryptP).ImportECDSA(key, passphrase)
+	if err != nil {
+		utils.Fatalf("Failed to store key: %v", err)
+	}
+	fmt.Printf("Found address {%x} after %d attempts\n", account.Address, attempts)
+	fmt.Printf("Key stored in %s\n", account.File)
+}
+
+// pattern is a vanity address pattern, in lowercase hex.
+type pattern struct {
+	prefix string
+	suffix string
+}
+
+// newPattern validates a vanity prefix and suffix, ignoring their case and any
+// 0x prefix.
+func newPattern(prefix, suffix string) (*pattern, error) {
+	p := &pattern{
+		prefix: strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(prefix, "0x"), "0X")),
+		suffix: strings.ToLower(suffix),
+	}
+	if p.prefix == "" && p.suffix == "" {
+		return nil, fmt.Errorf("specify a -prefix and/or a -suffix")
+	}
+	if len(p.prefix)+len(p.suffix) > 2*common.AddressLength {
+		return nil, fmt.Errorf("pattern longer than an address")
+	}
+	for _, c := range p.prefix + p.suffix {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return nil, fmt.Errorf("invalid hex character %q in pattern", c)
+		}
+	}
+	return p, nil
+}
+
+// matches reports whether an address matches the pattern.
+func (p *pattern) matches(addr common.Address) bool {
+	hexaddr := hex.EncodeToString(addr[:])
+	return strings.HasPrefix(hexaddr, p.prefix) && strings.HasSuffix(hexaddr, p.suffix)
+}
+
+// difficulty returns the average number of keypairs to grind for a match.
+func (p *pattern) difficulty() float64 {
+	return math.Pow(16, float64(len(p.prefix)+len(p.suffix)))
+}
+
+// grind generates random keypairs on the given number of threads until one has
+// an address matching the pattern, returning it along with the attempts made.
+func grind(p *pattern, threads int) (*ecdsa.PrivateKey, uint64) {
+	var (
+		attempts uint64
+		found    = make(chan *ecdsa.PrivateKey, threads)
+		quit     = make(chan struct{})
+		wg       sync.WaitGroup
+	)
+	for i := 0; i < threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-quit:
+					return
+				default:
+				}
+				key, err := crypto.GenerateKey()
+				if err != nil {
+					utils.Fatalf("Failed to generate key: %v", err)
+				}
+				atomic.AddUint64(&attempts, 1)
+				if p.matches(crypto.PubkeyToAddress(key.PublicKey)) {
+					found <- key
+					return
+				}
+			}
+		}()
+	}
+	start := time.Now()
+	report := time.NewTicker(progressInterval)
+	defer report.Stop()
+
+	for {
+		select {
+		case key := <-found:
+			close(quit)
+			wg.Wait()
+			return key, atomic.LoadUint64(&attempts)
+		case <-report.C:
+			done := atomic.LoadUint64(&attempts)
+			rate := float64(done) / time.Since(start).Seconds()
+			fmt.Printf("%d attempts, %.0f keys/s, %v expected remaining\n", done, rate, remaining(p.difficulty(), float64(done), rate))
+		}
+	}
+}
+
+// remaining estimates the time left until the expected number of attempts.
+func remaining(expected, done, rate float64) time.Duration {
+	if rate == 0 || done >= expected {
+		return 0
+	}
+	return time.Duration((expected-done)/rate) * time.Second
+}
+
+// readPassphrase reads the passphrase to encrypt the key with from the first
+// line of the given file, or prompts for it if none.
+func readPassphrase(file string) string {
+	if file != "" {
+		text, err := ioutil.ReadFile(file)
+		if err != nil {
+			utils.Fatalf("Failed to read password file: %v", err)
+		}
+		return strings.TrimRight(strings.SplitN(string(text), "\n", 2)[0], "\r")
+	}
+	fmt.Println("The vanity key will be locked with a passphrase. Do not forget it.")
+	passphrase, err := console.Stdin.PromptPassword("Passphrase: ")
+	if err != nil {
+		utils.Fatalf("Failed to read passphrase: %v", err)
+	}
+	confirm, err := console.Stdin.PromptPassword("Repeat passphrase: ")
+	if err != nil {
+		utils.Fatalf("Failed to read passphrase confirmation: %v", err)
+	}
+	if passphrase != confirm {
+		utils.Fatalf("Passphrases do not match")
+	}
+	return passphrase
+}
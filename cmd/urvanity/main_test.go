@@ -0,0 +1,106 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of go-ur.
+//
+// go-ur is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ur is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ur. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/crypto"
+)
+
+func TestPatternValidation(t *testing.T) {
+	tests := []struct {
+		prefix, suffix string
+		ok             bool
+	}{
+		{"", "", false},
+		{"0xDEAD", "", true},
+		{"", "beef", true},
+		{"abc", "123", true},
+		{"xyz", "", false},
+		{"", "g0", false},
+		{"1234567890123456789012345678901234567890", "", true},
+		{"12345678901234567890123456789012345678901", "", false},
+		{"12345678901234567890", "123456789012345678901", false},
+	}
+	for i, tt := range tests {
+		_, err := newPattern(tt.prefix, tt.suffix)
+		if (err == nil) != tt.ok {
+			t.Errorf("test %d: pattern %q…%q: error mismatch: have %v, want ok %v", i, tt.prefix, tt.suffix, err, tt.ok)
+		}
+	}
+}
+
+func TestPatternMatches(t *testing.T) {
+	addr := common.HexToAddress("0xdead00000000000000000000000000000000beef")
+
+	tests := []struct {
+		prefix, suffix string
+		match          bool
+	}{
+		{"0xDEAD", "", true},
+		{"dead", "beef", true},
+		{"", "BEEF", true},
+		{"beef", "", false},
+		{"dead", "dead", false},
+	}
+	for i, tt := range tests {
+		p, err := newPattern(tt.prefix, tt.suffix)
+		if err != nil {
+			t.Fatalf("test %d: failed to create pattern: %v", i, err)
+		}
+		if have := p.matches(addr); have != tt.match {
+			t.Errorf("test %d: match mismatch: have %v, want %v", i, have, tt.match)
+		}
+	}
+}
+
+func TestPatternDifficulty(t *testing.T) {
+	tests := []struct {
+		prefix, suffix string
+		difficulty     float64
+	}{
+		{"a", "", 16},
+		{"ab", "c", 4096},
+		{"", "1234", 65536},
+	}
+	for i, tt := range tests {
+		p, err := newPattern(tt.prefix, tt.suffix)
+		if err != nil {
+			t.Fatalf("test %d: failed to create pattern: %v", i, err)
+		}
+		if have := p.difficulty(); have != tt.difficulty {
+			t.Errorf("test %d: difficulty mismatch: have %v, want %v", i, have, tt.difficulty)
+		}
+	}
+}
+
+// Tests that grinding on multiple threads returns a key matching the pattern.
+func TestGrind(t *testing.T) {
+	p, err := newPattern("0a", "")
+	if err != nil {
+		t.Fatalf("failed to create pattern: %v", err)
+	}
+	key, attempts := grind(p, 4)
+	if addr := crypto.PubkeyToAddress(key.PublicKey); !p.matches(addr) {
+		t.Fatalf("ground address %x doesn't match the pattern", addr)
+	}
+	if attempts == 0 {
+		t.Fatalf("no attempts counted")
+	}
+}
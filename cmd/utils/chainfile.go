@@ -0,0 +1,173 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of go-ur.
+//
+// go-ur is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ur is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ur. If not, see <http://www.gnu.org/licenses/>.
+
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang/snappy"
+	"github.com/ur-technology/go-ur/logger"
+	"github.com/ur-technology/go-ur/logger/glog"
+)
+
+// Compression algorithms supported for chain export files.
+const (
+	CompressNone   = "none"
+	CompressGzip   = "gzip"
+	CompressSnappy = "snappy"
+)
+
+// compressionExts maps the supported compression algorithms to the extension
+// of the files compressed with them.
+var compressionExts = map[string]string{
+	CompressNone:   "",
+	CompressGzip:   ".gz",
+	CompressSnappy: ".sz",
+}
+
+// chunkFileFormat is the name format of the files of a chunked export, numbered
+// by the first block they contain and padded so they sort in chain order.
+const chunkFileFormat = "chain-%010d.rlp"
+
+var (
+	gzipMagic   = []byte{0x1f, 0x8b}
+	snappyMagic = []byte("\xff\x06\x00\x00sNaPpY")
+)
+
+// CompressionByName returns the compression algorithm implied by the extension
+// of a chain file name, defaulting to no compression.
+func CompressionByName(fn string) string {
+	for compression, ext := range compressionExts {
+		if ext != "" && strings.HasSuffix(fn, ext) {
+			return compression
+		}
+	}
+	return CompressNone
+}
+
+// nopWriteCloser is an uncompressed output stream.
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// newCompressor wraps w into a stream compressing with the given algorithm. The
+// stream must be closed to flush the compressed output.
+func newCompressor(w io.Writer, compression string) io.WriteCloser {
+	switch compression {
+	case CompressGzip:
+		return gzip.NewWriter(w)
+	case CompressSnappy:
+		return snappy.NewBufferedWriter(w)
+	default:
+		return nopWriteCloser{w}
+	}
+}
+
+// newDecompressor wraps r into a stream decompressing it, detecting the
+// compression from the leading magic bytes. Plain RLP chain files can't be
+// mistaken for compressed ones, as blocks are lists starting with 0xc0 or above.
+func newDecompressor(r io.Reader) (io.Reader, error) {
+	buf := bufio.NewReader(r)
+	magic, _ := buf.Peek(len(snappyMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(buf)
+	case bytes.Equal(magic, snappyMagic):
+		return snappy.NewReader(buf), nil
+	default:
+		return buf, nil
+	}
+}
+
+// chainFiles returns the files to import for the given path: the path itself,
+// or the chunk files of a chunked export if it is a directory.
+func chainFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	files, err := filepath.Glob(filepath.Join(path, "chain-*.rlp*"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no chain files found in %s", path)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// chainFileReader reads the decompressed contents of a list of chain files back
+// to back, opening each of them only once the previous one is exhausted.
+type chainFileReader struct {
+	files  []string  // Files not opened yet
+	file   *os.File  // File currently being read
+	reader io.Reader // Decompressed stream of the current file
+}
+
+func (r *chainFileReader) Read(p []byte) (int, error) {
+	for {
+		if r.reader == nil {
+			if len(r.files) == 0 {
+				return 0, io.EOF
+			}
+			file, err := os.Open(r.files[0])
+			if err != nil {
+				return 0, err
+			}
+			glog.V(logger.Debug).Infof("reading chain file %s", r.files[0])
+			r.files = r.files[1:]
+
+			if r.reader, err = newDecompressor(file); err != nil {
+				file.Close()
+				return 0, fmt.Errorf("%s: %v", file.Name(), err)
+			}
+			r.file = file
+		}
+		n, err := r.reader.Read(p)
+		if err == io.EOF {
+			r.Close()
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+// Close closes the file currently being read.
+func (r *chainFileReader) Close() error {
+	r.reader = nil
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
@@ -18,12 +18,17 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"regexp"
 	"runtime"
+	"syscall"
+	"time"
 
 	"github.com/ur-technology/go-ur/common"
 	"github.com/ur-technology/go-ur/core"
@@ -73,6 +78,17 @@ func StartNode(stack *node.Node) {
 	if err := stack.Start(); err != nil {
 		Fatalf("Error starting protocol stack: %v", err)
 	}
+	go func() {
+		sigc := make(chan os.Signal, 1)
+		signal.Notify(sigc, syscall.SIGHUP)
+		for range sigc {
+			glog.V(logger.Info).Infoln("Got hangup, reloading configuration...")
+			// Reloading the config also reloads the static and trusted nodes
+			if err := stack.ReloadConfig(); err != nil {
+				glog.V(logger.Error).Infof("Failed to reload configuration: %v", err)
+			}
+		}
+	}()
 	go func() {
 		sigc := make(chan os.Signal, 1)
 		signal.Notify(sigc, os.Interrupt)
@@ -104,7 +120,19 @@ func FormatTransactionData(data string) []byte {
 	return d
 }
 
+// ImportChain imports all the blocks contained in the given file, or in the chunk
+// files of the given directory. Compressed files are detected automatically.
 func ImportChain(chain *core.BlockChain, fn string) error {
+	return ImportChainRange(chain, fn, 0, math.MaxUint64)
+}
+
+// ImportChainRange imports the blocks numbered between first and last (both
+// inclusive) from the given file. Blocks already present in the local chain are
+// skipped, so an interrupted import can be resumed by simply rerunning it.
+func ImportChainRange(chain *core.BlockChain, fn string, first, last uint64) error {
+	if first > last {
+		return fmt.Errorf("import failed: first (%d) is greater than last (%d)", first, last)
+	}
 	// Watch for Ctrl-C while the import is running.
 	// If a signal is received, the import will stop at the next batch.
 	interrupt := make(chan os.Signal, 1)
@@ -128,91 +156,150 @@ func ImportChain(chain *core.BlockChain, fn string) error {
 	}
 
 	glog.Infoln("Importing blockchain ", fn)
-	fh, err := os.Open(fn)
+	files, err := chainFiles(fn)
 	if err != nil {
 		return err
 	}
-	defer fh.Close()
-	stream := rlp.NewStream(fh, 0)
+	reader := &chainFileReader{files: files}
+	defer reader.Close()
+
+	stream := rlp.NewStream(reader, 0)
 
 	// Run actual the import.
-	blocks := make(types.Blocks, importBatchSize)
-	n := 0
-	for batch := 0; ; batch++ {
+	var (
+		blocks   = make(types.Blocks, importBatchSize)
+		n        = 0
+		imported = 0
+		start    = time.Now()
+		done     = false
+	)
+	for batch := 0; !done; batch++ {
 		// Load a batch of RLP blocks.
 		if checkInterrupt() {
 			return fmt.Errorf("interrupted")
 		}
 		i := 0
-		for ; i < importBatchSize; i++ {
+		for i < importBatchSize {
 			var b types.Block
 			if err := stream.Decode(&b); err == io.EOF {
+				done = true
 				break
 			} else if err != nil {
 				return fmt.Errorf("at block %d: %v", n, err)
 			}
-			// don't import first block
-			if b.NumberU64() == 0 {
-				i--
+			n++
+
+			// don't import first block or anything outside the requested range
+			number := b.NumberU64()
+			if number == 0 || number < first {
 				continue
 			}
+			if number > last {
+				done = true
+				break
+			}
 			blocks[i] = &b
-			n++
+			i++
 		}
 		if i == 0 {
-			break
+			continue
 		}
 		// Import the batch.
 		if checkInterrupt() {
 			return fmt.Errorf("interrupted")
 		}
-		if hasAllBlocks(chain, blocks[:i]) {
+		// Drop the leading blocks already present, resuming any previous import
+		known := 0
+		for known < i && chain.HasBlock(blocks[known].Hash()) {
+			known++
+		}
+		if known == i {
 			glog.Infof("skipping batch %d, all blocks present [%x / %x]",
 				batch, blocks[0].Hash().Bytes()[:4], blocks[i-1].Hash().Bytes()[:4])
 			continue
 		}
-
-		if _, err := chain.InsertChain(blocks[:i]); err != nil {
+		if _, err := chain.InsertChain(blocks[known:i]); err != nil {
 			return fmt.Errorf("invalid block %d: %v", n, err)
 		}
+		imported += i - known
+		glog.Infof("imported %d blocks, head #%d [%x], elapsed %v", imported, blocks[i-1].NumberU64(),
+			blocks[i-1].Hash().Bytes()[:4], time.Since(start))
 	}
 	return nil
 }
 
-func hasAllBlocks(chain *core.BlockChain, bs []*types.Block) bool {
-	for _, b := range bs {
-		if !chain.HasBlock(b.Hash()) {
-			return false
-		}
-	}
-	return true
+// ExportChain exports the entire local chain into the given file, truncating
+// it first. The output is compressed according to the file name extension.
+func ExportChain(blockchain *core.BlockChain, fn string) error {
+	return ExportChainFile(blockchain, fn, 0, blockchain.CurrentBlock().NumberU64(), CompressionByName(fn), false)
 }
 
-func ExportChain(blockchain *core.BlockChain, fn string) error {
+// ExportAppendChain exports the blocks numbered between first and last (both
+// inclusive) into the given file, appending to it if it already exists. The
+// output is compressed according to the file name extension.
+func ExportAppendChain(blockchain *core.BlockChain, fn string, first uint64, last uint64) error {
+	return ExportChainFile(blockchain, fn, first, last, CompressionByName(fn), true)
+}
+
+// ExportChainFile exports the blocks numbered between first and last (both
+// inclusive) into the given file, compressed with the given algorithm. Unless
+// appending, the file is truncated first. Compressed output is appended as an
+// additional gzip member or snappy stream, which readers transparently concatenate.
+func ExportChainFile(blockchain *core.BlockChain, fn string, first, last uint64, compression string, append bool) error {
+	if _, ok := compressionExts[compression]; !ok {
+		return fmt.Errorf("unknown compression %q", compression)
+	}
 	glog.Infoln("Exporting blockchain to ", fn)
-	fh, err := os.OpenFile(fn, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if append {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	// TODO verify mode perms
+	fh, err := os.OpenFile(fn, flags, os.ModePerm)
 	if err != nil {
 		return err
 	}
 	defer fh.Close()
-	if err := blockchain.Export(fh); err != nil {
+
+	writer := newCompressor(fh, compression)
+	if err := blockchain.ExportN(writer, first, last); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
 		return err
 	}
 	glog.Infoln("Exported blockchain to ", fn)
 	return nil
 }
 
-func ExportAppendChain(blockchain *core.BlockChain, fn string, first uint64, last uint64) error {
-	glog.Infoln("Exporting blockchain to ", fn)
-	// TODO verify mode perms
-	fh, err := os.OpenFile(fn, os.O_CREATE|os.O_APPEND|os.O_WRONLY, os.ModePerm)
-	if err != nil {
-		return err
+// ExportChainChunks exports the blocks numbered between first and last (both
+// inclusive) into the given directory, split into files of at most chunk blocks
+// each. The files are named after the first block they contain, so importing
+// the directory reads them back in chain order.
+func ExportChainChunks(blockchain *core.BlockChain, dir string, first, last, chunk uint64, compression string) error {
+	if chunk == 0 {
+		return errors.New("chunk size must be positive")
 	}
-	defer fh.Close()
-	if err := blockchain.ExportN(fh, first, last); err != nil {
+	if first > last {
+		return fmt.Errorf("export failed: first (%d) is greater than last (%d)", first, last)
+	}
+	if _, ok := compressionExts[compression]; !ok {
+		return fmt.Errorf("unknown compression %q", compression)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
 		return err
 	}
-	glog.Infoln("Exported blockchain to ", fn)
-	return nil
+	for start := first; ; start += chunk {
+		end := start + chunk - 1
+		if end > last || end < start {
+			end = last
+		}
+		fn := filepath.Join(dir, fmt.Sprintf(chunkFileFormat, start)+compressionExts[compression])
+		if err := ExportChainFile(blockchain, fn, start, end, compression, false); err != nil {
+			return err
+		}
+		if end == last {
+			return nil
+		}
+	}
 }
@@ -0,0 +1,164 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of go-ur.
+//
+// go-ur is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ur is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ur. If not, see <http://www.gnu.org/licenses/>.
+
+package utils
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ur-technology/go-ur/core"
+	"github.com/ur-technology/go-ur/ethdb"
+	"github.com/ur-technology/go-ur/event"
+	"github.com/ur-technology/go-ur/params"
+)
+
+// newTestChain creates a blockchain on top of a fresh testing genesis, with n
+// generated blocks inserted.
+func newTestChain(t *testing.T, n int) *core.BlockChain {
+	db, _ := ethdb.NewMemDatabase()
+	genesis := core.WriteGenesisBlockForTesting(db)
+	config := &params.ChainConfig{HomesteadBlock: big.NewInt(0)}
+
+	chain, err := core.NewBlockChain(db, config, new(core.FakePow), new(event.TypeMux))
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	if n > 0 {
+		blocks, _ := core.GenerateChain(config, chain, genesis, db, n, nil)
+		if _, err := chain.InsertChain(blocks); err != nil {
+			t.Fatalf("failed to insert chain: %v", err)
+		}
+	}
+	return chain
+}
+
+// Tests that gzip compressed chain exports can be imported back, both fully
+// and restricted to a block range, and that reimports resume over known blocks.
+func TestExportImportGzip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gur-export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	source := newTestChain(t, 10)
+	fn := filepath.Join(dir, "chain.rlp.gz")
+	if err := ExportAppendChain(source, fn, 0, 4); err != nil {
+		t.Fatalf("failed to export first range: %v", err)
+	}
+	if err := ExportAppendChain(source, fn, 5, 10); err != nil {
+		t.Fatalf("failed to export second range: %v", err)
+	}
+	// Import only a part of the chain, then resume with the remainder
+	target := newTestChain(t, 0)
+	if err := ImportChainRange(target, fn, 1, 6); err != nil {
+		t.Fatalf("failed to import range: %v", err)
+	}
+	if head := target.CurrentBlock().NumberU64(); head != 6 {
+		t.Fatalf("head mismatch after ranged import: have %d, want %d", head, 6)
+	}
+	if err := ImportChain(target, fn); err != nil {
+		t.Fatalf("failed to resume import: %v", err)
+	}
+	if have, want := target.CurrentBlock().Hash(), source.CurrentBlock().Hash(); have != want {
+		t.Fatalf("head mismatch after full import: have %x, want %x", have, want)
+	}
+	// A full export must round trip as well
+	full := filepath.Join(dir, "full.rlp.gz")
+	if err := ExportChain(source, full); err != nil {
+		t.Fatalf("failed to export chain: %v", err)
+	}
+	fresh := newTestChain(t, 0)
+	if err := ImportChain(fresh, full); err != nil {
+		t.Fatalf("failed to import full export: %v", err)
+	}
+	if have, want := fresh.CurrentBlock().Hash(), source.CurrentBlock().Hash(); have != want {
+		t.Fatalf("head mismatch after full export: have %x, want %x", have, want)
+	}
+}
+
+// Tests that the compression of imported files is detected from their contents,
+// including appended snappy streams, regardless of the file name.
+func TestExportImportDetectCompression(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gur-export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	source := newTestChain(t, 10)
+	for _, compression := range []string{CompressNone, CompressGzip, CompressSnappy} {
+		fn := filepath.Join(dir, "chain-"+compression)
+		if err := ExportChainFile(source, fn, 0, 4, compression, true); err != nil {
+			t.Fatalf("%s: failed to export first range: %v", compression, err)
+		}
+		if err := ExportChainFile(source, fn, 5, 10, compression, true); err != nil {
+			t.Fatalf("%s: failed to export second range: %v", compression, err)
+		}
+		target := newTestChain(t, 0)
+		if err := ImportChain(target, fn); err != nil {
+			t.Fatalf("%s: failed to import: %v", compression, err)
+		}
+		if have, want := target.CurrentBlock().Hash(), source.CurrentBlock().Hash(); have != want {
+			t.Errorf("%s: head mismatch: have %x, want %x", compression, have, want)
+		}
+	}
+	if err := ExportChainFile(source, filepath.Join(dir, "chain"), 0, 10, "lzma", false); err == nil {
+		t.Errorf("export with unknown compression succeeded")
+	}
+}
+
+// Tests that chunked exports are split as requested and can be imported back
+// by pointing the import at their directory.
+func TestExportImportChunks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gur-export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	source := newTestChain(t, 10)
+	if err := ExportChainChunks(source, dir, 0, 10, 3, CompressSnappy); err != nil {
+		t.Fatalf("failed to export chunks: %v", err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	want := []string{"chain-0000000000.rlp.sz", "chain-0000000003.rlp.sz", "chain-0000000006.rlp.sz", "chain-0000000009.rlp.sz"}
+	if len(files) != len(want) {
+		t.Fatalf("chunk count mismatch: have %v, want %v", files, want)
+	}
+	for i, file := range files {
+		if filepath.Base(file) != want[i] {
+			t.Errorf("chunk %d: name mismatch: have %s, want %s", i, filepath.Base(file), want[i])
+		}
+	}
+	target := newTestChain(t, 0)
+	if err := ImportChainRange(target, dir, 1, 7); err != nil {
+		t.Fatalf("failed to import range of chunks: %v", err)
+	}
+	if head := target.CurrentBlock().NumberU64(); head != 7 {
+		t.Fatalf("head mismatch after ranged import: have %d, want %d", head, 7)
+	}
+	if err := ImportChain(target, dir); err != nil {
+		t.Fatalf("failed to import chunks: %v", err)
+	}
+	if have, want := target.CurrentBlock().Hash(), source.CurrentBlock().Hash(); have != want {
+		t.Fatalf("head mismatch after full import: have %x, want %x", have, want)
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of go-ur.
+//
+// go-ur is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ur is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ur. If not, see <http://www.gnu.org/licenses/>.
+
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ConfigEntry is a single key/value option of a configuration file.
+type ConfigEntry struct {
+	Section string      // Table the option was listed under, empty for the root table
+	Key     string      // Name of the option
+	Value   interface{} // String, bool, integer or float value
+	Line    int         // Line the option was read from
+	Default bool        // Written commented out, documenting an unchanged default
+}
+
+// ReadConfig parses the subset of TOML used by configuration files: [tables] of
+// key = value pairs, with string, integer, float and boolean values, along with
+// # comments. Arrays, inline tables and dotted keys are not supported.
+func ReadConfig(r io.Reader) ([]ConfigEntry, error) {
+	var (
+		entries []ConfigEntry
+		section string
+		seen    = make(map[string]bool)
+		scanner = bufio.NewScanner(r)
+	)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		// Table headers only group the keys that follow them
+		if text[0] == '[' {
+			end := strings.IndexByte(text, ']')
+			if end < 0 || !isBareKey(strings.TrimSpace(text[1:end])) || !isComment(text[end+1:]) {
+				return nil, fmt.Errorf("line %d: invalid table header %q", line, text)
+			}
+			section = strings.TrimSpace(text[1:end])
+			continue
+		}
+		// Quoted keys may contain the separator themselves
+		eq := strings.IndexByte(text, '=')
+		if text[0] == '"' {
+			if end := strings.IndexByte(text[1:], '"') + 2; end > 1 {
+				if eq = strings.IndexByte(text[end:], '='); eq >= 0 {
+					eq += end
+				}
+			}
+		}
+		if eq < 0 {
+			return nil, fmt.Errorf("line %d: expected key = value", line)
+		}
+		key, err := parseConfigKey(strings.TrimSpace(text[:eq]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		if seen[section+"."+key] {
+			return nil, fmt.Errorf("line %d: duplicate key %q", line, key)
+		}
+		seen[section+"."+key] = true
+
+		value, err := parseConfigValue(strings.TrimSpace(text[eq+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		entries = append(entries, ConfigEntry{Section: section, Key: key, Value: value, Line: line})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// parseConfigKey parses a bare or quoted TOML key. Dotted keys are rejected as
+// the flat list of options has no use for nested tables.
+func parseConfigKey(text string) (string, error) {
+	if isBareKey(text) {
+		return text, nil
+	}
+	if len(text) > 1 && text[0] == '"' && text[len(text)-1] == '"' {
+		if key, err := strconv.Unquote(text); err == nil && key != "" {
+			return key, nil
+		}
+	}
+	return "", fmt.Errorf("invalid key %s", text)
+}
+
+// parseConfigValue parses a single TOML value along with any trailing comment.
+func parseConfigValue(text string) (interface{}, error) {
+	switch {
+	case text == "":
+		return nil, errors.New("missing value")
+
+	case text[0] == '"':
+		end := 1
+		for ; end < len(text) && text[end] != '"'; end++ {
+			if text[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(text) || !isComment(text[end+1:]) {
+			return nil, fmt.Errorf("invalid string %s", text)
+		}
+		value, err := strconv.Unquote(text[:end+1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid string %s", text)
+		}
+		return value, nil
+
+	case text[0] == '\'':
+		end := strings.IndexByte(text[1:], '\'') + 1
+		if end == 0 || !isComment(text[end+1:]) {
+			return nil, fmt.Errorf("invalid string %s", text)
+		}
+		return text[1:end], nil
+	}
+	if hash := strings.IndexByte(text, '#'); hash >= 0 {
+		text = strings.TrimSpace(text[:hash])
+	}
+	switch text {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	number := strings.Replace(text, "_", "", -1)
+	if value, err := strconv.ParseInt(number, 10, 64); err == nil {
+		return value, nil
+	}
+	if value, err := strconv.ParseFloat(number, 64); err == nil {
+		return value, nil
+	}
+	return nil, fmt.Errorf("invalid value %s", text)
+}
+
+// WriteConfig writes the entries as a configuration file readable by ReadConfig,
+// starting a new table whenever the section of consecutive entries changes.
+func WriteConfig(w io.Writer, entries []ConfigEntry) error {
+	buf := bufio.NewWriter(w)
+	for i, entry := range entries {
+		if i == 0 || entry.Section != entries[i-1].Section {
+			if i > 0 {
+				buf.WriteString("\n")
+			}
+			if entry.Section != "" {
+				fmt.Fprintf(buf, "[%s]\n", entry.Section)
+			}
+		}
+		var value string
+		switch v := entry.Value.(type) {
+		case string:
+			value = strconv.Quote(v)
+		case bool, int, int64, uint64, float64:
+			value = fmt.Sprint(v)
+		default:
+			return fmt.Errorf("unsupported value type %T for key %q", v, entry.Key)
+		}
+		if entry.Default {
+			buf.WriteString("# ")
+		}
+		key := entry.Key
+		if !isBareKey(key) {
+			key = strconv.Quote(key)
+		}
+		fmt.Fprintf(buf, "%s = %s\n", key, value)
+	}
+	return buf.Flush()
+}
+
+// isBareKey reports whether key is a valid unquoted TOML key.
+func isBareKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, c := range key {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// isComment reports whether text is empty or only holds a comment.
+func isComment(text string) bool {
+	text = strings.TrimSpace(text)
+	return text == "" || text[0] == '#'
+}
@@ -0,0 +1,112 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of go-ur.
+//
+// go-ur is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ur is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ur. If not, see <http://www.gnu.org/licenses/>.
+
+package utils
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadConfig(t *testing.T) {
+	input := `# Node settings
+identity = "my \"node\"" # trailing comment
+datadir = '/var/lib/gur'
+
+[networking]
+maxpeers = 25
+nodiscover = false
+  port = 30_303
+ratio = 0.5 # trailing comment
+"rpc.logs-cap" = 100
+`
+	want := []ConfigEntry{
+		{Section: "", Key: "identity", Value: `my "node"`, Line: 2},
+		{Section: "", Key: "datadir", Value: "/var/lib/gur", Line: 3},
+		{Section: "networking", Key: "maxpeers", Value: int64(25), Line: 6},
+		{Section: "networking", Key: "nodiscover", Value: false, Line: 7},
+		{Section: "networking", Key: "port", Value: int64(30303), Line: 8},
+		{Section: "networking", Key: "ratio", Value: 0.5, Line: 9},
+		{Section: "networking", Key: "rpc.logs-cap", Value: int64(100), Line: 10},
+	}
+	entries, err := ReadConfig(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("entries mismatch:\nhave %+v\nwant %+v", entries, want)
+	}
+}
+
+func TestReadConfigErrors(t *testing.T) {
+	tests := []struct {
+		input, err string
+	}{
+		{"key", "line 1: expected key = value"},
+		{"key =", "line 1: missing value"},
+		{"key = value", "line 1: invalid value value"},
+		{"key = \"unterminated", "line 1: invalid string \"unterminated"},
+		{"key = 'a' b", "line 1: invalid string 'a' b"},
+		{"a.b = 1", "line 1: invalid key a.b"},
+		{`"a = 1`, `line 1: invalid key "a`},
+		{`"a"`, "line 1: expected key = value"},
+		{"a = 1\na = 2", `line 2: duplicate key "a"`},
+		{"[[array]]", `line 1: invalid table header "[[array]]"`},
+		{"key = [1, 2]", "line 1: invalid value [1, 2]"},
+	}
+	for _, tt := range tests {
+		_, err := ReadConfig(strings.NewReader(tt.input))
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("%q: error mismatch: have %v, want %s", tt.input, err, tt.err)
+		}
+	}
+}
+
+func TestWriteConfig(t *testing.T) {
+	entries := []ConfigEntry{
+		{Section: "ur", Key: "datadir", Value: "/tmp/\"quoted\""},
+		{Section: "ur", Key: "testnet", Value: false, Default: true},
+		{Section: "networking", Key: "maxpeers", Value: 25},
+		{Section: "networking", Key: "nodiscover", Value: true},
+		{Section: "networking", Key: "rpc.logs-cap", Value: 100},
+	}
+	want := `[ur]
+datadir = "/tmp/\"quoted\""
+# testnet = false
+
+[networking]
+maxpeers = 25
+nodiscover = true
+"rpc.logs-cap" = 100
+`
+	buf := new(bytes.Buffer)
+	if err := WriteConfig(buf, entries); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	if buf.String() != want {
+		t.Fatalf("output mismatch:\nhave:\n%s\nwant:\n%s", buf, want)
+	}
+	// Reading the output back should yield everything but the defaults
+	read, err := ReadConfig(buf)
+	if err != nil {
+		t.Fatalf("failed to read written config: %v", err)
+	}
+	if len(read) != 4 || read[0].Value != "/tmp/\"quoted\"" || read[1].Value != int64(25) || read[2].Value != true || read[3].Key != "rpc.logs-cap" {
+		t.Errorf("read back mismatch: %+v", read)
+	}
+}
@@ -39,6 +39,11 @@ func (self *DirectoryString) String() string {
 }
 
 func (self *DirectoryString) Set(value string) error {
+	// Keep an empty path empty instead of cleaning it to the working directory
+	if value == "" {
+		self.Value = ""
+		return nil
+	}
 	self.Value = expandPath(value)
 	return nil
 }
@@ -122,7 +127,7 @@ func withEnvHint(envVar, str string) string {
 	return str + envText
 }
 
-func (self DirectoryFlag) getName() string {
+func (self DirectoryFlag) GetName() string {
 	return self.Name
 }
 
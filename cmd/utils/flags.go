@@ -18,30 +18,40 @@
 package utils
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"fmt"
 	"io/ioutil"
 	"math"
 	"math/big"
+	"net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ur-technology/go-ur/accounts"
 	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/console"
 	"github.com/ur-technology/go-ur/core"
 	"github.com/ur-technology/go-ur/core/state"
 	"github.com/ur-technology/go-ur/crypto"
 	"github.com/ur-technology/go-ur/eth"
+	"github.com/ur-technology/go-ur/eth/downloader"
+	"github.com/ur-technology/go-ur/eth/gasprice"
 	"github.com/ur-technology/go-ur/ethdb"
 	"github.com/ur-technology/go-ur/ethstats"
 	"github.com/ur-technology/go-ur/event"
+	"github.com/ur-technology/go-ur/explorer"
+	"github.com/ur-technology/go-ur/finality"
 	"github.com/ur-technology/go-ur/les"
 	"github.com/ur-technology/go-ur/logger"
 	"github.com/ur-technology/go-ur/logger/glog"
 	"github.com/ur-technology/go-ur/metrics"
+	"github.com/ur-technology/go-ur/miner"
 	"github.com/ur-technology/go-ur/node"
 	"github.com/ur-technology/go-ur/p2p/discover"
 	"github.com/ur-technology/go-ur/p2p/discv5"
@@ -49,7 +59,12 @@ import (
 	"github.com/ur-technology/go-ur/p2p/netutil"
 	"github.com/ur-technology/go-ur/params"
 	"github.com/ur-technology/go-ur/pow"
+	"github.com/ur-technology/go-ur/rewardmon"
 	"github.com/ur-technology/go-ur/rpc"
+	"github.com/ur-technology/go-ur/signupcast"
+	"github.com/ur-technology/go-ur/telemetry"
+	"github.com/ur-technology/go-ur/urext"
+	"github.com/ur-technology/go-ur/watchlist"
 	whisper "github.com/ur-technology/go-ur/whisper/whisperv2"
 	"github.com/ur-technology/urhash"
 	"gopkg.in/urfave/cli.v1"
@@ -105,6 +120,10 @@ func NewApp(gitCommit, usage string) *cli.App {
 
 var (
 	// General settings
+	ConfigFileFlag = cli.StringFlag{
+		Name:  "config",
+		Usage: "TOML configuration file to read flag values from (command line flags take precedence)",
+	}
 	DataDirFlag = DirectoryFlag{
 		Name:  "datadir",
 		Usage: "Data directory for the databases and keystore",
@@ -114,6 +133,19 @@ var (
 		Name:  "keystore",
 		Usage: "Directory for the keystore (default = inside the datadir)",
 	}
+	AncientDirFlag = DirectoryFlag{
+		Name:  "datadir.ancient",
+		Usage: "Directory for the ancient chain segments (default = inside the chaindata)",
+	}
+	DatabaseKeyFlag = cli.StringFlag{
+		Name:  "datadir.key",
+		Usage: "Source of the key encrypting the databases at rest: file:<path>, cmd:<command> printing it (e.g. a KMS client) or prompt",
+	}
+	AncientThresholdFlag = cli.Uint64Flag{
+		Name:  "ancient.threshold",
+		Usage: "Number of recent blocks kept in the database, older ones are moved to the ancient store (0 = disabled)",
+		Value: core.DefaultAncientThreshold,
+	}
 	NetworkIdFlag = cli.IntFlag{
 		Name:  "networkid",
 		Usage: "Network identifier (integer, 0=Olympic (disused), 1=Frontier, 2=Morden (disused), 3=Ropsten)",
@@ -129,7 +161,7 @@ var (
 	}
 	DevModeFlag = cli.BoolFlag{
 		Name:  "dev",
-		Usage: "Developer mode: pre-configured private network with several debugging flags",
+		Usage: "Developer mode: private chain sealing blocks instantly on pending transactions, with prefunded and privileged accounts",
 	}
 	IdentityFlag = cli.StringFlag{
 		Name:  "identity",
@@ -148,6 +180,14 @@ var (
 		Name:  "fast",
 		Usage: "Enable fast syncing through state downloads",
 	}
+	CheckpointFlag = cli.StringFlag{
+		Name:  "checkpoint",
+		Usage: "Signed weak subjectivity checkpoint (JSON file) every synced chain must pass through",
+	}
+	CheckpointSignerFlag = cli.StringFlag{
+		Name:  "checkpoint.signer",
+		Usage: "Address of the key the checkpoint must be signed with",
+	}
 	LightModeFlag = cli.BoolFlag{
 		Name:  "light",
 		Usage: "Enable light client mode",
@@ -172,11 +212,70 @@ var (
 		Usage: "Megabytes of memory allocated to internal caching (min 16MB / database forced)",
 		Value: 128,
 	}
+	TrieCacheFlag = cli.IntFlag{
+		Name:  "cache.trie",
+		Usage: "Megabytes of memory allocated to recent states before writing them to disk (full gcmode)",
+		Value: 64,
+	}
+	TrieCommitIntervalFlag = cli.Uint64Flag{
+		Name:  "cache.trie.interval",
+		Usage: "Number of blocks between writes of the head state to disk (full gcmode)",
+		Value: core.DefaultTrieCommitInterval,
+	}
+	FlatStateFlag = cli.IntFlag{
+		Name:  "cache.flat",
+		Usage: "Number of accounts and storage slots of the recent states kept in a flat view for fast reads (0 = disabled)",
+		Value: 250000,
+	}
+	StateHistoryFlag = cli.Uint64Flag{
+		Name:  "history.state",
+		Usage: "Number of recent blocks whose states can be queried after being garbage collected, kept as reverse diffs (0 = disabled, full gcmode)",
+		Value: 0,
+	}
+	TxLookupLimitFlag = cli.IntFlag{
+		Name:  "txlookuplimit",
+		Usage: "Number of recent blocks whose transactions can be looked up by hash (0 = entire chain, -1 = disabled)",
+		Value: 0,
+	}
+	GCModeFlag = cli.StringFlag{
+		Name:  "gcmode",
+		Usage: `Blockchain garbage collection mode ("full", "archive")`,
+		Value: "full",
+	}
 	TrieCacheGenFlag = cli.IntFlag{
 		Name:  "trie-cache-gens",
 		Usage: "Number of trie node generations to keep in memory",
 		Value: int(state.MaxTrieCacheGen),
 	}
+	WorkersFlag = cli.IntFlag{
+		Name:  "workers",
+		Usage: "Maximum number of concurrent workers of each parallel task (0 = one per CPU)",
+		Value: 0,
+	}
+	PowCachesFlag = cli.IntFlag{
+		Name:  "urhash-caches",
+		Usage: "Number of recent urhash verification caches to keep in memory (16MB+ each)",
+		Value: 3,
+	}
+	PowDagDirFlag = DirectoryFlag{
+		Name:  "urhash-dagdir",
+		Usage: "Directory to store the urhash DAGs in, shareable between instances",
+		Value: DirectoryString{urhash.DefaultDir},
+	}
+	PowModeFlag = cli.StringFlag{
+		Name:  "urhash-mode",
+		Usage: `Proof-of-work mode ("normal", "shared", "test" or "fake", the latter two for testing only)`,
+		Value: "normal",
+	}
+	PowVerifiersFlag = cli.IntFlag{
+		Name:  "urhash-verifiers",
+		Usage: "Number of concurrent proof-of-work verification workers (0 = one per CPU)",
+		Value: 0,
+	}
+	PowLightVerifyFlag = cli.BoolFlag{
+		Name:  "urhash-lightverify",
+		Usage: "Only verify the proof-of-work of a random sample of imported blocks (non-mining nodes)",
+	}
 	// Fork settings
 	SupportDAOFork = cli.BoolFlag{
 		Name:  "support-dao-fork",
@@ -201,6 +300,68 @@ var (
 		Usage: "Target gas limit sets the artificial target gas floor for the blocks to mine",
 		Value: params.GenesisGasLimit.String(),
 	}
+	MinerGasTargetFlag = cli.StringFlag{
+		Name:  "miner.gastarget",
+		Usage: "Gas limit the mined blocks vote toward (default = --targetgaslimit)",
+	}
+	MinerGasLimitFlag = cli.StringFlag{
+		Name:  "miner.gaslimit",
+		Usage: "Gas limit ceiling the mined blocks vote down to and never exceed (empty = none)",
+	}
+	MinerRecommitFlag = cli.DurationFlag{
+		Name:  "miner.recommit",
+		Usage: "Time interval to rebuild the mined block with newly arrived transactions (0 = on new blocks only)",
+		Value: 3 * time.Second,
+	}
+	MinerNotifyFlag = cli.StringFlag{
+		Name:  "miner.notify",
+		Usage: "Comma separated HTTP URLs to post new work packages to",
+	}
+	MinerCoinbasesFlag = cli.StringFlag{
+		Name:  "miner.coinbases",
+		Usage: "Comma separated coinbases the mined blocks rotate through (default = etherbase only)",
+	}
+	MinerRotationFlag = cli.Uint64Flag{
+		Name:  "miner.rotation",
+		Usage: "Number of consecutive blocks mined to each of the rotated coinbases",
+		Value: 1,
+	}
+	MinerSignupsFirstFlag = cli.BoolFlag{
+		Name:  "miner.signupsfirst",
+		Usage: "Place the signup transactions of the privileged accounts at the front of the mined blocks",
+	}
+	StratumAddrFlag = cli.StringFlag{
+		Name:  "stratum",
+		Usage: "Listen address of the stratum server for external miners (empty = disabled)",
+	}
+	StratumHTTPAddrFlag = cli.StringFlag{
+		Name:  "stratum.http",
+		Usage: "Listen address of the getwork HTTP server for external miners (empty = disabled)",
+	}
+	StratumShareDiffFlag = cli.StringFlag{
+		Name:  "stratum.diff",
+		Usage: "Difficulty of the shares submitted by external miners (0 = block difficulty)",
+		Value: "0",
+	}
+	StratumPayoutFlag = cli.StringFlag{
+		Name:  "stratum.payout",
+		Usage: "Unlocked coinbase splitting the mined rewards across the stratum workers (empty = disabled)",
+	}
+	StratumPayoutDepthFlag = cli.Uint64Flag{
+		Name:  "stratum.payout.depth",
+		Usage: "Confirmations a mined block needs before its rewards are split",
+		Value: 12,
+	}
+	StratumPayoutThresholdFlag = cli.StringFlag{
+		Name:  "stratum.payout.threshold",
+		Usage: "Minimum balance of a worker paid out, in wei",
+		Value: "0",
+	}
+	StratumPayoutStateFlag = cli.StringFlag{
+		Name:  "stratum.payout.state",
+		Usage: "File the share state of the workers is persisted to, relative to the data directory",
+		Value: "payouts.json",
+	}
 	AutoDAGFlag = cli.BoolFlag{
 		Name:  "autodag",
 		Usage: "Enable automatic DAG pregeneration",
@@ -220,10 +381,10 @@ var (
 		Usage: "Minimal gas price to accept for mining a transactions",
 		Value: new(big.Int).Mul(big.NewInt(20), common.Shannon).String(),
 	}
-	// ExtraDataFlag = cli.StringFlag{
-	// 	Name:  "extradata",
-	// 	Usage: "Block extra data set by the miner (default = client version)",
-	// }
+	MinerExtraDataFlag = cli.StringFlag{
+		Name:  "miner.extradata",
+		Usage: "Block extra data set by the miner (default = client version)",
+	}
 	// Account settings
 	UnlockedAccountFlag = cli.StringFlag{
 		Name:  "unlock",
@@ -254,6 +415,34 @@ var (
 		Name:  "ethstats",
 		Usage: "Reporting URL of a ethstats service (nodename:secret@host:port)",
 	}
+	ExplorerAddrFlag = cli.StringFlag{
+		Name:  "explorer",
+		Usage: "Listening address of the built-in chain explorer (e.g. localhost:8090)",
+	}
+	TelemetryURLFlag = cli.StringFlag{
+		Name:  "telemetry",
+		Usage: "Opt-in reporting of anonymized node statistics to an HTTPS endpoint",
+	}
+	WatchlistFlag = cli.BoolFlag{
+		Name:  "watchlist",
+		Usage: "Enable webhook notifications for the addresses of the watchlist (managed via the watchlist RPC API)",
+	}
+	RewardMonitorFlag = cli.BoolFlag{
+		Name:  "rewardmonitor",
+		Usage: "Cross-check the issuance of imported blocks against the reward schedule, raising critical alerts on violations",
+	}
+	RewardMonitorCeilingFlag = cli.StringFlag{
+		Name:  "rewardmonitor.ceiling",
+		Usage: "Fixed per-block issuance ceiling in wei (default = derived from the reward schedule)",
+	}
+	ReleaseManifestFlag = cli.StringFlag{
+		Name:  "release.manifest",
+		Usage: "Opt-in periodic check of a signed release manifest at an HTTP(S) URL for newer releases",
+	}
+	ReleaseSignerFlag = cli.StringFlag{
+		Name:  "release.signer",
+		Usage: "Address of the key the release manifest must be signed with",
+	}
 	MetricsEnabledFlag = cli.BoolFlag{
 		Name:  metrics.MetricsEnabledFlag,
 		Usage: "Enable metrics collection and reporting",
@@ -288,6 +477,41 @@ var (
 		Usage: "API's offered over the HTTP-RPC interface",
 		Value: rpc.DefaultHTTPApis,
 	}
+	RPCBatchRequestLimitFlag = cli.IntFlag{
+		Name:  "rpc.batch-request-limit",
+		Usage: "Maximum number of requests in a JSON-RPC batch (0 = unlimited)",
+		Value: 1000,
+	}
+	RPCBatchResponseMaxSizeFlag = cli.IntFlag{
+		Name:  "rpc.batch-response-max-size",
+		Usage: "Maximum number of bytes returned from a JSON-RPC batch (0 = unlimited)",
+		Value: 25 * 1000 * 1000,
+	}
+	RPCLogsCapFlag = cli.IntFlag{
+		Name:  "rpc.logs-cap",
+		Usage: "Maximum number of logs returned by a single log query (0 = unlimited)",
+		Value: 10000,
+	}
+	RPCTraceCapFlag = cli.IntFlag{
+		Name:  "rpc.trace-cap",
+		Usage: "Maximum number of struct logs returned by a single debug trace (0 = unlimited)",
+		Value: 100000,
+	}
+	RPCTimeoutsFlag = cli.StringFlag{
+		Name:  "rpctimeouts",
+		Usage: "Comma separated list of per namespace RPC execution deadlines (e.g. eth=5s,debug=5m)",
+		Value: "",
+	}
+	RPCUpstreamFlag = cli.StringFlag{
+		Name:  "rpc.upstream",
+		Usage: "Comma separated RPC endpoints of full nodes to forward calls not served locally to, in order of preference",
+		Value: "",
+	}
+	RPCUpstreamForwardFlag = cli.StringFlag{
+		Name:  "rpc.upstream-forward",
+		Usage: "Comma separated namespaces or methods always forwarded to the upstream nodes (e.g. personal,ur_sendRawTransaction)",
+		Value: "",
+	}
 	IPCDisabledFlag = cli.BoolFlag{
 		Name:  "ipcdisable",
 		Usage: "Disable the IPC-RPC server",
@@ -356,6 +580,14 @@ var (
 		Usage: "Comma separated enode URLs for P2P discovery bootstrap",
 		Value: "",
 	}
+	StaticNodesFlag = cli.StringFlag{
+		Name:  "staticnodes",
+		Usage: "Comma separated enode URLs of the peers to always stay connected to (in addition to static-nodes.json)",
+	}
+	TrustedNodesFlag = cli.StringFlag{
+		Name:  "trustednodes",
+		Usage: "Comma separated enode URLs of the peers always allowed to connect (in addition to trusted-nodes.json)",
+	}
 	NodeKeyFileFlag = cli.StringFlag{
 		Name:  "nodekey",
 		Usage: "P2P node key file",
@@ -366,8 +598,16 @@ var (
 	}
 	NATFlag = cli.StringFlag{
 		Name:  "nat",
-		Usage: "NAT port mapping mechanism (any|none|upnp|pmp|extip:<IP>)",
-		Value: "any",
+		Usage: "NAT port mapping mechanism (auto|any|none|upnp|pmp|pmp:<gateway>|extip:<IP>)",
+		Value: "auto",
+	}
+	NATExtIPFlag = cli.StringFlag{
+		Name:  "nat.extip",
+		Usage: "External IP address the node is reachable on, with ports mapped manually (implies --nat extip)",
+	}
+	NATGatewayFlag = cli.StringFlag{
+		Name:  "nat.gateway",
+		Usage: "Address of the NAT-PMP gateway, instead of auto-detecting it (implies --nat pmp)",
 	}
 	NoDiscoverFlag = cli.BoolFlag{
 		Name:  "nodiscover",
@@ -386,6 +626,31 @@ var (
 		Name:  "shh",
 		Usage: "Enable Whisper",
 	}
+	WhisperSignupsFlag = cli.BoolFlag{
+		Name:  "shh.signups",
+		Usage: "Broadcast the signups of imported blocks on the whisper topic \"" + signupcast.TopicName + "\" (requires --shh)",
+	}
+	FinalityFlag = cli.BoolFlag{
+		Name:  "finality",
+		Usage: "Refuse reorgs past the checkpoints signed by the validator set on the whisper topic \"" + finality.TopicName + "\" (requires --shh)",
+	}
+	FinalityValidatorsFlag = cli.StringFlag{
+		Name:  "finality.validators",
+		Usage: "Comma separated addresses of the checkpoint validators (default = privileged addresses)",
+	}
+	FinalityThresholdFlag = cli.IntFlag{
+		Name:  "finality.threshold",
+		Usage: "Validator signatures required to finalize a checkpoint (0 = two thirds majority)",
+	}
+	FinalityIntervalFlag = cli.Uint64Flag{
+		Name:  "finality.interval",
+		Usage: "Number of blocks between checkpoints",
+		Value: finality.DefaultInterval,
+	}
+	FinalitySignerFlag = cli.StringFlag{
+		Name:  "finality.signer",
+		Usage: "Unlocked validator account to sign checkpoints with (address or index)",
+	}
 
 	// ATM the url is left to the user and deployment to
 	JSpathFlag = cli.StringFlag{
@@ -399,6 +664,52 @@ var (
 		Value: "solc",
 	}
 
+	// Transaction pool settings
+	TxPoolAccountSlotsFlag = cli.Uint64Flag{
+		Name:  "txpool.accountslots",
+		Usage: "Minimum number of executable transaction slots guaranteed per account",
+		Value: core.DefaultTxPoolLimits().AccountSlots,
+	}
+	TxPoolGlobalSlotsFlag = cli.Uint64Flag{
+		Name:  "txpool.globalslots",
+		Usage: "Maximum number of executable transaction slots for all accounts",
+		Value: core.DefaultTxPoolLimits().GlobalSlots,
+	}
+	TxPoolAccountQueueFlag = cli.Uint64Flag{
+		Name:  "txpool.accountqueue",
+		Usage: "Maximum number of non-executable transaction slots permitted per account",
+		Value: core.DefaultTxPoolLimits().AccountQueue,
+	}
+	TxPoolGlobalQueueFlag = cli.Uint64Flag{
+		Name:  "txpool.globalqueue",
+		Usage: "Maximum number of non-executable transaction slots for all accounts",
+		Value: core.DefaultTxPoolLimits().GlobalQueue,
+	}
+	TxPoolLifetimeFlag = cli.DurationFlag{
+		Name:  "txpool.lifetime",
+		Usage: "Maximum amount of time non-executable transactions are queued",
+		Value: core.DefaultTxPoolLimits().Lifetime,
+	}
+	TxPoolPriceBumpFlag = cli.Uint64Flag{
+		Name:  "txpool.pricebump",
+		Usage: "Price bump percentage to replace an already existing transaction",
+		Value: core.DefaultTxPoolLimits().PriceBump,
+	}
+	TxPoolLocalsFlag = cli.StringFlag{
+		Name:  "txpool.locals",
+		Usage: "Comma separated accounts to treat as locals (no gas price floor, no eviction)",
+	}
+	TxPoolJournalFlag = cli.StringFlag{
+		Name:  "txpool.journal",
+		Usage: "Disk journal for local transactions to survive node restarts (empty = disabled)",
+		Value: "transactions.rlp",
+	}
+	TxPoolRejournalFlag = cli.DurationFlag{
+		Name:  "txpool.rejournal",
+		Usage: "Time interval to regenerate the local transaction journal",
+		Value: time.Hour,
+	}
+
 	// Gas price oracle settings
 	GpoMinGasPriceFlag = cli.StringFlag{
 		Name:  "gpomin",
@@ -430,6 +741,16 @@ var (
 		Usage: "Suggested gas price base correction factor (%)",
 		Value: 110,
 	}
+	GpoBlocksFlag = cli.IntFlag{
+		Name:  "gpoblocks",
+		Usage: "Number of recent blocks to sample for gas price suggestions (0 = track a base price instead)",
+		Value: 20,
+	}
+	GpoPercentileFlag = cli.IntFlag{
+		Name:  "gpopercentile",
+		Usage: "Suggested gas price is the given percentile of the lowest prices of the sampled blocks",
+		Value: 50,
+	}
 )
 
 // MakeDataDir retrieves the currently requested data directory, terminating
@@ -520,6 +841,28 @@ func MakeBootstrapNodes(ctx *cli.Context) []*discover.Node {
 	return bootnodes
 }
 
+// SplitNodeURLs splits a comma separated list of enode URLs.
+func SplitNodeURLs(list string) []string {
+	var urls []string
+	for _, url := range strings.Split(list, ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
+// MakeNodeURLs parses the enode URLs of a static or trusted node list flag.
+func MakeNodeURLs(ctx *cli.Context, flag cli.StringFlag) []string {
+	urls := SplitNodeURLs(ctx.GlobalString(flag.Name))
+	for _, url := range urls {
+		if _, err := discover.ParseNode(url); err != nil {
+			Fatalf("Option %q: node URL %s: %v", flag.Name, url, err)
+		}
+	}
+	return urls
+}
+
 // MakeBootstrapNodesV5 creates a list of bootstrap nodes from the command line
 // flags, reverting to pre-configured ones if none have been specified.
 func MakeBootstrapNodesV5(ctx *cli.Context) []*discv5.Node {
@@ -555,7 +898,24 @@ func MakeDiscoveryV5Address(ctx *cli.Context) string {
 
 // MakeNAT creates a port mapper from set command line flags.
 func MakeNAT(ctx *cli.Context) nat.Interface {
-	natif, err := nat.Parse(ctx.GlobalString(NATFlag.Name))
+	spec := ctx.GlobalString(NATFlag.Name)
+	mech := strings.ToLower(strings.SplitN(spec, ":", 2)[0])
+
+	// The explicit external IP and gateway flags select their own mechanism
+	explicit := ctx.GlobalIsSet(NATFlag.Name)
+	if ctx.GlobalIsSet(NATExtIPFlag.Name) {
+		if explicit && mech != "extip" && mech != "ip" {
+			Fatalf("Option %s: conflicts with --%s %s", NATExtIPFlag.Name, NATFlag.Name, spec)
+		}
+		spec, mech, explicit = "extip:"+ctx.GlobalString(NATExtIPFlag.Name), "extip", true
+	}
+	if ctx.GlobalIsSet(NATGatewayFlag.Name) {
+		if explicit && mech != "pmp" && mech != "natpmp" && mech != "nat-pmp" {
+			Fatalf("Option %s: conflicts with --%s %s", NATGatewayFlag.Name, NATFlag.Name, spec)
+		}
+		spec = "pmp:" + ctx.GlobalString(NATGatewayFlag.Name)
+	}
+	natif, err := nat.Parse(spec)
 	if err != nil {
 		Fatalf("Option %s: %v", NATFlag.Name, err)
 	}
@@ -580,6 +940,92 @@ func MakeRPCModules(input string) []string {
 	return result
 }
 
+// MakeRPCUpstreams parses a comma separated list of upstream RPC endpoints or
+// forwarded namespaces and methods, dropping empty entries.
+func MakeRPCUpstreams(input string) []string {
+	var result []string
+	for _, entry := range strings.Split(input, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// MakeRPCTimeouts parses a comma separated list of namespace=duration pairs into
+// the per namespace execution deadlines of the RPC servers.
+func MakeRPCTimeouts(input string) map[string]time.Duration {
+	timeouts, err := ParseRPCTimeouts(input)
+	if err != nil {
+		Fatalf("Option %q: %v", RPCTimeoutsFlag.Name, err)
+	}
+	return timeouts
+}
+
+// ParseRPCTimeouts is the non-fatal version of MakeRPCTimeouts, used when the
+// configuration is reloaded at runtime.
+func ParseRPCTimeouts(input string) (map[string]time.Duration, error) {
+	if strings.TrimSpace(input) == "" {
+		return nil, nil
+	}
+	timeouts := make(map[string]time.Duration)
+	for _, entry := range strings.Split(input, ",") {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid entry %q, expected namespace=duration", entry)
+		}
+		timeout, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, err
+		}
+		timeouts[replaceModuleAliasWithTarget(strings.TrimSpace(parts[0]))] = timeout
+	}
+	return timeouts, nil
+}
+
+// MakeTxPoolLimits creates the transaction pool limits from the set command line
+// flags.
+func MakeTxPoolLimits(ctx *cli.Context) core.TxPoolLimits {
+	return core.TxPoolLimits{
+		AccountSlots: ctx.GlobalUint64(TxPoolAccountSlotsFlag.Name),
+		GlobalSlots:  ctx.GlobalUint64(TxPoolGlobalSlotsFlag.Name),
+		AccountQueue: ctx.GlobalUint64(TxPoolAccountQueueFlag.Name),
+		GlobalQueue:  ctx.GlobalUint64(TxPoolGlobalQueueFlag.Name),
+		Lifetime:     ctx.GlobalDuration(TxPoolLifetimeFlag.Name),
+		PriceBump:    ctx.GlobalUint64(TxPoolPriceBumpFlag.Name),
+	}
+}
+
+// MakeTxPoolLocals creates the list of the local transaction pool accounts from
+// the set command line flags.
+func MakeTxPoolLocals(ctx *cli.Context) []common.Address {
+	var locals []common.Address
+	if accounts := ctx.GlobalString(TxPoolLocalsFlag.Name); accounts != "" {
+		for _, account := range strings.Split(accounts, ",") {
+			if account = strings.TrimSpace(account); !common.IsHexAddress(account) {
+				Fatalf("Option %q: invalid account address %q", TxPoolLocalsFlag.Name, account)
+			}
+			locals = append(locals, common.HexToAddress(account))
+		}
+	}
+	return locals
+}
+
+// MakeGasPriceOracleParams creates the gas price oracle parameters from the set
+// command line flags.
+func MakeGasPriceOracleParams(ctx *cli.Context) *gasprice.GpoParams {
+	return &gasprice.GpoParams{
+		GpoMinGasPrice:          common.String2Big(ctx.GlobalString(GpoMinGasPriceFlag.Name)),
+		GpoMaxGasPrice:          common.String2Big(ctx.GlobalString(GpoMaxGasPriceFlag.Name)),
+		GpoFullBlockRatio:       ctx.GlobalInt(GpoFullBlockRatioFlag.Name),
+		GpobaseStepDown:         ctx.GlobalInt(GpobaseStepDownFlag.Name),
+		GpobaseStepUp:           ctx.GlobalInt(GpobaseStepUpFlag.Name),
+		GpobaseCorrectionFactor: ctx.GlobalInt(GpobaseCorrectionFactorFlag.Name),
+		GpoBlocks:               ctx.GlobalInt(GpoBlocksFlag.Name),
+		GpoPercentile:           ctx.GlobalInt(GpoPercentileFlag.Name),
+	}
+}
+
 // MakeHTTPRpcHost creates the HTTP RPC listener interface string from the set
 // command line flags, returning empty if the HTTP endpoint is disabled.
 func MakeHTTPRpcHost(ctx *cli.Context) string {
@@ -658,12 +1104,84 @@ func MakeEtherbase(accman *accounts.Manager, ctx *cli.Context) common.Address {
 	return account.Address
 }
 
+// MakeMinerGasLimit parses a gas limit of the miner from the given flag, nil if
+// the flag isn't set.
+func MakeMinerGasLimit(ctx *cli.Context, flag cli.StringFlag) *big.Int {
+	value := ctx.GlobalString(flag.Name)
+	if value == "" {
+		return nil
+	}
+	gas, ok := new(big.Int).SetString(value, 10)
+	if !ok || gas.Cmp(params.MinGasLimit) < 0 {
+		Fatalf("Option %q: invalid gas limit %q, minimum %v", flag.Name, value, params.MinGasLimit)
+	}
+	return gas
+}
+
+// MakeMinerNotify parses the work notification URLs of the miner from the set
+// command line flags.
+func MakeMinerNotify(ctx *cli.Context) []string {
+	var urls []string
+	for _, rawurl := range strings.Split(ctx.GlobalString(MinerNotifyFlag.Name), ",") {
+		if rawurl = strings.TrimSpace(rawurl); rawurl == "" {
+			continue
+		}
+		if u, err := url.Parse(rawurl); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			Fatalf("Invalid work notification URL %q", rawurl)
+		}
+		urls = append(urls, rawurl)
+	}
+	return urls
+}
+
+// MakeMinerCoinbases parses the coinbases the miner rotates through from the set
+// command line flags.
+func MakeMinerCoinbases(ctx *cli.Context) []common.Address {
+	var coinbases []common.Address
+	if accounts := ctx.GlobalString(MinerCoinbasesFlag.Name); accounts != "" {
+		for _, account := range strings.Split(accounts, ",") {
+			if account = strings.TrimSpace(account); !common.IsHexAddress(account) {
+				Fatalf("Option %q: invalid coinbase address %q", MinerCoinbasesFlag.Name, account)
+			}
+			coinbases = append(coinbases, common.HexToAddress(account))
+		}
+	}
+	if len(coinbases) > 0 && ctx.GlobalUint64(MinerRotationFlag.Name) == 0 {
+		Fatalf("Option %q: coinbases must be mined to for at least one block", MinerRotationFlag.Name)
+	}
+	return coinbases
+}
+
+// MakeStratumPayout creates the reward splitting configuration from the set
+// command line flags.
+func MakeStratumPayout(ctx *cli.Context) miner.PayoutConfig {
+	account := ctx.GlobalString(StratumPayoutFlag.Name)
+	if account == "" {
+		return miner.PayoutConfig{}
+	}
+	if !common.IsHexAddress(account) {
+		Fatalf("Option %q: invalid payout address %q", StratumPayoutFlag.Name, account)
+	}
+	if ctx.GlobalString(StratumAddrFlag.Name) == "" && ctx.GlobalString(StratumHTTPAddrFlag.Name) == "" {
+		Fatalf("Option %q: requires the stratum server", StratumPayoutFlag.Name)
+	}
+	return miner.PayoutConfig{
+		Account:   common.HexToAddress(account),
+		Depth:     ctx.GlobalUint64(StratumPayoutDepthFlag.Name),
+		Threshold: common.String2Big(ctx.GlobalString(StratumPayoutThresholdFlag.Name)),
+		State:     ctx.GlobalString(StratumPayoutStateFlag.Name),
+	}
+}
+
 // MakeMinerExtra resolves extradata for the miner from the set command line flags
 // or returns a default one composed on the client, runtime and OS metadata.
 func MakeMinerExtra(extra []byte, ctx *cli.Context) []byte {
-	// if ctx.GlobalIsSet(ExtraDataFlag.Name) {
-	// 	return []byte(ctx.GlobalString(ExtraDataFlag.Name))
-	// }
+	if ctx.GlobalIsSet(MinerExtraDataFlag.Name) {
+		extra = []byte(ctx.GlobalString(MinerExtraDataFlag.Name))
+		if uint64(len(extra)) > params.MaximumExtraDataSize.Uint64() {
+			Fatalf("Miner extra data of %d bytes exceeds the maximum of %v", len(extra), params.MaximumExtraDataSize)
+		}
+	}
 	return extra
 }
 
@@ -685,6 +1203,49 @@ func MakePasswordList(ctx *cli.Context) []string {
 	return lines
 }
 
+// MakeDatabaseKey retrieves the secret encrypting the databases at rest from the
+// source specified by --datadir.key, nil if the databases are not encrypted.
+func MakeDatabaseKey(ctx *cli.Context) []byte {
+	source := ctx.GlobalString(DatabaseKeyFlag.Name)
+
+	var (
+		key []byte
+		err error
+	)
+	switch {
+	case source == "":
+		return nil
+
+	case source == "prompt":
+		var password string
+		password, err = console.Stdin.PromptPassword("Database key: ")
+		key = []byte(password)
+
+	case strings.HasPrefix(source, "file:"):
+		key, err = ioutil.ReadFile(strings.TrimPrefix(source, "file:"))
+
+	case strings.HasPrefix(source, "cmd:"):
+		shell, flag := "sh", "-c"
+		if runtime.GOOS == "windows" {
+			shell, flag = "cmd", "/C"
+		}
+		cmd := exec.Command(shell, flag, strings.TrimPrefix(source, "cmd:"))
+		cmd.Stderr = os.Stderr
+		key, err = cmd.Output()
+
+	default:
+		Fatalf("Option %q: unknown key source %q, want file:<path>, cmd:<command> or prompt", DatabaseKeyFlag.Name, source)
+	}
+	if err != nil {
+		Fatalf("Option %q: %v", DatabaseKeyFlag.Name, err)
+	}
+	// Sanitise trailing line endings of files and command outputs
+	if key = bytes.TrimRight(key, "\r\n"); len(key) == 0 {
+		Fatalf("Option %q: empty key", DatabaseKeyFlag.Name)
+	}
+	return key
+}
+
 // MakeNode configures a node with no services from command line flags.
 func MakeNode(ctx *cli.Context, name, gitCommit string) *node.Node {
 	vsn := params.Version
@@ -693,31 +1254,40 @@ func MakeNode(ctx *cli.Context, name, gitCommit string) *node.Node {
 	}
 
 	config := &node.Config{
-		DataDir:           MakeDataDir(ctx),
-		KeyStoreDir:       ctx.GlobalString(KeyStoreDirFlag.Name),
-		UseLightweightKDF: ctx.GlobalBool(LightKDFFlag.Name),
-		PrivateKey:        MakeNodeKey(ctx),
-		Name:              name,
-		Version:           vsn,
-		UserIdent:         makeNodeUserIdent(ctx),
-		NoDiscovery:       ctx.GlobalBool(NoDiscoverFlag.Name) || ctx.GlobalBool(LightModeFlag.Name),
-		DiscoveryV5:       ctx.GlobalBool(DiscoveryV5Flag.Name) || ctx.GlobalBool(LightModeFlag.Name) || ctx.GlobalInt(LightServFlag.Name) > 0,
-		DiscoveryV5Addr:   MakeDiscoveryV5Address(ctx),
-		BootstrapNodes:    MakeBootstrapNodes(ctx),
-		BootstrapNodesV5:  MakeBootstrapNodesV5(ctx),
-		ListenAddr:        MakeListenAddress(ctx),
-		NAT:               MakeNAT(ctx),
-		MaxPeers:          ctx.GlobalInt(MaxPeersFlag.Name),
-		MaxPendingPeers:   ctx.GlobalInt(MaxPendingPeersFlag.Name),
-		IPCPath:           MakeIPCPath(ctx),
-		HTTPHost:          MakeHTTPRpcHost(ctx),
-		HTTPPort:          ctx.GlobalInt(RPCPortFlag.Name),
-		HTTPCors:          ctx.GlobalString(RPCCORSDomainFlag.Name),
-		HTTPModules:       MakeRPCModules(ctx.GlobalString(RPCApiFlag.Name)),
-		WSHost:            MakeWSRpcHost(ctx),
-		WSPort:            ctx.GlobalInt(WSPortFlag.Name),
-		WSOrigins:         ctx.GlobalString(WSAllowedOriginsFlag.Name),
-		WSModules:         MakeRPCModules(ctx.GlobalString(WSApiFlag.Name)),
+		DataDir:                 MakeDataDir(ctx),
+		DatabaseKey:             MakeDatabaseKey(ctx),
+		KeyStoreDir:             ctx.GlobalString(KeyStoreDirFlag.Name),
+		UseLightweightKDF:       ctx.GlobalBool(LightKDFFlag.Name),
+		PrivateKey:              MakeNodeKey(ctx),
+		Name:                    name,
+		Version:                 vsn,
+		Build:                   params.Build(gitCommit),
+		UserIdent:               makeNodeUserIdent(ctx),
+		NoDiscovery:             ctx.GlobalBool(NoDiscoverFlag.Name) || ctx.GlobalBool(LightModeFlag.Name),
+		DiscoveryV5:             ctx.GlobalBool(DiscoveryV5Flag.Name) || ctx.GlobalBool(LightModeFlag.Name) || ctx.GlobalInt(LightServFlag.Name) > 0,
+		DiscoveryV5Addr:         MakeDiscoveryV5Address(ctx),
+		BootstrapNodes:          MakeBootstrapNodes(ctx),
+		BootstrapNodesV5:        MakeBootstrapNodesV5(ctx),
+		StaticNodeURLs:          MakeNodeURLs(ctx, StaticNodesFlag),
+		TrustedNodeURLs:         MakeNodeURLs(ctx, TrustedNodesFlag),
+		ListenAddr:              MakeListenAddress(ctx),
+		NAT:                     MakeNAT(ctx),
+		MaxPeers:                ctx.GlobalInt(MaxPeersFlag.Name),
+		MaxPendingPeers:         ctx.GlobalInt(MaxPendingPeersFlag.Name),
+		IPCPath:                 MakeIPCPath(ctx),
+		HTTPHost:                MakeHTTPRpcHost(ctx),
+		HTTPPort:                ctx.GlobalInt(RPCPortFlag.Name),
+		HTTPCors:                ctx.GlobalString(RPCCORSDomainFlag.Name),
+		HTTPModules:             MakeRPCModules(ctx.GlobalString(RPCApiFlag.Name)),
+		WSHost:                  MakeWSRpcHost(ctx),
+		WSPort:                  ctx.GlobalInt(WSPortFlag.Name),
+		WSOrigins:               ctx.GlobalString(WSAllowedOriginsFlag.Name),
+		WSModules:               MakeRPCModules(ctx.GlobalString(WSApiFlag.Name)),
+		RPCTimeouts:             MakeRPCTimeouts(ctx.GlobalString(RPCTimeoutsFlag.Name)),
+		RPCBatchRequestLimit:    ctx.GlobalInt(RPCBatchRequestLimitFlag.Name),
+		RPCBatchResponseMaxSize: ctx.GlobalInt(RPCBatchResponseMaxSizeFlag.Name),
+		RPCUpstreams:            MakeRPCUpstreams(ctx.GlobalString(RPCUpstreamFlag.Name)),
+		RPCUpstreamForward:      MakeRPCUpstreams(ctx.GlobalString(RPCUpstreamForwardFlag.Name)),
 	}
 	if ctx.GlobalBool(DevModeFlag.Name) {
 		if !ctx.GlobalIsSet(DataDirFlag.Name) {
@@ -739,9 +1309,52 @@ func MakeNode(ctx *cli.Context, name, gitCommit string) *node.Node {
 	if err != nil {
 		Fatalf("Failed to create the protocol stack: %v", err)
 	}
+	// Zero-config developer chains get the developer accounts in their keystore,
+	// custom keystores are left alone not to shift the indices of their accounts
+	if ctx.GlobalBool(DevModeFlag.Name) && !ctx.GlobalIsSet(DataDirFlag.Name) && !ctx.GlobalIsSet(KeyStoreDirFlag.Name) {
+		setupDevAccounts(stack.AccountManager())
+	}
 	return stack
 }
 
+// setupDevAccounts imports the well known keys of the developer mode chain into
+// the keystore and unlocks them, so that the prefunded developer account and the
+// privileged sender can transact right away.
+func setupDevAccounts(accman *accounts.Manager) {
+	for _, key := range []*ecdsa.PrivateKey{core.DevAccountKey, core.DevPrivilegedKey} {
+		account := accounts.Account{Address: crypto.PubkeyToAddress(key.PublicKey)}
+		if !accman.HasAddress(account.Address) {
+			var err error
+			if account, err = accman.ImportECDSA(key, ""); err != nil {
+				Fatalf("Failed to import developer account %x: %v", account.Address, err)
+			}
+		}
+		if err := accman.Unlock(account, ""); err != nil {
+			glog.V(logger.Warn).Infof("Developer account %x not unlocked: %v", account.Address, err)
+			continue
+		}
+		glog.V(logger.Info).Infof("Developer account %x unlocked", account.Address)
+	}
+}
+
+// MakeCheckpoint loads the signed weak subjectivity checkpoint set by the command
+// line flags, nil if none.
+func MakeCheckpoint(ctx *cli.Context) *downloader.Checkpoint {
+	file := ctx.GlobalString(CheckpointFlag.Name)
+	if file == "" {
+		return nil
+	}
+	signer := ctx.GlobalString(CheckpointSignerFlag.Name)
+	if !common.IsHexAddress(signer) {
+		Fatalf("Option %q: invalid checkpoint signer address %q", CheckpointSignerFlag.Name, signer)
+	}
+	checkpoint, err := downloader.LoadCheckpoint(file, common.HexToAddress(signer))
+	if err != nil {
+		Fatalf("Failed to load checkpoint: %v", err)
+	}
+	return checkpoint
+}
+
 // RegisterEthService configures eth.Ethereum from command line flags and adds it to the
 // given node.
 func RegisterEthService(ctx *cli.Context, stack *node.Node, extra []byte) {
@@ -760,28 +1373,65 @@ func RegisterEthService(ctx *cli.Context, stack *node.Node, extra []byte) {
 		Etherbase:               MakeEtherbase(stack.AccountManager(), ctx),
 		ChainConfig:             MakeChainConfig(ctx, stack),
 		FastSync:                ctx.GlobalBool(FastSyncFlag.Name),
+		Checkpoint:              MakeCheckpoint(ctx),
 		LightMode:               ctx.GlobalBool(LightModeFlag.Name),
 		LightServ:               ctx.GlobalInt(LightServFlag.Name),
 		LightPeers:              ctx.GlobalInt(LightPeersFlag.Name),
 		MaxPeers:                ctx.GlobalInt(MaxPeersFlag.Name),
 		DatabaseCache:           ctx.GlobalInt(CacheFlag.Name),
 		DatabaseHandles:         MakeDatabaseHandles(),
+		AncientDir:              ctx.GlobalString(AncientDirFlag.Name),
+		AncientThreshold:        ctx.GlobalUint64(AncientThresholdFlag.Name),
 		NetworkId:               ctx.GlobalInt(NetworkIdFlag.Name),
 		MinerThreads:            ctx.GlobalInt(MinerThreadsFlag.Name),
 		ExtraData:               MakeMinerExtra(extra, ctx),
 		NatSpec:                 ctx.GlobalBool(NatspecEnabledFlag.Name),
 		DocRoot:                 ctx.GlobalString(DocRootFlag.Name),
 		GasPrice:                common.String2Big(ctx.GlobalString(GasPriceFlag.Name)),
+		MinerGasTarget:          MakeMinerGasLimit(ctx, MinerGasTargetFlag),
+		MinerGasLimit:           MakeMinerGasLimit(ctx, MinerGasLimitFlag),
+		MinerSignups:            ctx.GlobalBool(MinerSignupsFirstFlag.Name),
+		MinerRecommit:           ctx.GlobalDuration(MinerRecommitFlag.Name),
+		MinerNotify:             MakeMinerNotify(ctx),
+		MinerCoinbases:          MakeMinerCoinbases(ctx),
+		MinerRotation:           ctx.GlobalUint64(MinerRotationFlag.Name),
+		TxPoolLimits:            MakeTxPoolLimits(ctx),
+		TxPoolLocals:            MakeTxPoolLocals(ctx),
+		TxPoolJournal:           ctx.GlobalString(TxPoolJournalFlag.Name),
+		TxPoolRejournal:         ctx.GlobalDuration(TxPoolRejournalFlag.Name),
 		GpoMinGasPrice:          common.String2Big(ctx.GlobalString(GpoMinGasPriceFlag.Name)),
 		GpoMaxGasPrice:          common.String2Big(ctx.GlobalString(GpoMaxGasPriceFlag.Name)),
 		GpoFullBlockRatio:       ctx.GlobalInt(GpoFullBlockRatioFlag.Name),
 		GpobaseStepDown:         ctx.GlobalInt(GpobaseStepDownFlag.Name),
 		GpobaseStepUp:           ctx.GlobalInt(GpobaseStepUpFlag.Name),
 		GpobaseCorrectionFactor: ctx.GlobalInt(GpobaseCorrectionFactorFlag.Name),
+		GpoBlocks:               ctx.GlobalInt(GpoBlocksFlag.Name),
+		GpoPercentile:           ctx.GlobalInt(GpoPercentileFlag.Name),
 		SolcPath:                ctx.GlobalString(SolcPathFlag.Name),
 		AutoDAG:                 ctx.GlobalBool(AutoDAGFlag.Name) || ctx.GlobalBool(MiningEnabledFlag.Name),
+		PowCaches:               ctx.GlobalInt(PowCachesFlag.Name),
+		PowDagDir:               ctx.GlobalString(PowDagDirFlag.Name),
+		RPCLogsCap:              ctx.GlobalInt(RPCLogsCapFlag.Name),
+		RPCTraceCap:             ctx.GlobalInt(RPCTraceCapFlag.Name),
+		Stratum: miner.StratumConfig{
+			Addr:            ctx.GlobalString(StratumAddrFlag.Name),
+			HTTPAddr:        ctx.GlobalString(StratumHTTPAddrFlag.Name),
+			ShareDifficulty: common.String2Big(ctx.GlobalString(StratumShareDiffFlag.Name)),
+		},
+		Payout: MakeStratumPayout(ctx),
+	}
+
+	switch mode := ctx.GlobalString(PowModeFlag.Name); mode {
+	case "normal":
+	case "shared":
+		ethConf.PowShared = true
+	case "test":
+		ethConf.PowTest = true
+	case "fake":
+		ethConf.PowFake = true
+	default:
+		Fatalf("Option %s: unknown mode %q", PowModeFlag.Name, mode)
 	}
-
 	// Override any default configs in dev mode or the test net
 	switch {
 	case ctx.GlobalBool(OlympicFlag.Name):
@@ -797,16 +1447,42 @@ func RegisterEthService(ctx *cli.Context, stack *node.Node, extra []byte) {
 		ethConf.Genesis = core.DefaultTestnetGenesisBlock()
 
 	case ctx.GlobalBool(DevModeFlag.Name):
-		ethConf.Genesis = core.OlympicGenesisBlock()
+		ethConf.Genesis = core.DevGenesisBlock()
 		if !ctx.GlobalIsSet(GasPriceFlag.Name) {
 			ethConf.GasPrice = new(big.Int)
 		}
-		ethConf.PowTest = true
+		if !ctx.GlobalIsSet(EtherbaseFlag.Name) && !ctx.GlobalIsSet(UrbaseFlag.Name) {
+			ethConf.Etherbase = crypto.PubkeyToAddress(core.DevAccountKey.PublicKey)
+		}
+		ethConf.InstantSeal = true
+		ethConf.AutoDAG = false
 	}
 	// Override any global options pertaining to the Ethereum protocol
 	if gen := ctx.GlobalInt(TrieCacheGenFlag.Name); gen > 0 {
 		state.MaxTrieCacheGen = uint16(gen)
 	}
+	ethConf.BlockChain.FlatStateLimit = ctx.GlobalInt(FlatStateFlag.Name)
+	ethConf.BlockChain.TxLookupLimit = ctx.GlobalInt(TxLookupLimitFlag.Name)
+	switch gcmode := ctx.GlobalString(GCModeFlag.Name); gcmode {
+	case "full":
+		if ctx.GlobalUint64(TrieCommitIntervalFlag.Name) == 0 {
+			Fatalf("Option %q must be positive", TrieCommitIntervalFlag.Name)
+		}
+		ethConf.BlockChain.TrieCacheLimit = ctx.GlobalInt(TrieCacheFlag.Name)
+		ethConf.BlockChain.TrieCommitInterval = ctx.GlobalUint64(TrieCommitIntervalFlag.Name)
+		ethConf.BlockChain.ReverseDiffBlocks = ctx.GlobalUint64(StateHistoryFlag.Name)
+	case "archive":
+		// Leave the trie cache disabled, writing every state to disk
+	default:
+		Fatalf("Option %q: unknown mode %q, want \"full\" or \"archive\"", GCModeFlag.Name, gcmode)
+	}
+	ethConf.BlockChain.Pow.Verifiers = ctx.GlobalInt(PowVerifiersFlag.Name)
+	if ctx.GlobalBool(PowLightVerifyFlag.Name) {
+		if ctx.GlobalBool(MiningEnabledFlag.Name) {
+			Fatalf("Option %q cannot be used while mining", PowLightVerifyFlag.Name)
+		}
+		ethConf.BlockChain.Pow.LightVerify = true
+	}
 
 	if ethConf.LightMode {
 		if err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
@@ -852,6 +1528,139 @@ func RegisterEthStatsService(stack *node.Node, url string) {
 	}
 }
 
+// RegisterExplorerService configures the built-in chain explorer and adds it to
+// the given node.
+func RegisterExplorerService(stack *node.Node, addr string) {
+	if err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+		var ethServ *eth.Ethereum
+		ctx.Service(&ethServ)
+
+		return explorer.New(addr, ethServ)
+	}); err != nil {
+		Fatalf("Failed to register the chain explorer service: %v", err)
+	}
+}
+
+// RegisterTelemetryService configures the opt-in telemetry daemon and adds it to
+// the given node.
+func RegisterTelemetryService(stack *node.Node, url string) {
+	if err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+		// Retrieve both eth and les services
+		var ethServ *eth.Ethereum
+		ctx.Service(&ethServ)
+
+		var lesServ *les.LightEthereum
+		ctx.Service(&lesServ)
+
+		return telemetry.New(url, ctx.ResolvePath("telemetrykey"), ethServ, lesServ)
+	}); err != nil {
+		Fatalf("Failed to register the telemetry service: %v", err)
+	}
+}
+
+// RegisterWatchlistService configures the address watchlist daemon and adds it
+// to the given node.
+func RegisterWatchlistService(stack *node.Node) {
+	if err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+		var ethServ *eth.Ethereum
+		ctx.Service(&ethServ)
+
+		return watchlist.New(ctx.ResolvePath("watchlist.json"), ethServ)
+	}); err != nil {
+		Fatalf("Failed to register the watchlist service: %v", err)
+	}
+}
+
+// RegisterRewardMonitorService configures the reward engine circuit breaker and
+// adds it to the given node.
+func RegisterRewardMonitorService(ctx *cli.Context, stack *node.Node) {
+	var ceiling *big.Int
+	if value := ctx.GlobalString(RewardMonitorCeilingFlag.Name); value != "" {
+		var ok bool
+		if ceiling, ok = new(big.Int).SetString(value, 10); !ok {
+			Fatalf("Option %q: invalid issuance ceiling %q", RewardMonitorCeilingFlag.Name, value)
+		}
+	}
+	if err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+		var ethServ *eth.Ethereum
+		ctx.Service(&ethServ)
+
+		return rewardmon.New(ethServ, ceiling)
+	}); err != nil {
+		Fatalf("Failed to register the reward monitoring service: %v", err)
+	}
+}
+
+// RegisterSignupcastService configures the whisper signup broadcaster and adds
+// it to the given node.
+func RegisterSignupcastService(stack *node.Node) {
+	if err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+		var ethServ *eth.Ethereum
+		ctx.Service(&ethServ)
+
+		var shhServ *whisper.Whisper
+		ctx.Service(&shhServ)
+
+		return signupcast.New(ethServ, shhServ)
+	}); err != nil {
+		Fatalf("Failed to register the signup broadcasting service: %v", err)
+	}
+}
+
+// MakeFinalityConfig creates the checkpoint finality settings from the set
+// command line flags.
+func MakeFinalityConfig(ctx *cli.Context, accman *accounts.Manager) finality.Config {
+	config := finality.Config{
+		Threshold: ctx.GlobalInt(FinalityThresholdFlag.Name),
+		Interval:  ctx.GlobalUint64(FinalityIntervalFlag.Name),
+	}
+	if validators := ctx.GlobalString(FinalityValidatorsFlag.Name); validators != "" {
+		for _, validator := range strings.Split(validators, ",") {
+			if validator = strings.TrimSpace(validator); !common.IsHexAddress(validator) {
+				Fatalf("Option %q: invalid validator address %q", FinalityValidatorsFlag.Name, validator)
+			}
+			config.Validators = append(config.Validators, common.HexToAddress(validator))
+		}
+	}
+	if signer := ctx.GlobalString(FinalitySignerFlag.Name); signer != "" {
+		account, err := MakeAddress(accman, signer)
+		if err != nil {
+			Fatalf("Option %q: %v", FinalitySignerFlag.Name, err)
+		}
+		config.Signer = account.Address
+	}
+	return config
+}
+
+// RegisterFinalityService configures the checkpoint finality layer and adds it
+// to the given node.
+func RegisterFinalityService(stack *node.Node, config finality.Config) {
+	if err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+		var ethServ *eth.Ethereum
+		ctx.Service(&ethServ)
+
+		var shhServ *whisper.Whisper
+		ctx.Service(&shhServ)
+
+		return finality.New(ethServ, shhServ, config)
+	}); err != nil {
+		Fatalf("Failed to register the checkpoint finality service: %v", err)
+	}
+}
+
+// RegisterURExtService configures the UR wire protocol extensions and adds them
+// to the given node.
+func RegisterURExtService(stack *node.Node, broadcasting bool) {
+	if err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+		var ethServ *eth.Ethereum
+		ctx.Service(&ethServ)
+
+		return urext.New(ethServ, broadcasting)
+	}); err != nil {
+		Fatalf("Failed to register the UR protocol extensions: %v", err)
+	}
+}
+
 // SetupNetwork configures the system for either the main net or some test network.
 func SetupNetwork(ctx *cli.Context) {
 	switch {
@@ -903,6 +1712,15 @@ func MakeChainConfigFromDb(ctx *cli.Context, db ethdb.Database) *params.ChainCon
 		(genesis.Hash() == params.MainNetGenesisHash && !ctx.GlobalBool(TestNetFlag.Name)) ||
 		(genesis.Hash() == params.TestNetGenesisHash && ctx.GlobalBool(TestNetFlag.Name))
 
+	// A new developer mode chain runs with the configuration of its genesis
+	if genesis == nil && ctx.GlobalBool(DevModeFlag.Name) {
+		_, devConfig, err := core.ParseGenesisBlock(strings.NewReader(core.DevGenesisBlock()))
+		if err != nil {
+			Fatalf("Could not make developer chain configuration: %v", err)
+		}
+		config, defaults = devConfig, false
+	}
+
 	if defaults {
 		if ctx.GlobalBool(TestNetFlag.Name) {
 			config = params.TestnetChainConfig
@@ -930,6 +1748,16 @@ func MakeChainConfigFromDb(ctx *cli.Context, db ethdb.Database) *params.ChainCon
 	case ctx.GlobalBool(OpposeDAOFork.Name):
 		config.DAOForkSupport = false
 	}
+	// Private networks may run with their own reward parameters
+	if err := core.ValidateURConfig(config.UR); err != nil {
+		Fatalf("Invalid UR configuration: %v", err)
+	}
+	if err := core.ValidateDifficultyForks(config.DifficultyForks); err != nil {
+		Fatalf("Invalid difficulty forks: %v", err)
+	}
+	if err := core.ValidateUnclePolicy(config.UnclePolicy); err != nil {
+		Fatalf("Invalid uncle policy: %v", err)
+	}
 	return config
 }
 
@@ -953,6 +1781,11 @@ func MakeChainDatabase(ctx *cli.Context, stack *node.Node) ethdb.Database {
 	if err != nil {
 		Fatalf("Could not open database: %v", err)
 	}
+	if !ctx.GlobalBool(LightModeFlag.Name) {
+		if err := core.OpenAncientStore(chainDb, ctx.GlobalString(AncientDirFlag.Name)); err != nil {
+			Fatalf("Could not open ancient store: %v", err)
+		}
+	}
 	return chainDb
 }
 
@@ -970,10 +1803,10 @@ func MakeChain(ctx *cli.Context, stack *node.Node) (chain *core.BlockChain, chai
 	chainConfig := MakeChainConfigFromDb(ctx, chainDb)
 
 	pow := pow.PoW(core.FakePow{})
-	if !ctx.GlobalBool(FakePoWFlag.Name) {
+	if !ctx.GlobalBool(FakePoWFlag.Name) && ctx.GlobalString(PowModeFlag.Name) != "fake" {
 		pow = urhash.New()
 	}
-	chain, err = core.NewBlockChain(chainDb, chainConfig, pow, new(event.TypeMux))
+	chain, err = core.NewBlockChain(chainDb, chainConfig, core.NewPowEngine(pow), new(event.TypeMux))
 	if err != nil {
 		Fatalf("Could not start chainmanager: %v", err)
 	}
@@ -996,3 +1829,19 @@ func MakeConsolePreloads(ctx *cli.Context) []string {
 	}
 	return preloads
 }
+
+// MigrateFlags wraps a command action, copying the flags set on the command
+// itself onto the identically named global flags. This allows commands to accept
+// global flags after their name too, while the action only reads global ones.
+func MigrateFlags(action func(ctx *cli.Context) error) func(*cli.Context) error {
+	return func(ctx *cli.Context) error {
+		for _, name := range ctx.FlagNames() {
+			if ctx.IsSet(name) {
+				if err := ctx.GlobalSet(name, ctx.String(name)); err != nil {
+					Fatalf("Option %q: %v", name, err)
+				}
+			}
+		}
+		return action(ctx)
+	}
+}
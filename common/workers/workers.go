@@ -0,0 +1,89 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package workers implements bounded worker pools shared by the parallel parts
+// of the node, so that a single setting caps how many goroutines any of them
+// spins up at once.
+package workers
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// limit is the maximum number of concurrent workers of a single pool. Zero
+// means one worker per usable CPU.
+var limit int32
+
+// SetLimit sets the maximum number of concurrent workers any single pool may
+// run. Zero or negative values reset it to one worker per usable CPU.
+func SetLimit(n int) {
+	if n < 0 {
+		n = 0
+	}
+	atomic.StoreInt32(&limit, int32(n))
+}
+
+// Limit returns the maximum number of concurrent workers of a single pool.
+func Limit() int {
+	if n := int(atomic.LoadInt32(&limit)); n > 0 {
+		return n
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// Size returns the number of workers to use for processing the given number of
+// items, which is never more than the items themselves nor the configured limit.
+func Size(items int) int {
+	workers := Limit()
+	if items < workers {
+		workers = items
+	}
+	return workers
+}
+
+// Run calls fn for every index in [0, items) on a bounded number of concurrent
+// workers and waits until all of them have been processed. Callers wanting a
+// deterministic outcome should store results by index instead of by completion
+// order.
+func Run(items int, fn func(index int)) {
+	workers := Size(items)
+	if workers <= 1 {
+		for i := 0; i < items; i++ {
+			fn(i)
+		}
+		return
+	}
+	var (
+		next    int64 = -1
+		pending sync.WaitGroup
+	)
+	pending.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer pending.Done()
+			for {
+				index := int(atomic.AddInt64(&next, 1))
+				if index >= items {
+					return
+				}
+				fn(index)
+			}
+		}()
+	}
+	pending.Wait()
+}
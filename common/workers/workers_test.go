@@ -0,0 +1,74 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package workers
+
+import (
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Tests that pool sizes honour both the item count and the configured limit.
+func TestSize(t *testing.T) {
+	defer SetLimit(0)
+
+	SetLimit(3)
+	for items, want := range map[int]int{0: 0, 1: 1, 3: 3, 100: 3} {
+		if have := Size(items); have != want {
+			t.Errorf("limit 3, %d items: have %d workers, want %d", items, have, want)
+		}
+	}
+	SetLimit(0)
+	if have, want := Limit(), runtime.GOMAXPROCS(0); have != want {
+		t.Errorf("default limit mismatch: have %d, want %d", have, want)
+	}
+}
+
+// Tests that every item is processed exactly once and that no more than the
+// configured number of workers run at the same time.
+func TestRunBounded(t *testing.T) {
+	defer SetLimit(0)
+	SetLimit(4)
+
+	var (
+		items   = 200
+		hits    = make([]int32, items)
+		running int32
+		peak    int32
+	)
+	Run(items, func(index int) {
+		current := atomic.AddInt32(&running, 1)
+		for {
+			max := atomic.LoadInt32(&peak)
+			if current <= max || atomic.CompareAndSwapInt32(&peak, max, current) {
+				break
+			}
+		}
+		time.Sleep(100 * time.Microsecond)
+		atomic.AddInt32(&hits[index], 1)
+		atomic.AddInt32(&running, -1)
+	})
+	for i, hit := range hits {
+		if hit != 1 {
+			t.Errorf("item %d: processed %d times", i, hit)
+		}
+	}
+	if peak > 4 {
+		t.Errorf("concurrency exceeded limit: have %d, want at most %d", peak, 4)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package consensus defines the interface consensus engines implement to seal,
+// verify and finalize blocks, so the chain, the miner and the protocol handlers
+// don't depend on a particular engine (proof of work, proof of authority, ...).
+package consensus
+
+import (
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core/state"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/params"
+)
+
+// ChainReader is the subset of the local chain engines need to verify headers
+// and finalize blocks.
+type ChainReader interface {
+	// Config retrieves the chain configuration.
+	Config() *params.ChainConfig
+
+	// GetHeader retrieves a header from the local chain by hash and number.
+	GetHeader(hash common.Hash, number uint64) *types.Header
+}
+
+// Engine is an algorithm agnostic consensus engine.
+type Engine interface {
+	// VerifyHeader checks whether a header conforms to the consensus rules on
+	// top of its parent, verifying the seal too if requested. Uncle headers are
+	// exempt from the rules only meaningful for the chain head.
+	VerifyHeader(chain ChainReader, header, parent *types.Header, seal, uncle bool) error
+
+	// VerifySeal checks whether the seal of a header is valid. It's separate
+	// from VerifyHeader so seals can be verified concurrently.
+	VerifySeal(header *types.Header) error
+
+	// Finalize runs the post-transaction state modifications of a block, most
+	// notably crediting the UR block and uncle rewards. The header, including
+	// its signup totals, and the state root are left to the caller. Signup
+	// rewards aren't part of it, they're credited with the signup transactions
+	// by the state processor as the receipts commit to the state after each.
+	Finalize(chain ChainReader, statedb *state.StateDB, header *types.Header, uncles []*types.Header)
+
+	// Seal generates a sealed version of a finalized block, returning nil if
+	// sealing was aborted through the stop channel. Index differentiates the
+	// concurrent sealers of the same engine.
+	Seal(block *types.Block, stop <-chan struct{}, index int) (*types.Block, error)
+}
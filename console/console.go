@@ -276,17 +276,15 @@ func (c *Console) Welcome() {
 }
 
 // Evaluate executes code and pretty prints the result to the specified output
-// stream.
-func (c *Console) Evaluate(statement string) error {
+// stream. Any failure is printed and returned as well.
+func (c *Console) Evaluate(statement string) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			fmt.Fprintf(c.printer, "[native] error: %v\n", r)
+			err = fmt.Errorf("native error: %v", r)
 		}
 	}()
-	if err := c.jsre.Evaluate(statement, c.printer); err != nil {
-		return err
-	}
-	return nil
+	return c.jsre.Evaluate(statement, c.printer)
 }
 
 // Interactive starts an interactive user session, where input is propted from
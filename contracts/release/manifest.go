@@ -0,0 +1,289 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package release
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/crypto"
+	"github.com/ur-technology/go-ur/logger"
+	"github.com/ur-technology/go-ur/logger/glog"
+	"github.com/ur-technology/go-ur/p2p"
+	"github.com/ur-technology/go-ur/rpc"
+)
+
+// manifestTimeout is the maximum time allowed for retrieving the manifest.
+const manifestTimeout = 30 * time.Second
+
+// Manifest describes the latest client release, as published by the release
+// signer. Every published manifest increments the sequence number and expires,
+// so that a stale manifest can't be replayed to hide a newer release.
+type Manifest struct {
+	Sequence uint64 `json:"sequence"` // Number of the manifest, incremented by every publication
+	Expires  int64  `json:"expires"`  // Unix timestamp after which the manifest is rejected
+
+	Version string        `json:"version"`        // Version of the release, e.g. "1.5.3"
+	Commit  string        `json:"commit"`         // Git commit the release was built from
+	URL     string        `json:"url"`            // Download location of the release
+	Fork    *ManifestFork `json:"fork,omitempty"` // Hard fork scheduled by the release, if any
+}
+
+// ManifestFork is a hard fork scheduled by a release. Nodes not upgraded by the
+// fork block will split off the network.
+type ManifestFork struct {
+	Name  string `json:"name"`  // Name of the fork
+	Block uint64 `json:"block"` // Block number the fork activates at
+}
+
+// signedManifest is the signed wrapper around a published manifest.
+type signedManifest struct {
+	Manifest  json.RawMessage `json:"manifest"`
+	Signature string          `json:"signature"`
+}
+
+// ManifestConfig contains the configurations of the release manifest checker.
+type ManifestConfig struct {
+	URL    string         // HTTP(S) location of the signed release manifest
+	Signer common.Address // Address of the key the manifest must be signed with
+	Major  uint32         // Major version component of the running client
+	Minor  uint32         // Minor version component of the running client
+	Patch  uint32         // Patch version component of the running client
+}
+
+// ManifestStatus is the outcome of the last release manifest check.
+type ManifestStatus struct {
+	Current  string        `json:"current"`           // Version of the running client
+	Latest   string        `json:"latest,omitempty"`  // Version of the latest release
+	Outdated bool          `json:"outdated"`          // Whether a newer release is available
+	URL      string        `json:"url,omitempty"`     // Download location of the latest release
+	Fork     *ManifestFork `json:"fork,omitempty"`    // Hard fork scheduled by the latest release
+	Checked  int64         `json:"checked,omitempty"` // Unix timestamp of the last successful check
+	Error    string        `json:"error,omitempty"`   // Failure of the last check, if any
+}
+
+// ManifestService is a node service that periodically retrieves the signed
+// release manifest and warns the user if a newer release is available, loudly
+// so if it schedules a hard fork.
+type ManifestService struct {
+	config ManifestConfig
+	client *http.Client
+
+	status   ManifestStatus // Outcome of the last check
+	sequence uint64         // Sequence number of the last accepted manifest
+	lock     sync.RWMutex   // Protects the status and sequence number
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewManifestService creates a new service checking the signed release manifest
+// published at the configured location.
+func NewManifestService(config ManifestConfig) (*ManifestService, error) {
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid release manifest url: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid release manifest url: \"%s\", only http(s) is supported", config.URL)
+	}
+	if config.Signer == (common.Address{}) {
+		return nil, errors.New("release manifest signer not configured")
+	}
+	return &ManifestService{
+		config: config,
+		client: &http.Client{Timeout: manifestTimeout},
+		status: ManifestStatus{Current: fmt.Sprintf("%d.%d.%d", config.Major, config.Minor, config.Patch)},
+		quit:   make(chan struct{}),
+	}, nil
+}
+
+// Protocols returns an empty list of P2P protocols as the manifest service does
+// not have a networking component.
+func (m *ManifestService) Protocols() []p2p.Protocol { return nil }
+
+// APIs returns an empty list of RPC descriptors, the outcome of the checks is
+// reported through admin_nodeInfo.
+func (m *ManifestService) APIs() []rpc.API { return nil }
+
+// Start spawns the periodic manifest checker goroutine.
+func (m *ManifestService) Start(server *p2p.Server) error {
+	m.wg.Add(1)
+	go m.checker()
+	return nil
+}
+
+// Stop terminates the manifest checker, blocking until it returns.
+func (m *ManifestService) Stop() error {
+	close(m.quit)
+	m.wg.Wait()
+	return nil
+}
+
+// NodeInfo implements node.InfoService, reporting the outcome of the last check.
+func (m *ManifestService) NodeInfo() (string, interface{}) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	status := m.status
+	return "release", &status
+}
+
+// checker checks the manifest right after startup and then periodically until
+// termination.
+func (m *ManifestService) checker() {
+	defer m.wg.Done()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			m.check()
+			timer.Reset(releaseRecheckInterval)
+		case <-m.quit:
+			return
+		}
+	}
+}
+
+// check retrieves the manifest, updating the status and warning about newer
+// releases.
+func (m *ManifestService) check() {
+	manifest, err := m.fetch()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if err != nil {
+		glog.V(logger.Debug).Infof("Failed to check release manifest: %v", err)
+		m.status.Error = err.Error()
+		return
+	}
+	if manifest.Sequence < m.sequence {
+		err := fmt.Errorf("manifest sequence %d older than accepted %d", manifest.Sequence, m.sequence)
+		glog.V(logger.Warn).Infof("Rejected release manifest: %v", err)
+		m.status.Error = err.Error()
+		return
+	}
+	m.sequence = manifest.Sequence
+
+	m.status.Error = ""
+	m.status.Checked = time.Now().Unix()
+	m.status.Latest, m.status.URL, m.status.Fork = manifest.Version, manifest.URL, manifest.Fork
+	m.status.Outdated = false
+
+	major, minor, patch, err := parseVersion(manifest.Version)
+	if err != nil {
+		m.status.Error = err.Error()
+		return
+	}
+	if !newerVersion(major, minor, patch, m.config.Major, m.config.Minor, m.config.Patch) {
+		glog.V(logger.Debug).Infof("Client v%s seems up to date with release v%s", m.status.Current, manifest.Version)
+		return
+	}
+	m.status.Outdated = true
+
+	warning := fmt.Sprintf("Client v%s seems older than the latest release v%s", m.status.Current, manifest.Version)
+	lines := []string{warning}
+	if manifest.Fork != nil {
+		lines = append(lines, fmt.Sprintf("The release schedules the %s hard fork at block #%d, nodes not upgraded by then will split off the network", manifest.Fork.Name, manifest.Fork.Block))
+	}
+	if manifest.URL != "" {
+		lines = append(lines, fmt.Sprintf("Please upgrade from %s", manifest.URL))
+	}
+	separator := strings.Repeat("-", len(warning))
+
+	glog.V(logger.Warn).Info(separator)
+	for _, line := range lines {
+		glog.V(logger.Warn).Info(line)
+	}
+	glog.V(logger.Warn).Info(separator)
+}
+
+// fetch downloads the manifest and verifies it was signed by the release signer.
+func (m *ManifestService) fetch() (*Manifest, error) {
+	res, err := m.client.Get(m.config.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status: %s", res.Status)
+	}
+	signed := new(signedManifest)
+	if err := json.NewDecoder(res.Body).Decode(signed); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %v", err)
+	}
+	return verifyManifest(signed, m.config.Signer, time.Now())
+}
+
+// verifyManifest checks the signature of a manifest, decodes it and checks that
+// it hasn't expired by the given time.
+func verifyManifest(signed *signedManifest, signer common.Address, now time.Time) (*Manifest, error) {
+	pubkey, err := crypto.SigToPub(crypto.Keccak256(signed.Manifest), common.FromHex(signed.Signature))
+	if err != nil {
+		return nil, fmt.Errorf("invalid manifest signature: %v", err)
+	}
+	if addr := crypto.PubkeyToAddress(*pubkey); addr != signer {
+		return nil, fmt.Errorf("manifest signed by %x, want %x", addr, signer)
+	}
+	manifest := new(Manifest)
+	if err := json.Unmarshal(signed.Manifest, manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %v", err)
+	}
+	if manifest.Expires == 0 {
+		return nil, errors.New("manifest without expiry")
+	}
+	if expiry := time.Unix(manifest.Expires, 0); now.After(expiry) {
+		return nil, fmt.Errorf("manifest expired at %v", expiry.UTC())
+	}
+	return manifest, nil
+}
+
+// parseVersion splits a major.minor.patch version, ignoring any "v" prefix and
+// trailing metadata (e.g. "1.5.3-stable").
+func parseVersion(version string) (major, minor, patch uint32, err error) {
+	version = strings.TrimPrefix(version, "v")
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		version = version[:i]
+	}
+	if _, err := fmt.Sscanf(version, "%d.%d.%d", &major, &minor, &patch); err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid release version %q", version)
+	}
+	return major, minor, patch, nil
+}
+
+// newerVersion reports whether version a is newer than version b.
+func newerVersion(aMajor, aMinor, aPatch, bMajor, bMinor, bPatch uint32) bool {
+	if aMajor != bMajor {
+		return aMajor > bMajor
+	}
+	if aMinor != bMinor {
+		return aMinor > bMinor
+	}
+	return aPatch > bPatch
+}
@@ -0,0 +1,137 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package release
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/crypto"
+)
+
+// signManifest encodes and signs a manifest with the given key.
+func signManifest(t *testing.T, manifest *Manifest, key *ecdsa.PrivateKey) []byte {
+	blob, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := crypto.Sign(crypto.Keccak256(blob), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := json.Marshal(&signedManifest{Manifest: blob, Signature: common.ToHex(sig)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// Tests that newer releases are detected from properly signed manifests only.
+func TestManifestCheck(t *testing.T) {
+	signer, _ := crypto.GenerateKey()
+	forger, _ := crypto.GenerateKey()
+
+	var published []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(published)
+	}))
+	defer server.Close()
+
+	service, err := NewManifestService(ManifestConfig{
+		URL:    server.URL,
+		Signer: crypto.PubkeyToAddress(signer.PublicKey),
+		Major:  1, Minor: 5, Patch: 2,
+	})
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+	status := func() *ManifestStatus {
+		service.check()
+		name, info := service.NodeInfo()
+		if name != "release" {
+			t.Fatalf("info name mismatch: have %q, want %q", name, "release")
+		}
+		return info.(*ManifestStatus)
+	}
+	expires := time.Now().Add(time.Hour).Unix()
+
+	// Same or older releases aren't reported as upgrades
+	published = signManifest(t, &Manifest{Sequence: 1, Expires: expires, Version: "1.5.2"}, signer)
+	if s := status(); s.Outdated || s.Latest != "1.5.2" || s.Error != "" {
+		t.Errorf("current release: unexpected status %+v", s)
+	}
+	// Newer releases are, along with the forks they schedule
+	fork := &ManifestFork{Name: "Bonus", Block: 100000}
+	published = signManifest(t, &Manifest{Sequence: 2, Expires: expires, Version: "v1.6.0-stable", URL: "https://example.com", Fork: fork}, signer)
+	if s := status(); !s.Outdated || s.Fork == nil || *s.Fork != *fork || s.URL != "https://example.com" {
+		t.Errorf("newer release: unexpected status %+v", s)
+	}
+	// Manifests signed by anyone else are rejected, keeping the last known release
+	published = signManifest(t, &Manifest{Sequence: 3, Expires: expires, Version: "9.0.0"}, forger)
+	if s := status(); !strings.Contains(s.Error, "manifest signed by") || s.Latest != "v1.6.0-stable" {
+		t.Errorf("forged release: unexpected status %+v", s)
+	}
+	// Replayed older manifests are rejected, keeping the last known release
+	published = signManifest(t, &Manifest{Sequence: 1, Expires: expires, Version: "1.5.2"}, signer)
+	if s := status(); !strings.Contains(s.Error, "older than accepted") || !s.Outdated || s.Latest != "v1.6.0-stable" {
+		t.Errorf("replayed release: unexpected status %+v", s)
+	}
+	// Re-publishing the same manifest is fine
+	published = signManifest(t, &Manifest{Sequence: 2, Expires: expires, Version: "v1.6.0-stable"}, signer)
+	if s := status(); s.Error != "" || !s.Outdated {
+		t.Errorf("republished release: unexpected status %+v", s)
+	}
+	// Expired manifests and ones without expiry are rejected
+	published = signManifest(t, &Manifest{Sequence: 4, Expires: time.Now().Add(-time.Hour).Unix(), Version: "1.5.2"}, signer)
+	if s := status(); !strings.Contains(s.Error, "manifest expired") || s.Latest != "v1.6.0-stable" {
+		t.Errorf("expired release: unexpected status %+v", s)
+	}
+	published = signManifest(t, &Manifest{Sequence: 4, Version: "1.5.2"}, signer)
+	if s := status(); !strings.Contains(s.Error, "without expiry") || s.Latest != "v1.6.0-stable" {
+		t.Errorf("unexpiring release: unexpected status %+v", s)
+	}
+}
+
+// Tests that release versions are parsed and compared component wise.
+func TestNewerVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		newer   bool
+	}{
+		{"1.5.2", false}, {"1.5.1", false}, {"1.4.9", false}, {"0.9.9", false},
+		{"1.5.3", true}, {"1.6.0", true}, {"2.0.0", true}, {"v1.5.10-unstable", true},
+	}
+	for _, tt := range tests {
+		major, minor, patch, err := parseVersion(tt.version)
+		if err != nil {
+			t.Errorf("%s: failed to parse: %v", tt.version, err)
+			continue
+		}
+		if newer := newerVersion(major, minor, patch, 1, 5, 2); newer != tt.newer {
+			t.Errorf("%s: newer mismatch: have %v, want %v", tt.version, newer, tt.newer)
+		}
+	}
+	if _, _, _, err := parseVersion("1.5"); err == nil {
+		t.Errorf("incomplete version accepted")
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core/types"
+)
+
+// Kinds of balance changes reported by BalanceProvenance.
+const (
+	BalanceTransfer      = "transfer"      // Value sent or received by a transaction
+	BalanceGas           = "gas"           // Gas paid by a sender, or collected by the miner
+	BalanceBlockReward   = "blockReward"   // Block, uncle and per signup miner rewards
+	BalanceSignupReward  = "signupReward"  // Reward of a signed up member (level 0) or of its level-k referrer
+	BalanceManagementFee = "managementFee" // Management and UR Future Fund fees of a signup
+	BalanceBonus         = "bonus"         // Signup rewards of missing referral levels, paid to the receiver
+)
+
+// BalanceEntry is a single credit (positive amount) or debit (negative amount)
+// of an account's balance.
+type BalanceEntry struct {
+	Block        uint64
+	TxHash       common.Hash    // Zero for the rewards of mining the block
+	Kind         string         // One of the Balance* kinds
+	Level        int            // Referral level of a signup reward, 0 for the new member
+	Amount       *big.Int       // Positive for credits, negative for debits
+	Counterparty common.Address // Other end of a transfer, or the signed up member
+}
+
+// BalanceProvenance returns the ledger of the balance changes of addr in the
+// canonical blocks from first up to and including last, ordered as applied.
+//
+// The ledger is derived from the transactions, receipts and reward rules of the
+// blocks. Value moved by contract code is not covered, neither is the value of
+// a transaction whose execution failed, so a ledger may not add up to the
+// difference of the balances before and after the range.
+func (bc *BlockChain) BalanceProvenance(addr common.Address, first, last uint64) ([]*BalanceEntry, error) {
+	var entries []*BalanceEntry
+	for number := first; number <= last; number++ {
+		block := bc.GetBlockByNumber(number)
+		if block == nil {
+			return nil, fmt.Errorf("block #%d not found", number)
+		}
+		blockEntries, err := bc.blockBalanceEntries(block, addr)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, blockEntries...)
+	}
+	return entries, nil
+}
+
+// blockBalanceEntries returns the balance changes of addr in a canonical block.
+func (bc *BlockChain) blockBalanceEntries(block *types.Block, addr common.Address) ([]*BalanceEntry, error) {
+	var (
+		entries  []*BalanceEntry
+		header   = block.Header()
+		number   = block.NumberU64()
+		signer   = types.MakeSigner(bc.config, header.Number)
+		receipts = GetBlockReceipts(bc.chainDb, block.Hash(), number)
+		usedGas  = new(big.Int)
+	)
+	if len(receipts) != len(block.Transactions()) {
+		return nil, fmt.Errorf("receipts of block #%d not found", number)
+	}
+	add := func(tx common.Hash, kind string, level int, amount *big.Int, counterparty common.Address) {
+		entries = append(entries, &BalanceEntry{
+			Block:        number,
+			TxHash:       tx,
+			Kind:         kind,
+			Level:        level,
+			Amount:       amount,
+			Counterparty: counterparty,
+		})
+	}
+	for i, tx := range block.Transactions() {
+		msg, err := tx.AsMessage(signer)
+		if err != nil {
+			return nil, err
+		}
+		hash, from := tx.Hash(), msg.From()
+
+		// Signup rewards are credited before the transaction is executed, which
+		// then doesn't transfer its value
+		signup := false
+		if IsSignupTransaction(bc.config, msg) {
+			if chain, err := getSignupChain(bc, msg.Data()); err == nil {
+				signup = true
+				rewards := Rewards(bc.config)
+				member := *msg.To()
+				if header.Coinbase == addr {
+					add(hash, BalanceBlockReward, 0, new(big.Int).Set(rewards.BlockReward), member)
+				}
+				if member == addr {
+					add(hash, BalanceSignupReward, 0, new(big.Int).Set(rewards.SignupReward), member)
+				}
+				bonus := new(big.Int).Set(rewards.TotalSignupRewards)
+				for level, referrer := range chain {
+					if referrer == addr {
+						add(hash, BalanceSignupReward, level+1, new(big.Int).Set(rewards.MembersSignupRewards[level]), member)
+					}
+					bonus.Sub(bonus, rewards.MembersSignupRewards[level])
+				}
+				receivers := rewards.Privileged[from]
+				if receivers.URFF == addr {
+					add(hash, BalanceManagementFee, 0, new(big.Int).Set(rewards.URFutureFundFee), member)
+				}
+				if receivers.Receiver == addr {
+					parent := bc.GetBlock(header.ParentHash, number-1)
+					if parent == nil {
+						return nil, fmt.Errorf("parent of block #%d not found", number)
+					}
+					add(hash, BalanceManagementFee, 0, calculateTxManagementFee(rewards, parent.NSignups(), parent.TotalWei()), member)
+					if bonus.Sign() != 0 {
+						add(hash, BalanceBonus, 0, bonus, member)
+					}
+				}
+			}
+		}
+		// Gas paid by the sender to the miner, then the value transferred
+		gas := new(big.Int).Sub(receipts[i].CumulativeGasUsed, usedGas)
+		usedGas.Set(receipts[i].CumulativeGasUsed)
+		fee := gas.Mul(gas, msg.GasPrice())
+
+		if fee.Sign() > 0 {
+			if from == addr {
+				add(hash, BalanceGas, 0, new(big.Int).Neg(fee), header.Coinbase)
+			}
+			if header.Coinbase == addr {
+				add(hash, BalanceGas, 0, new(big.Int).Set(fee), from)
+			}
+		}
+		to := receipts[i].ContractAddress
+		if msg.To() != nil {
+			to = *msg.To()
+		}
+		if !signup && msg.Value().Sign() > 0 && from != to {
+			if from == addr {
+				add(hash, BalanceTransfer, 0, new(big.Int).Neg(msg.Value()), to)
+			}
+			if to == addr {
+				add(hash, BalanceTransfer, 0, new(big.Int).Set(msg.Value()), from)
+			}
+		}
+	}
+	// Block and uncle rewards are credited after all the transactions
+	if reward, ok := calculateAccumulatedRewards(bc.config, header, block.Uncles())[addr]; ok {
+		add(common.Hash{}, BalanceBlockReward, 0, reward, common.Address{})
+	}
+	return entries, nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package core_test
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core"
+)
+
+// Tests that the balance provenance ledger explains the balance changes of the
+// members, the miner and the privileged receivers of a chain of signups.
+func TestBalanceProvenance(t *testing.T) {
+	sim, err := NewSimulator(genesisAccount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, minerAddr, err := newKeyAddr()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.Coinbase = minerAddr
+
+	// Sign up a chain of members, then move some funds between two of them
+	var (
+		members []*memberNode
+		block   uint64
+		txHash  common.Hash
+	)
+	for i := 0; i < 3; i++ {
+		member := newMember()
+		if block, txHash, err = signMember(sim, member.addr, block, txHash, i == 0); err != nil {
+			t.Fatalf("member %d: failed to sign up: %v", i, err)
+		}
+		members = append(members, member)
+	}
+	sim.AddPendingTx(&TxData{From: members[2].key, To: members[0].addr, Value: big.NewInt(1000)})
+	if _, err := sim.Commit(); err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	bc := sim.BlockChain
+	genesis, err := bc.StateAt(bc.Genesis().Root())
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := bc.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	receivers := core.PrivilegedAddressesReceivers[privKeyAddr]
+	accounts := []common.Address{privKeyAddr, minerAddr, receivers.Receiver, receivers.URFF}
+	for _, member := range members {
+		accounts = append(accounts, member.addr)
+	}
+	for _, addr := range accounts {
+		entries, err := bc.BalanceProvenance(addr, 1, bc.CurrentBlock().NumberU64())
+		if err != nil {
+			t.Fatalf("%x: failed to retrieve provenance: %v", addr, err)
+		}
+		have := new(big.Int)
+		for _, entry := range entries {
+			have.Add(have, entry.Amount)
+		}
+		want := new(big.Int).Sub(head.GetBalance(addr), genesis.GetBalance(addr))
+		if have.Cmp(want) != 0 {
+			t.Errorf("%x: balance change mismatch: have %v, want %v", addr, have, want)
+		}
+	}
+	// The first member is rewarded at level 0 for itself and level 1 and 2 for the others
+	entries, _ := bc.BalanceProvenance(members[0].addr, 1, bc.CurrentBlock().NumberU64())
+	var levels []int
+	for _, entry := range entries {
+		if entry.Kind == core.BalanceSignupReward {
+			levels = append(levels, entry.Level)
+		}
+	}
+	if len(levels) != 3 || levels[0] != 0 || levels[1] != 1 || levels[2] != 2 {
+		t.Errorf("signup reward levels mismatch: have %v, want [0 1 2]", levels)
+	}
+}
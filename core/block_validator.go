@@ -22,6 +22,7 @@ import (
 	"time"
 
 	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/consensus"
 	"github.com/ur-technology/go-ur/core/state"
 	"github.com/ur-technology/go-ur/core/types"
 	"github.com/ur-technology/go-ur/logger/glog"
@@ -36,6 +37,13 @@ var (
 	bigMinus99    = big.NewInt(-99)
 )
 
+// maxUncleDepth is the maximum distance of an uncle from the including block, the
+// uncle parents must be among its 7 most recent ancestors other than the parent.
+const maxUncleDepth = 6
+
+// maxUncles is the maximum number of uncles a block can include.
+const maxUncles = 2
+
 // BlockValidator is responsible for validating block headers, uncles and
 // processed state.
 //
@@ -43,14 +51,14 @@ var (
 type BlockValidator struct {
 	config *params.ChainConfig // Chain configuration options
 	bc     *BlockChain         // Canonical block chain
-	Pow    pow.PoW             // Proof of work used for validating
+	engine consensus.Engine    // Consensus engine used for validating
 }
 
 // NewBlockValidator returns a new block validator which is safe for re-use
-func NewBlockValidator(config *params.ChainConfig, blockchain *BlockChain, pow pow.PoW) *BlockValidator {
+func NewBlockValidator(config *params.ChainConfig, blockchain *BlockChain, engine consensus.Engine) *BlockValidator {
 	validator := &BlockValidator{
 		config: config,
-		Pow:    pow,
+		engine: engine,
 		bc:     blockchain,
 	}
 	return validator
@@ -68,7 +76,7 @@ func NewBlockValidator(config *params.ChainConfig, blockchain *BlockChain, pow p
 // false positives where a header is present but the state is not.
 func (v *BlockValidator) ValidateBlock(block *types.Block) error {
 	if v.bc.HasBlock(block.Hash()) {
-		if _, err := state.New(block.Root(), v.bc.chainDb); err == nil {
+		if _, err := state.New(block.Root(), v.bc.stateDb); err == nil {
 			return &KnownBlockError{block.Number(), block.Hash()}
 		}
 	}
@@ -76,13 +84,13 @@ func (v *BlockValidator) ValidateBlock(block *types.Block) error {
 	if parent == nil {
 		return ParentError(block.ParentHash())
 	}
-	if _, err := state.New(parent.Root(), v.bc.chainDb); err != nil {
+	if _, err := state.New(parent.Root(), v.bc.stateDb); err != nil {
 		return ParentError(block.ParentHash())
 	}
 
 	header := block.Header()
 	// validate the block header
-	if err := ValidateHeader(v.config, v.Pow, header, parent.Header(), false, false); err != nil {
+	if err := v.engine.VerifyHeader(v.bc, header, parent.Header(), false, false); err != nil {
 		return err
 	}
 	// verify the uncles are correctly rewarded
@@ -102,6 +110,15 @@ func (v *BlockValidator) ValidateBlock(block *types.Block) error {
 	if txSha != header.TxHash {
 		return fmt.Errorf("invalid transaction root hash (remote: %x local: %x)", header.TxHash, txSha)
 	}
+	// Once the gas price floor is active, no transaction may undercut it, not
+	// even the miner's own ones.
+	if floor := v.config.MinGasPriceAt(header.Number); floor != nil {
+		for i, tx := range block.Transactions() {
+			if tx.GasPrice().Cmp(floor) < 0 {
+				return ValidationError("transaction %d (%x) gas price below chain minimum (have %v, want %v)", i, tx.Hash().Bytes()[:4], tx.GasPrice(), floor)
+			}
+		}
+	}
 
 	return nil
 }
@@ -136,12 +153,12 @@ func (v *BlockValidator) ValidateState(block, parent *types.Block, statedb *stat
 	if err != nil {
 		return err
 	}
-	vfyNSignups, vfyTotalWei := calculateBlockTotals(parent.NSignups(), parent.TotalWei(), header, block.Uncles(), msgs)
+	vfyNSignups, vfyTotalWei := calculateBlockTotals(v.config, parent.NSignups(), parent.TotalWei(), header, block.Uncles(), msgs)
 	if vfyNSignups.Cmp(header.NSignups) != 0 {
-		return fmt.Errorf("number of signups mismatch: got %s, expected %s", header.NSignups, vfyNSignups)
+		return RewardError("number of signups mismatch: got %s, expected %s", header.NSignups, vfyNSignups)
 	}
 	if vfyTotalWei.Cmp(header.TotalWei) != 0 {
-		return fmt.Errorf("total wei mismatch: got %s, expected %s", header.TotalWei, vfyTotalWei)
+		return RewardError("total wei mismatch: got %s, expected %s", header.TotalWei, vfyTotalWei)
 	}
 
 	return nil
@@ -153,9 +170,13 @@ func (v *BlockValidator) ValidateState(block, parent *types.Block, statedb *stat
 // if the validation failed.
 func (v *BlockValidator) VerifyUncles(block, parent *types.Block) error {
 	// validate that there are at most 2 uncles included in this block
-	if len(block.Uncles()) > 2 {
+	if len(block.Uncles()) > maxUncles {
 		return ValidationError("Block can only contain maximum 2 uncles (contained %v)", len(block.Uncles()))
 	}
+	policy := v.config.UnclePolicyAt(block.Number())
+	if policy != nil && policy.NoUncles && len(block.Uncles()) > 0 {
+		return ValidationError("Block can't contain uncles (contained %v)", len(block.Uncles()))
+	}
 
 	uncles := set.New()
 	ancestors := make(map[common.Hash]*types.Block)
@@ -189,8 +210,11 @@ func (v *BlockValidator) VerifyUncles(block, parent *types.Block) error {
 		if ancestors[uncle.ParentHash] == nil || uncle.ParentHash == parent.Hash() {
 			return UncleError("uncle[%d](%x)'s parent is not ancestor (%x)", i, hash[:4], uncle.ParentHash[0:4])
 		}
+		if depth := new(big.Int).Sub(block.Number(), uncle.Number); depth.Cmp(new(big.Int).SetUint64(MaxUncleDepth(v.config, block.Number()))) > 0 {
+			return UncleError("uncle[%d](%x) too deep (%v blocks)", i, hash[:4], depth)
+		}
 
-		if err := ValidateHeader(v.config, v.Pow, uncle, ancestors[uncle.ParentHash].Header(), true, true); err != nil {
+		if err := v.engine.VerifyHeader(v.bc, uncle, ancestors[uncle.ParentHash].Header(), true, true); err != nil {
 			return ValidationError(fmt.Sprintf("uncle[%d](%x) header invalid: %v", i, hash[:4], err))
 		}
 	}
@@ -198,6 +222,34 @@ func (v *BlockValidator) VerifyUncles(block, parent *types.Block) error {
 	return nil
 }
 
+// MaxUncleDepth returns the maximum distance of the uncles included in block
+// number from it, as limited by the uncle policy.
+func MaxUncleDepth(config *params.ChainConfig, number *big.Int) uint64 {
+	if policy := config.UnclePolicyAt(number); policy != nil && policy.MaxDepth != 0 {
+		return policy.MaxDepth
+	}
+	return maxUncleDepth
+}
+
+// ValidateUnclePolicy checks that the uncle policy of a chain configuration can
+// be applied: uncles can't be deeper than the ancestors scanned for their
+// parents and rewards must not be negative.
+func ValidateUnclePolicy(policy *params.UnclePolicy) error {
+	if policy == nil {
+		return nil
+	}
+	if policy.MaxDepth > maxUncleDepth {
+		return fmt.Errorf("maximum uncle depth %d above %d", policy.MaxDepth, maxUncleDepth)
+	}
+	if policy.UncleReward != nil && policy.UncleReward.Sign() < 0 {
+		return fmt.Errorf("negative uncle reward %v", policy.UncleReward)
+	}
+	if policy.NephewReward != nil && policy.NephewReward.Sign() < 0 {
+		return fmt.Errorf("negative nephew reward %v", policy.NephewReward)
+	}
+	return nil
+}
+
 // ValidateHeader validates the given header and, depending on the pow arg,
 // checks the proof of work of the given header. Returns an error if the
 // validation failed.
@@ -210,7 +262,7 @@ func (v *BlockValidator) ValidateHeader(header, parent *types.Header, checkPow b
 	if v.bc.HasHeader(header.Hash()) {
 		return nil
 	}
-	return ValidateHeader(v.config, v.Pow, header, parent, checkPow, false)
+	return v.engine.VerifyHeader(v.bc, header, parent, checkPow, false)
 }
 
 // Validates a header. Returns an error if the header is invalid.
@@ -272,11 +324,57 @@ func ValidateHeader(config *params.ChainConfig, pow pow.PoW, header *types.Heade
 	return nil
 }
 
+// DifficultyCalculator computes the difficulty of a block created at time on
+// top of a parent, tuned by the difficulty fork selecting it.
+type DifficultyCalculator func(fork *params.DifficultyFork, time, parentTime uint64, parentNumber, parentDiff *big.Int) *big.Int
+
+// difficultyCalculators are the difficulty algorithms selectable per fork.
+var difficultyCalculators = map[string]DifficultyCalculator{
+	params.DifficultyFrontier: func(fork *params.DifficultyFork, time, parentTime uint64, parentNumber, parentDiff *big.Int) *big.Int {
+		return calcDifficultyFrontierWith(forkBlockTime(fork, params.DurationLimit), !fork.NoBomb, time, parentTime, parentNumber, parentDiff)
+	},
+	params.DifficultyHomestead: func(fork *params.DifficultyFork, time, parentTime uint64, parentNumber, parentDiff *big.Int) *big.Int {
+		return calcDifficultyHomesteadWith(forkBlockTime(fork, big10), !fork.NoBomb, time, parentTime, parentNumber, parentDiff)
+	},
+}
+
+// forkBlockTime returns the target block time of a difficulty fork, or the
+// algorithm default if the fork doesn't set one.
+func forkBlockTime(fork *params.DifficultyFork, def *big.Int) *big.Int {
+	if fork.BlockTime == 0 {
+		return def
+	}
+	return new(big.Int).SetUint64(fork.BlockTime)
+}
+
+// ValidateDifficultyForks checks that the difficulty forks of a chain
+// configuration are in block order and select known algorithms.
+func ValidateDifficultyForks(forks []params.DifficultyFork) error {
+	for i, fork := range forks {
+		if fork.Block == nil || fork.Block.Sign() < 0 {
+			return fmt.Errorf("difficulty fork %d: invalid block %v", i, fork.Block)
+		}
+		if i > 0 && fork.Block.Cmp(forks[i-1].Block) <= 0 {
+			return fmt.Errorf("difficulty fork %d: block %v not after block %v", i, fork.Block, forks[i-1].Block)
+		}
+		if _, ok := difficultyCalculators[fork.Algorithm]; !ok {
+			return fmt.Errorf("difficulty fork %d: unknown algorithm %q", i, fork.Algorithm)
+		}
+	}
+	return nil
+}
+
 // CalcDifficulty is the difficulty adjustment algorithm. It returns
 // the difficulty that a new block should have when created at time
 // given the parent block's time and difficulty.
 func CalcDifficulty(config *params.ChainConfig, time, parentTime uint64, parentNumber, parentDiff *big.Int) *big.Int {
-	if config.IsHomestead(new(big.Int).Add(parentNumber, common.Big1)) {
+	next := new(big.Int).Add(parentNumber, common.Big1)
+	if fork := config.DifficultyForkAt(next); fork != nil {
+		if calc, ok := difficultyCalculators[fork.Algorithm]; ok {
+			return calc(fork, time, parentTime, parentNumber, parentDiff)
+		}
+	}
+	if config.IsHomestead(next) {
 		return calcDifficultyHomestead(time, parentTime, parentNumber, parentDiff)
 	} else {
 		return calcDifficultyFrontier(time, parentTime, parentNumber, parentDiff)
@@ -284,10 +382,16 @@ func CalcDifficulty(config *params.ChainConfig, time, parentTime uint64, parentN
 }
 
 func calcDifficultyHomestead(time, parentTime uint64, parentNumber, parentDiff *big.Int) *big.Int {
+	return calcDifficultyHomesteadWith(big10, true, time, parentTime, parentNumber, parentDiff)
+}
+
+// calcDifficultyHomesteadWith is the Homestead difficulty algorithm adjusting to
+// the given block time, optionally without the exponential factor.
+func calcDifficultyHomesteadWith(blockTime *big.Int, bomb bool, time, parentTime uint64, parentNumber, parentDiff *big.Int) *big.Int {
 	// https://github.com/ur-technology/EIPs/blob/master/EIPS/eip-2.mediawiki
 	// algorithm:
 	// diff = (parent_diff +
-	//         (parent_diff / 2048 * max(1 - (block_timestamp - parent_timestamp) // 10, -99))
+	//         (parent_diff / 2048 * max(1 - (block_timestamp - parent_timestamp) // block_time, -99))
 	//        ) + 2^(periodCount - 2)
 
 	bigTime := new(big.Int).SetUint64(time)
@@ -297,17 +401,17 @@ func calcDifficultyHomestead(time, parentTime uint64, parentNumber, parentDiff *
 	x := new(big.Int)
 	y := new(big.Int)
 
-	// 1 - (block_timestamp -parent_timestamp) // 10
+	// 1 - (block_timestamp -parent_timestamp) // block_time
 	x.Sub(bigTime, bigParentTime)
-	x.Div(x, big10)
+	x.Div(x, blockTime)
 	x.Sub(common.Big1, x)
 
-	// max(1 - (block_timestamp - parent_timestamp) // 10, -99)))
+	// max(1 - (block_timestamp - parent_timestamp) // block_time, -99)))
 	if x.Cmp(bigMinus99) < 0 {
 		x.Set(bigMinus99)
 	}
 
-	// (parent_diff + parent_diff // 2048 * max(1 - (block_timestamp - parent_timestamp) // 10, -99))
+	// (parent_diff + parent_diff // 2048 * max(1 - (block_timestamp - parent_timestamp) // block_time, -99))
 	y.Div(parentDiff, params.DifficultyBoundDivisor)
 	x.Mul(y, x)
 	x.Add(parentDiff, x)
@@ -316,7 +420,9 @@ func calcDifficultyHomestead(time, parentTime uint64, parentNumber, parentDiff *
 	if x.Cmp(params.MinimumDifficulty) < 0 {
 		x.Set(params.MinimumDifficulty)
 	}
-
+	if !bomb {
+		return x
+	}
 	// for the exponential factor
 	periodCount := new(big.Int).Add(parentNumber, common.Big1)
 	periodCount.Div(periodCount, ExpDiffPeriod)
@@ -333,6 +439,12 @@ func calcDifficultyHomestead(time, parentTime uint64, parentNumber, parentDiff *
 }
 
 func calcDifficultyFrontier(time, parentTime uint64, parentNumber, parentDiff *big.Int) *big.Int {
+	return calcDifficultyFrontierWith(params.DurationLimit, true, time, parentTime, parentNumber, parentDiff)
+}
+
+// calcDifficultyFrontierWith is the Frontier difficulty algorithm stepping around
+// the given block time, optionally without the exponential factor.
+func calcDifficultyFrontierWith(blockTime *big.Int, bomb bool, time, parentTime uint64, parentNumber, parentDiff *big.Int) *big.Int {
 	diff := new(big.Int)
 	adjust := new(big.Int).Div(parentDiff, params.DifficultyBoundDivisor)
 	bigTime := new(big.Int)
@@ -341,7 +453,7 @@ func calcDifficultyFrontier(time, parentTime uint64, parentNumber, parentDiff *b
 	bigTime.SetUint64(time)
 	bigParentTime.SetUint64(parentTime)
 
-	if bigTime.Sub(bigTime, bigParentTime).Cmp(params.DurationLimit) < 0 {
+	if bigTime.Sub(bigTime, bigParentTime).Cmp(blockTime) < 0 {
 		diff.Add(parentDiff, adjust)
 	} else {
 		diff.Sub(parentDiff, adjust)
@@ -349,7 +461,9 @@ func calcDifficultyFrontier(time, parentTime uint64, parentNumber, parentDiff *b
 	if diff.Cmp(params.MinimumDifficulty) < 0 {
 		diff.Set(params.MinimumDifficulty)
 	}
-
+	if !bomb {
+		return diff
+	}
 	periodCount := new(big.Int).Add(parentNumber, common.Big1)
 	periodCount.Div(periodCount, ExpDiffPeriod)
 	if periodCount.Cmp(common.Big1) > 0 {
@@ -367,6 +481,16 @@ func calcDifficultyFrontier(time, parentTime uint64, parentNumber, parentDiff *b
 // The result may be modified by the caller.
 // This is miner strategy, not consensus protocol.
 func CalcGasLimit(parent *types.Block) *big.Int {
+	return CalcGasLimitTarget(parent, params.TargetGasLimit, nil)
+}
+
+// CalcGasLimitTarget computes the gas limit of the next block after parent,
+// voting toward the target gas limit and never above the ceiling, if any. Both
+// are only reached gradually, as far as the bound divisor allows per block.
+func CalcGasLimitTarget(parent *types.Block, target, ceiling *big.Int) *big.Int {
+	if ceiling != nil && target.Cmp(ceiling) > 0 {
+		target = ceiling
+	}
 	// contrib = (parentGasUsed * 3 / 2) / 1024
 	contrib := new(big.Int).Mul(parent.GasUsed(), big.NewInt(3))
 	contrib = contrib.Div(contrib, big.NewInt(2))
@@ -387,11 +511,17 @@ func CalcGasLimit(parent *types.Block) *big.Int {
 	gl = gl.Add(gl, contrib)
 	gl.Set(common.BigMax(gl, params.MinGasLimit))
 
-	// however, if we're now below the target (TargetGasLimit) we increase the
+	// however, if we're now below the target we increase the
 	// limit as much as we can (parentGasLimit / 1024 -1)
-	if gl.Cmp(params.TargetGasLimit) < 0 {
+	if gl.Cmp(target) < 0 {
 		gl.Add(parent.GasLimit(), decay)
-		gl.Set(common.BigMin(gl, params.TargetGasLimit))
+		gl.Set(common.BigMin(gl, target))
+	}
+	// if we're above the ceiling, we decrease the limit as much as we can
+	if ceiling != nil && gl.Cmp(ceiling) > 0 {
+		gl.Sub(parent.GasLimit(), decay)
+		gl.Set(common.BigMax(gl, ceiling))
+		gl.Set(common.BigMax(gl, params.MinGasLimit))
 	}
 	return gl
 }
@@ -94,3 +94,106 @@ func TestPutReceipt(t *testing.T) {
 		t.Error("expected to get 1 receipt, got none.")
 	}
 }
+
+// Tests that the difficulty forks switch the difficulty algorithm and its tuning
+// from their block on, and that the legacy selection applies before them.
+func TestCalcDifficultyForks(t *testing.T) {
+	config := &params.ChainConfig{
+		HomesteadBlock: big.NewInt(0),
+		DifficultyForks: []params.DifficultyFork{
+			{Block: big.NewInt(100), Algorithm: params.DifficultyFrontier},
+			{Block: big.NewInt(200), Algorithm: params.DifficultyHomestead, BlockTime: 5},
+			{Block: big.NewInt(300000), Algorithm: params.DifficultyHomestead, NoBomb: true},
+		},
+	}
+	var (
+		parentDiff = big.NewInt(2048 * 1000000)
+		step       = big.NewInt(1000000) // parentDiff / DifficultyBoundDivisor
+		bomb       = big.NewInt(1)       // 2^(299999/ExpDiffPeriod - 2)
+	)
+	tests := []struct {
+		number  int64 // Number of the new block
+		elapsed uint64
+		want    *big.Int
+	}{
+		{50, 9, new(big.Int).Add(parentDiff, step)},     // legacy Homestead, below 10 seconds
+		{50, 10, parentDiff},                            // legacy Homestead, at 10 seconds
+		{150, 12, new(big.Int).Add(parentDiff, step)},   // Frontier, below 13 seconds
+		{150, 13, new(big.Int).Sub(parentDiff, step)},   // Frontier, at 13 seconds
+		{250, 9, parentDiff},                            // Homestead tuned to 5 seconds
+		{250, 4, new(big.Int).Add(parentDiff, step)},    // Homestead tuned to 5 seconds
+		{299999, 5, new(big.Int).Add(parentDiff, bomb)}, // bomb still active
+		{300000, 10, parentDiff},                        // bomb removed
+	}
+	for i, tt := range tests {
+		have := CalcDifficulty(config, 1000+tt.elapsed, 1000, big.NewInt(tt.number-1), parentDiff)
+		if have.Cmp(tt.want) != 0 {
+			t.Errorf("test %d: difficulty mismatch: have %v, want %v", i, have, tt.want)
+		}
+	}
+}
+
+// Tests that invalid difficulty fork schedules are rejected.
+func TestValidateDifficultyForks(t *testing.T) {
+	tests := []struct {
+		forks []params.DifficultyFork
+		fail  bool
+	}{
+		{nil, false},
+		{[]params.DifficultyFork{{Block: big.NewInt(0), Algorithm: params.DifficultyHomestead}, {Block: big.NewInt(5), Algorithm: params.DifficultyFrontier}}, false},
+		{[]params.DifficultyFork{{Block: nil, Algorithm: params.DifficultyHomestead}}, true},
+		{[]params.DifficultyFork{{Block: big.NewInt(5), Algorithm: params.DifficultyHomestead}, {Block: big.NewInt(5), Algorithm: params.DifficultyFrontier}}, true},
+		{[]params.DifficultyFork{{Block: big.NewInt(5), Algorithm: "byzantium"}}, true},
+	}
+	for i, tt := range tests {
+		if err := ValidateDifficultyForks(tt.forks); (err != nil) != tt.fail {
+			t.Errorf("test %d: validation mismatch: have %v, want failure %v", i, err, tt.fail)
+		}
+	}
+}
+
+// Tests that invalid uncle policies are rejected.
+func TestValidateUnclePolicy(t *testing.T) {
+	tests := []struct {
+		policy *params.UnclePolicy
+		fail   bool
+	}{
+		{nil, false},
+		{&params.UnclePolicy{NoUncles: true}, false},
+		{&params.UnclePolicy{MaxDepth: 3, UncleReward: new(big.Int), NephewReward: new(big.Int)}, false},
+		{&params.UnclePolicy{MaxDepth: 7}, true},
+		{&params.UnclePolicy{UncleReward: big.NewInt(-1)}, true},
+		{&params.UnclePolicy{NephewReward: big.NewInt(-1)}, true},
+	}
+	for i, tt := range tests {
+		if err := ValidateUnclePolicy(tt.policy); (err != nil) != tt.fail {
+			t.Errorf("test %d: validation mismatch: have %v, want failure %v", i, err, tt.fail)
+		}
+	}
+}
+
+// Tests that the mined gas limit votes toward the target, and down to the
+// ceiling, by at most the bound divisor allowance per block.
+func TestCalcGasLimitTarget(t *testing.T) {
+	parent := func(used int64) *types.Block {
+		return types.NewBlockWithHeader(&types.Header{GasLimit: big.NewInt(1024000), GasUsed: big.NewInt(used)})
+	}
+	tests := []struct {
+		used            int64
+		target, ceiling *big.Int
+		want            int64
+	}{
+		{0, big.NewInt(2000000), nil, 1024999},
+		{0, big.NewInt(1024500), nil, 1024500},
+		{0, big.NewInt(500000), nil, 1023001},
+		{0, big.NewInt(2000000), big.NewInt(1024000), 1024000},
+		{0, big.NewInt(2000000), big.NewInt(900000), 1023001},
+		{1024000, big.NewInt(500000), big.NewInt(1024200), 1024200},
+		{1024000, big.NewInt(500000), nil, 1024501},
+	}
+	for i, tt := range tests {
+		if have := CalcGasLimitTarget(parent(tt.used), tt.target, tt.ceiling); have.Int64() != tt.want {
+			t.Errorf("test %d: gas limit mismatch: have %v, want %d", i, have, tt.want)
+		}
+	}
+}
@@ -23,13 +23,14 @@ import (
 	"io"
 	"math/big"
 	mrand "math/rand"
-	"runtime"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/hashicorp/golang-lru"
 	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/common/workers"
+	"github.com/ur-technology/go-ur/consensus"
 	"github.com/ur-technology/go-ur/core/state"
 	"github.com/ur-technology/go-ur/core/types"
 	"github.com/ur-technology/go-ur/core/vm"
@@ -40,7 +41,6 @@ import (
 	"github.com/ur-technology/go-ur/logger/glog"
 	"github.com/ur-technology/go-ur/metrics"
 	"github.com/ur-technology/go-ur/params"
-	"github.com/ur-technology/go-ur/pow"
 	"github.com/ur-technology/go-ur/rlp"
 	"github.com/ur-technology/go-ur/trie"
 )
@@ -52,6 +52,10 @@ var (
 	blockInsertTimer = metrics.NewTimer("chain/inserts")
 
 	ErrNoGenesis = errors.New("Genesis not found in chain")
+
+	// ErrFinalizedReorg is returned when a chain reorganisation would revert the
+	// finalized checkpoint.
+	ErrFinalizedReorg = errors.New("reorg past the finalized checkpoint")
 )
 
 const (
@@ -59,11 +63,52 @@ const (
 	blockCacheLimit     = 256
 	maxFutureBlocks     = 256
 	maxTimeFutureBlocks = 30
+	badBlockLimit       = 10
+	triesInMemory       = 128              // Recent states kept in the trie cache for reorgs
+	txLookupInterval    = 30 * time.Second // Time between two removals of old transaction lookups
+	txLookupBatch       = 1000             // Blocks whose transaction lookups are removed or restored at once
 	// must be bumped when consensus algorithm is changed, this forces the upgradedb
 	// command to be run (forces the blocks to be imported again using the new algorithm)
 	BlockChainVersion = 3
+
+	// DefaultTrieCommitInterval is the default number of blocks between writes of
+	// the head state to disk when the trie cache is enabled.
+	DefaultTrieCommitInterval = 128
 )
 
+// BlockChainConfig contains the settings of the state caching, indexing and
+// proof of work verification of a BlockChain. The zero value writes every state
+// to disk and indexes the transactions of the entire chain.
+type BlockChainConfig struct {
+	// TrieCacheLimit is the memory allowance, in megabytes, of the trie cache the
+	// states of imported blocks are held and garbage collected in before being
+	// written to disk ("full" gc mode). Zero disables the cache, writing every
+	// state to disk ("archive" gc mode).
+	TrieCacheLimit int
+
+	// TrieCommitInterval is the number of blocks between writes of the head state
+	// to disk when the trie cache is enabled.
+	TrieCommitInterval uint64
+
+	// FlatStateLimit is the number of accounts, and as many storage slots, the
+	// flat view of the recent states serving reads ahead of the tries may hold.
+	// Zero disables the flat view.
+	FlatStateLimit int
+
+	// ReverseDiffBlocks is the number of most recent blocks whose state changes
+	// are kept as reverse diffs, so their states can be read after the tries are
+	// gone. Zero disables the reverse diffs.
+	ReverseDiffBlocks uint64
+
+	// TxLookupLimit is the number of most recent blocks whose transactions can be
+	// looked up by hash, the lookups of older blocks being removed in the
+	// background. Zero keeps the lookups of the entire chain, a negative value
+	// disables them.
+	TxLookupLimit int
+
+	Pow PowConfig // Proof of work verification settings of the header chain
+}
+
 // BlockChain represents the canonical chain given a database with a genesis
 // block. The Blockchain manages chain imports, reverts, chain reorganisations.
 //
@@ -79,10 +124,14 @@ const (
 // included in the canonical one where as GetBlockByNumber always represents the
 // canonical chain.
 type BlockChain struct {
-	config *params.ChainConfig // chain & network configuration
+	config      *params.ChainConfig // chain & network configuration
+	cacheConfig *BlockChainConfig   // state caching, indexing and verification settings
 
 	hc           *HeaderChain
 	chainDb      ethdb.Database
+	stateDb      ethdb.Database   // Database the states are kept in, chainDb or trieCache
+	trieCache    *state.TrieCache // Cache of the recent states in full gc mode, nil in archive mode
+	flatState    *state.FlatState // Flat view of the recent states, nil if disabled
 	eventMux     *event.TypeMux
 	genesisBlock *types.Block
 
@@ -93,12 +142,15 @@ type BlockChain struct {
 	checkpoint       int          // checkpoint counts towards the new checkpoint
 	currentBlock     *types.Block // Current head of the block chain
 	currentFastBlock *types.Block // Current head of the fast-sync chain (may be above the block chain!)
+	finalNumber      uint64       // Number of the finalized checkpoint, never reorganised past
+	finalHash        common.Hash  // Hash of the finalized checkpoint, zero if none
 
 	stateCache   *state.StateDB // State database to reuse between imports (contains state cache)
 	bodyCache    *lru.Cache     // Cache for the most recent block bodies
 	bodyRLPCache *lru.Cache     // Cache for the most recent block bodies in RLP encoded format
 	blockCache   *lru.Cache     // Cache for the most recent entire blocks
 	futureBlocks *lru.Cache     // future blocks are blocks added for later processing
+	badBlocks    *lru.Cache     // Most recent blocks rejected as invalid
 
 	quit    chan struct{} // blockchain quit channel
 	running int32         // running must be called atomically
@@ -106,22 +158,30 @@ type BlockChain struct {
 	procInterrupt int32          // interrupt signaler for block processing
 	wg            sync.WaitGroup // chain processing wait group for shutting down
 
-	pow       pow.PoW
+	engine    consensus.Engine
 	processor Processor // block processor interface
 	validator Validator // block and state validator interface
 }
 
 // NewBlockChain returns a fully initialised block chain using information
 // available in the database. It initialiser the default Ethereum Validator and
-// Processor.
-func NewBlockChain(chainDb ethdb.Database, config *params.ChainConfig, pow pow.PoW, mux *event.TypeMux) (*BlockChain, error) {
+// Processor, which verify and finalize blocks with the given consensus engine.
+func NewBlockChain(chainDb ethdb.Database, config *params.ChainConfig, engine consensus.Engine, mux *event.TypeMux) (*BlockChain, error) {
+	return NewBlockChainWithConfig(chainDb, config, new(BlockChainConfig), engine, mux)
+}
+
+// NewBlockChainWithConfig returns a fully initialised block chain like
+// NewBlockChain, caching, indexing and verifying according to cacheConfig.
+func NewBlockChainWithConfig(chainDb ethdb.Database, config *params.ChainConfig, cacheConfig *BlockChainConfig, engine consensus.Engine, mux *event.TypeMux) (*BlockChain, error) {
 	bodyCache, _ := lru.New(bodyCacheLimit)
 	bodyRLPCache, _ := lru.New(bodyCacheLimit)
 	blockCache, _ := lru.New(blockCacheLimit)
 	futureBlocks, _ := lru.New(maxFutureBlocks)
+	badBlocks, _ := lru.New(badBlockLimit)
 
 	bc := &BlockChain{
 		config:       config,
+		cacheConfig:  cacheConfig,
 		chainDb:      chainDb,
 		eventMux:     mux,
 		quit:         make(chan struct{}),
@@ -129,14 +189,23 @@ func NewBlockChain(chainDb ethdb.Database, config *params.ChainConfig, pow pow.P
 		bodyRLPCache: bodyRLPCache,
 		blockCache:   blockCache,
 		futureBlocks: futureBlocks,
-		pow:          pow,
+		badBlocks:    badBlocks,
+		engine:       engine,
+	}
+	bc.stateDb = chainDb
+	if cacheConfig.TrieCacheLimit > 0 {
+		bc.trieCache = state.NewTrieCache(chainDb, triesInMemory)
+		bc.stateDb = bc.trieCache
+	}
+	if cacheConfig.FlatStateLimit > 0 {
+		bc.flatState = state.NewFlatState(cacheConfig.FlatStateLimit)
 	}
-	bc.SetValidator(NewBlockValidator(config, bc, pow))
+	bc.SetValidator(NewBlockValidator(config, bc, engine))
 	bc.SetProcessor(NewStateProcessor(config, bc))
 
 	gv := func() HeaderValidator { return bc.Validator() }
 	var err error
-	bc.hc, err = NewHeaderChain(chainDb, config, gv, bc.getProcInterrupt)
+	bc.hc, err = NewHeaderChain(chainDb, config, cacheConfig.Pow, gv, bc.getProcInterrupt)
 	if err != nil {
 		return nil, err
 	}
@@ -163,6 +232,7 @@ func NewBlockChain(chainDb ethdb.Database, config *params.ChainConfig, pow pow.P
 		}
 	}
 	// Take ownership of this particular state
+	bc.wg.Add(1)
 	go bc.update()
 	return bc, nil
 }
@@ -180,34 +250,36 @@ func (self *BlockChain) loadLastState() error {
 		// Corrupt or empty database, init from scratch
 		self.Reset()
 	} else {
-		if block := self.GetBlockByHash(head); block != nil {
-			// Block found, set as the current head
-			self.currentBlock = block
-		} else {
-			// Corrupt or empty database, init from scratch
-			self.Reset()
-		}
+		// A missing block is rebuilt from the header chain by the integrity check
+		self.currentBlock = self.GetBlockByHash(head)
 	}
 	// Restore the last known head header
-	currentHeader := self.currentBlock.Header()
+	var currentHeader *types.Header
 	if head := GetHeadHeaderHash(self.chainDb); head != (common.Hash{}) {
-		if header := self.GetHeaderByHash(head); header != nil {
-			currentHeader = header
-		}
+		currentHeader = self.GetHeaderByHash(head)
 	}
-	self.hc.SetCurrentHeader(currentHeader)
+	// Restore the finalized checkpoint
+	self.finalNumber, self.finalHash = GetFinalizedCheckpoint(self.chainDb)
 	// Restore the last known head fast block
-	self.currentFastBlock = self.currentBlock
+	self.currentFastBlock = nil
 	if head := GetHeadFastBlockHash(self.chainDb); head != (common.Hash{}) {
-		if block := self.GetBlockByHash(head); block != nil {
-			self.currentFastBlock = block
-		}
+		self.currentFastBlock = self.GetBlockByHash(head)
+	}
+	// Verify the heads agree with each other, the canonical chain and the state,
+	// rewinding them otherwise, the recent states held in memory being lost if
+	// the node crashed in full gc mode
+	currentHeader, err := self.checkIntegrity(currentHeader)
+	if err != nil {
+		return err
 	}
+	self.hc.SetCurrentHeader(currentHeader)
+
 	// Initialize a statedb cache to ensure singleton account bloom filter generation
-	statedb, err := state.New(self.currentBlock.Root(), self.chainDb)
+	statedb, err := state.New(self.currentBlock.Root(), self.stateDb)
 	if err != nil {
 		return err
 	}
+	statedb.SetFlatState(self.flatState)
 	self.stateCache = statedb
 	self.stateCache.GetAccount(common.Address{})
 
@@ -223,11 +295,30 @@ func (self *BlockChain) loadLastState() error {
 	return nil
 }
 
+// repair rewinds the given head block to the most recent ancestor whose state is
+// available.
+func (self *BlockChain) repair(head **types.Block) error {
+	block := *head
+	for !self.hasState(block.Root()) {
+		parent := self.GetBlock(block.ParentHash(), block.NumberU64()-1)
+		if parent == nil {
+			return fmt.Errorf("missing state of block #%d [%x…] and of its ancestors", block.Number(), block.Hash().Bytes()[:4])
+		}
+		block = parent
+	}
+	*head = block
+	return nil
+}
+
 // SetHead rewinds the local chain to a new head. In the case of headers, everything
 // above the new head will be deleted and the new one set. In the case of blocks
 // though, the head may be further rewound if block bodies are missing (non-archive
 // nodes after a fast sync).
 func (bc *BlockChain) SetHead(head uint64) {
+	// Wait for any running import to finish rather than rewinding under it
+	bc.chainmu.Lock()
+	defer bc.chainmu.Unlock()
+
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
 
@@ -236,6 +327,11 @@ func (bc *BlockChain) SetHead(head uint64) {
 	}
 	bc.hc.SetHead(head, delFn)
 
+	// Discard the frozen blocks beyond the new head along with the live ones
+	if err := TruncateAncients(bc.chainDb, head+1); err != nil {
+		glog.V(logger.Error).Infof("failed to truncate ancient blocks: %v", err)
+	}
+
 	// Clear out any stale content from the caches
 	bc.bodyCache.Purge()
 	bc.bodyRLPCache.Purge()
@@ -264,9 +360,43 @@ func (bc *BlockChain) SetHead(head uint64) {
 	if err := WriteHeadFastBlockHash(bc.chainDb, bc.currentFastBlock.Hash()); err != nil {
 		glog.Fatalf("failed to reset head fast block hash: %v", err)
 	}
+	// An explicit rewind overrides the finality of the blocks it discards
+	if bc.finalHash != (common.Hash{}) && bc.finalNumber > bc.currentBlock.NumberU64() {
+		glog.V(logger.Warn).Infof("Rewound past the finalized checkpoint #%d [%x…]", bc.finalNumber, bc.finalHash[:4])
+		DeleteFinalizedCheckpoint(bc.chainDb)
+	}
 	bc.loadLastState()
 }
 
+// Finalized returns the number and hash of the finalized checkpoint, a zero hash
+// if no block was finalized.
+func (bc *BlockChain) Finalized() (uint64, common.Hash) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	return bc.finalNumber, bc.finalHash
+}
+
+// SetFinalized marks a canonical block as finalized, refusing any later chain
+// reorganisation that would revert it. Checkpoints older than the current one
+// are ignored.
+func (bc *BlockChain) SetFinalized(number uint64, hash common.Hash) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if bc.finalHash != (common.Hash{}) && number <= bc.finalNumber {
+		return nil
+	}
+	if number > bc.currentBlock.NumberU64() || GetCanonicalHash(bc.chainDb, number) != hash {
+		return fmt.Errorf("checkpoint #%d [%x…] not in the canonical chain", number, hash[:4])
+	}
+	if err := WriteFinalizedCheckpoint(bc.chainDb, number, hash); err != nil {
+		return err
+	}
+	bc.finalNumber, bc.finalHash = number, hash
+	return nil
+}
+
 // FastSyncCommitHead sets the current head block to the one defined by the hash
 // irrelevant what the chain contents were prior.
 func (self *BlockChain) FastSyncCommitHead(hash common.Hash) error {
@@ -358,14 +488,20 @@ func (self *BlockChain) Processor() Processor {
 	return self.processor
 }
 
-// AuxValidator returns the auxiliary validator (Proof of work atm)
-func (self *BlockChain) AuxValidator() pow.PoW { return self.pow }
+// Engine returns the consensus engine sealing, verifying and finalizing blocks.
+func (self *BlockChain) Engine() consensus.Engine { return self.engine }
 
 // State returns a new mutable state based on the current HEAD block.
 func (self *BlockChain) State() (*state.StateDB, error) {
 	return self.StateAt(self.CurrentBlock().Root())
 }
 
+// StateDatabase returns the database the states are kept in, a cache in front of
+// the chain database in full gc mode.
+func (self *BlockChain) StateDatabase() ethdb.Database {
+	return self.stateDb
+}
+
 // StateAt returns a new mutable state based on a particular point in time.
 func (self *BlockChain) StateAt(root common.Hash) (*state.StateDB, error) {
 	return self.stateCache.New(root)
@@ -419,6 +555,7 @@ func (self *BlockChain) ExportN(w io.Writer, first uint64, last uint64) error {
 
 	glog.V(logger.Info).Infof("exporting %d blocks...\n", last-first+1)
 
+	start, reported := time.Now(), time.Now()
 	for nr := first; nr <= last; nr++ {
 		block := self.GetBlockByNumber(nr)
 		if block == nil {
@@ -428,6 +565,10 @@ func (self *BlockChain) ExportN(w io.Writer, first uint64, last uint64) error {
 		if err := block.EncodeRLP(w); err != nil {
 			return err
 		}
+		if time.Since(reported) >= statsReportLimit {
+			glog.V(logger.Info).Infof("exported %d/%d blocks, elapsed %v", nr-first+1, last-first+1, time.Since(start))
+			reported = time.Now()
+		}
 	}
 
 	return nil
@@ -516,7 +657,7 @@ func (bc *BlockChain) HasBlockAndState(hash common.Hash) bool {
 		return false
 	}
 	// Ensure the associated state is also present
-	_, err := state.New(block.Root(), bc.chainDb)
+	_, err := state.New(block.Root(), bc.stateDb)
 	return err == nil
 }
 
@@ -589,6 +730,16 @@ func (bc *BlockChain) Stop() {
 
 	bc.wg.Wait()
 
+	// Persist the head state, the uncommitted ones in memory are lost
+	if bc.trieCache != nil {
+		bc.mu.RLock()
+		root := bc.currentBlock.Root()
+		bc.mu.RUnlock()
+
+		if _, _, err := bc.trieCache.Commit(root, 0); err != nil {
+			glog.V(logger.Error).Infof("Failed to commit head state: %v", err)
+		}
+	}
 	glog.V(logger.Info).Infoln("Chain manager stopped")
 }
 
@@ -733,7 +884,7 @@ func (self *BlockChain) InsertReceiptChain(blockChain types.Blocks, receiptChain
 				glog.Fatal(errs[index])
 				return
 			}
-			if err := WriteTransactions(self.chainDb, block); err != nil {
+			if err := self.WriteTxLookups(block); err != nil {
 				errs[index] = fmt.Errorf("failed to write individual transactions: %v", err)
 				atomic.AddInt32(&failed, 1)
 				glog.Fatal(errs[index])
@@ -748,9 +899,9 @@ func (self *BlockChain) InsertReceiptChain(blockChain types.Blocks, receiptChain
 			atomic.AddInt32(&stats.processed, 1)
 		}
 	}
-	// Start as many worker threads as goroutines allowed
+	// Start as many worker threads as the shared pool allows
 	pending := new(sync.WaitGroup)
-	for i := 0; i < runtime.GOMAXPROCS(0); i++ {
+	for i, n := 0, workers.Size(len(errs)); i < n; i++ {
 		pending.Add(1)
 		go func(id int) {
 			defer pending.Done()
@@ -834,12 +985,35 @@ func (self *BlockChain) WriteBlock(block *types.Block) (status WriteStatus, err
 	} else {
 		status = SideStatTy
 	}
+	self.commitState(block, status)
 
 	self.futureBlocks.Remove(block.Hash())
 
 	return
 }
 
+// commitState tracks the state of a newly written block in the trie cache if
+// enabled, writing the head state to disk every TrieCommitInterval blocks or once
+// the cache outgrows its allowance.
+func (self *BlockChain) commitState(block *types.Block, status WriteStatus) {
+	if self.trieCache == nil {
+		return
+	}
+	self.trieCache.Reference(block.Root())
+	if status != CanonStatTy {
+		return
+	}
+	limit := common.StorageSize(self.cacheConfig.TrieCacheLimit) * 1024 * 1024
+	if interval := self.cacheConfig.TrieCommitInterval; interval > 0 && block.NumberU64()%interval != 0 && self.trieCache.Size() < limit {
+		return
+	}
+	nodes, size, err := self.trieCache.Commit(block.Root(), limit)
+	if err != nil {
+		glog.Fatalf("failed to commit block state: %v", err)
+	}
+	glog.V(logger.Debug).Infof("committed state of block #%d [%x…]: %d nodes, %v, %v cached", block.Number(), block.Hash().Bytes()[:4], nodes, size, self.trieCache.Size())
+}
+
 // InsertChain will attempt to insert the given chain in to the canonical chain or, otherwise, create a fork. It an error is returned
 // it will return the index number of the failing block as well an error describing what went wrong (for possible errors see core/errors.go).
 func (self *BlockChain) InsertChain(chain types.Blocks) (int, error) {
@@ -857,12 +1031,17 @@ func (self *BlockChain) InsertChain(chain types.Blocks) (int, error) {
 		events        = make([]interface{}, 0, len(chain))
 		coalescedLogs vm.Logs
 		nonceChecked  = make([]bool, len(chain))
+		txChecked     = make([]bool, len(chain))
+		txErrs        = make([]error, len(chain))
 	)
 
-	// Start the parallel nonce verifier.
-	nonceAbort, nonceResults := verifyNoncesFromBlocks(self.pow, chain)
+	// Start the parallel nonce verifier and the transaction pre-validator.
+	nonceAbort, nonceResults := verifyNoncesFromBlocks(self.engine, chain, self.cacheConfig.Pow.Verifiers)
 	defer close(nonceAbort)
 
+	txAbort, txResults := verifyTransactions(self.config, chain)
+	defer close(txAbort)
+
 	for i, block := range chain {
 		if atomic.LoadInt32(&self.procInterrupt) == 1 {
 			glog.V(logger.Debug).Infoln("Premature abort during block chain processing")
@@ -920,6 +1099,16 @@ func (self *BlockChain) InsertChain(chain types.Blocks) (int, error) {
 			return i, err
 		}
 
+		// Wait for block i's transactions to be pre-validated (senders
+		// recovered, intrinsic gas checked) before processing its state.
+		for !txChecked[i] {
+			r := <-txResults
+			txChecked[r.index], txErrs[r.index] = true, r.err
+		}
+		if err := txErrs[i]; err != nil {
+			self.reportBlock(block, nil, err)
+			return i, err
+		}
 		// Create a new statedb using the parent block and report an
 		// error if it fails.
 		switch {
@@ -945,10 +1134,14 @@ func (self *BlockChain) InsertChain(chain types.Blocks) (int, error) {
 			return i, err
 		}
 		// Write state changes to database
+		if self.cacheConfig.ReverseDiffBlocks > 0 {
+			self.stateCache.RecordReverseDiff()
+		}
 		_, err = self.stateCache.Commit(self.config.IsEIP158(block.Number()))
 		if err != nil {
 			return i, err
 		}
+		self.WriteReverseDiff(block, self.stateCache.ReverseDiff())
 
 		// coalesce logs for later processing
 		coalescedLogs = append(coalescedLogs, logs...)
@@ -972,7 +1165,7 @@ func (self *BlockChain) InsertChain(chain types.Blocks) (int, error) {
 			events = append(events, ChainEvent{block, block.Hash(), logs})
 
 			// This puts transactions in a extra db for rpc
-			if err := WriteTransactions(self.chainDb, block); err != nil {
+			if err := self.WriteTxLookups(block); err != nil {
 				return i, err
 			}
 			// store the receipts
@@ -1126,6 +1319,10 @@ func (self *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 			return fmt.Errorf("Invalid new chain")
 		}
 	}
+	// Refuse to revert the finalized checkpoint
+	if self.finalHash != (common.Hash{}) && commonBlock.NumberU64() < self.finalNumber {
+		return fmt.Errorf("%v #%d [%x…]", ErrFinalizedReorg, self.finalNumber, self.finalHash[:4])
+	}
 
 	if glog.V(logger.Debug) {
 		commonHash := commonBlock.Hash()
@@ -1138,7 +1335,7 @@ func (self *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 		// insert the block in the canonical way, re-writing history
 		self.insert(block)
 		// write canonical receipts and transactions
-		if err := WriteTransactions(self.chainDb, block); err != nil {
+		if err := self.WriteTxLookups(block); err != nil {
 			return err
 		}
 		receipts := GetBlockReceipts(self.chainDb, block.Hash(), block.NumberU64())
@@ -1200,19 +1397,158 @@ func (self *BlockChain) postChainEvents(events []interface{}, logs vm.Logs) {
 }
 
 func (self *BlockChain) update() {
+	defer self.wg.Done()
+
 	futureTimer := time.Tick(5 * time.Second)
+	txLookupTimer := time.Tick(txLookupInterval)
 	for {
 		select {
 		case <-futureTimer:
 			self.procFutureBlocks()
+		case <-txLookupTimer:
+			self.updateTxLookups()
 		case <-self.quit:
 			return
 		}
 	}
 }
 
-// reportBlock logs a bad block error.
+// WriteTxLookups stores the transactions of a canonical block for lookups by
+// hash, unless disabled or the block is below the lookups already removed.
+func (self *BlockChain) WriteTxLookups(block *types.Block) error {
+	if self.cacheConfig.TxLookupLimit < 0 || block.NumberU64() < GetTxLookupTail(self.chainDb) {
+		return nil
+	}
+	return WriteTransactions(self.chainDb, block)
+}
+
+// txLookupTarget returns the number of the oldest block whose transaction
+// lookups should be kept at the given chain head.
+func (self *BlockChain) txLookupTarget(head uint64) uint64 {
+	limit := self.cacheConfig.TxLookupLimit
+	switch {
+	case limit < 0:
+		return head + 1
+	case limit == 0 || head+1 <= uint64(limit):
+		return 0
+	default:
+		return head + 1 - uint64(limit)
+	}
+}
+
+// updateTxLookups moves the oldest block with transaction lookups to the one
+// required by TxLookupLimit: the lookups of older blocks are removed, and those
+// of the blocks previously unindexed are written again when the limit was
+// raised or lifted since.
+func (self *BlockChain) updateTxLookups() {
+	self.unindexTransactions()
+	self.reindexTransactions()
+}
+
+// unindexTransactions removes the transaction lookups of the canonical blocks
+// older than the most recent TxLookupLimit ones, or of all blocks if the lookups
+// are disabled, in batches until caught up with the chain head.
+func (self *BlockChain) unindexTransactions() {
+	for {
+		target := self.txLookupTarget(self.CurrentBlock().NumberU64())
+		tail := GetTxLookupTail(self.chainDb)
+		if tail >= target {
+			return
+		}
+		if target-tail > txLookupBatch {
+			target = tail + txLookupBatch
+		}
+		// Hold off reorgs, which rewrite the lookups of the blocks they touch
+		self.chainmu.Lock()
+		for number := tail; number < target; number++ {
+			hash := GetCanonicalHash(self.chainDb, number)
+			if body := GetBody(self.chainDb, hash, number); body != nil {
+				for _, tx := range body.Transactions {
+					DeleteTransaction(self.chainDb, tx.Hash())
+				}
+			}
+		}
+		err := WriteTxLookupTail(self.chainDb, target)
+		self.chainmu.Unlock()
+
+		if err != nil {
+			glog.V(logger.Error).Infof("Failed to remove transaction lookups: %v", err)
+			return
+		}
+		glog.V(logger.Debug).Infof("Removed transaction lookups of blocks #%d-#%d", tail, target-1)
+
+		select {
+		case <-self.quit:
+			return
+		default:
+		}
+	}
+}
+
+// reindexTransactions writes the transaction lookups of the canonical blocks
+// below the oldest indexed one that are within TxLookupLimit again, newest
+// first in batches, so the lookups stay contiguous up to the chain head.
+func (self *BlockChain) reindexTransactions() {
+	for {
+		target := self.txLookupTarget(self.CurrentBlock().NumberU64())
+		tail := GetTxLookupTail(self.chainDb)
+		if tail <= target {
+			return
+		}
+		if tail-target > txLookupBatch {
+			target = tail - txLookupBatch
+		}
+		// Hold off reorgs, which rewrite the lookups of the blocks they touch
+		self.chainmu.Lock()
+		var err error
+		for number := tail; number > target && err == nil; number-- {
+			hash := GetCanonicalHash(self.chainDb, number-1)
+			if block := GetBlock(self.chainDb, hash, number-1); block != nil {
+				err = WriteTransactions(self.chainDb, block)
+			}
+		}
+		if err == nil {
+			err = WriteTxLookupTail(self.chainDb, target)
+		}
+		self.chainmu.Unlock()
+
+		if err != nil {
+			glog.V(logger.Error).Infof("Failed to restore transaction lookups: %v", err)
+			return
+		}
+		glog.V(logger.Debug).Infof("Restored transaction lookups of blocks #%d-#%d", target, tail-1)
+
+		select {
+		case <-self.quit:
+			return
+		default:
+		}
+	}
+}
+
+// BadBlock is a block rejected as invalid during import, along with the reason.
+type BadBlock struct {
+	Block    *types.Block
+	Receipts types.Receipts // Receipts of the processed transactions, nil if not processed
+	Err      error
+	Reported time.Time
+}
+
+// BadBlocks returns the most recent blocks rejected as invalid, oldest first.
+func (bc *BlockChain) BadBlocks() []*BadBlock {
+	blocks := make([]*BadBlock, 0, bc.badBlocks.Len())
+	for _, hash := range bc.badBlocks.Keys() {
+		if bad, ok := bc.badBlocks.Peek(hash); ok {
+			blocks = append(blocks, bad.(*BadBlock))
+		}
+	}
+	return blocks
+}
+
+// reportBlock logs a bad block error and keeps the block for later inspection.
 func (bc *BlockChain) reportBlock(block *types.Block, receipts types.Receipts, err error) {
+	bc.badBlocks.Add(block.Hash(), &BadBlock{Block: block, Receipts: receipts, Err: err, Reported: time.Now()})
+
 	if glog.V(logger.Error) {
 		var receiptString string
 		for _, receipt := range receipts {
@@ -0,0 +1,194 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core/state"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/logger"
+	"github.com/ur-technology/go-ur/logger/glog"
+)
+
+// checkIntegrity verifies that the head header, head block and head fast block
+// restored on startup are canonical and ordered, that the state of the head
+// block is available and that the block stats index, holding the signup counts,
+// doesn't reach past the head block. Whatever is inconsistent is rewound to the
+// most recent consistent block and persisted, with a summary of the repairs
+// logged. Heads missing from the database are passed as nil.
+//
+// The checks only read the heads, so a consistent database costs a few lookups.
+// The chain is walked only to repair.
+func (self *BlockChain) checkIntegrity(header *types.Header) (*types.Header, error) {
+	var (
+		start   = time.Now()
+		repairs []string
+		block   = self.currentBlock
+		fast    = self.currentFastBlock
+	)
+	if self.consistentHeads(header, block, fast) && self.statsIndexAligned(block.NumberU64()) {
+		glog.V(logger.Debug).Infof("Chain integrity check passed in %v", common.PrettyDuration(time.Since(start)))
+		return header, nil
+	}
+	report := func(format string, args ...interface{}) {
+		repairs = append(repairs, fmt.Sprintf(format, args...))
+	}
+	// The head header must be canonical, rewind it to its canonical ancestor if not
+	switch {
+	case header == nil:
+		header = self.genesisBlock.Header()
+		if block != nil {
+			header = block.Header()
+		}
+		report("head header missing, reset to #%d [%x…]", header.Number, header.Hash().Bytes()[:4])
+	case !self.isCanonical(header.Hash(), header.Number.Uint64()):
+		stale := header
+		header = self.canonicalAncestor(header)
+		report("head header #%d [%x…] not canonical, rewound to #%d [%x…]", stale.Number, stale.Hash().Bytes()[:4], header.Number, header.Hash().Bytes()[:4])
+	}
+	// A canonical head block above the head header means the header write was lost
+	if block != nil && block.NumberU64() > header.Number.Uint64() && self.isCanonical(block.Hash(), block.NumberU64()) {
+		report("head header #%d [%x…] behind head block, advanced to #%d [%x…]", header.Number, header.Hash().Bytes()[:4], block.Number(), block.Hash().Bytes()[:4])
+		header = block.Header()
+	}
+	// The head block must be canonical up to the head header, with its body
+	if block == nil || block.NumberU64() > header.Number.Uint64() || !self.isCanonical(block.Hash(), block.NumberU64()) {
+		stale := "missing"
+		if block != nil {
+			stale = fmt.Sprintf("#%d [%x…] not canonical", block.Number(), block.Hash().Bytes()[:4])
+		}
+		number := header.Number.Uint64()
+		if block != nil && block.NumberU64() <= number {
+			number = self.canonicalAncestor(block.Header()).Number.Uint64()
+		}
+		block = self.lastCanonicalBlock(number)
+		report("head block %s, rewound to #%d [%x…]", stale, block.Number(), block.Hash().Bytes()[:4])
+	}
+	// The state of the head block must be available
+	if number, hash := block.NumberU64(), block.Hash(); !self.hasState(block.Root()) {
+		if err := self.repair(&block); err != nil {
+			return nil, err
+		}
+		report("state of head block #%d [%x…] missing, rewound to #%d [%x…]", number, hash[:4], block.Number(), block.Hash().Bytes()[:4])
+	}
+	if err := WriteHeadBlockHash(self.chainDb, block.Hash()); err != nil {
+		return nil, err
+	}
+	self.currentBlock = block
+
+	// The head fast block must be canonical up to the head header
+	if fast == nil || fast.NumberU64() > header.Number.Uint64() || !self.isCanonical(fast.Hash(), fast.NumberU64()) {
+		stale := "missing"
+		if fast != nil {
+			stale = fmt.Sprintf("#%d [%x…] not canonical", fast.Number(), fast.Hash().Bytes()[:4])
+		}
+		fast = block
+		report("head fast block %s, reset to #%d [%x…]", stale, fast.Number(), fast.Hash().Bytes()[:4])
+		if err := WriteHeadFastBlockHash(self.chainDb, fast.Hash()); err != nil {
+			return nil, err
+		}
+	}
+	self.currentFastBlock = fast
+
+	// The block stats index must not reach past the head block
+	if sections := GetBlockStatsSections(self.chainDb); !self.statsIndexAligned(block.NumberU64()) {
+		valid := sections
+		for valid > 0 && !self.statsSectionValid(valid-1, block.NumberU64()) {
+			valid--
+		}
+		if err := WriteBlockStatsSections(self.chainDb, valid); err != nil {
+			return nil, err
+		}
+		report("block stats index ahead of head block #%d, rolled back from %d to %d sections", block.Number(), sections, valid)
+	}
+	glog.V(logger.Warn).Infof("Chain integrity check made %d repairs in %v:", len(repairs), common.PrettyDuration(time.Since(start)))
+	for _, repair := range repairs {
+		glog.V(logger.Warn).Infof("  %s", repair)
+	}
+	return header, nil
+}
+
+// consistentHeads reports whether the heads are present and canonical, with the
+// block and fast heads no higher than the header one and the head state available.
+func (self *BlockChain) consistentHeads(header *types.Header, block, fast *types.Block) bool {
+	if header == nil || block == nil || fast == nil {
+		return false
+	}
+	number := header.Number.Uint64()
+	if block.NumberU64() > number || fast.NumberU64() > number {
+		return false
+	}
+	if !self.isCanonical(header.Hash(), number) || !self.isCanonical(block.Hash(), block.NumberU64()) || !self.isCanonical(fast.Hash(), fast.NumberU64()) {
+		return false
+	}
+	return self.hasState(block.Root())
+}
+
+// isCanonical reports whether a block is the canonical one at its number.
+func (self *BlockChain) isCanonical(hash common.Hash, number uint64) bool {
+	return GetCanonicalHash(self.chainDb, number) == hash
+}
+
+// hasState reports whether the state with the given root is available.
+func (self *BlockChain) hasState(root common.Hash) bool {
+	_, err := state.New(root, self.stateDb)
+	return err == nil
+}
+
+// canonicalAncestor returns the most recent canonical ancestor of a header.
+func (self *BlockChain) canonicalAncestor(header *types.Header) *types.Header {
+	for header.Number.Sign() > 0 && !self.isCanonical(header.Hash(), header.Number.Uint64()) {
+		parent := self.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+		if parent == nil {
+			return self.genesisBlock.Header()
+		}
+		header = parent
+	}
+	return header
+}
+
+// lastCanonicalBlock returns the most recent canonical block not above the given
+// number whose body is available.
+func (self *BlockChain) lastCanonicalBlock(number uint64) *types.Block {
+	for ; number > 0; number-- {
+		if block := self.GetBlock(GetCanonicalHash(self.chainDb, number), number); block != nil {
+			return block
+		}
+	}
+	return self.genesisBlock
+}
+
+// statsIndexAligned reports whether every indexed block stats section is below
+// the head block and still canonical.
+func (self *BlockChain) statsIndexAligned(head uint64) bool {
+	sections := GetBlockStatsSections(self.chainDb)
+	return sections == 0 || self.statsSectionValid(sections-1, head)
+}
+
+// statsSectionValid reports whether a block stats section ends at or below the
+// head block with its last block canonical.
+func (self *BlockChain) statsSectionValid(section, head uint64) bool {
+	last := (section+1)*BlockStatsSectionSize - 1
+	if last > head {
+		return false
+	}
+	hash, _ := GetBlockStatsSection(self.chainDb, section)
+	return hash != (common.Hash{}) && self.isCanonical(hash, last)
+}
@@ -0,0 +1,96 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"testing"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/ethdb"
+	"github.com/ur-technology/go-ur/event"
+	"github.com/ur-technology/go-ur/params"
+)
+
+// Tests that the startup integrity check rewinds or advances the inconsistent
+// heads and the block stats index left by an unclean shutdown.
+func TestIntegrityCheck(t *testing.T) {
+	var (
+		db, _    = ethdb.NewMemDatabase()
+		gendb, _ = ethdb.NewMemDatabase()
+		genesis  = WriteGenesisBlockForTesting(db)
+	)
+	WriteGenesisBlockForTesting(gendb)
+	blocks, _ := GenerateChain(params.TestChainConfig, nil, genesis, gendb, 5, nil)
+	forks, _ := GenerateChain(params.TestChainConfig, nil, blocks[1], gendb, 2, func(i int, gen *BlockGen) {
+		gen.SetCoinbase(common.Address{0x01})
+	})
+	blockchain, _ := NewBlockChain(db, params.TestChainConfig, FakePow{}, new(event.TypeMux))
+	if _, err := blockchain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	if _, err := blockchain.InsertChain(forks); err != nil {
+		t.Fatalf("failed to insert fork: %v", err)
+	}
+	reopen := func() *BlockChain {
+		blockchain, err := NewBlockChain(db, params.TestChainConfig, FakePow{}, new(event.TypeMux))
+		if err != nil {
+			t.Fatalf("failed to reopen chain: %v", err)
+		}
+		return blockchain
+	}
+	check := func(blockchain *BlockChain, header, block, fast *types.Block) {
+		if have := blockchain.CurrentHeader().Hash(); have != header.Hash() {
+			t.Errorf("head header mismatch: have %x, want #%d [%x]", have, header.Number(), header.Hash())
+		}
+		if have := blockchain.CurrentBlock().Hash(); have != block.Hash() {
+			t.Errorf("head block mismatch: have %x, want #%d [%x]", have, block.Number(), block.Hash())
+		}
+		if have := blockchain.CurrentFastBlock().Hash(); have != fast.Hash() {
+			t.Errorf("head fast block mismatch: have %x, want #%d [%x]", have, fast.Number(), fast.Hash())
+		}
+		if GetHeadHeaderHash(db) != header.Hash() || GetHeadBlockHash(db) != block.Hash() || GetHeadFastBlockHash(db) != fast.Hash() {
+			t.Errorf("repaired heads not persisted")
+		}
+	}
+	// A consistent database is left untouched
+	check(reopen(), blocks[4], blocks[4], blocks[4])
+
+	// A head block on a side chain is rewound to the fork point
+	WriteHeadBlockHash(db, forks[1].Hash())
+	check(reopen(), blocks[4], blocks[1], blocks[4])
+
+	// A head header lagging behind the canonical head block is advanced
+	WriteHeadBlockHash(db, blocks[4].Hash())
+	WriteHeadHeaderHash(db, blocks[2].Hash())
+	check(reopen(), blocks[4], blocks[4], blocks[4])
+
+	// A missing head block is rebuilt from the header chain
+	WriteHeadBlockHash(db, common.Hash{0x01})
+	check(reopen(), blocks[4], blocks[4], blocks[4])
+
+	// A head fast block on a side chain is reset to the head block
+	WriteHeadFastBlockHash(db, forks[1].Hash())
+	check(reopen(), blocks[4], blocks[4], blocks[4])
+
+	// A block stats index reaching past the head block is rolled back
+	WriteBlockStatsSections(db, 1)
+	reopen()
+	if sections := GetBlockStatsSections(db); sections != 0 {
+		t.Errorf("block stats sections mismatch: have %d, want 0", sections)
+	}
+}
@@ -24,11 +24,13 @@ import (
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/hashicorp/golang-lru"
 	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/consensus"
 	"github.com/ur-technology/go-ur/core/state"
 	"github.com/ur-technology/go-ur/core/types"
 	"github.com/ur-technology/go-ur/core/vm"
@@ -36,7 +38,6 @@ import (
 	"github.com/ur-technology/go-ur/ethdb"
 	"github.com/ur-technology/go-ur/event"
 	"github.com/ur-technology/go-ur/params"
-	"github.com/ur-technology/go-ur/pow"
 	"github.com/ur-technology/go-ur/rlp"
 	"github.com/ur-technology/urhash"
 )
@@ -45,9 +46,9 @@ func init() {
 	runtime.GOMAXPROCS(runtime.NumCPU())
 }
 
-func thePow() pow.PoW {
+func thePow() consensus.Engine {
 	pow, _ := urhash.NewForTesting()
-	return pow
+	return NewPowEngine(pow)
 }
 
 func theBlockChain(db ethdb.Database, t *testing.T) *BlockChain {
@@ -474,17 +475,20 @@ func chm(genesis *types.Block, db ethdb.Database) *BlockChain {
 	var eventMux event.TypeMux
 	bc := &BlockChain{
 		chainDb:      db,
+		stateDb:      db,
 		genesisBlock: genesis,
 		eventMux:     &eventMux,
-		pow:          FakePow{},
+		engine:       FakePow{},
 		config:       testChainConfig(),
+		cacheConfig:  new(BlockChainConfig),
 	}
 	valFn := func() HeaderValidator { return bc.Validator() }
-	bc.hc, _ = NewHeaderChain(db, testChainConfig(), valFn, bc.getProcInterrupt)
+	bc.hc, _ = NewHeaderChain(db, testChainConfig(), PowConfig{}, valFn, bc.getProcInterrupt)
 	bc.bodyCache, _ = lru.New(100)
 	bc.bodyRLPCache, _ = lru.New(100)
 	bc.blockCache, _ = lru.New(100)
 	bc.futureBlocks, _ = lru.New(100)
+	bc.badBlocks, _ = lru.New(100)
 	bc.SetValidator(bproc{})
 	bc.SetProcessor(bproc{})
 	bc.ResetWithGenesisBlock(genesis)
@@ -553,6 +557,63 @@ func testReorg(t *testing.T, first, second []int, td int64, full bool) {
 	}
 }
 
+// Tests that a finalized checkpoint is never reorganised past, while reorgs on
+// top of it are still accepted.
+func TestFinalizedReorg(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	genesis, _ := WriteTestNetGenesisBlock(db)
+	bc := chm(genesis, db)
+
+	easy := makeBlockChainWithDiff(genesis, []int{1, 2, 3, 4}, 11)
+	if _, err := bc.InsertChain(easy); err != nil {
+		t.Fatalf("failed to insert easy chain: %v", err)
+	}
+	// Only canonical blocks may be finalized
+	if err := bc.SetFinalized(5, common.Hash{}); err == nil {
+		t.Errorf("finalized block above the head")
+	}
+	if err := bc.SetFinalized(2, easy[0].Hash()); err == nil {
+		t.Errorf("finalized non-canonical hash")
+	}
+	if err := bc.SetFinalized(2, easy[1].Hash()); err != nil {
+		t.Fatalf("failed to finalize checkpoint: %v", err)
+	}
+	// Older checkpoints are ignored
+	if err := bc.SetFinalized(1, easy[0].Hash()); err != nil {
+		t.Errorf("failed to ignore older checkpoint: %v", err)
+	}
+	if number, hash := bc.Finalized(); number != 2 || hash != easy[1].Hash() {
+		t.Errorf("finalized checkpoint mismatch: have #%d [%x], want #2 [%x]", number, hash, easy[1].Hash())
+	}
+	// A more difficult chain forking below the checkpoint must be refused
+	if _, err := bc.InsertChain(makeBlockChainWithDiff(genesis, []int{1, 10}, 22)); err == nil || !strings.Contains(err.Error(), ErrFinalizedReorg.Error()) {
+		t.Errorf("reorg past checkpoint error mismatch: have %v, want %v", err, ErrFinalizedReorg)
+	}
+	if head := bc.CurrentBlock(); head.Hash() != easy[3].Hash() {
+		t.Errorf("head mismatch: have #%d [%x], want #4 [%x]", head.NumberU64(), head.Hash(), easy[3].Hash())
+	}
+	// A more difficult chain forking at the checkpoint must be accepted
+	fork := types.NewBlockWithHeader(&types.Header{
+		ParentHash:  easy[1].Hash(),
+		Coinbase:    common.Address{33},
+		Number:      big.NewInt(3),
+		Difficulty:  big.NewInt(10),
+		UncleHash:   types.EmptyUncleHash,
+		TxHash:      types.EmptyRootHash,
+		ReceiptHash: types.EmptyRootHash,
+	})
+	if _, err := bc.InsertChain(types.Blocks{fork}); err != nil {
+		t.Fatalf("failed to reorg above checkpoint: %v", err)
+	}
+	if head := bc.CurrentBlock(); head.Hash() != fork.Hash() {
+		t.Errorf("head mismatch: have #%d [%x], want #3 [%x]", head.NumberU64(), head.Hash(), fork.Hash())
+	}
+	// The checkpoint must survive a restart
+	if number, hash := GetFinalizedCheckpoint(db); number != 2 || hash != easy[1].Hash() {
+		t.Errorf("stored checkpoint mismatch: have #%d [%x], want #2 [%x]", number, hash, easy[1].Hash())
+	}
+}
+
 // Tests that the insertion functions detect banned hashes.
 func TestBadHeaderHashes(t *testing.T) { testBadHashes(t, false) }
 func TestBadBlockHashes(t *testing.T)  { testBadHashes(t, true) }
@@ -657,7 +718,7 @@ func testInsertNonceError(t *testing.T, full bool) {
 			failNum = blocks[failAt].NumberU64()
 			failHash = blocks[failAt].Hash()
 
-			blockchain.pow = failPow{failNum}
+			blockchain.engine = NewPowEngine(failPow{failNum})
 
 			failRes, err = blockchain.InsertChain(blocks)
 		} else {
@@ -667,8 +728,8 @@ func testInsertNonceError(t *testing.T, full bool) {
 			failNum = headers[failAt].Number.Uint64()
 			failHash = headers[failAt].Hash()
 
-			blockchain.pow = failPow{failNum}
-			blockchain.validator = NewBlockValidator(testChainConfig(), blockchain, failPow{failNum})
+			blockchain.engine = NewPowEngine(failPow{failNum})
+			blockchain.validator = NewBlockValidator(testChainConfig(), blockchain, blockchain.engine)
 
 			failRes, err = blockchain.InsertHeaderChain(headers, 1)
 		}
@@ -1296,3 +1357,191 @@ func TestEIP161AccountRemoval(t *testing.T) {
 		t.Error("account should not expect")
 	}
 }
+
+// Tests that once the chain's gas price floor activates, blocks carrying
+// transactions that undercut it are rejected.
+func TestMinGasPriceFloor(t *testing.T) {
+	var (
+		key, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr   = crypto.PubkeyToAddress(key.PublicKey)
+		db, _  = ethdb.NewMemDatabase()
+		signer = types.NewEIP155Signer(big.NewInt(1))
+	)
+	config := *params.TestChainConfig
+	config.MinGasPriceBlock = big.NewInt(2)
+	config.MinGasPrice = big.NewInt(1)
+
+	genesis := WriteGenesisBlockForTesting(db, GenesisAccount{addr, big.NewInt(1000000)})
+	blockchain, _ := NewBlockChain(db, &config, FakePow{}, new(event.TypeMux))
+
+	chain, _ := GenerateChain(&config, blockchain, genesis, db, 2, func(i int, gen *BlockGen) {
+		tx, _ := types.NewTransaction(gen.TxNonce(addr), addr, big.NewInt(1000), params.TxGas, new(big.Int), nil).SignECDSA(signer, key)
+		gen.AddTx(tx)
+	})
+	if _, err := blockchain.InsertChain(chain[:1]); err != nil {
+		t.Fatalf("failed to insert block before the floor: %v", err)
+	}
+	if _, err := blockchain.InsertChain(chain[1:]); !IsValidationErr(err) {
+		t.Fatalf("expected validation error for block under the floor, got %v", err)
+	}
+}
+
+// Tests that in full gc mode only every TrieCommitInterval-th head state is
+// written to disk, that the head state is persisted on shutdown and that after a
+// crash the head is rewound to the last block with its state on disk.
+func TestTrieCacheGC(t *testing.T) {
+	var (
+		db, _    = ethdb.NewMemDatabase()
+		gendb, _ = ethdb.NewMemDatabase()
+		genesis  = WriteGenesisBlockForTesting(db)
+		config   = &BlockChainConfig{TrieCacheLimit: 16, TrieCommitInterval: 4}
+	)
+	WriteGenesisBlockForTesting(gendb)
+	blocks, _ := GenerateChain(params.TestChainConfig, nil, genesis, gendb, 10, nil)
+
+	blockchain, _ := NewBlockChainWithConfig(db, params.TestChainConfig, config, FakePow{}, new(event.TypeMux))
+	if _, err := blockchain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	for i, block := range blocks {
+		_, err := state.New(block.Root(), db)
+		if ondisk := (i+1)%4 == 0; ondisk != (err == nil) {
+			t.Errorf("block #%d: state on disk mismatch: have %v, want %v", i+1, err == nil, ondisk)
+		}
+		if !blockchain.HasBlockAndState(block.Hash()) {
+			t.Errorf("block #%d: state missing", i+1)
+		}
+	}
+	// Simulate a crash, the head must be rewound to the last committed state
+	blockchain, _ = NewBlockChainWithConfig(db, params.TestChainConfig, config, FakePow{}, new(event.TypeMux))
+	if head := blockchain.CurrentBlock().NumberU64(); head != 8 {
+		t.Fatalf("head mismatch after crash: have #%d, want #8", head)
+	}
+	if _, err := blockchain.InsertChain(blocks[8:]); err != nil {
+		t.Fatalf("failed to reinsert blocks: %v", err)
+	}
+	// Cleanly stop, the head state must be persisted
+	blockchain.Stop()
+	if _, err := state.New(blocks[9].Root(), db); err != nil {
+		t.Fatalf("head state not persisted on shutdown: %v", err)
+	}
+	blockchain, _ = NewBlockChainWithConfig(db, params.TestChainConfig, config, FakePow{}, new(event.TypeMux))
+	if head := blockchain.CurrentBlock().NumberU64(); head != 10 {
+		t.Fatalf("head mismatch after restart: have #%d, want #10", head)
+	}
+}
+
+// Tests that blocks rejected during import are kept for inspection, and that the
+// chain can be rewound and re-extended past them.
+func TestBadBlockTracking(t *testing.T) {
+	var (
+		db, _    = ethdb.NewMemDatabase()
+		gendb, _ = ethdb.NewMemDatabase()
+		genesis  = WriteGenesisBlockForTesting(db)
+	)
+	WriteGenesisBlockForTesting(gendb)
+	blocks, _ := GenerateChain(params.TestChainConfig, nil, genesis, gendb, 5, nil)
+
+	blockchain, _ := NewBlockChain(db, params.TestChainConfig, FakePow{}, new(event.TypeMux))
+	if _, err := blockchain.InsertChain(blocks[:3]); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	// Corrupt the state root of the next block and try to import it
+	header := blocks[3].Header()
+	header.Root = common.Hash{0x01}
+	bad := types.NewBlockWithHeader(header).WithBody(blocks[3].Transactions(), blocks[3].Uncles())
+
+	if _, err := blockchain.InsertChain(types.Blocks{bad}); err == nil {
+		t.Fatalf("bad block accepted")
+	}
+	badBlocks := blockchain.BadBlocks()
+	if len(badBlocks) != 1 {
+		t.Fatalf("bad block count mismatch: have %d, want 1", len(badBlocks))
+	}
+	if badBlocks[0].Block.Hash() != bad.Hash() || badBlocks[0].Err == nil {
+		t.Errorf("bad block mismatch: have %x (%v), want %x", badBlocks[0].Block.Hash(), badBlocks[0].Err, bad.Hash())
+	}
+	// Rewind past the last good block and import the good chain again
+	blockchain.SetHead(1)
+	if head := blockchain.CurrentBlock().NumberU64(); head != 1 {
+		t.Fatalf("head mismatch after rewind: have #%d, want #1", head)
+	}
+	if _, err := blockchain.InsertChain(blocks[1:]); err != nil {
+		t.Fatalf("failed to reinsert chain: %v", err)
+	}
+	if head := blockchain.CurrentBlock().Hash(); head != blocks[4].Hash() {
+		t.Errorf("head mismatch after reinsert: have %x, want %x", head, blocks[4].Hash())
+	}
+}
+
+// Tests that the transaction lookups of the blocks older than the configured
+// limit are removed, that disabling them stops indexing new blocks, and that
+// raising or lifting the limit restores them.
+func TestTxLookupLimit(t *testing.T) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr    = crypto.PubkeyToAddress(key.PublicKey)
+		db, _   = ethdb.NewMemDatabase()
+		genesis = WriteGenesisBlockForTesting(db, GenesisAccount{addr, big.NewInt(1000000)})
+		signer  = types.NewEIP155Signer(big.NewInt(1))
+		config  = new(BlockChainConfig)
+	)
+	blockchain, _ := NewBlockChainWithConfig(db, testChainConfig(), config, FakePow{}, new(event.TypeMux))
+	defer blockchain.Stop()
+
+	blocks, _ := GenerateChain(params.TestChainConfig, blockchain, genesis, db, 12, func(i int, gen *BlockGen) {
+		tx, _ := types.NewTransaction(gen.TxNonce(addr), common.Address{0x01}, big.NewInt(1), params.TxGas, nil, nil).SignECDSA(signer, key)
+		gen.AddTx(tx)
+	})
+	indexed := func(block *types.Block) bool {
+		tx, _, _, _ := GetTransaction(db, block.Transactions()[0].Hash())
+		return tx != nil
+	}
+	config.TxLookupLimit = 4
+	if _, err := blockchain.InsertChain(blocks[:10]); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	// Only the lookups of the four most recent blocks, #7-#10, must be kept
+	blockchain.updateTxLookups()
+	for i, block := range blocks[:10] {
+		if have, want := indexed(block), block.NumberU64() >= 7; have != want {
+			t.Errorf("block #%d: lookup presence mismatch: have %v, want %v", i+1, have, want)
+		}
+	}
+	if tail := GetTxLookupTail(db); tail != 7 {
+		t.Errorf("lookup tail mismatch: have %d, want 7", tail)
+	}
+	// Disabling the lookups must stop indexing and remove the remaining ones
+	config.TxLookupLimit = -1
+	if _, err := blockchain.InsertChain(blocks[10:]); err != nil {
+		t.Fatalf("failed to extend chain: %v", err)
+	}
+	blockchain.updateTxLookups()
+	for i, block := range blocks {
+		if indexed(block) {
+			t.Errorf("block #%d: lookup retained with lookups disabled", i+1)
+		}
+	}
+	// Raising the limit must restore the lookups of the blocks within it
+	config.TxLookupLimit = 5
+	blockchain.updateTxLookups()
+	for i, block := range blocks {
+		if have, want := indexed(block), block.NumberU64() >= 8; have != want {
+			t.Errorf("block #%d: lookup presence mismatch after raise: have %v, want %v", i+1, have, want)
+		}
+	}
+	if tail := GetTxLookupTail(db); tail != 8 {
+		t.Errorf("lookup tail mismatch after raise: have %d, want 8", tail)
+	}
+	// Lifting the limit must restore the lookups of the entire chain
+	config.TxLookupLimit = 0
+	blockchain.updateTxLookups()
+	for i, block := range blocks {
+		if !indexed(block) {
+			t.Errorf("block #%d: lookup missing with the limit lifted", i+1)
+		}
+	}
+	if tail := GetTxLookupTail(db); tail != 0 {
+		t.Errorf("lookup tail mismatch with the limit lifted: have %d, want 0", tail)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core/bloombits"
+	"github.com/ur-technology/go-ur/ethdb"
+)
+
+const (
+	// BloomBitsSectionSize is the number of blocks of a bloom bits section.
+	BloomBitsSectionSize = 4096
+
+	// bloomBitsConfirms is the number of blocks a section must be below the
+	// chain head before being indexed, so that reorgs rarely invalidate it.
+	bloomBitsConfirms = 256
+)
+
+// BloomIndexer builds the bloom bits sections of the canonical chain in the
+// background, rotating the header blooms of each section of blocks into one
+// bit vector per bloom bit for fast log filtering over large ranges.
+type BloomIndexer struct {
+	*ChainIndexer
+	db ethdb.Database
+}
+
+// NewBloomIndexer creates an indexer over the canonical chain of the database,
+// resuming from the sections stored by a previous run.
+func NewBloomIndexer(db ethdb.Database) *BloomIndexer {
+	return newBloomIndexer(db, BloomBitsSectionSize, bloomBitsConfirms)
+}
+
+// newBloomIndexer creates an indexer with custom section size and confirmation
+// count, allowing tests to work with short chains.
+func newBloomIndexer(db ethdb.Database, sectionSize, confirms uint64) *BloomIndexer {
+	backend := &bloomIndexerBackend{db: db, sectionSize: sectionSize}
+	return &BloomIndexer{
+		ChainIndexer: NewChainIndexer(db, backend, "bloom bits", sectionSize, confirms),
+		db:           db,
+	}
+}
+
+// BloomBits returns the bit vector of a bloom bit over an indexed section, the
+// bit of the i-th block of the section being the bit 7-i%8 of the byte i/8.
+func (b *BloomIndexer) BloomBits(bit uint, section uint64) ([]byte, error) {
+	size, sections := b.Status()
+	if section >= sections {
+		return nil, fmt.Errorf("section %d not indexed", section)
+	}
+	blob := GetBloomBits(b.db, bit, section)
+	if len(blob) == 0 {
+		return nil, fmt.Errorf("bloom bits of bit %d, section %d missing", bit, section)
+	}
+	return bloombits.DecompressVector(blob, int(size/8))
+}
+
+// bloomIndexerBackend rotates the header blooms of a section into bit vectors.
+type bloomIndexerBackend struct {
+	db          ethdb.Database
+	sectionSize uint64
+	gen         *bloombits.Generator
+}
+
+func (b *bloomIndexerBackend) Sections() uint64 {
+	return GetBloomBitsSections(b.db)
+}
+
+func (b *bloomIndexerBackend) SetSections(sections uint64) error {
+	return WriteBloomBitsSections(b.db, sections)
+}
+
+func (b *bloomIndexerBackend) SectionHead(section uint64) common.Hash {
+	return GetBloomBitsHead(b.db, section)
+}
+
+func (b *bloomIndexerBackend) Reset(section uint64) (err error) {
+	b.gen, err = bloombits.NewGenerator(uint(b.sectionSize))
+	return err
+}
+
+func (b *bloomIndexerBackend) Process(number uint64, hash common.Hash) error {
+	header := GetHeader(b.db, hash, number)
+	if header == nil {
+		return fmt.Errorf("header #%d [%x…] missing", number, hash[:4])
+	}
+	return b.gen.AddBloom(uint(number%b.sectionSize), header.Bloom)
+}
+
+func (b *bloomIndexerBackend) Commit(section uint64, head common.Hash) error {
+	vectors := make([][]byte, bloombits.BloomBitLength)
+	for bit := range vectors {
+		vector, err := b.gen.Vector(uint(bit))
+		if err != nil {
+			return err
+		}
+		vectors[bit] = bloombits.CompressVector(vector)
+	}
+	return WriteBloomBitsSection(b.db, section, head, vectors)
+}
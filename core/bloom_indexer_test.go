@@ -0,0 +1,105 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/core/vm"
+	"github.com/ur-technology/go-ur/ethdb"
+	"github.com/ur-technology/go-ur/params"
+)
+
+// Tests that the bloom indexer builds the confirmed sections of the canonical
+// chain and rolls back the sections reorged out of it.
+func TestBloomIndexer(t *testing.T) {
+	var (
+		db, _    = ethdb.NewMemDatabase()
+		gendb, _ = ethdb.NewMemDatabase()
+		genesis  = WriteGenesisBlockForTesting(db)
+	)
+	WriteGenesisBlockForTesting(gendb)
+
+	// Generate a chain logging from a different address in every block, and a
+	// fork of it overtaking it in the third section
+	logging := func(seed byte) func(int, *BlockGen) {
+		return func(i int, gen *BlockGen) {
+			receipt := types.NewReceipt(nil, new(big.Int))
+			receipt.Logs = vm.Logs{&vm.Log{Address: common.Address{seed, byte(i)}}}
+			receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+			gen.AddUncheckedReceipt(receipt)
+		}
+	}
+	blocks, _ := GenerateChain(params.TestChainConfig, nil, genesis, gendb, 40, logging(1))
+	fork, _ := GenerateChain(params.TestChainConfig, nil, blocks[19], gendb, 25, logging(2))
+
+	canonize := func(blocks []*types.Block) {
+		for _, block := range blocks {
+			WriteBlock(db, block)
+			WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+			WriteHeadBlockHash(db, block.Hash())
+		}
+	}
+	check := func(indexer *BloomIndexer, sections uint64) {
+		for {
+			indexed, err := indexer.update()
+			if err != nil {
+				t.Fatalf("failed to update index: %v", err)
+			}
+			if !indexed {
+				break
+			}
+		}
+		if _, have := indexer.Status(); have != sections {
+			t.Fatalf("section count mismatch: have %d, want %d", have, sections)
+		}
+		for number := uint64(0); number < sections*8; number++ {
+			header := GetHeader(db, GetCanonicalHash(db, number), number)
+			for bit := uint(0); bit < 2048; bit++ {
+				vector, err := indexer.BloomBits(bit, number/8)
+				if err != nil {
+					t.Fatalf("block %d, bit %d: failed to retrieve bloom bits: %v", number, bit, err)
+				}
+				want := header.Bloom[255-bit/8]&(1<<(bit%8)) != 0
+				if have := vector[(number%8)/8]&(0x80>>(number%8)) != 0; have != want {
+					t.Fatalf("block %d, bit %d: bloom bit mismatch: have %v, want %v", number, bit, have, want)
+				}
+			}
+		}
+	}
+	// Index the confirmed sections of the chain: blocks #0-#31 with the head at #40
+	canonize(blocks)
+	indexer := newBloomIndexer(db, 8, 4)
+	check(indexer, 4)
+
+	if _, err := indexer.BloomBits(0, 4); err == nil {
+		t.Errorf("unindexed section retrieved")
+	}
+	// Reorg the chain from block #21, the second half of the index must be rebuilt
+	canonize(fork)
+	check(indexer, 5)
+	if head := GetBloomBitsHead(db, 2); head != fork[2].Hash() {
+		t.Errorf("section head mismatch: have %x, want %x", head, fork[2].Hash())
+	}
+	// The sections must be resumed by a new indexer
+	if _, sections := newBloomIndexer(db, 8, 4).Status(); sections != 5 {
+		t.Errorf("resumed section count mismatch: have %d, want 5", sections)
+	}
+}
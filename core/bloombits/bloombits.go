@@ -0,0 +1,242 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package bloombits implements log filtering over whole sections of blocks at
+// once. The header blooms of a section are rotated into one bit vector per bloom
+// bit, holding that bit of every block of the section, so that the blocks which
+// may contain a value are found with three vector ANDs instead of testing the
+// bloom of every block.
+package bloombits
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/crypto"
+)
+
+const (
+	// BloomByteLength is the number of bytes of a header bloom.
+	BloomByteLength = 256
+
+	// BloomBitLength is the number of bits of a header bloom.
+	BloomBitLength = 8 * BloomByteLength
+)
+
+var (
+	// errSectionSize is returned if the section size is not a multiple of 8.
+	errSectionSize = errors.New("section size must be a multiple of 8")
+
+	// errSectionOutOfBounds is returned if a bloom is added beyond the section.
+	errSectionOutOfBounds = errors.New("section out of bounds")
+
+	// errOutOfOrder is returned if blooms are not added in order.
+	errOutOfOrder = errors.New("bloom added out of order")
+
+	// errInvalidVector is returned when decoding a malformed bit vector.
+	errInvalidVector = errors.New("invalid bit vector")
+)
+
+// Generator rotates the header blooms of a section of blocks into bit vectors.
+type Generator struct {
+	vectors [BloomBitLength][]byte // Bit vectors being built, one per bloom bit
+	size    uint                   // Number of blocks in the section
+	next    uint                   // Index of the next bloom to add
+}
+
+// NewGenerator creates a generator for a section of the given number of blocks.
+func NewGenerator(size uint) (*Generator, error) {
+	if size%8 != 0 {
+		return nil, errSectionSize
+	}
+	g := &Generator{size: size}
+	for i := range g.vectors {
+		g.vectors[i] = make([]byte, size/8)
+	}
+	return g, nil
+}
+
+// AddBloom adds the header bloom of the index-th block of the section. Blooms
+// must be added in order.
+func (g *Generator) AddBloom(index uint, bloom types.Bloom) error {
+	if index >= g.size {
+		return errSectionOutOfBounds
+	}
+	if index != g.next {
+		return errOutOfOrder
+	}
+	var (
+		byteIndex = index / 8
+		bitMask   = byte(1) << byte(7-index%8)
+	)
+	for bit := uint(0); bit < BloomBitLength; bit++ {
+		if bloomBit(bloom, bit) {
+			g.vectors[bit][byteIndex] |= bitMask
+		}
+	}
+	g.next++
+	return nil
+}
+
+// Vector returns the bit vector of the given bloom bit, once all blooms of the
+// section have been added.
+func (g *Generator) Vector(bit uint) ([]byte, error) {
+	if g.next != g.size {
+		return nil, errors.New("section incomplete")
+	}
+	if bit >= BloomBitLength {
+		return nil, errors.New("bloom bit out of bounds")
+	}
+	return g.vectors[bit], nil
+}
+
+// bloomBit reports whether the given bit of a header bloom is set, bits being
+// numbered as in the big endian integer form of the bloom.
+func bloomBit(bloom types.Bloom, bit uint) bool {
+	return bloom[BloomByteLength-1-bit/8]&(1<<(bit%8)) != 0
+}
+
+// BloomIndexes returns the three bloom bits set by a value.
+func BloomIndexes(data []byte) [3]uint {
+	hash := crypto.Keccak256(data)
+
+	var idxs [3]uint
+	for i := range idxs {
+		idxs[i] = (uint(hash[2*i])<<8 | uint(hash[2*i+1])) & (BloomBitLength - 1)
+	}
+	return idxs
+}
+
+// CompressVector encodes a bit vector for storage. Vectors are mostly sparse, so
+// those with few bits set are stored as the list of their set bit positions.
+func CompressVector(vector []byte) []byte {
+	var positions []byte
+	for i, b := range vector {
+		for j := uint(0); b != 0 && j < 8; j++ {
+			if b&(0x80>>j) != 0 {
+				positions = append(positions, 0, 0, 0, 0)
+				binary.BigEndian.PutUint32(positions[len(positions)-4:], uint32(i)*8+uint32(j))
+			}
+		}
+		if len(positions) >= len(vector) {
+			return append([]byte{0}, vector...)
+		}
+	}
+	return append([]byte{1}, positions...)
+}
+
+// DecompressVector decodes a stored bit vector of the given length in bytes.
+func DecompressVector(blob []byte, length int) ([]byte, error) {
+	if len(blob) == 0 {
+		return nil, errInvalidVector
+	}
+	switch blob[0] {
+	case 0:
+		if len(blob)-1 != length {
+			return nil, errInvalidVector
+		}
+		return blob[1:], nil
+	case 1:
+		if (len(blob)-1)%4 != 0 {
+			return nil, errInvalidVector
+		}
+		vector := make([]byte, length)
+		for i := 1; i < len(blob); i += 4 {
+			pos := binary.BigEndian.Uint32(blob[i:])
+			if int(pos/8) >= length {
+				return nil, errInvalidVector
+			}
+			vector[pos/8] |= 0x80 >> (pos % 8)
+		}
+		return vector, nil
+	}
+	return nil, errInvalidVector
+}
+
+// Matcher finds the blocks of a section whose blooms match a filter made of
+// groups of values: a block matches if, for every group, its bloom contains any
+// of the values of the group.
+type Matcher struct {
+	groups [][][3]uint // Bloom bits of the values of each group
+}
+
+// NewMatcher creates a matcher of the given value groups. Empty groups, which
+// match anything, are ignored.
+func NewMatcher(groups [][][]byte) *Matcher {
+	m := new(Matcher)
+	for _, group := range groups {
+		if len(group) == 0 {
+			continue
+		}
+		idxs := make([][3]uint, len(group))
+		for i, value := range group {
+			idxs[i] = BloomIndexes(value)
+		}
+		m.groups = append(m.groups, idxs)
+	}
+	return m
+}
+
+// Empty reports whether the matcher has no groups and thus matches every block.
+func (m *Matcher) Empty() bool {
+	return len(m.groups) == 0
+}
+
+// Match returns the bit vector of the blocks of a section which may match the
+// filter, retrieving the bit vectors of the section through vector.
+func (m *Matcher) Match(length int, vector func(bit uint) ([]byte, error)) ([]byte, error) {
+	cache := make(map[uint][]byte)
+	fetch := func(bit uint) ([]byte, error) {
+		if v, ok := cache[bit]; ok {
+			return v, nil
+		}
+		v, err := vector(bit)
+		if err != nil {
+			return nil, err
+		}
+		if len(v) != length {
+			return nil, errInvalidVector
+		}
+		cache[bit] = v
+		return v, nil
+	}
+	result := make([]byte, length)
+	for i := range result {
+		result[i] = 0xff
+	}
+	for _, group := range m.groups {
+		any := make([]byte, length)
+		for _, idxs := range group {
+			all := make([]byte, length)
+			copy(all, result)
+			for _, bit := range idxs {
+				v, err := fetch(bit)
+				if err != nil {
+					return nil, err
+				}
+				for i := range all {
+					all[i] &= v[i]
+				}
+			}
+			for i := range any {
+				any[i] |= all[i]
+			}
+		}
+		result = any
+	}
+	return result, nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package bloombits
+
+import (
+	"bytes"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/ur-technology/go-ur/core/types"
+)
+
+// Tests that the bit vectors of a section and the matcher agree with testing
+// the blooms of the blocks one by one.
+func TestMatcher(t *testing.T) {
+	const size = 64
+
+	// Create blooms holding a few random values each, without leading zero bytes
+	// as those are dropped by the big integer bloom operations
+	values := make([][]byte, 32)
+	for i := range values {
+		values[i] = []byte{byte(i + 1), byte(i * 7)}
+	}
+	blooms := make([]types.Bloom, size)
+	for i := range blooms {
+		for j := 0; j < 3; j++ {
+			blooms[i].Add(new(big.Int).SetBytes(values[rand.Intn(len(values))]))
+		}
+	}
+	gen, err := NewGenerator(size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gen.AddBloom(1, blooms[1]); err != errOutOfOrder {
+		t.Errorf("out of order bloom error mismatch: have %v, want %v", err, errOutOfOrder)
+	}
+	for i, bloom := range blooms {
+		if err := gen.AddBloom(uint(i), bloom); err != nil {
+			t.Fatalf("bloom %d: failed to add: %v", i, err)
+		}
+	}
+	vector := func(bit uint) ([]byte, error) { return gen.Vector(bit) }
+
+	groups := [][][]byte{{values[0], values[1]}, nil, {values[2]}}
+	matches, err := NewMatcher(groups).Match(size/8, vector)
+	if err != nil {
+		t.Fatalf("failed to match: %v", err)
+	}
+	for i, bloom := range blooms {
+		want := (bloom.TestBytes(values[0]) || bloom.TestBytes(values[1])) && bloom.TestBytes(values[2])
+		if have := matches[i/8]&(0x80>>uint(i%8)) != 0; have != want {
+			t.Errorf("block %d: match mismatch: have %v, want %v", i, have, want)
+		}
+	}
+	if !NewMatcher([][][]byte{nil, {}}).Empty() {
+		t.Errorf("wildcard matcher not empty")
+	}
+}
+
+// Tests that sparse and dense bit vectors round trip through compression.
+func TestVectorCompression(t *testing.T) {
+	for _, set := range []int{0, 1, 5, 100, 512} {
+		vector := make([]byte, 512)
+		for i := 0; i < set; i++ {
+			vector[rand.Intn(len(vector))] |= 1 << uint(rand.Intn(8))
+		}
+		blob := CompressVector(vector)
+		if len(blob) > len(vector)+1 {
+			t.Errorf("%d bits: compressed size %d exceeds raw size", set, len(blob))
+		}
+		have, err := DecompressVector(blob, len(vector))
+		if err != nil {
+			t.Fatalf("%d bits: failed to decompress: %v", set, err)
+		}
+		if !bytes.Equal(have, vector) {
+			t.Errorf("%d bits: vector mismatch", set)
+		}
+	}
+	if _, err := DecompressVector([]byte{1, 0, 0, 16, 0}, 8); err != errInvalidVector {
+		t.Errorf("out of bounds position error mismatch: have %v, want %v", err, errInvalidVector)
+	}
+}
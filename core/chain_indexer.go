@@ -0,0 +1,203 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/ethdb"
+	"github.com/ur-technology/go-ur/logger"
+	"github.com/ur-technology/go-ur/logger/glog"
+)
+
+// chainIndexerRecheckInterval is the time between two indexing attempts once an
+// index caught up with the chain.
+const chainIndexerRecheckInterval = 10 * time.Second
+
+// errChainIndexerStopped is returned if an indexer is stopped mid-section.
+var errChainIndexerStopped = errors.New("chain indexer stopped")
+
+// ChainIndexerBackend generates and stores the sections of a chain index, the
+// ChainIndexer driving it over the confirmed canonical blocks.
+type ChainIndexerBackend interface {
+	// Sections returns the number of sections stored by the backend.
+	Sections() uint64
+
+	// SetSections stores the number of sections valid on the canonical chain.
+	SetSections(sections uint64) error
+
+	// SectionHead returns the hash of the last block of a stored section, or
+	// the zero hash if the section is missing.
+	SectionHead(section uint64) common.Hash
+
+	// Reset starts generating a new section.
+	Reset(section uint64) error
+
+	// Process adds the next canonical block to the section being generated.
+	Process(number uint64, hash common.Hash) error
+
+	// Commit stores the generated section, ending with the block of head.
+	Commit(section uint64, head common.Hash) error
+}
+
+// ChainIndexer builds an index of the canonical chain in sections of blocks in
+// the background, handing the blocks of each confirmed section to its backend
+// and rolling back the sections reorged out of the chain.
+type ChainIndexer struct {
+	db          ethdb.Database
+	backend     ChainIndexerBackend
+	kind        string // Name of the index in the logs
+	sectionSize uint64
+	confirms    uint64
+
+	sections uint64 // Number of sections indexed and valid on the canonical chain
+	lock     sync.RWMutex
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewChainIndexer creates an indexer over the canonical chain of the database,
+// resuming from the sections stored by the backend. A section is only indexed
+// once its last block is confirms blocks below the chain head.
+func NewChainIndexer(db ethdb.Database, backend ChainIndexerBackend, kind string, sectionSize, confirms uint64) *ChainIndexer {
+	return &ChainIndexer{
+		db:          db,
+		backend:     backend,
+		kind:        kind,
+		sectionSize: sectionSize,
+		confirms:    confirms,
+		sections:    backend.Sections(),
+		quit:        make(chan struct{}),
+	}
+}
+
+// Start spawns the indexing goroutine.
+func (c *ChainIndexer) Start() {
+	c.wg.Add(1)
+	go c.loop()
+}
+
+// Stop terminates the indexing goroutine, blocking until it returns.
+func (c *ChainIndexer) Stop() {
+	close(c.quit)
+	c.wg.Wait()
+}
+
+// Status returns the section size and the number of indexed sections.
+func (c *ChainIndexer) Status() (uint64, uint64) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.sectionSize, c.sections
+}
+
+// loop indexes sections until caught up with the chain, then waits for the
+// chain to advance before trying again.
+func (c *ChainIndexer) loop() {
+	defer c.wg.Done()
+
+	for {
+		indexed, err := c.update()
+		if err != nil && err != errChainIndexerStopped {
+			glog.V(logger.Error).Infof("Failed to index %s: %v", c.kind, err)
+		}
+		wait := chainIndexerRecheckInterval
+		if err == nil && indexed {
+			wait = 0
+		}
+		select {
+		case <-time.After(wait):
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// update discards the indexed sections reorged out of the canonical chain and
+// indexes the next section if confirmed. It reports whether a section was added.
+func (c *ChainIndexer) update() (bool, error) {
+	_, sections := c.Status()
+
+	// Roll back the sections whose last block isn't canonical any more
+	valid := sections
+	for valid > 0 {
+		last := valid*c.sectionSize - 1
+		if head := c.backend.SectionHead(valid - 1); head != (common.Hash{}) && head == GetCanonicalHash(c.db, last) {
+			break
+		}
+		valid--
+	}
+	if valid < sections {
+		glog.V(logger.Info).Infof("Rolled back %s index from %d to %d sections", c.kind, sections, valid)
+		if err := c.setSections(valid); err != nil {
+			return false, err
+		}
+	}
+	// Index the next section if it's deep enough below the chain head
+	head := GetBlockNumber(c.db, GetHeadBlockHash(c.db))
+	if head == missingNumber || head+1 < (valid+1)*c.sectionSize+c.confirms {
+		return false, nil
+	}
+	if err := c.index(valid); err != nil {
+		return false, err
+	}
+	return true, c.setSections(valid + 1)
+}
+
+// index feeds the canonical blocks of a section to the backend and stores it.
+func (c *ChainIndexer) index(section uint64) error {
+	if err := c.backend.Reset(section); err != nil {
+		return err
+	}
+	var hash common.Hash
+	for i := uint64(0); i < c.sectionSize; i++ {
+		number := section*c.sectionSize + i
+		if hash = GetCanonicalHash(c.db, number); hash == (common.Hash{}) {
+			return fmt.Errorf("canonical hash #%d missing", number)
+		}
+		if err := c.backend.Process(number, hash); err != nil {
+			return err
+		}
+		select {
+		case <-c.quit:
+			return errChainIndexerStopped
+		default:
+		}
+	}
+	if err := c.backend.Commit(section, hash); err != nil {
+		return err
+	}
+	glog.V(logger.Debug).Infof("Indexed %s section %d (#%d-#%d)", c.kind, section, section*c.sectionSize, (section+1)*c.sectionSize-1)
+	return nil
+}
+
+// setSections stores and publishes the number of valid sections.
+func (c *ChainIndexer) setSections(sections uint64) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := c.backend.SetSections(sections); err != nil {
+		return err
+	}
+	c.sections = sections
+	return nil
+}
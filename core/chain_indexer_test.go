@@ -0,0 +1,126 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/ethdb"
+	"github.com/ur-technology/go-ur/params"
+)
+
+// testIndexerBackend records the blocks handed to it per section.
+type testIndexerBackend struct {
+	sections uint64
+	heads    map[uint64]common.Hash
+	blocks   map[uint64][]uint64
+	pending  []uint64
+}
+
+func (b *testIndexerBackend) Sections() uint64 { return b.sections }
+
+func (b *testIndexerBackend) SetSections(sections uint64) error {
+	b.sections = sections
+	return nil
+}
+
+func (b *testIndexerBackend) SectionHead(section uint64) common.Hash { return b.heads[section] }
+
+func (b *testIndexerBackend) Reset(section uint64) error {
+	b.pending = nil
+	return nil
+}
+
+func (b *testIndexerBackend) Process(number uint64, hash common.Hash) error {
+	b.pending = append(b.pending, number)
+	return nil
+}
+
+func (b *testIndexerBackend) Commit(section uint64, head common.Hash) error {
+	b.heads[section], b.blocks[section] = head, b.pending
+	return nil
+}
+
+// Tests that the chain indexer hands the blocks of the confirmed sections to
+// its backend in order, and rebuilds the sections reorged out of the chain.
+func TestChainIndexer(t *testing.T) {
+	var (
+		db, _    = ethdb.NewMemDatabase()
+		gendb, _ = ethdb.NewMemDatabase()
+		genesis  = WriteGenesisBlockForTesting(db)
+	)
+	WriteGenesisBlockForTesting(gendb)
+
+	blocks, _ := GenerateChain(params.TestChainConfig, nil, genesis, gendb, 30, nil)
+	fork, _ := GenerateChain(params.TestChainConfig, nil, blocks[9], gendb, 20, func(i int, gen *BlockGen) {
+		gen.SetExtra([]byte("fork"))
+	})
+	for _, block := range blocks {
+		WriteBlock(db, block)
+		WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+		WriteHeadBlockHash(db, block.Hash())
+	}
+	backend := &testIndexerBackend{heads: make(map[uint64]common.Hash), blocks: make(map[uint64][]uint64)}
+	indexer := NewChainIndexer(db, backend, "test", 8, 4)
+
+	update := func(sections uint64) {
+		for {
+			indexed, err := indexer.update()
+			if err != nil {
+				t.Fatalf("failed to update index: %v", err)
+			}
+			if !indexed {
+				break
+			}
+		}
+		if _, have := indexer.Status(); have != sections {
+			t.Fatalf("section count mismatch: have %d, want %d", have, sections)
+		}
+		if backend.sections != sections {
+			t.Fatalf("stored section count mismatch: have %d, want %d", backend.sections, sections)
+		}
+		for section := uint64(0); section < sections; section++ {
+			var want []uint64
+			for number := 8 * section; number < 8*(section+1); number++ {
+				want = append(want, number)
+			}
+			if have := backend.blocks[section]; fmt.Sprint(have) != fmt.Sprint(want) {
+				t.Errorf("section %d blocks mismatch: have %v, want %v", section, have, want)
+			}
+			if head, want := backend.heads[section], GetCanonicalHash(db, 8*section+7); head != want {
+				t.Errorf("section %d head mismatch: have %x, want %x", section, head, want)
+			}
+		}
+	}
+	// Blocks #0-#23 are confirmed with the head at #30
+	update(3)
+
+	// Reorg from block #11, the sections from the second on must be rebuilt
+	for _, block := range fork {
+		WriteBlock(db, block)
+		WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+		WriteHeadBlockHash(db, block.Hash())
+	}
+	update(3)
+
+	// A new indexer resumes from the backend's sections
+	if _, sections := NewChainIndexer(db, backend, "test", 8, 4).Status(); sections != 3 {
+		t.Errorf("resumed section count mismatch: have %d, want 3", sections)
+	}
+}
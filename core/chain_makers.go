@@ -21,6 +21,7 @@ import (
 	"math/big"
 
 	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/consensus"
 	"github.com/ur-technology/go-ur/core/state"
 	"github.com/ur-technology/go-ur/core/types"
 	"github.com/ur-technology/go-ur/core/vm"
@@ -54,6 +55,19 @@ func (f FakePow) Verify(block pow.Block) bool { return true }
 func (f FakePow) GetHashrate() int64          { return 0 }
 func (f FakePow) Turbo(bool)                  {}
 
+// FakePow is also usable as a consensus engine, verifying headers without their
+// proof of work and finalizing blocks like the proof of work engine.
+func (f FakePow) VerifyHeader(chain consensus.ChainReader, header, parent *types.Header, seal, uncle bool) error {
+	return NewPowEngine(f).VerifyHeader(chain, header, parent, seal, uncle)
+}
+func (f FakePow) VerifySeal(header *types.Header) error { return nil }
+func (f FakePow) Finalize(chain consensus.ChainReader, statedb *state.StateDB, header *types.Header, uncles []*types.Header) {
+	NewPowEngine(f).Finalize(chain, statedb, header, uncles)
+}
+func (f FakePow) Seal(block *types.Block, stop <-chan struct{}, index int) (*types.Block, error) {
+	return NewPowEngine(f).Seal(block, stop, index)
+}
+
 // So we can deterministically seed different blockchains
 var (
 	canonicalSeed = 1
@@ -210,9 +224,9 @@ func GenerateChain(config *params.ChainConfig, blockchain *BlockChain, parent *t
 		if err != nil {
 			panic(err)
 		}
-		UpdateBlockTotals(parent.Header(), h, b.uncles, msgs)
+		UpdateBlockTotals(config, parent.Header(), h, b.uncles, msgs)
 
-		AccumulateRewards(statedb, h, b.uncles)
+		AccumulateRewards(config, statedb, h, b.uncles)
 		root, err := statedb.Commit(config.IsEIP158(h.Number))
 		if err != nil {
 			panic(fmt.Sprintf("state write error: %v", err))
@@ -17,12 +17,41 @@
 package core
 
 import (
-	"runtime"
-
+	"github.com/ur-technology/go-ur/common/workers"
+	"github.com/ur-technology/go-ur/consensus"
 	"github.com/ur-technology/go-ur/core/types"
-	"github.com/ur-technology/go-ur/pow"
 )
 
+// PowConfig contains the proof of work verification settings of a chain.
+type PowConfig struct {
+	// Verifiers is the number of concurrent workers verifying the proof of work
+	// of imported headers and blocks. Zero means the shared worker pool limit.
+	Verifiers int
+
+	// LightVerify enables the light verification mode, in which only a random
+	// sample of the headers of a synced batch (always including the last one)
+	// have their proof of work verified. It trades a little security for much
+	// less CPU spent during header sync and is meant for non-mining nodes. Full
+	// blocks are always verified.
+	LightVerify bool
+}
+
+// powLightVerifyFrequency is the average number of headers out of which one has
+// its proof of work verified in light verification mode.
+const powLightVerifyFrequency = 100
+
+// powVerifyWorkers returns the number of proof of work verifiers to use for a
+// batch of the given size, given the configured limit.
+func powVerifyWorkers(items, limit int) int {
+	if limit <= 0 {
+		return workers.Size(items)
+	}
+	if items < limit {
+		return items
+	}
+	return limit
+}
+
 // nonceCheckResult contains the result of a nonce verification.
 type nonceCheckResult struct {
 	index int  // Index of the item verified from an input array
@@ -32,40 +61,35 @@ type nonceCheckResult struct {
 // verifyNoncesFromHeaders starts a concurrent header nonce verification,
 // returning a quit channel to abort the operations and a results channel
 // to retrieve the async verifications.
-func verifyNoncesFromHeaders(checker pow.PoW, headers []*types.Header) (chan<- struct{}, <-chan nonceCheckResult) {
-	items := make([]pow.Block, len(headers))
-	for i, header := range headers {
-		items[i] = types.NewBlockWithHeader(header)
-	}
-	return verifyNonces(checker, items)
+func verifyNoncesFromHeaders(checker consensus.Engine, headers []*types.Header, limit int) (chan<- struct{}, <-chan nonceCheckResult) {
+	return verifyNonces(checker, headers, limit)
 }
 
 // verifyNoncesFromBlocks starts a concurrent block nonce verification,
 // returning a quit channel to abort the operations and a results channel
 // to retrieve the async verifications.
-func verifyNoncesFromBlocks(checker pow.PoW, blocks []*types.Block) (chan<- struct{}, <-chan nonceCheckResult) {
-	items := make([]pow.Block, len(blocks))
+func verifyNoncesFromBlocks(checker consensus.Engine, blocks []*types.Block, limit int) (chan<- struct{}, <-chan nonceCheckResult) {
+	items := make([]*types.Header, len(blocks))
 	for i, block := range blocks {
-		items[i] = block
+		items[i] = block.Header()
 	}
-	return verifyNonces(checker, items)
+	return verifyNonces(checker, items, limit)
 }
 
-// verifyNonces starts a concurrent nonce verification, returning a quit channel
-// to abort the operations and a results channel to retrieve the async checks.
-func verifyNonces(checker pow.PoW, items []pow.Block) (chan<- struct{}, <-chan nonceCheckResult) {
-	// Spawn as many workers as allowed threads
-	workers := runtime.GOMAXPROCS(0)
-	if len(items) < workers {
-		workers = len(items)
-	}
+// verifyNonces starts a concurrent nonce verification with at most limit
+// workers, returning a quit channel to abort the operations and a results
+// channel to retrieve the async checks.
+func verifyNonces(checker consensus.Engine, items []*types.Header, limit int) (chan<- struct{}, <-chan nonceCheckResult) {
+	// Spawn as many workers as configured
+	workers := powVerifyWorkers(len(items), limit)
+
 	// Create a task channel and spawn the verifiers
 	tasks := make(chan int, workers)
 	results := make(chan nonceCheckResult, len(items)) // Buffered to make sure all workers stop
 	for i := 0; i < workers; i++ {
 		go func() {
 			for index := range tasks {
-				results <- nonceCheckResult{index: index, valid: checker.Verify(items[index])}
+				results <- nonceCheckResult{index: index, valid: checker.VerifySeal(items[index]) == nil}
 			}
 		}()
 	}
@@ -25,6 +25,7 @@ import (
 	"github.com/ur-technology/go-ur/common"
 	"github.com/ur-technology/go-ur/core/types"
 	"github.com/ur-technology/go-ur/ethdb"
+	"github.com/ur-technology/go-ur/event"
 	"github.com/ur-technology/go-ur/params"
 	"github.com/ur-technology/go-ur/pow"
 )
@@ -75,13 +76,13 @@ func TestPowVerification(t *testing.T) {
 
 				switch {
 				case full && valid:
-					_, results = verifyNoncesFromBlocks(FakePow{}, []*types.Block{blocks[i]})
+					_, results = verifyNoncesFromBlocks(FakePow{}, []*types.Block{blocks[i]}, 0)
 				case full && !valid:
-					_, results = verifyNoncesFromBlocks(failPow{blocks[i].NumberU64()}, []*types.Block{blocks[i]})
+					_, results = verifyNoncesFromBlocks(NewPowEngine(failPow{blocks[i].NumberU64()}), []*types.Block{blocks[i]}, 0)
 				case !full && valid:
-					_, results = verifyNoncesFromHeaders(FakePow{}, []*types.Header{headers[i]})
+					_, results = verifyNoncesFromHeaders(FakePow{}, []*types.Header{headers[i]}, 0)
 				case !full && !valid:
-					_, results = verifyNoncesFromHeaders(failPow{headers[i].Number.Uint64()}, []*types.Header{headers[i]})
+					_, results = verifyNoncesFromHeaders(NewPowEngine(failPow{headers[i].Number.Uint64()}), []*types.Header{headers[i]}, 0)
 				}
 				// Wait for the verification result
 				select {
@@ -134,13 +135,13 @@ func testPowConcurrentVerification(t *testing.T, threads int) {
 
 			switch {
 			case full && valid:
-				_, results = verifyNoncesFromBlocks(FakePow{}, blocks)
+				_, results = verifyNoncesFromBlocks(FakePow{}, blocks, 0)
 			case full && !valid:
-				_, results = verifyNoncesFromBlocks(failPow{uint64(len(blocks) - 1)}, blocks)
+				_, results = verifyNoncesFromBlocks(NewPowEngine(failPow{uint64(len(blocks) - 1)}), blocks, 0)
 			case !full && valid:
-				_, results = verifyNoncesFromHeaders(FakePow{}, headers)
+				_, results = verifyNoncesFromHeaders(FakePow{}, headers, 0)
 			case !full && !valid:
-				_, results = verifyNoncesFromHeaders(failPow{uint64(len(headers) - 1)}, headers)
+				_, results = verifyNoncesFromHeaders(NewPowEngine(failPow{uint64(len(headers) - 1)}), headers, 0)
 			}
 			// Wait for all the verification results
 			checks := make(map[int]bool)
@@ -204,9 +205,9 @@ func testPowConcurrentAbortion(t *testing.T, threads int) {
 
 		// Start the verifications and immediately abort
 		if full {
-			abort, results = verifyNoncesFromBlocks(delayedPow{time.Millisecond}, blocks)
+			abort, results = verifyNoncesFromBlocks(NewPowEngine(delayedPow{time.Millisecond}), blocks, 0)
 		} else {
-			abort, results = verifyNoncesFromHeaders(delayedPow{time.Millisecond}, headers)
+			abort, results = verifyNoncesFromHeaders(NewPowEngine(delayedPow{time.Millisecond}), headers, 0)
 		}
 		close(abort)
 
@@ -232,3 +233,41 @@ func testPowConcurrentAbortion(t *testing.T, threads int) {
 		}
 	}
 }
+
+// Tests that in light verification mode only a sample of the synced headers,
+// always including the last one, have their proof of work verified, while
+// imported blocks are all verified.
+func TestPowLightVerification(t *testing.T) {
+	// Create a simple chain to verify
+	var (
+		gendb, _  = ethdb.NewMemDatabase()
+		genesis   = WriteGenesisBlockForTesting(gendb)
+		blocks, _ = GenerateChain(params.TestChainConfig, nil, genesis, gendb, 8, nil)
+		config    = &BlockChainConfig{Pow: PowConfig{LightVerify: true}}
+	)
+	headers := make([]*types.Header, len(blocks))
+	for i, block := range blocks {
+		headers[i] = block.Header()
+	}
+	newChain := func(failing uint64) *BlockChain {
+		db, _ := ethdb.NewMemDatabase()
+		WriteGenesisBlockForTesting(db)
+
+		chain, err := NewBlockChainWithConfig(db, params.TestChainConfig, config, NewPowEngine(failPow{failing}), new(event.TypeMux))
+		if err != nil {
+			t.Fatalf("failed to create chain: %v", err)
+		}
+		return chain
+	}
+	// A bad header within the batch is only sampled, the last one always checked
+	if _, err := newChain(4).InsertHeaderChain(headers, 1); err != nil {
+		t.Errorf("headers with a sampled out bad seal: insert failed: %v", err)
+	}
+	if _, err := newChain(8).InsertHeaderChain(headers, 1); err == nil {
+		t.Errorf("headers with a bad last seal: insert succeeded")
+	}
+	// Full blocks must all be verified regardless
+	if _, err := newChain(4).InsertChain(blocks); err == nil {
+		t.Errorf("blocks with a bad seal: insert succeeded")
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ur-technology/go-ur/common/workers"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/params"
+)
+
+// txCheckResult contains the result of pre-validating the transactions of a
+// block.
+type txCheckResult struct {
+	index int   // Index of the block verified from the input array
+	err   error // Error of the first invalid transaction, nil if all passed
+}
+
+// verifyTransactions starts the pre-validation of the transactions of the given
+// blocks, returning a quit channel to abort the operations and a results channel
+// to retrieve the async checks.
+//
+// Blocks are pre-validated in order, the transactions of every one of them
+// concurrently on the shared worker pool, so that checking a block overlaps with
+// the sequential state processing of the ones before it. Only the checks which
+// don't depend on the state are done, recovering the senders (which caches them
+// in the transactions) and verifying the intrinsic gas and gas limits. Any
+// transaction failing them would fail the state transition too, so the outcome
+// of importing a block is the same, only known before executing it.
+func verifyTransactions(config *params.ChainConfig, blocks types.Blocks) (chan<- struct{}, <-chan txCheckResult) {
+	abort := make(chan struct{})
+	results := make(chan txCheckResult, len(blocks)) // Buffered to make sure the checker stops
+
+	go func() {
+		for i, block := range blocks {
+			select {
+			case <-abort:
+				return
+			default:
+			}
+			results <- txCheckResult{index: i, err: verifyBlockTransactions(config, block)}
+		}
+	}()
+	return abort, results
+}
+
+// verifyBlockTransactions checks all the transactions of a block concurrently,
+// returning the error of the first one, in block order, found invalid.
+func verifyBlockTransactions(config *params.ChainConfig, block *types.Block) error {
+	var (
+		txs       = block.Transactions()
+		errs      = make([]error, len(txs))
+		signer    = types.MakeSigner(config, block.Number())
+		homestead = config.IsHomestead(block.Number())
+	)
+	workers.Run(len(txs), func(i int) {
+		errs[i] = verifyTransaction(signer, homestead, block.GasLimit(), txs[i])
+	})
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyTransaction runs the state independent checks of a transaction included
+// in a block of the given gas limit.
+func verifyTransaction(signer types.Signer, homestead bool, gasLimit *big.Int, tx *types.Transaction) error {
+	if _, err := types.Sender(signer, tx); err != nil {
+		return err
+	}
+	if tx.Gas().Cmp(gasLimit) > 0 {
+		return &GasLimitErr{Have: gasLimit, Want: tx.Gas()}
+	}
+	if igas := IntrinsicGas(tx.Data(), tx.To() == nil, homestead); tx.Gas().Cmp(igas) < 0 {
+		return InvalidTxError(fmt.Errorf("tx %x: intrinsic gas too low: have %v, want %v", tx.Hash().Bytes()[:4], tx.Gas(), igas))
+	}
+	return nil
+}
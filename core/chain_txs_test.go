@@ -0,0 +1,83 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/crypto"
+	"github.com/ur-technology/go-ur/ethdb"
+	"github.com/ur-technology/go-ur/event"
+	"github.com/ur-technology/go-ur/params"
+)
+
+// Tests that the transaction pre-validation accepts valid blocks and rejects
+// the ones with transactions failing the state independent checks.
+func TestTransactionPreValidation(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	header := &types.Header{Number: big.NewInt(1), GasLimit: big.NewInt(100000)}
+
+	valid := transaction(0, params.TxGas, key)
+	tests := []struct {
+		txs   []*types.Transaction
+		check func(error) bool
+	}{
+		{nil, func(err error) bool { return err == nil }},
+		{[]*types.Transaction{valid, transaction(1, params.TxGas, key)}, func(err error) bool { return err == nil }},
+		{[]*types.Transaction{valid, transaction(1, big.NewInt(20000), key)}, IsInvalidTxErr},
+		{[]*types.Transaction{valid, transaction(1, big.NewInt(200000), key)}, IsGasLimitErr},
+		{[]*types.Transaction{valid, types.NewTransaction(1, common.Address{}, big.NewInt(100), params.TxGas, big.NewInt(1), nil)}, func(err error) bool { return err != nil }},
+	}
+	for i, tt := range tests {
+		block := types.NewBlock(header, tt.txs, nil, nil)
+		abort, results := verifyTransactions(params.TestChainConfig, types.Blocks{block})
+		if r := <-results; !tt.check(r.err) {
+			t.Errorf("test %d: unexpected result: %v", i, r.err)
+		}
+		close(abort)
+	}
+	// Senders should have been cached by the pre-validation
+	if from, _ := types.Sender(types.HomesteadSigner{}, valid); from != crypto.PubkeyToAddress(key.PublicKey) {
+		t.Errorf("sender mismatch: have %x, want %x", from, crypto.PubkeyToAddress(key.PublicKey))
+	}
+}
+
+// Tests that blocks with transactions failing the pre-validation are rejected
+// by the import before their state is processed.
+func TestInsertChainInvalidTransaction(t *testing.T) {
+	var (
+		key, _  = crypto.GenerateKey()
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		db, _   = ethdb.NewMemDatabase()
+		genesis = WriteGenesisBlockForTesting(db, GenesisAccount{address, big.NewInt(1000000000)})
+	)
+	blockchain, _ := NewBlockChain(db, testChainConfig(), FakePow{}, new(event.TypeMux))
+	defer blockchain.Stop()
+
+	blocks, _ := GenerateChain(params.TestChainConfig, blockchain, genesis, db, 2, nil)
+	bad := types.NewBlock(types.CopyHeader(blocks[1].Header()), []*types.Transaction{transaction(0, big.NewInt(20000), key)}, nil, nil)
+
+	if n, err := blockchain.InsertChain(types.Blocks{blocks[0], bad}); n != 1 || !IsInvalidTxErr(err) {
+		t.Fatalf("insert result mismatch: have (%d, %v), want (1, invalid tx)", n, err)
+	}
+	if head := blockchain.CurrentBlock().NumberU64(); head != 1 {
+		t.Errorf("head mismatch: have %d, want 1", head)
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/ethdb"
+	"github.com/ur-technology/go-ur/logger"
+	"github.com/ur-technology/go-ur/logger/glog"
+)
+
+// The tables of the ancient store, each holding one item per canonical block.
+const (
+	ancientHashTable     = "hashes"   // Canonical block hashes
+	ancientHeaderTable   = "headers"  // Block headers in RLP encoding
+	ancientBodyTable     = "bodies"   // Block bodies in RLP encoding
+	ancientReceiptsTable = "receipts" // Block receipts in RLP storage encoding
+)
+
+// AncientTables lists the tables of the ancient store, to be passed when opening it.
+var AncientTables = []string{ancientHashTable, ancientHeaderTable, ancientBodyTable, ancientReceiptsTable}
+
+const (
+	// DefaultAncientThreshold is the default number of most recent blocks kept
+	// in LevelDB, older canonical blocks are moved to the ancient store. It is
+	// well beyond any reorg the chain may go through.
+	DefaultAncientThreshold = 90000
+
+	// freezeBatchSize is the number of blocks frozen between syncs of the
+	// ancient store and deletions from LevelDB.
+	freezeBatchSize = 2048
+
+	// freezeRecheckInterval is the time between two freezing attempts once the
+	// ancient store caught up with the chain.
+	freezeRecheckInterval = time.Minute
+)
+
+// emptyReceiptsRLP is the RLP encoding of an empty receipt list, frozen for the
+// blocks without stored receipts (e.g. the genesis block).
+var emptyReceiptsRLP = []byte{0xc0}
+
+// OpenAncientStore attaches the ancient store in dir to a LevelDB database, dir
+// defaulting to the "ancient" directory within the database. Other databases
+// are left untouched.
+func OpenAncientStore(db ethdb.Database, dir string) error {
+	ldb, ok := db.(*ethdb.LDBDatabase)
+	if !ok {
+		return nil
+	}
+	if dir == "" {
+		dir = filepath.Join(ldb.Path(), "ancient")
+	}
+	return ldb.OpenFreezer(dir, AncientTables)
+}
+
+// readAncient retrieves an item of the block with the given hash and number from
+// the ancient store, or nil if the database has no such store or the block isn't
+// the frozen canonical one.
+func readAncient(db ethdb.Database, table string, hash common.Hash, number uint64) []byte {
+	ancients, ok := db.(ethdb.AncientReader)
+	if !ok || number >= ancients.Ancients() {
+		return nil
+	}
+	frozen, err := ancients.Ancient(ancientHashTable, number)
+	if err != nil || common.BytesToHash(frozen) != hash {
+		return nil
+	}
+	data, _ := ancients.Ancient(table, number)
+	return data
+}
+
+// FreezeAncients moves the headers, bodies and receipts of canonical blocks more
+// than threshold blocks below the current head from LevelDB into the ancient
+// store of the database, at most limit blocks at once (0 = no limit). It returns
+// the number of blocks frozen. Moving the entire history of a database created
+// before the ancient store existed migrates it to the new layout.
+func FreezeAncients(db *ethdb.LDBDatabase, threshold, limit uint64) (uint64, error) {
+	freezer := db.Freezer()
+	if freezer == nil {
+		return 0, fmt.Errorf("no ancient store attached to %s", db.Path())
+	}
+	// Only freeze blocks fully processed by both full and fast sync
+	head := GetBlockNumber(db, GetHeadBlockHash(db))
+	if fast := GetBlockNumber(db, GetHeadFastBlockHash(db)); fast < head {
+		head = fast
+	}
+	if head == missingNumber || head < threshold {
+		return 0, nil
+	}
+	var (
+		first = freezer.Items()
+		last  = head - threshold
+	)
+	if limit > 0 && last >= first+limit {
+		last = first + limit - 1
+	}
+	var (
+		hashes  []common.Hash
+		failure error
+	)
+	for number := first; number <= last; number++ {
+		hash := GetCanonicalHash(db, number)
+		if hash == (common.Hash{}) {
+			failure = fmt.Errorf("canonical hash #%d missing", number)
+			break
+		}
+		header := GetHeaderRLP(db, hash, number)
+		if len(header) == 0 {
+			failure = fmt.Errorf("header #%d [%x…] missing", number, hash[:4])
+			break
+		}
+		// Light databases hold no bodies, stop freezing there without failing
+		body := GetBodyRLP(db, hash, number)
+		if len(body) == 0 {
+			break
+		}
+		receipts, _ := db.Get(append(append(blockReceiptsPrefix, encodeBlockNumber(number)...), hash[:]...))
+		if len(receipts) == 0 {
+			receipts = emptyReceiptsRLP
+		}
+		blobs := map[string][]byte{
+			ancientHashTable:     hash[:],
+			ancientHeaderTable:   header,
+			ancientBodyTable:     body,
+			ancientReceiptsTable: receipts,
+		}
+		if failure = freezer.Append(number, blobs); failure != nil {
+			break
+		}
+		hashes = append(hashes, hash)
+	}
+	if len(hashes) == 0 {
+		return 0, failure
+	}
+	// Only delete the moved data once safely on disk
+	if err := freezer.Sync(); err != nil {
+		return 0, err
+	}
+	for i, hash := range hashes {
+		number := first + uint64(i)
+		db.Delete(append(append(headerPrefix, encodeBlockNumber(number)...), hash.Bytes()...))
+		DeleteBody(db, hash, number)
+		DeleteBlockReceipts(db, hash, number)
+	}
+	glog.V(logger.Debug).Infof("Froze %d blocks #%d-#%d into the ancient store", len(hashes), first, first+uint64(len(hashes))-1)
+	return uint64(len(hashes)), failure
+}
+
+// TruncateAncients discards the frozen blocks from the given number onwards, e.g.
+// when rewinding the chain below the frozen blocks.
+func TruncateAncients(db ethdb.Database, number uint64) error {
+	if ldb, ok := db.(*ethdb.LDBDatabase); ok && ldb.Freezer() != nil {
+		return ldb.Freezer().Truncate(number)
+	}
+	return nil
+}
+
+// ChainFreezer periodically moves the canonical blocks more than a threshold
+// below the chain head into the ancient store of the chain database.
+type ChainFreezer struct {
+	db        *ethdb.LDBDatabase
+	threshold uint64
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewChainFreezer creates a freezer for the database, which must have an ancient
+// store attached.
+func NewChainFreezer(db *ethdb.LDBDatabase, threshold uint64) *ChainFreezer {
+	return &ChainFreezer{
+		db:        db,
+		threshold: threshold,
+		quit:      make(chan struct{}),
+	}
+}
+
+// Start spawns the freezing goroutine.
+func (f *ChainFreezer) Start() {
+	f.wg.Add(1)
+	go f.loop()
+}
+
+// Stop terminates the freezing goroutine, blocking until it returns.
+func (f *ChainFreezer) Stop() {
+	close(f.quit)
+	f.wg.Wait()
+}
+
+// loop freezes blocks in batches until caught up with the chain, then waits for
+// the chain to advance before trying again.
+func (f *ChainFreezer) loop() {
+	defer f.wg.Done()
+
+	for {
+		frozen, err := FreezeAncients(f.db, f.threshold, freezeBatchSize)
+		if err != nil {
+			glog.V(logger.Error).Infof("Failed to freeze ancient blocks: %v", err)
+		}
+		wait := freezeRecheckInterval
+		if err == nil && frozen == freezeBatchSize {
+			wait = 0
+		}
+		select {
+		case <-time.After(wait):
+		case <-f.quit:
+			return
+		}
+	}
+}
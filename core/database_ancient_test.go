@@ -0,0 +1,104 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/crypto"
+	"github.com/ur-technology/go-ur/ethdb"
+	"github.com/ur-technology/go-ur/event"
+	"github.com/ur-technology/go-ur/params"
+)
+
+// Tests that frozen blocks are removed from LevelDB but remain accessible, and
+// that rewinding the chain below them discards them.
+func TestFreezeAncients(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ancient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := ethdb.NewLDBDatabase(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if err := OpenAncientStore(db, ""); err != nil {
+		t.Fatalf("failed to open ancient store: %v", err)
+	}
+	var (
+		key, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr   = crypto.PubkeyToAddress(key.PublicKey)
+		signer = types.HomesteadSigner{}
+	)
+	genesis := WriteGenesisBlockForTesting(db, GenesisAccount{addr, big.NewInt(1000000000)})
+	blockchain, _ := NewBlockChain(db, params.TestChainConfig, FakePow{}, new(event.TypeMux))
+	defer blockchain.Stop()
+
+	chain, _ := GenerateChain(params.TestChainConfig, blockchain, genesis, db, 8, func(i int, gen *BlockGen) {
+		tx, _ := types.NewTransaction(gen.TxNonce(addr), common.Address{1}, big.NewInt(1000), params.TxGas, nil, nil).SignECDSA(signer, key)
+		gen.AddTx(tx)
+	})
+	if _, err := blockchain.InsertChain(chain); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	// Freeze the genesis and the first 4 blocks, leaving the last 4 in LevelDB
+	frozen, err := FreezeAncients(db, 4, 0)
+	if err != nil {
+		t.Fatalf("failed to freeze: %v", err)
+	}
+	if frozen != 5 || db.Ancients() != 5 {
+		t.Fatalf("frozen block count mismatch: have %d/%d, want 5", frozen, db.Ancients())
+	}
+	if frozen, err := FreezeAncients(db, 4, 0); err != nil || frozen != 0 {
+		t.Fatalf("refreeze mismatch: have %d (%v), want 0", frozen, err)
+	}
+	for _, block := range chain {
+		hash, number := block.Hash(), block.NumberU64()
+
+		_, err := db.Get(append(append(bodyPrefix, encodeBlockNumber(number)...), hash[:]...))
+		if inLevelDB := err == nil; inLevelDB != (number > 4) {
+			t.Errorf("block #%d: body in LevelDB %v, want %v", number, inLevelDB, number > 4)
+		}
+		if header := GetHeader(db, hash, number); header == nil || header.Hash() != hash {
+			t.Errorf("block #%d: header not retrievable", number)
+		}
+		if body := GetBody(db, hash, number); body == nil || len(body.Transactions) != 1 {
+			t.Errorf("block #%d: body not retrievable", number)
+		}
+		if receipts := GetBlockReceipts(db, hash, number); len(receipts) != 1 {
+			t.Errorf("block #%d: receipts not retrievable", number)
+		}
+	}
+	// Items of non canonical blocks must not be served from the ancient store
+	if GetHeader(db, common.Hash{1}, 1) != nil {
+		t.Errorf("header retrieved for unknown hash")
+	}
+	// Rewinding below the frozen blocks must discard them
+	blockchain.SetHead(2)
+	if ancients := db.Ancients(); ancients != 3 {
+		t.Errorf("ancients after rewind mismatch: have %d, want 3", ancients)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/ethdb"
+	"github.com/ur-technology/go-ur/params"
+)
+
+// ChainConfigVersion is the version of the chain configuration encoding written
+// to the database. Bumping it requires adding the migration from the previous
+// version to chainConfigMigrations.
+const ChainConfigVersion = 1
+
+// chainConfigMigrations converts the stored chain configuration of version i
+// into the encoding of version i+1. Version 0 is the plain JSON encoding of the
+// configuration written before the encoding was versioned.
+var chainConfigMigrations = []func(json.RawMessage) (json.RawMessage, error){
+	// Version 1 only wraps the configuration into the versioned encoding
+	func(config json.RawMessage) (json.RawMessage, error) { return config, nil },
+}
+
+// storedChainConfig is the versioned database encoding of a chain configuration.
+type storedChainConfig struct {
+	Version uint64          `json:"version"`
+	Config  json.RawMessage `json:"config"`
+}
+
+// encodeChainConfig encodes a chain configuration in the current versioned format.
+func encodeChainConfig(config *params.ChainConfig) ([]byte, error) {
+	blob, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(storedChainConfig{Version: ChainConfigVersion, Config: blob})
+}
+
+// decodeChainConfig decodes a stored chain configuration of any version up to the
+// current one, running the migrations of the older ones.
+func decodeChainConfig(blob []byte) (*params.ChainConfig, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(blob, &fields); err != nil {
+		return nil, err
+	}
+	var stored storedChainConfig
+	if _, ok := fields["config"]; ok {
+		if err := json.Unmarshal(blob, &stored); err != nil {
+			return nil, err
+		}
+	} else {
+		stored.Config = blob
+	}
+	if stored.Version > ChainConfigVersion {
+		return nil, fmt.Errorf("chain config version %d unsupported, have %d (database written by a newer release?)", stored.Version, ChainConfigVersion)
+	}
+	for version := stored.Version; version < ChainConfigVersion; version++ {
+		migrated, err := chainConfigMigrations[version](stored.Config)
+		if err != nil {
+			return nil, fmt.Errorf("chain config migration to version %d failed: %v", version+1, err)
+		}
+		stored.Config = migrated
+	}
+	config := new(params.ChainConfig)
+	if err := json.Unmarshal(stored.Config, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// SetupChainConfig stores the chain configuration of the chain with the given
+// genesis hash, unless it conflicts with the stored one on the rules of blocks
+// already in the database, in which case a *params.ConfigCompatError is returned
+// and the stored configuration is left untouched. Changes to forks ahead of the
+// chain head are accepted, as is a stored configuration of an older version.
+func SetupChainConfig(db ethdb.Database, genesis common.Hash, config *params.ChainConfig) error {
+	stored, err := GetChainConfig(db, genesis)
+	switch {
+	case err == ChainConfigNotFoundErr:
+		return WriteChainConfig(db, genesis, config)
+	case err != nil:
+		return err
+	}
+	height := uint64(0)
+	if head := GetHeadHeaderHash(db); head != (common.Hash{}) {
+		if number := GetBlockNumber(db, head); number != missingNumber {
+			height = number
+		}
+	}
+	if compatErr := stored.CheckCompatible(config, height); compatErr != nil {
+		return compatErr
+	}
+	return WriteChainConfig(db, genesis, config)
+}
@@ -0,0 +1,128 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/ethdb"
+	"github.com/ur-technology/go-ur/params"
+)
+
+// Tests that chain configurations stored before the versioned encoding are
+// migrated on read, and that newer versions are refused.
+func TestChainConfigMigration(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	hash := common.Hash{1}
+
+	config := &params.ChainConfig{ChainId: big.NewInt(7), HomesteadBlock: big.NewInt(0), EIP155Block: big.NewInt(10)}
+	legacy, _ := json.Marshal(config)
+	db.Put(append(configPrefix, hash[:]...), legacy)
+
+	stored, err := GetChainConfig(db, hash)
+	if err != nil {
+		t.Fatalf("failed to read legacy config: %v", err)
+	}
+	if !reflect.DeepEqual(stored, config) {
+		t.Errorf("legacy config mismatch: have %v, want %v", stored, config)
+	}
+	// Rewriting must upgrade to the current version
+	if err := WriteChainConfig(db, hash, stored); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	blob, _ := db.Get(append(configPrefix, hash[:]...))
+	var versioned storedChainConfig
+	if err := json.Unmarshal(blob, &versioned); err != nil || versioned.Version != ChainConfigVersion {
+		t.Errorf("stored config version mismatch: have %d (%v), want %d", versioned.Version, err, ChainConfigVersion)
+	}
+	if stored, err = GetChainConfig(db, hash); err != nil || !reflect.DeepEqual(stored, config) {
+		t.Errorf("versioned config mismatch: have %v (%v), want %v", stored, err, config)
+	}
+	// Configs written by a future release must not be misread
+	future, _ := json.Marshal(storedChainConfig{Version: ChainConfigVersion + 1, Config: legacy})
+	db.Put(append(configPrefix, hash[:]...), future)
+	if _, err := GetChainConfig(db, hash); err == nil {
+		t.Errorf("future config version accepted")
+	}
+}
+
+// Tests that configuration changes affecting the blocks already in the chain are
+// refused, while changes ahead of the head are accepted.
+func TestSetupChainConfig(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	genesis := WriteGenesisBlockForTesting(db)
+
+	stored := &params.ChainConfig{ChainId: big.NewInt(1), HomesteadBlock: big.NewInt(0), EIP150Block: big.NewInt(5), EIP155Block: big.NewInt(20)}
+	if err := SetupChainConfig(db, genesis.Hash(), stored); err != nil {
+		t.Fatalf("failed to store initial config: %v", err)
+	}
+	// Move the head to block 10
+	header := genesis.Header()
+	header.Number = big.NewInt(10)
+	WriteHeader(db, header)
+	WriteHeadHeaderHash(db, header.Hash())
+
+	tests := []struct {
+		change func(*params.ChainConfig)
+		fail   bool
+	}{
+		{func(c *params.ChainConfig) {}, false},
+		{func(c *params.ChainConfig) { c.EIP155Block = big.NewInt(30) }, false},      // future fork moved
+		{func(c *params.ChainConfig) { c.EIP158Block = big.NewInt(11) }, false},      // future fork added
+		{func(c *params.ChainConfig) { c.EIP150Block = big.NewInt(6) }, true},        // past fork moved
+		{func(c *params.ChainConfig) { c.EIP150Block = nil }, true},                  // past fork removed
+		{func(c *params.ChainConfig) { c.FeeContractBlock = big.NewInt(3) }, true},   // fork added in the past
+		{func(c *params.ChainConfig) { c.UR = &params.URConfig{} }, true},            // rewards changed
+		{func(c *params.ChainConfig) { c.MinGasPriceBlock = big.NewInt(50) }, false}, // future floor
+		{func(c *params.ChainConfig) { c.DifficultyForks = diffForks(20) }, false},   // future difficulty fork
+		{func(c *params.ChainConfig) { c.DifficultyForks = diffForks(8) }, true},     // difficulty fork in the past
+		{func(c *params.ChainConfig) { c.UnclePolicyBlock = big.NewInt(9) }, true},   // uncle policy in the past
+		{func(c *params.ChainConfig) { c.UnclePolicyBlock = big.NewInt(11) }, false}, // future uncle policy
+	}
+	for i, tt := range tests {
+		config := *stored
+		tt.change(&config)
+
+		err := SetupChainConfig(db, genesis.Hash(), &config)
+		if _, compat := err.(*params.ConfigCompatError); compat != tt.fail {
+			t.Errorf("test %d: compatibility mismatch: have %v, want failure %v", i, err, tt.fail)
+			continue
+		}
+		have, err := GetChainConfig(db, genesis.Hash())
+		if err != nil {
+			t.Fatalf("test %d: failed to read config: %v", i, err)
+		}
+		if want := &config; tt.fail {
+			want = stored
+			if !reflect.DeepEqual(have, want) {
+				t.Errorf("test %d: stored config overwritten: have %v, want %v", i, have, want)
+			}
+		}
+		// Restore the original for the next test
+		WriteChainConfig(db, genesis.Hash(), stored)
+	}
+}
+
+// diffForks returns a difficulty schedule retuning the block time at the given
+// block.
+func diffForks(block int64) []params.DifficultyFork {
+	return []params.DifficultyFork{{Block: big.NewInt(block), Algorithm: params.DifficultyHomestead, BlockTime: 5}}
+}
@@ -0,0 +1,140 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/ethdb"
+	"github.com/ur-technology/go-ur/rlp"
+)
+
+// Key space categories reported by InspectDatabase, in reporting order.
+const (
+	KeyCategoryHeaders      = "Headers"
+	KeyCategoryTds          = "Total difficulties"
+	KeyCategoryCanonical    = "Canonical hashes"
+	KeyCategoryNumbers      = "Block number lookups"
+	KeyCategoryBodies       = "Bodies"
+	KeyCategoryReceipts     = "Receipts"
+	KeyCategoryTxs          = "Transaction lookups"
+	KeyCategoryState        = "State trie and code"
+	KeyCategoryPreimages    = "Trie key preimages"
+	KeyCategoryBlooms       = "Log bloom mipmaps"
+	KeyCategoryBloomBits    = "Log bloom bits"
+	KeyCategoryLightCHT     = "Light client CHT roots"
+	KeyCategoryChainMeta    = "Chain metadata"
+	KeyCategoryUnclassified = "Unclassified"
+)
+
+// keyCategories lists all the key space categories in reporting order.
+var keyCategories = []string{
+	KeyCategoryHeaders, KeyCategoryTds, KeyCategoryCanonical, KeyCategoryNumbers,
+	KeyCategoryBodies, KeyCategoryReceipts, KeyCategoryTxs, KeyCategoryState,
+	KeyCategoryPreimages, KeyCategoryBlooms, KeyCategoryBloomBits, KeyCategoryLightCHT,
+	KeyCategoryChainMeta, KeyCategoryUnclassified,
+}
+
+// DatabaseStat is the usage of a single key space category of the database.
+type DatabaseStat struct {
+	Category string             // Name of the key space category
+	Count    uint64             // Number of entries in the category
+	Size     common.StorageSize // Total size of the keys and values in the category
+}
+
+// InspectDatabase iterates over the entire database, breaking its contents down
+// by key space category.
+func InspectDatabase(db *ethdb.LDBDatabase) ([]DatabaseStat, error) {
+	stats := make(map[string]*DatabaseStat)
+	for _, category := range keyCategories {
+		stats[category] = &DatabaseStat{Category: category}
+	}
+	it := db.NewIterator()
+	defer it.Release()
+
+	for it.Next() {
+		key, value := it.Key(), it.Value()
+
+		stat := stats[classifyKey(key, value)]
+		stat.Count++
+		stat.Size += common.StorageSize(len(key) + len(value))
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	result := make([]DatabaseStat, len(keyCategories))
+	for i, category := range keyCategories {
+		result[i] = *stats[category]
+	}
+	return result, nil
+}
+
+// classifyKey returns the key space category of a database entry. Transactions
+// and state trie nodes are both keyed by plain hashes, so they are told apart by
+// the shape of their values.
+func classifyKey(key, value []byte) string {
+	const numHashLen = 1 + 8 + common.HashLength // prefix + block number + hash
+
+	switch {
+	case bytes.HasPrefix(key, headerPrefix) && len(key) == numHashLen:
+		return KeyCategoryHeaders
+	case bytes.HasPrefix(key, headerPrefix) && len(key) == numHashLen+len(tdSuffix) && bytes.HasSuffix(key, tdSuffix):
+		return KeyCategoryTds
+	case bytes.HasPrefix(key, headerPrefix) && len(key) == 1+8+len(numSuffix) && bytes.HasSuffix(key, numSuffix):
+		return KeyCategoryCanonical
+	case bytes.HasPrefix(key, blockHashPrefix) && len(key) == 1+common.HashLength && len(value) == 8:
+		return KeyCategoryNumbers
+	case bytes.HasPrefix(key, bodyPrefix) && len(key) == numHashLen:
+		return KeyCategoryBodies
+	case bytes.HasPrefix(key, blockReceiptsPrefix) && len(key) == numHashLen,
+		bytes.HasPrefix(key, receiptsPrefix) && len(key) == len(receiptsPrefix)+common.HashLength:
+		return KeyCategoryReceipts
+	case len(key) == common.HashLength+len(txMetaSuffix) && bytes.HasSuffix(key, txMetaSuffix):
+		return KeyCategoryTxs
+	case len(key) == common.HashLength:
+		if isTransactionBlob(value) {
+			return KeyCategoryTxs
+		}
+		return KeyCategoryState
+	case bytes.HasPrefix(key, []byte("secure-key-")):
+		return KeyCategoryPreimages
+	case bytes.HasPrefix(key, mipmapPre):
+		return KeyCategoryBlooms
+	case bytes.HasPrefix(key, bloomBitsPrefix), bytes.Equal(key, bloomBitsCountKey):
+		return KeyCategoryBloomBits
+	case bytes.HasPrefix(key, []byte("cht")):
+		return KeyCategoryLightCHT
+	case bytes.HasPrefix(key, configPrefix), bytes.HasPrefix(key, []byte("dbUpgrade_")),
+		bytes.Equal(key, headHeaderKey), bytes.Equal(key, headBlockKey), bytes.Equal(key, headFastKey),
+		bytes.Equal(key, txLookupTailKey),
+		bytes.Equal(key, []byte("BlockchainVersion")), bytes.Equal(key, []byte("setting-mipmap-version")):
+		return KeyCategoryChainMeta
+	}
+	return KeyCategoryUnclassified
+}
+
+// isTransactionBlob reports whether value looks like an RLP encoded transaction,
+// which is a list of exactly nine items, unlike trie nodes (two or seventeen).
+func isTransactionBlob(value []byte) bool {
+	content, rest, err := rlp.SplitList(value)
+	if err != nil || len(rest) != 0 {
+		return false
+	}
+	count, err := rlp.CountValues(content)
+	return err == nil && count == 9
+}
@@ -0,0 +1,84 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/ethdb"
+)
+
+// Tests that the database inspection attributes every written entry to the
+// right key space category.
+func TestInspectDatabase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inspect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := ethdb.NewLDBDatabase(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	// Write a genesis with some state and a block with a transaction and receipt
+	genesis := WriteGenesisBlockForTesting(db, GenesisAccount{common.Address{1}, big.NewInt(1)})
+
+	tx := types.NewTransaction(0, common.Address{2}, big.NewInt(1), big.NewInt(21000), big.NewInt(1), nil)
+	receipt := types.NewReceipt(nil, big.NewInt(21000))
+	receipt.TxHash = tx.Hash()
+	block := types.NewBlock(&types.Header{Number: big.NewInt(1), ParentHash: genesis.Hash()}, []*types.Transaction{tx}, nil, types.Receipts{receipt})
+
+	if err := WriteBlock(db, block); err != nil {
+		t.Fatalf("failed to write block: %v", err)
+	}
+	WriteCanonicalHash(db, block.Hash(), 1)
+	WriteTd(db, block.Hash(), 1, big.NewInt(2))
+	WriteTransactions(db, block)
+	WriteReceipts(db, types.Receipts{receipt})
+	WriteBlockReceipts(db, block.Hash(), 1, types.Receipts{receipt})
+	WriteHeadBlockHash(db, block.Hash())
+	WriteBlockChainVersion(db, BlockChainVersion)
+
+	stats, err := InspectDatabase(db)
+	if err != nil {
+		t.Fatalf("failed to inspect database: %v", err)
+	}
+	counts := make(map[string]uint64)
+	for _, stat := range stats {
+		counts[stat.Category] = stat.Count
+	}
+	for _, category := range []string{KeyCategoryHeaders, KeyCategoryTds, KeyCategoryCanonical, KeyCategoryNumbers,
+		KeyCategoryBodies, KeyCategoryReceipts, KeyCategoryState, KeyCategoryChainMeta} {
+		if counts[category] == 0 {
+			t.Errorf("category %q: no entries found", category)
+		}
+	}
+	if counts[KeyCategoryTxs] != 2 {
+		t.Errorf("transaction lookups: have %d entries, want 2", counts[KeyCategoryTxs])
+	}
+	if counts[KeyCategoryUnclassified] != 0 {
+		t.Errorf("unclassified entries: have %d, want 0", counts[KeyCategoryUnclassified])
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core/state"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/ethdb"
+	"github.com/ur-technology/go-ur/rlp"
+	"github.com/ur-technology/go-ur/trie"
+)
+
+// pruneBatchSize is the number of deletions accumulated before being written.
+const pruneBatchSize = 10000
+
+// DefaultPruneKeep is the default number of most recent block states retained
+// when pruning the state.
+const DefaultPruneKeep = 128
+
+// DeleteState removes all state trie nodes, contract codes and trie key preimages
+// from the database, except for those of the genesis state, and rewinds the head
+// block to the genesis block. Headers, bodies and receipts are left untouched, so
+// the state can be regenerated by syncing without downloading the chain again.
+// It returns the number and total size of the entries deleted.
+func DeleteState(db *ethdb.LDBDatabase) (uint64, common.StorageSize, error) {
+	genesis := GetBlock(db, GetCanonicalHash(db, 0), 0)
+	if genesis == nil {
+		return 0, 0, ErrNoGenesis
+	}
+	// Collect the genesis state, the only one the chain can be rebuilt from
+	keep := make(map[common.Hash]bool)
+	if err := markState(db, genesis.Root(), nil, keep); err != nil {
+		return 0, 0, fmt.Errorf("genesis state incomplete: %v", err)
+	}
+	// Rewind the head first, so an interrupted deletion leaves a usable database
+	if err := WriteHeadBlockHash(db, genesis.Hash()); err != nil {
+		return 0, 0, err
+	}
+	return sweepState(db, keep, true)
+}
+
+// PruneState removes all state trie nodes and contract codes not reachable from
+// the states of the genesis block and of the given number of most recent
+// canonical blocks, leaving the node unable to serve or reorg onto older states.
+// Recent states missing from the database, such as the ones below the pivot of
+// a fast sync, are skipped, but the state of the head block must be complete.
+// It returns the number of states retained along with the number and total size
+// of the entries deleted.
+func PruneState(db *ethdb.LDBDatabase, recent uint64) (int, uint64, common.StorageSize, error) {
+	genesis := GetBlock(db, GetCanonicalHash(db, 0), 0)
+	if genesis == nil {
+		return 0, 0, 0, ErrNoGenesis
+	}
+	head := GetBlock(db, GetHeadBlockHash(db), GetBlockNumber(db, GetHeadBlockHash(db)))
+	if head == nil {
+		return 0, 0, 0, fmt.Errorf("head block missing")
+	}
+	keep := make(map[common.Hash]bool)
+	if err := markState(db, head.Root(), nil, keep); err != nil {
+		return 0, 0, 0, fmt.Errorf("head state #%d incomplete: %v", head.NumberU64(), err)
+	}
+	roots := map[common.Hash]bool{head.Root(): true}
+
+	// Collect the recent states available, along with the genesis one
+	var (
+		number = head.NumberU64()
+		blocks []*types.Header
+	)
+	for i := uint64(1); i < recent && i <= number; i++ {
+		blocks = append(blocks, GetHeader(db, GetCanonicalHash(db, number-i), number-i))
+	}
+	blocks = append(blocks, genesis.Header())
+
+	for _, header := range blocks {
+		if header == nil || roots[header.Root] {
+			continue
+		}
+		// Mark into a separate set, so an incomplete state is dropped entirely
+		marked := make(map[common.Hash]bool)
+		if err := markState(db, header.Root, keep, marked); err != nil {
+			continue
+		}
+		for hash := range marked {
+			keep[hash] = true
+		}
+		roots[header.Root] = true
+	}
+	count, size, err := sweepState(db, keep, false)
+	return len(roots), count, size, err
+}
+
+// markState adds the hashes of all trie nodes and contract codes of the state
+// with the given root to marked. The subtries already in keep or marked aren't
+// descended into again, so marking many states sharing most of their nodes only
+// visits the nodes each of them adds.
+func markState(db ethdb.Database, root common.Hash, keep, marked map[common.Hash]bool) error {
+	return markTrie(db, root, keep, marked, func(value []byte) error {
+		var account state.Account
+		if err := rlp.DecodeBytes(value, &account); err != nil {
+			return fmt.Errorf("invalid account: %v", err)
+		}
+		if err := markTrie(db, account.Root, keep, marked, nil); err != nil {
+			return err
+		}
+		code := common.BytesToHash(account.CodeHash)
+		if code == emptyCodeHash || keep[code] || marked[code] {
+			return nil
+		}
+		if _, err := db.Get(code[:]); err != nil {
+			return fmt.Errorf("missing code %x: %v", code, err)
+		}
+		marked[code] = true
+		return nil
+	})
+}
+
+// markTrie adds the hashes of the nodes of the trie with the given root to
+// marked, skipping the subtries already in keep or marked, and calls onValue,
+// if set, with every value held by the nodes visited.
+func markTrie(db ethdb.Database, root common.Hash, keep, marked map[common.Hash]bool, onValue func([]byte) error) error {
+	pending := []common.Hash{root}
+	for len(pending) > 0 {
+		hash := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		if hash == types.EmptyRootHash || keep[hash] || marked[hash] {
+			continue
+		}
+		blob, err := db.Get(hash[:])
+		if err != nil {
+			return fmt.Errorf("missing trie node %x: %v", hash, err)
+		}
+		children, values, err := trie.NodeChildren(blob)
+		if err != nil {
+			return fmt.Errorf("invalid trie node %x: %v", hash, err)
+		}
+		marked[hash] = true
+		pending = append(pending, children...)
+
+		if onValue != nil {
+			for _, value := range values {
+				if err := onValue(value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// sweepState deletes all state trie nodes and contract codes not in keep from
+// the database, along with the trie key preimages if requested. It returns the
+// number and total size of the entries deleted.
+func sweepState(db *ethdb.LDBDatabase, keep map[common.Hash]bool, preimages bool) (uint64, common.StorageSize, error) {
+	var (
+		count uint64
+		size  common.StorageSize
+		batch = new(leveldb.Batch)
+	)
+	it := db.NewIterator()
+	defer it.Release()
+
+	for it.Next() {
+		key, value := it.Key(), it.Value()
+		switch classifyKey(key, value) {
+		case KeyCategoryState:
+			if keep[common.BytesToHash(key)] {
+				continue
+			}
+		case KeyCategoryPreimages:
+			if !preimages {
+				continue
+			}
+		default:
+			continue
+		}
+		batch.Delete(key)
+		count++
+		size += common.StorageSize(len(key) + len(value))
+
+		if batch.Len() >= pruneBatchSize {
+			if err := db.LDB().Write(batch, nil); err != nil {
+				return count, size, err
+			}
+			batch.Reset()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return count, size, err
+	}
+	return count, size, db.LDB().Write(batch, nil)
+}
@@ -0,0 +1,231 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core/state"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/crypto"
+	"github.com/ur-technology/go-ur/ethdb"
+	"github.com/ur-technology/go-ur/event"
+	"github.com/ur-technology/go-ur/params"
+)
+
+// Tests that deleting the state keeps the genesis state and the chain data, from
+// which the state can be regenerated by processing the blocks again.
+func TestDeleteState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "prune")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := ethdb.NewLDBDatabase(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	var (
+		key, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr   = crypto.PubkeyToAddress(key.PublicKey)
+		signer = types.HomesteadSigner{}
+	)
+	genesis := WriteGenesisBlockForTesting(db, GenesisAccount{addr, big.NewInt(1000000000)})
+	blockchain, _ := NewBlockChain(db, params.TestChainConfig, FakePow{}, new(event.TypeMux))
+
+	chain, _ := GenerateChain(params.TestChainConfig, blockchain, genesis, db, 4, func(i int, gen *BlockGen) {
+		tx, _ := types.NewTransaction(gen.TxNonce(addr), common.Address{1}, big.NewInt(1000), params.TxGas, nil, nil).SignECDSA(signer, key)
+		gen.AddTx(tx)
+	})
+	if _, err := blockchain.InsertChain(chain); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	blockchain.Stop()
+
+	count, _, err := DeleteState(db)
+	if err != nil {
+		t.Fatalf("failed to delete state: %v", err)
+	}
+	if count == 0 {
+		t.Fatalf("no state entries deleted")
+	}
+	if _, err := state.New(genesis.Root(), db); err != nil {
+		t.Errorf("genesis state deleted: %v", err)
+	}
+	head := chain[len(chain)-1]
+	if _, err := state.New(head.Root(), db); err == nil {
+		t.Errorf("head state still present")
+	}
+	if GetBody(db, head.Hash(), head.NumberU64()) == nil || GetBlockReceipts(db, head.Hash(), head.NumberU64()) == nil {
+		t.Errorf("chain data deleted along with the state")
+	}
+	// Reopening the chain must start from the genesis and regenerate the state
+	blockchain, err = NewBlockChain(db, params.TestChainConfig, FakePow{}, new(event.TypeMux))
+	if err != nil {
+		t.Fatalf("failed to reopen chain: %v", err)
+	}
+	defer blockchain.Stop()
+
+	if number := blockchain.CurrentBlock().NumberU64(); number != 0 {
+		t.Fatalf("head block not rewound: have #%d, want #0", number)
+	}
+	if _, err := blockchain.InsertChain(chain); err != nil {
+		t.Fatalf("failed to reprocess chain: %v", err)
+	}
+	if _, err := state.New(head.Root(), db); err != nil {
+		t.Errorf("head state not regenerated: %v", err)
+	}
+}
+
+// Tests that pruning the state keeps the genesis and recent states only, and
+// that the chain can be extended on top of the pruned database.
+func TestPruneState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "prune")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := ethdb.NewLDBDatabase(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	var (
+		key, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr   = crypto.PubkeyToAddress(key.PublicKey)
+		signer = types.HomesteadSigner{}
+	)
+	genesis := WriteGenesisBlockForTesting(db, GenesisAccount{addr, big.NewInt(1000000000)})
+	blockchain, _ := NewBlockChain(db, params.TestChainConfig, FakePow{}, new(event.TypeMux))
+
+	chain, _ := GenerateChain(params.TestChainConfig, blockchain, genesis, db, 10, func(i int, gen *BlockGen) {
+		tx, _ := types.NewTransaction(gen.TxNonce(addr), common.Address{byte(i + 1)}, big.NewInt(1000), params.TxGas, nil, nil).SignECDSA(signer, key)
+		gen.AddTx(tx)
+	})
+	if _, err := blockchain.InsertChain(chain[:8]); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	blockchain.Stop()
+
+	roots, count, _, err := PruneState(db, 3)
+	if err != nil {
+		t.Fatalf("failed to prune state: %v", err)
+	}
+	if roots != 4 {
+		t.Errorf("retained state count mismatch: have %d, want 4", roots)
+	}
+	if count == 0 {
+		t.Fatalf("no state entries deleted")
+	}
+	for _, block := range append([]*types.Block{genesis}, chain[:8]...) {
+		_, err := state.New(block.Root(), db)
+		if retained := block.NumberU64() == 0 || block.NumberU64() >= 6; retained && err != nil {
+			t.Errorf("block #%d: state pruned: %v", block.NumberU64(), err)
+		} else if !retained && err == nil {
+			t.Errorf("block #%d: state retained", block.NumberU64())
+		}
+	}
+	// Pruning again must only keep what's still there
+	if _, count, _, err := PruneState(db, 3); err != nil || count != 0 {
+		t.Errorf("second pruning mismatch: deleted %d (%v), want 0", count, err)
+	}
+	// The chain must continue from the retained head state
+	blockchain, err = NewBlockChain(db, params.TestChainConfig, FakePow{}, new(event.TypeMux))
+	if err != nil {
+		t.Fatalf("failed to reopen chain: %v", err)
+	}
+	defer blockchain.Stop()
+
+	if number := blockchain.CurrentBlock().NumberU64(); number != 8 {
+		t.Fatalf("head block mismatch: have #%d, want #8", number)
+	}
+	if _, err := blockchain.InsertChain(chain[8:]); err != nil {
+		t.Fatalf("failed to extend pruned chain: %v", err)
+	}
+}
+
+// Tests that marking states one after the other, skipping the subtries already
+// marked, collects the same nodes and codes as iterating each state entirely.
+func TestMarkState(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+
+	var (
+		key, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr   = crypto.PubkeyToAddress(key.PublicKey)
+		signer = types.HomesteadSigner{}
+		code   = common.FromHex("600160005560016000f3") // sstore(0, 1), return a 1 byte code
+	)
+	genesis := WriteGenesisBlockForTesting(db, GenesisAccount{addr, big.NewInt(1000000000)})
+	blockchain, _ := NewBlockChain(db, params.TestChainConfig, FakePow{}, new(event.TypeMux))
+	defer blockchain.Stop()
+
+	chain, _ := GenerateChain(params.TestChainConfig, blockchain, genesis, db, 6, func(i int, gen *BlockGen) {
+		var tx *types.Transaction
+		if i%2 == 0 {
+			tx, _ = types.NewContractCreation(gen.TxNonce(addr), new(big.Int), big.NewInt(100000), nil, code).SignECDSA(signer, key)
+		} else {
+			tx, _ = types.NewTransaction(gen.TxNonce(addr), common.Address{byte(i + 1)}, big.NewInt(1000), params.TxGas, nil, nil).SignECDSA(signer, key)
+		}
+		gen.AddTx(tx)
+	})
+	if _, err := blockchain.InsertChain(chain); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	if statedb, _ := blockchain.State(); len(statedb.GetCode(crypto.CreateAddress(addr, 0))) == 0 {
+		t.Fatalf("contract not deployed")
+	}
+	want := make(map[common.Hash]bool)
+	keep := make(map[common.Hash]bool)
+	for _, block := range append([]*types.Block{genesis}, chain...) {
+		statedb, err := state.New(block.Root(), db)
+		if err != nil {
+			t.Fatalf("block #%d: failed to open state: %v", block.NumberU64(), err)
+		}
+		for it := state.NewNodeIterator(statedb); it.Next(); {
+			if it.Hash != (common.Hash{}) {
+				want[it.Hash] = true
+			}
+		}
+		marked := make(map[common.Hash]bool)
+		if err := markState(db, block.Root(), keep, marked); err != nil {
+			t.Fatalf("block #%d: failed to mark state: %v", block.NumberU64(), err)
+		}
+		for hash := range marked {
+			if keep[hash] {
+				t.Errorf("block #%d: %x marked twice", block.NumberU64(), hash)
+			}
+			keep[hash] = true
+		}
+	}
+	if len(keep) != len(want) {
+		t.Errorf("marked entry count mismatch: have %d, want %d", len(keep), len(want))
+	}
+	for hash := range want {
+		if !keep[hash] {
+			t.Errorf("entry %x not marked", hash)
+		}
+	}
+}
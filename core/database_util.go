@@ -19,12 +19,12 @@ package core
 import (
 	"bytes"
 	"encoding/binary"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"math/big"
 
 	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core/state"
 	"github.com/ur-technology/go-ur/core/types"
 	"github.com/ur-technology/go-ur/ethdb"
 	"github.com/ur-technology/go-ur/logger"
@@ -38,6 +38,9 @@ var (
 	headBlockKey  = []byte("LastBlock")
 	headFastKey   = []byte("LastFast")
 
+	txLookupTailKey = []byte("TransactionLookupTail") // number of the oldest block whose transaction lookups are kept
+	finalizedKey    = []byte("LastFinalized")         // number and hash of the most recent finalized checkpoint
+
 	headerPrefix        = []byte("h") // headerPrefix + num (uint64 big endian) + hash -> header
 	tdSuffix            = []byte("t") // headerPrefix + num (uint64 big endian) + hash + tdSuffix -> td
 	numSuffix           = []byte("n") // headerPrefix + num (uint64 big endian) + numSuffix -> hash
@@ -51,6 +54,16 @@ var (
 	mipmapPre    = []byte("mipmap-log-bloom-")
 	MIPMapLevels = []uint64{1000000, 500000, 100000, 50000, 1000}
 
+	bloomBitsPrefix     = []byte("bloombits-")      // bloomBitsPrefix + bit (uint16 big endian) + section (uint64 big endian) -> bit vector
+	bloomBitsHeadPrefix = []byte("bloombits-head-") // bloomBitsHeadPrefix + section (uint64 big endian) -> hash of the last block
+	bloomBitsCountKey   = []byte("BloomBitsSections")
+
+	blockStatsPrefix   = []byte("blockstats-") // blockStatsPrefix + section (uint64 big endian) -> section head hash and block stats
+	blockStatsCountKey = []byte("BlockStatsSections")
+
+	reverseDiffPrefix  = []byte("rdiff-")  // reverseDiffPrefix + num (uint64 big endian) + hash -> state reverse diff of the block
+	reverseDiffsPrefix = []byte("rdiffs-") // reverseDiffsPrefix + num (uint64 big endian) -> hashes of the blocks with reverse diffs
+
 	configPrefix = []byte("ethereum-config-") // config prefix for the db
 
 	// used by old (non-sequential keys) db, now only used for conversion
@@ -144,6 +157,9 @@ func GetHeadFastBlockHash(db ethdb.Database) common.Hash {
 // if the header's not found.
 func GetHeaderRLP(db ethdb.Database, hash common.Hash, number uint64) rlp.RawValue {
 	data, _ := db.Get(append(append(headerPrefix, encodeBlockNumber(number)...), hash.Bytes()...))
+	if len(data) == 0 {
+		data = readAncient(db, ancientHeaderTable, hash, number)
+	}
 	if len(data) == 0 {
 		data, _ = db.Get(append(append(oldBlockPrefix, hash.Bytes()...), oldHeaderSuffix...))
 	}
@@ -168,6 +184,9 @@ func GetHeader(db ethdb.Database, hash common.Hash, number uint64) *types.Header
 // GetBodyRLP retrieves the block body (transactions and uncles) in RLP encoding.
 func GetBodyRLP(db ethdb.Database, hash common.Hash, number uint64) rlp.RawValue {
 	data, _ := db.Get(append(append(bodyPrefix, encodeBlockNumber(number)...), hash.Bytes()...))
+	if len(data) == 0 {
+		data = readAncient(db, ancientBodyTable, hash, number)
+	}
 	if len(data) == 0 {
 		data, _ = db.Get(append(append(oldBlockPrefix, hash.Bytes()...), oldBodySuffix...))
 	}
@@ -231,6 +250,9 @@ func GetBlock(db ethdb.Database, hash common.Hash, number uint64) *types.Block {
 // in a block given by its hash.
 func GetBlockReceipts(db ethdb.Database, hash common.Hash, number uint64) types.Receipts {
 	data, _ := db.Get(append(append(blockReceiptsPrefix, encodeBlockNumber(number)...), hash[:]...))
+	if len(data) == 0 {
+		data = readAncient(db, ancientReceiptsTable, hash, number)
+	}
 	if len(data) == 0 {
 		data, _ = db.Get(append(oldBlockReceiptsPrefix, hash.Bytes()...))
 		if len(data) == 0 {
@@ -589,6 +611,232 @@ func GetMipmapBloom(db ethdb.Database, number, level uint64) types.Bloom {
 	return types.BytesToBloom(bloomDat)
 }
 
+// bloomBitsKey returns the key of the bit vector of a bloom bit over a section.
+func bloomBitsKey(bit uint, section uint64) []byte {
+	key := make([]byte, len(bloomBitsPrefix)+10)
+	copy(key, bloomBitsPrefix)
+	binary.BigEndian.PutUint16(key[len(bloomBitsPrefix):], uint16(bit))
+	binary.BigEndian.PutUint64(key[len(bloomBitsPrefix)+2:], section)
+	return key
+}
+
+// WriteBloomBitsSection stores the compressed bit vectors of all the bloom bits
+// over a section, along with the hash of the last block the section was built on.
+func WriteBloomBitsSection(db ethdb.Database, section uint64, head common.Hash, vectors [][]byte) error {
+	batch := db.NewBatch()
+	for bit, vector := range vectors {
+		batch.Put(bloomBitsKey(uint(bit), section), vector)
+	}
+	batch.Put(append(bloomBitsHeadPrefix, encodeBlockNumber(section)...), head[:])
+	if err := batch.Write(); err != nil {
+		return fmt.Errorf("bloom bits write fail for section %d: %v", section, err)
+	}
+	return nil
+}
+
+// GetBloomBits retrieves the compressed bit vector of a bloom bit over a section.
+func GetBloomBits(db ethdb.Database, bit uint, section uint64) []byte {
+	data, _ := db.Get(bloomBitsKey(bit, section))
+	return data
+}
+
+// GetBloomBitsHead retrieves the hash of the last block a section was built on.
+func GetBloomBitsHead(db ethdb.Database, section uint64) common.Hash {
+	data, _ := db.Get(append(bloomBitsHeadPrefix, encodeBlockNumber(section)...))
+	return common.BytesToHash(data)
+}
+
+// GetBloomBitsSections retrieves the number of indexed bloom bits sections.
+func GetBloomBitsSections(db ethdb.Database) uint64 {
+	data, _ := db.Get(bloomBitsCountKey)
+	if len(data) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(data)
+}
+
+// WriteBloomBitsSections stores the number of indexed bloom bits sections.
+func WriteBloomBitsSections(db ethdb.Database, sections uint64) error {
+	if err := db.Put(bloomBitsCountKey, encodeBlockNumber(sections)); err != nil {
+		return fmt.Errorf("failed to store bloom bits section count: %v", err)
+	}
+	return nil
+}
+
+// blockStatsSection is the storage format of a block stats section.
+type blockStatsSection struct {
+	Head   common.Hash // Hash of the last block the section was built on
+	Blocks []*BlockStats
+}
+
+// WriteBlockStatsSection stores the statistics of the blocks of a section,
+// along with the hash of the last block the section was built on.
+func WriteBlockStatsSection(db ethdb.Database, section uint64, head common.Hash, stats []*BlockStats) error {
+	data, err := rlp.EncodeToBytes(&blockStatsSection{head, stats})
+	if err != nil {
+		return err
+	}
+	if err := db.Put(append(blockStatsPrefix, encodeBlockNumber(section)...), data); err != nil {
+		return fmt.Errorf("block stats write fail for section %d: %v", section, err)
+	}
+	return nil
+}
+
+// GetBlockStatsSection retrieves the statistics of the blocks of a section and
+// the hash of the last block it was built on, nil if not found.
+func GetBlockStatsSection(db ethdb.Database, section uint64) (common.Hash, []*BlockStats) {
+	data, _ := db.Get(append(blockStatsPrefix, encodeBlockNumber(section)...))
+	if len(data) == 0 {
+		return common.Hash{}, nil
+	}
+	stored := new(blockStatsSection)
+	if err := rlp.DecodeBytes(data, stored); err != nil {
+		glog.V(logger.Error).Infof("invalid block stats section %d: %v", section, err)
+		return common.Hash{}, nil
+	}
+	return stored.Head, stored.Blocks
+}
+
+// GetBlockStatsSections retrieves the number of indexed block stats sections.
+func GetBlockStatsSections(db ethdb.Database) uint64 {
+	data, _ := db.Get(blockStatsCountKey)
+	if len(data) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(data)
+}
+
+// WriteBlockStatsSections stores the number of indexed block stats sections.
+func WriteBlockStatsSections(db ethdb.Database, sections uint64) error {
+	if err := db.Put(blockStatsCountKey, encodeBlockNumber(sections)); err != nil {
+		return fmt.Errorf("failed to store block stats section count: %v", err)
+	}
+	return nil
+}
+
+// GetReverseDiff retrieves the reverse diff of the state changes of a block,
+// nil if not found.
+func GetReverseDiff(db ethdb.Database, hash common.Hash, number uint64) *state.ReverseDiff {
+	data, _ := db.Get(append(append(reverseDiffPrefix, encodeBlockNumber(number)...), hash[:]...))
+	if len(data) == 0 {
+		return nil
+	}
+	diff := new(state.ReverseDiff)
+	if err := rlp.DecodeBytes(data, diff); err != nil {
+		glog.V(logger.Error).Infof("invalid reverse diff RLP for block #%d [%x…]: %v", number, hash[:4], err)
+		return nil
+	}
+	return diff
+}
+
+// getReverseDiffHashes retrieves the hashes of the blocks with the given number
+// whose reverse diffs are stored, canonical or not.
+func getReverseDiffHashes(db ethdb.Database, number uint64) []common.Hash {
+	data, _ := db.Get(append(reverseDiffsPrefix, encodeBlockNumber(number)...))
+	if len(data) == 0 {
+		return nil
+	}
+	var hashes []common.Hash
+	if err := rlp.DecodeBytes(data, &hashes); err != nil {
+		glog.V(logger.Error).Infof("invalid reverse diff hashes RLP for block #%d: %v", number, err)
+		return nil
+	}
+	return hashes
+}
+
+// WriteReverseDiff stores the reverse diff of the state changes of a block,
+// tracking it by block number so that side chain ones can be pruned too.
+func WriteReverseDiff(db ethdb.Database, hash common.Hash, number uint64, diff *state.ReverseDiff) error {
+	data, err := rlp.EncodeToBytes(diff)
+	if err != nil {
+		return err
+	}
+	if err := db.Put(append(append(reverseDiffPrefix, encodeBlockNumber(number)...), hash[:]...), data); err != nil {
+		return fmt.Errorf("reverse diff write fail for block #%d [%x…]: %v", number, hash[:4], err)
+	}
+	hashes := getReverseDiffHashes(db, number)
+	for _, known := range hashes {
+		if known == hash {
+			return nil
+		}
+	}
+	data, err = rlp.EncodeToBytes(append(hashes, hash))
+	if err != nil {
+		return err
+	}
+	if err := db.Put(append(reverseDiffsPrefix, encodeBlockNumber(number)...), data); err != nil {
+		return fmt.Errorf("reverse diff hashes write fail for block #%d: %v", number, err)
+	}
+	return nil
+}
+
+// DeleteReverseDiffs removes the reverse diffs of all blocks with the given
+// number, whether on the canonical chain or a side chain.
+func DeleteReverseDiffs(db ethdb.Database, number uint64) {
+	for _, hash := range getReverseDiffHashes(db, number) {
+		db.Delete(append(append(reverseDiffPrefix, encodeBlockNumber(number)...), hash[:]...))
+	}
+	db.Delete(append(reverseDiffsPrefix, encodeBlockNumber(number)...))
+}
+
+// GetTxLookupTail retrieves the number of the oldest block whose transaction
+// lookups are kept, the lookups of the blocks below having been removed.
+func GetTxLookupTail(db ethdb.Database) uint64 {
+	data, _ := db.Get(txLookupTailKey)
+	if len(data) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(data)
+}
+
+// WriteTxLookupTail stores the number of the oldest block whose transaction
+// lookups are kept.
+func WriteTxLookupTail(db ethdb.Database, number uint64) error {
+	if err := db.Put(txLookupTailKey, encodeBlockNumber(number)); err != nil {
+		return fmt.Errorf("failed to store transaction lookup tail: %v", err)
+	}
+	return nil
+}
+
+// finalizedCheckpoint is the storage format of the finalized checkpoint.
+type finalizedCheckpoint struct {
+	Number uint64
+	Hash   common.Hash
+}
+
+// GetFinalizedCheckpoint retrieves the number and hash of the most recent block
+// finalized by the validator set, a zero hash if none was.
+func GetFinalizedCheckpoint(db ethdb.Database) (uint64, common.Hash) {
+	data, _ := db.Get(finalizedKey)
+	if len(data) == 0 {
+		return 0, common.Hash{}
+	}
+	stored := new(finalizedCheckpoint)
+	if err := rlp.DecodeBytes(data, stored); err != nil {
+		glog.V(logger.Error).Infof("invalid finalized checkpoint: %v", err)
+		return 0, common.Hash{}
+	}
+	return stored.Number, stored.Hash
+}
+
+// WriteFinalizedCheckpoint stores the number and hash of the most recent block
+// finalized by the validator set.
+func WriteFinalizedCheckpoint(db ethdb.Database, number uint64, hash common.Hash) error {
+	data, err := rlp.EncodeToBytes(&finalizedCheckpoint{number, hash})
+	if err != nil {
+		return err
+	}
+	if err := db.Put(finalizedKey, data); err != nil {
+		return fmt.Errorf("failed to store finalized checkpoint: %v", err)
+	}
+	return nil
+}
+
+// DeleteFinalizedCheckpoint removes the finalized checkpoint.
+func DeleteFinalizedCheckpoint(db ethdb.Database) {
+	db.Delete(finalizedKey)
+}
+
 // GetBlockChainVersion reads the version number from db.
 func GetBlockChainVersion(db ethdb.Database) int {
 	var vsn uint
@@ -611,7 +859,7 @@ func WriteChainConfig(db ethdb.Database, hash common.Hash, cfg *params.ChainConf
 		return nil
 	}
 
-	jsonChainConfig, err := json.Marshal(cfg)
+	jsonChainConfig, err := encodeChainConfig(cfg)
 	if err != nil {
 		return err
 	}
@@ -619,19 +867,15 @@ func WriteChainConfig(db ethdb.Database, hash common.Hash, cfg *params.ChainConf
 	return db.Put(append(configPrefix, hash[:]...), jsonChainConfig)
 }
 
-// GetChainConfig will fetch the network settings based on the given hash.
+// GetChainConfig will fetch the network settings based on the given hash,
+// migrating them from older encodings if needed.
 func GetChainConfig(db ethdb.Database, hash common.Hash) (*params.ChainConfig, error) {
 	jsonChainConfig, _ := db.Get(append(configPrefix, hash[:]...))
 	if len(jsonChainConfig) == 0 {
 		return nil, ChainConfigNotFoundErr
 	}
 
-	var config params.ChainConfig
-	if err := json.Unmarshal(jsonChainConfig, &config); err != nil {
-		return nil, err
-	}
-
-	return &config, nil
+	return decodeChainConfig(jsonChainConfig)
 }
 
 // FindCommonAncestor returns the last common ancestor of two block headers
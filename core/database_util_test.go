@@ -25,6 +25,7 @@ import (
 	"testing"
 
 	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core/state"
 	"github.com/ur-technology/go-ur/core/types"
 	"github.com/ur-technology/go-ur/core/vm"
 	"github.com/ur-technology/go-ur/crypto"
@@ -609,3 +610,32 @@ func TestMipmapChain(t *testing.T) {
 		t.Error("address was included in bloom and should not have")
 	}
 }
+
+// Tests that the reverse diffs of all blocks at a height are deleted together,
+// including the ones of side chain blocks.
+func TestReverseDiffStorage(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+
+	canon, side := common.Hash{0x01}, common.Hash{0x02}
+	diff := &state.ReverseDiff{Accounts: []*state.ReverseDiffAccount{{Address: common.Address{0x03}}}}
+	for _, hash := range []common.Hash{canon, side, canon} {
+		if err := WriteReverseDiff(db, hash, 5, diff); err != nil {
+			t.Fatalf("failed to write reverse diff: %v", err)
+		}
+	}
+	if err := WriteReverseDiff(db, canon, 6, diff); err != nil {
+		t.Fatalf("failed to write reverse diff: %v", err)
+	}
+	if hashes := getReverseDiffHashes(db, 5); len(hashes) != 2 {
+		t.Fatalf("tracked hash count mismatch: have %d, want 2", len(hashes))
+	}
+	DeleteReverseDiffs(db, 5)
+	for _, hash := range []common.Hash{canon, side} {
+		if GetReverseDiff(db, hash, 5) != nil {
+			t.Errorf("reverse diff of block %x retained", hash[:1])
+		}
+	}
+	if GetReverseDiff(db, canon, 6) == nil {
+		t.Errorf("reverse diff of another height deleted")
+	}
+}
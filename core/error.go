@@ -85,6 +85,25 @@ func IsValidationErr(err error) bool {
 	return ok
 }
 
+// Reward totals error. Thrown if the number of signups or the total wei of a
+// block header don't match the ones derived from its transactions
+type RewardErr struct {
+	Message string
+}
+
+func (err *RewardErr) Error() string {
+	return err.Message
+}
+
+func RewardError(format string, v ...interface{}) *RewardErr {
+	return &RewardErr{Message: fmt.Sprintf(format, v...)}
+}
+
+func IsRewardErr(err error) bool {
+	_, ok := err.(*RewardErr)
+	return ok
+}
+
 type NonceErr struct {
 	Message string
 	Is, Exp uint64
@@ -122,6 +141,7 @@ func IsBlockNonceErr(err error) bool {
 
 type InvalidTxErr struct {
 	Message string
+	Err     error // Underlying reason the transaction is invalid
 }
 
 func (err *InvalidTxErr) Error() string {
@@ -129,7 +149,7 @@ func (err *InvalidTxErr) Error() string {
 }
 
 func InvalidTxError(err error) *InvalidTxErr {
-	return &InvalidTxErr{fmt.Sprintf("%v", err)}
+	return &InvalidTxErr{Message: fmt.Sprintf("%v", err), Err: err}
 }
 
 func IsInvalidTxErr(err error) bool {
@@ -137,6 +157,37 @@ func IsInvalidTxErr(err error) bool {
 	return ok
 }
 
+// KnownTxErr is returned when a transaction is already present in the pool.
+type KnownTxErr struct {
+	Hash common.Hash
+}
+
+func (err *KnownTxErr) Error() string {
+	return fmt.Sprintf("Known transaction: %x", err.Hash[:4])
+}
+
+// IsKnownTxErr returns true for already known transaction errors.
+func IsKnownTxErr(err error) bool {
+	_, ok := err.(*KnownTxErr)
+	return ok
+}
+
+// RewardRuleErr is returned when a signup transaction would not be honoured by
+// the reward rules, e.g. because its signup chain is invalid.
+type RewardRuleErr struct {
+	Message string
+}
+
+func (err *RewardRuleErr) Error() string {
+	return err.Message
+}
+
+// IsRewardRuleErr returns true for reward rule violations.
+func IsRewardRuleErr(err error) bool {
+	_, ok := err.(*RewardRuleErr)
+	return ok
+}
+
 type TDError struct {
 	a, b *big.Int
 }
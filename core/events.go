@@ -27,6 +27,29 @@ import (
 // TxPreEvent is posted when a transaction enters the transaction pool.
 type TxPreEvent struct{ Tx *types.Transaction }
 
+// TxStatus is the status change of a pooled transaction reported by a
+// TxStatusEvent.
+type TxStatus string
+
+const (
+	TxStatusPromoted    TxStatus = "promoted"    // Moved from the queue to the executable pending set
+	TxStatusInvalidated TxStatus = "invalidated" // Moved back from the pending set to the queue, no longer executable
+	TxStatusIncluded    TxStatus = "included"    // Removed as included in an imported block
+	TxStatusReplaced    TxStatus = "replaced"    // Replaced by a transaction with the same nonce and a higher price
+	TxStatusDropped     TxStatus = "dropped"     // Rejected or evicted, for the reason given
+)
+
+// TxStatusEvent is posted when the transaction pool promotes, invalidates,
+// replaces or drops a transaction, or removes it as included in a block. The
+// events of the pool are posted in the order they happened.
+type TxStatusEvent struct {
+	Tx          *types.Transaction
+	Status      TxStatus
+	Reason      TxDropReason       // Reason of a drop or replacement
+	Err         error              // Validation error of rejected transactions
+	Replacement *types.Transaction // Transaction replacing a replaced one
+}
+
 // TxPostEvent is posted when a transaction has been processed.
 type TxPostEvent struct{ Tx *types.Transaction }
 
@@ -0,0 +1,232 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package forkid implements the fork identifier exchanged in the handshake,
+// which lets nodes tell peers following another chain or fork schedule apart
+// before wasting any time syncing with them.
+//
+// The identifier is a checksum of the genesis hash and of the fork blocks the
+// chain already passed, along with the next scheduled fork block, as specified
+// by EIP-2124.
+package forkid
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"math/big"
+	"sort"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/params"
+	"github.com/ur-technology/go-ur/rlp"
+)
+
+var (
+	// ErrRemoteStale is returned by the filter if the remote peer is at a fork
+	// we already passed, but doesn't know of the fork that followed it.
+	ErrRemoteStale = errors.New("remote needs update")
+
+	// ErrLocalIncompatibleOrStale is returned by the filter if the remote peer
+	// follows a fork schedule we don't know of, either because it is on another
+	// chain or because we need to update.
+	ErrLocalIncompatibleOrStale = errors.New("local incompatible or needs update")
+)
+
+// ID is the fork identifier of a node.
+type ID struct {
+	Hash [4]byte // CRC32 checksum of the genesis hash and the fork blocks passed
+	Next uint64  // Block number of the next scheduled fork, 0 if none
+}
+
+// String implements fmt.Stringer.
+func (id ID) String() string {
+	return fmt.Sprintf("%x/%d", id.Hash, id.Next)
+}
+
+// Filter checks the fork identifier of a remote peer against the local chain,
+// returning an error if the peer is incompatible.
+type Filter func(id ID) error
+
+// NewID calculates the fork identifier of a chain with its head at the given
+// block number.
+func NewID(config *params.ChainConfig, genesis common.Hash, head uint64) ID {
+	hash := genesisChecksum(config, genesis)
+	for _, fork := range gatherForks(config) {
+		if fork > head {
+			return ID{Hash: checksumToBytes(hash), Next: fork}
+		}
+		hash = checksumUpdate(hash, fork)
+	}
+	return ID{Hash: checksumToBytes(hash)}
+}
+
+// NewFilter creates a filter accepting the fork identifiers of the peers which
+// are compatible with the local chain, whose head is retrieved with headfn.
+func NewFilter(config *params.ChainConfig, genesis common.Hash, headfn func() uint64) Filter {
+	// Calculate the checksums of all the fork stages of the local chain
+	forks := gatherForks(config)
+	sums := make([][4]byte, len(forks)+1)
+
+	hash := genesisChecksum(config, genesis)
+	sums[0] = checksumToBytes(hash)
+	for i, fork := range forks {
+		hash = checksumUpdate(hash, fork)
+		sums[i+1] = checksumToBytes(hash)
+	}
+	// Add a sentinel fork so the last stage is never passed
+	forks = append(forks, math.MaxUint64)
+
+	return func(id ID) error {
+		head := headfn()
+
+		// Find the local fork stage, the first whose fork block isn't passed yet
+		stage := 0
+		for head >= forks[stage] {
+			stage++
+		}
+		// Both at the same stage: compatible unless we passed the remote's next fork
+		if sums[stage] == id.Hash {
+			if id.Next > 0 && head >= id.Next {
+				return ErrLocalIncompatibleOrStale
+			}
+			return nil
+		}
+		// Remote at an earlier stage: it must know of the fork that followed
+		for i := 0; i < stage; i++ {
+			if sums[i] == id.Hash {
+				if forks[i] != id.Next {
+					return ErrRemoteStale
+				}
+				return nil
+			}
+		}
+		// Remote at a later stage we know of, we're just behind
+		for i := stage + 1; i < len(sums); i++ {
+			if sums[i] == id.Hash {
+				return nil
+			}
+		}
+		return ErrLocalIncompatibleOrStale
+	}
+}
+
+// genesisChecksum calculates the checksum of the first fork stage. The UR reward
+// parameters of private networks apply from the first block on, so they're part
+// of it too.
+func genesisChecksum(config *params.ChainConfig, genesis common.Hash) uint32 {
+	hash := crc32.ChecksumIEEE(genesis[:])
+	if config.UR != nil {
+		hash = crc32.Update(hash, crc32.IEEETable, encodeURConfig(config.UR))
+	}
+	return hash
+}
+
+// encodeURConfig encodes the UR reward parameters for the checksum, independent
+// of their JSON representation. Every parameter is wrapped in a list holding it
+// only if set, as unset ones keep the compiled in values rather than being zero.
+// The privileged senders are sorted, their order carrying no meaning.
+func encodeURConfig(ur *params.URConfig) []byte {
+	optional := func(set bool, value interface{}) []interface{} {
+		if !set {
+			return []interface{}{}
+		}
+		return []interface{}{value}
+	}
+	privileged := make([]params.URPrivilegedSender, len(ur.Privileged))
+	copy(privileged, ur.Privileged)
+	sort.Sort(privilegedSenders(privileged))
+	blob, err := rlp.EncodeToBytes([]interface{}{
+		optional(ur.BlockReward != nil, ur.BlockReward),
+		optional(ur.SignupReward != nil, ur.SignupReward),
+		optional(ur.MembersSignupRewards != nil, ur.MembersSignupRewards),
+		optional(ur.TotalSignupRewards != nil, ur.TotalSignupRewards),
+		optional(ur.URFutureFundFee != nil, ur.URFutureFundFee),
+		optional(ur.ManagementFee != nil, ur.ManagementFee),
+		optional(ur.ManagementFeeCap != nil, ur.ManagementFeeCap),
+		optional(ur.Privileged != nil, privileged),
+	})
+	if err != nil {
+		panic(fmt.Sprintf("failed to encode UR parameters: %v", err))
+	}
+	return blob
+}
+
+type privilegedSenders []params.URPrivilegedSender
+
+func (p privilegedSenders) Len() int      { return len(p) }
+func (p privilegedSenders) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p privilegedSenders) Less(i, j int) bool {
+	return bytes.Compare(p[i].Address[:], p[j].Address[:]) < 0
+}
+
+// checksumUpdate folds a fork block number into the checksum.
+func checksumUpdate(hash uint32, fork uint64) uint32 {
+	var blob [8]byte
+	binary.BigEndian.PutUint64(blob[:], fork)
+	return crc32.Update(hash, crc32.IEEETable, blob[:])
+}
+
+// checksumToBytes converts a checksum into its big endian byte form.
+func checksumToBytes(hash uint32) [4]byte {
+	var blob [4]byte
+	binary.BigEndian.PutUint32(blob[:], hash)
+	return blob
+}
+
+// gatherForks returns the distinct fork blocks of a chain configuration in
+// ascending order, including the reward forks of UR. Forks at the genesis
+// block are part of the genesis rules and skipped.
+func gatherForks(config *params.ChainConfig) []uint64 {
+	blocks := []*big.Int{
+		config.HomesteadBlock,
+		config.DAOForkBlock,
+		config.EIP150Block,
+		config.EIP155Block,
+		config.EIP158Block,
+		config.MinGasPriceBlock,
+		config.FeeContractBlock,
+		config.UnclePolicyBlock,
+	}
+	for _, fork := range config.DifficultyForks {
+		blocks = append(blocks, fork.Block)
+	}
+	var forks []uint64
+	for _, block := range blocks {
+		if block != nil && block.Sign() > 0 && block.BitLen() <= 64 {
+			forks = append(forks, block.Uint64())
+		}
+	}
+	sort.Sort(uint64s(forks))
+
+	// Deduplicate the forks activated at the same block
+	for i := 1; i < len(forks); i++ {
+		if forks[i] == forks[i-1] {
+			forks = append(forks[:i], forks[i+1:]...)
+			i--
+		}
+	}
+	return forks
+}
+
+type uint64s []uint64
+
+func (s uint64s) Len() int           { return len(s) }
+func (s uint64s) Less(i, j int) bool { return s[i] < s[j] }
+func (s uint64s) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
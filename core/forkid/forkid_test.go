@@ -0,0 +1,128 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package forkid
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/params"
+)
+
+var testGenesis = common.HexToHash("0xd4e56740f876aef8c010b86a40d5f56745a118d0906a34e69aec8c0db1cb8fa3")
+
+// testConfig forks at blocks 10, 20 (twice, Homestead and the fee contract) and
+// 30 (a difficulty fork), the EIP150 fork at genesis is part of the genesis rules.
+var testConfig = &params.ChainConfig{
+	HomesteadBlock:   big.NewInt(20),
+	EIP150Block:      big.NewInt(0),
+	EIP155Block:      big.NewInt(10),
+	FeeContractBlock: big.NewInt(20),
+	DifficultyForks:  []params.DifficultyFork{{Block: big.NewInt(30), Algorithm: params.DifficultyHomestead}},
+}
+
+// Tests that the fork blocks are gathered in order, without duplicates and
+// without the genesis ones.
+func TestGatherForks(t *testing.T) {
+	if forks, want := gatherForks(testConfig), []uint64{10, 20, 30}; !reflect.DeepEqual(forks, want) {
+		t.Errorf("forks mismatch: have %v, want %v", forks, want)
+	}
+}
+
+// Tests that the identifiers change with the fork blocks passed.
+func TestNewID(t *testing.T) {
+	var (
+		genesis = checksumToBytes(genesisChecksum(testConfig, testGenesis))
+		fork10  = checksumToBytes(checksumUpdate(genesisChecksum(testConfig, testGenesis), 10))
+		fork20  = checksumToBytes(checksumUpdate(checksumUpdate(genesisChecksum(testConfig, testGenesis), 10), 20))
+	)
+	tests := []struct {
+		head uint64
+		want ID
+	}{
+		{0, ID{Hash: genesis, Next: 10}},
+		{9, ID{Hash: genesis, Next: 10}},
+		{10, ID{Hash: fork10, Next: 20}},
+		{25, ID{Hash: fork20, Next: 30}},
+	}
+	for i, tt := range tests {
+		if id := NewID(testConfig, testGenesis, tt.head); id != tt.want {
+			t.Errorf("test %d: id mismatch: have %v, want %v", i, id, tt.want)
+		}
+	}
+	if id := NewID(testConfig, testGenesis, 100); id.Next != 0 {
+		t.Errorf("next fork announced past the last one: %v", id)
+	}
+	// Private networks with other reward parameters are on another chain
+	ur := *testConfig
+	ur.UR = &params.URConfig{BlockReward: big.NewInt(1)}
+	if NewID(&ur, testGenesis, 0) == NewID(testConfig, testGenesis, 0) {
+		t.Errorf("UR reward parameters not part of the identifier")
+	}
+	// Unset parameters differ from zero ones, the order of privileged senders doesn't matter
+	zero := *testConfig
+	zero.UR = &params.URConfig{BlockReward: big.NewInt(1), SignupReward: new(big.Int)}
+	if NewID(&zero, testGenesis, 0) == NewID(&ur, testGenesis, 0) {
+		t.Errorf("zero UR parameter not told apart from an unset one")
+	}
+	senders := []params.URPrivilegedSender{{Address: common.Address{1}}, {Address: common.Address{2}, Receiver: common.Address{3}}}
+	ordered, reordered := *testConfig, *testConfig
+	ordered.UR = &params.URConfig{Privileged: senders}
+	reordered.UR = &params.URConfig{Privileged: []params.URPrivilegedSender{senders[1], senders[0]}}
+	if NewID(&ordered, testGenesis, 0) != NewID(&reordered, testGenesis, 0) {
+		t.Errorf("identifier depends on the order of the privileged senders")
+	}
+	// The checksum must not change along with the JSON encoding of the parameters
+	if have, want := common.Bytes2Hex(encodeURConfig(ur.UR)), "c9c101c0c0c0c0c0c0c0"; have != want {
+		t.Errorf("UR parameter encoding mismatch: have %s, want %s", have, want)
+	}
+}
+
+// Tests that the filter accepts the peers on the same chain at any fork stage,
+// unless they missed a fork, and rejects the ones on other chains.
+func TestFilter(t *testing.T) {
+	other := common.HexToHash("0x41941023680923e0fe4d74a34bdac8141f2540e3ae90623718e47d66d1ca4a2d")
+	tests := []struct {
+		head uint64
+		id   ID
+		err  error
+	}{
+		// Same stage, same next fork
+		{15, NewID(testConfig, testGenesis, 15), nil},
+		// Same stage, remote not aware of the next fork yet
+		{15, ID{Hash: NewID(testConfig, testGenesis, 15).Hash}, nil},
+		// Same stage, remote announces a fork we passed without forking
+		{15, ID{Hash: NewID(testConfig, testGenesis, 15).Hash, Next: 12}, ErrLocalIncompatibleOrStale},
+		// Remote behind, aware of the fork following its stage
+		{25, NewID(testConfig, testGenesis, 5), nil},
+		// Remote behind, not aware of the fork following its stage
+		{25, ID{Hash: NewID(testConfig, testGenesis, 5).Hash, Next: 11}, ErrRemoteStale},
+		// Remote ahead, at a stage we know of
+		{5, NewID(testConfig, testGenesis, 35), nil},
+		// Remote on another chain
+		{5, NewID(testConfig, other, 5), ErrLocalIncompatibleOrStale},
+	}
+	for i, tt := range tests {
+		head := tt.head
+		filter := NewFilter(testConfig, testGenesis, func() uint64 { return head })
+		if err := filter(tt.id); err != tt.err {
+			t.Errorf("test %d: filter error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+}
@@ -29,65 +29,99 @@ import (
 	"github.com/ur-technology/go-ur/common"
 	"github.com/ur-technology/go-ur/core/state"
 	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/crypto"
 	"github.com/ur-technology/go-ur/ethdb"
 	"github.com/ur-technology/go-ur/logger"
 	"github.com/ur-technology/go-ur/logger/glog"
 	"github.com/ur-technology/go-ur/params"
+	"github.com/ur-technology/go-ur/rlp"
 )
 
-// WriteGenesisBlock writes the genesis block to the database as block number 0
-func WriteGenesisBlock(chainDb ethdb.Database, reader io.Reader) (*types.Block, error) {
-	contents, err := ioutil.ReadAll(reader)
-	if err != nil {
-		return nil, err
-	}
+// GenesisSpec is the JSON genesis specification accepted by WriteGenesisBlock.
+type GenesisSpec struct {
+	ChainConfig *params.ChainConfig           `json:"config,omitempty"`
+	Nonce       string                        `json:"nonce"`
+	Timestamp   string                        `json:"timestamp"`
+	ParentHash  string                        `json:"parentHash"`
+	ExtraData   string                        `json:"extraData"`
+	GasLimit    string                        `json:"gasLimit"`
+	Difficulty  string                        `json:"difficulty"`
+	Mixhash     string                        `json:"mixhash"`
+	Coinbase    string                        `json:"coinbase"`
+	NSignups    string                        `json:"nSignups,omitempty"`
+	TotalWei    string                        `json:"totalWei,omitempty"`
+	Alloc       map[string]GenesisSpecAccount `json:"alloc"`
+}
 
-	var genesis struct {
-		ChainConfig *params.ChainConfig `json:"config"`
-		Nonce       string
-		Timestamp   string
-		ParentHash  string
-		ExtraData   string
-		GasLimit    string
-		Difficulty  string
-		Mixhash     string
-		Coinbase    string
-		Alloc       map[string]struct {
-			Code    string
-			Storage map[string]string
-			Balance string
-		}
-	}
+// GenesisSpecAccount is an account allocated in the genesis state.
+type GenesisSpecAccount struct {
+	Code    string            `json:"code,omitempty"`
+	Storage map[string]string `json:"storage,omitempty"`
+	Balance string            `json:"balance"`
+}
 
-	if err := json.Unmarshal(contents, &genesis); err != nil {
+// ReadGenesisSpec reconstructs the genesis specification of the chain stored in
+// the database from its genesis block, chain configuration and genesis state.
+// Initializing a new database with the result yields the same genesis block.
+func ReadGenesisSpec(db ethdb.Database) (*GenesisSpec, error) {
+	hash := GetCanonicalHash(db, 0)
+	genesis := GetBlock(db, hash, 0)
+	if genesis == nil {
+		return nil, ErrNoGenesis
+	}
+	config, err := GetChainConfig(db, hash)
+	if err != nil && err != ChainConfigNotFoundErr {
 		return nil, err
 	}
-
-	// creating with empty hash always works
-	statedb, _ := state.New(common.Hash{}, chainDb)
-	for addr, account := range genesis.Alloc {
-		address := common.HexToAddress(addr)
-		statedb.AddBalance(address, common.String2Big(account.Balance))
-		statedb.SetCode(address, common.Hex2Bytes(account.Code))
+	statedb, err := state.New(genesis.Root(), db)
+	if err != nil {
+		return nil, fmt.Errorf("genesis state unavailable: %v", err)
+	}
+	spec := &GenesisSpec{
+		ChainConfig: config,
+		Nonce:       fmt.Sprintf("0x%x", genesis.Header().Nonce[:]),
+		Timestamp:   fmt.Sprintf("0x%x", genesis.Time()),
+		ParentHash:  genesis.ParentHash().Hex(),
+		ExtraData:   fmt.Sprintf("0x%x", genesis.Extra()),
+		GasLimit:    fmt.Sprintf("0x%x", genesis.GasLimit()),
+		Difficulty:  fmt.Sprintf("0x%x", genesis.Difficulty()),
+		Mixhash:     genesis.MixDigest().Hex(),
+		Coinbase:    genesis.Coinbase().Hex(),
+		Alloc:       make(map[string]GenesisSpecAccount),
+	}
+	if n := genesis.NSignups(); n != nil && n.Sign() != 0 {
+		spec.NSignups = fmt.Sprintf("0x%x", n)
+	}
+	if w := genesis.TotalWei(); w != nil && w.Sign() != 0 {
+		spec.TotalWei = fmt.Sprintf("0x%x", w)
+	}
+	for addr, account := range statedb.RawDump().Accounts {
+		alloc := GenesisSpecAccount{
+			Code:    account.Code,
+			Balance: account.Balance,
+		}
+		// Storage values are kept RLP encoded in the trie, unwrap them
 		for key, value := range account.Storage {
-			statedb.SetState(address, common.HexToHash(key), common.HexToHash(value))
+			_, content, _, err := rlp.Split(common.Hex2Bytes(value))
+			if err != nil {
+				return nil, fmt.Errorf("invalid storage of %s: %v", addr, err)
+			}
+			if alloc.Storage == nil {
+				alloc.Storage = make(map[string]string)
+			}
+			alloc.Storage[common.HexToHash(key).Hex()] = common.BytesToHash(content).Hex()
 		}
+		spec.Alloc[addr] = alloc
 	}
-	root, stateBatch := statedb.CommitBatch(false)
-
-	difficulty := common.String2Big(genesis.Difficulty)
-	block := types.NewBlock(&types.Header{
-		Nonce:      types.EncodeNonce(common.String2Big(genesis.Nonce).Uint64()),
-		Time:       common.String2Big(genesis.Timestamp),
-		ParentHash: common.HexToHash(genesis.ParentHash),
-		Extra:      common.FromHex(genesis.ExtraData),
-		GasLimit:   common.String2Big(genesis.GasLimit),
-		Difficulty: difficulty,
-		MixDigest:  common.HexToHash(genesis.Mixhash),
-		Coinbase:   common.HexToAddress(genesis.Coinbase),
-		Root:       root,
-	}, nil, nil, nil)
+	return spec, nil
+}
 
+// WriteGenesisBlock writes the genesis block to the database as block number 0
+func WriteGenesisBlock(chainDb ethdb.Database, reader io.Reader) (*types.Block, error) {
+	block, config, stateBatch, err := makeGenesisBlock(chainDb, reader)
+	if err != nil {
+		return nil, err
+	}
 	if block := GetBlock(chainDb, block.Hash(), block.NumberU64()); block != nil {
 		glog.V(logger.Info).Infoln("Genesis block already in chain. Writing canonical number")
 		err := WriteCanonicalHash(chainDb, block.Hash(), block.NumberU64())
@@ -100,7 +134,7 @@ func WriteGenesisBlock(chainDb ethdb.Database, reader io.Reader) (*types.Block,
 	if err := stateBatch.Write(); err != nil {
 		return nil, fmt.Errorf("cannot write state: %v", err)
 	}
-	if err := WriteTd(chainDb, block.Hash(), block.NumberU64(), difficulty); err != nil {
+	if err := WriteTd(chainDb, block.Hash(), block.NumberU64(), block.Difficulty()); err != nil {
 		return nil, err
 	}
 	if err := WriteBlock(chainDb, block); err != nil {
@@ -115,13 +149,83 @@ func WriteGenesisBlock(chainDb ethdb.Database, reader io.Reader) (*types.Block,
 	if err := WriteHeadBlockHash(chainDb, block.Hash()); err != nil {
 		return nil, err
 	}
-	if err := WriteChainConfig(chainDb, block.Hash(), genesis.ChainConfig); err != nil {
+	if err := WriteChainConfig(chainDb, block.Hash(), config); err != nil {
 		return nil, err
 	}
 
 	return block, nil
 }
 
+// ParseGenesisBlock assembles the genesis block and chain configuration defined
+// by the given JSON genesis specification without persisting anything, allowing
+// the resulting hash to be verified before a database is initialized with it.
+func ParseGenesisBlock(reader io.Reader) (*types.Block, *params.ChainConfig, error) {
+	db, _ := ethdb.NewMemDatabase()
+	block, config, _, err := makeGenesisBlock(db, reader)
+	return block, config, err
+}
+
+// makeGenesisBlock parses a JSON genesis specification and assembles the genesis
+// block from it. The genesis state is accumulated into the returned batch, which
+// the caller needs to write out if the block is to be persisted.
+func makeGenesisBlock(chainDb ethdb.Database, reader io.Reader) (*types.Block, *params.ChainConfig, ethdb.Batch, error) {
+	contents, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var genesis GenesisSpec
+	if err := json.Unmarshal(contents, &genesis); err != nil {
+		return nil, nil, nil, err
+	}
+	if genesis.ChainConfig != nil {
+		if err := ValidateURConfig(genesis.ChainConfig.UR); err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid UR configuration: %v", err)
+		}
+		if err := ValidateDifficultyForks(genesis.ChainConfig.DifficultyForks); err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid difficulty forks: %v", err)
+		}
+		if err := ValidateUnclePolicy(genesis.ChainConfig.UnclePolicy); err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid uncle policy: %v", err)
+		}
+	}
+
+	// creating with empty hash always works
+	statedb, _ := state.New(common.Hash{}, chainDb)
+	for addr, account := range genesis.Alloc {
+		address := common.HexToAddress(addr)
+		statedb.AddBalance(address, common.String2Big(account.Balance))
+		statedb.SetCode(address, common.Hex2Bytes(account.Code))
+		for key, value := range account.Storage {
+			statedb.SetState(address, common.HexToHash(key), common.HexToHash(value))
+		}
+	}
+	root, stateBatch := statedb.CommitBatch(false)
+
+	difficulty := common.String2Big(genesis.Difficulty)
+	header := &types.Header{
+		Nonce:      types.EncodeNonce(common.String2Big(genesis.Nonce).Uint64()),
+		Time:       common.String2Big(genesis.Timestamp),
+		ParentHash: common.HexToHash(genesis.ParentHash),
+		Extra:      common.FromHex(genesis.ExtraData),
+		GasLimit:   common.String2Big(genesis.GasLimit),
+		Difficulty: difficulty,
+		MixDigest:  common.HexToHash(genesis.Mixhash),
+		Coinbase:   common.HexToAddress(genesis.Coinbase),
+		Root:       root,
+	}
+	// Private networks may start with signups accounted for already
+	if genesis.NSignups != "" {
+		header.NSignups = common.String2Big(genesis.NSignups)
+	}
+	if genesis.TotalWei != "" {
+		header.TotalWei = common.String2Big(genesis.TotalWei)
+	}
+	block := types.NewBlock(header, nil, nil, nil)
+
+	return block, genesis.ChainConfig, stateBatch, nil
+}
+
 // GenesisBlockForTesting creates a block in which addr has the given wei balance.
 // The state trie of the block is written to db. the passed db needs to contain a state root
 func GenesisBlockForTesting(db ethdb.Database, addr common.Address, balance *big.Int) *types.Block {
@@ -232,3 +336,41 @@ func OlympicGenesisBlock() string {
 		}
 	}`, types.EncodeNonce(42), params.GenesisGasLimit.Bytes(), params.GenesisDifficulty.Bytes())
 }
+
+// Well known keys of the developer mode chain: a prefunded account and a
+// privileged sender able to sign up members. Both keys are public, accounts
+// using them must never hold value on a real network.
+var (
+	DevAccountKey, _    = crypto.HexToECDSA("9505b7510144d8196ca9d3c2ae19e536768cf4c2b421cf3fb1772b880df21a69")
+	DevPrivilegedKey, _ = crypto.HexToECDSA("e9c607df06a25efe342b520e0309ee96058e2c07b4802403a516539472f5a5fa")
+)
+
+// DevGenesisBlock assembles a JSON string representing the genesis block of the
+// developer mode chain. All forks are active from the genesis, the developer
+// account is prefunded and the privileged sender is the only one of the chain,
+// its signup fees being paid to the developer account.
+func DevGenesisBlock() string {
+	var (
+		account    = crypto.PubkeyToAddress(DevAccountKey.PublicKey)
+		privileged = crypto.PubkeyToAddress(DevPrivilegedKey.PublicKey)
+	)
+	return fmt.Sprintf(`{
+		"config": {
+			"chainId": 1337,
+			"homesteadBlock": 0,
+			"eip150Block": 0,
+			"eip155Block": 0,
+			"eip158Block": 0,
+			"ur": {
+				"privileged": [{"address": "0x%x", "receiver": "0x%x", "urff": "0x%x"}]
+			}
+		},
+		"nonce":"0x%x",
+		"gasLimit":"0x%x",
+		"difficulty":"0x%x",
+		"alloc": {
+			"%x": {"balance": "1000000000000000000000000000"},
+			"%x": {"balance": "1000000000000000000000"}
+		}
+	}`, privileged, account, account, types.EncodeNonce(42), params.GenesisGasLimit.Bytes(), params.MinimumDifficulty.Bytes(), account, privileged)
+}
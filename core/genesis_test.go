@@ -0,0 +1,188 @@
+// Copyright 2015 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core/state"
+	"github.com/ur-technology/go-ur/crypto"
+	"github.com/ur-technology/go-ur/ethdb"
+)
+
+// Tests that parsing a genesis specification yields the same block that writing
+// it would, without touching any database.
+func TestParseGenesisBlock(t *testing.T) {
+	genesis := `{
+		"alloc"      : {"0x0000000000000000000000000000000000000001": {"balance": "1000"}},
+		"difficulty" : "0x20000",
+		"gasLimit"   : "0x2fefd8",
+		"nonce"      : "0x0000000000000042",
+		"config"     : {"homesteadBlock": 5}
+	}`
+	parsed, config, err := ParseGenesisBlock(strings.NewReader(genesis))
+	if err != nil {
+		t.Fatalf("failed to parse genesis: %v", err)
+	}
+	if config == nil || config.HomesteadBlock.Int64() != 5 {
+		t.Errorf("chain config mismatch: have %v, want homestead block 5", config)
+	}
+	db, _ := ethdb.NewMemDatabase()
+	written, err := WriteGenesisBlock(db, strings.NewReader(genesis))
+	if err != nil {
+		t.Fatalf("failed to write genesis: %v", err)
+	}
+	if parsed.Hash() != written.Hash() {
+		t.Errorf("genesis hash mismatch: parsed %x, written %x", parsed.Hash(), written.Hash())
+	}
+}
+
+// Tests that the genesis specification read back from a database initializes
+// an identical chain.
+func TestReadGenesisSpec(t *testing.T) {
+	genesis := `{
+		"alloc"      : {
+			"0x0000000000000000000000000000000000000001": {"balance": "1000"},
+			"0x0000000000000000000000000000000000000002": {
+				"balance": "0x10",
+				"code"   : "6001600055",
+				"storage": {"0x01": "0x2a", "0x02": "0x0100000000000000000000000000000000000000000000000000000000000000"}
+			}
+		},
+		"difficulty" : "0x20000",
+		"gasLimit"   : "0x2fefd8",
+		"nonce"      : "0x0000000000000042",
+		"timestamp"  : "0x5",
+		"extraData"  : "0x1234",
+		"coinbase"   : "0x0000000000000000000000000000000000000003",
+		"nSignups"   : "0x3",
+		"totalWei"   : "0x1b1ae4d6e2ef500000",
+		"config"     : {"homesteadBlock": 5}
+	}`
+	db, _ := ethdb.NewMemDatabase()
+	written, err := WriteGenesisBlock(db, strings.NewReader(genesis))
+	if err != nil {
+		t.Fatalf("failed to write genesis: %v", err)
+	}
+	spec, err := ReadGenesisSpec(db)
+	if err != nil {
+		t.Fatalf("failed to read genesis spec: %v", err)
+	}
+	blob, err := json.Marshal(spec)
+	if err != nil {
+		t.Fatalf("failed to encode genesis spec: %v", err)
+	}
+	parsed, config, err := ParseGenesisBlock(strings.NewReader(string(blob)))
+	if err != nil {
+		t.Fatalf("failed to parse dumped genesis: %v", err)
+	}
+	if parsed.Hash() != written.Hash() {
+		t.Errorf("genesis hash mismatch: dumped %x, original %x\n%s", parsed.Hash(), written.Hash(), blob)
+	}
+	if config == nil || config.HomesteadBlock.Int64() != 5 {
+		t.Errorf("chain config mismatch: have %v, want homestead block 5", config)
+	}
+	if parsed.NSignups().Int64() != 3 || parsed.TotalWei().String() != "500000000000000000000" {
+		t.Errorf("seeded totals mismatch: have %v signups, %v wei", parsed.NSignups(), parsed.TotalWei())
+	}
+	// Uninitialized databases have no genesis to read
+	empty, _ := ethdb.NewMemDatabase()
+	if _, err := ReadGenesisSpec(empty); err != ErrNoGenesis {
+		t.Errorf("empty database error mismatch: have %v, want %v", err, ErrNoGenesis)
+	}
+}
+
+// Tests that the UR reward parameters of a genesis configuration are validated
+// when parsing it and override the compiled in ones once applied.
+func TestGenesisURConfig(t *testing.T) {
+	invalid := map[string]string{
+		`{"blockReward": -1}`:                 "negative blockReward -1",
+		`{"membersSignupRewards": [1, 2, 3]}`: "need 7 membersSignupRewards tiers, have 3",
+		`{"membersSignupRewards": [1, 1, 1, 1, 1, 1, 1], "totalSignupRewards": 6}`:     "membersSignupRewards 7 exceed totalSignupRewards 6",
+		`{"privileged": [{"receiver": "0x0000000000000000000000000000000000000001"}]}`: "privileged sender without address",
+	}
+	for ur, want := range invalid {
+		genesis := `{"difficulty": "0x20000", "gasLimit": "0x2fefd8", "config": {"ur": ` + ur + `}}`
+		if _, _, err := ParseGenesisBlock(strings.NewReader(genesis)); err == nil || err.Error() != "invalid UR configuration: "+want {
+			t.Errorf("%s: error mismatch: have %v, want %q", ur, err, want)
+		}
+	}
+	genesis := `{
+		"difficulty" : "0x20000",
+		"gasLimit"   : "0x2fefd8",
+		"config"     : {"ur": {
+			"blockReward"         : 5000000000000000000,
+			"membersSignupRewards": [1, 2, 3, 4, 5, 6, 7],
+			"totalSignupRewards"  : 30,
+			"privileged"          : [{
+				"address" : "0x0000000000000000000000000000000000000001",
+				"receiver": "0x0000000000000000000000000000000000000002",
+				"urff"    : "0x0000000000000000000000000000000000000003"
+			}]
+		}}
+	}`
+	_, config, err := ParseGenesisBlock(strings.NewReader(genesis))
+	if err != nil {
+		t.Fatalf("failed to parse genesis: %v", err)
+	}
+	rewards := Rewards(config)
+	if rewards.BlockReward.String() != "5000000000000000000" || rewards.TotalSignupRewards.Int64() != 30 || rewards.MembersSignupRewards[6].Int64() != 7 {
+		t.Errorf("rewards not applied: block %v, total %v, members %v", rewards.BlockReward, rewards.TotalSignupRewards, rewards.MembersSignupRewards)
+	}
+	if rewards.SignupReward != SignupReward {
+		t.Errorf("unset signup reward overridden: have %v, want %v", rewards.SignupReward, SignupReward)
+	}
+	sender, receiver := common.BytesToAddress([]byte{1}), common.BytesToAddress([]byte{2})
+	if len(rewards.Privileged) != 1 || rewards.Privileged[sender].Receiver != receiver {
+		t.Errorf("privileged senders not applied: %v", rewards.Privileged)
+	}
+	// The compiled in rewards of other chains are left alone
+	if BlockReward.Cmp(rewards.BlockReward) == 0 || IsPrivilegedAddress(nil, sender) {
+		t.Errorf("default rewards overridden by chain configuration")
+	}
+}
+
+// Tests that the developer mode genesis funds the developer account and makes
+// the developer privileged sender the only one of the chain.
+func TestDevGenesisBlock(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	block, err := WriteGenesisBlock(db, strings.NewReader(DevGenesisBlock()))
+	if err != nil {
+		t.Fatalf("failed to write developer genesis: %v", err)
+	}
+	config, err := GetChainConfig(db, block.Hash())
+	if err != nil {
+		t.Fatalf("failed to read chain config: %v", err)
+	}
+	var (
+		account    = crypto.PubkeyToAddress(DevAccountKey.PublicKey)
+		privileged = crypto.PubkeyToAddress(DevPrivilegedKey.PublicKey)
+	)
+	if !config.IsEIP155(new(big.Int)) || config.UR == nil || len(config.UR.Privileged) != 1 || config.UR.Privileged[0].Address != privileged {
+		t.Fatalf("chain config mismatch: %v, UR %+v", config, config.UR)
+	}
+	statedb, _ := state.New(block.Root(), db)
+	for _, addr := range []common.Address{account, privileged} {
+		if statedb.GetBalance(addr).Sign() <= 0 {
+			t.Errorf("account %x not funded", addr)
+		}
+	}
+}
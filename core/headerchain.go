@@ -22,18 +22,17 @@ import (
 	"math"
 	"math/big"
 	mrand "math/rand"
-	"runtime"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/consensus"
 	"github.com/ur-technology/go-ur/core/types"
 	"github.com/ur-technology/go-ur/ethdb"
 	"github.com/ur-technology/go-ur/logger"
 	"github.com/ur-technology/go-ur/logger/glog"
 	"github.com/ur-technology/go-ur/params"
-	"github.com/ur-technology/go-ur/pow"
 	"github.com/hashicorp/golang-lru"
 )
 
@@ -50,6 +49,7 @@ const (
 // the necessary mutex locking/unlocking.
 type HeaderChain struct {
 	config *params.ChainConfig
+	pow    PowConfig // Proof of work verification settings
 
 	chainDb       ethdb.Database
 	genesisHeader *types.Header
@@ -71,10 +71,11 @@ type HeaderChain struct {
 type getHeaderValidatorFn func() HeaderValidator
 
 // NewHeaderChain creates a new HeaderChain structure.
+//  pow configures the proof of work verification of inserted headers
 //  getValidator should return the parent's validator
 //  procInterrupt points to the parent's interrupt semaphore
 //  wg points to the parent's shutdown wait group
-func NewHeaderChain(chainDb ethdb.Database, config *params.ChainConfig, getValidator getHeaderValidatorFn, procInterrupt func() bool) (*HeaderChain, error) {
+func NewHeaderChain(chainDb ethdb.Database, config *params.ChainConfig, pow PowConfig, getValidator getHeaderValidatorFn, procInterrupt func() bool) (*HeaderChain, error) {
 	headerCache, _ := lru.New(headerCacheLimit)
 	tdCache, _ := lru.New(tdCacheLimit)
 	numberCache, _ := lru.New(numberCacheLimit)
@@ -87,6 +88,7 @@ func NewHeaderChain(chainDb ethdb.Database, config *params.ChainConfig, getValid
 
 	hc := &HeaderChain{
 		config:        config,
+		pow:           pow,
 		chainDb:       chainDb,
 		headerCache:   headerCache,
 		tdCache:       tdCache,
@@ -228,7 +230,11 @@ func (hc *HeaderChain) InsertHeaderChain(chain []*types.Header, checkFreq int, w
 	stats := struct{ processed, ignored int }{}
 	start := time.Now()
 
-	// Generate the list of headers that should be POW verified
+	// Generate the list of headers that should be POW verified, only sampling
+	// them sparsely in light verification mode
+	if hc.pow.LightVerify && checkFreq < powLightVerifyFrequency {
+		checkFreq = powLightVerifyFrequency
+	}
 	verify := make([]bool, len(chain))
 	for i := 0; i < len(verify)/checkFreq; i++ {
 		index := i*checkFreq + hc.rand.Intn(checkFreq)
@@ -283,9 +289,9 @@ func (hc *HeaderChain) InsertHeaderChain(chain []*types.Header, checkFreq int, w
 			}
 		}
 	}
-	// Start as many worker threads as goroutines allowed
-	pending := new(sync.WaitGroup)
-	for i := 0; i < runtime.GOMAXPROCS(0); i++ {
+	// Start as many worker threads as proof of work verifiers allowed
+	pending, workers := new(sync.WaitGroup), powVerifyWorkers(len(chain), hc.pow.Verifiers)
+	for i := 0; i < workers; i++ {
 		pending.Add(1)
 		go func(id int) {
 			defer pending.Done()
@@ -487,20 +493,23 @@ func (hc *HeaderChain) SetGenesis(head *types.Header) {
 	hc.genesisHeader = head
 }
 
+// Config retrieves the header chain's chain configuration.
+func (hc *HeaderChain) Config() *params.ChainConfig { return hc.config }
+
 // headerValidator is responsible for validating block headers
 //
 // headerValidator implements HeaderValidator.
 type headerValidator struct {
 	config *params.ChainConfig
-	hc     *HeaderChain // Canonical header chain
-	Pow    pow.PoW      // Proof of work used for validating
+	hc     *HeaderChain     // Canonical header chain
+	engine consensus.Engine // Consensus engine used for validating
 }
 
 // NewBlockValidator returns a new block validator which is safe for re-use
-func NewHeaderValidator(config *params.ChainConfig, chain *HeaderChain, pow pow.PoW) HeaderValidator {
+func NewHeaderValidator(config *params.ChainConfig, chain *HeaderChain, engine consensus.Engine) HeaderValidator {
 	return &headerValidator{
 		config: config,
-		Pow:    pow,
+		engine: engine,
 		hc:     chain,
 	}
 }
@@ -517,5 +526,5 @@ func (v *headerValidator) ValidateHeader(header, parent *types.Header, checkPow
 	if v.hc.HasHeader(header.Hash()) {
 		return nil
 	}
-	return ValidateHeader(v.config, v.Pow, header, parent, checkPow, false)
+	return v.engine.VerifyHeader(v.hc, header, parent, checkPow, false)
 }
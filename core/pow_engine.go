@@ -0,0 +1,66 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/consensus"
+	"github.com/ur-technology/go-ur/core/state"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/pow"
+)
+
+// PowEngine is the proof of work consensus engine, sealing and verifying blocks
+// with a proof of work algorithm such as urhash. Blocks are finalized with the
+// UR reward schedule shared by all engines.
+//
+// PowEngine implements consensus.Engine.
+type PowEngine struct {
+	pow.PoW
+}
+
+// NewPowEngine returns a consensus engine backed by the given proof of work.
+func NewPowEngine(pow pow.PoW) *PowEngine {
+	return &PowEngine{pow}
+}
+
+// VerifyHeader checks whether a header conforms to the consensus rules.
+func (e *PowEngine) VerifyHeader(chain consensus.ChainReader, header, parent *types.Header, seal, uncle bool) error {
+	return ValidateHeader(chain.Config(), e.PoW, header, parent, seal, uncle)
+}
+
+// VerifySeal checks whether the proof of work of a header is valid.
+func (e *PowEngine) VerifySeal(header *types.Header) error {
+	if !e.Verify(types.NewBlockWithHeader(header)) {
+		return &BlockNonceErr{header.Number, header.Hash(), header.Nonce.Uint64()}
+	}
+	return nil
+}
+
+// Finalize credits the block and uncle rewards.
+func (e *PowEngine) Finalize(chain consensus.ChainReader, statedb *state.StateDB, header *types.Header, uncles []*types.Header) {
+	AccumulateRewards(chain.Config(), statedb, header, uncles)
+}
+
+// Seal searches for a nonce satisfying the difficulty of the block.
+func (e *PowEngine) Seal(block *types.Block, stop <-chan struct{}, index int) (*types.Block, error) {
+	nonce, mixDigest := e.Search(block, stop, index)
+	if nonce == 0 {
+		return nil, nil
+	}
+	return block.WithMiningResult(nonce, common.BytesToHash(mixDigest)), nil
+}
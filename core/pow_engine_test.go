@@ -0,0 +1,74 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"testing"
+
+	"github.com/ur-technology/go-ur/consensus"
+	"github.com/ur-technology/go-ur/core/state"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/ethdb"
+	"github.com/ur-technology/go-ur/event"
+	"github.com/ur-technology/go-ur/params"
+)
+
+// recordingEngine is a consensus engine recording the blocks it finalizes and
+// the headers it verifies.
+type recordingEngine struct {
+	FakePow
+	finalized []uint64
+	verified  []uint64
+}
+
+func (e *recordingEngine) VerifyHeader(chain consensus.ChainReader, header, parent *types.Header, seal, uncle bool) error {
+	e.verified = append(e.verified, header.Number.Uint64())
+	return e.FakePow.VerifyHeader(chain, header, parent, seal, uncle)
+}
+
+func (e *recordingEngine) Finalize(chain consensus.ChainReader, statedb *state.StateDB, header *types.Header, uncles []*types.Header) {
+	e.finalized = append(e.finalized, header.Number.Uint64())
+	e.FakePow.Finalize(chain, statedb, header, uncles)
+}
+
+// Tests that the chain verifies and finalizes imported blocks through its
+// consensus engine.
+func TestEngineImport(t *testing.T) {
+	var (
+		db, _   = ethdb.NewMemDatabase()
+		genesis = WriteGenesisBlockForTesting(db)
+		engine  = new(recordingEngine)
+	)
+	chain, _ := NewBlockChain(db, params.TestChainConfig, engine, new(event.TypeMux))
+	defer chain.Stop()
+
+	blocks, _ := GenerateChain(params.TestChainConfig, chain, genesis, db, 3, func(int, *BlockGen) {})
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	if len(engine.verified) != 3 || len(engine.finalized) != 3 {
+		t.Fatalf("engine calls mismatch: have %d verified and %d finalized, want 3 each", len(engine.verified), len(engine.finalized))
+	}
+	for i, number := range engine.finalized {
+		if number != uint64(i+1) {
+			t.Errorf("finalized block %d: number mismatch: have %d, want %d", i, number, i+1)
+		}
+	}
+	if head := chain.CurrentBlock(); head.Hash() != blocks[2].Hash() {
+		t.Errorf("head mismatch: have %x, want %x", head.Hash(), blocks[2].Hash())
+	}
+}
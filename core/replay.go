@@ -0,0 +1,224 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core/state"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/core/vm"
+	"github.com/ur-technology/go-ur/ethdb"
+	"github.com/ur-technology/go-ur/event"
+	"github.com/ur-technology/go-ur/params"
+)
+
+// BlockRecord contains everything needed to re-execute a block without the chain
+// database it was recorded from: every database entry read while processing it,
+// along with the chain configuration.
+type BlockRecord struct {
+	Number  uint64
+	Hash    common.Hash
+	Config  []byte        // JSON encoded chain configuration
+	Entries []RecordEntry // Database entries read during processing, sorted by key
+}
+
+// RecordEntry is a single database entry of a block record.
+type RecordEntry struct {
+	Key, Value []byte
+}
+
+// ReplayResult is the outcome of re-executing a block.
+type ReplayResult struct {
+	Block    *types.Block
+	Receipts types.Receipts
+	UsedGas  *big.Int
+	Root     common.Hash // State root after processing the block
+	Err      error       // Processing or validation failure, nil if the block is valid
+}
+
+// RecordBlock processes the block with the given hash on top of its parent
+// state, recording all the database entries read along the way. The database
+// itself is never written to.
+func RecordBlock(db ethdb.Database, config *params.ChainConfig, hash common.Hash) (*BlockRecord, *ReplayResult, error) {
+	blob, err := json.Marshal(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	recorder := newRecordingDatabase(db)
+	result, err := replayBlock(recorder, config, hash)
+	if err != nil {
+		return nil, nil, err
+	}
+	record := &BlockRecord{
+		Number:  result.Block.NumberU64(),
+		Hash:    hash,
+		Config:  blob,
+		Entries: recorder.entries(),
+	}
+	return record, result, nil
+}
+
+// Replay re-executes the recorded block from the recorded entries alone.
+func (r *BlockRecord) Replay() (*ReplayResult, error) {
+	config := new(params.ChainConfig)
+	if err := json.Unmarshal(r.Config, config); err != nil {
+		return nil, fmt.Errorf("invalid chain configuration: %v", err)
+	}
+	db, _ := ethdb.NewMemDatabase()
+	for _, entry := range r.Entries {
+		db.Put(entry.Key, entry.Value)
+	}
+	return replayBlock(db, config, r.Hash)
+}
+
+// replayBlock processes and validates the block with the given hash on top of
+// its parent state. Failures of the block itself are reported in the result,
+// the error is only set if the block can't be processed at all.
+func replayBlock(db ethdb.Database, config *params.ChainConfig, hash common.Hash) (*ReplayResult, error) {
+	bc, err := NewBlockChain(db, config, FakePow{}, new(event.TypeMux))
+	if err != nil {
+		return nil, err
+	}
+	defer bc.Stop()
+
+	block := bc.GetBlockByHash(hash)
+	if block == nil {
+		return nil, fmt.Errorf("block %x not found", hash)
+	}
+	if block.NumberU64() == 0 {
+		return nil, errors.New("genesis block can't be replayed")
+	}
+	parent := bc.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return nil, fmt.Errorf("parent of block #%d [%x…] not found", block.NumberU64(), hash[:4])
+	}
+	statedb, err := state.New(parent.Root(), db)
+	if err != nil {
+		return nil, fmt.Errorf("parent state unavailable: %v", err)
+	}
+	result := &ReplayResult{Block: block}
+	result.Receipts, _, result.UsedGas, result.Err = bc.Processor().Process(block, statedb, vm.Config{})
+	if result.Err == nil {
+		result.Err = bc.Validator().ValidateState(block, parent, statedb, result.Receipts, result.UsedGas)
+	}
+	result.Root = statedb.IntermediateRoot(config.IsEIP158(block.Number()))
+	return result, nil
+}
+
+// recordingDatabase is a database wrapper remembering every entry read from the
+// underlying database. Writes are kept in memory, leaving the wrapped database
+// untouched.
+type recordingDatabase struct {
+	db      ethdb.Database
+	reads   map[string][]byte // Entries read from the wrapped database
+	overlay map[string][]byte // Entries written, nil values marking deletions
+	lock    sync.Mutex
+}
+
+func newRecordingDatabase(db ethdb.Database) *recordingDatabase {
+	return &recordingDatabase{
+		db:      db,
+		reads:   make(map[string][]byte),
+		overlay: make(map[string][]byte),
+	}
+}
+
+func (db *recordingDatabase) Get(key []byte) ([]byte, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if value, ok := db.overlay[string(key)]; ok {
+		if value == nil {
+			return nil, errors.New("not found")
+		}
+		return common.CopyBytes(value), nil
+	}
+	value, err := db.db.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	db.reads[string(key)] = common.CopyBytes(value)
+	return value, nil
+}
+
+func (db *recordingDatabase) Put(key []byte, value []byte) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.overlay[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+func (db *recordingDatabase) Delete(key []byte) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.overlay[string(key)] = nil
+	return nil
+}
+
+func (db *recordingDatabase) Close() {}
+
+func (db *recordingDatabase) NewBatch() ethdb.Batch {
+	return &recordingBatch{db: db}
+}
+
+// entries returns the entries read from the wrapped database, sorted by key.
+func (db *recordingDatabase) entries() []RecordEntry {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	entries := make([]RecordEntry, 0, len(db.reads))
+	for key, value := range db.reads {
+		entries = append(entries, RecordEntry{Key: []byte(key), Value: value})
+	}
+	sort.Sort(recordEntries(entries))
+	return entries
+}
+
+// recordingBatch collects writes to a recording database until written.
+type recordingBatch struct {
+	db     *recordingDatabase
+	writes []RecordEntry
+}
+
+func (b *recordingBatch) Put(key, value []byte) error {
+	b.writes = append(b.writes, RecordEntry{Key: common.CopyBytes(key), Value: append([]byte{}, value...)})
+	return nil
+}
+
+func (b *recordingBatch) Write() error {
+	for _, write := range b.writes {
+		b.db.Put(write.Key, write.Value)
+	}
+	return nil
+}
+
+// recordEntries implements sort.Interface, ordering entries by key.
+type recordEntries []RecordEntry
+
+func (e recordEntries) Len() int           { return len(e) }
+func (e recordEntries) Less(i, j int) bool { return bytes.Compare(e[i].Key, e[j].Key) < 0 }
+func (e recordEntries) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
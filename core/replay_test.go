@@ -0,0 +1,83 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/crypto"
+	"github.com/ur-technology/go-ur/ethdb"
+	"github.com/ur-technology/go-ur/event"
+	"github.com/ur-technology/go-ur/params"
+	"github.com/ur-technology/go-ur/rlp"
+)
+
+// Tests that a recorded block can be re-executed from its record alone, with the
+// same outcome as on the full chain, and that recording leaves the database be.
+func TestRecordReplayBlock(t *testing.T) {
+	var (
+		key, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr   = crypto.PubkeyToAddress(key.PublicKey)
+		db, _  = ethdb.NewMemDatabase()
+		signer = types.HomesteadSigner{}
+	)
+	genesis := WriteGenesisBlockForTesting(db, GenesisAccount{addr, big.NewInt(1000000000)})
+	blockchain, _ := NewBlockChain(db, params.TestChainConfig, FakePow{}, new(event.TypeMux))
+	defer blockchain.Stop()
+
+	chain, _ := GenerateChain(params.TestChainConfig, blockchain, genesis, db, 3, func(i int, gen *BlockGen) {
+		tx, _ := types.NewTransaction(gen.TxNonce(addr), common.Address{1}, big.NewInt(1000), params.TxGas, nil, nil).SignECDSA(signer, key)
+		gen.AddTx(tx)
+	})
+	if _, err := blockchain.InsertChain(chain); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	keys := len(db.Keys())
+
+	record, result, err := RecordBlock(db, params.TestChainConfig, chain[1].Hash())
+	if err != nil {
+		t.Fatalf("failed to record block: %v", err)
+	}
+	if result.Err != nil || result.Root != chain[1].Root() {
+		t.Fatalf("recording mismatch: err %v, root %x, want %x", result.Err, result.Root, chain[1].Root())
+	}
+	if len(db.Keys()) != keys {
+		t.Errorf("recording modified the database: have %d keys, want %d", len(db.Keys()), keys)
+	}
+	// Round trip the record through its encoding and replay it
+	blob, err := rlp.EncodeToBytes(record)
+	if err != nil {
+		t.Fatalf("failed to encode record: %v", err)
+	}
+	decoded := new(BlockRecord)
+	if err := rlp.DecodeBytes(blob, decoded); err != nil {
+		t.Fatalf("failed to decode record: %v", err)
+	}
+	replay, err := decoded.Replay()
+	if err != nil {
+		t.Fatalf("failed to replay block: %v", err)
+	}
+	if replay.Err != nil {
+		t.Errorf("replayed block invalid: %v", replay.Err)
+	}
+	if replay.Root != chain[1].Root() || replay.UsedGas.Cmp(chain[1].GasUsed()) != 0 || len(replay.Receipts) != 1 {
+		t.Errorf("replay mismatch: root %x, gas %v, receipts %d", replay.Root, replay.UsedGas, len(replay.Receipts))
+	}
+}
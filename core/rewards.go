@@ -1,12 +1,21 @@
 package core
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"math/big"
+	"sort"
+	"sync"
 
 	"github.com/ur-technology/go-ur/common"
 	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/crypto"
+	"github.com/ur-technology/go-ur/logger"
+	"github.com/ur-technology/go-ur/logger/glog"
+	"github.com/ur-technology/go-ur/params"
+	"github.com/ur-technology/go-ur/rlp"
 )
 
 // privileged addresses
@@ -71,6 +80,244 @@ func init() {
 	}
 }
 
+// URRewards are the UR reward parameters a chain runs with: the ones of its
+// chain configuration, falling back to the compiled in defaults.
+type URRewards struct {
+	BlockReward          *big.Int
+	SignupReward         *big.Int
+	MembersSignupRewards []*big.Int
+	TotalSignupRewards   *big.Int
+	URFutureFundFee      *big.Int
+	ManagementFee        *big.Int
+	ManagementFeeCap     *big.Int
+	Privileged           map[common.Address]ReceiverAddressPair
+}
+
+var (
+	privilegedCache = make(map[*params.URConfig]map[common.Address]ReceiverAddressPair)
+	privilegedLock  sync.Mutex
+)
+
+// Rewards returns the UR reward parameters of the chain configuration. Private
+// networks may override any of the compiled in ones in their genesis.
+func Rewards(config *params.ChainConfig) *URRewards {
+	rewards := &URRewards{
+		BlockReward:          BlockReward,
+		SignupReward:         SignupReward,
+		MembersSignupRewards: MembersSingupRewards,
+		TotalSignupRewards:   TotalSingupRewards,
+		URFutureFundFee:      URFutureFundFee,
+		ManagementFee:        ManagementFee,
+		ManagementFeeCap:     Big10k,
+		Privileged:           PrivilegedAddressesReceivers,
+	}
+	if config == nil || config.UR == nil {
+		return rewards
+	}
+	cfg := config.UR
+	if cfg.BlockReward != nil {
+		rewards.BlockReward = cfg.BlockReward
+	}
+	if cfg.SignupReward != nil {
+		rewards.SignupReward = cfg.SignupReward
+	}
+	if cfg.MembersSignupRewards != nil {
+		rewards.MembersSignupRewards = cfg.MembersSignupRewards
+	}
+	if cfg.TotalSignupRewards != nil {
+		rewards.TotalSignupRewards = cfg.TotalSignupRewards
+	}
+	if cfg.URFutureFundFee != nil {
+		rewards.URFutureFundFee = cfg.URFutureFundFee
+	}
+	if cfg.ManagementFee != nil {
+		rewards.ManagementFee = cfg.ManagementFee
+	}
+	if cfg.ManagementFeeCap != nil {
+		rewards.ManagementFeeCap = cfg.ManagementFeeCap
+	}
+	if cfg.Privileged != nil {
+		// Signup checks look up the privileged senders for every transaction
+		privilegedLock.Lock()
+		privileged, ok := privilegedCache[cfg]
+		if !ok {
+			privileged = make(map[common.Address]ReceiverAddressPair, len(cfg.Privileged))
+			for _, sender := range cfg.Privileged {
+				privileged[sender.Address] = ReceiverAddressPair{Receiver: sender.Receiver, URFF: sender.URFF}
+			}
+			privilegedCache[cfg] = privileged
+		}
+		privilegedLock.Unlock()
+		rewards.Privileged = privileged
+	}
+	return rewards
+}
+
+// ValidateURConfig checks that the UR reward parameters of a chain configuration
+// can be applied: amounts must not be negative, every signup chain level needs a
+// reward tier and the tiers must fit into the total signup rewards.
+func ValidateURConfig(cfg *params.URConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	amounts := []struct {
+		name  string
+		value *big.Int
+	}{
+		{"blockReward", cfg.BlockReward},
+		{"signupReward", cfg.SignupReward},
+		{"totalSignupRewards", cfg.TotalSignupRewards},
+		{"urFutureFundFee", cfg.URFutureFundFee},
+		{"managementFee", cfg.ManagementFee},
+		{"managementFeeCap", cfg.ManagementFeeCap},
+	}
+	for _, amount := range amounts {
+		if amount.value != nil && amount.value.Sign() < 0 {
+			return fmt.Errorf("negative %s %v", amount.name, amount.value)
+		}
+	}
+	members, total := MembersSingupRewards, TotalSingupRewards
+	if cfg.MembersSignupRewards != nil {
+		members = cfg.MembersSignupRewards
+	}
+	if cfg.TotalSignupRewards != nil {
+		total = cfg.TotalSignupRewards
+	}
+	if len(members) != signupChainLevels {
+		return fmt.Errorf("need %d membersSignupRewards tiers, have %d", signupChainLevels, len(members))
+	}
+	sum := new(big.Int)
+	for i, reward := range members {
+		if reward == nil || reward.Sign() < 0 {
+			return fmt.Errorf("invalid membersSignupRewards tier %d: %v", i, reward)
+		}
+		sum.Add(sum, reward)
+	}
+	if sum.Cmp(total) > 0 {
+		return fmt.Errorf("membersSignupRewards %v exceed totalSignupRewards %v", sum, total)
+	}
+	seen := make(map[common.Address]bool, len(cfg.Privileged))
+	for _, sender := range cfg.Privileged {
+		if sender.Address == (common.Address{}) {
+			return errors.New("privileged sender without address")
+		}
+		if seen[sender.Address] {
+			return fmt.Errorf("duplicate privileged sender %x", sender.Address)
+		}
+		seen[sender.Address] = true
+	}
+	return nil
+}
+
+// privilegedReward is the canonical encoding of a privileged address along with
+// the addresses receiving its signup rewards.
+type privilegedReward struct {
+	Sender, Receiver, URFF common.Address
+}
+
+type privilegedRewards []privilegedReward
+
+func (p privilegedRewards) Len() int      { return len(p) }
+func (p privilegedRewards) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p privilegedRewards) Less(i, j int) bool {
+	return bytes.Compare(p[i].Sender[:], p[j].Sender[:]) < 0
+}
+
+// RewardSpecHash returns a digest of the UR reward parameters of the chain
+// configuration: the block and signup rewards, the fees, the management fee cap
+// and the privileged addresses with their receivers. Nodes disagreeing on it will compute
+// different states.
+func RewardSpecHash(config *params.ChainConfig) common.Hash {
+	rewards := Rewards(config)
+
+	privileged := make(privilegedRewards, 0, len(rewards.Privileged))
+	for sender, pair := range rewards.Privileged {
+		privileged = append(privileged, privilegedReward{sender, pair.Receiver, pair.URFF})
+	}
+	sort.Sort(privileged)
+
+	blob, err := rlp.EncodeToBytes([]interface{}{
+		rewards.BlockReward,
+		rewards.URFutureFundFee,
+		rewards.ManagementFee,
+		rewards.ManagementFeeCap,
+		rewards.SignupReward,
+		rewards.TotalSignupRewards,
+		rewards.MembersSignupRewards,
+		[]privilegedReward(privileged),
+	})
+	if err != nil {
+		panic(err)
+	}
+	return crypto.Keccak256Hash(blob)
+}
+
+// feeCreditedSig is the ABI selector of feeCredited(address,uint256), the hook
+// invoked on contract fee receivers.
+var feeCreditedSig = crypto.Keccak256([]byte("feeCredited(address,uint256)"))[:4]
+
+// creditSignup credits the rewards of a signup transaction if it carries a valid
+// signup chain: the block reward to the miner, the signup reward to the new
+// member, the member rewards to the referring members, the UR Future Fund fee
+// and the management fee along with the unpaid member rewards to the receivers
+// of the privileged sender.
+//
+// Unlike the block and uncle rewards credited by the consensus engines when
+// finalizing a block, signup rewards are part of the state transition of the
+// signup itself, the receipts committing to the state after every transaction.
+func creditSignup(env *VMEnv, bc *BlockChain, msg types.Message) {
+	signupChain, err := getSignupChain(bc, msg.Data())
+	if err != nil {
+		return
+	}
+	var (
+		statedb = env.state
+		header  = env.header
+		rewards = Rewards(env.chainConfig)
+	)
+	// pay the miner BlockReward for every signup
+	statedb.AddBalance(header.Coinbase, rewards.BlockReward)
+	// pay the member being signed up
+	statedb.AddBalance(*msg.To(), rewards.SignupReward)
+	// pay the referral members
+	remRewards := rewards.TotalSignupRewards
+	for i, m := range signupChain {
+		statedb.AddBalance(m, rewards.MembersSignupRewards[i])
+		remRewards = new(big.Int).Sub(remRewards, rewards.MembersSignupRewards[i])
+	}
+	txFrom := msg.From()
+	recvAddr := rewards.Privileged[txFrom]
+	// pay 5000 UR to the UR Future Fund
+	creditFee(env, txFrom, recvAddr.URFF, rewards.URFutureFundFee)
+	// pay the receiver address any remaining fees from the members and the management fee
+	pBlock := bc.GetBlockByHash(header.ParentHash)
+	mngFee := calculateTxManagementFee(rewards, pBlock.NSignups(), pBlock.TotalWei())
+	creditFee(env, txFrom, recvAddr.Receiver, new(big.Int).Add(mngFee, remRewards))
+}
+
+// creditFee pays amount to a privileged sender's fee receiver. Once the fee
+// contract fork is active and the receiver is a contract, its feeCredited hook
+// is called with the sender and amount, limited to params.FeeReceiverGas. A
+// failing hook is reverted but never invalidates the signup, the fee stays
+// credited either way.
+func creditFee(env *VMEnv, sender, receiver common.Address, amount *big.Int) {
+	statedb := env.state
+	statedb.AddBalance(receiver, amount)
+
+	if !env.chainConfig.IsFeeContract(env.header.Number) || statedb.GetCodeSize(receiver) == 0 {
+		return
+	}
+	input := make([]byte, 4+2*32)
+	copy(input, feeCreditedSig)
+	copy(input[4:], common.LeftPadBytes(sender[:], 32))
+	copy(input[36:], common.LeftPadBytes(amount.Bytes(), 32))
+
+	caller := statedb.GetOrNewStateObject(sender)
+	if _, err := env.Call(caller, receiver, input, new(big.Int).Set(params.FeeReceiverGas), new(big.Int), new(big.Int)); err != nil {
+		glog.V(logger.Debug).Infof("fee receiver %x hook failed: %v", receiver, err)
+	}
+}
+
 func floatUrToWei(ur string) *big.Int {
 	u, _ := new(big.Float).SetString(ur)
 	urFloat, _ := new(big.Float).SetString(common.Ether.String())
@@ -79,12 +326,13 @@ func floatUrToWei(ur string) *big.Int {
 }
 
 // a signup transaction is signaled by the value 1 and the data in the following format:
-//     when a privileged address signs a member
-//         "01" - the current version of the message
-//     when a member signs a member:
-//         "01" - the current version of the message
-//         8 bytes in big endian for the block number of signup transaction of the referring member
-//         32 bytes for the hash of the signup transaction of the referring member
+//
+//	when a privileged address signs a member
+//	    "01" - the current version of the message
+//	when a member signs a member:
+//	    "01" - the current version of the message
+//	    8 bytes in big endian for the block number of signup transaction of the referring member
+//	    32 bytes for the hash of the signup transaction of the referring member
 func refTxFromData(bc *BlockChain, d []byte) (*types.Transaction, error) {
 	if len(d) < 1 {
 		return nil, errInvalidChain
@@ -99,15 +347,21 @@ func refTxFromData(bc *BlockChain, d []byte) (*types.Transaction, error) {
 		bn := binary.BigEndian.Uint64(d[1:])
 		var txh common.Hash
 		copy(txh[:], d[9:])
-		return bc.GetBlockByNumber(bn).Transaction(txh), nil
+		block := bc.GetBlockByNumber(bn)
+		if block == nil {
+			return nil, errInvalidChain
+		}
+		if tx := block.Transaction(txh); tx != nil {
+			return tx, nil
+		}
 	}
 	return nil, errInvalidChain
 }
 
 func getSignupChain(bc *BlockChain, data []byte) ([]common.Address, error) {
-	r := make([]common.Address, 0, 7)
+	r := make([]common.Address, 0, signupChainLevels)
 	txdata := data
-	for len(r) < 7 {
+	for len(r) < signupChainLevels {
 		tx, err := refTxFromData(bc, txdata)
 		if err == errInvalidChain {
 			return nil, err
@@ -119,6 +373,9 @@ func getSignupChain(bc *BlockChain, data []byte) ([]common.Address, error) {
 			return nil, errInvalidChain
 		}
 		to := tx.To()
+		if to == nil {
+			return nil, errInvalidChain
+		}
 		r = append(r, *to)
 		txdata = tx.Data()
 	}
@@ -138,54 +395,84 @@ var (
 
 const currentSignupMessageVersion byte = 1
 
-func isSignupTx(from common.Address, value *big.Int, data []byte) bool {
-	return IsPrivilegedAddress(from) && value.Cmp(big.NewInt(1)) == 0 && len(data) > 0 && data[0] == currentSignupMessageVersion
+// signupChainLevels is the number of referring members rewarded for a signup.
+const signupChainLevels = 7
+
+func isSignupTx(config *params.ChainConfig, from common.Address, value *big.Int, data []byte) bool {
+	return IsPrivilegedAddress(config, from) && value.Cmp(big.NewInt(1)) == 0 && len(data) > 0 && data[0] == currentSignupMessageVersion
 }
 
-func isSignupTransaction(msg types.Message) bool {
-	return isSignupTx(msg.From(), msg.Value(), msg.Data())
+// IsSignupTransaction reports whether the message signs up a new member.
+func IsSignupTransaction(config *params.ChainConfig, msg types.Message) bool {
+	return isSignupTx(config, msg.From(), msg.Value(), msg.Data())
 }
 
-func IsPrivilegedAddress(address common.Address) bool {
-	_, ok := PrivilegedAddressesReceivers[address]
+// IsPrivilegedAddress reports whether the address may sign up members on the
+// chain with the given configuration.
+func IsPrivilegedAddress(config *params.ChainConfig, address common.Address) bool {
+	_, ok := Rewards(config).Privileged[address]
 	return ok
 }
 
-var (
-	big9007 = new(big.Int).Mul(common.Ether, big.NewInt(9007))
-	Big10k  = new(big.Int).Mul(common.Ether, big.NewInt(10000))
-)
+// Big10k is the average wei per signup above which no management fee is paid.
+var Big10k = new(big.Int).Mul(common.Ether, big.NewInt(10000))
+
+// signupIssuance returns the wei issued by a signup on top of its management fee:
+// the block and signup rewards, the member rewards and the UR Future Fund fee.
+func signupIssuance(rewards *URRewards) *big.Int {
+	issued := new(big.Int).Add(rewards.BlockReward, rewards.SignupReward)
+	issued.Add(issued, rewards.TotalSignupRewards)
+	return issued.Add(issued, rewards.URFutureFundFee)
+}
+
+// MaxBlockIssuance returns the most wei the reward schedule can issue in the
+// block with the given header and number of signups: the block reward, the
+// rewards of the most uncles at the smallest depth along with their inclusion
+// rewards, and every signup paying the management fee.
+func MaxBlockIssuance(config *params.ChainConfig, header *types.Header, signups int) *big.Int {
+	rewards := Rewards(config)
+	issued := new(big.Int).Set(rewards.BlockReward)
+	if policy := config.UnclePolicyAt(header.Number); policy == nil || !policy.NoUncles {
+		nearest := &types.Header{Number: new(big.Int).Sub(header.Number, common.Big1)}
+		uncle := new(big.Int).Add(UncleReward(config, header, nearest), UncleInclusionReward(config, header.Number))
+		issued.Add(issued, uncle.Mul(uncle, big.NewInt(maxUncles)))
+	}
+	signup := new(big.Int).Add(signupIssuance(rewards), rewards.ManagementFee)
+	return issued.Add(issued, signup.Mul(signup, big.NewInt(int64(signups))))
+}
 
-func calculateTxManagementFee(nSignups, totaWei *big.Int) *big.Int {
+func calculateTxManagementFee(rewards *URRewards, nSignups, totaWei *big.Int) *big.Int {
 	if nSignups.Cmp(common.Big0) == 0 {
-		return ManagementFee
+		return rewards.ManagementFee
 	}
 	avg := new(big.Int).Div(totaWei, nSignups)
-	if avg.Cmp(Big10k) <= 0 {
-		return ManagementFee
+	if avg.Cmp(rewards.ManagementFeeCap) <= 0 {
+		return rewards.ManagementFee
 	}
 	return common.Big0
 }
 
-func calculateBlockTotals(cNSignups, cTotalWei *big.Int, header *types.Header, uncles []*types.Header, msgs []types.Message) (*big.Int, *big.Int) {
+func calculateBlockTotals(config *params.ChainConfig, cNSignups, cTotalWei *big.Int, header *types.Header, uncles []*types.Header, msgs []types.Message) (*big.Int, *big.Int) {
 	newNSignups := new(big.Int).Set(cNSignups)
 	newTotalWei := new(big.Int).Set(cTotalWei)
-	blockMngFee := calculateTxManagementFee(cNSignups, cTotalWei)
-	for _, r := range calculateAccumulatedRewards(header, uncles) {
+	rewards := Rewards(config)
+	blockMngFee := calculateTxManagementFee(rewards, cNSignups, cTotalWei)
+	issued := signupIssuance(rewards)
+	for _, r := range calculateAccumulatedRewards(config, header, uncles) {
 		newTotalWei.Add(newTotalWei, r)
 	}
 	for _, m := range msgs {
-		if isSignupTransaction(m) {
+		if IsSignupTransaction(config, m) {
 			newNSignups.Add(newNSignups, common.Big1)
-			newTotalWei.Add(newTotalWei, new(big.Int).Add(big9007, blockMngFee))
+			newTotalWei.Add(newTotalWei, new(big.Int).Add(issued, blockMngFee))
 		}
 	}
 	return newNSignups, newTotalWei
 }
 
 // returns number of sign
-func UpdateBlockTotals(parent, header *types.Header, uncles []*types.Header, msgs []types.Message) {
-	header.NSignups, header.TotalWei = calculateBlockTotals(parent.NSignups, parent.TotalWei, header, uncles, msgs)
+func UpdateBlockTotals(config *params.ChainConfig, parent, header *types.Header, uncles []*types.Header, msgs []types.Message) {
+	header.NSignups, header.TotalWei = calculateBlockTotals(config, parent.NSignups, parent.TotalWei, header, uncles, msgs)
 }
 
 func TransactionsToMessages(txs types.Transactions, signer types.Signer) ([]types.Message, error) {
@@ -14,6 +14,7 @@ import (
 	"github.com/ur-technology/go-ur/common"
 	"github.com/ur-technology/go-ur/core"
 	"github.com/ur-technology/go-ur/crypto"
+	"github.com/ur-technology/go-ur/params"
 )
 
 var (
@@ -256,6 +257,22 @@ func TestManagementFee(t *testing.T) {
 	}
 }
 
+// Tests that the reward spec hash covers the management fee cap, as it decides
+// whether the management fee of a signup is paid.
+func TestRewardSpecHashFeeCap(t *testing.T) {
+	config := func(cap int64) *params.ChainConfig {
+		config := *params.TestChainConfig
+		config.UR = &params.URConfig{ManagementFeeCap: new(big.Int).Mul(common.Ether, big.NewInt(cap))}
+		return &config
+	}
+	if core.RewardSpecHash(config(10000)) != core.RewardSpecHash(config(10000)) {
+		t.Errorf("same reward parameters hash differently")
+	}
+	if core.RewardSpecHash(config(10000)) == core.RewardSpecHash(config(20000)) {
+		t.Errorf("different management fee caps hash the same")
+	}
+}
+
 func signupMembers(sim *Simulator, node *memberNode, minerAddr common.Address, chain []common.Address, balances map[common.Address]*big.Int) {
 	var err error
 	for _, m := range node.signups {
@@ -0,0 +1,106 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/rlp"
+	"github.com/ur-technology/go-ur/trie"
+)
+
+// emptyRoot is the known root hash of an empty trie.
+var emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
+// BalanceDelta returns the change of the sum of all account balances from the
+// state with root from to the one with root to, i.e. the wei issued in between.
+//
+// Both account tries are walked level by level in lockstep, skipping the
+// subtrees they share, so the cost is proportional to the accounts changed and
+// not to the size of the state.
+func BalanceDelta(db trie.Database, from, to common.Hash) (*big.Int, error) {
+	var (
+		delta  = new(big.Int)
+		before = []common.Hash{from}
+		after  = []common.Hash{to}
+	)
+	for len(before) > 0 || len(after) > 0 {
+		// Drop the subtrees present in both states, they hold the same balances
+		shared := make(map[common.Hash]int)
+		for _, hash := range before {
+			shared[hash]++
+		}
+		var changed []common.Hash
+		for _, hash := range after {
+			if shared[hash] > 0 {
+				shared[hash]--
+				continue
+			}
+			changed = append(changed, hash)
+		}
+		var removed []common.Hash
+		for _, hash := range before {
+			if shared[hash] > 0 {
+				shared[hash]--
+				removed = append(removed, hash)
+			}
+		}
+		// Account for the balances held by the differing nodes and descend
+		var err error
+		if after, err = balanceLevel(db, changed, delta, 1); err != nil {
+			return nil, err
+		}
+		if before, err = balanceLevel(db, removed, delta, -1); err != nil {
+			return nil, err
+		}
+	}
+	return delta, nil
+}
+
+// balanceLevel adds the balances of the accounts held by the trie nodes to the
+// delta with the given sign, returning the hashes of the referenced children.
+func balanceLevel(db trie.Database, hashes []common.Hash, delta *big.Int, sign int) ([]common.Hash, error) {
+	var children []common.Hash
+	for _, hash := range hashes {
+		if hash == emptyRoot {
+			continue
+		}
+		blob, err := db.Get(hash[:])
+		if err != nil || len(blob) == 0 {
+			return nil, fmt.Errorf("state node %x missing", hash)
+		}
+		refs, values, err := trie.NodeChildren(blob)
+		if err != nil {
+			return nil, fmt.Errorf("state node %x: %v", hash, err)
+		}
+		for _, value := range values {
+			var account Account
+			if err := rlp.DecodeBytes(value, &account); err != nil {
+				return nil, fmt.Errorf("state node %x: invalid account: %v", hash, err)
+			}
+			if sign > 0 {
+				delta.Add(delta, account.Balance)
+			} else {
+				delta.Sub(delta, account.Balance)
+			}
+		}
+		children = append(children, refs...)
+	}
+	return children, nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ur-technology/go-ur/common"
+)
+
+// Tests that the balance delta between two states is the sum of the balance
+// changes of the accounts changed, created and deleted in between.
+func TestBalanceDelta(t *testing.T) {
+	db, root, accounts := makeTestState()
+
+	total := new(big.Int)
+	for _, account := range accounts {
+		total.Add(total, account.balance)
+	}
+	if delta, err := BalanceDelta(db, emptyRoot, root); err != nil || delta.Cmp(total) != 0 {
+		t.Errorf("delta from the empty state mismatch: have %v (%v), want %v", delta, err, total)
+	}
+	if delta, err := BalanceDelta(db, root, root); err != nil || delta.Sign() != 0 {
+		t.Errorf("delta of an unchanged state mismatch: have %v (%v), want 0", delta, err)
+	}
+	// Move balance between accounts, mint into new and existing ones and burn
+	// the balance of a deleted one
+	state, _ := New(root, db)
+	state.GetOrNewStateObject(common.BytesToAddress([]byte{10})).SubBalance(big.NewInt(50))
+	state.AddBalance(common.BytesToAddress([]byte{20}), big.NewInt(50))
+	state.AddBalance(common.BytesToAddress([]byte{30}), big.NewInt(1000))
+	state.AddBalance(common.BytesToAddress([]byte{1, 0}), big.NewInt(2000))
+	state.Suicide(common.BytesToAddress([]byte{40}))
+	next, _ := state.Commit(false)
+
+	want := new(big.Int).Sub(big.NewInt(3000), accounts[40].balance)
+	if delta, err := BalanceDelta(db, root, next); err != nil || delta.Cmp(want) != 0 {
+		t.Errorf("delta mismatch: have %v (%v), want %v", delta, err, want)
+	}
+	if delta, err := BalanceDelta(db, next, root); err != nil || delta.Cmp(new(big.Int).Neg(want)) != 0 {
+		t.Errorf("reverse delta mismatch: have %v (%v), want %v", delta, err, new(big.Int).Neg(want))
+	}
+	if _, err := BalanceDelta(db, root, common.Hash{1}); err == nil {
+		t.Errorf("delta to a missing state succeeded")
+	}
+}
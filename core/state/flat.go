@@ -0,0 +1,191 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/ur-technology/go-ur/common"
+)
+
+// flatStateLayers is the number of account layers kept before the oldest ones
+// are flattened into their descendants.
+const flatStateLayers = 128
+
+// FlatState is a flat key-value view of the recent states, maintained alongside
+// the tries to serve account and storage reads without walking the tries.
+//
+// Accounts are kept in layers keyed by state root, each holding the accounts
+// changed by the commit which produced it and the ones read at that root since.
+// A lookup walks from a layer towards its ancestors, the first hit being the
+// value at the requested root. Storage slots are content addressed by the root
+// of the storage trie, so they need no layering.
+//
+// The view is never authoritative: anything not found in it is read from the
+// trie, which allows dropping any part of it at any time to bound memory use.
+type FlatState struct {
+	layers map[common.Hash]*flatLayer // Account layers keyed by state root
+	order  []common.Hash              // Layer roots, oldest first
+	limit  int                        // Maximum number of flattened accounts to keep
+
+	storage *lru.Cache // Storage slots keyed by storage root and slot
+
+	lock sync.RWMutex
+}
+
+// flatLayer is the set of accounts known at a particular state root.
+type flatLayer struct {
+	root     common.Hash
+	parent   *flatLayer                // Layer of the parent state, nil if unknown or flattened
+	accounts map[common.Address][]byte // RLP encoded accounts, empty if deleted
+}
+
+// flatSlot is the key of a cached storage slot.
+type flatSlot struct {
+	root common.Hash // Root of the storage trie
+	key  common.Hash // Storage slot within the trie
+}
+
+// NewFlatState creates an empty flat state view, keeping at most limit accounts
+// and as many storage slots in memory.
+func NewFlatState(limit int) *FlatState {
+	storage, _ := lru.New(limit)
+	return &FlatState{
+		layers:  make(map[common.Hash]*flatLayer),
+		limit:   limit,
+		storage: storage,
+	}
+}
+
+// account retrieves the RLP encoded account at the given state root. The second
+// return value is false if the account is not known in the flat view, in which
+// case it must be read from the trie. A known but missing account is empty.
+func (f *FlatState) account(root common.Hash, addr common.Address) ([]byte, bool) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	for layer := f.layers[root]; layer != nil; layer = layer.parent {
+		if enc, ok := layer.accounts[addr]; ok {
+			return enc, true
+		}
+	}
+	return nil, false
+}
+
+// cacheAccount records an account read from the trie at the given state root.
+func (f *FlatState) cacheAccount(root common.Hash, addr common.Address, enc []byte) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	layer := f.layers[root]
+	if layer == nil {
+		layer = f.insert(root, nil)
+	}
+	layer.accounts[addr] = common.CopyBytes(enc)
+}
+
+// update creates the layer of a state committed on top of the given parent,
+// holding the accounts changed by the commit.
+func (f *FlatState) update(parent, root common.Hash, accounts map[common.Address][]byte) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if _, ok := f.layers[root]; ok || root == parent {
+		return
+	}
+	layer := f.insert(root, f.layers[parent])
+	layer.accounts = accounts
+}
+
+// insert adds a new empty layer, flattening the oldest ones if there are too
+// many. The lock must be held.
+func (f *FlatState) insert(root common.Hash, parent *flatLayer) *flatLayer {
+	layer := &flatLayer{root: root, parent: parent, accounts: make(map[common.Address][]byte)}
+	f.layers[root] = layer
+	f.order = append(f.order, root)
+
+	for len(f.order) > flatStateLayers {
+		f.flatten(f.layers[f.order[0]])
+		f.order = f.order[1:]
+	}
+	f.cap()
+	return layer
+}
+
+// flatten removes a layer, merging its accounts into the layers referencing it
+// so that their lookups yield the same results. The lock must be held.
+func (f *FlatState) flatten(old *flatLayer) {
+	delete(f.layers, old.root)
+
+	var children []*flatLayer
+	for _, layer := range f.layers {
+		if layer.parent == old {
+			layer.parent = old.parent
+			children = append(children, layer)
+		}
+	}
+	// Without forks, move the accounts of the single descendant into the usually
+	// much larger flattened set rather than the other way around
+	if len(children) == 1 && len(children[0].accounts) <= len(old.accounts) {
+		for addr, enc := range children[0].accounts {
+			old.accounts[addr] = enc
+		}
+		children[0].accounts = old.accounts
+		return
+	}
+	for _, layer := range children {
+		for addr, enc := range old.accounts {
+			if _, ok := layer.accounts[addr]; !ok {
+				layer.accounts[addr] = enc
+			}
+		}
+	}
+}
+
+// cap drops the accounts of the oldest layers until the view holds no more than
+// the allowed number of accounts. Only layers without a parent are dropped, the
+// accounts of the others being needed to shadow those of their ancestors. The
+// lock must be held.
+func (f *FlatState) cap() {
+	size := 0
+	for _, layer := range f.layers {
+		size += len(layer.accounts)
+	}
+	for _, root := range f.order {
+		if size <= f.limit {
+			return
+		}
+		if layer := f.layers[root]; layer.parent == nil {
+			size -= len(layer.accounts)
+			layer.accounts = make(map[common.Address][]byte)
+		}
+	}
+}
+
+// storageSlot retrieves a storage slot of the trie with the given root.
+func (f *FlatState) storageSlot(root, key common.Hash) (common.Hash, bool) {
+	if value, ok := f.storage.Get(flatSlot{root, key}); ok {
+		return value.(common.Hash), true
+	}
+	return common.Hash{}, false
+}
+
+// cacheStorageSlot records a storage slot read from the trie with the given root.
+func (f *FlatState) cacheStorageSlot(root, key, value common.Hash) {
+	f.storage.Add(flatSlot{root, key}, value)
+}
@@ -0,0 +1,118 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/ethdb"
+)
+
+// Tests that reads served by the flat view match the tries across a long chain
+// of states with forks, deletions and flattened layers.
+func TestFlatStateReads(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	base, _ := New(common.Hash{}, db)
+	base.SetFlatState(NewFlatState(100000))
+
+	// Create a chain of states longer than the layers kept, forking every now and then
+	roots := []common.Hash{{}}
+	for i := 0; i < 2*flatStateLayers; i++ {
+		parent := roots[len(roots)-1]
+		if i%10 == 9 {
+			parent = roots[len(roots)-2]
+		}
+		state, err := base.New(parent)
+		if err != nil {
+			t.Fatalf("state %d: failed to open parent: %v", i, err)
+		}
+		addr := common.BytesToAddress([]byte{byte(i % 20)})
+		state.AddBalance(addr, big.NewInt(int64(i+1)))
+		state.SetState(addr, common.Hash{byte(i % 3)}, common.Hash{byte(i)})
+		if i%7 == 6 {
+			state.Suicide(common.BytesToAddress([]byte{byte(i % 20)}))
+		}
+		// The untouched sentinel account is only written by the first state
+		if i == 0 {
+			state.SetNonce(common.Address{0xff}, 42)
+		}
+		root, err := state.Commit(false)
+		if err != nil {
+			t.Fatalf("state %d: failed to commit: %v", i, err)
+		}
+		roots = append(roots, root)
+	}
+	// The sentinel written by the first, long flattened state must still be
+	// served from the flat view of the head state
+	enc, ok := base.flat.account(roots[len(roots)-1], common.Address{0xff})
+	if !ok || len(enc) == 0 {
+		t.Fatalf("flattened account missing from the flat view")
+	}
+	if layers := len(base.flat.layers); layers > flatStateLayers {
+		t.Errorf("layer count mismatch: have %d, want at most %d", layers, flatStateLayers)
+	}
+	// Compare every state read through the flat view against the tries
+	for i, root := range roots[1:] {
+		want, _ := New(root, db)
+		have, _ := base.New(root)
+		for j := 0; j < 20; j++ {
+			addr := common.BytesToAddress([]byte{byte(j)})
+			if w, h := want.Exist(addr), have.Exist(addr); w != h {
+				t.Fatalf("state %d, account %d: existence mismatch: have %v, want %v", i, j, h, w)
+			}
+			if w, h := want.GetBalance(addr), have.GetBalance(addr); w.Cmp(h) != 0 {
+				t.Fatalf("state %d, account %d: balance mismatch: have %v, want %v", i, j, h, w)
+			}
+			for k := byte(0); k < 3; k++ {
+				if w, h := want.GetState(addr, common.Hash{k}), have.GetState(addr, common.Hash{k}); w != h {
+					t.Fatalf("state %d, account %d, slot %d: storage mismatch: have %x, want %x", i, j, k, h, w)
+				}
+			}
+		}
+	}
+}
+
+// Tests that the flat view drops the oldest accounts once over its limit.
+func TestFlatStateLimit(t *testing.T) {
+	flat := NewFlatState(10)
+
+	root := common.Hash{}
+	for i := 0; i < 5; i++ {
+		accounts := make(map[common.Address][]byte)
+		for j := 0; j < 5; j++ {
+			accounts[common.BytesToAddress([]byte{byte(i), byte(j)})] = []byte{byte(i)}
+		}
+		next := common.Hash{byte(i + 1)}
+		flat.update(root, next, accounts)
+		root = next
+	}
+	// Layers with ancestors must be retained as they shadow those
+	if _, ok := flat.account(root, common.BytesToAddress([]byte{4, 0})); !ok {
+		t.Errorf("head account missing")
+	}
+	// Reads cached at a standalone root are dropped first
+	flat.cacheAccount(common.Hash{0xff}, common.Address{0xff}, []byte{0xff})
+	flat.update(root, common.Hash{0xee}, map[common.Address][]byte{{0xee}: nil})
+	if _, ok := flat.account(common.Hash{0xff}, common.Address{0xff}); ok {
+		t.Errorf("standalone account retained over the limit")
+	}
+	if enc, ok := flat.account(common.Hash{0xee}, common.Address{0xee}); !ok || len(enc) != 0 {
+		t.Errorf("deleted account mismatch: have %x, %v", enc, ok)
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/crypto"
+	"github.com/ur-technology/go-ur/rlp"
+	"github.com/ur-technology/go-ur/trie"
+)
+
+// ReverseDiff holds the accounts and storage slots a commit changed, with their
+// values before it. Walking the reverse diffs of consecutive commits backwards
+// from an available state answers reads at states whose tries are gone.
+type ReverseDiff struct {
+	Accounts []*ReverseDiffAccount
+}
+
+// ReverseDiffAccount is an account changed by a commit.
+type ReverseDiffAccount struct {
+	Address     common.Address
+	Account     []byte            // RLP encoded account before the commit, empty if missing
+	FullStorage bool              // Whether Storage is the whole previous storage (account deleted or re-created)
+	Storage     []ReverseDiffSlot // Storage slots before the commit, changed ones only unless FullStorage
+	Code        []byte            // Code before the commit if FullStorage, the states after may not reference it
+}
+
+// ReverseDiffSlot is a storage slot changed by a commit.
+type ReverseDiffSlot struct {
+	Hash  common.Hash // Hash of the slot key, as keyed in the storage trie
+	Value []byte      // RLP encoded value before the commit, empty if unset
+}
+
+// account returns the changes of an account, nil if the commit didn't touch it.
+func (d *ReverseDiff) account(addr common.Address) *ReverseDiffAccount {
+	for _, account := range d.Accounts {
+		if account.Address == addr {
+			return account
+		}
+	}
+	return nil
+}
+
+// Account returns the RLP encoded account before the commit. The second return
+// value is false if the commit didn't change the account.
+func (d *ReverseDiff) Account(addr common.Address) ([]byte, bool) {
+	if account := d.account(addr); account != nil {
+		return account.Account, true
+	}
+	return nil, false
+}
+
+// Code returns the code of an account before the commit if the commit deleted
+// or re-created it, empty otherwise.
+func (d *ReverseDiff) Code(addr common.Address) []byte {
+	if account := d.account(addr); account != nil {
+		return account.Code
+	}
+	return nil
+}
+
+// Storage returns a storage slot of an account before the commit. The second
+// return value is false if the commit didn't change the slot.
+func (d *ReverseDiff) Storage(addr common.Address, key common.Hash) (common.Hash, bool) {
+	account := d.account(addr)
+	if account == nil {
+		return common.Hash{}, false
+	}
+	hash := crypto.Keccak256Hash(key[:])
+	for _, slot := range account.Storage {
+		if slot.Hash == hash {
+			return decodeStorageValue(slot.Value), true
+		}
+	}
+	// Slots missing from a full storage were unset
+	return common.Hash{}, account.FullStorage
+}
+
+// decodeStorageValue decodes a storage slot as stored in the storage trie.
+func decodeStorageValue(enc []byte) (value common.Hash) {
+	if len(enc) > 0 {
+		_, content, _, _ := rlp.Split(enc)
+		value.SetBytes(content)
+	}
+	return value
+}
+
+// RecordReverseDiff makes the next commit record its reverse diff, retrievable
+// with ReverseDiff. A reset of the state stops the recording.
+func (self *StateDB) RecordReverseDiff() {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.rdiff = new(ReverseDiff)
+}
+
+// ReverseDiff returns the reverse diff recorded by the last commit, nil if none
+// was recorded.
+func (self *StateDB) ReverseDiff() *ReverseDiff {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	return self.rdiff
+}
+
+// recordReverseDiff adds the previous values of an object about to be committed
+// to the reverse diff, reading them from the tries of the parent state.
+func (s *StateDB) recordReverseDiff(parent *trie.SecureTrie, obj *StateObject, deleted bool) error {
+	addr := obj.Address()
+	diff := &ReverseDiffAccount{Address: addr, FullStorage: deleted || obj.created}
+
+	diff.Account = common.CopyBytes(parent.Get(addr[:]))
+	if len(diff.Account) == 0 && deleted {
+		return nil // Created and deleted within the commit
+	}
+	if len(diff.Account) > 0 {
+		var prev Account
+		if err := rlp.DecodeBytes(diff.Account, &prev); err != nil {
+			return err
+		}
+		if diff.FullStorage && !bytes.Equal(prev.CodeHash, emptyCodeHash) {
+			code, err := s.db.Get(prev.CodeHash)
+			if err != nil {
+				return err
+			}
+			diff.Code = code
+		}
+		storage, err := trie.NewSecure(prev.Root, s.db, 0)
+		if err != nil {
+			return err
+		}
+		if diff.FullStorage {
+			it := storage.Iterator()
+			for it.Next() {
+				diff.Storage = append(diff.Storage, ReverseDiffSlot{common.BytesToHash(it.Key), common.CopyBytes(it.Value)})
+			}
+			if err := it.Err(); err != nil {
+				return err
+			}
+		} else {
+			// Every written slot is cached, the ones only read are unchanged
+			for key, value := range obj.cachedStorage {
+				if enc := storage.Get(key[:]); decodeStorageValue(enc) != value {
+					diff.Storage = append(diff.Storage, ReverseDiffSlot{crypto.Keccak256Hash(key[:]), common.CopyBytes(enc)})
+				}
+			}
+		}
+	}
+	// Skip accounts left untouched, such as the ones only read
+	if !deleted && len(diff.Storage) == 0 && !diff.FullStorage {
+		if enc, _ := rlp.EncodeToBytes(obj); bytes.Equal(enc, diff.Account) {
+			return nil
+		}
+	}
+	s.rdiff.Accounts = append(s.rdiff.Accounts, diff)
+	return nil
+}
@@ -0,0 +1,168 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/crypto"
+	"github.com/ur-technology/go-ur/ethdb"
+	"github.com/ur-technology/go-ur/rlp"
+	"github.com/ur-technology/go-ur/trie"
+)
+
+// snapshotCommitInterval is the number of accounts loaded from a snapshot after
+// which the account trie is flushed to the database to bound memory use.
+const snapshotCommitInterval = 10000
+
+// SnapshotHeader is the first item of a state snapshot, identifying the block
+// whose state follows.
+type SnapshotHeader struct {
+	Number uint64      // Number of the block the snapshot was taken at
+	Hash   common.Hash // Hash of the block the snapshot was taken at
+	Root   common.Hash // State root of the block, which the snapshot must rebuild
+}
+
+// snapshotAccount is a flat account entry of a state snapshot. Accounts and
+// storage slots are keyed by their secure trie hashes, so snapshots don't rely
+// on the availability of key preimages.
+type snapshotAccount struct {
+	Hash    common.Hash
+	Nonce   uint64
+	Balance *big.Int
+	Code    []byte
+	Storage []snapshotSlot
+}
+
+// snapshotSlot is a single storage entry of a snapshot account.
+type snapshotSlot struct {
+	Hash  common.Hash
+	Value []byte
+}
+
+// WriteSnapshot streams the flat account and storage state rooted at the
+// header's state root into w, returning the number of accounts written.
+func WriteSnapshot(w io.Writer, db trie.Database, header *SnapshotHeader) (int, error) {
+	accounts, err := trie.New(header.Root, db)
+	if err != nil {
+		return 0, err
+	}
+	if err := rlp.Encode(w, header); err != nil {
+		return 0, err
+	}
+	count := 0
+	it := accounts.Iterator()
+	for it.Next() {
+		var data Account
+		if err := rlp.DecodeBytes(it.Value, &data); err != nil {
+			return count, fmt.Errorf("account %x: %v", it.Key, err)
+		}
+		account := snapshotAccount{
+			Hash:    common.BytesToHash(it.Key),
+			Nonce:   data.Nonce,
+			Balance: data.Balance,
+		}
+		if !bytes.Equal(data.CodeHash, emptyCodeHash) {
+			if account.Code, err = db.Get(data.CodeHash); err != nil {
+				return count, fmt.Errorf("account %x: missing code %x: %v", it.Key, data.CodeHash, err)
+			}
+		}
+		storage, err := trie.New(data.Root, db)
+		if err != nil {
+			return count, fmt.Errorf("account %x: %v", it.Key, err)
+		}
+		storageIt := storage.Iterator()
+		for storageIt.Next() {
+			account.Storage = append(account.Storage, snapshotSlot{
+				Hash:  common.BytesToHash(storageIt.Key),
+				Value: common.CopyBytes(storageIt.Value),
+			})
+		}
+		if err := storageIt.Err(); err != nil {
+			return count, fmt.Errorf("account %x: storage: %v", it.Key, err)
+		}
+		if err := rlp.Encode(w, &account); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, it.Err()
+}
+
+// LoadSnapshot rebuilds the state tries contained in a snapshot stream into db,
+// returning the snapshot header. An error is returned if the rebuilt state root
+// does not match the one announced in the header.
+func LoadSnapshot(r io.Reader, db ethdb.Database) (*SnapshotHeader, error) {
+	stream := rlp.NewStream(r, 0)
+
+	header := new(SnapshotHeader)
+	if err := stream.Decode(header); err != nil {
+		return nil, fmt.Errorf("invalid snapshot header: %v", err)
+	}
+	accounts, _ := trie.New(common.Hash{}, db)
+
+	for count := 1; ; count++ {
+		var account snapshotAccount
+		if err := stream.Decode(&account); err == io.EOF {
+			break
+		} else if err != nil {
+			return header, fmt.Errorf("account #%d: %v", count, err)
+		}
+		storage, _ := trie.New(common.Hash{}, db)
+		for _, slot := range account.Storage {
+			storage.Update(slot.Hash[:], slot.Value)
+		}
+		root, err := storage.CommitTo(db)
+		if err != nil {
+			return header, fmt.Errorf("account %x: storage: %v", account.Hash, err)
+		}
+		codeHash := crypto.Keccak256(account.Code)
+		if len(account.Code) > 0 {
+			if err := db.Put(codeHash, account.Code); err != nil {
+				return header, err
+			}
+		}
+		blob, err := rlp.EncodeToBytes(&Account{
+			Nonce:    account.Nonce,
+			Balance:  account.Balance,
+			Root:     root,
+			CodeHash: codeHash,
+		})
+		if err != nil {
+			return header, err
+		}
+		accounts.Update(account.Hash[:], blob)
+
+		if count%snapshotCommitInterval == 0 {
+			if _, err := accounts.CommitTo(db); err != nil {
+				return header, err
+			}
+		}
+	}
+	root, err := accounts.CommitTo(db)
+	if err != nil {
+		return header, err
+	}
+	if root != header.Root {
+		return header, fmt.Errorf("state root mismatch: have %x, want %x", root, header.Root)
+	}
+	return header, nil
+}
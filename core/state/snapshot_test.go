@@ -0,0 +1,85 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/ethdb"
+	"github.com/ur-technology/go-ur/rlp"
+)
+
+// Tests that a state snapshot rebuilds the exact same state it was taken from.
+func TestSnapshotRoundtrip(t *testing.T) {
+	db, root, accounts := makeTestState()
+
+	// Add some storage on top of the test state to cover storage tries too
+	state, _ := New(root, db)
+	for i := byte(0); i < 16; i++ {
+		state.SetState(common.BytesToAddress([]byte{i}), common.BytesToHash([]byte{i}), common.BytesToHash([]byte{i, i}))
+	}
+	root, _ = state.Commit(false)
+
+	var buf bytes.Buffer
+	count, err := WriteSnapshot(&buf, db, &SnapshotHeader{Number: 1, Root: root})
+	if err != nil {
+		t.Fatalf("failed to write snapshot: %v", err)
+	}
+	if count != len(accounts) {
+		t.Errorf("account count mismatch: have %d, want %d", count, len(accounts))
+	}
+	dstDb, _ := ethdb.NewMemDatabase()
+	header, err := LoadSnapshot(bytes.NewReader(buf.Bytes()), dstDb)
+	if err != nil {
+		t.Fatalf("failed to load snapshot: %v", err)
+	}
+	if header.Number != 1 || header.Root != root {
+		t.Errorf("header mismatch: have #%d [%x], want #1 [%x]", header.Number, header.Root, root)
+	}
+	checkStateAccounts(t, dstDb, root, accounts)
+
+	loaded, _ := New(root, dstDb)
+	for i := byte(0); i < 16; i++ {
+		have := loaded.GetState(common.BytesToAddress([]byte{i}), common.BytesToHash([]byte{i}))
+		if want := common.BytesToHash([]byte{i, i}); have != want {
+			t.Errorf("account %d: storage mismatch: have %x, want %x", i, have, want)
+		}
+	}
+}
+
+// Tests that snapshots not matching their announced state root are rejected.
+func TestSnapshotRootMismatch(t *testing.T) {
+	db, root, _ := makeTestState()
+
+	var buf bytes.Buffer
+	header := &SnapshotHeader{Root: root}
+	if _, err := WriteSnapshot(&buf, db, header); err != nil {
+		t.Fatalf("failed to write snapshot: %v", err)
+	}
+	// Replace the header with one announcing a different root
+	original, _ := rlp.EncodeToBytes(header)
+	forged, _ := rlp.EncodeToBytes(&SnapshotHeader{Root: common.HexToHash("0xdeadbeef")})
+	blob := append(forged, buf.Bytes()[len(original):]...)
+
+	dstDb, _ := ethdb.NewMemDatabase()
+	if _, err := LoadSnapshot(bytes.NewReader(blob), dstDb); err == nil || !strings.Contains(err.Error(), "root mismatch") {
+		t.Fatalf("forged snapshot error mismatch: have %v, want root mismatch", err)
+	}
+}
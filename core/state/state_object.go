@@ -86,6 +86,7 @@ type StateObject struct {
 	// When an object is marked suicided it will be delete from the trie
 	// during the "update" phase of the state transition.
 	dirtyCode bool // true if the code was updated
+	created   bool // true if the account was (re)created, dropping any previous storage
 	suicided  bool
 	touched   bool
 	deleted   bool
@@ -170,13 +171,23 @@ func (self *StateObject) GetState(db trie.Database, key common.Hash) common.Hash
 	if exists {
 		return value
 	}
-	// Load from DB in case it is missing.
-	if enc := self.getTrie(db).Get(key[:]); len(enc) > 0 {
-		_, content, _, err := rlp.Split(enc)
-		if err != nil {
-			self.setError(err)
+	// Load from the flat view or the DB in case it is missing. Writes only reach
+	// the trie along with a root update, so its root identifies the contents.
+	flat := self.db.flat
+	if flat != nil {
+		value, exists = flat.storageSlot(self.data.Root, key)
+	}
+	if !exists {
+		if enc := self.getTrie(db).Get(key[:]); len(enc) > 0 {
+			_, content, _, err := rlp.Split(enc)
+			if err != nil {
+				self.setError(err)
+			}
+			value.SetBytes(content)
+		}
+		if flat != nil && self.dbErr == nil {
+			flat.cacheStorageSlot(self.data.Root, key, value)
 		}
-		value.SetBytes(content)
 	}
 	if (value != common.Hash{}) {
 		self.cachedStorage[key] = value
@@ -297,6 +308,7 @@ func (self *StateObject) deepCopy(db *StateDB, onDirty func(addr common.Address)
 	stateObject.dirtyStorage = self.dirtyStorage.Copy()
 	stateObject.cachedStorage = self.dirtyStorage.Copy()
 	stateObject.suicided = self.suicided
+	stateObject.created = self.created
 	stateObject.dirtyCode = self.dirtyCode
 	stateObject.deleted = self.deleted
 	return stateObject
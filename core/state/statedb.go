@@ -62,6 +62,11 @@ type StateDB struct {
 	pastTries     []*trie.SecureTrie
 	codeSizeCache *lru.Cache
 
+	root common.Hash // Root of the last committed state the trie was opened at
+	flat *FlatState  // Flat view of the recent states to serve reads from, if any
+
+	rdiff *ReverseDiff // Reverse diff of the next or last commit, if recording
+
 	// This map holds 'live' objects, which will get modified while processing a state transition.
 	stateObjects      map[common.Address]*StateObject
 	stateObjectsDirty map[common.Address]struct{}
@@ -94,6 +99,7 @@ func New(root common.Hash, db ethdb.Database) (*StateDB, error) {
 		db:                db,
 		trie:              tr,
 		codeSizeCache:     csc,
+		root:              root,
 		stateObjects:      make(map[common.Address]*StateObject),
 		stateObjectsDirty: make(map[common.Address]struct{}),
 		refund:            new(big.Int),
@@ -115,6 +121,8 @@ func (self *StateDB) New(root common.Hash) (*StateDB, error) {
 		db:                self.db,
 		trie:              tr,
 		codeSizeCache:     self.codeSizeCache,
+		root:              root,
+		flat:              self.flat,
 		stateObjects:      make(map[common.Address]*StateObject),
 		stateObjectsDirty: make(map[common.Address]struct{}),
 		refund:            new(big.Int),
@@ -133,6 +141,7 @@ func (self *StateDB) Reset(root common.Hash) error {
 		return err
 	}
 	self.trie = tr
+	self.root = root
 	self.stateObjects = make(map[common.Address]*StateObject)
 	self.stateObjectsDirty = make(map[common.Address]struct{})
 	self.thash = common.Hash{}
@@ -140,6 +149,7 @@ func (self *StateDB) Reset(root common.Hash) error {
 	self.txIndex = 0
 	self.logs = make(map[common.Hash]vm.Logs)
 	self.logSize = 0
+	self.rdiff = nil
 	self.clearJournalAndRefund()
 
 	return nil
@@ -157,6 +167,16 @@ func (self *StateDB) openTrie(root common.Hash) (*trie.SecureTrie, error) {
 	return trie.NewSecure(root, self.db, MaxTrieCacheGen)
 }
 
+// SetFlatState sets the flat view of the recent states used to serve account and
+// storage reads ahead of the tries. The states derived from this one share it,
+// and their commits keep it up to date.
+func (self *StateDB) SetFlatState(flat *FlatState) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	self.flat = flat
+}
+
 func (self *StateDB) pushTrie(t *trie.SecureTrie) {
 	self.lock.Lock()
 	defer self.lock.Unlock()
@@ -379,8 +399,17 @@ func (self *StateDB) GetStateObject(addr common.Address) (stateObject *StateObje
 		return obj
 	}
 
-	// Load the object from the database.
-	enc := self.trie.Get(addr[:])
+	// Load the object from the flat view or the database.
+	enc, ok := []byte(nil), false
+	if self.flat != nil {
+		enc, ok = self.flat.account(self.root, addr)
+	}
+	if !ok {
+		enc = self.trie.Get(addr[:])
+		if self.flat != nil {
+			self.flat.cacheAccount(self.root, addr, enc)
+		}
+	}
 	if len(enc) == 0 {
 		return nil
 	}
@@ -419,6 +448,7 @@ func (self *StateDB) MarkStateObjectDirty(addr common.Address) {
 func (self *StateDB) createObject(addr common.Address) (newobj, prev *StateObject) {
 	prev = self.GetStateObject(addr)
 	newobj = newObject(self, addr, Account{}, self.MarkStateObjectDirty)
+	newobj.created = true
 	newobj.setNonce(0) // sets the object to dirty
 	if prev == nil {
 		if glog.V(logger.Core) {
@@ -462,6 +492,8 @@ func (self *StateDB) Copy() *StateDB {
 		trie:              self.trie,
 		pastTries:         self.pastTries,
 		codeSizeCache:     self.codeSizeCache,
+		root:              self.root,
+		flat:              self.flat,
 		stateObjects:      make(map[common.Address]*StateObject, len(self.stateObjectsDirty)),
 		stateObjectsDirty: make(map[common.Address]struct{}, len(self.stateObjectsDirty)),
 		refund:            new(big.Int).Set(self.refund),
@@ -581,14 +613,30 @@ func (s *StateDB) clearJournalAndRefund() {
 func (s *StateDB) commit(dbw trie.DatabaseWriter, deleteEmptyObjects bool) (root common.Hash, err error) {
 	defer s.clearJournalAndRefund()
 
-	// Commit objects to the trie.
+	// Open the parent state to record the previous values from, if requested.
+	var parent *trie.SecureTrie
+	if s.rdiff != nil {
+		s.rdiff.Accounts = s.rdiff.Accounts[:0]
+		if parent, err = trie.NewSecure(s.root, s.db, 0); err != nil {
+			return common.Hash{}, err
+		}
+	}
+	// Commit objects to the trie, collecting the changes for the flat view.
+	changes := make(map[common.Address][]byte)
 	for addr, stateObject := range s.stateObjects {
 		_, isDirty := s.stateObjectsDirty[addr]
+		deleted := stateObject.suicided || (isDirty && deleteEmptyObjects && stateObject.empty())
+		if parent != nil && (deleted || isDirty) {
+			if err := s.recordReverseDiff(parent, stateObject, deleted); err != nil {
+				return common.Hash{}, err
+			}
+		}
 		switch {
-		case stateObject.suicided || (isDirty && deleteEmptyObjects && stateObject.empty()):
+		case deleted:
 			// If the object has been removed, don't bother syncing it
 			// and just mark it for deletion in the trie.
 			s.deleteStateObject(stateObject)
+			changes[addr] = nil
 		case isDirty:
 			// Write any contract code associated with the state object
 			if stateObject.code != nil && stateObject.dirtyCode {
@@ -603,6 +651,7 @@ func (s *StateDB) commit(dbw trie.DatabaseWriter, deleteEmptyObjects bool) (root
 			}
 			// Update the object in the main account trie.
 			s.updateStateObject(stateObject)
+			changes[addr], _ = rlp.EncodeToBytes(stateObject)
 		}
 		delete(s.stateObjectsDirty, addr)
 	}
@@ -610,6 +659,10 @@ func (s *StateDB) commit(dbw trie.DatabaseWriter, deleteEmptyObjects bool) (root
 	root, err = s.trie.CommitTo(dbw)
 	if err == nil {
 		s.pushTrie(s.trie)
+		if s.flat != nil {
+			s.flat.update(s.root, root, changes)
+		}
+		s.root = root
 	}
 	return root, err
 }
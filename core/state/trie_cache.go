@@ -0,0 +1,287 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"sync"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/ethdb"
+	"github.com/ur-technology/go-ur/rlp"
+	"github.com/ur-technology/go-ur/trie"
+)
+
+// TrieCache is a write-back cache in front of a database, holding the trie nodes
+// and contract code of recently committed states in memory instead of writing
+// them to disk right away. Only the states explicitly committed are written out,
+// along with everything they reference, while the nodes of the intermediate ones
+// are garbage collected once no recent state references them anymore.
+//
+// Entries are keyed by their hash, anything else (e.g. trie key preimages) goes
+// straight to the database. TrieCache implements ethdb.Database, so states can be
+// opened on top of it as on the database itself.
+type TrieCache struct {
+	db   ethdb.Database // Persistent database the committed states are written to
+	keep int            // Number of recent state roots to keep in memory
+
+	nodes map[common.Hash][]byte // Trie nodes and code of the uncommitted states
+	roots []common.Hash          // Recent state roots, oldest first
+	size  common.StorageSize     // Memory used by the cached entries
+	lock  sync.RWMutex
+}
+
+// NewTrieCache creates a trie cache on top of db, keeping in memory the nodes of
+// the given number of recent states.
+func NewTrieCache(db ethdb.Database, keep int) *TrieCache {
+	return &TrieCache{
+		db:    db,
+		keep:  keep,
+		nodes: make(map[common.Hash][]byte),
+	}
+}
+
+// Put caches a trie node or contract code, writing anything else to the database.
+func (c *TrieCache) Put(key []byte, value []byte) error {
+	if len(key) != common.HashLength {
+		return c.db.Put(key, value)
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.insert(common.BytesToHash(key), value)
+	return nil
+}
+
+// insert caches an entry, the lock must be held.
+func (c *TrieCache) insert(hash common.Hash, value []byte) {
+	if _, ok := c.nodes[hash]; ok {
+		return
+	}
+	c.nodes[hash] = common.CopyBytes(value)
+	c.size += common.StorageSize(common.HashLength + len(value))
+}
+
+// Get retrieves an entry from the cache, falling back to the database.
+func (c *TrieCache) Get(key []byte) ([]byte, error) {
+	if len(key) == common.HashLength {
+		c.lock.RLock()
+		value, ok := c.nodes[common.BytesToHash(key)]
+		c.lock.RUnlock()
+		if ok {
+			return common.CopyBytes(value), nil
+		}
+	}
+	return c.db.Get(key)
+}
+
+// Delete removes an entry from both the cache and the database.
+func (c *TrieCache) Delete(key []byte) error {
+	if len(key) == common.HashLength {
+		c.lock.Lock()
+		if value, ok := c.nodes[common.BytesToHash(key)]; ok {
+			delete(c.nodes, common.BytesToHash(key))
+			c.size -= common.StorageSize(common.HashLength + len(value))
+		}
+		c.lock.Unlock()
+	}
+	return c.db.Delete(key)
+}
+
+// Close does nothing, the underlying database is owned by the caller. Anything
+// not committed yet is lost.
+func (c *TrieCache) Close() {}
+
+// NewBatch creates a batch whose cacheable entries are moved into the cache when
+// it is written.
+func (c *TrieCache) NewBatch() ethdb.Batch {
+	return &trieCacheBatch{cache: c, batch: c.db.NewBatch()}
+}
+
+// Size returns the memory used by the cached entries.
+func (c *TrieCache) Size() common.StorageSize {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.size
+}
+
+// Reference marks the state with the given root as a recent one, whose nodes are
+// kept in memory until it falls out of the recent set.
+func (c *TrieCache) Reference(root common.Hash) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.roots = append(c.roots, root)
+	if len(c.roots) > c.keep {
+		c.roots = c.roots[len(c.roots)-c.keep:]
+	}
+}
+
+// Commit writes the state with the given root to the database, then garbage
+// collects the cache, keeping only the nodes of the recent states which aren't
+// on disk yet. If the cache still holds more than limit bytes (zero meaning no
+// limit), the recent states are flushed to the database too, so that they stay
+// available for reorgs. The number of nodes and bytes written is returned.
+func (c *TrieCache) Commit(root common.Hash, limit common.StorageSize) (int, common.StorageSize, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// Write out everything reachable from the root which isn't on disk yet
+	written := c.reachable([]common.Hash{root})
+	size, err := c.flush(written)
+	if err != nil {
+		return 0, 0, err
+	}
+	// Keep the rest of the recent states in memory, dropping everything else
+	kept := c.reachable(c.roots)
+
+	nodes := make(map[common.Hash][]byte, len(kept))
+	c.size = 0
+	for hash := range kept {
+		nodes[hash] = c.nodes[hash]
+		c.size += common.StorageSize(common.HashLength + len(nodes[hash]))
+	}
+	c.nodes = nodes
+
+	if limit > 0 && c.size > limit {
+		flushed, err := c.flush(kept)
+		if err != nil {
+			return len(written), size, err
+		}
+		return len(written) + len(kept), size + flushed, nil
+	}
+	return len(written), size, nil
+}
+
+// flush writes the given cached entries to the database and evicts them from
+// the cache, returning the number of bytes written. The lock must be held.
+func (c *TrieCache) flush(hashes map[common.Hash]struct{}) (common.StorageSize, error) {
+	var (
+		batch = c.db.NewBatch()
+		size  common.StorageSize
+	)
+	for hash := range hashes {
+		value := c.nodes[hash]
+		if err := batch.Put(hash[:], value); err != nil {
+			return 0, err
+		}
+		size += common.StorageSize(common.HashLength + len(value))
+	}
+	if err := batch.Write(); err != nil {
+		return 0, err
+	}
+	for hash := range hashes {
+		delete(c.nodes, hash)
+	}
+	c.size -= size
+	return size, nil
+}
+
+// cacheItemKind tells how to follow the references of a cached entry.
+type cacheItemKind byte
+
+const (
+	accountNode  cacheItemKind = iota // Node of the account trie
+	storageNode                       // Node of a storage trie
+	contractCode                      // Contract code, no references
+)
+
+// reachable returns the hashes of the cached entries referenced by the states
+// with the given roots, stopping at the ones already on disk. The lock must be
+// held.
+func (c *TrieCache) reachable(roots []common.Hash) map[common.Hash]struct{} {
+	type item struct {
+		hash common.Hash
+		kind cacheItemKind
+	}
+	var (
+		seen  = make(map[common.Hash]struct{})
+		queue = make([]item, 0, len(roots))
+	)
+	for _, root := range roots {
+		queue = append(queue, item{root, accountNode})
+	}
+	for len(queue) > 0 {
+		next := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+
+		if _, ok := seen[next.hash]; ok {
+			continue
+		}
+		blob, ok := c.nodes[next.hash]
+		if !ok {
+			continue
+		}
+		seen[next.hash] = struct{}{}
+		if next.kind == contractCode {
+			continue
+		}
+		hashes, values, err := trie.NodeChildren(blob)
+		if err != nil {
+			continue
+		}
+		for _, hash := range hashes {
+			queue = append(queue, item{hash, next.kind})
+		}
+		if next.kind != accountNode {
+			continue
+		}
+		for _, value := range values {
+			var account Account
+			if err := rlp.DecodeBytes(value, &account); err != nil {
+				continue
+			}
+			queue = append(queue, item{account.Root, storageNode})
+			queue = append(queue, item{common.BytesToHash(account.CodeHash), contractCode})
+		}
+	}
+	return seen
+}
+
+// trieCacheBatch is a write batch moving the cacheable entries into a trie cache
+// and the rest into a database batch.
+type trieCacheBatch struct {
+	cache *TrieCache
+	batch ethdb.Batch
+	keys  []common.Hash
+	vals  [][]byte
+}
+
+// Put queues an entry for writing.
+func (b *trieCacheBatch) Put(key, value []byte) error {
+	if len(key) != common.HashLength {
+		return b.batch.Put(key, value)
+	}
+	b.keys = append(b.keys, common.BytesToHash(key))
+	b.vals = append(b.vals, common.CopyBytes(value))
+	return nil
+}
+
+// Write flushes the queued entries to the cache and the database.
+func (b *trieCacheBatch) Write() error {
+	if err := b.batch.Write(); err != nil {
+		return err
+	}
+	b.cache.lock.Lock()
+	defer b.cache.lock.Unlock()
+
+	for i, key := range b.keys {
+		b.cache.insert(key, b.vals[i])
+	}
+	b.keys, b.vals = nil, nil
+	return nil
+}
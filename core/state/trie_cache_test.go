@@ -0,0 +1,101 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/ethdb"
+)
+
+// Tests that committing a state through the trie cache writes all of it to disk,
+// keeps the referenced recent states in memory and drops the rest, flushing the
+// recent states to disk once the cache outgrows its limit.
+func TestTrieCacheCommit(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	cache := NewTrieCache(db, 2)
+
+	// Create a chain of three states, leaving the middle one unreferenced
+	var roots []common.Hash
+	for i := byte(0); i < 3; i++ {
+		parent := common.Hash{}
+		if i > 0 {
+			parent = roots[i-1]
+		}
+		state, _ := New(parent, cache)
+		for j := byte(0); j < 16; j++ {
+			addr := common.BytesToAddress([]byte{j})
+			state.AddBalance(addr, big.NewInt(int64(i+1)))
+			state.SetState(addr, common.Hash{i}, common.Hash{j + 1})
+			state.SetCode(addr, []byte{i, j})
+		}
+		root, err := state.Commit(false)
+		if err != nil {
+			t.Fatalf("state %d: failed to commit: %v", i, err)
+		}
+		if i != 1 {
+			cache.Reference(root)
+		}
+		roots = append(roots, root)
+	}
+	if _, err := db.Get(roots[2][:]); err == nil {
+		t.Fatalf("uncommitted state root found on disk")
+	}
+	if _, _, err := cache.Commit(roots[2], 0); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	// The committed state must be complete on disk
+	state, err := New(roots[2], db)
+	if err != nil {
+		t.Fatalf("failed to open committed state: %v", err)
+	}
+	for j := byte(0); j < 16; j++ {
+		addr := common.BytesToAddress([]byte{j})
+		if balance := state.GetBalance(addr); balance.Cmp(big.NewInt(6)) != 0 {
+			t.Errorf("account %d: balance mismatch: have %v, want 6", j, balance)
+		}
+		if value := state.GetState(addr, common.Hash{0}); value != (common.Hash{j + 1}) {
+			t.Errorf("account %d: storage mismatch: have %x, want %x", j, value, common.Hash{j + 1})
+		}
+		if code := state.GetCode(addr); !bytes.Equal(code, []byte{2, j}) {
+			t.Errorf("account %d: code mismatch: have %x, want %x", j, code, []byte{2, j})
+		}
+	}
+	// The referenced older state must be in memory only, the other one gone
+	if _, err := New(roots[0], cache); err != nil {
+		t.Errorf("referenced state missing: %v", err)
+	}
+	if _, err := db.Get(roots[0][:]); err == nil {
+		t.Errorf("referenced state written to disk")
+	}
+	if _, err := cache.Get(roots[1][:]); err == nil {
+		t.Errorf("unreferenced state not garbage collected")
+	}
+	// Exceeding the limit must flush the recent states to disk
+	if _, _, err := cache.Commit(roots[2], 1); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	if size := cache.Size(); size != 0 {
+		t.Errorf("cache size mismatch: have %v, want 0", size)
+	}
+	if _, err := New(roots[0], db); err != nil {
+		t.Errorf("referenced state not flushed to disk: %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core/state"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/crypto"
+	"github.com/ur-technology/go-ur/ethdb"
+	"github.com/ur-technology/go-ur/logger"
+	"github.com/ur-technology/go-ur/logger/glog"
+	"github.com/ur-technology/go-ur/rlp"
+)
+
+var (
+	// ErrNoHistory is returned when reading a state neither available nor within
+	// the window of the kept reverse diffs.
+	ErrNoHistory = errors.New("historical state not available")
+
+	emptyCodeHash = crypto.Keccak256Hash(nil)
+)
+
+// WriteReverseDiff stores the reverse diff of the state changes of a block and
+// removes the ones of all blocks gone out of the ReverseDiffBlocks window.
+func (bc *BlockChain) WriteReverseDiff(block *types.Block, diff *state.ReverseDiff) {
+	limit := bc.cacheConfig.ReverseDiffBlocks
+	if limit == 0 || diff == nil {
+		return
+	}
+	if err := WriteReverseDiff(bc.chainDb, block.Hash(), block.NumberU64(), diff); err != nil {
+		glog.V(logger.Error).Infof("failed to store reverse diff: %v", err)
+		return
+	}
+	if number := block.NumberU64(); number > limit {
+		DeleteReverseDiffs(bc.chainDb, number-limit)
+	}
+}
+
+// ReverseDiffBlocks returns the number of most recent blocks whose states can
+// be read through reverse diffs after their tries are gone, zero if disabled.
+func (bc *BlockChain) ReverseDiffBlocks() uint64 {
+	return bc.cacheConfig.ReverseDiffBlocks
+}
+
+// HistoricalState returns the state of a canonical block whose tries are gone,
+// rebuilt from the closest available later state and the reverse diffs of the
+// blocks in between.
+func (bc *BlockChain) HistoricalState(header *types.Header) (*HistoricalState, error) {
+	number := header.Number.Uint64()
+	if GetCanonicalHash(bc.chainDb, number) != header.Hash() {
+		return nil, fmt.Errorf("block #%d [%x…] not canonical", number, header.Hash().Bytes()[:4])
+	}
+	var (
+		head  = bc.CurrentBlock().NumberU64()
+		diffs []*state.ReverseDiff
+	)
+	for n := number + 1; n <= head && n-number <= bc.cacheConfig.ReverseDiffBlocks; n++ {
+		hash := GetCanonicalHash(bc.chainDb, n)
+		diff := GetReverseDiff(bc.chainDb, hash, n)
+		if diff == nil {
+			break
+		}
+		diffs = append(diffs, diff)
+
+		if child := bc.GetHeader(hash, n); child != nil {
+			if base, err := bc.StateAt(child.Root); err == nil {
+				return &HistoricalState{db: bc.stateDb, base: base, diffs: diffs}, nil
+			}
+		}
+	}
+	return nil, ErrNoHistory
+}
+
+// HistoricalState is a read-only past state, serving the accounts and storage
+// slots the reverse diffs changed from them and the rest from an available
+// later state.
+type HistoricalState struct {
+	db    ethdb.Database
+	base  *state.StateDB       // Closest available state after the requested one
+	diffs []*state.ReverseDiff // Reverse diffs of the blocks up to base, oldest first
+}
+
+// account returns an account as of the historical state, nil if it didn't
+// exist, along with the reverse diff it was found in. The diff is nil if the
+// account is unchanged since.
+func (s *HistoricalState) account(addr common.Address) (*state.Account, *state.ReverseDiff, error) {
+	for _, diff := range s.diffs {
+		if enc, ok := diff.Account(addr); ok {
+			if len(enc) == 0 {
+				return nil, diff, nil
+			}
+			account := new(state.Account)
+			if err := rlp.DecodeBytes(enc, account); err != nil {
+				return nil, diff, err
+			}
+			return account, diff, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+// GetBalance retrieves the balance of an account.
+func (s *HistoricalState) GetBalance(addr common.Address) (*big.Int, error) {
+	account, diff, err := s.account(addr)
+	switch {
+	case err != nil:
+		return nil, err
+	case diff == nil:
+		return s.base.GetBalance(addr), nil
+	case account == nil:
+		return new(big.Int), nil
+	}
+	return account.Balance, nil
+}
+
+// GetNonce retrieves the nonce of an account.
+func (s *HistoricalState) GetNonce(addr common.Address) (uint64, error) {
+	account, diff, err := s.account(addr)
+	switch {
+	case err != nil:
+		return 0, err
+	case diff == nil:
+		return s.base.GetNonce(addr), nil
+	case account == nil:
+		return 0, nil
+	}
+	return account.Nonce, nil
+}
+
+// GetCode retrieves the code of an account.
+func (s *HistoricalState) GetCode(addr common.Address) ([]byte, error) {
+	account, diff, err := s.account(addr)
+	switch {
+	case err != nil:
+		return nil, err
+	case diff == nil:
+		return s.base.GetCode(addr), nil
+	case account == nil || common.BytesToHash(account.CodeHash) == emptyCodeHash:
+		return nil, nil
+	}
+	if code := diff.Code(addr); len(code) > 0 {
+		return code, nil
+	}
+	return s.db.Get(account.CodeHash)
+}
+
+// GetState retrieves a storage slot of an account.
+func (s *HistoricalState) GetState(addr common.Address, key common.Hash) common.Hash {
+	for _, diff := range s.diffs {
+		if value, ok := diff.Storage(addr, key); ok {
+			return value
+		}
+	}
+	return s.base.GetState(addr, key)
+}
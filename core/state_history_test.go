@@ -0,0 +1,97 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core/state"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/crypto"
+	"github.com/ur-technology/go-ur/ethdb"
+	"github.com/ur-technology/go-ur/event"
+	"github.com/ur-technology/go-ur/params"
+)
+
+// Tests that the states of recent blocks garbage collected in full gc mode can
+// still be read through the reverse diffs of the blocks after them.
+func TestHistoricalState(t *testing.T) {
+	var (
+		key, _   = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr     = crypto.PubkeyToAddress(key.PublicKey)
+		contract = crypto.CreateAddress(addr, 0)
+		signer   = types.MakeSigner(params.TestChainConfig, big.NewInt(1))
+		db, _    = ethdb.NewMemDatabase()
+		gendb, _ = ethdb.NewMemDatabase()
+		funds    = GenesisAccount{addr, big.NewInt(1000000000)}
+		genesis  = WriteGenesisBlockForTesting(db, funds)
+		config   = &BlockChainConfig{TrieCacheLimit: 16, TrieCommitInterval: 4, ReverseDiffBlocks: 16}
+	)
+	WriteGenesisBlockForTesting(gendb, funds)
+
+	// Deploy a contract storing the block number into slot 0 on every call
+	blocks, _ := GenerateChain(params.TestChainConfig, nil, genesis, gendb, 10, func(i int, gen *BlockGen) {
+		var tx *types.Transaction
+		if i == 0 {
+			code := common.FromHex("0x6443600055006000526005601bf3")
+			tx, _ = types.NewContractCreation(gen.TxNonce(addr), new(big.Int), big.NewInt(100000), new(big.Int), code).SignECDSA(signer, key)
+		} else {
+			tx, _ = types.NewTransaction(gen.TxNonce(addr), contract, big.NewInt(1000), big.NewInt(100000), new(big.Int), nil).SignECDSA(signer, key)
+		}
+		gen.AddTx(tx)
+	})
+	blockchain, _ := NewBlockChainWithConfig(db, params.TestChainConfig, config, FakePow{}, new(event.TypeMux))
+	if _, err := blockchain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	// Simulate a crash, dropping the states not written to disk
+	blockchain, _ = NewBlockChainWithConfig(db, params.TestChainConfig, config, FakePow{}, new(event.TypeMux))
+	if head := blockchain.CurrentBlock().NumberU64(); head != 8 {
+		t.Fatalf("head mismatch after crash: have #%d, want #8", head)
+	}
+	for number := uint64(0); number < 8; number++ {
+		header := blockchain.GetHeaderByNumber(number)
+		want, err := state.New(header.Root, gendb)
+		if err != nil {
+			t.Fatalf("block #%d: reference state missing: %v", number, err)
+		}
+		have, err := blockchain.HistoricalState(header)
+		if err != nil {
+			t.Fatalf("block #%d: failed to retrieve historical state: %v", number, err)
+		}
+		if balance, _ := have.GetBalance(addr); balance.Cmp(want.GetBalance(addr)) != 0 {
+			t.Errorf("block #%d: balance mismatch: have %v, want %v", number, balance, want.GetBalance(addr))
+		}
+		if nonce, _ := have.GetNonce(addr); nonce != want.GetNonce(addr) {
+			t.Errorf("block #%d: nonce mismatch: have %d, want %d", number, nonce, want.GetNonce(addr))
+		}
+		if code, _ := have.GetCode(contract); !bytes.Equal(code, want.GetCode(contract)) {
+			t.Errorf("block #%d: code mismatch: have %x, want %x", number, code, want.GetCode(contract))
+		}
+		if slot := have.GetState(contract, common.Hash{}); slot != want.GetState(contract, common.Hash{}) {
+			t.Errorf("block #%d: storage mismatch: have %x, want %x", number, slot, want.GetState(contract, common.Hash{}))
+		}
+	}
+	// States beyond the window of the reverse diffs must be rejected
+	config.ReverseDiffBlocks = 2
+	if _, err := blockchain.HistoricalState(blockchain.GetHeaderByNumber(1)); err != ErrNoHistory {
+		t.Fatalf("state beyond the window: error mismatch: have %v, want %v", err, ErrNoHistory)
+	}
+}
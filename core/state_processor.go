@@ -82,7 +82,7 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg
 		receipts = append(receipts, receipt)
 		allLogs = append(allLogs, logs...)
 	}
-	AccumulateRewards(statedb, header, block.Uncles())
+	p.bc.Engine().Finalize(p.bc, statedb, header, block.Uncles())
 
 	return receipts, allLogs, totalUsedGas, err
 }
@@ -98,31 +98,14 @@ func ApplyTransaction(config *params.ChainConfig, bc *BlockChain, gp *GasPool, s
 		return nil, nil, nil, err
 	}
 
-	// check for a signup transaction
-	if isSignupTransaction(msg) {
-		if signupChain, err := getSignupChain(bc, msg.Data()); err == nil {
-			// pay the miner BlockReward for every signup
-			statedb.AddBalance(header.Coinbase, BlockReward)
-			// pay the member being signed up
-			statedb.AddBalance(*msg.To(), SignupReward)
-			// pay the referral members
-			remRewards := TotalSingupRewards
-			for i, m := range signupChain {
-				statedb.AddBalance(m, MembersSingupRewards[i])
-				remRewards = new(big.Int).Sub(remRewards, MembersSingupRewards[i])
-			}
-			txFrom := msg.From()
-			recvAddr := PrivilegedAddressesReceivers[txFrom]
-			// pay 5000 UR to the UR Future Fund
-			statedb.AddBalance(recvAddr.URFF, URFutureFundFee)
-			// pay the receiver address any remaining fees from the members and the management fee
-			pBlock := bc.GetBlockByHash(header.ParentHash)
-			mngFee := calculateTxManagementFee(pBlock.NSignups(), pBlock.TotalWei())
-			statedb.AddBalance(PrivilegedAddressesReceivers[txFrom].Receiver, new(big.Int).Add(mngFee, remRewards))
-		}
+	vmenv := NewEnv(statedb, config, bc, msg, header, cfg)
+
+	// Signup rewards are credited with their transaction, ahead of it
+	if IsSignupTransaction(config, msg) {
+		creditSignup(vmenv, bc, msg)
 	}
 
-	_, gas, err := ApplyMessage(NewEnv(statedb, config, bc, msg, header, cfg), msg, gp)
+	_, gas, err := ApplyMessage(vmenv, msg, gp)
 	if err != nil {
 		return nil, nil, nil, err
 	}
@@ -145,26 +128,41 @@ func ApplyTransaction(config *params.ChainConfig, bc *BlockChain, gp *GasPool, s
 	return receipt, logs, gas, err
 }
 
-func calculateAccumulatedRewards(header *types.Header, uncles []*types.Header) map[common.Address]*big.Int {
+// UncleReward returns the reward paid to the miner of the given uncle when it is
+// included in the block with the given header:
+// ((uncleBlockNumber + 8 - currentBlockNumber) * UncleBase) / 8
+// where UncleBase is the uncle reward of the uncle policy, or BlockReward.
+func UncleReward(config *params.ChainConfig, header, uncle *types.Header) *big.Int {
+	base := Rewards(config).BlockReward
+	if policy := config.UnclePolicyAt(header.Number); policy != nil && policy.UncleReward != nil {
+		base = policy.UncleReward
+	}
+	r := new(big.Int).Add(uncle.Number, big8)
+	r.Sub(r, header.Number)
+	r.Mul(r, base)
+	return r.Div(r, big8)
+}
+
+// UncleInclusionReward returns the reward paid to the miner of block number for
+// every uncle it includes, the nephew reward of the uncle policy or 1/32 *
+// BlockReward.
+func UncleInclusionReward(config *params.ChainConfig, number *big.Int) *big.Int {
+	if policy := config.UnclePolicyAt(number); policy != nil && policy.NephewReward != nil {
+		return new(big.Int).Set(policy.NephewReward)
+	}
+	return new(big.Int).Div(Rewards(config).BlockReward, big32)
+}
+
+func calculateAccumulatedRewards(config *params.ChainConfig, header *types.Header, uncles []*types.Header) map[common.Address]*big.Int {
 	rew := make(map[common.Address]*big.Int, len(uncles)+1)
-	reward := new(big.Int).Set(BlockReward)
-	r := new(big.Int)
+	reward := new(big.Int).Set(Rewards(config).BlockReward)
 	for _, uncle := range uncles {
-		// the miner for the uncle block receives
-		// ((uncleBlockNumber + 8 - currentBlockNumber) * BlockReward) / 8
-		r.Add(uncle.Number, big8)
-		r.Sub(r, header.Number)
-		r.Mul(r, BlockReward)
-		r.Div(r, big8)
 		ub, ok := rew[uncle.Coinbase]
 		if !ok {
 			ub = big.NewInt(0)
 		}
-		rew[uncle.Coinbase] = ub.Add(ub, r)
-
-		// the miner receives 1/32 * BlockReward for every uncle block
-		r.Div(BlockReward, big32)
-		reward.Add(reward, r)
+		rew[uncle.Coinbase] = ub.Add(ub, UncleReward(config, header, uncle))
+		reward.Add(reward, UncleInclusionReward(config, header.Number))
 	}
 	ub, ok := rew[header.Coinbase]
 	if !ok {
@@ -178,8 +176,8 @@ func calculateAccumulatedRewards(header *types.Header, uncles []*types.Header) m
 // mining reward. The total reward consists of the static block reward
 // and rewards for included uncles. The coinbase of each uncle block is
 // also rewarded.
-func AccumulateRewards(statedb *state.StateDB, header *types.Header, uncles []*types.Header) {
-	rewards := calculateAccumulatedRewards(header, uncles)
+func AccumulateRewards(config *params.ChainConfig, statedb *state.StateDB, header *types.Header, uncles []*types.Header) {
+	rewards := calculateAccumulatedRewards(config, header, uncles)
 	for a, r := range rewards {
 		statedb.AddBalance(a, r)
 	}
@@ -0,0 +1,157 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core/state"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/core/vm"
+	"github.com/ur-technology/go-ur/ethdb"
+	"github.com/ur-technology/go-ur/params"
+)
+
+// Tests that contract fee receivers are credited and have their hook invoked
+// only once the fee contract fork is active.
+func TestCreditFeeContract(t *testing.T) {
+	var (
+		sender   = common.HexToAddress("0x482cf297b08d4523c97ec3a54e80d2d07acd76fa")
+		receiver = common.HexToAddress("0x59ab9bb134b529709333f7ae68f3f93c204d280b")
+		amount   = big.NewInt(5000)
+		// PUSH1 4 CALLDATALOAD PUSH1 0 SSTORE STOP: stores the credited sender
+		code = common.Hex2Bytes("6004356000550000")
+	)
+	for _, forked := range []bool{false, true} {
+		db, _ := ethdb.NewMemDatabase()
+		statedb, _ := state.New(common.Hash{}, db)
+		statedb.SetCode(receiver, code)
+
+		config := *params.TestChainConfig
+		if forked {
+			config.FeeContractBlock = big.NewInt(1)
+		}
+		header := &types.Header{Number: big.NewInt(1), GasLimit: big.NewInt(1000000), Difficulty: big.NewInt(1), Time: big.NewInt(0)}
+		msg := types.NewMessage(sender, &receiver, 0, new(big.Int), new(big.Int), new(big.Int), nil, false)
+		env := NewEnv(statedb, &config, nil, msg, header, vm.Config{})
+
+		creditFee(env, sender, receiver, amount)
+
+		if balance := statedb.GetBalance(receiver); balance.Cmp(amount) != 0 {
+			t.Errorf("forked=%v: receiver balance mismatch: have %v, want %v", forked, balance, amount)
+		}
+		want := common.Hash{}
+		if forked {
+			want = common.BytesToHash(sender[:])
+		}
+		if stored := statedb.GetState(receiver, common.Hash{}); stored != want {
+			t.Errorf("forked=%v: hook storage mismatch: have %x, want %x", forked, stored, want)
+		}
+	}
+}
+
+// Tests that uncle miners are paid according to the distance of their uncle to
+// the including block, and that the includer is paid for every uncle.
+func TestUncleRewards(t *testing.T) {
+	var (
+		miner   = common.HexToAddress("0x482cf297b08d4523c97ec3a54e80d2d07acd76fa")
+		uncler1 = common.HexToAddress("0x59ab9bb134b529709333f7ae68f3f93c204d280b")
+		uncler2 = common.HexToAddress("0x46c0b8e0e95a772ad8764d3190a34cd4a60c7a98")
+		header  = &types.Header{Number: big.NewInt(10), Coinbase: miner}
+		uncles  = []*types.Header{
+			{Number: big.NewInt(9), Coinbase: uncler1},
+			{Number: big.NewInt(3), Coinbase: uncler2},
+			{Number: big.NewInt(8), Coinbase: uncler2},
+		}
+	)
+	eighths := func(n int64) *big.Int {
+		r := new(big.Int).Mul(BlockReward, big.NewInt(n))
+		return r.Div(r, big8)
+	}
+	for i, want := range []*big.Int{eighths(7), eighths(1), eighths(6)} {
+		if have := UncleReward(params.TestChainConfig, header, uncles[i]); have.Cmp(want) != 0 {
+			t.Errorf("uncle %d: reward mismatch: have %v, want %v", i, have, want)
+		}
+	}
+	rewards := calculateAccumulatedRewards(params.TestChainConfig, header, uncles)
+	minerReward := new(big.Int).Mul(UncleInclusionReward(params.TestChainConfig, header.Number), big.NewInt(3))
+	minerReward.Add(minerReward, BlockReward)
+	for addr, want := range map[common.Address]*big.Int{miner: minerReward, uncler1: eighths(7), uncler2: eighths(7)} {
+		if have := rewards[addr]; have == nil || have.Cmp(want) != 0 {
+			t.Errorf("%x: accumulated reward mismatch: have %v, want %v", addr, have, want)
+		}
+	}
+}
+
+// Tests that the uncle policy replaces the uncle and nephew rewards from its
+// switch block on.
+func TestUnclePolicyRewards(t *testing.T) {
+	config := &params.ChainConfig{
+		UnclePolicyBlock: big.NewInt(10),
+		UnclePolicy:      &params.UnclePolicy{UncleReward: big.NewInt(800), NephewReward: new(big.Int)},
+	}
+	var (
+		miner  = common.HexToAddress("0x482cf297b08d4523c97ec3a54e80d2d07acd76fa")
+		uncler = common.HexToAddress("0x59ab9bb134b529709333f7ae68f3f93c204d280b")
+	)
+	// Before the switch the Ethereum rewards apply
+	header := &types.Header{Number: big.NewInt(9), Coinbase: miner}
+	uncle := &types.Header{Number: big.NewInt(8), Coinbase: uncler}
+	if have, want := UncleReward(config, header, uncle), new(big.Int).Div(new(big.Int).Mul(BlockReward, big.NewInt(7)), big8); have.Cmp(want) != 0 {
+		t.Errorf("pre-switch uncle reward mismatch: have %v, want %v", have, want)
+	}
+	// From the switch on the policy rewards apply
+	header = &types.Header{Number: big.NewInt(10), Coinbase: miner}
+	uncle = &types.Header{Number: big.NewInt(8), Coinbase: uncler}
+	rewards := calculateAccumulatedRewards(config, header, []*types.Header{uncle})
+	if have, want := rewards[uncler], big.NewInt(600); have == nil || have.Cmp(want) != 0 {
+		t.Errorf("uncle reward mismatch: have %v, want %v", have, want)
+	}
+	if have := rewards[miner]; have == nil || have.Cmp(BlockReward) != 0 {
+		t.Errorf("miner reward mismatch: have %v, want %v", have, BlockReward)
+	}
+}
+
+// Tests that the issuance ceiling covers the most rewarding block the schedule
+// allows, and drops the uncle rewards when uncles are disabled.
+func TestMaxBlockIssuance(t *testing.T) {
+	config := &params.ChainConfig{
+		UnclePolicyBlock: big.NewInt(10),
+		UnclePolicy:      &params.UnclePolicy{NoUncles: true},
+	}
+	header := &types.Header{Number: big.NewInt(9)}
+	uncles := []*types.Header{{Number: big.NewInt(8)}, {Number: big.NewInt(8), Coinbase: common.Address{1}}}
+
+	accumulated := new(big.Int)
+	for _, reward := range calculateAccumulatedRewards(config, header, uncles) {
+		accumulated.Add(accumulated, reward)
+	}
+	if have := MaxBlockIssuance(config, header, 0); have.Cmp(accumulated) != 0 {
+		t.Errorf("ceiling without signups mismatch: have %v, want %v", have, accumulated)
+	}
+	signups := new(big.Int).Add(signupIssuance(Rewards(config)), ManagementFee)
+	want := new(big.Int).Add(accumulated, signups.Mul(signups, big.NewInt(3)))
+	if have := MaxBlockIssuance(config, header, 3); have.Cmp(want) != 0 {
+		t.Errorf("ceiling with signups mismatch: have %v, want %v", have, want)
+	}
+	// Without uncles only the block reward remains
+	if have := MaxBlockIssuance(config, &types.Header{Number: big.NewInt(10)}, 0); have.Cmp(BlockReward) != 0 {
+		t.Errorf("ceiling without uncles mismatch: have %v, want %v", have, BlockReward)
+	}
+}
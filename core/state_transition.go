@@ -56,6 +56,7 @@ type StateTransition struct {
 	value         *big.Int
 	data          []byte
 	state         vm.Database
+	failed        bool // whether the EVM execution aborted with an error
 
 	env vm.Environment
 }
@@ -225,7 +226,7 @@ func (self *StateTransition) TransitionDb() (ret []byte, requiredGas, usedGas *b
 	}
 
 	// don't send 1 wei or execute any code for a signup transaction
-	if vmenv, ok := self.env.(*VMEnv); ok && isSignupTx(sender.Address(), self.value, self.data) {
+	if vmenv, ok := self.env.(*VMEnv); ok && isSignupTx(vmenv.chainConfig, sender.Address(), self.value, self.data) {
 		if _, err := getSignupChain(vmenv.chain, self.data); err == nil {
 			self.data = nil
 			self.value = big.NewInt(0)
@@ -259,6 +260,7 @@ func (self *StateTransition) TransitionDb() (ret []byte, requiredGas, usedGas *b
 
 	// We aren't interested in errors here. Errors returned by the VM are non-consensus errors and therefor shouldn't bubble up
 	if err != nil {
+		self.failed = true
 		err = nil
 	}
 
@@ -270,6 +272,13 @@ func (self *StateTransition) TransitionDb() (ret []byte, requiredGas, usedGas *b
 	return ret, requiredGas, self.gasUsed(), err
 }
 
+// Failed reports whether the EVM execution of the message aborted with an error,
+// e.g. running out of gas or reverting. The message is still applied, consuming
+// its gas, as a failed execution is not a consensus error.
+func (self *StateTransition) Failed() bool {
+	return self.failed
+}
+
 func (self *StateTransition) refundGas() {
 	// Return eth for remaining gas to the sender account,
 	// exchanged at the original rate.
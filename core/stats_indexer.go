@@ -0,0 +1,162 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/ethdb"
+)
+
+const (
+	// BlockStatsSectionSize is the number of blocks of a block stats section.
+	BlockStatsSectionSize = 1024
+
+	// blockStatsConfirms is the number of blocks a section must be below the
+	// chain head before being indexed, so that reorgs rarely invalidate it.
+	blockStatsConfirms = 256
+)
+
+// BlockStats is the gas usage and activity of a canonical block.
+type BlockStats struct {
+	Number   uint64
+	GasUsed  uint64
+	GasLimit uint64
+	Txs      uint64 // Number of transactions
+	Signups  uint64 // Number of signups
+}
+
+// StatsIndexer pre-aggregates the statistics of the canonical blocks in the
+// background, storing them in sections so that long ranges are served from a
+// few database reads instead of a header and a body per block.
+type StatsIndexer struct {
+	*ChainIndexer
+	db ethdb.Database
+}
+
+// NewStatsIndexer creates an indexer over the canonical chain of the database,
+// resuming from the sections stored by a previous run.
+func NewStatsIndexer(db ethdb.Database) *StatsIndexer {
+	return newStatsIndexer(db, BlockStatsSectionSize, blockStatsConfirms)
+}
+
+// newStatsIndexer creates an indexer with custom section size and confirmation
+// count, allowing tests to work with short chains.
+func newStatsIndexer(db ethdb.Database, sectionSize, confirms uint64) *StatsIndexer {
+	return &StatsIndexer{
+		ChainIndexer: NewChainIndexer(db, &statsIndexerBackend{db: db}, "block stats", sectionSize, confirms),
+		db:           db,
+	}
+}
+
+// Stats returns the statistics of the canonical blocks from first up to and
+// including last, served from the index where available and assembled from the
+// chain database above it.
+func (s *StatsIndexer) Stats(first, last uint64) ([]*BlockStats, error) {
+	if first > last {
+		return nil, fmt.Errorf("invalid block range: #%d > #%d", first, last)
+	}
+	size, sections := s.Status()
+
+	stats := make([]*BlockStats, 0, last-first+1)
+	for number := first; number <= last; {
+		if section := number / size; section < sections {
+			_, blocks := GetBlockStatsSection(s.db, section)
+			if uint64(len(blocks)) != size {
+				return nil, fmt.Errorf("block stats of section %d missing", section)
+			}
+			for ; number <= last && number/size == section; number++ {
+				stats = append(stats, blocks[number%size])
+			}
+			continue
+		}
+		block, err := blockStats(s.db, number, GetCanonicalHash(s.db, number))
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, block)
+		number++
+	}
+	return stats, nil
+}
+
+// statsIndexerBackend aggregates the statistics of the blocks of a section.
+type statsIndexerBackend struct {
+	db    ethdb.Database
+	stats []*BlockStats
+}
+
+func (s *statsIndexerBackend) Sections() uint64 {
+	return GetBlockStatsSections(s.db)
+}
+
+func (s *statsIndexerBackend) SetSections(sections uint64) error {
+	return WriteBlockStatsSections(s.db, sections)
+}
+
+func (s *statsIndexerBackend) SectionHead(section uint64) common.Hash {
+	head, _ := GetBlockStatsSection(s.db, section)
+	return head
+}
+
+func (s *statsIndexerBackend) Reset(section uint64) error {
+	s.stats = s.stats[:0]
+	return nil
+}
+
+func (s *statsIndexerBackend) Process(number uint64, hash common.Hash) error {
+	block, err := blockStats(s.db, number, hash)
+	if err != nil {
+		return err
+	}
+	s.stats = append(s.stats, block)
+	return nil
+}
+
+func (s *statsIndexerBackend) Commit(section uint64, head common.Hash) error {
+	return WriteBlockStatsSection(s.db, section, head, s.stats)
+}
+
+// blockStats assembles the statistics of a block from the chain database, the
+// signups being the growth of the network signup count over the parent.
+func blockStats(db ethdb.Database, number uint64, hash common.Hash) (*BlockStats, error) {
+	header := GetHeader(db, hash, number)
+	if header == nil {
+		return nil, fmt.Errorf("header #%d [%x…] missing", number, hash[:4])
+	}
+	body := GetBody(db, hash, number)
+	if body == nil {
+		return nil, fmt.Errorf("body #%d [%x…] missing", number, hash[:4])
+	}
+	stats := &BlockStats{
+		Number:   number,
+		GasUsed:  header.GasUsed.Uint64(),
+		GasLimit: header.GasLimit.Uint64(),
+		Txs:      uint64(len(body.Transactions)),
+	}
+	if number > 0 && header.NSignups != nil {
+		parent := GetHeader(db, header.ParentHash, number-1)
+		if parent == nil {
+			return nil, fmt.Errorf("header #%d [%x…] missing", number-1, header.ParentHash[:4])
+		}
+		if parent.NSignups != nil && header.NSignups.Cmp(parent.NSignups) > 0 {
+			stats.Signups = header.NSignups.Uint64() - parent.NSignups.Uint64()
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/crypto"
+	"github.com/ur-technology/go-ur/ethdb"
+	"github.com/ur-technology/go-ur/params"
+)
+
+// Tests that the stats indexer aggregates the confirmed sections of the
+// canonical chain, serves the blocks above them from the chain and rolls back
+// the sections reorged out of it.
+func TestStatsIndexer(t *testing.T) {
+	var (
+		key, _   = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr     = crypto.PubkeyToAddress(key.PublicKey)
+		db, _    = ethdb.NewMemDatabase()
+		gendb, _ = ethdb.NewMemDatabase()
+		funds    = GenesisAccount{addr, big.NewInt(1000000000)}
+		genesis  = WriteGenesisBlockForTesting(db, funds)
+		signer   = types.HomesteadSigner{}
+	)
+	WriteGenesisBlockForTesting(gendb, funds)
+
+	// Generate a chain with i%3 transactions in every block, and a fork of it
+	// with a single transaction per block overtaking it in the third section
+	transfers := func(count func(int) int) func(int, *BlockGen) {
+		return func(i int, gen *BlockGen) {
+			for j := 0; j < count(i); j++ {
+				tx, _ := types.NewTransaction(gen.TxNonce(addr), addr, big.NewInt(1), params.TxGas, nil, nil).SignECDSA(signer, key)
+				gen.AddTx(tx)
+			}
+		}
+	}
+	blocks, _ := GenerateChain(params.TestChainConfig, nil, genesis, gendb, 40, transfers(func(i int) int { return i % 3 }))
+	fork, _ := GenerateChain(params.TestChainConfig, nil, blocks[19], gendb, 25, transfers(func(int) int { return 1 }))
+
+	canonize := func(blocks []*types.Block) {
+		for _, block := range blocks {
+			WriteBlock(db, block)
+			WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+			WriteHeadBlockHash(db, block.Hash())
+		}
+	}
+	check := func(indexer *StatsIndexer, sections, head uint64) {
+		for {
+			indexed, err := indexer.update()
+			if err != nil {
+				t.Fatalf("failed to update index: %v", err)
+			}
+			if !indexed {
+				break
+			}
+		}
+		if _, have := indexer.Status(); have != sections {
+			t.Fatalf("section count mismatch: have %d, want %d", have, sections)
+		}
+		// Query ranges crossing the indexed sections and the unindexed blocks
+		for _, first := range []uint64{0, 5, 8, 13} {
+			stats, err := indexer.Stats(first, head)
+			if err != nil {
+				t.Fatalf("range #%d-#%d: failed to retrieve stats: %v", first, head, err)
+			}
+			if len(stats) != int(head-first+1) {
+				t.Fatalf("range #%d-#%d: stats count mismatch: have %d, want %d", first, head, len(stats), head-first+1)
+			}
+			for i, have := range stats {
+				number := first + uint64(i)
+				block := GetBlock(db, GetCanonicalHash(db, number), number)
+				if have.Number != number || have.GasUsed != block.GasUsed().Uint64() || have.GasLimit != block.GasLimit().Uint64() || have.Txs != uint64(len(block.Transactions())) {
+					t.Fatalf("block %d: stats mismatch: have %+v, want gas %v/%v, %d txs", number, have, block.GasUsed(), block.GasLimit(), len(block.Transactions()))
+				}
+			}
+		}
+	}
+	// Index the confirmed sections of the chain: blocks #0-#31 with the head at #40
+	canonize(blocks)
+	indexer := newStatsIndexer(db, 8, 4)
+	check(indexer, 4, 40)
+
+	if _, err := indexer.Stats(30, 41); err == nil {
+		t.Errorf("stats beyond the chain head retrieved")
+	}
+	// Reorg the chain from block #21, the second half of the index must be rebuilt
+	canonize(fork)
+	check(indexer, 5, 45)
+	if head, _ := GetBlockStatsSection(db, 2); head != fork[2].Hash() {
+		t.Errorf("section head mismatch: have %x, want %x", head, fork[2].Hash())
+	}
+	// The sections must be resumed by a new indexer
+	if _, sections := newStatsIndexer(db, 8, 4).Status(); sections != 5 {
+		t.Errorf("resumed section count mismatch: have %d, want 5", sections)
+	}
+}
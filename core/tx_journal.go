@@ -0,0 +1,123 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/rlp"
+)
+
+// errNoActiveJournal is returned if a transaction is journaled while the
+// journal file isn't open.
+var errNoActiveJournal = errors.New("no active journal")
+
+// txJournal is an append-only file of the local transactions, RLP encoded one
+// after the other, replayed into the pool on startup so the transactions
+// accepted via RPC but not yet mined survive a restart.
+type txJournal struct {
+	path   string         // Filesystem path of the journal
+	writer io.WriteCloser // Output stream new transactions are appended to
+}
+
+// newTxJournal creates a transaction journal at the given path.
+func newTxJournal(path string) *txJournal {
+	return &txJournal{path: path}
+}
+
+// load parses the transactions of the journal, feeding them to the given
+// callback. A missing journal is not an error, a truncated last entry (e.g. a
+// crash mid-write) ends the replay.
+func (journal *txJournal) load(add func(*types.Transaction) error) (total, dropped int, err error) {
+	input, err := os.Open(journal.path)
+	if os.IsNotExist(err) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	defer input.Close()
+
+	stream := rlp.NewStream(input, 0)
+	for {
+		tx := new(types.Transaction)
+		if err := stream.Decode(tx); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return total, dropped, nil
+			}
+			return total, dropped, err
+		}
+		total++
+		if add(tx) != nil {
+			dropped++
+		}
+	}
+}
+
+// insert appends a transaction to the journal.
+func (journal *txJournal) insert(tx *types.Transaction) error {
+	if journal.writer == nil {
+		return errNoActiveJournal
+	}
+	return rlp.Encode(journal.writer, tx)
+}
+
+// rotate replaces the journal with the given transactions, dropping the ones
+// mined or evicted since the last rotation, and reopens it for appending.
+func (journal *txJournal) rotate(txs types.Transactions) error {
+	if journal.writer != nil {
+		if err := journal.writer.Close(); err != nil {
+			return err
+		}
+		journal.writer = nil
+	}
+	replacement, err := os.OpenFile(journal.path+".new", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	for _, tx := range txs {
+		if err = rlp.Encode(replacement, tx); err != nil {
+			replacement.Close()
+			return err
+		}
+	}
+	if err := replacement.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(journal.path+".new", journal.path); err != nil {
+		return err
+	}
+	sink, err := os.OpenFile(journal.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	journal.writer = sink
+	return nil
+}
+
+// close flushes the journal contents to disk and closes the file.
+func (journal *txJournal) close() error {
+	var err error
+	if journal.writer != nil {
+		err = journal.writer.Close()
+		journal.writer = nil
+	}
+	return err
+}
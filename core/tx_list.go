@@ -235,13 +235,15 @@ func newTxList(strict bool) *txList {
 
 // Add tries to insert a new transaction into the list, returning whether the
 // transaction was accepted, and if yes, any previous transaction it replaced.
+// A transaction with the same nonce is only replaced if the new one's gas price
+// exceeds its own by at least priceBump percent.
 //
 // If the new transaction is accepted into the list, the lists' cost threshold
 // is also potentially updated.
-func (l *txList) Add(tx *types.Transaction) (bool, *types.Transaction) {
+func (l *txList) Add(tx *types.Transaction, priceBump uint64) (bool, *types.Transaction) {
 	// If there's an older better transaction, abort
 	old := l.txs.Get(tx.Nonce())
-	if old != nil && old.GasPrice().Cmp(tx.GasPrice()) >= 0 {
+	if old != nil && !replaces(tx, old, priceBump) {
 		return false, nil
 	}
 	// Otherwise overwrite the old transaction with the current one
@@ -252,6 +254,14 @@ func (l *txList) Add(tx *types.Transaction) (bool, *types.Transaction) {
 	return true, old
 }
 
+// replaces reports whether tx pays a gas price higher than old's and by at least
+// priceBump percent, so it may replace old.
+func replaces(tx, old *types.Transaction, priceBump uint64) bool {
+	threshold := new(big.Int).Mul(old.GasPrice(), new(big.Int).SetUint64(100+priceBump))
+	threshold.Div(threshold, big.NewInt(100))
+	return tx.GasPrice().Cmp(old.GasPrice()) > 0 && tx.GasPrice().Cmp(threshold) >= 0
+}
+
 // Forward removes all transactions from the list with a nonce lower than the
 // provided threshold. Every removed transaction is returned for any post-removal
 // maintenance.
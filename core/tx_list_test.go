@@ -38,7 +38,7 @@ func TestStrictTxListAdd(t *testing.T) {
 	// Insert the transactions in a random order
 	list := newTxList(true)
 	for _, v := range rand.Perm(len(txs)) {
-		list.Add(txs[v])
+		list.Add(txs[v], DefaultTxPoolLimits().PriceBump)
 	}
 	// Verify internal state
 	if len(list.txs.items) != len(txs) {
@@ -18,7 +18,6 @@ package core
 
 import (
 	"errors"
-	"fmt"
 	"math/big"
 	"sort"
 	"sync"
@@ -46,6 +45,24 @@ var (
 	ErrIntrinsicGas       = errors.New("Intrinsic gas too low")
 	ErrGasLimit           = errors.New("Exceeds block gas limit")
 	ErrNegativeValue      = errors.New("Negative value")
+	ErrReplaceUnderpriced = errors.New("Replacement transaction underpriced")
+)
+
+// TxDropReason is the reason code of a transaction rejected or evicted by the
+// transaction pool.
+type TxDropReason string
+
+const (
+	TxRejectInvalid     TxDropReason = "invalid"      // Failed the validation rules
+	TxRejectUnderpriced TxDropReason = "underpriced"  // Replacement not paying the price bump over the pooled transaction
+	TxDropReplaced      TxDropReason = "replaced"     // Replaced by a higher priced transaction with the same nonce
+	TxDropUnpayable     TxDropReason = "unpayable"    // Sender can't pay for the transaction anymore
+	TxDropAccountLimit  TxDropReason = "accountlimit" // Queued beyond the per account limit
+	TxDropPoolLimit     TxDropReason = "poollimit"    // Evicted to bring the pool back under its global limits
+	TxDropExpired       TxDropReason = "expired"      // Queued for longer than the pool lifetime
+	TxDropRemoved       TxDropReason = "removed"      // Removed explicitly, e.g. by the miner failing to execute it
+	TxDropCheap         TxDropReason = "cheap"        // Priced below a raised gas price floor
+	TxDropNonceUsed     TxDropReason = "nonceused"    // Nonce used by another transaction included in a block
 )
 
 var (
@@ -53,10 +70,35 @@ var (
 	maxPendingTotal      = uint64(4096)  // Max limit of pending transactions from all accounts (soft)
 	maxQueuedPerAccount  = uint64(64)    // Max limit of queued transactions per address
 	maxQueuedInTotal     = uint64(1024)  // Max limit of queued transactions from all accounts
-	maxQueuedLifetime    = 3 * time.Hour // Max amount of time transactions from idle accounts are queued
+	maxQueuedLifetime    = 3 * time.Hour // Max amount of time non-executable transactions are queued
+	minPriceBump         = uint64(10)    // Min gas price bump in percent to replace a pooled transaction
 	evictionInterval     = time.Minute   // Time interval to check for evictable transactions
 )
 
+// TxPoolLimits are the limits on the number of transactions a pool holds, on
+// how long they are queued and on the price of the transactions replacing them.
+// They may be adjusted while the pool is running.
+type TxPoolLimits struct {
+	AccountSlots uint64        // Min number of guaranteed pending transaction slots per account
+	GlobalSlots  uint64        // Max number of pending transactions from all accounts (soft)
+	AccountQueue uint64        // Max number of queued transactions per account
+	GlobalQueue  uint64        // Max number of queued transactions from all accounts
+	Lifetime     time.Duration // Max amount of time non-executable transactions are queued
+	PriceBump    uint64        // Min gas price bump in percent to replace a transaction with the same nonce
+}
+
+// DefaultTxPoolLimits returns the limits new pools are created with.
+func DefaultTxPoolLimits() TxPoolLimits {
+	return TxPoolLimits{
+		AccountSlots: minPendingPerAccount,
+		GlobalSlots:  maxPendingTotal,
+		AccountQueue: maxQueuedPerAccount,
+		GlobalQueue:  maxQueuedInTotal,
+		Lifetime:     maxQueuedLifetime,
+		PriceBump:    minPriceBump,
+	}
+}
+
 var (
 	// Metrics for the pending pool
 	pendingDiscardCounter = metrics.NewCounter("txpool/pending/discard")
@@ -69,6 +111,7 @@ var (
 	queuedReplaceCounter = metrics.NewCounter("txpool/queued/replace")
 	queuedRLCounter      = metrics.NewCounter("txpool/queued/ratelimit") // Dropped due to rate limiting
 	queuedNofundsCounter = metrics.NewCounter("txpool/queued/nofunds")   // Dropped due to out-of-funds
+	queuedExpiredCounter = metrics.NewCounter("txpool/queued/expired")   // Dropped due to the lifetime
 
 	// General tx metrics
 	invalidTxCounter = metrics.NewCounter("txpool/invalid")
@@ -76,6 +119,9 @@ var (
 
 type stateFn func() (*state.StateDB, error)
 
+// txLookupFn reports whether a transaction is included in the canonical chain.
+type txLookupFn func(hash common.Hash) bool
+
 // TxPool contains all currently known transactions. Transactions
 // enter the pool when they are received from the network or submitted
 // locally. They exit the pool when they are included in the blockchain.
@@ -85,20 +131,30 @@ type stateFn func() (*state.StateDB, error)
 // two states over time as they are received and processed.
 type TxPool struct {
 	config       *params.ChainConfig
-	currentState stateFn // The state function which will allow us to do some pre checks
+	currentState stateFn    // The state function which will allow us to do some pre checks
+	included     txLookupFn // Lookup of the included transactions (nil = nonce used means included)
 	pendingState *state.ManagedState
 	gasLimit     func() *big.Int // The current gas limit function callback
 	minGasPrice  *big.Int
+	limits       TxPoolLimits
 	eventMux     *event.TypeMux
 	events       event.Subscription
 	localTx      *txSet
+	locals       map[common.Address]struct{} // Accounts exempt from the gas price floor and eviction
 	signer       types.Signer
 	mu           sync.RWMutex
 
+	journal   *txJournal               // Journal of the local transactions to replay on restart (nil = disabled)
+	journaled map[common.Hash]struct{} // Local transactions in the journal
+
 	pending map[common.Address]*txList         // All currently processable transactions
 	queue   map[common.Address]*txList         // Queued but non-processable transactions
 	all     map[common.Hash]*types.Transaction // All transactions to allow lookups
-	beats   map[common.Address]time.Time       // Last heartbeat from each known account
+	queued  map[common.Hash]time.Time          // Time each queued transaction entered the queue
+
+	statuses    []TxStatusEvent // Status events waiting to be posted, in order
+	statusLock  sync.Mutex      // Lock protecting the status events
+	statusReady chan struct{}   // Notification of status events waiting
 
 	wg   sync.WaitGroup // for shutdown sync
 	quit chan struct{}
@@ -106,27 +162,33 @@ type TxPool struct {
 	homestead bool
 }
 
-func NewTxPool(config *params.ChainConfig, eventMux *event.TypeMux, currentStateFn stateFn, gasLimitFn func() *big.Int) *TxPool {
+func NewTxPool(config *params.ChainConfig, eventMux *event.TypeMux, currentStateFn stateFn, gasLimitFn func() *big.Int, includedFn txLookupFn) *TxPool {
 	pool := &TxPool{
 		config:       config,
 		signer:       types.NewEIP155Signer(config.ChainId),
 		pending:      make(map[common.Address]*txList),
 		queue:        make(map[common.Address]*txList),
 		all:          make(map[common.Hash]*types.Transaction),
-		beats:        make(map[common.Address]time.Time),
+		queued:       make(map[common.Hash]time.Time),
 		eventMux:     eventMux,
 		currentState: currentStateFn,
+		included:     includedFn,
 		gasLimit:     gasLimitFn,
 		minGasPrice:  new(big.Int),
+		limits:       DefaultTxPoolLimits(),
 		pendingState: nil,
 		localTx:      newTxSet(),
+		locals:       make(map[common.Address]struct{}),
+		journaled:    make(map[common.Hash]struct{}),
 		events:       eventMux.Subscribe(ChainHeadEvent{}, GasPriceChanged{}, RemovedTransactionEvent{}),
+		statusReady:  make(chan struct{}, 1),
 		quit:         make(chan struct{}),
 	}
 
-	pool.wg.Add(2)
+	pool.wg.Add(3)
 	go pool.eventLoop()
 	go pool.expirationLoop()
+	go pool.statusLoop()
 
 	return pool
 }
@@ -150,9 +212,7 @@ func (pool *TxPool) eventLoop() {
 			pool.resetState()
 			pool.mu.Unlock()
 		case GasPriceChanged:
-			pool.mu.Lock()
-			pool.minGasPrice = ev.Price
-			pool.mu.Unlock()
+			pool.SetGasPrice(ev.Price)
 		case RemovedTransactionEvent:
 			pool.AddBatch(ev.Txs)
 		}
@@ -192,9 +252,71 @@ func (pool *TxPool) Stop() {
 	pool.events.Unsubscribe()
 	close(pool.quit)
 	pool.wg.Wait()
+
+	if pool.journal != nil {
+		pool.mu.Lock()
+		if err := pool.journal.rotate(pool.journaledTxs()); err != nil {
+			glog.V(logger.Warn).Infof("Failed to rotate transaction journal: %v", err)
+		}
+		pool.journal.close()
+		pool.mu.Unlock()
+	}
 	glog.V(logger.Info).Infoln("Transaction pool stopped")
 }
 
+// Limits returns the current limits of the pool.
+func (pool *TxPool) Limits() TxPoolLimits {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	return pool.limits
+}
+
+// SetLimits changes the limits of the pool, dropping any transactions beyond
+// the new ones right away.
+func (pool *TxPool) SetLimits(limits TxPoolLimits) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.limits = limits
+	pool.promoteExecutables()
+}
+
+// GasPrice returns the gas price floor of the remote transactions.
+func (pool *TxPool) GasPrice() *big.Int {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	return new(big.Int).Set(pool.minGasPrice)
+}
+
+// SetGasPrice changes the gas price floor of the remote transactions, dropping
+// the pooled ones priced below it right away.
+func (pool *TxPool) SetGasPrice(price *big.Int) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.minGasPrice = price
+
+	var dropped int
+	for hash, tx := range pool.all {
+		if tx.GasPrice().Cmp(price) >= 0 || pool.localTx.contains(hash) {
+			continue
+		}
+		from, _ := types.Sender(pool.signer, tx) // already validated during insertion
+		if _, local := pool.locals[from]; local {
+			continue
+		}
+		pool.removeTx(hash)
+		pool.drop(tx, TxDropCheap, nil)
+		dropped++
+	}
+	if dropped > 0 {
+		pool.promoteExecutables()
+	}
+	glog.V(logger.Info).Infof("Transaction pool gas price floor set to %v, %d transactions dropped", price, dropped)
+}
+
 func (pool *TxPool) State() *state.ManagedState {
 	pool.mu.RLock()
 	defer pool.mu.RUnlock()
@@ -254,6 +376,108 @@ func (pool *TxPool) Pending() map[common.Address]types.Transactions {
 	return pending
 }
 
+// SetJournal enables the journal of the local transactions at the given path,
+// replaying into the pool the ones of a previous run and regenerating it every
+// rejournal interval (zero = only on shutdown) to drop the mined transactions.
+func (pool *TxPool) SetJournal(path string, rejournal time.Duration) error {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	journal := newTxJournal(path)
+	total, dropped, err := journal.load(func(tx *types.Transaction) error {
+		pool.localTx.add(tx.Hash())
+		if err := pool.add(tx); err != nil {
+			return err
+		}
+		if from, err := types.Sender(pool.signer, tx); err == nil {
+			pool.locals[from] = struct{}{}
+		}
+		pool.journaled[tx.Hash()] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		glog.V(logger.Warn).Infof("Failed to load transaction journal: %v", err)
+	}
+	pool.promoteExecutables()
+	glog.V(logger.Info).Infof("Loaded %d local transactions from the journal, %d stale ones dropped", total-dropped, dropped)
+
+	if err := journal.rotate(pool.journaledTxs()); err != nil {
+		return err
+	}
+	pool.journal = journal
+
+	if rejournal > 0 {
+		pool.wg.Add(1)
+		go pool.journalLoop(rejournal)
+	}
+	return nil
+}
+
+// journalLoop regenerates the journal periodically, dropping the transactions
+// no longer in the pool.
+func (pool *TxPool) journalLoop(interval time.Duration) {
+	defer pool.wg.Done()
+
+	rejournal := time.NewTicker(interval)
+	defer rejournal.Stop()
+
+	for {
+		select {
+		case <-rejournal.C:
+			pool.mu.Lock()
+			if err := pool.journal.rotate(pool.journaledTxs()); err != nil {
+				glog.V(logger.Warn).Infof("Failed to rotate transaction journal: %v", err)
+			}
+			pool.mu.Unlock()
+
+		case <-pool.quit:
+			return
+		}
+	}
+}
+
+// journaledTxs returns the journaled local transactions still in the pool, in
+// nonce order, forgetting the ones gone.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) journaledTxs() types.Transactions {
+	txs := make(types.Transactions, 0, len(pool.journaled))
+	for hash := range pool.journaled {
+		if tx := pool.all[hash]; tx != nil {
+			txs = append(txs, tx)
+		} else {
+			delete(pool.journaled, hash)
+		}
+	}
+	sort.Sort(types.TxByNonce(txs))
+	return txs
+}
+
+// AddLocal queues a transaction submitted locally, journaling it to survive a
+// restart. Its sender becomes a local account, whose transactions are exempt
+// from the gas price floor and from eviction.
+func (pool *TxPool) AddLocal(tx *types.Transaction) error {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.localTx.add(tx.Hash())
+	if err := pool.add(tx); err != nil {
+		return err
+	}
+	if from, err := types.Sender(pool.signer, tx); err == nil {
+		pool.locals[from] = struct{}{}
+	}
+	if pool.journal != nil {
+		pool.journaled[tx.Hash()] = struct{}{}
+		if err := pool.journal.insert(tx); err != nil {
+			glog.V(logger.Warn).Infof("Failed to journal local transaction %x: %v", tx.Hash(), err)
+		}
+	}
+	pool.promoteExecutables()
+
+	return nil
+}
+
 // SetLocal marks a transaction as local, skipping gas price
 //  check against local miner minimum in the future
 func (pool *TxPool) SetLocal(tx *types.Transaction) {
@@ -262,12 +486,27 @@ func (pool *TxPool) SetLocal(tx *types.Transaction) {
 	pool.localTx.add(tx.Hash())
 }
 
+// SetLocals marks accounts as local, exempting all their transactions from the
+// gas price floor and from eviction, as if they were submitted locally.
+func (pool *TxPool) SetLocals(accounts []common.Address) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	for _, account := range accounts {
+		pool.locals[account] = struct{}{}
+	}
+}
+
 // validateTx checks whether a transaction is valid according
 // to the consensus rules.
 func (pool *TxPool) validateTx(tx *types.Transaction) error {
-	local := pool.localTx.contains(tx.Hash())
+	from, err := types.Sender(pool.signer, tx)
+	if err != nil {
+		return ErrInvalidSender
+	}
 	// Drop transactions under our own minimal accepted gas price
-	if !local && pool.minGasPrice.Cmp(tx.GasPrice()) > 0 {
+	_, local := pool.locals[from]
+	if !local && !pool.localTx.contains(tx.Hash()) && pool.minGasPrice.Cmp(tx.GasPrice()) > 0 {
 		return ErrCheap
 	}
 
@@ -276,11 +515,6 @@ func (pool *TxPool) validateTx(tx *types.Transaction) error {
 		return err
 	}
 
-	from, err := types.Sender(pool.signer, tx)
-	if err != nil {
-		return ErrInvalidSender
-	}
-
 	// Make sure the account exist. Non existent accounts
 	// haven't got funds and well therefor never pass.
 	if !currentState.Exist(from) {
@@ -325,13 +559,20 @@ func (pool *TxPool) add(tx *types.Transaction) error {
 	// If the transaction is alreayd known, discard it
 	hash := tx.Hash()
 	if pool.all[hash] != nil {
-		return fmt.Errorf("Known transaction: %x", hash[:4])
+		return &KnownTxErr{Hash: hash}
 	}
 	// Otherwise ensure basic validation passes and queue it up
 	if err := pool.validateTx(tx); err != nil {
 		invalidTxCounter.Inc(1)
+		pool.drop(tx, TxRejectInvalid, err)
 		return err
 	}
+	// Reject replacements not paying the price bump over the transaction they would replace
+	from, _ := types.Sender(pool.signer, tx) // already validated
+	if pool.underpriced(from, tx) {
+		pool.drop(tx, TxRejectUnderpriced, ErrReplaceUnderpriced)
+		return ErrReplaceUnderpriced
+	}
 	pool.enqueueTx(hash, tx)
 
 	// Print a log message if low enough level is set
@@ -340,12 +581,91 @@ func (pool *TxPool) add(tx *types.Transaction) error {
 		if to := tx.To(); to != nil {
 			rcpt = common.Bytes2Hex(to[:4])
 		}
-		from, _ := types.Sender(pool.signer, tx) // from already verified during tx validation
 		glog.Infof("(t) 0x%x => %s (%v) %x\n", from[:4], rcpt, tx.Value, hash)
 	}
 	return nil
 }
 
+// drop notifies any subsystems of a transaction rejected or evicted by the pool.
+func (pool *TxPool) drop(tx *types.Transaction, reason TxDropReason, err error) {
+	pool.post(TxStatusEvent{Tx: tx, Status: TxStatusDropped, Reason: reason, Err: err})
+}
+
+// replace notifies any subsystems of a transaction replaced by another one with
+// the same nonce.
+func (pool *TxPool) replace(old, tx *types.Transaction) {
+	pool.post(TxStatusEvent{Tx: old, Status: TxStatusReplaced, Reason: TxDropReplaced, Replacement: tx})
+}
+
+// notify notifies any subsystems of a status change of a pooled transaction
+// other than a drop or replacement.
+func (pool *TxPool) notify(tx *types.Transaction, status TxStatus) {
+	pool.post(TxStatusEvent{Tx: tx, Status: status})
+}
+
+// consumed notifies any subsystems of a transaction removed as its nonce got
+// used, either by its inclusion or by another transaction included instead.
+func (pool *TxPool) consumed(tx *types.Transaction) {
+	if pool.included == nil || pool.included(tx.Hash()) {
+		pool.notify(tx, TxStatusIncluded)
+	} else {
+		pool.drop(tx, TxDropNonceUsed, nil)
+	}
+}
+
+// post queues a status event for the status loop to post, keeping the events
+// in the order the pool generated them.
+func (pool *TxPool) post(ev TxStatusEvent) {
+	pool.statusLock.Lock()
+	pool.statuses = append(pool.statuses, ev)
+	pool.statusLock.Unlock()
+
+	select {
+	case pool.statusReady <- struct{}{}:
+	default:
+	}
+}
+
+// statusLoop posts the queued status events in order, outside of the pool lock
+// as the subscribers may call back into the pool.
+func (pool *TxPool) statusLoop() {
+	defer pool.wg.Done()
+
+	for {
+		select {
+		case <-pool.statusReady:
+			pool.statusLock.Lock()
+			statuses := pool.statuses
+			pool.statuses = nil
+			pool.statusLock.Unlock()
+
+			for _, ev := range statuses {
+				pool.eventMux.Post(ev)
+			}
+
+		case <-pool.quit:
+			return
+		}
+	}
+}
+
+// underpriced checks whether the pool already holds a transaction from the same
+// account with the same nonce that tx's gas price doesn't exceed by the price
+// bump, in which case tx would be discarded instead of replacing it.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) underpriced(from common.Address, tx *types.Transaction) bool {
+	for _, list := range []*txList{pool.pending[from], pool.queue[from]} {
+		if list == nil {
+			continue
+		}
+		if old := list.txs.Get(tx.Nonce()); old != nil && !replaces(tx, old, pool.limits.PriceBump) {
+			return true
+		}
+	}
+	return false
+}
+
 // enqueueTx inserts a new transaction into the non-executable transaction queue.
 //
 // Note, this method assumes the pool lock is held!
@@ -355,17 +675,21 @@ func (pool *TxPool) enqueueTx(hash common.Hash, tx *types.Transaction) {
 	if pool.queue[from] == nil {
 		pool.queue[from] = newTxList(false)
 	}
-	inserted, old := pool.queue[from].Add(tx)
+	inserted, old := pool.queue[from].Add(tx, pool.limits.PriceBump)
 	if !inserted {
 		queuedDiscardCounter.Inc(1)
+		pool.drop(tx, TxRejectUnderpriced, ErrReplaceUnderpriced)
 		return // An older transaction was better, discard this
 	}
 	// Discard any previous transaction and mark this
 	if old != nil {
 		delete(pool.all, old.Hash())
+		delete(pool.queued, old.Hash())
 		queuedReplaceCounter.Inc(1)
+		pool.replace(old, tx)
 	}
 	pool.all[hash] = tx
+	pool.queued[hash] = time.Now()
 }
 
 // promoteTx adds a transaction to the pending (processable) list of transactions.
@@ -382,24 +706,26 @@ func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.T
 	}
 	list := pool.pending[addr]
 
-	inserted, old := list.Add(tx)
+	inserted, old := list.Add(tx, pool.limits.PriceBump)
 	if !inserted {
 		// An older transaction was better, discard this
 		delete(pool.all, hash)
 		pendingDiscardCounter.Inc(1)
+		pool.drop(tx, TxRejectUnderpriced, ErrReplaceUnderpriced)
 		return
 	}
 	// Otherwise discard any previous transaction and mark this
 	if old != nil {
 		delete(pool.all, old.Hash())
 		pendingReplaceCounter.Inc(1)
+		pool.replace(old, tx)
 	}
 	pool.all[hash] = tx // Failsafe to work around direct pending inserts (tests)
 
 	// Set the potentially new pending nonce and notify any subsystems of the new tx
-	pool.beats[addr] = time.Now()
 	pool.pendingState.SetNonce(addr, tx.Nonce()+1)
 	go pool.eventMux.Post(TxPreEvent{tx})
+	pool.notify(tx, TxStatusPromoted)
 }
 
 // Add queues a single transaction in the pool if it is valid.
@@ -442,7 +768,10 @@ func (pool *TxPool) Remove(hash common.Hash) {
 	pool.mu.Lock()
 	defer pool.mu.Unlock()
 
-	pool.removeTx(hash)
+	if tx := pool.all[hash]; tx != nil {
+		pool.removeTx(hash)
+		pool.drop(tx, TxDropRemoved, nil)
+	}
 }
 
 // RemoveBatch removes all given transactions from the pool.
@@ -451,7 +780,10 @@ func (pool *TxPool) RemoveBatch(txs types.Transactions) {
 	defer pool.mu.Unlock()
 
 	for _, tx := range txs {
-		pool.removeTx(tx.Hash())
+		if pool.all[tx.Hash()] != nil {
+			pool.removeTx(tx.Hash())
+			pool.drop(tx, TxDropRemoved, nil)
+		}
 	}
 }
 
@@ -474,12 +806,10 @@ func (pool *TxPool) removeTx(hash common.Hash) {
 			// If no more transactions are left, remove the list
 			if pending.Empty() {
 				delete(pool.pending, addr)
-				delete(pool.beats, addr)
-			} else {
-				// Otherwise postpone any invalidated transactions
-				for _, tx := range invalids {
-					pool.enqueueTx(tx.Hash(), tx)
-				}
+			}
+			// Postpone any invalidated transactions
+			for _, tx := range invalids {
+				pool.enqueueTx(tx.Hash(), tx)
 			}
 			// Update the account nonce if needed
 			if nonce := tx.Nonce(); pool.pendingState.GetNonce(addr) > nonce {
@@ -519,6 +849,7 @@ func (pool *TxPool) promoteExecutables() {
 				glog.Infof("Removed old queued transaction: %v", tx)
 			}
 			delete(pool.all, tx.Hash())
+			pool.consumed(tx)
 		}
 		// Drop all transactions that are too costly (low balance)
 		drops, _ := list.Filter(state.GetBalance(addr))
@@ -528,6 +859,7 @@ func (pool *TxPool) promoteExecutables() {
 			}
 			delete(pool.all, tx.Hash())
 			queuedNofundsCounter.Inc(1)
+			pool.drop(tx, TxDropUnpayable, nil)
 		}
 		// Gather all executable transactions and promote them
 		for _, tx := range list.Ready(pool.pendingState.GetNonce(addr)) {
@@ -537,12 +869,13 @@ func (pool *TxPool) promoteExecutables() {
 			pool.promoteTx(addr, tx.Hash(), tx)
 		}
 		// Drop all transactions over the allowed limit
-		for _, tx := range list.Cap(int(maxQueuedPerAccount)) {
+		for _, tx := range list.Cap(int(pool.limits.AccountQueue)) {
 			if glog.V(logger.Core) {
 				glog.Infof("Removed cap-exceeding queued transaction: %v", tx)
 			}
 			delete(pool.all, tx.Hash())
 			queuedRLCounter.Inc(1)
+			pool.drop(tx, TxDropAccountLimit, nil)
 		}
 		queued += uint64(list.Len())
 
@@ -556,13 +889,13 @@ func (pool *TxPool) promoteExecutables() {
 	for _, list := range pool.pending {
 		pending += uint64(list.Len())
 	}
-	if pending > maxPendingTotal {
+	if pending > pool.limits.GlobalSlots {
 		pendingBeforeCap := pending
 		// Assemble a spam order to penalize large transactors first
 		spammers := prque.New()
 		for addr, list := range pool.pending {
 			// Only evict transactions from high rollers
-			if uint64(list.Len()) > minPendingPerAccount {
+			if uint64(list.Len()) > pool.limits.AccountSlots && pool.evictable(addr) {
 				// Skip local accounts as pools should maintain backlogs for themselves
 				for _, tx := range list.txs.items {
 					if !pool.localTx.contains(tx.Hash()) {
@@ -574,7 +907,7 @@ func (pool *TxPool) promoteExecutables() {
 		}
 		// Gradually drop transactions from offenders
 		offenders := []common.Address{}
-		for pending > maxPendingTotal && !spammers.Empty() {
+		for pending > pool.limits.GlobalSlots && !spammers.Empty() {
 			// Retrieve the next offender if not local address
 			offender, _ := spammers.Pop()
 			offenders = append(offenders, offender.(common.Address))
@@ -585,63 +918,78 @@ func (pool *TxPool) promoteExecutables() {
 				threshold := pool.pending[offender.(common.Address)].Len()
 
 				// Iteratively reduce all offenders until below limit or threshold reached
-				for pending > maxPendingTotal && pool.pending[offenders[len(offenders)-2]].Len() > threshold {
+				for pending > pool.limits.GlobalSlots && pool.pending[offenders[len(offenders)-2]].Len() > threshold {
 					for i := 0; i < len(offenders)-1; i++ {
-						list := pool.pending[offenders[i]]
-						list.Cap(list.Len() - 1)
+						pool.capPending(offenders[i])
 						pending--
 					}
 				}
 			}
 		}
 		// If still above threshold, reduce to limit or min allowance
-		if pending > maxPendingTotal && len(offenders) > 0 {
-			for pending > maxPendingTotal && uint64(pool.pending[offenders[len(offenders)-1]].Len()) > minPendingPerAccount {
+		if pending > pool.limits.GlobalSlots && len(offenders) > 0 {
+			for pending > pool.limits.GlobalSlots && uint64(pool.pending[offenders[len(offenders)-1]].Len()) > pool.limits.AccountSlots {
 				for _, addr := range offenders {
-					list := pool.pending[addr]
-					list.Cap(list.Len() - 1)
+					pool.capPending(addr)
 					pending--
 				}
 			}
 		}
 		pendingRLCounter.Inc(int64(pendingBeforeCap - pending))
 	}
-	// If we've queued more transactions than the hard limit, drop oldest ones
-	if queued > maxQueuedInTotal {
-		// Sort all accounts with queued transactions by heartbeat
-		addresses := make(addresssByHeartbeat, 0, len(pool.queue))
-		for addr, _ := range pool.queue {
-			addresses = append(addresses, addressByHeartbeat{addr, pool.beats[addr]})
+	// If we've queued more transactions than the hard limit, trim the longest
+	// queues first so a single spamming account can't crowd out the others
+	if queued > pool.limits.GlobalQueue {
+		spammers := prque.New()
+		for addr, list := range pool.queue {
+			if pool.evictable(addr) {
+				spammers.Push(addr, float32(list.Len()))
+			}
 		}
-		sort.Sort(addresses)
-
-		// Drop transactions until the total is below the limit
-		for drop := queued - maxQueuedInTotal; drop > 0; {
-			addr := addresses[len(addresses)-1]
-			list := pool.queue[addr.address]
-
-			addresses = addresses[:len(addresses)-1]
+		for drop := queued - pool.limits.GlobalQueue; drop > 0 && !spammers.Empty(); drop-- {
+			offender, _ := spammers.Pop()
+			addr := offender.(common.Address)
 
-			// Drop all transactions if they are less than the overflow
-			if size := uint64(list.Len()); size <= drop {
-				for _, tx := range list.Flatten() {
-					pool.removeTx(tx.Hash())
-				}
-				drop -= size
-				queuedRLCounter.Inc(int64(size))
-				continue
+			list := pool.queue[addr]
+			for _, tx := range list.Cap(list.Len() - 1) {
+				delete(pool.all, tx.Hash())
+				pool.drop(tx, TxDropPoolLimit, nil)
 			}
-			// Otherwise drop only last few transactions
-			txs := list.Flatten()
-			for i := len(txs) - 1; i >= 0 && drop > 0; i-- {
-				pool.removeTx(txs[i].Hash())
-				drop--
-				queuedRLCounter.Inc(1)
+			queuedRLCounter.Inc(1)
+
+			if list.Empty() {
+				delete(pool.queue, addr)
+			} else {
+				spammers.Push(addr, float32(list.Len()))
 			}
 		}
 	}
 }
 
+// evictable reports whether the transactions of an account may be evicted to
+// bring the pool back under its global limits. The privileged accounts sending
+// the signup transactions and the local accounts are exempt, so no amount of
+// spam from other accounts can push their transactions out of the pool.
+func (pool *TxPool) evictable(addr common.Address) bool {
+	if _, local := pool.locals[addr]; local {
+		return false
+	}
+	return !IsPrivilegedAddress(pool.config, addr)
+}
+
+// capPending evicts the highest nonce pending transaction of an account to bring
+// the pool back under its global limits.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) capPending(addr common.Address) {
+	list := pool.pending[addr]
+	for _, tx := range list.Cap(list.Len() - 1) {
+		delete(pool.all, tx.Hash())
+		pool.pendingState.SetNonce(addr, tx.Nonce())
+		pool.drop(tx, TxDropPoolLimit, nil)
+	}
+}
+
 // demoteUnexecutables removes invalid and processed transactions from the pools
 // executable/pending queue and any subsequent transactions that become unexecutable
 // are moved back into the future queue.
@@ -662,6 +1010,7 @@ func (pool *TxPool) demoteUnexecutables() {
 				glog.Infof("Removed old pending transaction: %v", tx)
 			}
 			delete(pool.all, tx.Hash())
+			pool.consumed(tx)
 		}
 		// Drop all transactions that are too costly (low balance), and queue any invalids back for later
 		drops, invalids := list.Filter(state.GetBalance(addr))
@@ -671,24 +1020,25 @@ func (pool *TxPool) demoteUnexecutables() {
 			}
 			delete(pool.all, tx.Hash())
 			pendingNofundsCounter.Inc(1)
+			pool.drop(tx, TxDropUnpayable, nil)
 		}
 		for _, tx := range invalids {
 			if glog.V(logger.Core) {
 				glog.Infof("Demoting pending transaction: %v", tx)
 			}
 			pool.enqueueTx(tx.Hash(), tx)
+			pool.notify(tx, TxStatusInvalidated)
 		}
 		// Delete the entire queue entry if it became empty.
 		if list.Empty() {
 			delete(pool.pending, addr)
-			delete(pool.beats, addr)
 		}
 	}
 }
 
-// expirationLoop is a loop that periodically iterates over all accounts with
-// queued transactions and drop all that have been inactive for a prolonged amount
-// of time.
+// expirationLoop is a loop that periodically iterates over all queued transactions
+// and drops the ones that have been non-executable for a prolonged amount of time,
+// except for the ones of the local accounts.
 func (pool *TxPool) expirationLoop() {
 	defer pool.wg.Done()
 
@@ -699,13 +1049,22 @@ func (pool *TxPool) expirationLoop() {
 		select {
 		case <-evict.C:
 			pool.mu.Lock()
-			for addr := range pool.queue {
-				if time.Since(pool.beats[addr]) > maxQueuedLifetime {
-					for _, tx := range pool.queue[addr].Flatten() {
-						pool.removeTx(tx.Hash())
+			queued := make(map[common.Hash]time.Time)
+			for addr, list := range pool.queue {
+				_, local := pool.locals[addr]
+				for _, tx := range list.Flatten() {
+					hash := tx.Hash()
+					if !local && time.Since(pool.queued[hash]) > pool.limits.Lifetime {
+						pool.removeTx(hash)
+						pool.drop(tx, TxDropExpired, nil)
+						queuedExpiredCounter.Inc(1)
+						continue
 					}
+					queued[hash] = pool.queued[hash]
 				}
 			}
+			// Forget the transactions that left the queue since the last run
+			pool.queued = queued
 			pool.mu.Unlock()
 
 		case <-pool.quit:
@@ -714,17 +1073,43 @@ func (pool *TxPool) expirationLoop() {
 	}
 }
 
-// addressByHeartbeat is an account address tagged with its last activity timestamp.
-type addressByHeartbeat struct {
-	address   common.Address
-	heartbeat time.Time
+// queueAgeBounds are the upper age bounds of the buckets reported by QueueAges,
+// the last bucket counting the transactions queued for longer.
+var queueAgeBounds = []time.Duration{time.Minute, 10 * time.Minute, time.Hour}
+
+// TxAgeStats is the age distribution of the queued transactions.
+type TxAgeStats struct {
+	Bounds []time.Duration // Upper age bounds of the buckets, the last bucket is unbounded
+	Counts []int           // Number of queued transactions in each bucket
+	Oldest time.Duration   // Age of the transaction queued for the longest
 }
 
-type addresssByHeartbeat []addressByHeartbeat
+// QueueAges retrieves the age distribution of the queued transactions, measured
+// from their last entry into the queue.
+func (pool *TxPool) QueueAges() TxAgeStats {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
 
-func (a addresssByHeartbeat) Len() int           { return len(a) }
-func (a addresssByHeartbeat) Less(i, j int) bool { return a[i].heartbeat.Before(a[j].heartbeat) }
-func (a addresssByHeartbeat) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+	stats := TxAgeStats{
+		Bounds: queueAgeBounds,
+		Counts: make([]int, len(queueAgeBounds)+1),
+	}
+	now := time.Now()
+	for _, list := range pool.queue {
+		for _, tx := range list.Flatten() {
+			age := now.Sub(pool.queued[tx.Hash()])
+			bucket := 0
+			for bucket < len(queueAgeBounds) && age >= queueAgeBounds[bucket] {
+				bucket++
+			}
+			stats.Counts[bucket]++
+			if age > stats.Oldest {
+				stats.Oldest = age
+			}
+		}
+	}
+	return stats
+}
 
 // txSet represents a set of transaction hashes in which entries
 //  are automatically dropped after txSetDuration time
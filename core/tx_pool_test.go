@@ -18,8 +18,11 @@ package core
 
 import (
 	"crypto/ecdsa"
+	"io/ioutil"
 	"math/big"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -41,7 +44,7 @@ func setupTxPool() (*TxPool, *ecdsa.PrivateKey) {
 	statedb, _ := state.New(common.Hash{}, db)
 
 	key, _ := crypto.GenerateKey()
-	newPool := NewTxPool(testChainConfig(), new(event.TypeMux), func() (*state.StateDB, error) { return statedb, nil }, func() *big.Int { return big.NewInt(1000000) })
+	newPool := NewTxPool(testChainConfig(), new(event.TypeMux), func() (*state.StateDB, error) { return statedb, nil }, func() *big.Int { return big.NewInt(1000000) }, nil)
 	newPool.resetState()
 
 	return newPool, key
@@ -232,9 +235,9 @@ func TestTransactionDoubleNonce(t *testing.T) {
 	if tx := pool.pending[addr].txs.items[0]; tx.Hash() != tx2.Hash() {
 		t.Errorf("transaction mismatch: have %x, want %x", tx.Hash(), tx2.Hash())
 	}
-	// Add the thid transaction and ensure it's not saved (smaller price)
-	if err := pool.add(tx3); err != nil {
-		t.Error("didn't expect error", err)
+	// Add the thid transaction and ensure it's rejected and not saved (smaller price)
+	if err := pool.add(tx3); err != ErrReplaceUnderpriced {
+		t.Errorf("replacement error mismatch: have %v, want %v", err, ErrReplaceUnderpriced)
 	}
 	pool.promoteExecutables()
 	if pool.pending[addr].Len() != 1 {
@@ -249,6 +252,249 @@ func TestTransactionDoubleNonce(t *testing.T) {
 	}
 }
 
+// Tests that a transaction only replaces a pending or queued one with the same
+// nonce if it bumps the gas price by at least the configured percentage.
+func TestTransactionReplacementPriceBump(t *testing.T) {
+	pool, key := setupTxPool()
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+	currentState, _ := pool.currentState()
+	currentState.AddBalance(addr, big.NewInt(1000000000000000))
+
+	limits := pool.Limits()
+	limits.PriceBump = 10
+	pool.SetLimits(limits)
+
+	priced := func(nonce uint64, price int64) *types.Transaction {
+		tx, _ := types.NewTransaction(nonce, common.Address{}, big.NewInt(100), big.NewInt(100000), big.NewInt(price), nil).SignECDSA(types.HomesteadSigner{}, key)
+		return tx
+	}
+	// Replace a pending (nonce 0) and a queued (nonce 2) transaction
+	for _, nonce := range []uint64{0, 2} {
+		if err := pool.Add(priced(nonce, 100)); err != nil {
+			t.Fatalf("nonce %d: failed to add original: %v", nonce, err)
+		}
+		if err := pool.Add(priced(nonce, 100)); err == nil {
+			t.Errorf("nonce %d: duplicate accepted", nonce)
+		}
+		if err := pool.Add(priced(nonce, 109)); err != ErrReplaceUnderpriced {
+			t.Errorf("nonce %d: underpriced replacement error mismatch: have %v, want %v", nonce, err, ErrReplaceUnderpriced)
+		}
+		replacement := priced(nonce, 110)
+		if err := pool.Add(replacement); err != nil {
+			t.Errorf("nonce %d: failed to replace: %v", nonce, err)
+		}
+		if pool.Get(replacement.Hash()) == nil {
+			t.Errorf("nonce %d: replacement not pooled", nonce)
+		}
+	}
+	if pending, queued := pool.Stats(); pending != 1 || queued != 1 {
+		t.Errorf("pool size mismatch: have %d pending and %d queued, want 1 and 1", pending, queued)
+	}
+}
+
+// Tests that raising the gas price floor drops the remote transactions priced
+// below it, keeping the local ones, and that the floor applies to new arrivals.
+func TestTransactionPoolSetGasPrice(t *testing.T) {
+	pool, _ := setupTxPool()
+	currentState, _ := pool.currentState()
+
+	keys := make([]*ecdsa.PrivateKey, 2)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		currentState.AddBalance(crypto.PubkeyToAddress(keys[i].PublicKey), big.NewInt(1000000000000000))
+	}
+	priced := func(nonce uint64, price int64, key *ecdsa.PrivateKey) *types.Transaction {
+		tx, _ := types.NewTransaction(nonce, common.Address{}, big.NewInt(100), big.NewInt(100000), big.NewInt(price), nil).SignECDSA(types.HomesteadSigner{}, key)
+		return tx
+	}
+	var (
+		local  = crypto.PubkeyToAddress(keys[0].PublicKey)
+		remote = crypto.PubkeyToAddress(keys[1].PublicKey)
+	)
+	if err := pool.AddLocal(priced(0, 1, keys[0])); err != nil {
+		t.Fatalf("failed to add local transaction: %v", err)
+	}
+	for nonce, price := range []int64{1, 2, 1} {
+		if err := pool.Add(priced(uint64(nonce), price, keys[1])); err != nil {
+			t.Fatalf("nonce %d: failed to add remote transaction: %v", nonce, err)
+		}
+	}
+	pool.SetGasPrice(big.NewInt(2))
+
+	if pool.GasPrice().Cmp(big.NewInt(2)) != 0 {
+		t.Errorf("gas price mismatch: have %v, want %v", pool.GasPrice(), 2)
+	}
+	if pool.pending[local].Len() != 1 {
+		t.Errorf("local transaction dropped")
+	}
+	// Dropping the first remote transaction postpones the second one
+	if pool.pending[remote] != nil {
+		t.Errorf("remote pending transactions mismatch: have %d, want 0", pool.pending[remote].Len())
+	}
+	if queued := pool.queue[remote]; queued == nil || queued.Len() != 1 {
+		t.Errorf("remote queued transactions mismatch: have %v, want 1", queued)
+	}
+	if err := pool.Add(priced(0, 1, keys[1])); err != ErrCheap {
+		t.Errorf("cheap transaction error mismatch: have %v, want %v", err, ErrCheap)
+	}
+}
+
+// Tests that rejected and evicted transactions are reported along with the
+// reason of their drop.
+func TestTransactionDropEvents(t *testing.T) {
+	pool, key := setupTxPool()
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+
+	currentState, _ := pool.currentState()
+	currentState.AddBalance(addr, big.NewInt(100000000000000))
+
+	sub := pool.eventMux.Subscribe(TxStatusEvent{})
+	defer sub.Unsubscribe()
+
+	signer := types.HomesteadSigner{}
+	tx1, _ := types.NewTransaction(1, common.Address{}, big.NewInt(100), big.NewInt(100000), big.NewInt(1), nil).SignECDSA(signer, key)
+	tx2, _ := types.NewTransaction(1, common.Address{}, big.NewInt(100), big.NewInt(100000), big.NewInt(2), nil).SignECDSA(signer, key)
+	tx3, _ := types.NewTransaction(1, common.Address{}, big.NewInt(100), big.NewInt(100000), big.NewInt(1), nil).SignECDSA(signer, key)
+	tx4, _ := types.NewTransaction(2, common.Address{}, big.NewInt(100), big.NewInt(100), big.NewInt(1), nil).SignECDSA(signer, key)
+
+	pool.Add(tx1)
+	pool.Add(tx2)
+	pool.Add(tx3)
+	pool.Add(tx4)
+
+	want := map[common.Hash]TxDropReason{
+		tx1.Hash(): TxDropReplaced,
+		tx3.Hash(): TxRejectUnderpriced,
+		tx4.Hash(): TxRejectInvalid,
+	}
+	for len(want) > 0 {
+		select {
+		case ev := <-sub.Chan():
+			drop := ev.Data.(TxStatusEvent)
+			if drop.Status != TxStatusDropped && drop.Status != TxStatusReplaced {
+				continue
+			}
+			reason, ok := want[drop.Tx.Hash()]
+			if !ok {
+				t.Fatalf("unexpected drop of %x: %s", drop.Tx.Hash(), drop.Reason)
+			}
+			if drop.Reason != reason {
+				t.Errorf("%x: drop reason mismatch: have %s, want %s", drop.Tx.Hash(), drop.Reason, reason)
+			}
+			if reason == TxRejectInvalid && drop.Err != ErrIntrinsicGas {
+				t.Errorf("%x: drop error mismatch: have %v, want %v", drop.Tx.Hash(), drop.Err, ErrIntrinsicGas)
+			}
+			delete(want, drop.Tx.Hash())
+		case <-time.After(time.Second):
+			t.Fatalf("missing drop events: %v", want)
+		}
+	}
+}
+
+// Tests that promotions, replacements and drops of pooled transactions are
+// reported as status events.
+func TestTransactionStatusEvents(t *testing.T) {
+	pool, key := setupTxPool()
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+
+	currentState, _ := pool.currentState()
+	currentState.AddBalance(addr, big.NewInt(100000000000000))
+
+	sub := pool.eventMux.Subscribe(TxStatusEvent{})
+	defer sub.Unsubscribe()
+
+	signer := types.HomesteadSigner{}
+	tx1, _ := types.NewTransaction(0, common.Address{}, big.NewInt(100), big.NewInt(100000), big.NewInt(1), nil).SignECDSA(signer, key)
+	tx2, _ := types.NewTransaction(0, common.Address{}, big.NewInt(100), big.NewInt(100000), big.NewInt(2), nil).SignECDSA(signer, key)
+	tx3, _ := types.NewTransaction(1, common.Address{}, big.NewInt(100), big.NewInt(100), big.NewInt(1), nil).SignECDSA(signer, key)
+
+	pool.Add(tx1)
+	pool.Add(tx2)
+	pool.Add(tx3)
+
+	type status struct {
+		hash   common.Hash
+		status TxStatus
+		reason TxDropReason
+	}
+	want := []status{
+		{tx1.Hash(), TxStatusPromoted, ""},
+		{tx1.Hash(), TxStatusReplaced, TxDropReplaced},
+		{tx2.Hash(), TxStatusPromoted, ""},
+		{tx3.Hash(), TxStatusDropped, TxRejectInvalid},
+	}
+	for i, want := range want {
+		select {
+		case ev := <-sub.Chan():
+			event := ev.Data.(TxStatusEvent)
+			if have := (status{event.Tx.Hash(), event.Status, event.Reason}); have != want {
+				t.Fatalf("event %d: mismatch: have %x %s %q, want %x %s %q", i, have.hash, have.status, have.reason, want.hash, want.status, want.reason)
+			}
+			if event.Status == TxStatusReplaced && (event.Replacement == nil || event.Replacement.Hash() != tx2.Hash()) {
+				t.Errorf("%x: replacement mismatch: have %v, want %x", event.Tx.Hash(), event.Replacement, tx2.Hash())
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("missing status event %d: %x %s", i, want.hash, want.status)
+		}
+	}
+}
+
+// Tests that pooled transactions whose nonce gets consumed are only reported
+// as included if they made it into the chain, and as dropped otherwise.
+func TestTransactionNonceUsedEvents(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, db)
+
+	key, _ := crypto.GenerateKey()
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+	statedb.AddBalance(addr, big.NewInt(100000000000000))
+
+	signer := types.HomesteadSigner{}
+	tx1, _ := types.NewTransaction(0, common.Address{}, big.NewInt(100), big.NewInt(100000), big.NewInt(1), nil).SignECDSA(signer, key)
+	tx2, _ := types.NewTransaction(1, common.Address{}, big.NewInt(100), big.NewInt(100000), big.NewInt(1), nil).SignECDSA(signer, key)
+
+	included := func(hash common.Hash) bool { return hash == tx1.Hash() }
+	pool := NewTxPool(testChainConfig(), new(event.TypeMux), func() (*state.StateDB, error) { return statedb, nil }, func() *big.Int { return big.NewInt(1000000) }, included)
+	defer pool.Stop()
+	pool.resetState()
+
+	sub := pool.eventMux.Subscribe(TxStatusEvent{})
+	defer sub.Unsubscribe()
+
+	pool.AddBatch(types.Transactions{tx1, tx2})
+	if pending, _ := pool.Stats(); pending != 2 {
+		t.Fatalf("pending transactions mismatch: have %d, want 2", pending)
+	}
+
+	// Consume both nonces, only the first by the pooled transaction itself
+	statedb.SetNonce(addr, 2)
+	pool.resetState()
+
+	want := map[common.Hash]TxStatusEvent{
+		tx1.Hash(): {Status: TxStatusIncluded},
+		tx2.Hash(): {Status: TxStatusDropped, Reason: TxDropNonceUsed},
+	}
+	for len(want) > 0 {
+		select {
+		case ev := <-sub.Chan():
+			event := ev.Data.(TxStatusEvent)
+			if event.Status == TxStatusPromoted {
+				continue
+			}
+			expect, ok := want[event.Tx.Hash()]
+			if !ok {
+				t.Fatalf("unexpected %s event of %x", event.Status, event.Tx.Hash())
+			}
+			if event.Status != expect.Status || event.Reason != expect.Reason {
+				t.Errorf("%x: status mismatch: have %s %q, want %s %q", event.Tx.Hash(), event.Status, event.Reason, expect.Status, expect.Reason)
+			}
+			delete(want, event.Tx.Hash())
+		case <-time.After(time.Second):
+			t.Fatalf("missing status events: %v", want)
+		}
+	}
+}
+
 func TestMissingNonce(t *testing.T) {
 	pool, key := setupTxPool()
 	addr := crypto.PubkeyToAddress(key.PublicKey)
@@ -476,6 +722,38 @@ func TestTransactionQueueAccountLimiting(t *testing.T) {
 	}
 }
 
+// Tests that lowering the limits of a running pool drops the transactions above
+// the new limits right away.
+func TestTransactionPoolSetLimits(t *testing.T) {
+	pool, key := setupTxPool()
+	account, _ := deriveSender(transaction(0, big.NewInt(0), key))
+
+	state, _ := pool.currentState()
+	state.AddBalance(account, big.NewInt(1000000))
+
+	for i := uint64(1); i <= 10; i++ {
+		if err := pool.Add(transaction(i, big.NewInt(100000), key)); err != nil {
+			t.Fatalf("tx %d: failed to add transaction: %v", i, err)
+		}
+	}
+	if pool.queue[account].Len() != 10 {
+		t.Fatalf("queue size mismatch: have %d, want %d", pool.queue[account].Len(), 10)
+	}
+	limits := pool.Limits()
+	limits.AccountQueue = 4
+	pool.SetLimits(limits)
+
+	if pool.Limits() != limits {
+		t.Errorf("limits mismatch: have %+v, want %+v", pool.Limits(), limits)
+	}
+	if pool.queue[account].Len() != 4 {
+		t.Errorf("queue size mismatch: have %d, want %d", pool.queue[account].Len(), 4)
+	}
+	if len(pool.all) != 4 {
+		t.Errorf("total transaction mismatch: have %d, want %d", len(pool.all), 4)
+	}
+}
+
 // Tests that if the transaction count belonging to multiple accounts go above
 // some threshold, the higher transactions are dropped to prevent DOS attacks.
 func TestTransactionQueueGlobalLimiting(t *testing.T) {
@@ -487,7 +765,7 @@ func TestTransactionQueueGlobalLimiting(t *testing.T) {
 	db, _ := ethdb.NewMemDatabase()
 	statedb, _ := state.New(common.Hash{}, db)
 
-	pool := NewTxPool(testChainConfig(), new(event.TypeMux), func() (*state.StateDB, error) { return statedb, nil }, func() *big.Int { return big.NewInt(1000000) })
+	pool := NewTxPool(testChainConfig(), new(event.TypeMux), func() (*state.StateDB, error) { return statedb, nil }, func() *big.Int { return big.NewInt(1000000) }, nil)
 	pool.resetState()
 
 	// Create a number of test accounts and fund them
@@ -524,6 +802,100 @@ func TestTransactionQueueGlobalLimiting(t *testing.T) {
 	}
 }
 
+// Tests that the global queue limit is enforced by trimming the longest queues
+// first, never evicting the transactions of the privileged signup accounts.
+func TestTransactionQueueFairEviction(t *testing.T) {
+	pool, _ := setupTxPool()
+	state, _ := pool.currentState()
+
+	keys := make([]*ecdsa.PrivateKey, 3)
+	for i := 0; i < len(keys); i++ {
+		keys[i], _ = crypto.GenerateKey()
+		state.AddBalance(crypto.PubkeyToAddress(keys[i].PublicKey), big.NewInt(1000000))
+	}
+	var (
+		signer  = crypto.PubkeyToAddress(keys[0].PublicKey)
+		spammer = crypto.PubkeyToAddress(keys[1].PublicKey)
+		other   = crypto.PubkeyToAddress(keys[2].PublicKey)
+	)
+	defer func(old map[common.Address]ReceiverAddressPair) { PrivilegedAddressesReceivers = old }(PrivilegedAddressesReceivers)
+	PrivilegedAddressesReceivers = map[common.Address]ReceiverAddressPair{signer: {}}
+
+	limits := pool.Limits()
+	limits.GlobalQueue = 8
+	pool.SetLimits(limits)
+
+	// Queue a few transactions from each account, then spam from one of them
+	for i, count := range []int{6, 30, 4} {
+		for nonce := 1; nonce <= count; nonce++ {
+			if err := pool.Add(transaction(uint64(nonce), big.NewInt(100000), keys[i])); err != nil {
+				t.Fatalf("account %d, tx %d: failed to add transaction: %v", i, nonce, err)
+			}
+		}
+	}
+	if have := pool.queue[signer].Len(); have != 6 {
+		t.Errorf("signup account queue mismatch: have %d, want %d", have, 6)
+	}
+	if have := pool.queue[spammer].Len() + pool.queue[other].Len(); have != 2 {
+		t.Errorf("evictable queues mismatch: have %d, want %d", have, 2)
+	}
+	if pool.queue[other] == nil || pool.queue[other].Len() != 1 {
+		t.Errorf("spam crowded out the transactions of other accounts")
+	}
+}
+
+// Tests that the transactions of local accounts, configured or having submitted
+// a transaction locally, skip the gas price floor and are never evicted.
+func TestTransactionLocalAccounts(t *testing.T) {
+	pool, _ := setupTxPool()
+	state, _ := pool.currentState()
+
+	keys := make([]*ecdsa.PrivateKey, 3)
+	for i := 0; i < len(keys); i++ {
+		keys[i], _ = crypto.GenerateKey()
+		state.AddBalance(crypto.PubkeyToAddress(keys[i].PublicKey), big.NewInt(1000000))
+	}
+	var (
+		configured = crypto.PubkeyToAddress(keys[0].PublicKey)
+		submitter  = crypto.PubkeyToAddress(keys[1].PublicKey)
+		remote     = crypto.PubkeyToAddress(keys[2].PublicKey)
+	)
+	pool.SetLocals([]common.Address{configured})
+	pool.minGasPrice = big.NewInt(2)
+
+	// Only the local accounts may pay less than the gas price floor
+	if err := pool.Add(transaction(1, big.NewInt(100000), keys[0])); err != nil {
+		t.Errorf("configured local: failed to add cheap transaction: %v", err)
+	}
+	if err := pool.Add(transaction(1, big.NewInt(100000), keys[1])); err != ErrCheap {
+		t.Errorf("remote: cheap transaction error mismatch: have %v, want %v", err, ErrCheap)
+	}
+	if err := pool.AddLocal(transaction(1, big.NewInt(100000), keys[1])); err != nil {
+		t.Errorf("submitter: failed to add local transaction: %v", err)
+	}
+	if err := pool.Add(transaction(2, big.NewInt(100000), keys[1])); err != nil {
+		t.Errorf("submitter: failed to add cheap transaction: %v", err)
+	}
+	// Overflowing the queue only evicts the transactions of remote accounts
+	pool.minGasPrice = new(big.Int)
+
+	limits := pool.Limits()
+	limits.GlobalQueue = 3
+	pool.SetLimits(limits)
+
+	for nonce := uint64(1); nonce <= 5; nonce++ {
+		if err := pool.Add(transaction(nonce, big.NewInt(100000), keys[2])); err != nil {
+			t.Fatalf("remote, tx %d: failed to add transaction: %v", nonce, err)
+		}
+	}
+	if pool.queue[configured].Len() != 1 || pool.queue[submitter].Len() != 2 {
+		t.Errorf("local queues mismatch: have %d and %d, want 1 and 2", pool.queue[configured].Len(), pool.queue[submitter].Len())
+	}
+	if pool.queue[remote] != nil {
+		t.Errorf("remote queue mismatch: have %d, want none", pool.queue[remote].Len())
+	}
+}
+
 // Tests that if an account remains idle for a prolonged amount of time, any
 // non-executable transactions queued up are dropped to prevent wasting resources
 // on shuffling them around.
@@ -547,11 +919,58 @@ func TestTransactionQueueTimeLimiting(t *testing.T) {
 			t.Fatalf("tx %d: failed to add transaction: %v", i, err)
 		}
 	}
+	// Queue up transactions of a local account too, never to expire
+	local, _ := crypto.GenerateKey()
+	state.AddBalance(crypto.PubkeyToAddress(local.PublicKey), big.NewInt(1000000))
+	if err := pool.AddLocal(transaction(1, big.NewInt(100000), local)); err != nil {
+		t.Fatalf("failed to add local transaction: %v", err)
+	}
 	// Wait until at least two expiration cycles hit and make sure the transactions are gone
 	time.Sleep(2 * evictionInterval)
-	if len(pool.queue) > 0 {
+	if pool.queue[account] != nil {
 		t.Fatalf("old transactions remained after eviction")
 	}
+	if len(pool.queue) != 1 {
+		t.Fatalf("local transactions evicted")
+	}
+}
+
+// Tests that non-executable transactions are dropped once queued for longer than
+// the pool lifetime, even if their account keeps sending executable ones, and
+// that their ages are reported.
+func TestTransactionQueueLifetime(t *testing.T) {
+	defer func(old time.Duration) { evictionInterval = old }(evictionInterval)
+	evictionInterval = 100 * time.Millisecond
+
+	pool, key := setupTxPool()
+	account, _ := deriveSender(transaction(0, big.NewInt(0), key))
+
+	state, _ := pool.currentState()
+	state.AddBalance(account, big.NewInt(1000000))
+
+	limits := pool.Limits()
+	limits.Lifetime = time.Second
+	pool.SetLimits(limits)
+
+	// Queue a transaction behind a nonce gap, then keep the account active
+	if err := pool.Add(transaction(5, big.NewInt(100000), key)); err != nil {
+		t.Fatalf("failed to add queued transaction: %v", err)
+	}
+	if stats := pool.QueueAges(); stats.Counts[0] != 1 {
+		t.Errorf("queue age buckets mismatch: have %v, want 1 in the first", stats.Counts)
+	}
+	for i := uint64(0); i < 3; i++ {
+		if err := pool.Add(transaction(i, big.NewInt(100000), key)); err != nil {
+			t.Fatalf("tx %d: failed to add transaction: %v", i, err)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	if pending, queued := pool.Stats(); pending != 3 || queued != 0 {
+		t.Errorf("pool size mismatch: have %d pending and %d queued, want 3 and 0", pending, queued)
+	}
+	if stats := pool.QueueAges(); stats.Oldest != 0 {
+		t.Errorf("oldest queued age mismatch: have %v, want 0", stats.Oldest)
+	}
 }
 
 // Tests that even if the transaction count belonging to a single account goes
@@ -635,7 +1054,7 @@ func TestTransactionPendingGlobalLimiting(t *testing.T) {
 	db, _ := ethdb.NewMemDatabase()
 	statedb, _ := state.New(common.Hash{}, db)
 
-	pool := NewTxPool(testChainConfig(), new(event.TypeMux), func() (*state.StateDB, error) { return statedb, nil }, func() *big.Int { return big.NewInt(1000000) })
+	pool := NewTxPool(testChainConfig(), new(event.TypeMux), func() (*state.StateDB, error) { return statedb, nil }, func() *big.Int { return big.NewInt(1000000) }, nil)
 	pool.resetState()
 
 	// Create a number of test accounts and fund them
@@ -681,7 +1100,7 @@ func TestTransactionPendingMinimumAllowance(t *testing.T) {
 	db, _ := ethdb.NewMemDatabase()
 	statedb, _ := state.New(common.Hash{}, db)
 
-	pool := NewTxPool(testChainConfig(), new(event.TypeMux), func() (*state.StateDB, error) { return statedb, nil }, func() *big.Int { return big.NewInt(1000000) })
+	pool := NewTxPool(testChainConfig(), new(event.TypeMux), func() (*state.StateDB, error) { return statedb, nil }, func() *big.Int { return big.NewInt(1000000) }, nil)
 	pool.resetState()
 
 	// Create a number of test accounts and fund them
@@ -713,6 +1132,72 @@ func TestTransactionPendingMinimumAllowance(t *testing.T) {
 	}
 }
 
+// Tests that local transactions are journaled and replayed into the pool after a
+// restart, skipping the remote ones and the ones mined in the meantime.
+func TestTransactionJournaling(t *testing.T) {
+	dir, err := ioutil.TempDir("", "txjournal")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	journal := filepath.Join(dir, "transactions.rlp")
+
+	// Create the pool to journal into, with a local and a remote account
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, db)
+
+	newPool := func() *TxPool {
+		pool := NewTxPool(testChainConfig(), new(event.TypeMux), func() (*state.StateDB, error) { return statedb, nil }, func() *big.Int { return big.NewInt(1000000) }, nil)
+		if err := pool.SetJournal(journal, 0); err != nil {
+			t.Fatalf("failed to enable journal: %v", err)
+		}
+		return pool
+	}
+	local, _ := crypto.GenerateKey()
+	remote, _ := crypto.GenerateKey()
+	statedb.AddBalance(crypto.PubkeyToAddress(local.PublicKey), big.NewInt(1000000000))
+	statedb.AddBalance(crypto.PubkeyToAddress(remote.PublicKey), big.NewInt(1000000000))
+
+	pool := newPool()
+	for _, nonce := range []uint64{0, 1, 3} {
+		if err := pool.AddLocal(transaction(nonce, big.NewInt(100000), local)); err != nil {
+			t.Fatalf("failed to add local transaction %d: %v", nonce, err)
+		}
+	}
+	if err := pool.Add(transaction(0, big.NewInt(100000), remote)); err != nil {
+		t.Fatalf("failed to add remote transaction: %v", err)
+	}
+	if pending, queued := pool.Stats(); pending != 3 || queued != 1 {
+		t.Fatalf("pool stats mismatch: have %d pending and %d queued, want 3 and 1", pending, queued)
+	}
+	pool.Stop()
+
+	// Restart with the first local transaction mined, only the remaining local ones must be replayed
+	statedb.SetNonce(crypto.PubkeyToAddress(local.PublicKey), 1)
+
+	pool = newPool()
+	if pending, queued := pool.Stats(); pending != 1 || queued != 1 {
+		t.Fatalf("replayed pool stats mismatch: have %d pending and %d queued, want 1 and 1", pending, queued)
+	}
+	// The sender of the replayed transactions must be a local account again
+	if pool.evictable(crypto.PubkeyToAddress(local.PublicKey)) {
+		t.Errorf("replayed sender not local")
+	}
+	if !pool.evictable(crypto.PubkeyToAddress(remote.PublicKey)) {
+		t.Errorf("remote sender local")
+	}
+	pool.Stop()
+
+	// The journal must have been regenerated without the mined transaction
+	total, _, err := newTxJournal(journal).load(func(*types.Transaction) error { return nil })
+	if err != nil {
+		t.Fatalf("failed to load journal: %v", err)
+	}
+	if total != 2 {
+		t.Fatalf("journaled transactions mismatch: have %d, want 2", total)
+	}
+}
+
 // Benchmarks the speed of validating the contents of the pending queue of the
 // transaction pool.
 func BenchmarkPendingDemotion100(b *testing.B)   { benchmarkPendingDemotion(b, 100) }
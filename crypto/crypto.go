@@ -218,6 +218,20 @@ func Sign(data []byte, prv *ecdsa.PrivateKey) (sig []byte, err error) {
 	return
 }
 
+// SignDeterministic calculates an ECDSA signature like Sign, but without any
+// extra entropy in the nonce: the same hash and key always give the same
+// signature. It is meant for reproducible test fixtures only.
+func SignDeterministic(data []byte, prv *ecdsa.PrivateKey) (sig []byte, err error) {
+	if len(data) != 32 {
+		return nil, fmt.Errorf("hash is required to be exactly 32 bytes (%d)", len(data))
+	}
+
+	seckey := common.LeftPadBytes(prv.D.Bytes(), prv.Params().BitSize/8)
+	defer zeroBytes(seckey)
+	sig, err = secp256k1.SignDeterministic(data, seckey)
+	return
+}
+
 // SignEthereum calculates an Ethereum ECDSA signature.
 // This function is susceptible to choosen plaintext attacks that can leak
 // information about the private key that is used for signing. Callers must
@@ -133,15 +133,25 @@ func GeneratePubKey(seckey []byte) ([]byte, error) {
 }
 
 func Sign(msg []byte, seckey []byte) ([]byte, error) {
+	nonce := randentropy.GetEntropyCSPRNG(32)
+	return sign(msg, seckey, unsafe.Pointer(&nonce[0]))
+}
+
+// SignDeterministic creates a recoverable signature whose nonce is derived from
+// the message and key alone (RFC 6979), so signing the same message with the
+// same key always yields the same signature. Only meant for generating
+// reproducible fixtures, Sign mixes in extra entropy as a safeguard.
+func SignDeterministic(msg []byte, seckey []byte) ([]byte, error) {
+	return sign(msg, seckey, nil)
+}
+
+func sign(msg []byte, seckey []byte, ndata_ptr unsafe.Pointer) ([]byte, error) {
 	msg_ptr := (*C.uchar)(unsafe.Pointer(&msg[0]))
 	seckey_ptr := (*C.uchar)(unsafe.Pointer(&seckey[0]))
 
 	sig := make([]byte, 65)
 	sig_ptr := (*C.secp256k1_ecdsa_recoverable_signature)(unsafe.Pointer(&sig[0]))
 
-	nonce := randentropy.GetEntropyCSPRNG(32)
-	ndata_ptr := unsafe.Pointer(&nonce[0])
-
 	noncefp_ptr := &(*C.secp256k1_nonce_function_default)
 
 	if C.secp256k1_ec_seckey_verify(context, seckey_ptr) != C.int(1) {
@@ -158,6 +168,9 @@ func Sign(msg []byte, seckey []byte) ([]byte, error) {
 	)
 
 	if ret == C.int(0) {
+		if ndata_ptr == nil {
+			return nil, errors.New("Unable to sign deterministically")
+		}
 		return Sign(msg, seckey) //invalid secret, try again
 	}
 
@@ -33,6 +33,30 @@ func TestPrivkeyGenerate(t *testing.T) {
 	}
 }
 
+func TestSignDeterministic(t *testing.T) {
+	pubkey, seckey := GenerateKeyPair()
+	msg := randentropy.GetEntropyCSPRNG(32)
+	sig1, err := SignDeterministic(msg, seckey)
+	if err != nil {
+		t.Fatalf("signature error: %s", err)
+	}
+	sig2, err := SignDeterministic(msg, seckey)
+	if err != nil {
+		t.Fatalf("signature error: %s", err)
+	}
+	if !bytes.Equal(sig1, sig2) {
+		t.Errorf("signatures differ: %x != %x", sig1, sig2)
+	}
+	compactSigCheck(t, sig1)
+	recovered, err := RecoverPubkey(msg, sig1)
+	if err != nil {
+		t.Fatalf("recover error: %s", err)
+	}
+	if !bytes.Equal(pubkey, recovered) {
+		t.Errorf("pubkey mismatch: want: %x have: %x", pubkey, recovered)
+	}
+}
+
 func TestSignatureValidity(t *testing.T) {
 	pubkey, seckey := GenerateKeyPair()
 	msg := randentropy.GetEntropyCSPRNG(32)
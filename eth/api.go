@@ -18,6 +18,7 @@ package eth
 
 import (
 	"bytes"
+	"compress/gzip"
 	"errors"
 	"fmt"
 	"io"
@@ -25,10 +26,12 @@ import (
 	"math/big"
 	"os"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/ur-technology/urhash"
 	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/common/hexutil"
 	"github.com/ur-technology/go-ur/core"
 	"github.com/ur-technology/go-ur/core/state"
 	"github.com/ur-technology/go-ur/core/types"
@@ -71,6 +74,174 @@ func (s *PublicEthereumAPI) Hashrate() *rpc.HexNumber {
 	return rpc.NewHexNumber(s.e.Miner().HashRate())
 }
 
+// maxBlockStatsRange is the maximum number of blocks a single block statistics
+// query may cover.
+const maxBlockStatsRange = 100000
+
+// RPCBlockStats is the gas usage and activity of a canonical block.
+type RPCBlockStats struct {
+	Number   hexutil.Uint64 `json:"number"`
+	GasUsed  hexutil.Uint64 `json:"gasUsed"`
+	GasLimit hexutil.Uint64 `json:"gasLimit"`
+	TxCount  hexutil.Uint64 `json:"txCount"`
+	Signups  hexutil.Uint64 `json:"signups"`
+}
+
+// BlockStats returns the gas used, gas limit, transaction and signup counts of
+// the canonical blocks from fromBlock up to and including toBlock, served from
+// the pre-aggregated statistics index.
+func (s *PublicEthereumAPI) BlockStats(fromBlock, toBlock rpc.BlockNumber) ([]*RPCBlockStats, error) {
+	head := s.e.BlockChain().CurrentBlock().NumberU64()
+	resolve := func(number rpc.BlockNumber) uint64 {
+		if number < 0 {
+			return head
+		}
+		return uint64(number)
+	}
+	first, last := resolve(fromBlock), resolve(toBlock)
+	if last > head {
+		return nil, fmt.Errorf("block #%d not found", last)
+	}
+	if first > last {
+		return nil, fmt.Errorf("invalid block range: #%d > #%d", first, last)
+	}
+	if last-first >= maxBlockStatsRange {
+		return nil, fmt.Errorf("block range too large: %d blocks, limit %d", last-first+1, maxBlockStatsRange)
+	}
+	stats, err := s.e.statsIndexer.Stats(first, last)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*RPCBlockStats, len(stats))
+	for i, block := range stats {
+		results[i] = &RPCBlockStats{
+			Number:   hexutil.Uint64(block.Number),
+			GasUsed:  hexutil.Uint64(block.GasUsed),
+			GasLimit: hexutil.Uint64(block.GasLimit),
+			TxCount:  hexutil.Uint64(block.Txs),
+			Signups:  hexutil.Uint64(block.Signups),
+		}
+	}
+	return results, nil
+}
+
+// maxBalanceProvenanceRange is the maximum number of blocks a single balance
+// provenance query may cover.
+const maxBalanceProvenanceRange = 10000
+
+// RPCBalanceEntry is a credit or debit of an account's balance.
+type RPCBalanceEntry struct {
+	BlockNumber  hexutil.Uint64  `json:"blockNumber"`
+	TxHash       *common.Hash    `json:"transactionHash"`
+	Kind         string          `json:"kind"`
+	Level        *hexutil.Uint64 `json:"level,omitempty"`
+	Amount       *hexutil.Big    `json:"amount"`
+	Counterparty *common.Address `json:"counterparty"`
+}
+
+// RPCBalanceProvenance is the ledger of the balance changes of an account in a
+// range of blocks.
+type RPCBalanceProvenance struct {
+	Address      common.Address     `json:"address"`
+	FromBlock    hexutil.Uint64     `json:"fromBlock"`
+	ToBlock      hexutil.Uint64     `json:"toBlock"`
+	StartBalance *hexutil.Big       `json:"startBalance"` // Balance before fromBlock, nil if unavailable
+	EndBalance   *hexutil.Big       `json:"endBalance"`   // Balance after toBlock, nil if unavailable
+	Unexplained  *hexutil.Big       `json:"unexplained"`  // Balance change not covered by the entries
+	Entries      []*RPCBalanceEntry `json:"entries"`
+}
+
+// GetBalanceProvenance returns the ledger of the credits and debits of address
+// in the canonical blocks from fromBlock up to and including toBlock, each one
+// classified as a transfer, gas, block reward, signup reward of a referral
+// level, management fee or bonus. It is served as ur_getBalanceProvenance too,
+// through the ur alias of the eth namespace.
+//
+// The balances around the range are included when their states are available,
+// along with the part of the balance change the ledger doesn't cover, such as
+// value moved by contract code.
+func (s *PublicEthereumAPI) GetBalanceProvenance(address common.Address, fromBlock, toBlock rpc.BlockNumber) (*RPCBalanceProvenance, error) {
+	bc := s.e.BlockChain()
+	head := bc.CurrentBlock().NumberU64()
+	resolve := func(number rpc.BlockNumber) uint64 {
+		if number < 0 {
+			return head
+		}
+		return uint64(number)
+	}
+	first, last := resolve(fromBlock), resolve(toBlock)
+	if last > head {
+		return nil, fmt.Errorf("block #%d not found", last)
+	}
+	if first > last {
+		return nil, fmt.Errorf("invalid block range: #%d > #%d", first, last)
+	}
+	if last-first >= maxBalanceProvenanceRange {
+		return nil, fmt.Errorf("block range too large: %d blocks, limit %d", last-first+1, maxBalanceProvenanceRange)
+	}
+	entries, err := bc.BalanceProvenance(address, first, last)
+	if err != nil {
+		return nil, err
+	}
+	result := &RPCBalanceProvenance{
+		Address:   address,
+		FromBlock: hexutil.Uint64(first),
+		ToBlock:   hexutil.Uint64(last),
+		Entries:   make([]*RPCBalanceEntry, len(entries)),
+	}
+	total := new(big.Int)
+	for i, entry := range entries {
+		result.Entries[i] = &RPCBalanceEntry{
+			BlockNumber: hexutil.Uint64(entry.Block),
+			Kind:        entry.Kind,
+			Amount:      (*hexutil.Big)(entry.Amount),
+		}
+		if entry.TxHash != (common.Hash{}) {
+			hash := entry.TxHash
+			result.Entries[i].TxHash = &hash
+		}
+		if entry.Kind == core.BalanceSignupReward {
+			level := hexutil.Uint64(entry.Level)
+			result.Entries[i].Level = &level
+		}
+		if entry.Counterparty != (common.Address{}) {
+			counterparty := entry.Counterparty
+			result.Entries[i].Counterparty = &counterparty
+		}
+		total.Add(total, entry.Amount)
+	}
+	start := new(big.Int)
+	if first > 0 {
+		start = s.balanceAt(address, first-1)
+	}
+	end := s.balanceAt(address, last)
+	if start != nil && end != nil {
+		result.StartBalance, result.EndBalance = (*hexutil.Big)(start), (*hexutil.Big)(end)
+		result.Unexplained = (*hexutil.Big)(new(big.Int).Sub(new(big.Int).Sub(end, start), total))
+	}
+	return result, nil
+}
+
+// balanceAt returns the balance of an account after a canonical block, read
+// from the state of the block or rebuilt from the reverse state diffs, nil if
+// neither is available.
+func (s *PublicEthereumAPI) balanceAt(address common.Address, number uint64) *big.Int {
+	bc := s.e.BlockChain()
+	header := bc.GetHeaderByNumber(number)
+	if header == nil {
+		return nil
+	}
+	if statedb, err := bc.StateAt(header.Root); err == nil {
+		return statedb.GetBalance(address)
+	}
+	if historical, err := bc.HistoricalState(header); err == nil {
+		if balance, err := historical.GetBalance(address); err == nil {
+			return balance
+		}
+	}
+	return nil
+}
+
 // PublicMinerAPI provides an API to control the miner.
 // It offers only methods that operate on data that pose no security risk when it is publicly accessible.
 type PublicMinerAPI struct {
@@ -81,6 +252,9 @@ type PublicMinerAPI struct {
 // NewPublicMinerAPI create a new PublicMinerAPI instance.
 func NewPublicMinerAPI(e *Ethereum) *PublicMinerAPI {
 	agent := miner.NewRemoteAgent()
+	if len(e.minerNotify) > 0 {
+		agent.SetNotify(e.minerNotify)
+	}
 	e.Miner().Register(agent)
 
 	return &PublicMinerAPI{e, agent}
@@ -135,13 +309,16 @@ func NewPrivateMinerAPI(e *Ethereum) *PrivateMinerAPI {
 
 // Start the miner with the given number of threads. If threads is nil the number of
 // workers started is equal to the number of logical CPU's that are usable by this process.
+// If the miner is already running, only its number of threads is adjusted.
 func (s *PrivateMinerAPI) Start(threads *rpc.HexNumber) (bool, error) {
 	s.e.StartAutoDAG()
 
 	if threads == nil {
 		threads = rpc.NewHexNumber(runtime.NumCPU())
 	}
-
+	if threads.Int() < 0 {
+		return false, fmt.Errorf("invalid number of mining threads %d", threads.Int())
+	}
 	err := s.e.StartMining(threads.Int())
 	if err == nil {
 		return true, nil
@@ -155,6 +332,32 @@ func (s *PrivateMinerAPI) Stop() bool {
 	return true
 }
 
+// SetThreads sets the number of CPU threads searching for the proof of work,
+// applied right away if mining, or on the next start otherwise.
+func (s *PrivateMinerAPI) SetThreads(threads rpc.HexNumber) (bool, error) {
+	if err := s.e.Miner().SetThreads(threads.Int()); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Pause stops the CPU threads searching for the proof of work, keeping the
+// pending block updated and the work of the external miners served.
+func (s *PrivateMinerAPI) Pause() (bool, error) {
+	if err := s.e.Miner().Pause(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Resume restarts the CPU threads stopped by miner_pause.
+func (s *PrivateMinerAPI) Resume() (bool, error) {
+	if err := s.e.Miner().Resume(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // SetExtra sets the extra data string that is included when this miner mines a block.
 func (s *PrivateMinerAPI) SetExtra(extra string) (bool, error) {
 	if err := s.e.Miner().SetExtra([]byte(extra)); err != nil {
@@ -163,10 +366,23 @@ func (s *PrivateMinerAPI) SetExtra(extra string) (bool, error) {
 	return true, nil
 }
 
-// SetGasPrice sets the minimum accepted gas price for the miner.
-func (s *PrivateMinerAPI) SetGasPrice(gasPrice rpc.HexNumber) bool {
+// SetGasPrice sets the minimum accepted gas price for the miner, raising or
+// lowering the floor of the remote transactions in the pool along with it.
+func (s *PrivateMinerAPI) SetGasPrice(gasPrice rpc.HexNumber) (bool, error) {
+	if gasPrice.BigInt().Sign() < 0 {
+		return false, errors.New("negative gas price")
+	}
 	s.e.Miner().SetGasPrice(gasPrice.BigInt())
-	return true
+	return true, nil
+}
+
+// SetGasLimit sets the gas limit the mined blocks vote toward, becoming both the
+// target and the ceiling of the miner.
+func (s *PrivateMinerAPI) SetGasLimit(gasLimit rpc.HexNumber) (bool, error) {
+	if err := s.e.Miner().SetGasLimits(gasLimit.BigInt(), gasLimit.BigInt()); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 // SetEtherbase sets the etherbase of the miner
@@ -175,6 +391,29 @@ func (s *PrivateMinerAPI) SetEtherbase(etherbase common.Address) bool {
 	return true
 }
 
+// Workers returns the share accounting of the external miners connected to the
+// stratum server.
+func (s *PrivateMinerAPI) Workers() (map[string]*miner.WorkerStats, error) {
+	if s.e.Stratum() == nil {
+		return nil, errors.New("stratum server not enabled")
+	}
+	return s.e.Stratum().Workers(), nil
+}
+
+// Payouts returns the share state of the pool reward splitting.
+func (s *PrivateMinerAPI) Payouts() (*miner.PayoutStats, error) {
+	if s.e.payouter == nil {
+		return nil, errors.New("reward splitting not enabled")
+	}
+	return s.e.payouter.Stats(), nil
+}
+
+// Hashrate returns the hashrate of the miner broken down into the node's own and
+// the one reported by each external miner, via eth_submitHashrate or stratum.
+func (s *PrivateMinerAPI) Hashrate() *miner.HashrateDetail {
+	return s.e.Miner().HashrateDetail()
+}
+
 // StartAutoDAG starts auto DAG generation. This will prevent the DAG generating on epoch change
 // which will cause the node to stop mining during the generation process.
 func (s *PrivateMinerAPI) StartAutoDAG() bool {
@@ -188,14 +427,26 @@ func (s *PrivateMinerAPI) StopAutoDAG() bool {
 	return true
 }
 
-// MakeDAG creates the new DAG for the given block number
+// makeDAG generates the urhash DAG of a block into a directory, replaced by the
+// tests to skip the generation.
+var makeDAG = urhash.MakeDAG
+
+// MakeDAG creates the new DAG for the given block number in the configured DAG
+// directory.
 func (s *PrivateMinerAPI) MakeDAG(blockNr rpc.BlockNumber) (bool, error) {
-	if err := urhash.MakeDAG(uint64(blockNr.Int64()), ""); err != nil {
+	if err := makeDAG(uint64(blockNr.Int64()), s.e.dagDir); err != nil {
 		return false, err
 	}
 	return true, nil
 }
 
+// PendingBlockProfile returns how the next block would be assembled out of the
+// current transaction pool contents: the included transactions in order, the gas
+// they use and the rewards the coinbase would earn, signups included.
+func (s *PrivateMinerAPI) PendingBlockProfile() (*miner.BlockProfile, error) {
+	return s.e.Miner().PendingBlockProfile()
+}
+
 // PrivateAdminAPI is the collection of Etheruem full node-related APIs
 // exposed over the private admin endpoint.
 type PrivateAdminAPI struct {
@@ -217,10 +468,23 @@ func (api *PrivateAdminAPI) ExportChain(file string) (bool, error) {
 	}
 	defer out.Close()
 
+	var (
+		writer io.Writer = out
+		gz     *gzip.Writer
+	)
+	if strings.HasSuffix(file, ".gz") {
+		gz = gzip.NewWriter(out)
+		writer = gz
+	}
 	// Export the blockchain
-	if err := api.eth.BlockChain().Export(out); err != nil {
+	if err := api.eth.BlockChain().Export(writer); err != nil {
 		return false, err
 	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return false, err
+		}
+	}
 	return true, nil
 }
 
@@ -243,8 +507,14 @@ func (api *PrivateAdminAPI) ImportChain(file string) (bool, error) {
 	}
 	defer in.Close()
 
+	var reader io.Reader = in
+	if strings.HasSuffix(file, ".gz") {
+		if reader, err = gzip.NewReader(reader); err != nil {
+			return false, err
+		}
+	}
 	// Run actual the import in pre-configured batches
-	stream := rlp.NewStream(in, 0)
+	stream := rlp.NewStream(reader, 0)
 
 	blocks, index := make([]*types.Block, 0, 2500), 0
 	for batch := 0; ; batch++ {
@@ -304,14 +574,53 @@ func (api *PublicDebugAPI) DumpBlock(number uint64) (state.Dump, error) {
 // PrivateDebugAPI is the collection of Etheruem full node APIs exposed over
 // the private debugging endpoint.
 type PrivateDebugAPI struct {
-	config *params.ChainConfig
-	eth    *Ethereum
+	config   *params.ChainConfig
+	eth      *Ethereum
+	traceCap int // maximum number of struct logs a trace may return, 0 = unlimited
 }
 
 // NewPrivateDebugAPI creates a new API definition for the full node-related
 // private debug methods of the Ethereum service.
-func NewPrivateDebugAPI(config *params.ChainConfig, eth *Ethereum) *PrivateDebugAPI {
-	return &PrivateDebugAPI{config: config, eth: eth}
+func NewPrivateDebugAPI(config *params.ChainConfig, eth *Ethereum, traceCap int) *PrivateDebugAPI {
+	return &PrivateDebugAPI{config: config, eth: eth, traceCap: traceCap}
+}
+
+// BadBlockArgs is a block rejected as invalid during import, as returned by
+// debug_getBadBlocks.
+type BadBlockArgs struct {
+	Hash       common.Hash    `json:"hash"`
+	Number     hexutil.Uint64 `json:"number"`
+	ParentHash common.Hash    `json:"parentHash"`
+	Coinbase   common.Address `json:"coinbase"`
+	Error      string         `json:"error"`
+	Reported   time.Time      `json:"reported"`
+	Receipts   types.Receipts `json:"receipts"` // Receipts of the processed transactions, if any
+	RLP        hexutil.Bytes  `json:"rlp"`      // Block RLP, to be replayed with debug_traceBlock
+}
+
+// GetBadBlocks returns the most recent blocks rejected as invalid during import,
+// oldest first, to diagnose consensus failures.
+func (api *PrivateDebugAPI) GetBadBlocks() ([]*BadBlockArgs, error) {
+	bad := api.eth.BlockChain().BadBlocks()
+
+	results := make([]*BadBlockArgs, len(bad))
+	for i, b := range bad {
+		blob, err := rlp.EncodeToBytes(b.Block)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = &BadBlockArgs{
+			Hash:       b.Block.Hash(),
+			Number:     hexutil.Uint64(b.Block.NumberU64()),
+			ParentHash: b.Block.ParentHash(),
+			Coinbase:   b.Block.Coinbase(),
+			Error:      b.Err.Error(),
+			Reported:   b.Reported,
+			Receipts:   b.Receipts,
+			RLP:        blob,
+		}
+	}
+	return results, nil
 }
 
 // BlockTraceResult is the returned value when replaying a block to check for
@@ -388,8 +697,43 @@ func (api *PrivateDebugAPI) TraceBlockByHash(hash common.Hash, config *vm.LogCon
 	}
 }
 
-// traceBlock processes the given block but does not save the state.
+// cappedLogConfig returns a copy of config whose limit lets the struct logger
+// capture one entry beyond the trace cap, so overflowing traces can be detected.
+func (api *PrivateDebugAPI) cappedLogConfig(config *vm.LogConfig) *vm.LogConfig {
+	if api.traceCap == 0 {
+		return config
+	}
+	capped := new(vm.LogConfig)
+	if config != nil {
+		*capped = *config
+	}
+	if capped.Limit == 0 || capped.Limit > api.traceCap {
+		capped.Limit = api.traceCap + 1
+	}
+	return capped
+}
+
+// checkTraceCap returns an error if the struct logs of a trace exceed the cap.
+func (api *PrivateDebugAPI) checkTraceCap(logs []vm.StructLog) error {
+	if api.traceCap == 0 || len(logs) <= api.traceCap {
+		return nil
+	}
+	return fmt.Errorf("trace exceeds %d struct logs, retry with a limit of at most %d", api.traceCap, api.traceCap)
+}
+
+// traceBlock processes the given block but does not save the state. Traces
+// exceeding the cap are discarded, as the cut short execution would otherwise
+// surface as a misleading validation failure.
 func (api *PrivateDebugAPI) traceBlock(block *types.Block, logConfig *vm.LogConfig) (bool, []vm.StructLog, error) {
+	validated, logs, err := api.execTraceBlock(block, logConfig)
+	if capErr := api.checkTraceCap(logs); capErr != nil {
+		return false, nil, capErr
+	}
+	return validated, logs, err
+}
+
+// execTraceBlock reprocesses the given block with a struct logger attached.
+func (api *PrivateDebugAPI) execTraceBlock(block *types.Block, logConfig *vm.LogConfig) (bool, []vm.StructLog, error) {
 	// Validate and reprocess the block
 	var (
 		blockchain = api.eth.BlockChain()
@@ -397,14 +741,14 @@ func (api *PrivateDebugAPI) traceBlock(block *types.Block, logConfig *vm.LogConf
 		processor  = blockchain.Processor()
 	)
 
-	structLogger := vm.NewStructLogger(logConfig)
+	structLogger := vm.NewStructLogger(api.cappedLogConfig(logConfig))
 
 	config := vm.Config{
 		Debug:  true,
 		Tracer: structLogger,
 	}
 
-	if err := core.ValidateHeader(api.config, blockchain.AuxValidator(), block.Header(), blockchain.GetHeader(block.ParentHash(), block.NumberU64()-1), true, false); err != nil {
+	if err := blockchain.Engine().VerifyHeader(blockchain, block.Header(), blockchain.GetHeader(block.ParentHash(), block.NumberU64()-1), true, false); err != nil {
 		return false, structLogger.StructLogs(), err
 	}
 	statedb, err := blockchain.StateAt(blockchain.GetBlock(block.ParentHash(), block.NumberU64()-1).Root())
@@ -483,9 +827,9 @@ func (api *PrivateDebugAPI) TraceTransaction(ctx context.Context, txHash common.
 		}()
 		defer cancel()
 	} else if config == nil {
-		tracer = vm.NewStructLogger(nil)
+		tracer = vm.NewStructLogger(api.cappedLogConfig(nil))
 	} else {
-		tracer = vm.NewStructLogger(config.LogConfig)
+		tracer = vm.NewStructLogger(api.cappedLogConfig(config.LogConfig))
 	}
 
 	// Retrieve the tx from the chain and the containing block
@@ -534,6 +878,9 @@ func (api *PrivateDebugAPI) TraceTransaction(ctx context.Context, txHash common.
 
 		switch tracer := tracer.(type) {
 		case *vm.StructLogger:
+			if err := api.checkTraceCap(tracer.StructLogs()); err != nil {
+				return nil, err
+			}
 			return &ethapi.ExecutionResult{
 				Gas:         gas,
 				ReturnValue: fmt.Sprintf("%x", ret),
@@ -17,6 +17,7 @@
 package eth
 
 import (
+	"fmt"
 	"math/big"
 
 	"github.com/ur-technology/go-ur/accounts"
@@ -91,6 +92,12 @@ func (b *EthApiBackend) StateAndHeaderByNumber(ctx context.Context, blockNr rpc.
 		return nil, nil, err
 	}
 	stateDb, err := b.eth.BlockChain().StateAt(header.Root)
+	if err != nil && b.eth.BlockChain().ReverseDiffBlocks() > 0 {
+		// The tries of recent states may be gone, rebuild them from the reverse diffs
+		if history, herr := b.eth.BlockChain().HistoricalState(header); herr == nil {
+			return EthApiHistoricalState{history}, header, nil
+		}
+	}
 	return EthApiState{stateDb}, header, err
 }
 
@@ -102,12 +109,24 @@ func (b *EthApiBackend) GetReceipts(ctx context.Context, blockHash common.Hash)
 	return core.GetBlockReceipts(b.eth.chainDb, blockHash, core.GetBlockNumber(b.eth.chainDb, blockHash)), nil
 }
 
+func (b *EthApiBackend) BloomStatus() (uint64, uint64) {
+	return b.eth.bloomIndexer.Status()
+}
+
+func (b *EthApiBackend) GetBloomBits(ctx context.Context, bit uint, section uint64) ([]byte, error) {
+	return b.eth.bloomIndexer.BloomBits(bit, section)
+}
+
 func (b *EthApiBackend) GetTd(blockHash common.Hash) *big.Int {
 	return b.eth.blockchain.GetTdByHash(blockHash)
 }
 
 func (b *EthApiBackend) GetVMEnv(ctx context.Context, msg core.Message, state ethapi.State, header *types.Header) (vm.Environment, func() error, error) {
-	statedb := state.(EthApiState).state
+	apiState, ok := state.(EthApiState)
+	if !ok {
+		return nil, nil, fmt.Errorf("state of block #%d not available for execution", header.Number)
+	}
+	statedb := apiState.state
 	from := statedb.GetOrNewStateObject(msg.From())
 	from.SetBalance(common.MaxBig)
 	vmError := func() error { return nil }
@@ -118,8 +137,7 @@ func (b *EthApiBackend) SendTx(ctx context.Context, signedTx *types.Transaction)
 	b.eth.txMu.Lock()
 	defer b.eth.txMu.Unlock()
 
-	b.eth.txPool.SetLocal(signedTx)
-	return b.eth.txPool.Add(signedTx)
+	return b.eth.txPool.AddLocal(signedTx)
 }
 
 func (b *EthApiBackend) RemoveTx(txHash common.Hash) {
@@ -161,6 +179,13 @@ func (b *EthApiBackend) Stats() (pending int, queued int) {
 	return b.eth.txPool.Stats()
 }
 
+func (b *EthApiBackend) QueueAges() core.TxAgeStats {
+	b.eth.txMu.Lock()
+	defer b.eth.txMu.Unlock()
+
+	return b.eth.txPool.QueueAges()
+}
+
 func (b *EthApiBackend) TxPoolContent() (map[common.Address]types.Transactions, map[common.Address]types.Transactions) {
 	b.eth.txMu.Lock()
 	defer b.eth.txMu.Unlock()
@@ -184,6 +209,10 @@ func (b *EthApiBackend) ChainDb() ethdb.Database {
 	return b.eth.ChainDb()
 }
 
+func (b *EthApiBackend) StateDb() ethdb.Database {
+	return b.eth.BlockChain().StateDatabase()
+}
+
 func (b *EthApiBackend) EventMux() *event.TypeMux {
 	return b.eth.EventMux()
 }
@@ -211,3 +240,24 @@ func (s EthApiState) GetState(ctx context.Context, a common.Address, b common.Ha
 func (s EthApiState) GetNonce(ctx context.Context, addr common.Address) (uint64, error) {
 	return s.state.GetNonce(addr), nil
 }
+
+// EthApiHistoricalState serves the reads of a past state whose tries are gone.
+type EthApiHistoricalState struct {
+	state *core.HistoricalState
+}
+
+func (s EthApiHistoricalState) GetBalance(ctx context.Context, addr common.Address) (*big.Int, error) {
+	return s.state.GetBalance(addr)
+}
+
+func (s EthApiHistoricalState) GetCode(ctx context.Context, addr common.Address) ([]byte, error) {
+	return s.state.GetCode(addr)
+}
+
+func (s EthApiHistoricalState) GetState(ctx context.Context, a common.Address, b common.Hash) (common.Hash, error) {
+	return s.state.GetState(a, b), nil
+}
+
+func (s EthApiHistoricalState) GetNonce(ctx context.Context, addr common.Address) (uint64, error) {
+	return s.state.GetNonce(addr)
+}
@@ -30,6 +30,7 @@ import (
 
 	"github.com/ur-technology/go-ur/accounts"
 	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/consensus"
 	"github.com/ur-technology/go-ur/core"
 	"github.com/ur-technology/go-ur/core/types"
 	"github.com/ur-technology/go-ur/eth/downloader"
@@ -40,10 +41,12 @@ import (
 	"github.com/ur-technology/go-ur/internal/ethapi"
 	"github.com/ur-technology/go-ur/logger"
 	"github.com/ur-technology/go-ur/logger/glog"
+	"github.com/ur-technology/go-ur/metrics"
 	"github.com/ur-technology/go-ur/miner"
 	"github.com/ur-technology/go-ur/node"
 	"github.com/ur-technology/go-ur/p2p"
 	"github.com/ur-technology/go-ur/params"
+	"github.com/ur-technology/go-ur/pow"
 	"github.com/ur-technology/go-ur/rpc"
 	"github.com/ur-technology/urhash"
 )
@@ -75,18 +78,45 @@ type Config struct {
 	SkipBcVersionCheck bool // e.g. blockchain export
 	DatabaseCache      int
 	DatabaseHandles    int
+	AncientDir         string // Directory of the ancient store (empty = within the chain database)
+	AncientThreshold   uint64 // Number of recent blocks kept in LevelDB, older ones are frozen (0 = no freezing)
 
 	NatSpec   bool
 	DocRoot   string
 	AutoDAG   bool
 	PowTest   bool
 	PowShared bool
+	PowFake   bool   // Accept blocks without verifying their proof of work (testing only!)
+	PowCaches int    // Number of urhash verification caches to keep in memory (0 = default)
+	PowDagDir string // Directory of the urhash DAGs, shareable between nodes (empty = urhash default)
 	ExtraData []byte
 
-	Etherbase    common.Address
-	GasPrice     *big.Int
-	MinerThreads int
-	SolcPath     string
+	// InstantSeal seals a block without proof of work as soon as transactions
+	// are pending, and accepts blocks without verifying theirs (developer mode)
+	InstantSeal bool
+
+	Etherbase      common.Address
+	GasPrice       *big.Int
+	MinerGasTarget *big.Int         // Gas limit the mined blocks vote toward (nil = params.TargetGasLimit)
+	MinerGasLimit  *big.Int         // Gas limit the mined blocks never exceed (nil = no ceiling)
+	MinerSignups   bool             // Place the signup transactions of the privileged accounts at the front of the mined blocks
+	MinerRecommit  time.Duration    // Interval of rebuilding the mined block with new transactions (0 = on new heads only)
+	MinerNotify    []string         // URLs new work packages are posted to (empty = none)
+	MinerCoinbases []common.Address // Coinbases the mined blocks rotate through (empty = etherbase)
+	MinerRotation  uint64           // Number of consecutive blocks mined to each rotated coinbase
+	MinerThreads   int
+	SolcPath       string
+
+	Stratum miner.StratumConfig // Work server for external miners (no address = disabled)
+	Payout  miner.PayoutConfig  // Reward splitting across the stratum workers (no account = disabled)
+
+	TxPoolLimits    core.TxPoolLimits // Transaction pool limits (zero = defaults)
+	TxPoolLocals    []common.Address  // Accounts exempt from the gas price floor and eviction of the transaction pool
+	TxPoolJournal   string            // Journal of the local transactions, relative to the data directory (empty = disabled)
+	TxPoolRejournal time.Duration     // Time between regenerations of the local transaction journal
+
+	Checkpoint *downloader.Checkpoint // Weak subjectivity checkpoint synced chains must pass through (nil = none)
+	BlockChain core.BlockChainConfig  // State caching, indexing and proof of work verification settings
 
 	GpoMinGasPrice          *big.Int
 	GpoMaxGasPrice          *big.Int
@@ -94,10 +124,15 @@ type Config struct {
 	GpobaseStepDown         int
 	GpobaseStepUp           int
 	GpobaseCorrectionFactor int
+	GpoBlocks               int // Number of recent blocks sampled for percentile gas price suggestions (0 = base price tracking)
+	GpoPercentile           int // Percentile of the sampled block prices suggested
 
 	EnableJit bool
 	ForceJit  bool
 
+	RPCLogsCap  int // Maximum number of logs returned by a single log query (0 = unlimited)
+	RPCTraceCap int // Maximum number of struct logs returned by a single trace (0 = unlimited)
+
 	TestGenesisBlock *types.Block   // Genesis block to seed the chain database with (testing only!)
 	TestGenesisState ethdb.Database // Genesis state to seed the database with (testing only!)
 }
@@ -121,19 +156,27 @@ type Ethereum struct {
 	protocolManager *ProtocolManager
 	lesServer       LesServer
 	// DB interfaces
-	chainDb ethdb.Database // Block chain database
+	chainDb      ethdb.Database     // Block chain database
+	chainFreezer *core.ChainFreezer // Mover of old blocks into the ancient store (nil = disabled)
+	bloomIndexer *core.BloomIndexer // Builder of the bloom bits index for log filtering
+	statsIndexer *core.StatsIndexer // Aggregator of the block statistics for capacity queries
 
 	eventMux       *event.TypeMux
-	pow            *urhash.Ethash
+	pow            pow.PoW
+	engine         consensus.Engine
 	accountManager *accounts.Manager
 
 	ApiBackend *EthApiBackend
 
 	miner        *miner.Miner
+	stratum      *miner.StratumServer // Work server for external miners (nil = disabled)
+	minerNotify  []string             // URLs new work packages are posted to
+	payouter     *miner.Payouter      // Reward splitter of the mining pool (nil = disabled)
 	Mining       bool
 	MinerThreads int
 	AutoDAG      bool
 	autodagquit  chan bool
+	dagDir       string
 	etherbase    common.Address
 	solcPath     string
 
@@ -141,6 +184,9 @@ type Ethereum struct {
 	PowTest       bool
 	netVersionId  int
 	netRPCService *ethapi.PublicNetAPI
+
+	rpcLogsCap  int
+	rpcTraceCap int
 }
 
 func (s *Ethereum) AddLesServer(ls LesServer) {
@@ -168,6 +214,7 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 		eventMux:       ctx.EventMux,
 		accountManager: ctx.AccountManager,
 		pow:            pow,
+		engine:         core.NewPowEngine(pow),
 		shutdownChan:   make(chan bool),
 		stopDbUpgrade:  stopDbUpgrade,
 		netVersionId:   config.NetworkId,
@@ -176,7 +223,13 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 		etherbase:      config.Etherbase,
 		MinerThreads:   config.MinerThreads,
 		AutoDAG:        config.AutoDAG,
+		dagDir:         config.PowDagDir,
 		solcPath:       config.SolcPath,
+		rpcLogsCap:     config.RPCLogsCap,
+		rpcTraceCap:    config.RPCTraceCap,
+	}
+	if eth.dagDir == "" {
+		eth.dagDir = urhash.DefaultDir
 	}
 
 	if err := upgradeChainDatabase(chainDb); err != nil {
@@ -210,22 +263,61 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 	if config.ChainConfig == nil {
 		return nil, errors.New("missing chain config")
 	}
-	core.WriteChainConfig(chainDb, genesis.Hash(), config.ChainConfig)
+	if err := core.SetupChainConfig(chainDb, genesis.Hash(), config.ChainConfig); err != nil {
+		if _, ok := err.(*params.ConfigCompatError); ok {
+			return nil, fmt.Errorf("incompatible chain configuration: %v. The configuration changes the rules of blocks already processed, restore the previous flags or genesis, or remove the chain database and resync", err)
+		}
+		return nil, err
+	}
 
 	eth.chainConfig = config.ChainConfig
 
 	glog.V(logger.Info).Infoln("Chain config:", eth.chainConfig)
 
-	eth.blockchain, err = core.NewBlockChain(chainDb, eth.chainConfig, eth.pow, eth.EventMux())
+	eth.blockchain, err = core.NewBlockChainWithConfig(chainDb, eth.chainConfig, &config.BlockChain, eth.engine, eth.EventMux())
 	if err != nil {
 		if err == core.ErrNoGenesis {
 			return nil, fmt.Errorf(`No chain found. Please initialise a new chain using the "init" subcommand.`)
 		}
 		return nil, err
 	}
-	newPool := core.NewTxPool(eth.chainConfig, eth.EventMux(), eth.blockchain.State, eth.blockchain.GasLimit)
+	included := func(hash common.Hash) bool {
+		tx, _, _, _ := core.GetTransaction(chainDb, hash)
+		return tx != nil
+	}
+	newPool := core.NewTxPool(eth.chainConfig, eth.EventMux(), eth.blockchain.State, eth.blockchain.GasLimit, included)
+	if config.TxPoolLimits != (core.TxPoolLimits{}) {
+		newPool.SetLimits(config.TxPoolLimits)
+	}
+	newPool.SetLocals(config.TxPoolLocals)
+	if journal := ctx.ResolvePath(config.TxPoolJournal); config.TxPoolJournal != "" && journal != "" {
+		if err := newPool.SetJournal(journal, config.TxPoolRejournal); err != nil {
+			return nil, err
+		}
+	}
 	eth.txPool = newPool
 
+	if db, ok := chainDb.(*ethdb.LDBDatabase); ok && db.Freezer() != nil && config.AncientThreshold > 0 {
+		eth.chainFreezer = core.NewChainFreezer(db, config.AncientThreshold)
+	}
+	eth.bloomIndexer = core.NewBloomIndexer(chainDb)
+	eth.statsIndexer = core.NewStatsIndexer(chainDb)
+
+	metrics.NewFunctionalGauge("txpool/pending", func() int64 {
+		pending, _ := newPool.Stats()
+		return int64(pending)
+	})
+	metrics.NewFunctionalGauge("txpool/queued", func() int64 {
+		_, queued := newPool.Stats()
+		return int64(queued)
+	})
+	metrics.NewFunctionalGauge("txpool/queued/oldest", func() int64 {
+		return int64(newPool.QueueAges().Oldest / time.Second)
+	})
+	metrics.NewFunctionalGauge("chain/head", func() int64 {
+		return int64(eth.blockchain.CurrentBlock().NumberU64())
+	})
+
 	maxPeers := config.MaxPeers
 	if config.LightServ > 0 {
 		// if we are running a light server, limit the number of ETH peers so that we reserve some space for incoming LES connections
@@ -237,12 +329,52 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 		}
 	}
 
-	if eth.protocolManager, err = NewProtocolManager(eth.chainConfig, config.FastSync, config.NetworkId, maxPeers, eth.eventMux, eth.txPool, eth.pow, eth.blockchain, chainDb); err != nil {
+	if eth.protocolManager, err = NewProtocolManager(eth.chainConfig, config.FastSync, config.NetworkId, maxPeers, eth.eventMux, eth.txPool, eth.engine, eth.blockchain, chainDb); err != nil {
 		return nil, err
 	}
+	if cp := config.Checkpoint; cp != nil {
+		if hash := core.GetCanonicalHash(chainDb, cp.Number); hash != (common.Hash{}) && hash != cp.Hash {
+			return nil, fmt.Errorf("local chain conflicts with checkpoint #%d [%x…], resync required", cp.Number, cp.Hash[:4])
+		}
+		eth.protocolManager.downloader.SetCheckpoint(cp)
+	}
 	eth.miner = miner.New(eth, eth.chainConfig, eth.EventMux(), eth.pow)
+	eth.miner.SetInstant(config.InstantSeal)
+	eth.miner.SetSignupPriority(config.MinerSignups)
+	eth.miner.SetRecommitInterval(config.MinerRecommit)
+	eth.minerNotify = config.MinerNotify
+	if err := eth.miner.SetCoinbaseRotation(config.MinerCoinbases, config.MinerRotation); err != nil {
+		return nil, err
+	}
+	if (eth.etherbase == common.Address{}) && len(config.MinerCoinbases) > 0 {
+		eth.etherbase = config.MinerCoinbases[0]
+	}
 	eth.miner.SetGasPrice(config.GasPrice)
-	eth.miner.SetExtra(config.ExtraData)
+	if err := eth.miner.SetExtra(config.ExtraData); err != nil {
+		return nil, err
+	}
+	if err := eth.miner.SetGasLimits(config.MinerGasTarget, config.MinerGasLimit); err != nil {
+		return nil, err
+	}
+	if config.Stratum.Addr != "" || config.Stratum.HTTPAddr != "" {
+		eth.stratum = miner.NewStratumServer(config.Stratum, eth.pow)
+		eth.miner.Register(eth.stratum)
+	}
+	if (config.Payout.Account != common.Address{}) {
+		if eth.stratum == nil {
+			return nil, errors.New("reward splitting requires the stratum server")
+		}
+		etherbase, _ := eth.Etherbase()
+		if err := checkPayoutAccount(config.Payout.Account, etherbase, config.MinerCoinbases); err != nil {
+			return nil, err
+		}
+		payout := config.Payout
+		if payout.State != "" {
+			payout.State = ctx.ResolvePath(payout.State)
+		}
+		eth.payouter = miner.NewPayouter(payout, eth.chainConfig, eth, eth.eventMux, eth.miner.GasPrice)
+		eth.stratum.SetShareCallback(eth.payouter.RecordShare)
+	}
 
 	gpoParams := &gasprice.GpoParams{
 		GpoMinGasPrice:          config.GpoMinGasPrice,
@@ -251,6 +383,8 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 		GpobaseStepDown:         config.GpobaseStepDown,
 		GpobaseStepUp:           config.GpobaseStepUp,
 		GpobaseCorrectionFactor: config.GpobaseCorrectionFactor,
+		GpoBlocks:               config.GpoBlocks,
+		GpoPercentile:           config.GpoPercentile,
 	}
 	gpo := gasprice.NewGasPriceOracle(eth.blockchain, chainDb, eth.eventMux, gpoParams)
 	eth.ApiBackend = &EthApiBackend{eth, gpo}
@@ -261,10 +395,20 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 // CreateDB creates the chain database.
 func CreateDB(ctx *node.ServiceContext, config *Config, name string) (ethdb.Database, error) {
 	db, err := ctx.OpenDatabase(name, config.DatabaseCache, config.DatabaseHandles)
+	if err != nil {
+		return nil, err
+	}
 	if db, ok := db.(*ethdb.LDBDatabase); ok {
 		db.Meter("eth/db/chaindata/")
 	}
-	return db, err
+	// Light clients hold no bodies or receipts, only full nodes have ancients
+	if !config.LightMode {
+		if err := core.OpenAncientStore(db, config.AncientDir); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to open ancient store: %v", err)
+		}
+	}
+	return db, nil
 }
 
 // SetupGenesisBlock initializes the genesis block for an Ethereum service
@@ -291,18 +435,37 @@ func SetupGenesisBlock(chainDb *ethdb.Database, config *Config) error {
 }
 
 // CreatePoW creates the required type of PoW instance for an Ethereum service
-func CreatePoW(config *Config) (*urhash.Ethash, error) {
+func CreatePoW(config *Config) (pow.PoW, error) {
+	if config.InstantSeal {
+		glog.V(logger.Info).Infof("urhash disabled, blocks are sealed instantly")
+		return core.FakePow{}, nil
+	}
+	if config.PowFake {
+		glog.V(logger.Info).Infof("urhash used in fake mode, proof of work is not verified")
+		return core.FakePow{}, nil
+	}
+	var pow *urhash.Ethash
 	switch {
 	case config.PowTest:
 		glog.V(logger.Info).Infof("urhash used in test mode")
-		return urhash.NewForTesting()
+		var err error
+		if pow, err = urhash.NewForTesting(); err != nil {
+			return nil, err
+		}
 	case config.PowShared:
 		glog.V(logger.Info).Infof("urhash used in shared mode")
-		return urhash.NewShared(), nil
+		pow = urhash.NewShared()
 
 	default:
-		return urhash.New(), nil
+		pow = urhash.New()
+	}
+	if config.PowCaches > 0 {
+		pow.Light.NumCaches = config.PowCaches
 	}
+	if config.PowDagDir != "" {
+		pow.Full.Dir = config.PowDagDir
+	}
+	return pow, nil
 }
 
 // APIs returns the collection of RPC services the ethereum package offers.
@@ -332,7 +495,7 @@ func (s *Ethereum) APIs() []rpc.API {
 		}, {
 			Namespace: "eth",
 			Version:   "1.0",
-			Service:   filters.NewPublicFilterAPI(s.ApiBackend, false),
+			Service:   filters.NewPublicFilterAPI(s.ApiBackend, false, s.rpcLogsCap),
 			Public:    true,
 		}, {
 			Namespace: "admin",
@@ -346,7 +509,7 @@ func (s *Ethereum) APIs() []rpc.API {
 		}, {
 			Namespace: "debug",
 			Version:   "1.0",
-			Service:   NewPrivateDebugAPI(s.chainConfig, s),
+			Service:   NewPrivateDebugAPI(s.chainConfig, s, s.rpcTraceCap),
 		}, {
 			Namespace: "net",
 			Version:   "1.0",
@@ -360,6 +523,20 @@ func (s *Ethereum) ResetWithGenesisBlock(gb *types.Block) {
 	s.blockchain.ResetWithGenesisBlock(gb)
 }
 
+// checkPayoutAccount ensures the blocks are mined to the account splitting the
+// rewards, as the pool can only pay out the rewards credited to it.
+func checkPayoutAccount(account, etherbase common.Address, coinbases []common.Address) error {
+	if len(coinbases) == 0 {
+		coinbases = []common.Address{etherbase}
+	}
+	for _, coinbase := range coinbases {
+		if coinbase != account {
+			return fmt.Errorf("reward splitting account %x differs from mining coinbase %x", account, coinbase)
+		}
+	}
+	return nil
+}
+
 func (s *Ethereum) Etherbase() (eb common.Address, err error) {
 	eb = s.etherbase
 	if (eb == common.Address{}) {
@@ -393,17 +570,24 @@ func (s *Ethereum) StopMining()         { s.miner.Stop() }
 func (s *Ethereum) IsMining() bool      { return s.miner.Mining() }
 func (s *Ethereum) Miner() *miner.Miner { return s.miner }
 
+// Stratum returns the work server for external miners, nil if disabled.
+func (s *Ethereum) Stratum() *miner.StratumServer { return s.stratum }
+
 func (s *Ethereum) AccountManager() *accounts.Manager  { return s.accountManager }
 func (s *Ethereum) BlockChain() *core.BlockChain       { return s.blockchain }
 func (s *Ethereum) TxPool() *core.TxPool               { return s.txPool }
 func (s *Ethereum) EventMux() *event.TypeMux           { return s.eventMux }
-func (s *Ethereum) Pow() *urhash.Ethash                { return s.pow }
+func (s *Ethereum) Pow() pow.PoW                       { return s.pow }
+func (s *Ethereum) Engine() consensus.Engine           { return s.engine }
 func (s *Ethereum) ChainDb() ethdb.Database            { return s.chainDb }
 func (s *Ethereum) IsListening() bool                  { return true } // Always listening
 func (s *Ethereum) EthVersion() int                    { return int(s.protocolManager.SubProtocols[0].Version) }
 func (s *Ethereum) NetVersion() int                    { return s.netVersionId }
 func (s *Ethereum) Downloader() *downloader.Downloader { return s.protocolManager.downloader }
 
+// GasPriceOracle returns the oracle suggesting gas prices to RPC clients.
+func (s *Ethereum) GasPriceOracle() *gasprice.GasPriceOracle { return s.ApiBackend.gpo }
+
 // Protocols implements node.Service, returning all the currently configured
 // network protocols to start.
 func (s *Ethereum) Protocols() []p2p.Protocol {
@@ -425,6 +609,21 @@ func (s *Ethereum) Start(srvr *p2p.Server) error {
 	if s.lesServer != nil {
 		s.lesServer.Start(srvr)
 	}
+	if s.chainFreezer != nil {
+		s.chainFreezer.Start()
+	}
+	s.bloomIndexer.Start()
+	s.statsIndexer.Start()
+	if s.stratum != nil {
+		if err := s.stratum.Listen(); err != nil {
+			return fmt.Errorf("stratum server: %v", err)
+		}
+	}
+	if s.payouter != nil {
+		if err := s.payouter.Start(); err != nil {
+			return fmt.Errorf("reward splitting: %v", err)
+		}
+	}
 	return nil
 }
 
@@ -439,12 +638,23 @@ func (s *Ethereum) Stop() error {
 	if s.lesServer != nil {
 		s.lesServer.Stop()
 	}
+	if s.payouter != nil {
+		s.payouter.Stop()
+	}
 	s.txPool.Stop()
+	if s.stratum != nil {
+		s.stratum.Close()
+	}
 	s.miner.Stop()
 	s.eventMux.Stop()
 
 	s.StopAutoDAG()
 
+	if s.chainFreezer != nil {
+		s.chainFreezer.Stop()
+	}
+	s.bloomIndexer.Stop()
+	s.statsIndexer.Stop()
 	s.chainDb.Close()
 	close(s.shutdownChan)
 
@@ -470,29 +680,29 @@ func (self *Ethereum) StartAutoDAG() {
 		return // already started
 	}
 	go func() {
-		glog.V(logger.Info).Infof("Automatic pregeneration of urhash DAG ON (urhash dir: %s)", urhash.DefaultDir)
+		glog.V(logger.Info).Infof("Automatic pregeneration of urhash DAG ON (urhash dir: %s)", self.dagDir)
 		var nextEpoch uint64
 		timer := time.After(0)
 		self.autodagquit = make(chan bool)
 		for {
 			select {
 			case <-timer:
-				glog.V(logger.Info).Infof("checking DAG (urhash dir: %s)", urhash.DefaultDir)
+				glog.V(logger.Info).Infof("checking DAG (urhash dir: %s)", self.dagDir)
 				currentBlock := self.BlockChain().CurrentBlock().NumberU64()
 				thisEpoch := currentBlock / epochLength
 				if nextEpoch <= thisEpoch {
 					if currentBlock%epochLength > autoDAGepochHeight {
 						if thisEpoch > 0 {
 							previousDag, previousDagFull := dagFiles(thisEpoch - 1)
-							os.Remove(filepath.Join(urhash.DefaultDir, previousDag))
-							os.Remove(filepath.Join(urhash.DefaultDir, previousDagFull))
+							os.Remove(filepath.Join(self.dagDir, previousDag))
+							os.Remove(filepath.Join(self.dagDir, previousDagFull))
 							glog.V(logger.Info).Infof("removed DAG for epoch %d (%s)", thisEpoch-1, previousDag)
 						}
 						nextEpoch = thisEpoch + 1
 						dag, _ := dagFiles(nextEpoch)
-						if _, err := os.Stat(dag); os.IsNotExist(err) {
+						if _, err := os.Stat(filepath.Join(self.dagDir, dag)); os.IsNotExist(err) {
 							glog.V(logger.Info).Infof("Pregenerating DAG for epoch %d (%s)", nextEpoch, dag)
-							err := urhash.MakeDAG(nextEpoch*epochLength, "") // "" -> urhash.DefaultDir
+							err := urhash.MakeDAG(nextEpoch*epochLength, self.dagDir)
 							if err != nil {
 								glog.V(logger.Error).Infof("Error generating DAG for epoch %d (%s)", nextEpoch, dag)
 								return
@@ -516,7 +726,7 @@ func (self *Ethereum) StopAutoDAG() {
 		close(self.autodagquit)
 		self.autodagquit = nil
 	}
-	glog.V(logger.Info).Infof("Automatic pregeneration of urhash DAG OFF (urhash dir: %s)", urhash.DefaultDir)
+	glog.V(logger.Info).Infof("Automatic pregeneration of urhash DAG OFF (urhash dir: %s)", self.dagDir)
 }
 
 // dagFiles(epoch) returns the two alternative DAG filenames (not a path)
@@ -26,6 +26,8 @@ import (
 	"github.com/ur-technology/go-ur/core/vm"
 	"github.com/ur-technology/go-ur/ethdb"
 	"github.com/ur-technology/go-ur/params"
+	"github.com/ur-technology/go-ur/rpc"
+	"github.com/ur-technology/urhash"
 )
 
 func TestMipmapUpgrade(t *testing.T) {
@@ -82,3 +84,77 @@ func TestMipmapUpgrade(t *testing.T) {
 		t.Error("setting-mipmap-version not written to database")
 	}
 }
+
+// Tests that the proof-of-work modes and DAG directory are configured as set.
+func TestCreatePoW(t *testing.T) {
+	for _, config := range []*Config{{PowFake: true}, {InstantSeal: true}} {
+		pow, err := CreatePoW(config)
+		if err != nil {
+			t.Fatalf("%+v: failed to create pow: %v", config, err)
+		}
+		if _, ok := pow.(core.FakePow); !ok {
+			t.Errorf("%+v: pow type mismatch: have %T, want core.FakePow", config, pow)
+		}
+	}
+	pow, err := CreatePoW(&Config{PowDagDir: "/dags", PowCaches: 5})
+	if err != nil {
+		t.Fatalf("failed to create pow: %v", err)
+	}
+	ethash, ok := pow.(*urhash.Ethash)
+	if !ok {
+		t.Fatalf("pow type mismatch: have %T, want *urhash.Ethash", pow)
+	}
+	if ethash.Full.Dir != "/dags" {
+		t.Errorf("DAG directory mismatch: have %q, want %q", ethash.Full.Dir, "/dags")
+	}
+	if ethash.Light.NumCaches != 5 {
+		t.Errorf("cache count mismatch: have %d, want %d", ethash.Light.NumCaches, 5)
+	}
+}
+
+// Tests that DAGs generated on request go into the configured DAG directory.
+func TestMakeDAGDirectory(t *testing.T) {
+	defer func(gen func(uint64, string) error) { makeDAG = gen }(makeDAG)
+
+	var (
+		block uint64
+		dir   string
+	)
+	makeDAG = func(blockNum uint64, dagDir string) error {
+		block, dir = blockNum, dagDir
+		return nil
+	}
+	api := NewPrivateMinerAPI(&Ethereum{dagDir: "/dags"})
+	if ok, err := api.MakeDAG(rpc.BlockNumber(30000)); !ok || err != nil {
+		t.Fatalf("failed to make DAG: %v", err)
+	}
+	if block != 30000 || dir != "/dags" {
+		t.Errorf("DAG generation mismatch: have block %d in %q, want 30000 in %q", block, dir, "/dags")
+	}
+}
+
+// Tests that reward splitting is rejected unless every block is mined to the
+// account paying the rewards out.
+func TestCheckPayoutAccount(t *testing.T) {
+	var (
+		pool  = common.Address{0x01}
+		other = common.Address{0x02}
+	)
+	tests := []struct {
+		etherbase common.Address
+		coinbases []common.Address
+		ok        bool
+	}{
+		{pool, nil, true},
+		{other, nil, false},
+		{common.Address{}, nil, false},
+		{other, []common.Address{pool}, true},
+		{pool, []common.Address{pool, other}, false},
+		{pool, []common.Address{other}, false},
+	}
+	for i, tt := range tests {
+		if err := checkPayoutAccount(pool, tt.etherbase, tt.coinbases); (err == nil) != tt.ok {
+			t.Errorf("test %d: error mismatch: have %v, want ok %v", i, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package downloader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/crypto"
+	"github.com/ur-technology/go-ur/logger"
+	"github.com/ur-technology/go-ur/logger/glog"
+)
+
+var (
+	errCheckpointMismatch   = errors.New("chain doesn't pass through the checkpoint")
+	errCheckpointUnreached  = errors.New("peer chain ends before the checkpoint")
+	errIncompleteCheckpoint = errors.New("checkpoint without hash, signup count or total wei")
+)
+
+// Checkpoint is a weak subjectivity checkpoint: a block, along with its signup
+// totals, every synchronised chain must pass through. It protects fresh nodes
+// from long-range fake chains with fabricated reward histories.
+type Checkpoint struct {
+	Number   uint64      `json:"number"`
+	Hash     common.Hash `json:"hash"`
+	NSignups *big.Int    `json:"nSignups"`
+	TotalWei *big.Int    `json:"totalWei"`
+}
+
+// signedCheckpoint is the signed wrapper around a published checkpoint.
+type signedCheckpoint struct {
+	Checkpoint json.RawMessage `json:"checkpoint"`
+	Signature  string          `json:"signature"`
+}
+
+// LoadCheckpoint reads a signed checkpoint from a JSON file, checking that it
+// was signed by the given key.
+func LoadCheckpoint(file string, signer common.Address) (*Checkpoint, error) {
+	blob, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	signed := new(signedCheckpoint)
+	if err := json.Unmarshal(blob, signed); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint: %v", err)
+	}
+	return verifyCheckpoint(signed, signer)
+}
+
+// verifyCheckpoint checks the signature of a checkpoint and decodes it.
+func verifyCheckpoint(signed *signedCheckpoint, signer common.Address) (*Checkpoint, error) {
+	pubkey, err := crypto.SigToPub(crypto.Keccak256(signed.Checkpoint), common.FromHex(signed.Signature))
+	if err != nil {
+		return nil, fmt.Errorf("invalid checkpoint signature: %v", err)
+	}
+	if addr := crypto.PubkeyToAddress(*pubkey); addr != signer {
+		return nil, fmt.Errorf("checkpoint signed by %x, want %x", addr, signer)
+	}
+	checkpoint := new(Checkpoint)
+	if err := json.Unmarshal(signed.Checkpoint, checkpoint); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint: %v", err)
+	}
+	if checkpoint.Hash == (common.Hash{}) || checkpoint.NSignups == nil || checkpoint.TotalWei == nil {
+		return nil, errIncompleteCheckpoint
+	}
+	return checkpoint, nil
+}
+
+// verify checks that the header at the checkpoint height is the pinned one.
+func (c *Checkpoint) verify(header *types.Header) error {
+	if header.Hash() != c.Hash || header.NSignups.Cmp(c.NSignups) != 0 || header.TotalWei.Cmp(c.TotalWei) != 0 {
+		glog.V(logger.Warn).Infof("Checkpoint mismatch: have #%d [%x…] (signups %v, total wei %v), want [%x…] (signups %v, total wei %v)",
+			header.Number, header.Hash().Bytes()[:4], header.NSignups, header.TotalWei, c.Hash.Bytes()[:4], c.NSignups, c.TotalWei)
+		return errCheckpointMismatch
+	}
+	return nil
+}
@@ -104,6 +104,8 @@ type Downloader struct {
 	queue *queue   // Scheduler for selecting the hashes to download
 	peers *peerSet // Set of active peers from which download can proceed
 
+	checkpoint *Checkpoint // Weak subjectivity checkpoint every synced chain must pass through (nil = none)
+
 	fsPivotLock  *types.Header // Pivot header on critical section entry (cannot change between retries)
 	fsPivotFails uint32        // Number of subsequent fast sync failures in the critical section
 
@@ -205,6 +207,12 @@ func New(mode SyncMode, stateDb ethdb.Database, mux *event.TypeMux, hasHeader he
 	return dl
 }
 
+// SetCheckpoint pins the weak subjectivity checkpoint every chain synchronised
+// from then on must pass through, rejecting the peers serving any other chain.
+func (d *Downloader) SetCheckpoint(checkpoint *Checkpoint) {
+	d.checkpoint = checkpoint
+}
+
 // Progress retrieves the synchronisation boundaries, specifically the origin
 // block where synchronisation started at (may have failed/suspended); the block
 // or header sync is currently at; and the latest known block which the sync targets.
@@ -297,7 +305,7 @@ func (d *Downloader) Synchronise(id string, head common.Hash, td *big.Int, mode
 
 	case errTimeout, errBadPeer, errStallingPeer,
 		errEmptyHeaderSet, errPeersUnavailable, errTooOld,
-		errInvalidAncestor, errInvalidChain:
+		errInvalidAncestor, errInvalidChain, errCheckpointMismatch:
 		glog.V(logger.Debug).Infof("Removing peer %v: %v", id, err)
 		d.dropPeer(id)
 
@@ -400,6 +408,10 @@ func (d *Downloader) syncWithPeer(p *peer, hash common.Hash, td *big.Int) (err e
 	}
 	height := latest.Number.Uint64()
 
+	// Don't sync chains too short to be checked against the checkpoint
+	if d.checkpoint != nil && height < d.checkpoint.Number {
+		return errCheckpointUnreached
+	}
 	origin, err := d.findAncestor(p, height)
 	if err != nil {
 		return err
@@ -444,7 +456,7 @@ func (d *Downloader) syncWithPeer(p *peer, hash common.Hash, td *big.Int) (err e
 	if d.syncInitHook != nil {
 		d.syncInitHook(origin, height)
 	}
-	return d.spawnSync(origin+1,
+	return d.spawnSync(p.id, origin+1,
 		func() error { return d.fetchHeaders(p, origin+1) },    // Headers are always retrieved
 		func() error { return d.processHeaders(origin+1, td) }, // Headers are always retrieved
 		func() error { return d.fetchBodies(origin + 1) },      // Bodies are retrieved during normal and fast sync
@@ -454,12 +466,13 @@ func (d *Downloader) syncWithPeer(p *peer, hash common.Hash, td *big.Int) (err e
 }
 
 // spawnSync runs d.process and all given fetcher functions to completion in
-// separate goroutines, returning the first error that appears.
-func (d *Downloader) spawnSync(origin uint64, fetchers ...func() error) error {
+// separate goroutines, returning the first error that appears. The imported
+// blocks are attributed to the peer whose header chain is synced.
+func (d *Downloader) spawnSync(id string, origin uint64, fetchers ...func() error) error {
 	var wg sync.WaitGroup
 	errc := make(chan error, len(fetchers)+1)
 	wg.Add(len(fetchers) + 1)
-	go func() { defer wg.Done(); errc <- d.processContent() }()
+	go func() { defer wg.Done(); errc <- d.processContent(id) }()
 	for _, fn := range fetchers {
 		fn := fn
 		go func() { defer wg.Done(); errc <- fn() }()
@@ -1280,6 +1293,12 @@ func (d *Downloader) processHeaders(origin uint64, td *big.Int) error {
 				}
 				chunk := headers[:limit]
 
+				// Reject the chain if it doesn't pass through the checkpoint
+				if cp := d.checkpoint; cp != nil && chunk[0].Number.Uint64() <= cp.Number && chunk[len(chunk)-1].Number.Uint64() >= cp.Number {
+					if err := cp.verify(chunk[cp.Number-chunk[0].Number.Uint64()]); err != nil {
+						return err
+					}
+				}
 				// In case of header only syncing, validate the chunk immediately
 				if d.mode == FastSync || d.mode == LightSync {
 					// Collect the yet unknown headers to mark them as uncertain
@@ -1348,7 +1367,9 @@ func (d *Downloader) processHeaders(origin uint64, td *big.Int) error {
 
 // processContent takes fetch results from the queue and tries to import them
 // into the chain. The type of import operation will depend on the result contents.
-func (d *Downloader) processContent() error {
+// The blocks are marked as received from the peer with the given id, as the
+// bodies are only accepted if they match its headers.
+func (d *Downloader) processContent(id string) error {
 	pivot := d.queue.FastSyncPivot()
 	for {
 		results := d.queue.WaitResults()
@@ -1377,11 +1398,14 @@ func (d *Downloader) processContent() error {
 			)
 			items := int(math.Min(float64(len(results)), float64(maxResultsProcess)))
 			for _, result := range results[:items] {
+				block := types.NewBlockWithHeader(result.Header).WithBody(result.Transactions, result.Uncles)
+				block.ReceivedFrom = id
+
 				switch {
 				case d.mode == FullSync:
-					blocks = append(blocks, types.NewBlockWithHeader(result.Header).WithBody(result.Transactions, result.Uncles))
+					blocks = append(blocks, block)
 				case d.mode == FastSync:
-					blocks = append(blocks, types.NewBlockWithHeader(result.Header).WithBody(result.Transactions, result.Uncles))
+					blocks = append(blocks, block)
 					if result.Header.Number.Uint64() <= pivot {
 						receipts = append(receipts, result.Receipts)
 					}
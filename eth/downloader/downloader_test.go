@@ -693,6 +693,38 @@ func testCanonicalSynchronisation(t *testing.T, protocol int, mode SyncMode) {
 	assertOwnChain(t, tester, targetBlocks+1)
 }
 
+// Tests that the imported blocks are attributed to the peer they were synced
+// from, so that import failures can be held against it.
+func TestSyncedBlockOrigin(t *testing.T) {
+	t.Parallel()
+
+	tester := newTester()
+	defer tester.terminate()
+
+	targetBlocks := 2 * maxResultsProcess
+	hashes, headers, blocks, receipts := tester.makeChain(targetBlocks, 0, tester.genesis, nil, false)
+	tester.newPeer("peer", 63, hashes, headers, blocks, receipts)
+
+	var (
+		lock    sync.Mutex
+		origins = make(map[interface{}]int)
+	)
+	tester.downloader.insertBlocks = func(blocks types.Blocks) (int, error) {
+		lock.Lock()
+		for _, block := range blocks {
+			origins[block.ReceivedFrom]++
+		}
+		lock.Unlock()
+		return tester.insertBlocks(blocks)
+	}
+	if err := tester.sync("peer", nil, FullSync); err != nil {
+		t.Fatalf("failed to synchronise blocks: %v", err)
+	}
+	if len(origins) != 1 || origins["peer"] != targetBlocks {
+		t.Errorf("block origins mismatch: have %v, want peer: %d", origins, targetBlocks)
+	}
+}
+
 // Tests that if a large batch of blocks are being downloaded, it is throttled
 // until the cached blocks are retrieved.
 func TestThrottling62(t *testing.T)     { testThrottling(t, 62, FullSync) }
@@ -1795,3 +1827,85 @@ func testFastCriticalRestarts(t *testing.T, protocol int, progress bool) {
 	// completed using a single mode of operation, whereas fast-then-slow can result
 	// in arbitrary intermediate state that's not cleanly verifiable.
 }
+
+// Tests that only chains passing through the weak subjectivity checkpoint are
+// synchronised, and that chains ending before it aren't synced at all.
+func TestCheckpointSync63Full(t *testing.T)  { testCheckpointSync(t, 63, FullSync) }
+func TestCheckpointSync63Fast(t *testing.T)  { testCheckpointSync(t, 63, FastSync) }
+func TestCheckpointSync64Full(t *testing.T)  { testCheckpointSync(t, 64, FullSync) }
+func TestCheckpointSync64Fast(t *testing.T)  { testCheckpointSync(t, 64, FastSync) }
+func TestCheckpointSync64Light(t *testing.T) { testCheckpointSync(t, 64, LightSync) }
+
+func testCheckpointSync(t *testing.T, protocol int, mode SyncMode) {
+	t.Parallel()
+
+	targetBlocks := blockCacheLimit - 15
+	number := uint64(targetBlocks / 2)
+
+	tests := []struct {
+		checkpoint func(pinned *types.Header) *Checkpoint
+		err        error
+	}{
+		// A chain ending before the checkpoint is refused
+		{func(pinned *types.Header) *Checkpoint {
+			return &Checkpoint{Number: uint64(targetBlocks) + 1, Hash: pinned.Hash(), NSignups: pinned.NSignups, TotalWei: pinned.TotalWei}
+		}, errCheckpointUnreached},
+		// A chain not passing through the checkpoint is refused
+		{func(pinned *types.Header) *Checkpoint {
+			return &Checkpoint{Number: number, Hash: common.Hash{0x01}, NSignups: pinned.NSignups, TotalWei: pinned.TotalWei}
+		}, errCheckpointMismatch},
+		{func(pinned *types.Header) *Checkpoint {
+			return &Checkpoint{Number: number, Hash: pinned.Hash(), NSignups: pinned.NSignups, TotalWei: new(big.Int).Add(pinned.TotalWei, common.Big1)}
+		}, errCheckpointMismatch},
+		// A chain passing through the checkpoint is synchronised
+		{func(pinned *types.Header) *Checkpoint {
+			return &Checkpoint{Number: number, Hash: pinned.Hash(), NSignups: pinned.NSignups, TotalWei: pinned.TotalWei}
+		}, nil},
+	}
+	for i, tt := range tests {
+		tester := newTester()
+
+		hashes, headers, blocks, receipts := tester.makeChain(targetBlocks, 0, tester.genesis, nil, false)
+		pinned := headers[hashes[len(hashes)-1-int(number)]]
+
+		tester.downloader.SetCheckpoint(tt.checkpoint(pinned))
+		tester.newPeer("peer", protocol, hashes, headers, blocks, receipts)
+
+		if err := tester.sync("peer", nil, mode); err != tt.err {
+			t.Errorf("test %d: sync error mismatch: have %v, want %v", i, err, tt.err)
+		}
+		if tt.err == nil {
+			assertOwnChain(t, tester, targetBlocks+1)
+		} else if tester.hasHeader(pinned.Hash()) {
+			t.Errorf("test %d: header at checkpoint imported from refused chain", i)
+		}
+		tester.terminate()
+	}
+}
+
+// Tests that checkpoints are only accepted if signed by the configured key.
+func TestCheckpointSignature(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	other, _ := crypto.GenerateKey()
+
+	blob := []byte(`{"number": 100, "hash": "0x0100000000000000000000000000000000000000000000000000000000000000", "nSignups": 5, "totalWei": 1000000000000000000000}`)
+	sig, _ := crypto.Sign(crypto.Keccak256(blob), key)
+	signed := &signedCheckpoint{Checkpoint: blob, Signature: common.ToHex(sig)}
+
+	checkpoint, err := verifyCheckpoint(signed, crypto.PubkeyToAddress(key.PublicKey))
+	if err != nil {
+		t.Fatalf("failed to verify checkpoint: %v", err)
+	}
+	want, _ := new(big.Int).SetString("1000000000000000000000", 10)
+	if checkpoint.Number != 100 || checkpoint.Hash != (common.Hash{0x01}) || checkpoint.NSignups.Int64() != 5 || checkpoint.TotalWei.Cmp(want) != 0 {
+		t.Errorf("checkpoint mismatch: have %+v", checkpoint)
+	}
+	if _, err := verifyCheckpoint(signed, crypto.PubkeyToAddress(other.PublicKey)); err == nil {
+		t.Errorf("accepted checkpoint signed by another key")
+	}
+	blob = []byte(`{"number": 100, "hash": "0x0100000000000000000000000000000000000000000000000000000000000000"}`)
+	sig, _ = crypto.Sign(crypto.Keccak256(blob), key)
+	if _, err := verifyCheckpoint(&signedCheckpoint{Checkpoint: blob, Signature: common.ToHex(sig)}, crypto.PubkeyToAddress(key.PublicKey)); err != errIncompleteCheckpoint {
+		t.Errorf("incomplete checkpoint error mismatch: have %v, want %v", err, errIncompleteCheckpoint)
+	}
+}
@@ -28,9 +28,14 @@ import (
 
 	"github.com/ur-technology/go-ur/common"
 	"github.com/ur-technology/go-ur/common/hexutil"
+	"github.com/ur-technology/go-ur/core"
+	"github.com/ur-technology/go-ur/core/state"
 	"github.com/ur-technology/go-ur/core/types"
 	"github.com/ur-technology/go-ur/ethdb"
 	"github.com/ur-technology/go-ur/event"
+	"github.com/ur-technology/go-ur/internal/ethapi"
+	"github.com/ur-technology/go-ur/logger"
+	"github.com/ur-technology/go-ur/logger/glog"
 	"github.com/ur-technology/go-ur/rpc"
 )
 
@@ -38,6 +43,10 @@ var (
 	deadline = 5 * time.Minute // consider a filter inactive if it has not been polled for within deadline
 )
 
+// maxStorageSlots is the maximum number of storage slots a single storage
+// subscription may watch.
+const maxStorageSlots = 256
+
 // filter is a helper struct that holds meta information over the filter type
 // and associated subscription in the event system.
 type filter struct {
@@ -54,21 +63,28 @@ type filter struct {
 type PublicFilterAPI struct {
 	backend   Backend
 	useMipMap bool
+	lightMode bool
+	maxLogs   int
 	mux       *event.TypeMux
 	quit      chan struct{}
 	chainDb   ethdb.Database
+	stateDb   ethdb.Database
 	events    *EventSystem
 	filtersMu sync.Mutex
 	filters   map[rpc.ID]*filter
 }
 
-// NewPublicFilterAPI returns a new PublicFilterAPI instance.
-func NewPublicFilterAPI(backend Backend, lightMode bool) *PublicFilterAPI {
+// NewPublicFilterAPI returns a new PublicFilterAPI instance. Log queries returning
+// more than maxLogs results are rejected, 0 disables the cap.
+func NewPublicFilterAPI(backend Backend, lightMode bool, maxLogs int) *PublicFilterAPI {
 	api := &PublicFilterAPI{
 		backend:   backend,
 		useMipMap: !lightMode,
+		lightMode: lightMode,
+		maxLogs:   maxLogs,
 		mux:       backend.EventMux(),
 		chainDb:   backend.ChainDb(),
+		stateDb:   backend.StateDb(),
 		events:    NewEventSystem(backend.EventMux(), backend, lightMode),
 		filters:   make(map[rpc.ID]*filter),
 	}
@@ -138,7 +154,8 @@ func (api *PublicFilterAPI) NewPendingTransactionFilter() rpc.ID {
 
 // NewPendingTransactions creates a subscription that is triggered each time a transaction
 // enters the transaction pool and was signed from one of the transactions this nodes manages.
-func (api *PublicFilterAPI) NewPendingTransactions(ctx context.Context) (*rpc.Subscription, error) {
+// If fullTx is true the complete transaction objects are delivered instead of only their hashes.
+func (api *PublicFilterAPI) NewPendingTransactions(ctx context.Context, fullTx *bool) (*rpc.Subscription, error) {
 	notifier, supported := rpc.NotifierFromContext(ctx)
 	if !supported {
 		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
@@ -147,13 +164,23 @@ func (api *PublicFilterAPI) NewPendingTransactions(ctx context.Context) (*rpc.Su
 	rpcSub := notifier.CreateSubscription()
 
 	go func() {
-		txHashes := make(chan common.Hash)
-		pendingTxSub := api.events.SubscribePendingTxEvents(txHashes)
+		var (
+			txHashes     = make(chan common.Hash)
+			txs          = make(chan *types.Transaction)
+			pendingTxSub *Subscription
+		)
+		if fullTx != nil && *fullTx {
+			pendingTxSub = api.events.SubscribeFullPendingTxEvents(txs)
+		} else {
+			pendingTxSub = api.events.SubscribePendingTxEvents(txHashes)
+		}
 
 		for {
 			select {
 			case h := <-txHashes:
 				notifier.Notify(rpcSub.ID, h)
+			case tx := <-txs:
+				notifier.Notify(rpcSub.ID, ethapi.NewRPCPendingTransaction(tx))
 			case <-rpcSub.Err():
 				pendingTxSub.Unsubscribe()
 				return
@@ -167,6 +194,158 @@ func (api *PublicFilterAPI) NewPendingTransactions(ctx context.Context) (*rpc.Su
 	return rpcSub, nil
 }
 
+// DroppedTransaction is a transaction rejected or evicted by the transaction pool,
+// along with the reason code of the drop.
+type DroppedTransaction struct {
+	Transaction *ethapi.RPCTransaction `json:"transaction"`
+	Reason      core.TxDropReason      `json:"reason"`
+	Error       string                 `json:"error,omitempty"`
+}
+
+// droppedTxCriteria restricts the transaction pool events to the drops and
+// replacements reported by the dropped transactions subscription.
+var droppedTxCriteria = &TxPoolEventsCriteria{
+	Statuses: []core.TxStatus{core.TxStatusDropped, core.TxStatusReplaced},
+}
+
+// DroppedTransactions creates a subscription that is triggered each time the transaction pool rejects a
+// transaction or evicts it without it being included in a block, so submitters don't have to wait for
+// their transactions to time out.
+func (api *PublicFilterAPI) DroppedTransactions(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		statuses := make(chan core.TxStatusEvent)
+		statusesSub := api.events.SubscribeTxStatusEvents(statuses)
+
+		for {
+			select {
+			case status := <-statuses:
+				dropped := &DroppedTransaction{
+					Transaction: ethapi.NewRPCPendingTransaction(status.Tx),
+					Reason:      status.Reason,
+				}
+				if !droppedTxCriteria.matches(dropped.Transaction.From, status.Status) {
+					continue
+				}
+				if status.Err != nil {
+					dropped.Error = status.Err.Error()
+				}
+				notifier.Notify(rpcSub.ID, dropped)
+			case <-rpcSub.Err():
+				statusesSub.Unsubscribe()
+				return
+			case <-notifier.Closed():
+				statusesSub.Unsubscribe()
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
+// TxPoolEvent is a status change of a transaction in the transaction pool. The
+// reason code is set for drops and replacements, the replacement hash for the
+// latter only.
+type TxPoolEvent struct {
+	Transaction *ethapi.RPCTransaction `json:"transaction"`
+	Status      core.TxStatus          `json:"status"`
+	Reason      core.TxDropReason      `json:"reason,omitempty"`
+	Error       string                 `json:"error,omitempty"`
+	Replacement *common.Hash           `json:"replacement,omitempty"`
+}
+
+// TxPoolEventsCriteria restricts a transaction pool events subscription to the
+// transactions sent from the given accounts and to the given statuses. Empty
+// lists match any sender or status.
+type TxPoolEventsCriteria struct {
+	From     []common.Address `json:"from"`
+	Statuses []core.TxStatus  `json:"statuses"`
+}
+
+// matches reports whether an event of the given sender and status passes the
+// criteria, nil criteria passing all.
+func (crit *TxPoolEventsCriteria) matches(from common.Address, status core.TxStatus) bool {
+	if crit == nil {
+		return true
+	}
+	if len(crit.From) > 0 {
+		found := false
+		for _, addr := range crit.From {
+			if addr == from {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(crit.Statuses) > 0 {
+		for _, s := range crit.Statuses {
+			if s == status {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// TxPoolEvents creates a subscription that is triggered each time the transaction pool promotes,
+// invalidates, replaces or drops a transaction, or removes it after its inclusion in a block. The
+// optional criteria limit the events to the transactions of a set of senders and to some statuses,
+// e.g. to get notified of the drops of the transactions of the accounts a service manages.
+func (api *PublicFilterAPI) TxPoolEvents(ctx context.Context, crit *TxPoolEventsCriteria) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		statuses := make(chan core.TxStatusEvent)
+		statusesSub := api.events.SubscribeTxStatusEvents(statuses)
+
+		for {
+			select {
+			case status := <-statuses:
+				event := &TxPoolEvent{
+					Transaction: ethapi.NewRPCPendingTransaction(status.Tx),
+					Status:      status.Status,
+					Reason:      status.Reason,
+				}
+				if !crit.matches(event.Transaction.From, event.Status) {
+					continue
+				}
+				if status.Err != nil {
+					event.Error = status.Err.Error()
+				}
+				if status.Replacement != nil {
+					hash := status.Replacement.Hash()
+					event.Replacement = &hash
+				}
+				notifier.Notify(rpcSub.ID, event)
+			case <-rpcSub.Err():
+				statusesSub.Unsubscribe()
+				return
+			case <-notifier.Closed():
+				statusesSub.Unsubscribe()
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
 // NewBlockFilter creates a filter that fetches blocks that are imported into the chain.
 // It is part of the filter package since polling goes with eth_getFilterChanges.
 //
@@ -270,6 +449,107 @@ func (api *PublicFilterAPI) Logs(ctx context.Context, crit FilterCriteria) (*rpc
 	return rpcSub, nil
 }
 
+// StorageCriteria selects the contract storage slots a storage subscription
+// watches.
+type StorageCriteria struct {
+	Address common.Address `json:"address"`
+	Slots   []common.Hash  `json:"slots"`
+}
+
+// StorageChange is the notification sent when a watched storage slot changes.
+type StorageChange struct {
+	BlockNumber *hexutil.Big   `json:"blockNumber"`
+	BlockHash   common.Hash    `json:"blockHash"`
+	Address     common.Address `json:"address"`
+	Slot        common.Hash    `json:"slot"`
+	Previous    common.Hash    `json:"previous"`
+	Value       common.Hash    `json:"value"`
+}
+
+// StorageChanges creates a subscription that fires each time one of the watched
+// storage slots of a contract is changed by a new block, so clients can follow
+// contract state without polling eth_getStorageAt.
+func (api *PublicFilterAPI) StorageChanges(ctx context.Context, crit StorageCriteria) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	if api.lightMode {
+		return nil, errors.New("storage subscriptions are not supported by light clients")
+	}
+	if len(crit.Slots) == 0 {
+		return nil, errors.New("no storage slots specified")
+	}
+	if len(crit.Slots) > maxStorageSlots {
+		return nil, fmt.Errorf("too many storage slots: have %d, max %d", len(crit.Slots), maxStorageSlots)
+	}
+
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		headers := make(chan *types.Header)
+		headersSub := api.events.SubscribeNewHeads(headers)
+
+		for {
+			select {
+			case h := <-headers:
+				changes, err := api.storageChanges(h, crit)
+				if err != nil {
+					glog.V(logger.Debug).Infof("Failed to diff storage of block #%d [%x…]: %v", h.Number, h.Hash().Bytes()[:4], err)
+					continue
+				}
+				for _, change := range changes {
+					notifier.Notify(rpcSub.ID, change)
+				}
+			case <-rpcSub.Err():
+				headersSub.Unsubscribe()
+				return
+			case <-notifier.Closed():
+				headersSub.Unsubscribe()
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
+// storageChanges returns the watched storage slots whose values differ between
+// the state of the given block and that of its parent.
+func (api *PublicFilterAPI) storageChanges(header *types.Header, crit StorageCriteria) ([]*StorageChange, error) {
+	if header.Number.Sign() == 0 {
+		return nil, nil
+	}
+	parent := core.GetHeader(api.chainDb, header.ParentHash, header.Number.Uint64()-1)
+	if parent == nil {
+		return nil, fmt.Errorf("unknown parent %x", header.ParentHash)
+	}
+	before, err := state.New(parent.Root, api.stateDb)
+	if err != nil {
+		return nil, err
+	}
+	after, err := state.New(header.Root, api.stateDb)
+	if err != nil {
+		return nil, err
+	}
+	var changes []*StorageChange
+	for _, slot := range crit.Slots {
+		previous, value := before.GetState(crit.Address, slot), after.GetState(crit.Address, slot)
+		if previous == value {
+			continue
+		}
+		changes = append(changes, &StorageChange{
+			BlockNumber: (*hexutil.Big)(header.Number),
+			BlockHash:   header.Hash(),
+			Address:     crit.Address,
+			Slot:        slot,
+			Previous:    previous,
+			Value:       value,
+		})
+	}
+	return changes, nil
+}
+
 // FilterCriteria represents a request to create a new filter.
 type FilterCriteria struct {
 	FromBlock *big.Int
@@ -341,7 +621,26 @@ func (api *PublicFilterAPI) GetLogs(ctx context.Context, crit FilterCriteria) ([
 	filter.SetTopics(crit.Topics)
 
 	logs, err := filter.Find(ctx)
-	return returnLogs(logs), err
+	if err != nil {
+		return nil, err
+	}
+	if err := api.checkLogsCap(logs); err != nil {
+		return nil, err
+	}
+	return returnLogs(logs), nil
+}
+
+// checkLogsCap returns an error if logs exceed the maximum result size, hinting
+// at the block range that can be queried within the limit.
+func (api *PublicFilterAPI) checkLogsCap(logs []Log) error {
+	if api.maxLogs == 0 || len(logs) <= api.maxLogs {
+		return nil
+	}
+	first, overflow := logs[0].BlockNumber, logs[api.maxLogs].BlockNumber
+	if overflow == first {
+		return fmt.Errorf("query returned more than %d logs within block %d, narrow the addresses or topics", api.maxLogs, first)
+	}
+	return fmt.Errorf("query returned more than %d logs, retry with the block range [%#x, %#x]", api.maxLogs, first, overflow-1)
 }
 
 // UninstallFilter removes the filter with the given filter id.
@@ -388,10 +687,13 @@ func (api *PublicFilterAPI) GetFilterLogs(ctx context.Context, id rpc.ID) ([]Log
 	filter.SetAddresses(f.crit.Addresses)
 	filter.SetTopics(f.crit.Topics)
 
-	logs, err:= filter.Find(ctx)
+	logs, err := filter.Find(ctx)
 	if err != nil {
 		return nil, err
 	}
+	if err := api.checkLogsCap(logs); err != nil {
+		return nil, err
+	}
 	return returnLogs(logs), nil
 }
 
@@ -22,6 +22,7 @@ import (
 	"testing"
 
 	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core"
 	"github.com/ur-technology/go-ur/rpc"
 )
 
@@ -195,3 +196,49 @@ func TestUnmarshalJSONNewFilterArgs(t *testing.T) {
 		)
 	}
 }
+
+// Tests that the transaction pool events criteria decode from JSON and restrict
+// the events to the given senders and statuses.
+func TestTxPoolEventsCriteria(t *testing.T) {
+	var (
+		sender = common.HexToAddress("0x70c87d191324e6712a591f304b4eedef6ad9bb9d")
+		other  = common.HexToAddress("0x9b2055d370f73ec7d8a03e965129118dc8f5bf83")
+	)
+	var crit *TxPoolEventsCriteria
+	if !crit.matches(other, core.TxStatusPromoted) {
+		t.Errorf("nil criteria should match any event")
+	}
+	vector := fmt.Sprintf(`{"from": ["%s"], "statuses": ["dropped", "replaced"]}`, sender.Hex())
+	if err := json.Unmarshal([]byte(vector), &crit); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		from   common.Address
+		status core.TxStatus
+		want   bool
+	}{
+		{sender, core.TxStatusDropped, true},
+		{sender, core.TxStatusReplaced, true},
+		{sender, core.TxStatusPromoted, false},
+		{other, core.TxStatusDropped, false},
+	}
+	for i, tt := range tests {
+		if have := crit.matches(tt.from, tt.status); have != tt.want {
+			t.Errorf("test %d: match mismatch for %x %s: have %v, want %v", i, tt.from, tt.status, have, tt.want)
+		}
+	}
+	// Senders only, any status
+	crit = &TxPoolEventsCriteria{From: []common.Address{sender}}
+	if !crit.matches(sender, core.TxStatusIncluded) || crit.matches(other, core.TxStatusIncluded) {
+		t.Errorf("sender only criteria mismatch")
+	}
+	// Dropped transactions subscription, drops and replacements of any sender
+	for _, status := range []core.TxStatus{core.TxStatusPromoted, core.TxStatusInvalidated, core.TxStatusIncluded} {
+		if droppedTxCriteria.matches(sender, status) {
+			t.Errorf("dropped transactions criteria matches %s", status)
+		}
+	}
+	if !droppedTxCriteria.matches(sender, core.TxStatusDropped) || !droppedTxCriteria.matches(other, core.TxStatusReplaced) {
+		t.Errorf("dropped transactions criteria mismatch")
+	}
+}
@@ -24,6 +24,7 @@ import (
 
 	"github.com/ur-technology/go-ur/common"
 	"github.com/ur-technology/go-ur/core"
+	"github.com/ur-technology/go-ur/core/bloombits"
 	"github.com/ur-technology/go-ur/core/types"
 	"github.com/ur-technology/go-ur/ethdb"
 	"github.com/ur-technology/go-ur/event"
@@ -33,9 +34,17 @@ import (
 
 type Backend interface {
 	ChainDb() ethdb.Database
+	StateDb() ethdb.Database // Database of the recent states, may be a cache in front of ChainDb
 	EventMux() *event.TypeMux
 	HeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*types.Header, error)
 	GetReceipts(ctx context.Context, blockHash common.Hash) (types.Receipts, error)
+
+	// BloomStatus returns the section size and the number of sections of the
+	// bloom bits index, the sections covering the chain from the genesis block.
+	BloomStatus() (uint64, uint64)
+
+	// GetBloomBits returns the bit vector of a bloom bit over an indexed section.
+	GetBloomBits(ctx context.Context, bit uint, section uint64) ([]byte, error)
 }
 
 // Filter can be used to retrieve and filter logs
@@ -100,7 +109,33 @@ func (f *Filter) Find(ctx context.Context) ([]Log, error) {
 	if f.end == -1 {
 		endBlockNo = headBlockNumber
 	}
+	if beginBlockNo > endBlockNo {
+		return nil, nil
+	}
+	// Search the range covered by the bloom bits index section by section, and
+	// fall back to the per block search for the rest
+	var logs []Log
+	if size, sections := f.backend.BloomStatus(); size > 0 && beginBlockNo < sections*size {
+		indexedEnd := endBlockNo
+		if indexedEnd >= sections*size {
+			indexedEnd = sections*size - 1
+		}
+		found, err := f.indexedLogs(ctx, beginBlockNo, indexedEnd, size)
+		if err != nil {
+			return found, err
+		}
+		if indexedEnd == endBlockNo {
+			return found, nil
+		}
+		logs, beginBlockNo = found, indexedEnd+1
+	}
+	rest, err := f.unindexedLogs(ctx, beginBlockNo, endBlockNo)
+	return append(logs, rest...), err
+}
 
+// unindexedLogs returns the logs matching the filter criteria within a range of
+// blocks not covered by the bloom bits index.
+func (f *Filter) unindexedLogs(ctx context.Context, beginBlockNo, endBlockNo uint64) ([]Log, error) {
 	// if no addresses are present we can't make use of fast search which
 	// uses the mipmap bloom filters to check for fast inclusion and uses
 	// higher range probability in order to ensure at least a false positive
@@ -110,6 +145,56 @@ func (f *Filter) Find(ctx context.Context) ([]Log, error) {
 	return f.mipFind(beginBlockNo, endBlockNo, 0), nil
 }
 
+// indexedLogs returns the logs matching the filter criteria within a range of
+// blocks covered by the bloom bits index, only retrieving the logs of the blocks
+// whose blooms match according to the index.
+func (f *Filter) indexedLogs(ctx context.Context, start, end, size uint64) (logs []Log, err error) {
+	groups := make([][][]byte, 0, len(f.topics)+1)
+	addresses := make([][]byte, len(f.addresses))
+	for i, addr := range f.addresses {
+		addresses[i] = addr.Bytes()
+	}
+	groups = append(groups, addresses)
+	for _, sub := range f.topics {
+		topics := make([][]byte, 0, len(sub))
+		for _, topic := range sub {
+			// A zero hash matches any topic in its position
+			if (topic == common.Hash{}) {
+				topics = nil
+				break
+			}
+			topics = append(topics, topic.Bytes())
+		}
+		groups = append(groups, topics)
+	}
+	matcher := bloombits.NewMatcher(groups)
+	if matcher.Empty() {
+		return f.getLogs(ctx, start, end)
+	}
+	for section := start / size; section <= end/size; section++ {
+		matches, err := matcher.Match(int(size/8), func(bit uint) ([]byte, error) {
+			return f.backend.GetBloomBits(ctx, bit, section)
+		})
+		if err != nil {
+			return logs, err
+		}
+		for i, b := range matches {
+			for j := uint64(0); b != 0 && j < 8; j++ {
+				num := section*size + uint64(i)*8 + j
+				if b&(0x80>>j) == 0 || num < start || num > end {
+					continue
+				}
+				found, err := f.getLogs(ctx, num, num)
+				if err != nil {
+					return logs, err
+				}
+				logs = append(logs, found...)
+			}
+		}
+	}
+	return logs, nil
+}
+
 func (f *Filter) mipFind(start, end uint64, depth int) (logs []Log) {
 	level := core.MIPMapLevels[depth]
 	// normalise numerator so we can work in level specific batches and
@@ -52,6 +52,9 @@ const (
 	PendingTransactionsSubscription
 	// BlocksSubscription queries hashes for blocks that are imported
 	BlocksSubscription
+	// TxPoolEventsSubscription queries status changes of the transactions in
+	// the transaction pool
+	TxPoolEventsSubscription
 	// LastSubscription keeps track of the last index
 	LastIndexSubscription
 )
@@ -97,7 +100,9 @@ type subscription struct {
 	logsCrit  FilterCriteria
 	logs      chan []Log
 	hashes    chan common.Hash
+	txs       chan *types.Transaction
 	headers   chan *types.Header
+	statuses  chan core.TxStatusEvent
 	installed chan struct{} // closed when the filter is installed
 	err       chan error    // closed when the filter is uninstalled
 }
@@ -161,7 +166,9 @@ func (sub *Subscription) Unsubscribe() {
 				break uninstallLoop
 			case <-sub.f.logs:
 			case <-sub.f.hashes:
+			case <-sub.f.txs:
 			case <-sub.f.headers:
+			case <-sub.f.statuses:
 			}
 		}
 
@@ -306,6 +313,42 @@ func (es *EventSystem) SubscribePendingTxEvents(hashes chan common.Hash) *Subscr
 	return es.subscribe(sub)
 }
 
+// SubscribeFullPendingTxEvents creates a subscription that writes the complete
+// transactions that enter the transaction pool.
+func (es *EventSystem) SubscribeFullPendingTxEvents(txs chan *types.Transaction) *Subscription {
+	sub := &subscription{
+		id:        rpc.NewID(),
+		typ:       PendingTransactionsSubscription,
+		created:   time.Now(),
+		logs:      make(chan []Log),
+		hashes:    make(chan common.Hash),
+		txs:       txs,
+		headers:   make(chan *types.Header),
+		installed: make(chan struct{}),
+		err:       make(chan error),
+	}
+
+	return es.subscribe(sub)
+}
+
+// SubscribeTxStatusEvents creates a subscription that writes the promotions,
+// invalidations, inclusions, replacements and drops of the pooled transactions.
+func (es *EventSystem) SubscribeTxStatusEvents(statuses chan core.TxStatusEvent) *Subscription {
+	sub := &subscription{
+		id:        rpc.NewID(),
+		typ:       TxPoolEventsSubscription,
+		created:   time.Now(),
+		logs:      make(chan []Log),
+		hashes:    make(chan common.Hash),
+		headers:   make(chan *types.Header),
+		statuses:  statuses,
+		installed: make(chan struct{}),
+		err:       make(chan error),
+	}
+
+	return es.subscribe(sub)
+}
+
 type filterIndex map[Type]map[rpc.ID]*subscription
 
 // broadcast event to filters that match criteria.
@@ -344,7 +387,17 @@ func (es *EventSystem) broadcast(filters filterIndex, ev *event.Event) {
 	case core.TxPreEvent:
 		for _, f := range filters[PendingTransactionsSubscription] {
 			if ev.Time.After(f.created) {
-				f.hashes <- e.Tx.Hash()
+				if f.txs != nil {
+					f.txs <- e.Tx
+				} else {
+					f.hashes <- e.Tx.Hash()
+				}
+			}
+		}
+	case core.TxStatusEvent:
+		for _, f := range filters[TxPoolEventsSubscription] {
+			if ev.Time.After(f.created) {
+				f.statuses <- e
 			}
 		}
 	case core.ChainEvent:
@@ -430,7 +483,7 @@ func (es *EventSystem) lightFilterLogs(header *types.Header, addresses []common.
 func (es *EventSystem) eventLoop() {
 	var (
 		index = make(filterIndex)
-		sub   = es.mux.Subscribe(core.PendingLogsEvent{}, core.RemovedLogsEvent{}, vm.Logs{}, core.TxPreEvent{}, core.ChainEvent{})
+		sub   = es.mux.Subscribe(core.PendingLogsEvent{}, core.RemovedLogsEvent{}, vm.Logs{}, core.TxPreEvent{}, core.TxStatusEvent{}, core.ChainEvent{})
 	)
 
 	for i := UnknownSubscription; i < LastIndexSubscription; i++ {
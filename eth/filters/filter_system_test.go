@@ -19,13 +19,17 @@ package filters
 import (
 	"math/big"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"golang.org/x/net/context"
 
 	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/common/hexutil"
 	"github.com/ur-technology/go-ur/core"
+	"github.com/ur-technology/go-ur/core/bloombits"
+	"github.com/ur-technology/go-ur/core/state"
 	"github.com/ur-technology/go-ur/core/types"
 	"github.com/ur-technology/go-ur/core/vm"
 	"github.com/ur-technology/go-ur/ethdb"
@@ -43,6 +47,10 @@ func (b *testBackend) ChainDb() ethdb.Database {
 	return b.db
 }
 
+func (b *testBackend) StateDb() ethdb.Database {
+	return b.db
+}
+
 func (b *testBackend) EventMux() *event.TypeMux {
 	return b.mux
 }
@@ -65,6 +73,18 @@ func (b *testBackend) GetReceipts(ctx context.Context, blockHash common.Hash) (t
 	return core.GetBlockReceipts(b.db, blockHash, num), nil
 }
 
+// testBloomSectionSize is the section size of the bloom bits index the tests
+// store directly into the database of the test backend.
+const testBloomSectionSize = 16
+
+func (b *testBackend) BloomStatus() (uint64, uint64) {
+	return testBloomSectionSize, core.GetBloomBitsSections(b.db)
+}
+
+func (b *testBackend) GetBloomBits(ctx context.Context, bit uint, section uint64) ([]byte, error) {
+	return bloombits.DecompressVector(core.GetBloomBits(b.db, bit, section), testBloomSectionSize/8)
+}
+
 // TestBlockSubscription tests if a block subscription returns block hashes for posted chain events.
 // It creates multiple subscriptions:
 // - one at the start and should receive all posted chain events and a second (blockHashes)
@@ -77,7 +97,7 @@ func TestBlockSubscription(t *testing.T) {
 		mux     = new(event.TypeMux)
 		db, _   = ethdb.NewMemDatabase()
 		backend = &testBackend{mux, db}
-		api     = NewPublicFilterAPI(backend, false)
+		api     = NewPublicFilterAPI(backend, false, 0)
 
 		genesis     = core.WriteGenesisBlockForTesting(db)
 		chain, _    = core.GenerateChain(params.TestChainConfig, nil, genesis, db, 10, func(i int, gen *core.BlockGen) {})
@@ -131,7 +151,7 @@ func TestPendingTxFilter(t *testing.T) {
 		mux     = new(event.TypeMux)
 		db, _   = ethdb.NewMemDatabase()
 		backend = &testBackend{mux, db}
-		api     = NewPublicFilterAPI(backend, false)
+		api     = NewPublicFilterAPI(backend, false, 0)
 
 		transactions = []*types.Transaction{
 			types.NewTransaction(0, common.HexToAddress("0xb794f5ea0ba39494ce83a213fffba74279579268"), new(big.Int), new(big.Int), new(big.Int), nil),
@@ -174,6 +194,91 @@ func TestPendingTxFilter(t *testing.T) {
 	}
 }
 
+// TestFullPendingTxSubscription tests whether complete transactions are
+// delivered to subscribers that requested them.
+func TestFullPendingTxSubscription(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mux     = new(event.TypeMux)
+		db, _   = ethdb.NewMemDatabase()
+		backend = &testBackend{mux, db}
+		api     = NewPublicFilterAPI(backend, false, 0)
+
+		transactions = []*types.Transaction{
+			types.NewTransaction(0, common.HexToAddress("0xb794f5ea0ba39494ce83a213fffba74279579268"), new(big.Int), new(big.Int), new(big.Int), nil),
+			types.NewTransaction(1, common.HexToAddress("0xb794f5ea0ba39494ce83a213fffba74279579268"), new(big.Int), new(big.Int), new(big.Int), nil),
+		}
+	)
+
+	txs := make(chan *types.Transaction)
+	sub := api.events.SubscribeFullPendingTxEvents(txs)
+	defer sub.Unsubscribe()
+
+	time.Sleep(1 * time.Second)
+	go func() {
+		for _, tx := range transactions {
+			mux.Post(core.TxPreEvent{Tx: tx})
+		}
+	}()
+
+	for i := range transactions {
+		select {
+		case tx := <-txs:
+			if tx.Hash() != transactions[i].Hash() {
+				t.Errorf("tx %d: hash mismatch, want %x, got %x", i, transactions[i].Hash(), tx.Hash())
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("tx %d: timeout waiting for pending transaction", i)
+		}
+	}
+}
+
+// TestTxStatusSubscription tests whether the status changes of pooled
+// transactions are delivered to subscribers in the order they were posted.
+func TestTxStatusSubscription(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mux     = new(event.TypeMux)
+		db, _   = ethdb.NewMemDatabase()
+		backend = &testBackend{mux, db}
+		api     = NewPublicFilterAPI(backend, false, 0)
+
+		tx0 = types.NewTransaction(0, common.HexToAddress("0xb794f5ea0ba39494ce83a213fffba74279579268"), new(big.Int), new(big.Int), new(big.Int), nil)
+		tx1 = types.NewTransaction(1, common.HexToAddress("0xb794f5ea0ba39494ce83a213fffba74279579268"), new(big.Int), new(big.Int), new(big.Int), nil)
+
+		statuses = []core.TxStatusEvent{
+			{Tx: tx0, Status: core.TxStatusPromoted},
+			{Tx: tx0, Status: core.TxStatusDropped, Reason: core.TxDropNonceUsed},
+			{Tx: tx1, Status: core.TxStatusDropped, Reason: core.TxRejectInvalid, Err: core.ErrNonce},
+			{Tx: tx1, Status: core.TxStatusPromoted},
+		}
+	)
+
+	ch := make(chan core.TxStatusEvent)
+	sub := api.events.SubscribeTxStatusEvents(ch)
+	defer sub.Unsubscribe()
+
+	time.Sleep(1 * time.Second)
+	go func() {
+		for _, status := range statuses {
+			mux.Post(status)
+		}
+	}()
+
+	for i := range statuses {
+		select {
+		case status := <-ch:
+			if status.Tx.Hash() != statuses[i].Tx.Hash() || status.Status != statuses[i].Status || status.Reason != statuses[i].Reason {
+				t.Errorf("status %d: mismatch, want %x %s (%s), got %x %s (%s)", i, statuses[i].Tx.Hash(), statuses[i].Status, statuses[i].Reason, status.Tx.Hash(), status.Status, status.Reason)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("status %d: timeout waiting for transaction status", i)
+		}
+	}
+}
+
 // TestLogFilterCreation test whether a given filter criteria makes sense.
 // If not it must return an error.
 func TestLogFilterCreation(t *testing.T) {
@@ -181,7 +286,7 @@ func TestLogFilterCreation(t *testing.T) {
 		mux     = new(event.TypeMux)
 		db, _   = ethdb.NewMemDatabase()
 		backend = &testBackend{mux, db}
-		api     = NewPublicFilterAPI(backend, false)
+		api     = NewPublicFilterAPI(backend, false, 0)
 
 		testCases = []struct {
 			crit    FilterCriteria
@@ -226,7 +331,7 @@ func TestInvalidLogFilterCreation(t *testing.T) {
 		mux     = new(event.TypeMux)
 		db, _   = ethdb.NewMemDatabase()
 		backend = &testBackend{mux, db}
-		api     = NewPublicFilterAPI(backend, false)
+		api     = NewPublicFilterAPI(backend, false, 0)
 	)
 
 	// different situations where log filter creation should fail.
@@ -252,7 +357,7 @@ func TestLogFilter(t *testing.T) {
 		mux     = new(event.TypeMux)
 		db, _   = ethdb.NewMemDatabase()
 		backend = &testBackend{mux, db}
-		api     = NewPublicFilterAPI(backend, false)
+		api     = NewPublicFilterAPI(backend, false, 0)
 
 		firstAddr      = common.HexToAddress("0x1111111111111111111111111111111111111111")
 		secondAddr     = common.HexToAddress("0x2222222222222222222222222222222222222222")
@@ -360,7 +465,7 @@ func TestPendingLogsSubscription(t *testing.T) {
 		mux     = new(event.TypeMux)
 		db, _   = ethdb.NewMemDatabase()
 		backend = &testBackend{mux, db}
-		api     = NewPublicFilterAPI(backend, false)
+		api     = NewPublicFilterAPI(backend, false, 0)
 
 		firstAddr      = common.HexToAddress("0x1111111111111111111111111111111111111111")
 		secondAddr     = common.HexToAddress("0x2222222222222222222222222222222222222222")
@@ -464,3 +569,71 @@ func TestPendingLogsSubscription(t *testing.T) {
 		}
 	}
 }
+
+// TestLogsCap tests that log results exceeding the cap are rejected with a hint
+// at a block range that fits within it.
+func TestLogsCap(t *testing.T) {
+	api := &PublicFilterAPI{maxLogs: 2}
+
+	makeLogs := func(blocks ...uint64) []Log {
+		logs := make([]Log, len(blocks))
+		for i, number := range blocks {
+			logs[i] = Log{Log: &vm.Log{BlockNumber: number}}
+		}
+		return logs
+	}
+	if err := api.checkLogsCap(makeLogs(1, 2)); err != nil {
+		t.Errorf("unexpected error for logs within cap: %v", err)
+	}
+	if err := api.checkLogsCap(makeLogs(1, 2, 3)); err == nil || !strings.Contains(err.Error(), "[0x1, 0x2]") {
+		t.Errorf("expected block range hint, got %v", err)
+	}
+	if err := api.checkLogsCap(makeLogs(5, 5, 5)); err == nil || !strings.Contains(err.Error(), "within block 5") {
+		t.Errorf("expected single block hint, got %v", err)
+	}
+}
+
+// TestStorageChanges tests that only the watched storage slots changed by a
+// block are reported, along with their previous values.
+func TestStorageChanges(t *testing.T) {
+	var (
+		db, _    = ethdb.NewMemDatabase()
+		api      = &PublicFilterAPI{chainDb: db, stateDb: db}
+		contract = common.HexToAddress("0x1000000000000000000000000000000000000001")
+		slots    = []common.Hash{common.HexToHash("0x01"), common.HexToHash("0x02"), common.HexToHash("0x03")}
+	)
+	// Commit a parent state and a child state modifying some of the slots
+	statedb, _ := state.New(common.Hash{}, db)
+	statedb.SetNonce(contract, 1)
+	statedb.SetState(contract, slots[0], common.HexToHash("0xaa"))
+	statedb.SetState(contract, slots[1], common.HexToHash("0xbb"))
+	parentRoot, _ := statedb.Commit(false)
+
+	statedb, _ = state.New(parentRoot, db)
+	statedb.SetState(contract, slots[0], common.HexToHash("0xcc"))
+	statedb.SetState(contract, slots[2], common.HexToHash("0xdd"))
+	childRoot, _ := statedb.Commit(false)
+
+	parent := &types.Header{Number: big.NewInt(1), Root: parentRoot}
+	if err := core.WriteHeader(db, parent); err != nil {
+		t.Fatal(err)
+	}
+	child := &types.Header{Number: big.NewInt(2), ParentHash: parent.Hash(), Root: childRoot}
+
+	changes, err := api.storageChanges(child, StorageCriteria{Address: contract, Slots: slots})
+	if err != nil {
+		t.Fatalf("failed to diff storage: %v", err)
+	}
+	want := []*StorageChange{
+		{(*hexutil.Big)(child.Number), child.Hash(), contract, slots[0], common.HexToHash("0xaa"), common.HexToHash("0xcc")},
+		{(*hexutil.Big)(child.Number), child.Hash(), contract, slots[2], common.Hash{}, common.HexToHash("0xdd")},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("storage changes mismatch: have %+v, want %+v", changes, want)
+	}
+	// Blocks with unknown parents can't be diffed
+	orphan := &types.Header{Number: big.NewInt(2), ParentHash: common.HexToHash("0xdeadbeef"), Root: childRoot}
+	if _, err := api.storageChanges(orphan, StorageCriteria{Address: contract, Slots: slots}); err == nil {
+		t.Errorf("expected error for unknown parent")
+	}
+}
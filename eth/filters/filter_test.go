@@ -20,12 +20,14 @@ import (
 	"io/ioutil"
 	"math/big"
 	"os"
+	"reflect"
 	"testing"
 
 	"golang.org/x/net/context"
 
 	"github.com/ur-technology/go-ur/common"
 	"github.com/ur-technology/go-ur/core"
+	"github.com/ur-technology/go-ur/core/bloombits"
 	"github.com/ur-technology/go-ur/core/types"
 	"github.com/ur-technology/go-ur/core/vm"
 	"github.com/ur-technology/go-ur/crypto"
@@ -288,3 +290,113 @@ func TestFilters(t *testing.T) {
 		t.Error("expected 0 log, got", len(logs))
 	}
 }
+
+// indexBloomBits stores the bloom bits index of the first sections of the chain.
+func indexBloomBits(t *testing.T, db ethdb.Database, sections uint64) {
+	for section := uint64(0); section < sections; section++ {
+		gen, err := bloombits.NewGenerator(testBloomSectionSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var head common.Hash
+		for i := uint64(0); i < testBloomSectionSize; i++ {
+			number := section*testBloomSectionSize + i
+			head = core.GetCanonicalHash(db, number)
+			if err := gen.AddBloom(uint(i), core.GetHeader(db, head, number).Bloom); err != nil {
+				t.Fatal(err)
+			}
+		}
+		vectors := make([][]byte, bloombits.BloomBitLength)
+		for bit := range vectors {
+			vector, _ := gen.Vector(uint(bit))
+			vectors[bit] = bloombits.CompressVector(vector)
+		}
+		if err := core.WriteBloomBitsSection(db, section, head, vectors); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := core.WriteBloomBitsSections(db, sections); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Tests that searching through the bloom bits index finds the same logs as the
+// per block search, including over ranges only partially indexed.
+func TestIndexedFilters(t *testing.T) {
+	var (
+		db, _   = ethdb.NewMemDatabase()
+		backend = &testBackend{new(event.TypeMux), db}
+		addr1   = common.BytesToAddress([]byte("addr1"))
+		addr2   = common.BytesToAddress([]byte("addr2"))
+		hash1   = common.BytesToHash([]byte("topic1"))
+		hash2   = common.BytesToHash([]byte("topic2"))
+	)
+	genesis := core.WriteGenesisBlockForTesting(db)
+	logged := map[int]*vm.Log{
+		5:  {Address: addr1, Topics: []common.Hash{hash1}},
+		40: {Address: addr2, Topics: []common.Hash{hash2}},
+		70: {Address: addr1, Topics: []common.Hash{hash2}},
+		98: {Address: addr1, Topics: []common.Hash{hash1, hash2}},
+	}
+	chain, receipts := core.GenerateChain(params.TestChainConfig, nil, genesis, db, 100, func(i int, gen *core.BlockGen) {
+		if log, ok := logged[i]; ok {
+			receipt := types.NewReceipt(nil, new(big.Int))
+			receipt.Logs = vm.Logs{log}
+			receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+			gen.AddUncheckedReceipt(receipt)
+		}
+	})
+	for i, block := range chain {
+		core.WriteBlock(db, block)
+		core.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+		core.WriteHeadBlockHash(db, block.Hash())
+		core.WriteBlockReceipts(db, block.Hash(), block.NumberU64(), receipts[i])
+	}
+	queries := []struct {
+		begin, end int64
+		addresses  []common.Address
+		topics     [][]common.Hash
+	}{
+		{0, -1, []common.Address{addr1}, nil},
+		{0, -1, nil, [][]common.Hash{{hash2}}},
+		{0, -1, []common.Address{addr1, addr2}, [][]common.Hash{{common.Hash{}}, {hash2}}},
+		{30, 90, nil, [][]common.Hash{{hash1, hash2}}},
+		{10, 75, nil, nil},
+		{50, 20, []common.Address{addr1}, nil},
+	}
+	find := func(i int) []Log {
+		query := queries[i]
+		filter := New(backend, false)
+		filter.SetBeginBlock(query.begin)
+		filter.SetEndBlock(query.end)
+		filter.SetAddresses(query.addresses)
+		filter.SetTopics(query.topics)
+
+		logs, err := filter.Find(context.Background())
+		if err != nil {
+			t.Fatalf("query %d: failed to find logs: %v", i, err)
+		}
+		return logs
+	}
+	var want [][]Log
+	for i := range queries {
+		want = append(want, find(i))
+	}
+	// Index the first five sections, the chain head lying past them
+	indexBloomBits(t, db, 5)
+	for i := range queries {
+		have := find(i)
+		if len(have) != len(want[i]) {
+			t.Errorf("query %d: log count mismatch: have %d, want %d", i, len(have), len(want[i]))
+			continue
+		}
+		for j := range have {
+			if !reflect.DeepEqual(have[j].Log, want[i][j].Log) {
+				t.Errorf("query %d, log %d: mismatch: have %v, want %v", i, j, have[j].Log, want[i][j].Log)
+			}
+		}
+	}
+	if len(want[0]) != 3 || len(want[1]) != 2 || len(want[2]) != 1 || len(want[3]) != 2 {
+		t.Errorf("reference log counts mismatch: have %d, %d, %d, %d", len(want[0]), len(want[1]), len(want[2]), len(want[3]))
+	}
+}
@@ -19,8 +19,10 @@ package gasprice
 import (
 	"math/big"
 	"math/rand"
+	"sort"
 	"sync"
 
+	"github.com/ur-technology/go-ur/common"
 	"github.com/ur-technology/go-ur/core"
 	"github.com/ur-technology/go-ur/core/types"
 	"github.com/ur-technology/go-ur/ethdb"
@@ -48,6 +50,9 @@ type GpoParams struct {
 	GpobaseStepDown         int
 	GpobaseStepUp           int
 	GpobaseCorrectionFactor int
+
+	GpoBlocks     int // Number of recent blocks sampled for percentile suggestions (0 = base price tracking)
+	GpoPercentile int // Percentile of the sampled block prices suggested
 }
 
 // GasPriceOracle recommends gas prices based on the content of recent
@@ -56,20 +61,43 @@ type GasPriceOracle struct {
 	chain         *core.BlockChain
 	db            ethdb.Database
 	evmux         *event.TypeMux
-	params        *GpoParams
 	initOnce      sync.Once
-	minPrice      *big.Int
 	lastBaseMutex sync.Mutex
 	lastBase      *big.Int
 
+	params     *GpoParams // Tunable oracle parameters
+	minPrice   *big.Int   // Lowest price ever suggested, derived from the params
+	minBase    *big.Int   // Lowest base price tracked, derived from the params
+	paramsLock sync.RWMutex
+
+	// samples of the percentile suggestions, cached until the next head
+	sampleHead   common.Hash
+	sampleBlocks int
+	samples      bigIntArray
+	sampleLock   sync.Mutex
+
 	// state of listenLoop
 	blocks                        map[uint64]*blockPriceInfo
 	firstProcessed, lastProcessed uint64
-	minBase                       *big.Int
 }
 
 // NewGasPriceOracle returns a new oracle.
 func NewGasPriceOracle(chain *core.BlockChain, db ethdb.Database, evmux *event.TypeMux, params *GpoParams) *GasPriceOracle {
+	gpo := &GasPriceOracle{
+		chain:  chain,
+		db:     db,
+		evmux:  evmux,
+		blocks: make(map[uint64]*blockPriceInfo),
+	}
+	gpo.SetParams(params)
+	gpo.lastBase = gpo.minPrice
+	return gpo
+}
+
+// SetParams replaces the parameters of the oracle. Prices suggested from then on
+// are bounded by the new limits, base price corrections apply from the next
+// processed block.
+func (gpo *GasPriceOracle) SetParams(params *GpoParams) {
 	minprice := params.GpoMinGasPrice
 	if minprice == nil {
 		minprice = big.NewInt(gpoDefaultMinGasPrice)
@@ -78,16 +106,19 @@ func NewGasPriceOracle(chain *core.BlockChain, db ethdb.Database, evmux *event.T
 	if params.GpobaseCorrectionFactor > 0 {
 		minbase = minbase.Div(minbase, big.NewInt(int64(params.GpobaseCorrectionFactor)))
 	}
-	return &GasPriceOracle{
-		chain:    chain,
-		db:       db,
-		evmux:    evmux,
-		params:   params,
-		blocks:   make(map[uint64]*blockPriceInfo),
-		minBase:  minbase,
-		minPrice: minprice,
-		lastBase: minprice,
-	}
+	gpo.paramsLock.Lock()
+	defer gpo.paramsLock.Unlock()
+
+	gpo.params, gpo.minPrice, gpo.minBase = params, minprice, minbase
+}
+
+// settings returns the current parameters along with the price floors derived
+// from them.
+func (gpo *GasPriceOracle) settings() (params *GpoParams, minPrice, minBase *big.Int) {
+	gpo.paramsLock.RLock()
+	defer gpo.paramsLock.RUnlock()
+
+	return gpo.params, gpo.minPrice, gpo.minBase
 }
 
 func (gpo *GasPriceOracle) init() {
@@ -137,7 +168,9 @@ func (self *GasPriceOracle) processBlock(block *types.Block) {
 		self.lastProcessed = i
 	}
 
-	lastBase := self.minPrice
+	params, minPrice, minBase := self.settings()
+
+	lastBase := minPrice
 	bpl := self.blocks[i-1]
 	if bpl != nil {
 		lastBase = bpl.baseGasPrice
@@ -147,23 +180,23 @@ func (self *GasPriceOracle) processBlock(block *types.Block) {
 	}
 
 	var corr int
-	lp := self.lowestPrice(block)
+	lp := self.lowestPrice(block, params)
 	if lp == nil {
 		return
 	}
 
 	if lastBase.Cmp(lp) < 0 {
-		corr = self.params.GpobaseStepUp
+		corr = params.GpobaseStepUp
 	} else {
-		corr = -self.params.GpobaseStepDown
+		corr = -params.GpobaseStepDown
 	}
 
 	crand := int64(corr * (900 + rand.Intn(201)))
 	newBase := new(big.Int).Mul(lastBase, big.NewInt(1000000+crand))
 	newBase.Div(newBase, big.NewInt(1000000))
 
-	if newBase.Cmp(self.minBase) < 0 {
-		newBase = self.minBase
+	if newBase.Cmp(minBase) < 0 {
+		newBase = minBase
 	}
 
 	bpi := self.blocks[i]
@@ -180,7 +213,7 @@ func (self *GasPriceOracle) processBlock(block *types.Block) {
 }
 
 // returns the lowers possible price with which a tx was or could have been included
-func (self *GasPriceOracle) lowestPrice(block *types.Block) *big.Int {
+func (self *GasPriceOracle) lowestPrice(block *types.Block, params *GpoParams) *big.Int {
 	gasUsed := big.NewInt(0)
 
 	receipts := core.GetBlockReceipts(self.db, block.Hash(), block.NumberU64())
@@ -191,7 +224,7 @@ func (self *GasPriceOracle) lowestPrice(block *types.Block) *big.Int {
 	}
 
 	if new(big.Int).Mul(gasUsed, big.NewInt(100)).Cmp(new(big.Int).Mul(block.GasLimit(),
-		big.NewInt(int64(self.params.GpoFullBlockRatio)))) < 0 {
+		big.NewInt(int64(params.GpoFullBlockRatio)))) < 0 {
 		// block is not full, could have posted a tx with MinGasPrice
 		return big.NewInt(0)
 	}
@@ -211,19 +244,86 @@ func (self *GasPriceOracle) lowestPrice(block *types.Block) *big.Int {
 	return minPrice
 }
 
-// SuggestPrice returns the recommended gas price.
+// SuggestPrice returns the recommended gas price. If recent blocks are sampled,
+// it is the configured percentile of their lowest transaction prices, otherwise
+// the tracked base price raised by the correction factor.
 func (self *GasPriceOracle) SuggestPrice() *big.Int {
-	self.init()
-	self.lastBaseMutex.Lock()
-	price := new(big.Int).Set(self.lastBase)
-	self.lastBaseMutex.Unlock()
+	params, minPrice, _ := self.settings()
+
+	var price *big.Int
+	if params.GpoBlocks > 0 {
+		price = self.percentilePrice(params)
+	} else {
+		self.init()
+		self.lastBaseMutex.Lock()
+		price = new(big.Int).Set(self.lastBase)
+		self.lastBaseMutex.Unlock()
 
-	price.Mul(price, big.NewInt(int64(self.params.GpobaseCorrectionFactor)))
-	price.Div(price, big.NewInt(100))
-	if price.Cmp(self.minPrice) < 0 {
-		price.Set(self.minPrice)
-	} else if self.params.GpoMaxGasPrice != nil && price.Cmp(self.params.GpoMaxGasPrice) > 0 {
-		price.Set(self.params.GpoMaxGasPrice)
+		price.Mul(price, big.NewInt(int64(params.GpobaseCorrectionFactor)))
+		price.Div(price, big.NewInt(100))
+	}
+	if price == nil || price.Cmp(minPrice) < 0 {
+		price = new(big.Int).Set(minPrice)
+	} else if params.GpoMaxGasPrice != nil && price.Cmp(params.GpoMaxGasPrice) > 0 {
+		price = new(big.Int).Set(params.GpoMaxGasPrice)
 	}
 	return price
 }
+
+// percentilePrice returns the configured percentile of the lowest transaction
+// prices of the recent blocks, or nil if none of them holds a transaction.
+func (self *GasPriceOracle) percentilePrice(params *GpoParams) *big.Int {
+	samples := self.sample(params.GpoBlocks)
+	if len(samples) == 0 {
+		return nil
+	}
+	percentile := params.GpoPercentile
+	if percentile < 0 {
+		percentile = 0
+	} else if percentile > 100 {
+		percentile = 100
+	}
+	return new(big.Int).Set(samples[(len(samples)-1)*percentile/100])
+}
+
+// sample returns the sorted lowest transaction prices of the given number of
+// blocks up to the current head, skipping empty ones.
+func (self *GasPriceOracle) sample(blocks int) bigIntArray {
+	self.sampleLock.Lock()
+	defer self.sampleLock.Unlock()
+
+	head := self.chain.CurrentBlock()
+	if head.Hash() == self.sampleHead && blocks == self.sampleBlocks {
+		return self.samples
+	}
+	var samples bigIntArray
+	for number, n := head.NumberU64(), 0; n < blocks; n++ {
+		block := self.chain.GetBlockByNumber(number)
+		if block == nil {
+			break
+		}
+		if price := lowestTxPrice(block); price != nil {
+			samples = append(samples, price)
+		}
+		if number == 0 {
+			break
+		}
+		number--
+	}
+	sort.Sort(samples)
+
+	self.sampleHead, self.sampleBlocks, self.samples = head.Hash(), blocks, samples
+	return samples
+}
+
+// lowestTxPrice returns the lowest gas price of the transactions of a block, or
+// nil if the block is empty.
+func lowestTxPrice(block *types.Block) *big.Int {
+	var lowest *big.Int
+	for _, tx := range block.Transactions() {
+		if price := tx.GasPrice(); lowest == nil || price.Cmp(lowest) < 0 {
+			lowest = price
+		}
+	}
+	return lowest
+}
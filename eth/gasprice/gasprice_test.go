@@ -0,0 +1,118 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package gasprice
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/crypto"
+	"github.com/ur-technology/go-ur/ethdb"
+	"github.com/ur-technology/go-ur/event"
+	"github.com/ur-technology/go-ur/params"
+)
+
+// Tests that the suggested gas price is the configured percentile of the lowest
+// prices of the sampled blocks, bounded by the price limits.
+func TestPercentileSuggestions(t *testing.T) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr    = crypto.PubkeyToAddress(key.PublicKey)
+		evmux   = new(event.TypeMux)
+		db, _   = ethdb.NewMemDatabase()
+		genesis = core.WriteGenesisBlockForTesting(db, core.GenesisAccount{Address: addr, Balance: common.Ether})
+		config  = &params.ChainConfig{HomesteadBlock: big.NewInt(0)}
+		chain   = mustNewBlockChain(t, db, config, evmux)
+		signer  = types.MakeSigner(config, big.NewInt(0))
+	)
+	// Every even block holds transactions with the lowest price of its number in shannon
+	blocks, _ := core.GenerateChain(config, chain, genesis, db, 10, func(i int, gen *core.BlockGen) {
+		if number := i + 1; number%2 == 0 {
+			for j := 0; j < 2; j++ {
+				price := new(big.Int).Mul(big.NewInt(int64(number+j)), common.Shannon)
+				tx, _ := types.NewTransaction(gen.TxNonce(addr), common.Address{}, big.NewInt(1), big.NewInt(21000), price, nil).SignECDSA(signer, key)
+				gen.AddTx(tx)
+			}
+		}
+	})
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	tests := []struct {
+		blocks, percentile int
+		max                int64
+		want               int64
+	}{
+		{blocks: 20, percentile: 50, want: 6},          // Samples of 2, 4, 6, 8 and 10 shannon
+		{blocks: 20, percentile: 0, want: 2},           // Cheapest block
+		{blocks: 4, percentile: 50, want: 8},           // Samples of 8 and 10 shannon only
+		{blocks: 20, percentile: 100, max: 9, want: 9}, // Capped by the maximum price
+		{blocks: 1, percentile: 50, want: 10},          // Head block only
+	}
+	for i, tt := range tests {
+		gpoParams := &GpoParams{
+			GpoMinGasPrice:          common.Shannon,
+			GpobaseCorrectionFactor: 100,
+			GpoBlocks:               tt.blocks,
+			GpoPercentile:           tt.percentile,
+		}
+		if tt.max > 0 {
+			gpoParams.GpoMaxGasPrice = new(big.Int).Mul(big.NewInt(tt.max), common.Shannon)
+		}
+		gpo := NewGasPriceOracle(chain, db, evmux, gpoParams)
+		want := new(big.Int).Mul(big.NewInt(tt.want), common.Shannon)
+		if price := gpo.SuggestPrice(); price.Cmp(want) != 0 {
+			t.Errorf("test %d: suggested price mismatch: have %v, want %v", i, price, want)
+		}
+	}
+}
+
+// Tests that the minimum price is suggested if no recent block holds a
+// transaction.
+func TestPercentileSuggestionsEmptyChain(t *testing.T) {
+	var (
+		evmux   = new(event.TypeMux)
+		db, _   = ethdb.NewMemDatabase()
+		genesis = core.WriteGenesisBlockForTesting(db)
+		config  = &params.ChainConfig{HomesteadBlock: big.NewInt(0)}
+		chain   = mustNewBlockChain(t, db, config, evmux)
+	)
+	blocks, _ := core.GenerateChain(config, chain, genesis, db, 5, func(int, *core.BlockGen) {})
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	gpo := NewGasPriceOracle(chain, db, evmux, &GpoParams{
+		GpoMinGasPrice:          common.Shannon,
+		GpobaseCorrectionFactor: 100,
+		GpoBlocks:               20,
+		GpoPercentile:           50,
+	})
+	if price := gpo.SuggestPrice(); price.Cmp(common.Shannon) != 0 {
+		t.Errorf("suggested price mismatch: have %v, want %v", price, common.Shannon)
+	}
+}
+
+func mustNewBlockChain(t *testing.T, db ethdb.Database, config *params.ChainConfig, evmux *event.TypeMux) *core.BlockChain {
+	chain, err := core.NewBlockChain(db, config, new(core.FakePow), evmux)
+	if err != nil {
+		t.Fatalf("failed to create blockchain: %v", err)
+	}
+	return chain
+}
@@ -27,7 +27,9 @@ import (
 	"time"
 
 	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/consensus"
 	"github.com/ur-technology/go-ur/core"
+	"github.com/ur-technology/go-ur/core/forkid"
 	"github.com/ur-technology/go-ur/core/types"
 	"github.com/ur-technology/go-ur/eth/downloader"
 	"github.com/ur-technology/go-ur/eth/fetcher"
@@ -38,7 +40,6 @@ import (
 	"github.com/ur-technology/go-ur/p2p"
 	"github.com/ur-technology/go-ur/p2p/discover"
 	"github.com/ur-technology/go-ur/params"
-	"github.com/ur-technology/go-ur/pow"
 	"github.com/ur-technology/go-ur/rlp"
 )
 
@@ -55,8 +56,19 @@ var (
 // not compatible (low protocol version restrictions and high requirements).
 var errIncompatibleConfig = errors.New("incompatible configuration")
 
+// peerError is a failure caused by the remote peer breaking the protocol, as
+// opposed to a local or network one.
+type peerError struct {
+	code    errCode
+	message string
+}
+
+func (e *peerError) Error() string {
+	return fmt.Sprintf("%v - %v", e.code, e.message)
+}
+
 func errResp(code errCode, format string, v ...interface{}) error {
-	return fmt.Errorf("%v - %v", code, fmt.Sprintf(format, v...))
+	return &peerError{code, fmt.Sprintf(format, v...)}
 }
 
 type ProtocolManager struct {
@@ -74,6 +86,9 @@ type ProtocolManager struct {
 	downloader *downloader.Downloader
 	fetcher    *fetcher.Fetcher
 	peers      *peerSet
+	scores     *peerScores // Reputation of the peers, banning misbehaving ones
+
+	forkFilter forkid.Filter // Fork identifier filter rejecting peers on other chains or fork schedules
 
 	SubProtocols []p2p.Protocol
 
@@ -96,7 +111,7 @@ type ProtocolManager struct {
 
 // NewProtocolManager returns a new ethereum sub protocol manager. The Ethereum sub protocol manages peers capable
 // with the ethereum network.
-func NewProtocolManager(config *params.ChainConfig, fastSync bool, networkId int, maxPeers int, mux *event.TypeMux, txpool txPool, pow pow.PoW, blockchain *core.BlockChain, chaindb ethdb.Database) (*ProtocolManager, error) {
+func NewProtocolManager(config *params.ChainConfig, fastSync bool, networkId int, maxPeers int, mux *event.TypeMux, txpool txPool, engine consensus.Engine, blockchain *core.BlockChain, chaindb ethdb.Database) (*ProtocolManager, error) {
 	// Create the protocol manager with the base fields
 	manager := &ProtocolManager{
 		networkId:   networkId,
@@ -107,10 +122,14 @@ func NewProtocolManager(config *params.ChainConfig, fastSync bool, networkId int
 		chainconfig: config,
 		maxPeers:    maxPeers,
 		peers:       newPeerSet(),
+		scores:      newPeerScores(),
 		newPeerCh:   make(chan *peer),
 		noMorePeers: make(chan struct{}),
 		txsyncCh:    make(chan *txsync),
 		quitSync:    make(chan struct{}),
+		forkFilter: forkid.NewFilter(config, blockchain.Genesis().Hash(), func() uint64 {
+			return blockchain.CurrentHeader().Number.Uint64()
+		}),
 	}
 	// Figure out whether to allow fast sync or not
 	if fastSync && blockchain.CurrentBlock().NumberU64() > 0 {
@@ -149,7 +168,9 @@ func NewProtocolManager(config *params.ChainConfig, fastSync bool, networkId int
 			},
 			PeerInfo: func(id discover.NodeID) interface{} {
 				if p := manager.peers.Peer(fmt.Sprintf("%x", id[:8])); p != nil {
-					return p.Info()
+					info := p.Info()
+					info.Score = manager.scores.Score(p.id)
+					return info
 				}
 				return nil
 			},
@@ -162,10 +183,10 @@ func NewProtocolManager(config *params.ChainConfig, fastSync bool, networkId int
 	manager.downloader = downloader.New(downloader.FullSync, chaindb, manager.eventMux, blockchain.HasHeader, blockchain.HasBlockAndState, blockchain.GetHeaderByHash,
 		blockchain.GetBlockByHash, blockchain.CurrentHeader, blockchain.CurrentBlock, blockchain.CurrentFastBlock, blockchain.FastSyncCommitHead,
 		blockchain.GetTdByHash, blockchain.InsertHeaderChain, manager.insertChain, blockchain.InsertReceiptChain, blockchain.Rollback,
-		manager.removePeer)
+		func(id string) { manager.dropPeer(id, penaltyUseless, "dropped by the downloader") })
 
 	validator := func(block *types.Block, parent *types.Block) error {
-		return core.ValidateHeader(config, pow, block.Header(), parent.Header(), true, false)
+		return engine.VerifyHeader(blockchain, block.Header(), parent.Header(), true, false)
 	}
 	heighter := func() uint64 {
 		return blockchain.CurrentBlock().NumberU64()
@@ -174,7 +195,9 @@ func NewProtocolManager(config *params.ChainConfig, fastSync bool, networkId int
 		atomic.StoreUint32(&manager.synced, 1) // Mark initial sync done on any fetcher import
 		return manager.insertChain(blocks)
 	}
-	manager.fetcher = fetcher.New(blockchain.GetBlockByHash, validator, manager.BroadcastBlock, heighter, inserter, manager.removePeer)
+	manager.fetcher = fetcher.New(blockchain.GetBlockByHash, validator, manager.BroadcastBlock, heighter, inserter, func(id string) {
+		manager.dropPeer(id, penaltyInvalidBlock, "invalid block announcement")
+	})
 
 	if blockchain.Genesis().Hash().Hex() == defaultGenesisHash && networkId == 1 {
 		glog.V(logger.Debug).Infoln("Bad Block Reporting is enabled")
@@ -189,9 +212,47 @@ func (pm *ProtocolManager) insertChain(blocks types.Blocks) (i int, err error) {
 	if pm.badBlockReportingEnabled && core.IsValidationErr(err) && i < len(blocks) {
 		go sendBadBlockReport(blocks[i], err)
 	}
+	// Penalize the peer that propagated an invalid block
+	if err != nil && i < len(blocks) && !core.IsParentErr(err) && err != core.BlockFutureErr {
+		if id := blockOrigin(blocks[i]); id != "" {
+			if core.IsRewardErr(err) {
+				pm.penalize(id, penaltyBadRewards, err.Error())
+			} else {
+				pm.penalize(id, penaltyInvalidBlock, err.Error())
+			}
+		}
+	}
 	return i, err
 }
 
+// blockOrigin returns the id of the peer a block was received from, either the
+// one propagating it or the one the downloader synced it from.
+func blockOrigin(block *types.Block) string {
+	switch from := block.ReceivedFrom.(type) {
+	case *peer:
+		return from.id
+	case string:
+		return from
+	}
+	return ""
+}
+
+// penalize lowers the score of a misbehaving peer, disconnecting it if it gets
+// banned.
+func (pm *ProtocolManager) penalize(id string, penalty int, reason string) {
+	glog.V(logger.Debug).Infof("Penalizing peer %s by %d: %s", id, penalty, reason)
+	if pm.scores.penalize(id, penalty) {
+		glog.V(logger.Info).Infof("Banning peer %s for %v: %s", id, peerBanDuration, reason)
+		pm.removePeer(id)
+	}
+}
+
+// dropPeer penalizes and disconnects a misbehaving peer.
+func (pm *ProtocolManager) dropPeer(id string, penalty int, reason string) {
+	pm.penalize(id, penalty, reason)
+	pm.removePeer(id)
+}
+
 func (pm *ProtocolManager) removePeer(id string) {
 	// Short circuit if the peer was already removed
 	peer := pm.peers.Peer(id)
@@ -259,12 +320,17 @@ func (pm *ProtocolManager) handle(p *peer) error {
 	if pm.peers.Len() >= pm.maxPeers {
 		return p2p.DiscTooManyPeers
 	}
+	if pm.scores.banned(p.id) {
+		glog.V(logger.Debug).Infof("%v: banned, refusing", p)
+		return p2p.DiscUselessPeer
+	}
 
 	glog.V(logger.Debug).Infof("%v: peer connected [%s]", p, p.Name())
 
 	// Execute the Ethereum handshake
 	td, head, genesis := pm.blockchain.Status()
-	if err := p.Handshake(pm.networkId, td, head, genesis); err != nil {
+	forkID := forkid.NewID(pm.chainconfig, genesis, pm.blockchain.CurrentHeader().Number.Uint64())
+	if err := p.Handshake(pm.networkId, td, head, genesis, forkID, pm.forkFilter); err != nil {
 		glog.V(logger.Debug).Infof("%v: handshake failed: %v", p, err)
 		return err
 	}
@@ -317,12 +383,19 @@ func (pm *ProtocolManager) handle(p *peer) error {
 
 // handleMsg is invoked whenever an inbound message is received from a remote
 // peer. The remote connection is torn down upon returning any error.
-func (pm *ProtocolManager) handleMsg(p *peer) error {
+func (pm *ProtocolManager) handleMsg(p *peer) (err error) {
 	// Read the next message from the remote peer, and ensure it's fully consumed
 	msg, err := p.rw.ReadMsg()
 	if err != nil {
 		return err
 	}
+	// Hold protocol violations against the peer, but not failures on our side
+	// or of the network, such as failed sends
+	defer func() {
+		if _, ok := err.(*peerError); ok {
+			pm.penalize(p.id, penaltyProtocol, err.Error())
+		}
+	}()
 	if msg.Size > ProtocolMaxMsgSize {
 		return errResp(ErrMsgTooLarge, "%v > %v", msg.Size, ProtocolMaxMsgSize)
 	}
@@ -470,7 +543,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		// Decode the retrieval message
 		msgStream := rlp.NewStream(msg.Payload, uint64(msg.Size))
 		if _, err := msgStream.List(); err != nil {
-			return err
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
 		}
 		// Gather blocks until the fetch or network limits is reached
 		var (
@@ -523,7 +596,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		// Decode the retrieval message
 		msgStream := rlp.NewStream(msg.Payload, uint64(msg.Size))
 		if _, err := msgStream.List(); err != nil {
-			return err
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
 		}
 		// Gather state data until the fetch or network limits is reached
 		var (
@@ -538,8 +611,9 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			} else if err != nil {
 				return errResp(ErrDecode, "msg %v: %v", msg, err)
 			}
-			// Retrieve the requested state entry, stopping if enough was found
-			if entry, err := pm.chaindb.Get(hash.Bytes()); err == nil {
+			// Retrieve the requested state entry, stopping if enough was found. The
+			// recent states may only be held in the trie cache yet
+			if entry, err := pm.blockchain.StateDatabase().Get(hash.Bytes()); err == nil {
 				data = append(data, entry)
 				bytes += len(entry)
 			}
@@ -561,7 +635,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		// Decode the retrieval message
 		msgStream := rlp.NewStream(msg.Payload, uint64(msg.Size))
 		if _, err := msgStream.List(); err != nil {
-			return err
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
 		}
 		// Gather state data until the fetch or network limits is reached
 		var (
@@ -659,24 +733,33 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		p.MarkBlock(request.Block.Hash())
 		pm.fetcher.Enqueue(p.id, request.Block)
 
-		// Assuming the block is importable by the peer, but possibly not yet done so,
-		// calculate the head hash and TD that the peer truly must have.
-		var (
-			trueHead = request.Block.ParentHash()
-			trueTD   = new(big.Int).Sub(request.TD, request.Block.Difficulty())
-		)
-		// Update the peers total difficulty if better than the previous
-		if _, td := p.Head(); trueTD.Cmp(td) > 0 {
-			p.SetHead(trueHead, trueTD)
-
-			// Schedule a sync if above ours. Note, this will not fire a sync for a gap of
-			// a singe block (as the true TD is below the propagated block), however this
-			// scenario should easily be covered by the fetcher.
-			currentBlock := pm.blockchain.CurrentBlock()
-			if trueTD.Cmp(pm.blockchain.GetTd(currentBlock.Hash(), currentBlock.NumberU64())) > 0 {
-				go pm.synchronise(p)
-			}
+		pm.updatePropagatedHead(p, request.Block.Header(), request.TD)
+
+	case p.version >= eth64 && msg.Code == NewCompactBlockMsg:
+		// Retrieve and decode the propagated compact block
+		var request compactBlockData
+		if err := msg.Decode(&request); err != nil {
+			return errResp(ErrDecode, "%v: %v", msg, err)
 		}
+		if request.Header == nil || request.TD == nil {
+			return errResp(ErrDecode, "%v: missing header or td", msg)
+		}
+		hash := request.Header.Hash()
+		p.MarkBlock(hash)
+		for _, txHash := range request.TxHashes {
+			p.MarkTransaction(txHash)
+		}
+		// Rebuild the body from the pool, falling back to a regular fetch if
+		// any of the transactions are unknown to us
+		if block, err := pm.reconstructCompactBlock(&request); err != nil {
+			glog.V(logger.Detail).Infof("%v: compact block #%d [%x] incomplete, fetching: %v", p, request.Header.Number, hash[:4], err)
+			pm.fetcher.Notify(p.id, hash, request.Header.Number.Uint64(), time.Now(), p.RequestOneHeader, p.RequestBodies)
+		} else {
+			block.ReceivedAt = msg.ReceivedAt
+			block.ReceivedFrom = p
+			pm.fetcher.Enqueue(p.id, block)
+		}
+		pm.updatePropagatedHead(p, request.Header, request.TD)
 
 	case msg.Code == TxMsg:
 		// Transactions arrived, make sure we have a valid and fresh chain to handle them
@@ -703,6 +786,57 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 	return nil
 }
 
+// updatePropagatedHead updates the head and total difficulty of a peer that has
+// propagated the block with the given header and td to us, and schedules a sync
+// if the peer is ahead of the local chain.
+func (pm *ProtocolManager) updatePropagatedHead(p *peer, header *types.Header, propTD *big.Int) {
+	// Assuming the block is importable by the peer, but possibly not yet done so,
+	// calculate the head hash and TD that the peer truly must have.
+	var (
+		trueHead = header.ParentHash
+		trueTD   = new(big.Int).Sub(propTD, header.Difficulty)
+	)
+	// Update the peers total difficulty if better than the previous
+	if _, td := p.Head(); trueTD.Cmp(td) > 0 {
+		p.SetHead(trueHead, trueTD)
+
+		// Schedule a sync if above ours. Note, this will not fire a sync for a gap of
+		// a singe block (as the true TD is below the propagated block), however this
+		// scenario should easily be covered by the fetcher.
+		currentBlock := pm.blockchain.CurrentBlock()
+		if trueTD.Cmp(pm.blockchain.GetTd(currentBlock.Hash(), currentBlock.NumberU64())) > 0 {
+			go pm.synchronise(p)
+		}
+	}
+}
+
+// reconstructCompactBlock assembles the full block from a compact propagation
+// packet, taking transactions that were only referenced by hash from the local
+// transaction pool.
+func (pm *ProtocolManager) reconstructCompactBlock(request *compactBlockData) (*types.Block, error) {
+	included := make(map[common.Hash]*types.Transaction, len(request.Txs))
+	for _, tx := range request.Txs {
+		included[tx.Hash()] = tx
+	}
+	txs := make(types.Transactions, len(request.TxHashes))
+	for i, hash := range request.TxHashes {
+		if tx, ok := included[hash]; ok {
+			txs[i] = tx
+		} else if tx := pm.txpool.Get(hash); tx != nil {
+			txs[i] = tx
+		} else {
+			return nil, fmt.Errorf("transaction %x unknown", hash[:4])
+		}
+	}
+	if root := types.DeriveSha(txs); root != request.Header.TxHash {
+		return nil, fmt.Errorf("transaction root mismatch: have %x, want %x", root, request.Header.TxHash)
+	}
+	if hash := types.CalcUncleHash(request.Uncles); hash != request.Header.UncleHash {
+		return nil, fmt.Errorf("uncle hash mismatch: have %x, want %x", hash, request.Header.UncleHash)
+	}
+	return types.NewBlockWithHeader(request.Header).WithBody(txs, request.Uncles), nil
+}
+
 // BroadcastBlock will either propagate a block to a subset of it's peers, or
 // will only announce it's availability (depending what's requested).
 func (pm *ProtocolManager) BroadcastBlock(block *types.Block, propagate bool) {
@@ -722,7 +856,11 @@ func (pm *ProtocolManager) BroadcastBlock(block *types.Block, propagate bool) {
 		// Send the block to a subset of our peers
 		transfer := peers[:int(math.Sqrt(float64(len(peers))))]
 		for _, peer := range transfer {
-			peer.SendNewBlock(block, td)
+			if peer.version >= eth64 {
+				peer.SendNewCompactBlock(block, td)
+			} else {
+				peer.SendNewBlock(block, td)
+			}
 		}
 		glog.V(logger.Detail).Infof("propagated block %x to %d peers in %v", hash[:4], len(transfer), time.Since(block.ReceivedAt))
 	}
@@ -43,8 +43,8 @@ func TestProtocolCompatibility(t *testing.T) {
 		fastSync   bool
 		compatible bool
 	}{
-		{61, false, true}, {62, false, true}, {63, false, true},
-		{61, true, false}, {62, true, false}, {63, true, true},
+		{61, false, true}, {62, false, true}, {63, false, true}, {64, false, true},
+		{61, true, false}, {62, true, false}, {63, true, true}, {64, true, true},
 	}
 	// Make sure anything we screw up is restored
 	backup := ProtocolVersions
@@ -67,6 +67,7 @@ func TestProtocolCompatibility(t *testing.T) {
 // Tests that block headers can be retrieved from a remote chain based on user queries.
 func TestGetBlockHeaders62(t *testing.T) { testGetBlockHeaders(t, 62) }
 func TestGetBlockHeaders63(t *testing.T) { testGetBlockHeaders(t, 63) }
+func TestGetBlockHeaders64(t *testing.T) { testGetBlockHeaders(t, 64) }
 
 func testGetBlockHeaders(t *testing.T, protocol int) {
 	pm := newTestProtocolManagerMust(t, false, downloader.MaxHashFetch+15, nil, nil)
@@ -226,6 +227,7 @@ func testGetBlockHeaders(t *testing.T, protocol int) {
 // Tests that block contents can be retrieved from a remote chain based on their hashes.
 func TestGetBlockBodies62(t *testing.T) { testGetBlockBodies(t, 62) }
 func TestGetBlockBodies63(t *testing.T) { testGetBlockBodies(t, 63) }
+func TestGetBlockBodies64(t *testing.T) { testGetBlockBodies(t, 64) }
 
 func testGetBlockBodies(t *testing.T, protocol int) {
 	pm := newTestProtocolManagerMust(t, false, downloader.MaxBlockFetch+15, nil, nil)
@@ -387,6 +389,54 @@ func testGetNodeData(t *testing.T, protocol int) {
 	}
 }
 
+// Tests that the recent states held in the trie cache, not yet written to disk,
+// are served too.
+func TestGetNodeDataTrieCache(t *testing.T) {
+	// Generate the chain on a separate database, so the states are only cached
+	var (
+		evmux         = new(event.TypeMux)
+		pow           = new(core.FakePow)
+		db, _         = ethdb.NewMemDatabase()
+		gendb, _      = ethdb.NewMemDatabase()
+		genesis       = core.WriteGenesisBlockForTesting(db, testBank)
+		chainConfig   = &params.ChainConfig{HomesteadBlock: big.NewInt(0)}
+		cacheConfig   = &core.BlockChainConfig{TrieCacheLimit: 256, TrieCommitInterval: core.DefaultTrieCommitInterval}
+		blockchain, _ = core.NewBlockChainWithConfig(db, chainConfig, cacheConfig, pow, evmux)
+	)
+	core.WriteGenesisBlockForTesting(gendb, testBank)
+	chain, _ := core.GenerateChain(chainConfig, blockchain, genesis, gendb, 4, func(i int, block *core.BlockGen) {
+		tx, _ := types.NewTransaction(block.TxNonce(testBank.Address), common.Address{byte(i)}, big.NewInt(1000), params.TxGas, nil, nil).SignECDSA(types.HomesteadSigner{}, testBankKey)
+		block.AddTx(tx)
+	})
+	if _, err := blockchain.InsertChain(chain); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	pm, err := NewProtocolManager(chainConfig, false, NetworkId, 1000, evmux, &testTxPool{}, pow, blockchain, db)
+	if err != nil {
+		t.Fatalf("failed to create protocol manager: %v", err)
+	}
+	pm.Start()
+	peer, _ := newTestPeer("peer", 63, pm, true)
+	defer peer.close()
+
+	root := pm.blockchain.CurrentBlock().Root()
+	if _, err := pm.chaindb.Get(root.Bytes()); err == nil {
+		t.Fatalf("head state root written to disk")
+	}
+	p2p.Send(peer.app, 0x0d, []common.Hash{root})
+	msg, err := peer.app.ReadMsg()
+	if err != nil {
+		t.Fatalf("failed to read node data response: %v", err)
+	}
+	var data [][]byte
+	if err := msg.Decode(&data); err != nil {
+		t.Fatalf("failed to decode response node data: %v", err)
+	}
+	if len(data) != 1 || crypto.Keccak256Hash(data[0]) != root {
+		t.Fatalf("cached state root not served: have %d entries", len(data))
+	}
+}
+
 // Tests that the transaction receipts can be retrieved based on hashes.
 func TestGetReceipt63(t *testing.T) { testGetReceipt(t, 63) }
 
@@ -29,6 +29,7 @@ import (
 
 	"github.com/ur-technology/go-ur/common"
 	"github.com/ur-technology/go-ur/core"
+	"github.com/ur-technology/go-ur/core/forkid"
 	"github.com/ur-technology/go-ur/core/types"
 	"github.com/ur-technology/go-ur/crypto"
 	"github.com/ur-technology/go-ur/ethdb"
@@ -103,6 +104,19 @@ func (p *testTxPool) AddBatch(txs []*types.Transaction) {
 	}
 }
 
+// Get returns the pooled transaction with the given hash, or nil if unknown.
+func (p *testTxPool) Get(hash common.Hash) *types.Transaction {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	for _, tx := range p.pool {
+		if tx.Hash() == hash {
+			return tx
+		}
+	}
+	return nil
+}
+
 // Pending returns all the transactions known to the pool
 func (p *testTxPool) Pending() map[common.Address]types.Transactions {
 	p.lock.RLock()
@@ -158,21 +172,32 @@ func newTestPeer(name string, version int, pm *ProtocolManager, shake bool) (*te
 	// Execute any implicitly requested handshakes and return
 	if shake {
 		td, head, genesis := pm.blockchain.Status()
-		tp.handshake(nil, td, head, genesis)
+		forkID := forkid.NewID(pm.chainconfig, genesis, pm.blockchain.CurrentHeader().Number.Uint64())
+		tp.handshake(nil, td, head, genesis, forkID)
 	}
 	return tp, errc
 }
 
 // handshake simulates a trivial handshake that expects the same state from the
 // remote side as we are simulating locally.
-func (p *testPeer) handshake(t *testing.T, td *big.Int, head common.Hash, genesis common.Hash) {
-	msg := &statusData{
+func (p *testPeer) handshake(t *testing.T, td *big.Int, head common.Hash, genesis common.Hash, forkID forkid.ID) {
+	var msg interface{} = &statusData{
 		ProtocolVersion: uint32(p.version),
 		NetworkId:       uint32(NetworkId),
 		TD:              td,
 		CurrentBlock:    head,
 		GenesisBlock:    genesis,
 	}
+	if p.version >= eth65 {
+		msg = &statusData65{
+			ProtocolVersion: uint32(p.version),
+			NetworkId:       uint32(NetworkId),
+			TD:              td,
+			CurrentBlock:    head,
+			GenesisBlock:    genesis,
+			ForkID:          forkID,
+		}
+	}
 	if err := p2p.ExpectMsg(p.app, StatusMsg, msg); err != nil {
 		t.Fatalf("status recv: %v", err)
 	}
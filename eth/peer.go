@@ -24,6 +24,7 @@ import (
 	"time"
 
 	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core/forkid"
 	"github.com/ur-technology/go-ur/core/types"
 	"github.com/ur-technology/go-ur/logger"
 	"github.com/ur-technology/go-ur/logger/glog"
@@ -50,6 +51,7 @@ type PeerInfo struct {
 	Version    int      `json:"version"`    // Ethereum protocol version negotiated
 	Difficulty *big.Int `json:"difficulty"` // Total difficulty of the peer's blockchain
 	Head       string   `json:"head"`       // SHA3 hash of the peer's best owned block
+	Score      int      `json:"score"`      // Reputation of the peer, negative once penalized for misbehaving
 }
 
 type peer struct {
@@ -161,6 +163,28 @@ func (p *peer) SendNewBlock(block *types.Block, td *big.Int) error {
 	return p2p.Send(p.rw, NewBlockMsg, []interface{}{block, td})
 }
 
+// SendNewCompactBlock propagates a block to a remote peer, sending only the
+// hashes of the transactions the peer is known to have already.
+func (p *peer) SendNewCompactBlock(block *types.Block, td *big.Int) error {
+	p.knownBlocks.Add(block.Hash())
+
+	txs := block.Transactions()
+	request := compactBlockData{
+		Header:   block.Header(),
+		Uncles:   block.Uncles(),
+		TxHashes: make([]common.Hash, len(txs)),
+		TD:       td,
+	}
+	for i, tx := range txs {
+		hash := tx.Hash()
+		request.TxHashes[i] = hash
+		if !p.knownTxs.Has(hash) {
+			request.Txs = append(request.Txs, tx)
+		}
+	}
+	return p2p.Send(p.rw, NewCompactBlockMsg, request)
+}
+
 // SendBlockHeaders sends a batch of block headers to the remote peer.
 func (p *peer) SendBlockHeaders(headers []*types.Header) error {
 	return p2p.Send(p.rw, BlockHeadersMsg, headers)
@@ -232,12 +256,23 @@ func (p *peer) RequestReceipts(hashes []common.Hash) error {
 
 // Handshake executes the eth protocol handshake, negotiating version number,
 // network IDs, difficulties, head and genesis blocks.
-func (p *peer) Handshake(network int, td *big.Int, head common.Hash, genesis common.Hash) error {
+func (p *peer) Handshake(network int, td *big.Int, head common.Hash, genesis common.Hash, forkID forkid.ID, forkFilter forkid.Filter) error {
 	// Send out own handshake in a new thread
 	errc := make(chan error, 2)
-	var status statusData // safe to read after two values have been received from errc
+	var status statusData65 // safe to read after two values have been received from errc
 
 	go func() {
+		if p.version >= eth65 {
+			errc <- p2p.Send(p.rw, StatusMsg, &statusData65{
+				ProtocolVersion: uint32(p.version),
+				NetworkId:       uint32(network),
+				TD:              td,
+				CurrentBlock:    head,
+				GenesisBlock:    genesis,
+				ForkID:          forkID,
+			})
+			return
+		}
 		errc <- p2p.Send(p.rw, StatusMsg, &statusData{
 			ProtocolVersion: uint32(p.version),
 			NetworkId:       uint32(network),
@@ -247,7 +282,7 @@ func (p *peer) Handshake(network int, td *big.Int, head common.Hash, genesis com
 		})
 	}()
 	go func() {
-		errc <- p.readStatus(network, &status, genesis)
+		errc <- p.readStatus(network, &status, genesis, forkFilter)
 	}()
 	timeout := time.NewTimer(handshakeTimeout)
 	defer timeout.Stop()
@@ -265,7 +300,7 @@ func (p *peer) Handshake(network int, td *big.Int, head common.Hash, genesis com
 	return nil
 }
 
-func (p *peer) readStatus(network int, status *statusData, genesis common.Hash) (err error) {
+func (p *peer) readStatus(network int, status *statusData65, genesis common.Hash, forkFilter forkid.Filter) (err error) {
 	msg, err := p.rw.ReadMsg()
 	if err != nil {
 		return err
@@ -277,8 +312,17 @@ func (p *peer) readStatus(network int, status *statusData, genesis common.Hash)
 		return errResp(ErrMsgTooLarge, "%v > %v", msg.Size, ProtocolMaxMsgSize)
 	}
 	// Decode the handshake and make sure everything matches
-	if err := msg.Decode(&status); err != nil {
-		return errResp(ErrDecode, "msg %v: %v", msg, err)
+	if p.version >= eth65 {
+		if err := msg.Decode(&status); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+	} else {
+		var legacy statusData
+		if err := msg.Decode(&legacy); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		status.ProtocolVersion, status.NetworkId, status.TD = legacy.ProtocolVersion, legacy.NetworkId, legacy.TD
+		status.CurrentBlock, status.GenesisBlock = legacy.CurrentBlock, legacy.GenesisBlock
 	}
 	if status.GenesisBlock != genesis {
 		return errResp(ErrGenesisBlockMismatch, "%x (!= %x)", status.GenesisBlock, genesis)
@@ -289,6 +333,11 @@ func (p *peer) readStatus(network int, status *statusData, genesis common.Hash)
 	if int(status.ProtocolVersion) != p.version {
 		return errResp(ErrProtocolVersionMismatch, "%d (!= %d)", status.ProtocolVersion, p.version)
 	}
+	if p.version >= eth65 {
+		if err := forkFilter(status.ForkID); err != nil {
+			return errResp(ErrForkIDRejected, "%v: %v", status.ForkID, err)
+		}
+	}
 	return nil
 }
 
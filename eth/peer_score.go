@@ -0,0 +1,116 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"sync"
+	"time"
+)
+
+// Penalties lowering the score of misbehaving peers.
+const (
+	penaltyInvalidBlock = 50  // Propagated a block failing validation
+	penaltyBadRewards   = 100 // Propagated a block whose NSignups or TotalWei don't match its transactions
+	penaltyUseless      = 10  // Dropped by the downloader for useless, stalled or missing responses
+	penaltyProtocol     = 25  // Sent a malformed or unexpected message
+)
+
+var (
+	scoreBanThreshold = -100             // Score at which a peer is disconnected and banned
+	scoreRecovery     = time.Minute      // Time for a peer to recover a point of its score
+	peerBanDuration   = 30 * time.Minute // Time a banned peer is refused
+)
+
+// peerScore is the reputation of a peer, zero for well behaving ones and
+// negative once penalized, recovering over time.
+type peerScore struct {
+	score   int
+	updated time.Time // Time of the last penalty
+}
+
+// current returns the score recovered since the last penalty.
+func (s *peerScore) current(now time.Time) int {
+	if score := s.score + int(now.Sub(s.updated)/scoreRecovery); score < 0 {
+		return score
+	}
+	return 0
+}
+
+// peerScores tracks the reputation of the peers across reconnections, banning
+// the ones whose score falls to the threshold for a while.
+type peerScores struct {
+	scores map[string]*peerScore // Scores of the penalized peers not yet recovered
+	bans   map[string]time.Time  // Expiry of the bans of the peers
+	lock   sync.Mutex
+}
+
+func newPeerScores() *peerScores {
+	return &peerScores{
+		scores: make(map[string]*peerScore),
+		bans:   make(map[string]time.Time),
+	}
+}
+
+// Score returns the current score of a peer.
+func (ps *peerScores) Score(id string) int {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	if s := ps.scores[id]; s != nil {
+		return s.current(time.Now())
+	}
+	return 0
+}
+
+// penalize lowers the score of a peer, banning it if the score falls to the
+// threshold. It returns whether the peer got banned.
+func (ps *peerScores) penalize(id string, penalty int) bool {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	now := time.Now()
+	for other, s := range ps.scores {
+		if s.current(now) == 0 {
+			delete(ps.scores, other)
+		}
+	}
+	s := ps.scores[id]
+	if s == nil {
+		s = new(peerScore)
+		ps.scores[id] = s
+	}
+	s.score, s.updated = s.current(now)-penalty, now
+	if s.score > scoreBanThreshold {
+		return false
+	}
+	delete(ps.scores, id)
+	ps.bans[id] = now.Add(peerBanDuration)
+	return true
+}
+
+// banned returns whether a peer is banned, lifting expired bans.
+func (ps *peerScores) banned(id string) bool {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	expiry, ok := ps.bans[id]
+	if ok && time.Now().After(expiry) {
+		delete(ps.bans, id)
+		return false
+	}
+	return ok
+}
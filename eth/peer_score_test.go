@@ -0,0 +1,117 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ur-technology/go-ur/core"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/p2p"
+)
+
+// Tests that penalties accumulate into a ban once the threshold is reached, and
+// that scores recover and bans expire over time.
+func TestPeerScores(t *testing.T) {
+	scores := newPeerScores()
+
+	if scores.penalize("a", penaltyInvalidBlock) {
+		t.Fatalf("peer banned after a single invalid block")
+	}
+	if score := scores.Score("a"); score != -penaltyInvalidBlock {
+		t.Errorf("score mismatch: have %d, want %d", score, -penaltyInvalidBlock)
+	}
+	if scores.Score("b") != 0 {
+		t.Errorf("unpenalized peer has a score")
+	}
+	if !scores.penalize("a", penaltyInvalidBlock) {
+		t.Fatalf("peer not banned after reaching the threshold")
+	}
+	if !scores.banned("a") || scores.banned("b") {
+		t.Errorf("ban mismatch: have a=%v b=%v, want a=true b=false", scores.banned("a"), scores.banned("b"))
+	}
+	// Bad reward fields ban right away
+	if !scores.penalize("b", penaltyBadRewards) {
+		t.Errorf("peer not banned for bad reward fields")
+	}
+	// Scores recover, bans expire
+	scores.penalize("c", penaltyProtocol)
+	scores.scores["c"].updated = time.Now().Add(-10 * scoreRecovery)
+	if score := scores.Score("c"); score != 10-penaltyProtocol {
+		t.Errorf("recovered score mismatch: have %d, want %d", score, 10-penaltyProtocol)
+	}
+	scores.bans["a"] = time.Now().Add(-time.Second)
+	if scores.banned("a") {
+		t.Errorf("expired ban still effective")
+	}
+}
+
+// Tests that blocks with bad reward fields imported by the downloader are held
+// against the peer they were synced from.
+func TestSyncedBadRewardsPenalized(t *testing.T) {
+	pm := newTestProtocolManagerMust(t, false, 0, nil, nil)
+	defer pm.Stop()
+
+	blocks, _ := core.GenerateChain(pm.chainconfig, pm.blockchain, pm.blockchain.CurrentBlock(), pm.chaindb, 1, nil)
+	header := blocks[0].Header()
+	header.NSignups = new(big.Int).Add(header.NSignups, big.NewInt(1))
+
+	bad := types.NewBlockWithHeader(header).WithBody(blocks[0].Transactions(), blocks[0].Uncles())
+	bad.ReceivedFrom = "synced"
+
+	if _, err := pm.insertChain(types.Blocks{bad}); !core.IsRewardErr(err) {
+		t.Fatalf("import error mismatch: have %v, want reward error", err)
+	}
+	if !pm.scores.banned("synced") {
+		t.Errorf("peer not banned for bad reward fields")
+	}
+}
+
+// Tests that malformed messages are held against the peer sending them, while
+// failures on the local side, such as a reply that can't be sent, aren't.
+func TestProtocolViolationPenalized(t *testing.T) {
+	pm := newTestProtocolManagerMust(t, false, 0, nil, nil)
+	defer pm.Stop()
+
+	wait := func(errc <-chan error) {
+		select {
+		case <-errc:
+		case <-time.After(time.Second):
+			t.Fatalf("peer not disconnected")
+		}
+	}
+	// Request headers and go away before the reply is sent
+	gone, errc := newTestPeer("gone", eth63, pm, true)
+	p2p.Send(gone.app, GetBlockHeadersMsg, &getBlockHeadersData{Origin: hashOrNumber{Number: 0}, Amount: 1})
+	gone.close()
+	wait(errc)
+
+	if score := pm.scores.Score(gone.id); score != 0 {
+		t.Errorf("failed reply penalized: have score %d, want 0", score)
+	}
+	// Propagate a block that can't be decoded
+	bad, errc := newTestPeer("bad", eth63, pm, true)
+	defer bad.close()
+	p2p.Send(bad.app, NewBlockMsg, []interface{}{"junk"})
+	wait(errc)
+
+	if score := pm.scores.Score(bad.id); score != -penaltyProtocol {
+		t.Errorf("malformed block score mismatch: have %d, want %d", score, -penaltyProtocol)
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"math/big"
 
 	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core/forkid"
 	"github.com/ur-technology/go-ur/core/types"
 	"github.com/ur-technology/go-ur/rlp"
 )
@@ -30,16 +31,18 @@ import (
 const (
 	eth62 = 62
 	eth63 = 63
+	eth64 = 64
+	eth65 = 65
 )
 
 // Official short name of the protocol used during capability negotiation.
 var ProtocolName = "ur"
 
 // Supported versions of the eth protocol (first is primary).
-var ProtocolVersions = []uint{eth63, eth62}
+var ProtocolVersions = []uint{eth65, eth64, eth63, eth62}
 
 // Number of implemented message corresponding to different protocol versions.
-var ProtocolLengths = []uint64{17, 8}
+var ProtocolLengths = []uint64{18, 18, 17, 8}
 
 const (
 	NetworkId          = 1
@@ -63,6 +66,9 @@ const (
 	NodeDataMsg    = 0x0e
 	GetReceiptsMsg = 0x0f
 	ReceiptsMsg    = 0x10
+
+	// Protocol messages belonging to eth/64
+	NewCompactBlockMsg = 0x11
 )
 
 type errCode int
@@ -77,6 +83,7 @@ const (
 	ErrNoStatusMsg
 	ErrExtraStatusMsg
 	ErrSuspendedPeer
+	ErrForkIDRejected
 )
 
 func (e errCode) String() string {
@@ -94,12 +101,16 @@ var errorToString = map[int]string{
 	ErrNoStatusMsg:             "No status message",
 	ErrExtraStatusMsg:          "Extra status message",
 	ErrSuspendedPeer:           "Suspended peer",
+	ErrForkIDRejected:          "Fork ID rejected",
 }
 
 type txPool interface {
 	// AddBatch should add the given transactions to the pool.
 	AddBatch([]*types.Transaction)
 
+	// Get should return the pooled transaction with the given hash, or nil.
+	Get(hash common.Hash) *types.Transaction
+
 	// Pending should return pending transactions.
 	// The slice should be modifiable by the caller.
 	Pending() map[common.Address]types.Transactions
@@ -114,6 +125,17 @@ type statusData struct {
 	GenesisBlock    common.Hash
 }
 
+// statusData65 is the network packet for the status message since eth/65, which
+// also carries the fork identifier of the chain.
+type statusData65 struct {
+	ProtocolVersion uint32
+	NetworkId       uint32
+	TD              *big.Int
+	CurrentBlock    common.Hash
+	GenesisBlock    common.Hash
+	ForkID          forkid.ID
+}
+
 // newBlockHashesData is the network packet for the block announcements.
 type newBlockHashesData []struct {
 	Hash   common.Hash // Hash of one particular block being announced
@@ -170,6 +192,16 @@ type newBlockData struct {
 	TD    *big.Int
 }
 
+// compactBlockData is the network packet for the block propagation message that
+// replaces transactions the recipient is known to have with their hashes.
+type compactBlockData struct {
+	Header   *types.Header
+	Uncles   []*types.Header
+	TxHashes []common.Hash        // Hashes of all the block's transactions, in block order
+	Txs      []*types.Transaction // Transactions the recipient isn't known to have, in block order
+	TD       *big.Int
+}
+
 // blockBody represents the data content of a single block.
 type blockBody struct {
 	Transactions []*types.Transaction // Transactions contained within a block
@@ -18,11 +18,13 @@ package eth
 
 import (
 	"fmt"
+	"math/big"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core/forkid"
 	"github.com/ur-technology/go-ur/core/types"
 	"github.com/ur-technology/go-ur/crypto"
 	"github.com/ur-technology/go-ur/p2p"
@@ -39,6 +41,7 @@ var testAccount, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6
 // Tests that handshake failures are detected and reported correctly.
 func TestStatusMsgErrors62(t *testing.T) { testStatusMsgErrors(t, 62) }
 func TestStatusMsgErrors63(t *testing.T) { testStatusMsgErrors(t, 63) }
+func TestStatusMsgErrors64(t *testing.T) { testStatusMsgErrors(t, 64) }
 
 func testStatusMsgErrors(t *testing.T, protocol int) {
 	pm := newTestProtocolManagerMust(t, false, 0, nil, nil)
@@ -88,9 +91,51 @@ func testStatusMsgErrors(t *testing.T, protocol int) {
 	}
 }
 
+// Tests that the fork identifier is exchanged since eth/65 and that peers on
+// other chains or fork schedules are rejected.
+func TestStatusMsgErrors65(t *testing.T) {
+	pm := newTestProtocolManagerMust(t, false, 0, nil, nil)
+	td, currentBlock, genesis := pm.blockchain.Status()
+	defer pm.Stop()
+
+	forkID := forkid.NewID(pm.chainconfig, genesis, pm.blockchain.CurrentHeader().Number.Uint64())
+	tests := []struct {
+		code      uint64
+		data      interface{}
+		wantError error
+	}{
+		{
+			code: StatusMsg, data: statusData65{eth65, 999, td, currentBlock, genesis, forkID},
+			wantError: errResp(ErrNetworkIdMismatch, "999 (!= 1)"),
+		},
+		{
+			code: StatusMsg, data: statusData65{eth65, NetworkId, td, currentBlock, genesis, forkid.ID{Hash: [4]byte{1, 2, 3, 4}}},
+			wantError: errResp(ErrForkIDRejected, "01020304/0: %v", forkid.ErrLocalIncompatibleOrStale),
+		},
+	}
+	for i, test := range tests {
+		p, errc := newTestPeer("peer", eth65, pm, false)
+		go p2p.Send(p.app, test.code, test.data)
+
+		select {
+		case err := <-errc:
+			if err == nil {
+				t.Errorf("test %d: protocol returned nil error, want %q", i, test.wantError)
+			} else if err.Error() != test.wantError.Error() {
+				t.Errorf("test %d: wrong error: got %q, want %q", i, err, test.wantError)
+			}
+		case <-time.After(2 * time.Second):
+			t.Errorf("protocol did not shut down withing 2 seconds")
+		}
+		p.close()
+	}
+}
+
 // This test checks that received transactions are added to the local pool.
 func TestRecvTransactions62(t *testing.T) { testRecvTransactions(t, 62) }
 func TestRecvTransactions63(t *testing.T) { testRecvTransactions(t, 63) }
+func TestRecvTransactions64(t *testing.T) { testRecvTransactions(t, 64) }
+func TestRecvTransactions65(t *testing.T) { testRecvTransactions(t, 65) }
 
 func testRecvTransactions(t *testing.T, protocol int) {
 	txAdded := make(chan []*types.Transaction)
@@ -119,6 +164,7 @@ func testRecvTransactions(t *testing.T, protocol int) {
 // This test checks that pending transactions are sent.
 func TestSendTransactions62(t *testing.T) { testSendTransactions(t, 62) }
 func TestSendTransactions63(t *testing.T) { testSendTransactions(t, 63) }
+func TestSendTransactions64(t *testing.T) { testSendTransactions(t, 64) }
 
 func testSendTransactions(t *testing.T, protocol int) {
 	pm := newTestProtocolManagerMust(t, false, 0, nil, nil)
@@ -217,3 +263,64 @@ func TestGetBlockHeadersDataEncodeDecode(t *testing.T) {
 		}
 	}
 }
+
+// Tests that compact blocks omit transactions known by the peer and that they
+// can be reconstructed from the local pool on the receiving side.
+func TestCompactBlockPropagation(t *testing.T) {
+	pm := newTestProtocolManagerMust(t, false, 0, nil, nil)
+	p, _ := newTestPeer("peer", eth64, pm, true)
+	defer pm.Stop()
+	defer p.close()
+
+	txs := types.Transactions{
+		newTestTransaction(testAccount, 0, 0),
+		newTestTransaction(testAccount, 1, 0),
+		newTestTransaction(testAccount, 2, 0),
+	}
+	block := types.NewBlock(&types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(1)}, txs, nil, nil)
+
+	// Only the transaction unknown to the peer should be sent in full
+	p.MarkTransaction(txs[0].Hash())
+	p.MarkTransaction(txs[1].Hash())
+	go p.SendNewCompactBlock(block, big.NewInt(2))
+
+	msg, err := p.app.ReadMsg()
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if msg.Code != NewCompactBlockMsg {
+		t.Fatalf("message code mismatch: have %d, want %d", msg.Code, NewCompactBlockMsg)
+	}
+	var request compactBlockData
+	if err := msg.Decode(&request); err != nil {
+		t.Fatalf("failed to decode compact block: %v", err)
+	}
+	if len(request.TxHashes) != len(txs) {
+		t.Fatalf("hash count mismatch: have %d, want %d", len(request.TxHashes), len(txs))
+	}
+	if len(request.Txs) != 1 || request.Txs[0].Hash() != txs[2].Hash() {
+		t.Fatalf("unexpected full transactions: %v", request.Txs)
+	}
+
+	// Reconstruction must fail until the referenced transactions are pooled
+	if _, err := pm.reconstructCompactBlock(&request); err == nil {
+		t.Fatalf("reconstructed block with missing transactions")
+	}
+	pm.txpool.AddBatch(txs[:2])
+
+	rebuilt, err := pm.reconstructCompactBlock(&request)
+	if err != nil {
+		t.Fatalf("failed to reconstruct block: %v", err)
+	}
+	if rebuilt.Hash() != block.Hash() {
+		t.Errorf("block hash mismatch: have %x, want %x", rebuilt.Hash(), block.Hash())
+	}
+	if rebuilt.Transactions().Len() != len(txs) {
+		t.Errorf("transaction count mismatch: have %d, want %d", rebuilt.Transactions().Len(), len(txs))
+	}
+	// Uncles not matching the uncle hash of the header must be rejected
+	request.Uncles = []*types.Header{{Number: big.NewInt(0), Difficulty: big.NewInt(1)}}
+	if _, err := pm.reconstructCompactBlock(&request); err == nil {
+		t.Errorf("reconstructed block with mismatching uncles")
+	}
+}
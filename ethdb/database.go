@@ -17,6 +17,8 @@
 package ethdb
 
 import (
+	"errors"
+	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -27,10 +29,11 @@ import (
 	"github.com/ur-technology/go-ur/logger/glog"
 	"github.com/ur-technology/go-ur/metrics"
 	"github.com/syndtr/goleveldb/leveldb"
-	"github.com/syndtr/goleveldb/leveldb/errors"
+	lerrors "github.com/syndtr/goleveldb/leveldb/errors"
 	"github.com/syndtr/goleveldb/leveldb/filter"
 	"github.com/syndtr/goleveldb/leveldb/iterator"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/storage"
 
 	gometrics "github.com/rcrowley/go-metrics"
 )
@@ -52,8 +55,9 @@ var handleRatio = map[string]float64{
 }
 
 type LDBDatabase struct {
-	fn string      // filename for reporting
-	db *leveldb.DB // LevelDB instance
+	fn   string          // filename for reporting
+	db   *leveldb.DB     // LevelDB instance
+	stor storage.Storage // Storage of the LevelDB files, closed along with the instance
 
 	getTimer       gometrics.Timer // Timer for measuring the database get request counts and latencies
 	putTimer       gometrics.Timer // Timer for measuring the database put request counts and latencies
@@ -67,10 +71,64 @@ type LDBDatabase struct {
 
 	quitLock sync.Mutex      // Mutex protecting the quit channel access
 	quitChan chan chan error // Quit channel to stop the metrics collection before closing the database
+
+	freezer *Freezer  // Ancient store of immutable items, nil if none attached
+	cipher  *dbCipher // Cipher encrypting the database files, nil if plaintext
 }
 
 // NewLDBDatabase returns a LevelDB wrapped object.
 func NewLDBDatabase(file string, cache int, handles int) (*LDBDatabase, error) {
+	return openLDBDatabase(file, cache, handles, nil)
+}
+
+// NewEncryptedLDBDatabase returns a LevelDB wrapped object whose files, along with
+// those of any ancient store attached, are encrypted at rest with a key derived
+// from the given secret. New databases are encrypted on creation, existing ones
+// must have been created encrypted with the same secret.
+func NewEncryptedLDBDatabase(file string, cache int, handles int, secret []byte) (*LDBDatabase, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("empty database key")
+	}
+	return openLDBDatabase(file, cache, handles, secret)
+}
+
+// CheckLDBDatabase opens an existing LevelDB database read only, decrypting it
+// with the key derived from secret if given, and closes it again, returning why
+// it can't be opened if so. Encrypted databases checked without a secret fail
+// with ErrDatabaseEncrypted, plaintext ones checked with one with
+// ErrDatabaseNotEncrypted.
+func CheckLDBDatabase(file string, secret []byte) error {
+	var cipher *dbCipher
+	if secret != nil {
+		// Don't let the cipher initialize the encryption of a plaintext database
+		if _, err := os.Stat(filepath.Join(file, encryptionFile)); err != nil {
+			return ErrDatabaseNotEncrypted
+		}
+		var err error
+		if cipher, err = openCipher(file, secret); err != nil {
+			return err
+		}
+	} else if err := checkPlaintext(file); err != nil {
+		return err
+	}
+	stor, err := storage.OpenFile(file, true)
+	if err != nil {
+		return err
+	}
+	defer stor.Close()
+
+	if cipher != nil {
+		stor = &encryptedStorage{Storage: stor, cipher: cipher}
+	}
+	db, err := leveldb.Open(stor, &opt.Options{ReadOnly: true, ErrorIfMissing: true})
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
+
+// openLDBDatabase opens a LevelDB database, encrypted if a secret is given.
+func openLDBDatabase(file string, cache int, handles int, secret []byte) (*LDBDatabase, error) {
 	// Calculate the cache and file descriptor allowance for this particular database
 	cache = int(float64(cache) * cacheRatio[filepath.Base(file)])
 	if cache < 16 {
@@ -82,23 +140,43 @@ func NewLDBDatabase(file string, cache int, handles int) (*LDBDatabase, error) {
 	}
 	glog.V(logger.Info).Infof("Allotted %dMB cache and %d file handles to %s", cache, handles, file)
 
+	// Set up the encryption of the files, if requested
+	var cipher *dbCipher
+	if secret != nil {
+		var err error
+		if cipher, err = openCipher(file, secret); err != nil {
+			return nil, err
+		}
+	} else if err := checkPlaintext(file); err != nil {
+		return nil, err
+	}
+	stor, err := storage.OpenFile(file, false)
+	if err != nil {
+		return nil, err
+	}
+	if cipher != nil {
+		stor = &encryptedStorage{Storage: stor, cipher: cipher}
+	}
 	// Open the db and recover any potential corruptions
-	db, err := leveldb.OpenFile(file, &opt.Options{
+	db, err := leveldb.Open(stor, &opt.Options{
 		OpenFilesCacheCapacity: handles,
 		BlockCacheCapacity:     cache / 2 * opt.MiB,
 		WriteBuffer:            cache / 4 * opt.MiB, // Two of these are used internally
 		Filter:                 filter.NewBloomFilter(10),
 	})
-	if _, corrupted := err.(*errors.ErrCorrupted); corrupted {
-		db, err = leveldb.RecoverFile(file, nil)
+	if _, corrupted := err.(*lerrors.ErrCorrupted); corrupted {
+		db, err = leveldb.Recover(stor, nil)
 	}
 	// (Re)check for errors and abort if opening of the db failed
 	if err != nil {
+		stor.Close()
 		return nil, err
 	}
 	return &LDBDatabase{
-		fn: file,
-		db: db,
+		fn:     file,
+		db:     db,
+		stor:   stor,
+		cipher: cipher,
 	}, nil
 }
 
@@ -154,6 +232,39 @@ func (self *LDBDatabase) Delete(key []byte) error {
 	return self.db.Delete(key, nil)
 }
 
+// OpenFreezer attaches the ancient store in dir, holding the given tables, to
+// the database. It is closed along with the database.
+func (db *LDBDatabase) OpenFreezer(dir string, tables []string) error {
+	freezer, err := newFreezer(dir, tables, db.cipher)
+	if err != nil {
+		return err
+	}
+	db.freezer = freezer
+	return nil
+}
+
+// Freezer returns the attached ancient store, nil if none.
+func (db *LDBDatabase) Freezer() *Freezer {
+	return db.freezer
+}
+
+// Ancients implements AncientReader, returning the number of items in the
+// ancient store, 0 if none is attached.
+func (db *LDBDatabase) Ancients() uint64 {
+	if db.freezer == nil {
+		return 0
+	}
+	return db.freezer.Items()
+}
+
+// Ancient implements AncientReader, retrieving an item from the ancient store.
+func (db *LDBDatabase) Ancient(table string, item uint64) ([]byte, error) {
+	if db.freezer == nil {
+		return nil, errOutOfBounds
+	}
+	return db.freezer.Retrieve(table, item)
+}
+
 func (self *LDBDatabase) NewIterator() iterator.Iterator {
 	return self.db.NewIterator(nil, nil)
 }
@@ -170,7 +281,15 @@ func (self *LDBDatabase) Close() {
 			glog.V(logger.Error).Infof("metrics failure in '%s': %v\n", self.fn, err)
 		}
 	}
+	if self.freezer != nil {
+		if err := self.freezer.Close(); err != nil {
+			glog.V(logger.Error).Infof("error closing freezer of db %s: %v", self.fn, err)
+		}
+	}
 	err := self.db.Close()
+	if serr := self.stor.Close(); err == nil {
+		err = serr
+	}
 	if glog.V(logger.Error) {
 		if err == nil {
 			glog.Infoln("closed db:", self.fn)
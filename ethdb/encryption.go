@@ -0,0 +1,513 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethdb
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb/storage"
+	"github.com/ur-technology/go-ur/crypto"
+	"golang.org/x/crypto/scrypt"
+)
+
+var (
+	// ErrDatabaseEncrypted is returned when opening an encrypted database
+	// without a key.
+	ErrDatabaseEncrypted = errors.New("database is encrypted, key required")
+
+	// ErrDatabaseNotEncrypted is returned when opening an existing plaintext
+	// database with a key.
+	ErrDatabaseNotEncrypted = errors.New("database is not encrypted")
+
+	// ErrDatabaseKey is returned when opening an encrypted database with a key
+	// other than the one it was created with.
+	ErrDatabaseKey = errors.New("invalid database key")
+)
+
+const (
+	// encryptionFile is the file in the database directory holding the key
+	// derivation parameters of an encrypted database.
+	encryptionFile = "ENCRYPTION"
+
+	// cipherHeaderSize is the size of the random IV each encrypted file starts with.
+	cipherHeaderSize = aes.BlockSize
+
+	// Scrypt parameters deriving the encryption key from the user's secret.
+	encryptionScryptN = 1 << 15
+	encryptionScryptR = 8
+	encryptionScryptP = 1
+)
+
+// encryptionParams is the content of the encryption file of a database.
+type encryptionParams struct {
+	Cipher string `json:"cipher"`
+	KDF    string `json:"kdf"`
+	Salt   string `json:"salt"`
+	N      int    `json:"n"`
+	R      int    `json:"r"`
+	P      int    `json:"p"`
+	Check  string `json:"check"` // Hash of the derived key, telling wrong keys apart
+}
+
+// dbCipher encrypts database files with AES-256 in counter mode. Every file
+// starts with its own random IV so that keystreams are never reused, freezer
+// files deriving new ones for the content they rewrite (see freezerGenerations),
+// and the counter mode allows decrypting from any offset, as needed by the random
+// reads of LevelDB tables and freezer items. Integrity is left to the checksums
+// of the file formats.
+type dbCipher struct {
+	block cipher.Block
+}
+
+// openCipher derives the cipher of the database in dir from the user's secret,
+// initializing the encryption of a new database.
+func openCipher(dir string, secret []byte) (*dbCipher, error) {
+	path := filepath.Join(dir, encryptionFile)
+
+	var params encryptionParams
+	blob, err := ioutil.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(blob, &params); err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", path, err)
+		}
+		if params.Cipher != "aes-256-ctr" || params.KDF != "scrypt" {
+			return nil, fmt.Errorf("unsupported database encryption: %s/%s", params.Cipher, params.KDF)
+		}
+	case os.IsNotExist(err):
+		// Refuse to mix encrypted files into an existing plaintext database
+		if _, err := os.Stat(filepath.Join(dir, "CURRENT")); err == nil {
+			return nil, ErrDatabaseNotEncrypted
+		}
+		salt := make([]byte, 32)
+		if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+			return nil, err
+		}
+		params = encryptionParams{
+			Cipher: "aes-256-ctr",
+			KDF:    "scrypt",
+			Salt:   hex.EncodeToString(salt),
+			N:      encryptionScryptN,
+			R:      encryptionScryptR,
+			P:      encryptionScryptP,
+		}
+	default:
+		return nil, err
+	}
+	salt, err := hex.DecodeString(params.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", path, err)
+	}
+	key, err := scrypt.Key(secret, salt, params.N, params.R, params.P, 32)
+	if err != nil {
+		return nil, err
+	}
+	check := hex.EncodeToString(crypto.Keccak256(key))
+	if params.Check == "" {
+		params.Check = check
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+		blob, _ := json.MarshalIndent(params, "", "  ")
+		if err := ioutil.WriteFile(path, blob, 0600); err != nil {
+			return nil, err
+		}
+	} else if params.Check != check {
+		return nil, ErrDatabaseKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &dbCipher{block: block}, nil
+}
+
+// checkPlaintext returns an error if the database in dir is encrypted.
+func checkPlaintext(dir string) error {
+	if _, err := os.Stat(filepath.Join(dir, encryptionFile)); err == nil {
+		return ErrDatabaseEncrypted
+	}
+	return nil
+}
+
+// newIV generates the random header of a new encrypted file.
+func newIV() ([]byte, error) {
+	iv := make([]byte, cipherHeaderSize)
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, err
+	}
+	return iv, nil
+}
+
+// xor en- or decrypts buf in place, buf being located at the given offset of
+// the file content following the IV header.
+func (c *dbCipher) xor(iv []byte, buf []byte, offset int64) {
+	// Advance the big endian counter to the block the offset falls in
+	var ctr [aes.BlockSize]byte
+	copy(ctr[:], iv)
+	for i, blocks := aes.BlockSize-1, uint64(offset/aes.BlockSize); i >= 0 && blocks > 0; i-- {
+		sum := uint64(ctr[i]) + blocks&0xff
+		ctr[i] = byte(sum)
+		blocks = blocks>>8 + sum>>8
+	}
+	stream := cipher.NewCTR(c.block, ctr[:])
+
+	// Skip the keystream preceding the offset within the block
+	if skip := int(offset % aes.BlockSize); skip > 0 {
+		var pad [aes.BlockSize]byte
+		stream.XORKeyStream(pad[:skip], pad[:skip])
+	}
+	stream.XORKeyStream(buf, buf)
+}
+
+// encryptedStorage is a LevelDB storage encrypting the content of the journal,
+// manifest and table files. File names stay readable.
+type encryptedStorage struct {
+	storage.Storage
+	cipher *dbCipher
+}
+
+// Log drops the informational messages of LevelDB, which would otherwise end up
+// in the plaintext LOG file along with the key ranges of the tables.
+func (s *encryptedStorage) Log(str string) {}
+
+// Open opens a file for reading, loading its IV.
+func (s *encryptedStorage) Open(fd storage.FileDesc) (storage.Reader, error) {
+	r, err := s.Storage.Open(fd)
+	if err != nil {
+		return nil, err
+	}
+	iv := make([]byte, cipherHeaderSize)
+	if _, err := r.ReadAt(iv, 0); err != nil {
+		r.Close()
+		return nil, err
+	}
+	return &encryptedReader{Reader: r, cipher: s.cipher, iv: iv}, nil
+}
+
+// Create creates a file for writing, starting it with a fresh IV.
+func (s *encryptedStorage) Create(fd storage.FileDesc) (storage.Writer, error) {
+	iv, err := newIV()
+	if err != nil {
+		return nil, err
+	}
+	w, err := s.Storage.Create(fd)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(iv); err != nil {
+		w.Close()
+		return nil, err
+	}
+	return &encryptedWriter{Writer: w, cipher: s.cipher, iv: iv}, nil
+}
+
+// encryptedReader decrypts a LevelDB file being read.
+type encryptedReader struct {
+	storage.Reader
+	cipher *dbCipher
+	iv     []byte
+	pos    int64 // Position of sequential reads within the content
+}
+
+// ReadAt reads and decrypts the content at the given offset.
+func (r *encryptedReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.Reader.ReadAt(p, off+cipherHeaderSize)
+	r.cipher.xor(r.iv, p[:n], off)
+	return n, err
+}
+
+// Read reads and decrypts the content at the current position.
+func (r *encryptedReader) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.pos)
+	r.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek moves the position of sequential reads within the content.
+func (r *encryptedReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		size, err := r.Reader.Seek(0, io.SeekEnd)
+		if err != nil {
+			return 0, err
+		}
+		offset += size - cipherHeaderSize
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.pos = offset
+	return offset, nil
+}
+
+// encryptedWriter encrypts a LevelDB file being written.
+type encryptedWriter struct {
+	storage.Writer
+	cipher *dbCipher
+	iv     []byte
+	pos    int64 // Size of the content written so far
+}
+
+// Write encrypts and appends p to the file.
+func (w *encryptedWriter) Write(p []byte) (int, error) {
+	buf := make([]byte, len(p))
+	copy(buf, p)
+	w.cipher.xor(w.iv, buf, w.pos)
+
+	n, err := w.Writer.Write(buf)
+	w.pos += int64(n)
+	return n, err
+}
+
+// freezerFile is a flat file of a freezer table.
+type freezerFile interface {
+	io.ReaderAt
+	io.WriterAt
+	Stat() (os.FileInfo, error)
+	Truncate(size int64) error
+	Sync() error
+	Close() error
+}
+
+// openFreezerFile opens or creates a freezer file, encrypted if cipher is set.
+func openFreezerFile(path string, cipher *dbCipher) (freezerFile, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if cipher == nil {
+		return file, nil
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	iv := make([]byte, cipherHeaderSize)
+	if stat.Size() == 0 {
+		if iv, err = newIV(); err == nil {
+			_, err = file.WriteAt(iv, 0)
+		}
+	} else {
+		_, err = file.ReadAt(iv, 0)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	f := &encryptedFile{File: file, cipher: cipher, iv: iv, genPath: path + generationsSuffix}
+	if err := f.loadGenerations(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	// Whatever follows the content may have been written before a crash, start
+	// a new generation for it
+	if err := f.startGeneration(encryptedFileInfo{stat}.Size()); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// generationsSuffix is appended to the name of an encrypted freezer file to get
+// the name of the file tracking its keystream generations.
+const generationsSuffix = ".gen"
+
+// freezerGenerations tracks which keystream generation every region of the
+// content of an encrypted freezer file is encrypted with. Freezer files are
+// rewritten at the same offsets after being truncated, and a keystream must not
+// encrypt two different contents, so every truncation, as well as every reopening
+// of the file, starts a fresh generation from the end of the content.
+type freezerGenerations struct {
+	Next     uint64           `json:"next"`     // Generation to start next
+	Segments []freezerSegment `json:"segments"` // Regions of the content, by ascending offset
+}
+
+// freezerSegment is a region of an encrypted freezer file written with the same
+// keystream generation, extending up to the next region.
+type freezerSegment struct {
+	Offset int64  `json:"offset"`
+	Gen    uint64 `json:"gen"`
+}
+
+// encryptedFile is an encrypted freezer file, its content following the IV.
+type encryptedFile struct {
+	*os.File
+	cipher *dbCipher
+	iv     []byte
+
+	genPath string             // File the keystream generations are stored in
+	gens    freezerGenerations // Keystream generations of the content regions
+	lock    sync.RWMutex       // Protects the generations
+}
+
+// loadGenerations reads the keystream generations of the file. Files encrypted
+// before generations were tracked are made of a single one, keyed by the IV.
+func (f *encryptedFile) loadGenerations() error {
+	blob, err := ioutil.ReadFile(f.genPath)
+	switch {
+	case os.IsNotExist(err):
+		f.gens = freezerGenerations{Next: 1, Segments: []freezerSegment{{0, 0}}}
+		return nil
+	case err != nil:
+		return err
+	}
+	if err := json.Unmarshal(blob, &f.gens); err != nil {
+		return fmt.Errorf("invalid %s: %v", f.genPath, err)
+	}
+	if len(f.gens.Segments) == 0 || f.gens.Segments[0].Offset != 0 {
+		return fmt.Errorf("invalid %s: content not covered", f.genPath)
+	}
+	return nil
+}
+
+// startGeneration encrypts the content from the given offset onwards with a new
+// keystream generation, storing the generations before anything is written with
+// it. The lock must be held, or the file not yet shared.
+func (f *encryptedFile) startGeneration(offset int64) error {
+	segments := f.gens.Segments
+	for len(segments) > 1 && segments[len(segments)-1].Offset >= offset {
+		segments = segments[:len(segments)-1]
+	}
+	gen := freezerSegment{Offset: offset, Gen: f.gens.Next}
+	if segments[len(segments)-1].Offset >= offset {
+		segments = []freezerSegment{gen}
+	} else {
+		segments = append(segments, gen)
+	}
+	gens := freezerGenerations{Next: f.gens.Next + 1, Segments: segments}
+
+	blob, err := json.Marshal(gens)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(f.genPath+".tmp", blob, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(f.genPath+".tmp", f.genPath); err != nil {
+		return err
+	}
+	f.gens = gens
+	return nil
+}
+
+// genIV returns the IV of the keystream of a generation, the first one being the
+// file's own.
+func (f *encryptedFile) genIV(gen uint64) []byte {
+	if gen == 0 {
+		return f.iv
+	}
+	var enc [8]byte
+	binary.BigEndian.PutUint64(enc[:], gen)
+	return crypto.Keccak256(f.iv, enc[:])[:cipherHeaderSize]
+}
+
+// xor en- or decrypts buf in place, located at the given offset of the content,
+// with the keystreams of the generations its regions were written with.
+func (f *encryptedFile) xor(buf []byte, off int64) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	segments := f.gens.Segments
+	for i := len(segments) - 1; i >= 0 && len(buf) > 0; i-- {
+		start := segments[i].Offset
+		if start >= off+int64(len(buf)) {
+			continue
+		}
+		if start < off {
+			start = off
+		}
+		f.cipher.xor(f.genIV(segments[i].Gen), buf[start-off:], start)
+		buf = buf[:start-off]
+	}
+}
+
+// ReadAt reads and decrypts the content at the given offset.
+func (f *encryptedFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := f.File.ReadAt(p, off+cipherHeaderSize)
+	f.xor(p[:n], off)
+	return n, err
+}
+
+// WriteAt encrypts and writes p at the given offset of the content.
+func (f *encryptedFile) WriteAt(p []byte, off int64) (int, error) {
+	buf := make([]byte, len(p))
+	copy(buf, p)
+	f.xor(buf, off)
+	return f.File.WriteAt(buf, off+cipherHeaderSize)
+}
+
+// Truncate changes the size of the content. Content cut off starts a new
+// keystream generation, as it will be overwritten.
+func (f *encryptedFile) Truncate(size int64) error {
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if size < stat.Size() {
+		f.lock.Lock()
+		err := f.startGeneration(size)
+		f.lock.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return f.File.Truncate(size + cipherHeaderSize)
+}
+
+// Stat returns the file info, reporting the size of the content.
+func (f *encryptedFile) Stat() (os.FileInfo, error) {
+	stat, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return encryptedFileInfo{stat}, nil
+}
+
+// encryptedFileInfo is the file info of an encrypted file.
+type encryptedFileInfo struct {
+	os.FileInfo
+}
+
+// Size returns the size of the content following the IV.
+func (fi encryptedFileInfo) Size() int64 {
+	if size := fi.FileInfo.Size() - cipherHeaderSize; size > 0 {
+		return size
+	}
+	return 0
+}
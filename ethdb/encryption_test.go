@@ -0,0 +1,231 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethdb
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Tests that en- or decrypting at arbitrary offsets matches a single keystream,
+// including across carries of the counter.
+func TestCipherOffsets(t *testing.T) {
+	block, _ := aes.NewCipher(make([]byte, 32))
+	c := &dbCipher{block: block}
+
+	iv := bytes.Repeat([]byte{0xff}, aes.BlockSize)
+	iv[0] = 0x01
+
+	plain := make([]byte, 70000)
+	for i := range plain {
+		plain[i] = byte(i * 7)
+	}
+	want := make([]byte, len(plain))
+	cipher.NewCTR(block, iv).XORKeyStream(want, plain)
+
+	for _, chunk := range []int{1, 5, 16, 33, 4096} {
+		have := make([]byte, len(plain))
+		copy(have, plain)
+		for off := 0; off < len(have); off += chunk {
+			end := off + chunk
+			if end > len(have) {
+				end = len(have)
+			}
+			c.xor(iv, have[off:end], int64(off))
+		}
+		if !bytes.Equal(have, want) {
+			t.Errorf("chunk %d: keystream mismatch", chunk)
+		}
+	}
+}
+
+// Tests that an encrypted database and its ancient store round trip, leave no
+// plaintext on disk, and reject missing, wrong or misplaced keys.
+func TestEncryptedDatabase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ethdb-encrypted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		file   = filepath.Join(dir, "chaindata")
+		secret = []byte("correct horse battery staple")
+		marker = []byte("plaintext-marker")
+	)
+	db, err := NewEncryptedLDBDatabase(file, 16, 16, secret)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	if err := db.OpenFreezer(filepath.Join(file, "ancient"), []string{"a"}); err != nil {
+		t.Fatalf("failed to open freezer: %v", err)
+	}
+	for i := 0; i < 1000; i++ {
+		db.Put([]byte(fmt.Sprintf("key-%d", i)), append(marker, byte(i)))
+	}
+	for i := uint64(0); i < 10; i++ {
+		db.Freezer().Append(i, map[string][]byte{"a": append(marker, byte(i))})
+	}
+	// Flush the journal into tables too, so that both formats are exercised
+	if err := db.LDB().CompactRange(util.Range{}); err != nil {
+		t.Fatalf("failed to compact: %v", err)
+	}
+	db.Put([]byte("journal"), marker)
+	db.Close()
+
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			if blob, _ := ioutil.ReadFile(path); bytes.Contains(blob, marker) {
+				t.Errorf("plaintext found in %s", path)
+			}
+		}
+		return nil
+	})
+	// Reopen the database and check the contents
+	if db, err = NewEncryptedLDBDatabase(file, 16, 16, secret); err != nil {
+		t.Fatalf("failed to reopen database: %v", err)
+	}
+	if err := db.OpenFreezer(filepath.Join(file, "ancient"), []string{"a"}); err != nil {
+		t.Fatalf("failed to reopen freezer: %v", err)
+	}
+	for i := 0; i < 1000; i++ {
+		if value, err := db.Get([]byte(fmt.Sprintf("key-%d", i))); err != nil || !bytes.Equal(value, append(marker, byte(i))) {
+			t.Fatalf("item %d: value mismatch: have %x, %v", i, value, err)
+		}
+	}
+	if value, err := db.Get([]byte("journal")); err != nil || !bytes.Equal(value, marker) {
+		t.Errorf("journal value mismatch: have %x, %v", value, err)
+	}
+	for i := uint64(0); i < 10; i++ {
+		if blob, err := db.Ancient("a", i); err != nil || !bytes.Equal(blob, append(marker, byte(i))) {
+			t.Fatalf("ancient %d: value mismatch: have %x, %v", i, blob, err)
+		}
+	}
+	db.Close()
+
+	// Check that wrong or missing keys are rejected
+	if _, err := NewEncryptedLDBDatabase(file, 16, 16, []byte("wrong")); err != ErrDatabaseKey {
+		t.Errorf("wrong key error mismatch: have %v, want %v", err, ErrDatabaseKey)
+	}
+	if _, err := NewLDBDatabase(file, 16, 16); err != ErrDatabaseEncrypted {
+		t.Errorf("missing key error mismatch: have %v, want %v", err, ErrDatabaseEncrypted)
+	}
+	// Check that existing plaintext databases are not encrypted partially
+	plain := filepath.Join(dir, "plain")
+	if db, err = NewLDBDatabase(plain, 16, 16); err != nil {
+		t.Fatalf("failed to create plaintext database: %v", err)
+	}
+	db.Close()
+	if _, err := NewEncryptedLDBDatabase(plain, 16, 16, secret); err != ErrDatabaseNotEncrypted {
+		t.Errorf("plaintext database error mismatch: have %v, want %v", err, ErrDatabaseNotEncrypted)
+	}
+}
+
+// Tests that encrypted freezer files never reuse a keystream for content written
+// again at the same offset, and that content written across generations and
+// reopenings decrypts correctly.
+func TestEncryptedFreezerFileGenerations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ethdb-encrypted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	block, _ := aes.NewCipher(make([]byte, 32))
+	c := &dbCipher{block: block}
+	path := filepath.Join(dir, "table.dat")
+
+	// ciphertext returns the encrypted content of the file on disk
+	ciphertext := func() []byte {
+		blob, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read file: %v", err)
+		}
+		return blob[cipherHeaderSize:]
+	}
+	// keystream returns the keystream that encrypted the plaintext
+	keystream := func(plain, enc []byte) []byte {
+		ks := make([]byte, len(plain))
+		for i := range plain {
+			ks[i] = plain[i] ^ enc[i]
+		}
+		return ks
+	}
+	f, err := openFreezerFile(path, c)
+	if err != nil {
+		t.Fatalf("failed to open file: %v", err)
+	}
+	first, second := bytes.Repeat([]byte{0x11}, 64), bytes.Repeat([]byte{0x22}, 64)
+	if _, err := f.WriteAt(first, 0); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	ks1 := keystream(first, ciphertext())
+
+	// Rewriting after a truncation must use a fresh keystream
+	if err := f.Truncate(16); err != nil {
+		t.Fatalf("failed to truncate: %v", err)
+	}
+	if _, err := f.WriteAt(second[16:], 16); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	ks2 := keystream(append(first[:16:16], second[16:]...), ciphertext())
+	if !bytes.Equal(ks1[:16], ks2[:16]) {
+		t.Errorf("retained content reencrypted")
+	}
+	if bytes.Equal(ks1[16:], ks2[16:]) {
+		t.Errorf("keystream reused after truncation")
+	}
+	f.Close()
+
+	// Reopening must decrypt all regions and start a fresh generation again
+	if f, err = openFreezerFile(path, c); err != nil {
+		t.Fatalf("failed to reopen file: %v", err)
+	}
+	if _, err := f.WriteAt(first, 64); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if ks3 := keystream(first, ciphertext()[64:]); bytes.Equal(ks3, ks1) {
+		t.Errorf("keystream reused after reopening")
+	}
+	want := append(append(first[:16:16], second[16:]...), first...)
+	have := make([]byte, len(want))
+	if _, err := f.ReadAt(have, 0); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if !bytes.Equal(have, want) {
+		t.Errorf("content mismatch: have %x, want %x", have, want)
+	}
+	// Reads within a region and across regions must match too
+	for _, r := range [][2]int{{0, 16}, {10, 30}, {60, 70}, {70, 128}} {
+		part := make([]byte, r[1]-r[0])
+		if _, err := f.ReadAt(part, int64(r[0])); err != nil {
+			t.Fatalf("failed to read %v: %v", r, err)
+		}
+		if !bytes.Equal(part, want[r[0]:r[1]]) {
+			t.Errorf("range %v: content mismatch: have %x, want %x", r, part, want[r[0]:r[1]])
+		}
+	}
+	f.Close()
+}
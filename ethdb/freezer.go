@@ -0,0 +1,350 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// errUnknownTable is returned when accessing a table the freezer doesn't have.
+	errUnknownTable = errors.New("unknown freezer table")
+
+	// errOutOfBounds is returned when retrieving an item that wasn't frozen yet.
+	errOutOfBounds = errors.New("out of bounds")
+
+	// errOutOfOrder is returned when appending items out of sequence.
+	errOutOfOrder = errors.New("items appended out of order")
+)
+
+// indexEntrySize is the size of an entry of a table index file: the end offset
+// of the item in the data file as a big endian uint64.
+const indexEntrySize = 8
+
+// AncientReader is implemented by databases backed by an ancient store, holding
+// immutable items numbered sequentially from zero.
+type AncientReader interface {
+	// Ancients returns the number of items in the ancient store.
+	Ancients() uint64
+
+	// Ancient retrieves the numbered item of the given table.
+	Ancient(table string, item uint64) ([]byte, error)
+}
+
+// Freezer is an append-only store of immutable items kept in flat files rather
+// than in LevelDB, sparing them from compactions. Items are numbered from zero
+// and appended to all tables at once, so the tables always hold the same number
+// of items.
+type Freezer struct {
+	frozen uint64 // Number of items in all tables (atomic access)
+
+	tables map[string]*freezerTable
+	lock   sync.Mutex // Serializes writers
+}
+
+// NewFreezer opens or creates the freezer tables in dir. Tables left longer than
+// the others by an interrupted append are truncated back.
+func NewFreezer(dir string, tables []string) (*Freezer, error) {
+	return newFreezer(dir, tables, nil)
+}
+
+// newFreezer opens or creates the freezer tables in dir, encrypting them if a
+// cipher is given.
+func newFreezer(dir string, tables []string, cipher *dbCipher) (*Freezer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	freezer := &Freezer{tables: make(map[string]*freezerTable)}
+	for i, name := range tables {
+		table, err := openFreezerTable(dir, name, cipher)
+		if err != nil {
+			freezer.Close()
+			return nil, err
+		}
+		freezer.tables[name] = table
+		if i == 0 || table.items < freezer.frozen {
+			freezer.frozen = table.items
+		}
+	}
+	for _, table := range freezer.tables {
+		if err := table.truncate(freezer.frozen); err != nil {
+			freezer.Close()
+			return nil, err
+		}
+	}
+	return freezer, nil
+}
+
+// Items returns the number of items frozen in each table.
+func (f *Freezer) Items() uint64 {
+	return atomic.LoadUint64(&f.frozen)
+}
+
+// Retrieve returns the numbered item of the given table.
+func (f *Freezer) Retrieve(table string, item uint64) ([]byte, error) {
+	t, ok := f.tables[table]
+	if !ok {
+		return nil, errUnknownTable
+	}
+	if item >= f.Items() {
+		return nil, errOutOfBounds
+	}
+	return t.retrieve(item)
+}
+
+// Append adds the next item to all tables, blobs holding the data of each. The
+// item is readable once Append returns, but only persisted by Sync.
+func (f *Freezer) Append(item uint64, blobs map[string][]byte) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if item != f.Items() {
+		return errOutOfOrder
+	}
+	if len(blobs) != len(f.tables) {
+		return fmt.Errorf("freezer append needs %d tables, have %d", len(f.tables), len(blobs))
+	}
+	for name := range blobs {
+		if _, ok := f.tables[name]; !ok {
+			return errUnknownTable
+		}
+	}
+	for name, blob := range blobs {
+		if err := f.tables[name].append(blob); err != nil {
+			// Roll back the tables already appended to
+			for _, table := range f.tables {
+				table.truncate(item)
+			}
+			return err
+		}
+	}
+	atomic.StoreUint64(&f.frozen, item+1)
+	return nil
+}
+
+// Truncate discards all items from the given one onwards.
+func (f *Freezer) Truncate(items uint64) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if items >= f.Items() {
+		return nil
+	}
+	atomic.StoreUint64(&f.frozen, items)
+	for _, table := range f.tables {
+		if err := table.truncate(items); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sync flushes all appended items to disk.
+func (f *Freezer) Sync() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for _, table := range f.tables {
+		if err := table.sync(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Size returns the total size in bytes of the freezer files.
+func (f *Freezer) Size() uint64 {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	var size uint64
+	for _, table := range f.tables {
+		size += table.size + table.items*indexEntrySize
+	}
+	return size
+}
+
+// Close syncs and closes all tables.
+func (f *Freezer) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	var failure error
+	for _, table := range f.tables {
+		if err := table.close(); err != nil && failure == nil {
+			failure = err
+		}
+	}
+	return failure
+}
+
+// freezerTable is a single flat data file of items along with an index file of
+// the end offsets of the items in the data file.
+type freezerTable struct {
+	data  freezerFile
+	index freezerFile
+	items uint64 // Number of items in the table
+	size  uint64 // Size of the data file up to the end of the last item
+	lock  sync.RWMutex
+}
+
+// openFreezerTable opens or creates the files of a table, discarding any partial
+// data written by an interrupted append.
+func openFreezerTable(dir, name string, cipher *dbCipher) (*freezerTable, error) {
+	data, err := openFreezerFile(filepath.Join(dir, name+".dat"), cipher)
+	if err != nil {
+		return nil, err
+	}
+	index, err := openFreezerFile(filepath.Join(dir, name+".idx"), cipher)
+	if err != nil {
+		data.Close()
+		return nil, err
+	}
+	table := &freezerTable{data: data, index: index}
+	if err := table.repair(); err != nil {
+		table.close()
+		return nil, err
+	}
+	return table, nil
+}
+
+// repair drops index entries pointing beyond the data file and data beyond the
+// last index entry.
+func (t *freezerTable) repair() error {
+	dataStat, err := t.data.Stat()
+	if err != nil {
+		return err
+	}
+	indexStat, err := t.index.Stat()
+	if err != nil {
+		return err
+	}
+	t.items = uint64(indexStat.Size()) / indexEntrySize
+	for t.items > 0 {
+		end, err := t.offset(t.items)
+		if err != nil {
+			return err
+		}
+		if end <= uint64(dataStat.Size()) {
+			break
+		}
+		t.items--
+	}
+	return t.truncate(t.items)
+}
+
+// offset returns the end offset in the data file of the item before the given
+// one, i.e. the start offset of the given item.
+func (t *freezerTable) offset(item uint64) (uint64, error) {
+	if item == 0 {
+		return 0, nil
+	}
+	var entry [indexEntrySize]byte
+	if _, err := t.index.ReadAt(entry[:], int64((item-1)*indexEntrySize)); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(entry[:]), nil
+}
+
+// retrieve reads the numbered item from the data file.
+func (t *freezerTable) retrieve(item uint64) ([]byte, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if item >= t.items {
+		return nil, errOutOfBounds
+	}
+	start, err := t.offset(item)
+	if err != nil {
+		return nil, err
+	}
+	end, err := t.offset(item + 1)
+	if err != nil {
+		return nil, err
+	}
+	blob := make([]byte, end-start)
+	if _, err := t.data.ReadAt(blob, int64(start)); err != nil {
+		return nil, err
+	}
+	return blob, nil
+}
+
+// append writes the next item to the end of the table.
+func (t *freezerTable) append(blob []byte) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if _, err := t.data.WriteAt(blob, int64(t.size)); err != nil {
+		return err
+	}
+	var entry [indexEntrySize]byte
+	binary.BigEndian.PutUint64(entry[:], t.size+uint64(len(blob)))
+	if _, err := t.index.WriteAt(entry[:], int64(t.items*indexEntrySize)); err != nil {
+		return err
+	}
+	t.items++
+	t.size += uint64(len(blob))
+	return nil
+}
+
+// truncate discards all items from the given one onwards.
+func (t *freezerTable) truncate(items uint64) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	size, err := t.offset(items)
+	if err != nil {
+		return err
+	}
+	if err := t.index.Truncate(int64(items * indexEntrySize)); err != nil {
+		return err
+	}
+	if err := t.data.Truncate(int64(size)); err != nil {
+		return err
+	}
+	t.items, t.size = items, size
+	return nil
+}
+
+// sync flushes the table files to disk, data first so that a synced index never
+// points beyond the synced data.
+func (t *freezerTable) sync() error {
+	if err := t.data.Sync(); err != nil {
+		return err
+	}
+	return t.index.Sync()
+}
+
+// close syncs and closes the table files.
+func (t *freezerTable) close() error {
+	var failure error
+	for _, file := range []freezerFile{t.data, t.index} {
+		if err := file.Sync(); err != nil && failure == nil {
+			failure = err
+		}
+		if err := file.Close(); err != nil && failure == nil {
+			failure = err
+		}
+	}
+	return failure
+}
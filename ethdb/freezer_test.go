@@ -0,0 +1,122 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethdb
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Tests that frozen items can be retrieved, survive a reopen, and that appends
+// interrupted midway are rolled back on reopen.
+func TestFreezerAppendReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tables := []string{"a", "b"}
+	freezer, err := NewFreezer(dir, tables)
+	if err != nil {
+		t.Fatalf("failed to create freezer: %v", err)
+	}
+	for i := uint64(0); i < 10; i++ {
+		blobs := map[string][]byte{
+			"a": []byte(fmt.Sprintf("a%d", i)),
+			"b": bytes.Repeat([]byte{byte(i)}, int(i)),
+		}
+		if err := freezer.Append(i, blobs); err != nil {
+			t.Fatalf("item %d: failed to append: %v", i, err)
+		}
+	}
+	if err := freezer.Append(5, map[string][]byte{"a": nil, "b": nil}); err != errOutOfOrder {
+		t.Errorf("out of order append: have %v, want %v", err, errOutOfOrder)
+	}
+	if _, err := freezer.Retrieve("c", 0); err != errUnknownTable {
+		t.Errorf("unknown table retrieval: have %v, want %v", err, errUnknownTable)
+	}
+	if _, err := freezer.Retrieve("a", 10); err != errOutOfBounds {
+		t.Errorf("out of bounds retrieval: have %v, want %v", err, errOutOfBounds)
+	}
+	freezer.Close()
+
+	// Simulate an append interrupted after writing to a single table
+	index, err := os.OpenFile(filepath.Join(dir, "a.idx"), os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index.Write([]byte{0, 0, 0, 0, 0, 0, 0, 0xff})
+	index.Close()
+
+	if freezer, err = NewFreezer(dir, tables); err != nil {
+		t.Fatalf("failed to reopen freezer: %v", err)
+	}
+	defer freezer.Close()
+
+	if items := freezer.Items(); items != 10 {
+		t.Fatalf("item count mismatch: have %d, want 10", items)
+	}
+	for i := uint64(0); i < 10; i++ {
+		if blob, err := freezer.Retrieve("a", i); err != nil || string(blob) != fmt.Sprintf("a%d", i) {
+			t.Errorf("item %d: table a mismatch: have %q (%v)", i, blob, err)
+		}
+		if blob, err := freezer.Retrieve("b", i); err != nil || !bytes.Equal(blob, bytes.Repeat([]byte{byte(i)}, int(i))) {
+			t.Errorf("item %d: table b mismatch: have %x (%v)", i, blob, err)
+		}
+	}
+}
+
+// Tests that truncated items are discarded and new ones appended in their place.
+func TestFreezerTruncate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	freezer, err := NewFreezer(dir, []string{"a"})
+	if err != nil {
+		t.Fatalf("failed to create freezer: %v", err)
+	}
+	defer freezer.Close()
+
+	for i := uint64(0); i < 5; i++ {
+		if err := freezer.Append(i, map[string][]byte{"a": {byte(i)}}); err != nil {
+			t.Fatalf("item %d: failed to append: %v", i, err)
+		}
+	}
+	if err := freezer.Truncate(3); err != nil {
+		t.Fatalf("failed to truncate: %v", err)
+	}
+	if items := freezer.Items(); items != 3 {
+		t.Fatalf("item count mismatch: have %d, want 3", items)
+	}
+	if _, err := freezer.Retrieve("a", 3); err != errOutOfBounds {
+		t.Errorf("truncated item retrieval: have %v, want %v", err, errOutOfBounds)
+	}
+	if err := freezer.Append(3, map[string][]byte{"a": {0xaa}}); err != nil {
+		t.Fatalf("failed to append after truncation: %v", err)
+	}
+	if blob, err := freezer.Retrieve("a", 3); err != nil || !bytes.Equal(blob, []byte{0xaa}) {
+		t.Errorf("appended item mismatch: have %x (%v)", blob, err)
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package explorer implements a minimal built-in block explorer served over HTTP.
+package explorer
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"math/big"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/eth"
+	"github.com/ur-technology/go-ur/logger"
+	"github.com/ur-technology/go-ur/logger/glog"
+	"github.com/ur-technology/go-ur/p2p"
+	"github.com/ur-technology/go-ur/rpc"
+)
+
+// recentBlocks is the number of blocks listed on the explorer's front page.
+const recentBlocks = 25
+
+// Service implements a lightweight chain explorer serving HTML pages about the
+// blocks, transactions, accounts and signup chains of the local node.
+type Service struct {
+	eth      *eth.Ethereum // Full Ethereum service to retrieve chain data from
+	addr     string        // Listening address of the HTTP server
+	listener net.Listener  // Listener accepting explorer requests, nil if stopped
+}
+
+// New returns an explorer service ready to be served on addr.
+func New(addr string, ethServ *eth.Ethereum) (*Service, error) {
+	if ethServ == nil {
+		return nil, errors.New("chain explorer requires a full node")
+	}
+	return &Service{eth: ethServ, addr: addr}, nil
+}
+
+// Protocols implements node.Service, returning the P2P network protocols used
+// by the explorer (nil as it doesn't use the devp2p overlay network).
+func (s *Service) Protocols() []p2p.Protocol { return nil }
+
+// APIs implements node.Service, returning the RPC API endpoints provided by the
+// explorer (nil as it doesn't provide any user callable APIs).
+func (s *Service) APIs() []rpc.API { return nil }
+
+// Start implements node.Service, starting to serve the explorer pages.
+func (s *Service) Start(server *p2p.Server) error {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleIndex)
+	mux.HandleFunc("/block/", s.handleBlock)
+	mux.HandleFunc("/tx/", s.handleTransaction)
+	mux.HandleFunc("/address/", s.handleAddress)
+	mux.HandleFunc("/search", s.handleSearch)
+	go http.Serve(listener, mux)
+
+	glog.V(logger.Info).Infof("Chain explorer started on http://%s", listener.Addr())
+	return nil
+}
+
+// Stop implements node.Service, terminating the explorer HTTP server.
+func (s *Service) Stop() error {
+	if s.listener != nil {
+		s.listener.Close()
+		s.listener = nil
+	}
+	glog.V(logger.Info).Infoln("Chain explorer stopped")
+	return nil
+}
+
+// handleIndex renders the most recent blocks of the canonical chain.
+func (s *Service) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	chain := s.eth.BlockChain()
+	head := chain.CurrentBlock()
+
+	blocks := make([]*types.Block, 0, recentBlocks)
+	for number := head.NumberU64(); len(blocks) < recentBlocks; number-- {
+		if block := chain.GetBlockByNumber(number); block != nil {
+			blocks = append(blocks, block)
+		}
+		if number == 0 {
+			break
+		}
+	}
+	s.render(w, "index", map[string]interface{}{"Head": head, "Blocks": blocks})
+}
+
+// handleBlock renders a block identified either by number or hash.
+func (s *Service) handleBlock(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/block/")
+
+	var block *types.Block
+	if number, err := strconv.ParseUint(id, 10, 64); err == nil {
+		block = s.eth.BlockChain().GetBlockByNumber(number)
+	} else {
+		block = s.eth.BlockChain().GetBlockByHash(common.HexToHash(id))
+	}
+	if block == nil {
+		s.renderError(w, http.StatusNotFound, fmt.Errorf("block %s not found", id))
+		return
+	}
+	s.render(w, "block", map[string]interface{}{"Block": block, "Signer": s.signer(block.Number())})
+}
+
+// handleTransaction renders a mined transaction along with its receipt and, for
+// signups, the chain of referring members.
+func (s *Service) handleTransaction(w http.ResponseWriter, r *http.Request) {
+	hash := common.HexToHash(strings.TrimPrefix(r.URL.Path, "/tx/"))
+
+	tx, blockHash, blockNumber, index := core.GetTransaction(s.eth.ChainDb(), hash)
+	if tx == nil {
+		s.renderError(w, http.StatusNotFound, fmt.Errorf("transaction %x not found", hash))
+		return
+	}
+	from, _ := types.Sender(s.signer(new(big.Int).SetUint64(blockNumber)), tx)
+
+	data := map[string]interface{}{
+		"Tx":          tx,
+		"From":        from,
+		"BlockHash":   blockHash,
+		"BlockNumber": blockNumber,
+		"Index":       index,
+		"Receipt":     core.GetReceipt(s.eth.ChainDb(), hash),
+	}
+	if core.IsPrivilegedAddress(s.eth.BlockChain().Config(), from) && tx.Value().Cmp(big.NewInt(1)) == 0 {
+		if members, err := core.SignupChain(s.eth.BlockChain(), tx); err == nil {
+			data["Signup"] = members
+		}
+	}
+	s.render(w, "tx", data)
+}
+
+// handleAddress renders the current state of an account.
+func (s *Service) handleAddress(w http.ResponseWriter, r *http.Request) {
+	addr := common.HexToAddress(strings.TrimPrefix(r.URL.Path, "/address/"))
+
+	statedb, err := s.eth.BlockChain().State()
+	if err != nil {
+		s.renderError(w, http.StatusInternalServerError, err)
+		return
+	}
+	data := map[string]interface{}{
+		"Address":  addr,
+		"Balance":  statedb.GetBalance(addr),
+		"Nonce":    statedb.GetNonce(addr),
+		"CodeSize": statedb.GetCodeSize(addr),
+	}
+	if receivers, ok := core.Rewards(s.eth.BlockChain().Config()).Privileged[addr]; ok {
+		data["Receivers"] = receivers
+	}
+	s.render(w, "address", data)
+}
+
+// handleSearch redirects a free form query to the matching block, transaction
+// or address page.
+func (s *Service) handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	hex := strings.TrimPrefix(query, "0x")
+
+	switch {
+	case len(hex) == 2*common.AddressLength:
+		http.Redirect(w, r, "/address/"+query, http.StatusFound)
+	case len(hex) == 2*common.HashLength:
+		if s.eth.BlockChain().GetBlockByHash(common.HexToHash(hex)) != nil {
+			http.Redirect(w, r, "/block/"+query, http.StatusFound)
+		} else {
+			http.Redirect(w, r, "/tx/"+query, http.StatusFound)
+		}
+	default:
+		if _, err := strconv.ParseUint(query, 10, 64); err == nil {
+			http.Redirect(w, r, "/block/"+query, http.StatusFound)
+			return
+		}
+		s.renderError(w, http.StatusBadRequest, fmt.Errorf("unrecognized query %q", query))
+	}
+}
+
+// signer returns the transaction signer valid at the given block number.
+func (s *Service) signer(number *big.Int) types.Signer {
+	return types.MakeSigner(s.eth.BlockChain().Config(), number)
+}
+
+// render executes the named page template, reporting any failure to the client.
+func (s *Service) render(w http.ResponseWriter, page string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := templates.ExecuteTemplate(w, page, data); err != nil {
+		glog.V(logger.Debug).Infof("explorer: failed to render %s: %v", page, err)
+	}
+}
+
+// renderError renders an error page with the given HTTP status.
+func (s *Service) renderError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	templates.ExecuteTemplate(w, "error", err)
+}
+
+// templateFuncs are the helpers available to the page templates.
+var templateFuncs = template.FuncMap{
+	"ur": common.CurrencyToString,
+	"time": func(t *big.Int) string {
+		return time.Unix(t.Int64(), 0).UTC().Format("2006-01-02 15:04:05")
+	},
+	"sender": func(signer types.Signer, tx *types.Transaction) common.Address {
+		from, _ := types.Sender(signer, tx)
+		return from
+	},
+}
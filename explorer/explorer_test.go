@@ -0,0 +1,83 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package explorer
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core"
+	"github.com/ur-technology/go-ur/core/types"
+)
+
+// Tests that all the explorer pages render with representative chain data.
+func TestTemplatesRender(t *testing.T) {
+	to := common.HexToAddress("0x01")
+	tx := types.NewTransaction(0, to, big.NewInt(1), big.NewInt(21000), big.NewInt(1), nil)
+	creation := types.NewContractCreation(1, big.NewInt(0), big.NewInt(50000), big.NewInt(1), []byte{0x60})
+	header := &types.Header{
+		Number:     big.NewInt(7),
+		Time:       big.NewInt(1480000000),
+		Difficulty: big.NewInt(131072),
+		GasLimit:   big.NewInt(4712388),
+		GasUsed:    big.NewInt(71000),
+		NSignups:   big.NewInt(1),
+		TotalWei:   big.NewInt(2),
+	}
+	block := types.NewBlock(header, []*types.Transaction{tx, creation}, nil, nil)
+
+	var privileged common.Address
+	for addr := range core.PrivilegedAddressesReceivers {
+		privileged = addr
+		break
+	}
+	pages := map[string]interface{}{
+		"index": map[string]interface{}{"Head": block, "Blocks": []*types.Block{block}},
+		"block": map[string]interface{}{"Block": block, "Signer": types.HomesteadSigner{}},
+		"tx": map[string]interface{}{
+			"Tx":          tx,
+			"From":        privileged,
+			"BlockHash":   block.Hash(),
+			"BlockNumber": uint64(7),
+			"Index":       uint64(0),
+			"Receipt":     (*types.Receipt)(nil),
+			"Signup":      []common.Address{to, privileged},
+		},
+		"address": map[string]interface{}{
+			"Address":   privileged,
+			"Balance":   big.NewInt(1000),
+			"Nonce":     uint64(3),
+			"CodeSize":  0,
+			"Receivers": core.PrivilegedAddressesReceivers[privileged],
+		},
+		"error": errors.New("block 8 not found"),
+	}
+	for page, data := range pages {
+		var buf bytes.Buffer
+		if err := templates.ExecuteTemplate(&buf, page, data); err != nil {
+			t.Errorf("page %s: failed to render: %v", page, err)
+			continue
+		}
+		if !strings.Contains(buf.String(), "</html>") {
+			t.Errorf("page %s: incomplete output", page)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package explorer
+
+import "html/template"
+
+// templates contains all the pages served by the explorer. They are kept inline
+// so the explorer doesn't depend on any assets being present next to the binary.
+var templates = template.Must(template.New("").Funcs(templateFuncs).Parse(`
+{{define "header"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>UR Explorer</title>
+<style>
+body { font-family: monospace; margin: 2em; }
+table { border-collapse: collapse; }
+td, th { padding: 2px 10px; text-align: left; }
+th { background: #eee; }
+</style>
+</head>
+<body>
+<h2><a href="/">UR Explorer</a></h2>
+<form action="/search"><input name="q" size="70" placeholder="block number, block hash, tx hash or address"> <input type="submit" value="Search"></form>
+<hr>
+{{end}}
+
+{{define "footer"}}</body>
+</html>
+{{end}}
+
+{{define "index"}}{{template "header"}}
+<h3>Latest blocks</h3>
+<table>
+<tr><th>Number</th><th>Hash</th><th>Time (UTC)</th><th>Txs</th><th>Signups</th><th>Gas used</th><th>Miner</th></tr>
+{{range .Blocks}}<tr>
+<td><a href="/block/{{.NumberU64}}">{{.NumberU64}}</a></td>
+<td><a href="/block/{{.Hash.Hex}}">{{.Hash.Hex}}</a></td>
+<td>{{time .Time}}</td>
+<td>{{len .Transactions}}</td>
+<td>{{.NSignups}}</td>
+<td>{{.GasUsed}}</td>
+<td><a href="/address/{{.Coinbase.Hex}}">{{.Coinbase.Hex}}</a></td>
+</tr>{{end}}
+</table>
+{{template "footer"}}{{end}}
+
+{{define "block"}}{{template "header"}}
+{{$signer := .Signer}}{{with .Block}}
+<h3>Block #{{.NumberU64}}</h3>
+<table>
+<tr><td>Hash</td><td>{{.Hash.Hex}}</td></tr>
+<tr><td>Parent</td><td><a href="/block/{{.ParentHash.Hex}}">{{.ParentHash.Hex}}</a></td></tr>
+<tr><td>Time (UTC)</td><td>{{time .Time}}</td></tr>
+<tr><td>Miner</td><td><a href="/address/{{.Coinbase.Hex}}">{{.Coinbase.Hex}}</a></td></tr>
+<tr><td>Difficulty</td><td>{{.Difficulty}}</td></tr>
+<tr><td>Gas used / limit</td><td>{{.GasUsed}} / {{.GasLimit}}</td></tr>
+<tr><td>Signups</td><td>{{.NSignups}}</td></tr>
+<tr><td>Total wei</td><td>{{.TotalWei}}</td></tr>
+<tr><td>Uncles</td><td>{{len .Uncles}}</td></tr>
+</table>
+<h3>Transactions</h3>
+<table>
+<tr><th>Hash</th><th>From</th><th>To</th><th>Value</th></tr>
+{{range .Transactions}}<tr>
+<td><a href="/tx/{{.Hash.Hex}}">{{.Hash.Hex}}</a></td>
+<td>{{with sender $signer .}}<a href="/address/{{.Hex}}">{{.Hex}}</a>{{end}}</td>
+<td>{{with .To}}<a href="/address/{{.Hex}}">{{.Hex}}</a>{{else}}contract creation{{end}}</td>
+<td>{{ur .Value}}</td>
+</tr>{{end}}
+</table>
+{{end}}
+{{template "footer"}}{{end}}
+
+{{define "tx"}}{{template "header"}}
+<h3>Transaction {{.Tx.Hash.Hex}}</h3>
+<table>
+<tr><td>Block</td><td><a href="/block/{{.BlockNumber}}">{{.BlockNumber}}</a> (index {{.Index}})</td></tr>
+<tr><td>From</td><td><a href="/address/{{.From.Hex}}">{{.From.Hex}}</a></td></tr>
+<tr><td>To</td><td>{{with .Tx.To}}<a href="/address/{{.Hex}}">{{.Hex}}</a>{{else}}contract creation{{end}}</td></tr>
+<tr><td>Value</td><td>{{ur .Tx.Value}}</td></tr>
+<tr><td>Nonce</td><td>{{.Tx.Nonce}}</td></tr>
+<tr><td>Gas price</td><td>{{.Tx.GasPrice}}</td></tr>
+<tr><td>Gas limit</td><td>{{.Tx.Gas}}</td></tr>
+{{with .Receipt}}<tr><td>Gas used</td><td>{{.GasUsed}}</td></tr>
+<tr><td>Logs</td><td>{{len .Logs}}</td></tr>{{end}}
+<tr><td>Data</td><td>{{printf "%x" .Tx.Data}}</td></tr>
+</table>
+{{with .Signup}}<h3>Signup chain</h3>
+<ol>
+{{range .}}<li><a href="/address/{{.Hex}}">{{.Hex}}</a></li>{{end}}
+</ol>{{end}}
+{{template "footer"}}{{end}}
+
+{{define "address"}}{{template "header"}}
+<h3>Address {{.Address.Hex}}</h3>
+<table>
+<tr><td>Balance</td><td>{{ur .Balance}}</td></tr>
+<tr><td>Nonce</td><td>{{.Nonce}}</td></tr>
+<tr><td>Code size</td><td>{{.CodeSize}}</td></tr>
+{{with .Receivers}}<tr><td>Privileged receiver</td><td><a href="/address/{{.Receiver.Hex}}">{{.Receiver.Hex}}</a></td></tr>
+<tr><td>Privileged URFF</td><td><a href="/address/{{.URFF.Hex}}">{{.URFF.Hex}}</a></td></tr>{{end}}
+</table>
+{{template "footer"}}{{end}}
+
+{{define "error"}}{{template "header"}}
+<p>{{.}}</p>
+{{template "footer"}}{{end}}
+`))
@@ -0,0 +1,481 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package finality implements an optional checkpoint finality layer, where a
+// configured validator set periodically signs canonical checkpoints over a
+// well-known whisper topic. Once a checkpoint gathers the signatures of a
+// quorum of validators, the chain manager treats it as irreversible, refusing
+// any reorganisation past it.
+package finality
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ur-technology/go-ur/accounts"
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core"
+	"github.com/ur-technology/go-ur/crypto"
+	"github.com/ur-technology/go-ur/eth"
+	"github.com/ur-technology/go-ur/event"
+	"github.com/ur-technology/go-ur/logger"
+	"github.com/ur-technology/go-ur/logger/glog"
+	"github.com/ur-technology/go-ur/p2p"
+	"github.com/ur-technology/go-ur/params"
+	"github.com/ur-technology/go-ur/rlp"
+	"github.com/ur-technology/go-ur/rpc"
+	whisper "github.com/ur-technology/go-ur/whisper/whisperv2"
+)
+
+// TopicName is the whisper topic the checkpoint votes are broadcast on.
+const TopicName = "ur-checkpoints"
+
+// Topic is the whisper topic of the checkpoint votes.
+var Topic = whisper.NewTopicFromString(TopicName)
+
+const (
+	// DefaultInterval is the default number of blocks between checkpoints.
+	DefaultInterval = 1000
+
+	signDepth  = 64               // Blocks a checkpoint must be buried under before validators sign it
+	voteTTL    = 10 * time.Minute // Time the votes are kept in the whisper pool
+	voteWindow = 4                // Checkpoints around the local head votes are tallied for
+)
+
+// Config contains the settings of the finality layer.
+type Config struct {
+	Validators []common.Address // Addresses whose signatures count towards finality
+	Threshold  int              // Signatures required to finalize a checkpoint (0 = two thirds majority)
+	Interval   uint64           // Number of blocks between checkpoints
+	Signer     common.Address   // Validator account to sign checkpoints with (zero = don't sign)
+}
+
+// DefaultValidators returns the privileged addresses of the chain, which form
+// the validator set if none is configured.
+func DefaultValidators(config *params.ChainConfig) []common.Address {
+	privileged := core.Rewards(config).Privileged
+	validators := make([]common.Address, 0, len(privileged))
+	for addr := range privileged {
+		validators = append(validators, addr)
+	}
+	sort.Sort(addressesByHex(validators))
+	return validators
+}
+
+type addressesByHex []common.Address
+
+func (a addressesByHex) Len() int           { return len(a) }
+func (a addressesByHex) Less(i, j int) bool { return bytes.Compare(a[i][:], a[j][:]) < 0 }
+func (a addressesByHex) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
+// Vote is the whisper payload of a validator signing a checkpoint.
+type Vote struct {
+	Number    uint64
+	Hash      common.Hash
+	Signature []byte
+}
+
+// sigHash returns the hash the validators sign to vote for a checkpoint.
+func sigHash(number uint64, hash common.Hash) []byte {
+	data, _ := rlp.EncodeToBytes([]interface{}{number, hash})
+	return crypto.Keccak256(data)
+}
+
+// Validator recovers the address of the validator that signed the vote.
+func (v *Vote) Validator() (common.Address, error) {
+	pub, err := crypto.SigToPub(sigHash(v.Number, v.Hash), v.Signature)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("invalid checkpoint signature: %v", err)
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
+
+// checkpoint identifies a block voted on by the validators.
+type checkpoint struct {
+	Number uint64
+	Hash   common.Hash
+}
+
+// Service implements the finality layer, signing checkpoints with the validator
+// account of the node if it has one, and collecting the votes of the validator
+// set until a quorum finalizes a checkpoint.
+type Service struct {
+	config     Config
+	validators map[common.Address]bool
+
+	chain *core.BlockChain
+	mux   *event.TypeMux
+	am    *accounts.Manager
+	shh   *whisper.Whisper
+
+	lock       sync.Mutex
+	votes      map[checkpoint]map[common.Address][]byte // Signatures collected for non-finalized checkpoints
+	final      checkpoint                               // Checkpoint finalized by this instance
+	finalVotes map[common.Address][]byte                // Signatures that finalized it
+	signed     uint64                                   // Number of the last checkpoint signed locally
+
+	watch int
+	sub   event.Subscription
+	quit  chan struct{}
+	done  chan struct{}
+}
+
+// New returns a finality layer following the validator votes posted through the
+// given whisper service.
+func New(ethServ *eth.Ethereum, shh *whisper.Whisper, config Config) (*Service, error) {
+	if ethServ == nil {
+		return nil, errors.New("checkpoint finality requires a full node")
+	}
+	if shh == nil {
+		return nil, errors.New("checkpoint finality requires whisper")
+	}
+	s, err := newService(ethServ.BlockChain(), config)
+	if err != nil {
+		return nil, err
+	}
+	s.mux = ethServ.EventMux()
+	s.am = ethServ.AccountManager()
+	s.shh = shh
+	return s, nil
+}
+
+// newService validates the configuration and assembles the vote tallies.
+func newService(chain *core.BlockChain, config Config) (*Service, error) {
+	if len(config.Validators) == 0 {
+		config.Validators = DefaultValidators(chain.Config())
+	}
+	if len(config.Validators) == 0 {
+		return nil, errors.New("empty validator set")
+	}
+	if config.Interval == 0 {
+		config.Interval = DefaultInterval
+	}
+	if config.Threshold == 0 {
+		config.Threshold = len(config.Validators)*2/3 + 1
+	}
+	if config.Threshold < 0 || config.Threshold > len(config.Validators) {
+		return nil, fmt.Errorf("threshold %d out of range for %d validators", config.Threshold, len(config.Validators))
+	}
+	validators := make(map[common.Address]bool, len(config.Validators))
+	for _, addr := range config.Validators {
+		validators[addr] = true
+	}
+	if config.Signer != (common.Address{}) && !validators[config.Signer] {
+		return nil, fmt.Errorf("signer %x not in the validator set", config.Signer)
+	}
+	return &Service{
+		config:     config,
+		validators: validators,
+		chain:      chain,
+		votes:      make(map[checkpoint]map[common.Address][]byte),
+	}, nil
+}
+
+// Protocols implements node.Service, returning the P2P network protocols used
+// by the finality layer (nil as it votes through the whisper protocol).
+func (s *Service) Protocols() []p2p.Protocol { return nil }
+
+// APIs implements node.Service, returning the RPC API endpoints provided by the
+// finality layer.
+func (s *Service) APIs() []rpc.API {
+	return []rpc.API{{
+		Namespace: "finality",
+		Version:   "1.0",
+		Service:   &PublicFinalityAPI{s},
+		Public:    true,
+	}}
+}
+
+// Start implements node.Service, starting to collect the validator votes and
+// signing the checkpoints reached by the local chain.
+func (s *Service) Start(server *p2p.Server) error {
+	s.watch = s.shh.Watch(whisper.Filter{
+		Topics: [][]whisper.Topic{{Topic}},
+		Fn:     s.deliver,
+	})
+	s.sub = s.mux.Subscribe(core.ChainHeadEvent{})
+	s.quit = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.loop()
+
+	glog.V(logger.Info).Infof("Checkpoint finality started on whisper topic %q (%d/%d validators, every %d blocks)", TopicName, s.config.Threshold, len(s.config.Validators), s.config.Interval)
+	return nil
+}
+
+// Stop implements node.Service, terminating the finality layer.
+func (s *Service) Stop() error {
+	s.shh.Unwatch(s.watch)
+	s.sub.Unsubscribe()
+	close(s.quit)
+	<-s.done
+
+	glog.V(logger.Info).Infoln("Checkpoint finality stopped")
+	return nil
+}
+
+// loop signs the checkpoints reached by new chain heads and retries finalizing
+// the checkpoints whose blocks weren't known yet, until termination.
+func (s *Service) loop() {
+	defer close(s.done)
+
+	for {
+		select {
+		case ev, ok := <-s.sub.Chan():
+			if !ok {
+				return
+			}
+			head, ok := ev.Data.(core.ChainHeadEvent)
+			if !ok {
+				continue
+			}
+			if s.config.Signer != (common.Address{}) {
+				s.sign(head.Block.NumberU64())
+			}
+			s.lock.Lock()
+			s.finalize()
+			s.lock.Unlock()
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// sign votes for the most recent checkpoint buried deep enough under the given
+// head, broadcasting the vote to the other validators.
+func (s *Service) sign(head uint64) {
+	if head < signDepth+s.config.Interval {
+		return
+	}
+	number := (head - signDepth) / s.config.Interval * s.config.Interval
+
+	s.lock.Lock()
+	if number <= s.signed {
+		s.lock.Unlock()
+		return
+	}
+	s.signed = number
+	s.lock.Unlock()
+
+	block := s.chain.GetBlockByNumber(number)
+	if block == nil {
+		return
+	}
+	sig, err := s.am.Sign(s.config.Signer, sigHash(number, block.Hash()))
+	if err != nil {
+		glog.V(logger.Warn).Infof("Failed to sign checkpoint #%d: %v", number, err)
+		return
+	}
+	vote := &Vote{Number: number, Hash: block.Hash(), Signature: sig}
+	if err := s.addVote(vote); err != nil {
+		glog.V(logger.Warn).Infof("Failed to count own vote for checkpoint #%d: %v", number, err)
+	}
+	payload, err := rlp.EncodeToBytes(vote)
+	if err != nil {
+		glog.V(logger.Warn).Infof("Failed to encode vote for checkpoint #%d: %v", number, err)
+		return
+	}
+	envelope, err := whisper.NewMessage(payload).Wrap(whisper.DefaultPoW, whisper.Options{
+		TTL:    voteTTL,
+		Topics: []whisper.Topic{Topic},
+	})
+	if err != nil {
+		glog.V(logger.Warn).Infof("Failed to wrap vote for checkpoint #%d: %v", number, err)
+		return
+	}
+	if err := s.shh.Send(envelope); err != nil {
+		glog.V(logger.Warn).Infof("Failed to broadcast vote for checkpoint #%d: %v", number, err)
+	}
+}
+
+// deliver is the whisper callback counting the votes received from the network.
+func (s *Service) deliver(msg *whisper.Message) {
+	vote := new(Vote)
+	if err := rlp.DecodeBytes(msg.Payload, vote); err != nil {
+		glog.V(logger.Debug).Infof("Invalid checkpoint vote: %v", err)
+		return
+	}
+	if err := s.addVote(vote); err != nil {
+		glog.V(logger.Debug).Infof("Rejected vote for checkpoint #%d: %v", vote.Number, err)
+	}
+}
+
+// addVote verifies a vote and counts it towards its checkpoint, finalizing the
+// checkpoint if it reached the quorum.
+func (s *Service) addVote(vote *Vote) error {
+	if vote.Number == 0 || vote.Number%s.config.Interval != 0 {
+		return fmt.Errorf("block #%d is not a checkpoint", vote.Number)
+	}
+	validator, err := vote.Validator()
+	if err != nil {
+		return err
+	}
+	if !s.validators[validator] {
+		return fmt.Errorf("signer %x not in the validator set", validator)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if number, _ := s.chain.Finalized(); vote.Number <= number {
+		return nil
+	}
+	// Only tally the checkpoints near the local head, keeping the memory of the
+	// votes bounded no matter which heights the validators sign
+	window := voteWindow * s.config.Interval
+	head := s.chain.CurrentBlock().NumberU64()
+	if vote.Number > head+window {
+		return fmt.Errorf("checkpoint #%d too far ahead of head #%d", vote.Number, head)
+	}
+	if vote.Number+window < head {
+		return fmt.Errorf("checkpoint #%d too far behind head #%d", vote.Number, head)
+	}
+	for cp, votes := range s.votes {
+		if cp.Number+window < head {
+			delete(s.votes, cp)
+			continue
+		}
+		// A validator counts towards a single block per checkpoint height
+		if cp.Number == vote.Number && cp.Hash != vote.Hash {
+			delete(votes, validator)
+			if len(votes) == 0 {
+				delete(s.votes, cp)
+			}
+		}
+	}
+	cp := checkpoint{vote.Number, vote.Hash}
+	if s.votes[cp] == nil {
+		s.votes[cp] = make(map[common.Address][]byte)
+	}
+	s.votes[cp][validator] = vote.Signature
+
+	if len(s.votes[cp]) == s.config.Threshold {
+		if block := s.chain.GetBlockByNumber(cp.Number); block != nil && block.Hash() != cp.Hash {
+			glog.V(logger.Warn).Infof("Local chain conflicts with checkpoint #%d [%x…] signed by the validators", cp.Number, cp.Hash[:4])
+		}
+	}
+	s.finalize()
+	return nil
+}
+
+// finalize marks the most recent checkpoint with a quorum of votes finalized in
+// the chain, dropping the votes it supersedes. Checkpoints whose block isn't in
+// the local canonical chain are kept for a later head. The caller must hold
+// the lock.
+func (s *Service) finalize() {
+	var (
+		best  checkpoint
+		found bool
+	)
+	for cp, votes := range s.votes {
+		if len(votes) >= s.config.Threshold && (!found || cp.Number > best.Number) {
+			if block := s.chain.GetBlockByNumber(cp.Number); block == nil || block.Hash() != cp.Hash {
+				continue
+			}
+			best, found = cp, true
+		}
+	}
+	if !found {
+		return
+	}
+	if err := s.chain.SetFinalized(best.Number, best.Hash); err != nil {
+		glog.V(logger.Warn).Infof("Failed to finalize checkpoint #%d [%x…]: %v", best.Number, best.Hash[:4], err)
+		return
+	}
+	glog.V(logger.Info).Infof("Finalized checkpoint #%d [%x…] with %d validator signatures", best.Number, best.Hash[:4], len(s.votes[best]))
+
+	s.final, s.finalVotes = best, s.votes[best]
+	for cp := range s.votes {
+		if cp.Number <= best.Number {
+			delete(s.votes, cp)
+		}
+	}
+}
+
+// FinalizedCheckpoint is the RPC representation of the finalized checkpoint.
+type FinalizedCheckpoint struct {
+	Number     *rpc.HexNumber            `json:"number"`
+	Hash       common.Hash               `json:"hash"`
+	Signatures map[common.Address]string `json:"signatures"` // Nil if finalized before the last restart
+}
+
+// PendingCheckpoint is the RPC representation of a checkpoint collecting votes.
+type PendingCheckpoint struct {
+	Number *rpc.HexNumber   `json:"number"`
+	Hash   common.Hash      `json:"hash"`
+	Votes  []common.Address `json:"votes"`
+}
+
+type pendingByNumber []*PendingCheckpoint
+
+func (p pendingByNumber) Len() int           { return len(p) }
+func (p pendingByNumber) Less(i, j int) bool { return p[i].Number.Int64() < p[j].Number.Int64() }
+func (p pendingByNumber) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// PublicFinalityAPI provides access to the checkpoints of the finality layer.
+type PublicFinalityAPI struct {
+	s *Service
+}
+
+// Checkpoint returns the finalized checkpoint, nil if no block was finalized.
+func (api *PublicFinalityAPI) Checkpoint() *FinalizedCheckpoint {
+	number, hash := api.s.chain.Finalized()
+	if hash == (common.Hash{}) {
+		return nil
+	}
+	result := &FinalizedCheckpoint{Number: rpc.NewHexNumber(number), Hash: hash}
+
+	api.s.lock.Lock()
+	defer api.s.lock.Unlock()
+
+	if api.s.final == (checkpoint{number, hash}) {
+		result.Signatures = make(map[common.Address]string, len(api.s.finalVotes))
+		for addr, sig := range api.s.finalVotes {
+			result.Signatures[addr] = common.ToHex(sig)
+		}
+	}
+	return result
+}
+
+// Pending returns the checkpoints which didn't gather a quorum of votes yet.
+func (api *PublicFinalityAPI) Pending() []*PendingCheckpoint {
+	api.s.lock.Lock()
+	defer api.s.lock.Unlock()
+
+	pending := make([]*PendingCheckpoint, 0, len(api.s.votes))
+	for cp, votes := range api.s.votes {
+		voters := make([]common.Address, 0, len(votes))
+		for addr := range votes {
+			voters = append(voters, addr)
+		}
+		sort.Sort(addressesByHex(voters))
+		pending = append(pending, &PendingCheckpoint{Number: rpc.NewHexNumber(cp.Number), Hash: cp.Hash, Votes: voters})
+	}
+	sort.Sort(pendingByNumber(pending))
+	return pending
+}
+
+// Validators returns the validator set and the number of signatures required to
+// finalize a checkpoint.
+func (api *PublicFinalityAPI) Validators() map[string]interface{} {
+	return map[string]interface{}{
+		"validators": api.s.config.Validators,
+		"threshold":  api.s.config.Threshold,
+		"interval":   api.s.config.Interval,
+	}
+}
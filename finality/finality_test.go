@@ -0,0 +1,131 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package finality
+
+import (
+	"crypto/ecdsa"
+	"testing"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core"
+	"github.com/ur-technology/go-ur/crypto"
+	"github.com/ur-technology/go-ur/ethdb"
+	"github.com/ur-technology/go-ur/event"
+	"github.com/ur-technology/go-ur/params"
+)
+
+// vote creates a checkpoint vote signed with the given key.
+func vote(t *testing.T, key *ecdsa.PrivateKey, number uint64, hash common.Hash) *Vote {
+	sig, err := crypto.Sign(sigHash(number, hash), key)
+	if err != nil {
+		t.Fatalf("failed to sign checkpoint: %v", err)
+	}
+	return &Vote{Number: number, Hash: hash, Signature: sig}
+}
+
+// Tests that checkpoints are finalized once a quorum of the validator set voted
+// for them, and that votes from outside the validator set don't count.
+func TestCheckpointQuorum(t *testing.T) {
+	var (
+		keys        = make([]*ecdsa.PrivateKey, 3)
+		validators  = make([]common.Address, 3)
+		outsider, _ = crypto.GenerateKey()
+	)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		validators[i] = crypto.PubkeyToAddress(keys[i].PublicKey)
+	}
+
+	db, _ := ethdb.NewMemDatabase()
+	genesis := core.WriteGenesisBlockForTesting(db)
+	chain, _ := core.NewBlockChain(db, params.TestChainConfig, core.FakePow{}, new(event.TypeMux))
+	defer chain.Stop()
+
+	blocks, _ := core.GenerateChain(params.TestChainConfig, chain, genesis, db, 20, func(int, *core.BlockGen) {})
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	s, err := newService(chain, Config{Validators: validators, Interval: 10})
+	if err != nil {
+		t.Fatalf("failed to create finality layer: %v", err)
+	}
+	if s.config.Threshold != 3 {
+		t.Errorf("default threshold mismatch: have %d, want 3", s.config.Threshold)
+	}
+	s.config.Threshold = 2
+	checkpoint := blocks[9]
+
+	// Signatures must recover to the voting validator
+	v := vote(t, keys[0], checkpoint.NumberU64(), checkpoint.Hash())
+	if signer, err := v.Validator(); err != nil || signer != validators[0] {
+		t.Errorf("vote signer mismatch: have %x (%v), want %x", signer, err, validators[0])
+	}
+	// Votes on non-checkpoint blocks or by outsiders are rejected
+	if err := s.addVote(vote(t, keys[1], 5, blocks[4].Hash())); err == nil {
+		t.Errorf("accepted vote on non-checkpoint block")
+	}
+	if err := s.addVote(vote(t, outsider, checkpoint.NumberU64(), checkpoint.Hash())); err == nil {
+		t.Errorf("accepted vote from outside the validator set")
+	}
+	// A single validator, even voting twice, doesn't reach the quorum
+	for i := 0; i < 2; i++ {
+		if err := s.addVote(v); err != nil {
+			t.Fatalf("failed to add vote: %v", err)
+		}
+	}
+	if _, hash := chain.Finalized(); hash != (common.Hash{}) {
+		t.Fatalf("finalized checkpoint without quorum")
+	}
+	// A second validator finalizes the checkpoint and clears the tallies
+	if err := s.addVote(vote(t, keys[1], checkpoint.NumberU64(), checkpoint.Hash())); err != nil {
+		t.Fatalf("failed to add vote: %v", err)
+	}
+	if number, hash := chain.Finalized(); number != 10 || hash != checkpoint.Hash() {
+		t.Errorf("finalized checkpoint mismatch: have #%d [%x], want #10 [%x]", number, hash, checkpoint.Hash())
+	}
+	if len(s.votes) != 0 {
+		t.Errorf("pending tallies not cleared: %d left", len(s.votes))
+	}
+	api := &PublicFinalityAPI{s}
+	if cp := api.Checkpoint(); cp == nil || len(cp.Signatures) != 2 {
+		t.Errorf("finalized checkpoint signatures mismatch: have %v, want 2", cp)
+	}
+	// A quorum on a block unknown locally is kept pending
+	unknown := common.Hash{0x01}
+	for _, key := range keys[:2] {
+		if err := s.addVote(vote(t, key, 20, unknown)); err != nil {
+			t.Fatalf("failed to add vote: %v", err)
+		}
+	}
+	if number, _ := chain.Finalized(); number != 10 {
+		t.Errorf("finalized unknown checkpoint")
+	}
+	if pending := api.Pending(); len(pending) != 1 || len(pending[0].Votes) != 2 {
+		t.Errorf("pending checkpoints mismatch: have %v, want 1 with 2 votes", pending)
+	}
+	// Votes far from the local head are rejected, keeping the tallies bounded
+	if err := s.addVote(vote(t, keys[2], 20+voteWindow*10+10, unknown)); err == nil {
+		t.Errorf("accepted vote for a checkpoint far ahead of the head")
+	}
+	// A validator switching to another block drops its vote for the first one
+	if err := s.addVote(vote(t, keys[0], 20, common.Hash{0x02})); err != nil {
+		t.Fatalf("failed to add vote: %v", err)
+	}
+	if pending := api.Pending(); len(pending) != 2 || len(pending[0].Votes)+len(pending[1].Votes) != 2 {
+		t.Errorf("pending checkpoints mismatch: have %v, want 2 with 1 vote each", pending)
+	}
+}
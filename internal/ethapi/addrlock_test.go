@@ -0,0 +1,66 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ur-technology/go-ur/common"
+)
+
+// Tests that the same account is locked out while a transaction from it is
+// being sent, while other accounts can proceed.
+func TestAddrLocker(t *testing.T) {
+	var (
+		locker AddrLocker
+		a      = common.HexToAddress("0x01")
+		b      = common.HexToAddress("0x02")
+	)
+	locker.LockAddr(a)
+
+	// A different account must not be blocked
+	done := make(chan struct{})
+	go func() {
+		locker.LockAddr(b)
+		locker.UnlockAddr(b)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("unrelated account blocked")
+	}
+	// The same account must wait for the first sender to finish
+	acquired := make(chan struct{})
+	go func() {
+		locker.LockAddr(a)
+		close(acquired)
+		locker.UnlockAddr(a)
+	}()
+	select {
+	case <-acquired:
+		t.Fatalf("account locked twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+	locker.UnlockAddr(a)
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatalf("account not released")
+	}
+}
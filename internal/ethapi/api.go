@@ -100,7 +100,8 @@ func NewPublicTxPoolAPI(b Backend) *PublicTxPoolAPI {
 	return &PublicTxPoolAPI{b}
 }
 
-// Content returns the transactions contained within the transaction pool.
+// Content returns the transactions contained within the transaction pool, grouped
+// by sender account and keyed by their nonces.
 func (s *PublicTxPoolAPI) Content() map[string]map[string]map[string]*RPCTransaction {
 	content := map[string]map[string]map[string]*RPCTransaction{
 		"pending": make(map[string]map[string]*RPCTransaction),
@@ -111,16 +112,16 @@ func (s *PublicTxPoolAPI) Content() map[string]map[string]map[string]*RPCTransac
 	// Flatten the pending transactions
 	for account, txs := range pending {
 		dump := make(map[string]*RPCTransaction)
-		for nonce, tx := range txs {
-			dump[fmt.Sprintf("%d", nonce)] = newRPCPendingTransaction(tx)
+		for _, tx := range txs {
+			dump[fmt.Sprintf("%d", tx.Nonce())] = NewRPCPendingTransaction(tx)
 		}
 		content["pending"][account.Hex()] = dump
 	}
 	// Flatten the queued transactions
 	for account, txs := range queue {
 		dump := make(map[string]*RPCTransaction)
-		for nonce, tx := range txs {
-			dump[fmt.Sprintf("%d", nonce)] = newRPCPendingTransaction(tx)
+		for _, tx := range txs {
+			dump[fmt.Sprintf("%d", tx.Nonce())] = NewRPCPendingTransaction(tx)
 		}
 		content["queued"][account.Hex()] = dump
 	}
@@ -136,6 +137,35 @@ func (s *PublicTxPoolAPI) Status() map[string]*rpc.HexNumber {
 	}
 }
 
+// RPCQueueAgeBucket is the number of queued transactions younger than an age
+// bound, in seconds, and older than the bound of the previous bucket.
+type RPCQueueAgeBucket struct {
+	MaxAge uint64 `json:"maxAge,omitempty"` // Unset for the last, unbounded bucket
+	Count  int    `json:"count"`
+}
+
+// RPCQueueAges is the age distribution of the queued transactions.
+type RPCQueueAges struct {
+	Buckets []RPCQueueAgeBucket `json:"buckets"`
+	Oldest  uint64              `json:"oldest"` // Age of the oldest queued transaction in seconds
+}
+
+// QueueAges returns how long the non-executable transactions have been queued, so
+// that the ones approaching the pool lifetime can be spotted before being dropped.
+func (s *PublicTxPoolAPI) QueueAges() *RPCQueueAges {
+	stats := s.b.QueueAges()
+
+	ages := &RPCQueueAges{Oldest: uint64(stats.Oldest / time.Second)}
+	for i, count := range stats.Counts {
+		bucket := RPCQueueAgeBucket{Count: count}
+		if i < len(stats.Bounds) {
+			bucket.MaxAge = uint64(stats.Bounds[i] / time.Second)
+		}
+		ages.Buckets = append(ages.Buckets, bucket)
+	}
+	return ages
+}
+
 // Inspect retrieves the content of the transaction pool and flattens it into an
 // easily inspectable list.
 func (s *PublicTxPoolAPI) Inspect() map[string]map[string]map[string]string {
@@ -155,16 +185,16 @@ func (s *PublicTxPoolAPI) Inspect() map[string]map[string]map[string]string {
 	// Flatten the pending transactions
 	for account, txs := range pending {
 		dump := make(map[string]string)
-		for nonce, tx := range txs {
-			dump[fmt.Sprintf("%d", nonce)] = format(tx)
+		for _, tx := range txs {
+			dump[fmt.Sprintf("%d", tx.Nonce())] = format(tx)
 		}
 		content["pending"][account.Hex()] = dump
 	}
 	// Flatten the queued transactions
 	for account, txs := range queue {
 		dump := make(map[string]string)
-		for nonce, tx := range txs {
-			dump[fmt.Sprintf("%d", nonce)] = format(tx)
+		for _, tx := range txs {
+			dump[fmt.Sprintf("%d", tx.Nonce())] = format(tx)
 		}
 		content["queued"][account.Hex()] = dump
 	}
@@ -191,15 +221,17 @@ func (s *PublicAccountAPI) Accounts() []accounts.Account {
 // It offers methods to create, (un)lock en list accounts. Some methods accept
 // passwords and are therefore considered private by default.
 type PrivateAccountAPI struct {
-	am *accounts.Manager
-	b  Backend
+	am        *accounts.Manager
+	b         Backend
+	nonceLock *AddrLocker
 }
 
 // NewPrivateAccountAPI create a new PrivateAccountAPI.
-func NewPrivateAccountAPI(b Backend) *PrivateAccountAPI {
+func NewPrivateAccountAPI(b Backend, nonceLock *AddrLocker) *PrivateAccountAPI {
 	return &PrivateAccountAPI{
-		am: b.AccountManager(),
-		b:  b,
+		am:        b.AccountManager(),
+		b:         b,
+		nonceLock: nonceLock,
 	}
 }
 
@@ -256,8 +288,12 @@ func (s *PrivateAccountAPI) LockAccount(addr common.Address) bool {
 
 // SendTransaction will create a transaction from the given arguments and
 // tries to sign it with the key associated with args.To. If the given passwd isn't
-// able to decrypt the key it fails.
+// able to decrypt the key it fails. A missing nonce is filled in from the pool,
+// with concurrent sends from the same account handed consecutive nonces.
 func (s *PrivateAccountAPI) SendTransaction(ctx context.Context, args SendTxArgs, passwd string) (common.Hash, error) {
+	s.nonceLock.LockAddr(args.From)
+	defer s.nonceLock.UnlockAddr(args.From)
+
 	var err error
 	args, err = prepareSendTxArgs(ctx, args, s.b)
 	if err != nil {
@@ -282,12 +318,56 @@ func (s *PrivateAccountAPI) SendTransaction(ctx context.Context, args SendTxArgs
 	signer := types.MakeSigner(s.b.ChainConfig(), s.b.CurrentBlock().Number())
 	signature, err := s.am.SignWithPassphrase(args.From, passwd, signer.Hash(tx).Bytes())
 	if err != nil {
-		return common.Hash{}, err
+		return common.Hash{}, rpcError(err)
 	}
 
 	return submitTransaction(ctx, s.b, tx, signature)
 }
 
+// SignTransaction will create a transaction from the given arguments and sign it
+// with the key associated with args.From, decrypted with the given passwd. The
+// signed transaction is returned RLP encoded and is not submitted to the pool,
+// which allows it to be broadcast later or from another node. Because the node
+// cannot know the state the transaction will eventually be executed against, the
+// nonce, gas and gas price must be given explicitly.
+func (s *PrivateAccountAPI) SignTransaction(ctx context.Context, args SendTxArgs, passwd string) (*SignTransactionResult, error) {
+	if args.Nonce == nil {
+		return nil, fmt.Errorf("nonce not specified")
+	}
+	if args.Gas == nil {
+		return nil, fmt.Errorf("gas not specified")
+	}
+	if args.GasPrice == nil {
+		return nil, fmt.Errorf("gasPrice not specified")
+	}
+	if args.Value == nil {
+		args.Value = rpc.NewHexNumber(0)
+	}
+
+	var tx *types.Transaction
+	if args.To == nil {
+		tx = types.NewContractCreation(args.Nonce.Uint64(), args.Value.BigInt(), args.Gas.BigInt(), args.GasPrice.BigInt(), common.FromHex(args.Data))
+	} else {
+		tx = types.NewTransaction(args.Nonce.Uint64(), *args.To, args.Value.BigInt(), args.Gas.BigInt(), args.GasPrice.BigInt(), common.FromHex(args.Data))
+	}
+
+	signer := types.MakeSigner(s.b.ChainConfig(), s.b.CurrentBlock().Number())
+	signature, err := s.am.SignWithPassphrase(args.From, passwd, signer.Hash(tx).Bytes())
+	if err != nil {
+		return nil, err
+	}
+	signedTx, err := tx.WithSignature(signer, signature)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := rlp.EncodeToBytes(signedTx)
+	if err != nil {
+		return nil, err
+	}
+	return &SignTransactionResult{"0x" + common.Bytes2Hex(data), newTx(signedTx)}, nil
+}
+
 // signHash is a helper function that calculates a hash for the given message that can be
 // safely used to calculate a signature from. The hash is calulcated with:
 // keccak256("\x19Ethereum Signed Message:\n"${message length}${message}).
@@ -383,6 +463,30 @@ func (s *PublicBlockChainAPI) GetBalance(ctx context.Context, address common.Add
 	return state.GetBalance(ctx, address)
 }
 
+// maxBalanceAddresses is the maximum number of accounts GetBalances returns the balances of in a single request.
+const maxBalanceAddresses = 1000
+
+// GetBalances returns the balances of the given addresses in the state of the given block, in the order of the
+// addresses. All balances are read from the same state, so sweeps over many accounts see a consistent snapshot.
+func (s *PublicBlockChainAPI) GetBalances(ctx context.Context, addresses []common.Address, blockNr rpc.BlockNumber) ([]*rpc.HexNumber, error) {
+	if len(addresses) > maxBalanceAddresses {
+		return nil, fmt.Errorf("too many addresses: %d, limit %d", len(addresses), maxBalanceAddresses)
+	}
+	state, _, err := s.b.StateAndHeaderByNumber(ctx, blockNr)
+	if state == nil || err != nil {
+		return nil, err
+	}
+	balances := make([]*rpc.HexNumber, len(addresses))
+	for i, address := range addresses {
+		balance, err := state.GetBalance(ctx, address)
+		if err != nil {
+			return nil, err
+		}
+		balances[i] = rpc.NewHexNumber(balance)
+	}
+	return balances, nil
+}
+
 // GetBlockByNumber returns the requested block. When blockNr is -1 the chain head is returned. When fullTx is true all
 // transactions in the block are returned in full detail, otherwise only the transaction hash is returned.
 func (s *PublicBlockChainAPI) GetBlockByNumber(ctx context.Context, blockNr rpc.BlockNumber, fullTx bool) (map[string]interface{}, error) {
@@ -410,38 +514,112 @@ func (s *PublicBlockChainAPI) GetBlockByHash(ctx context.Context, blockHash comm
 	return nil, err
 }
 
-// GetUncleByBlockNumberAndIndex returns the uncle block for the given block hash and index. When fullTx is true
-// all transactions in the block are returned in full detail, otherwise only the transaction hash is returned.
+// GetUncleByBlockNumberAndIndex returns the uncle block for the given block number and index, along with the
+// reward paid to the uncle's miner for its inclusion.
 func (s *PublicBlockChainAPI) GetUncleByBlockNumberAndIndex(ctx context.Context, blockNr rpc.BlockNumber, index rpc.HexNumber) (map[string]interface{}, error) {
 	block, err := s.b.BlockByNumber(ctx, blockNr)
 	if block != nil {
-		uncles := block.Uncles()
-		if index.Int() < 0 || index.Int() >= len(uncles) {
+		if index.Int() < 0 || index.Int() >= len(block.Uncles()) {
 			glog.V(logger.Debug).Infof("uncle block on index %d not found for block #%d", index.Int(), blockNr)
 			return nil, nil
 		}
-		block = types.NewBlockWithHeader(uncles[index.Int()])
-		return s.rpcOutputBlock(block, false, false)
+		return s.rpcOutputUncle(block, index.Int())
 	}
 	return nil, err
 }
 
-// GetUncleByBlockHashAndIndex returns the uncle block for the given block hash and index. When fullTx is true
-// all transactions in the block are returned in full detail, otherwise only the transaction hash is returned.
+// GetUncleByBlockHashAndIndex returns the uncle block for the given block hash and index, along with the
+// reward paid to the uncle's miner for its inclusion.
 func (s *PublicBlockChainAPI) GetUncleByBlockHashAndIndex(ctx context.Context, blockHash common.Hash, index rpc.HexNumber) (map[string]interface{}, error) {
 	block, err := s.b.GetBlock(ctx, blockHash)
 	if block != nil {
-		uncles := block.Uncles()
-		if index.Int() < 0 || index.Int() >= len(uncles) {
+		if index.Int() < 0 || index.Int() >= len(block.Uncles()) {
 			glog.V(logger.Debug).Infof("uncle block on index %d not found for block %s", index.Int(), blockHash.Hex())
 			return nil, nil
 		}
-		block = types.NewBlockWithHeader(uncles[index.Int()])
-		return s.rpcOutputBlock(block, false, false)
+		return s.rpcOutputUncle(block, index.Int())
 	}
 	return nil, err
 }
 
+// rpcOutputUncle formats the uncle at the given index of block like a header-only block, adding the reward its
+// miner was paid for being included.
+func (s *PublicBlockChainAPI) rpcOutputUncle(block *types.Block, index int) (map[string]interface{}, error) {
+	uncle := block.Uncles()[index]
+	fields, err := s.rpcOutputBlock(types.NewBlockWithHeader(uncle), false, false)
+	if err != nil {
+		return nil, err
+	}
+	fields["reward"] = rpc.NewHexNumber(core.UncleReward(s.b.ChainConfig(), block.Header(), uncle))
+	return fields, nil
+}
+
+// maxUncleRewardBlocks is the maximum number of blocks GetUncleRewards scans in a single request.
+const maxUncleRewardBlocks = 10000
+
+// RPCUncleReward is the reward paid to a miner for one of its blocks included as an uncle.
+type RPCUncleReward struct {
+	BlockNumber *rpc.HexNumber `json:"blockNumber"`
+	BlockHash   common.Hash    `json:"blockHash"`
+	UncleIndex  *rpc.HexNumber `json:"uncleIndex"`
+	UncleHash   common.Hash    `json:"uncleHash"`
+	UncleNumber *rpc.HexNumber `json:"uncleNumber"`
+	Miner       common.Address `json:"miner"`
+	Reward      *rpc.HexNumber `json:"reward"`
+}
+
+// GetUncleRewards returns the rewards paid to miner for its uncles included in the blocks from fromBlock up to
+// and including toBlock, so mining pools can reconcile their uncle income. It is served as ur_getUncleRewards,
+// the ur namespace being an alias of eth.
+func (s *PublicBlockChainAPI) GetUncleRewards(ctx context.Context, miner common.Address, fromBlock, toBlock rpc.BlockNumber) ([]*RPCUncleReward, error) {
+	from, err := s.b.HeaderByNumber(ctx, fromBlock)
+	if from == nil {
+		if err == nil {
+			err = fmt.Errorf("block #%d not found", fromBlock)
+		}
+		return nil, err
+	}
+	to, err := s.b.HeaderByNumber(ctx, toBlock)
+	if to == nil {
+		if err == nil {
+			err = fmt.Errorf("block #%d not found", toBlock)
+		}
+		return nil, err
+	}
+	first, last := from.Number.Uint64(), to.Number.Uint64()
+	if first > last {
+		return nil, fmt.Errorf("invalid block range: #%d > #%d", first, last)
+	}
+	if last-first >= maxUncleRewardBlocks {
+		return nil, fmt.Errorf("block range too large: %d blocks, limit %d", last-first+1, maxUncleRewardBlocks)
+	}
+	rewards := []*RPCUncleReward{}
+	for n := first; n <= last; n++ {
+		block, err := s.b.BlockByNumber(ctx, rpc.BlockNumber(n))
+		if block == nil {
+			if err == nil {
+				err = fmt.Errorf("block #%d not found", n)
+			}
+			return nil, err
+		}
+		for i, uncle := range block.Uncles() {
+			if uncle.Coinbase != miner {
+				continue
+			}
+			rewards = append(rewards, &RPCUncleReward{
+				BlockNumber: rpc.NewHexNumber(block.Number()),
+				BlockHash:   block.Hash(),
+				UncleIndex:  rpc.NewHexNumber(i),
+				UncleHash:   uncle.Hash(),
+				UncleNumber: rpc.NewHexNumber(uncle.Number),
+				Miner:       uncle.Coinbase,
+				Reward:      rpc.NewHexNumber(core.UncleReward(s.b.ChainConfig(), block.Header(), uncle)),
+			})
+		}
+	}
+	return rewards, nil
+}
+
 // GetUncleCountByBlockNumber returns number of uncles in the block for the given block number
 func (s *PublicBlockChainAPI) GetUncleCountByBlockNumber(ctx context.Context, blockNr rpc.BlockNumber) *rpc.HexNumber {
 	if block, _ := s.b.BlockByNumber(ctx, blockNr); block != nil {
@@ -516,12 +694,12 @@ type CallArgs struct {
 	Data     string          `json:"data"`
 }
 
-func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber) (string, *big.Int, error) {
+func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber) (string, *big.Int, bool, error) {
 	defer func(start time.Time) { glog.V(logger.Debug).Infof("call took %v", time.Since(start)) }(time.Now())
 
 	state, header, err := s.b.StateAndHeaderByNumber(ctx, blockNr)
 	if state == nil || err != nil {
-		return "0x", common.Big0, err
+		return "0x", common.Big0, false, err
 	}
 
 	// Set the account address to interact with
@@ -550,30 +728,99 @@ func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr
 	// Execute the call and return
 	vmenv, vmError, err := s.b.GetVMEnv(ctx, msg, state, header)
 	if err != nil {
-		return "0x", common.Big0, err
+		return "0x", common.Big0, false, err
 	}
 	gp := new(core.GasPool).AddGas(common.MaxBig)
-	res, gas, err := core.ApplyMessage(vmenv, msg, gp)
+	st := core.NewStateTransition(vmenv, msg, gp)
+	res, _, gas, err := st.TransitionDb()
 	if err := vmError(); err != nil {
-		return "0x", common.Big0, err
+		return "0x", common.Big0, false, err
 	}
 	if len(res) == 0 { // backwards compatability
-		return "0x", gas, err
+		return "0x", gas, st.Failed(), err
 	}
-	return common.ToHex(res), gas, err
+	return common.ToHex(res), gas, st.Failed(), err
 }
 
 // Call executes the given transaction on the state for the given block number.
 // It doesn't make and changes in the state/blockchain and is usefull to execute and retrieve values.
 func (s *PublicBlockChainAPI) Call(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber) (string, error) {
-	result, _, err := s.doCall(ctx, args, blockNr)
-	return result, err
+	result, _, _, err := s.doCall(ctx, args, blockNr)
+	return result, rpcError(err)
 }
 
+// gasEstimateMargin is the percentage added on top of the lowest gas limit found
+// to be sufficient for transactions executing code, absorbing state changes
+// between estimation and inclusion.
+const gasEstimateMargin = 10
+
 // EstimateGas returns an estimate of the amount of gas needed to execute the given transaction.
+//
+// The estimate is the lowest gas limit the transaction succeeds with on top of the
+// pending state, found by binary searching over real executions capped by the
+// given gas or the pending block gas limit, whichever is lower. Searching instead
+// of measuring the used gas handles contracts whose behaviour depends on the gas
+// remaining, and runs signups through the same UR specific transition they will
+// be mined with.
 func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args CallArgs) (*rpc.HexNumber, error) {
-	_, gas, err := s.doCall(ctx, args, rpc.PendingBlockNumber)
-	return rpc.NewHexNumber(gas), err
+	header, err := s.b.HeaderByNumber(ctx, rpc.PendingBlockNumber)
+	if header == nil || err != nil {
+		return nil, err
+	}
+	allowance := header.GasLimit.Uint64()
+	if gas := args.Gas.BigInt(); gas.Sign() > 0 && gas.Cmp(header.GasLimit) < 0 {
+		allowance = gas.Uint64()
+	}
+	homestead := s.b.ChainConfig().IsHomestead(header.Number)
+	intrinsic := core.IntrinsicGas(common.FromHex(args.Data), args.To == nil, homestead).Uint64()
+
+	// The transaction is executable with a gas limit if the EVM doesn't abort,
+	// running out of gas or otherwise
+	executable := func(gas uint64) (bool, error) {
+		args.Gas = *rpc.NewHexNumber(gas)
+		_, _, failed, err := s.doCall(ctx, args, rpc.PendingBlockNumber)
+		if err != nil {
+			return false, err
+		}
+		return !failed, nil
+	}
+	gas, err := searchGas(intrinsic, allowance, executable)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	return rpc.NewHexNumber(gas), nil
+}
+
+// searchGas binary searches the lowest gas limit between intrinsic and allowance
+// the transaction is executable with, adding a safety margin if it runs code.
+func searchGas(intrinsic, allowance uint64, executable func(gas uint64) (bool, error)) (uint64, error) {
+	// Make sure the transaction can succeed at all before searching
+	if ok, err := executable(allowance); err != nil {
+		return 0, err
+	} else if !ok {
+		return 0, &codedError{ErrCodeOutOfGas, fmt.Errorf("gas required exceeds allowance (%d) or always failing transaction", allowance)}
+	}
+	lo, hi := intrinsic-1, allowance
+	for lo+1 < hi {
+		mid := (lo + hi) / 2
+		ok, err := executable(mid)
+		if err != nil && !core.IsInvalidTxErr(err) {
+			return 0, err
+		}
+		if ok {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	// Leave some headroom if code is executed, plain transfers cost exactly the intrinsic gas
+	if hi > intrinsic {
+		hi += hi * gasEstimateMargin / 100
+		if hi > allowance {
+			hi = allowance
+		}
+	}
+	return hi, nil
 }
 
 // ExecutionResult groups all structured logs emitted by the EVM
@@ -707,8 +954,8 @@ type RPCTransaction struct {
 	S                *rpc.HexNumber  `json:"s"`
 }
 
-// newRPCPendingTransaction returns a pending transaction that will serialize to the RPC representation
-func newRPCPendingTransaction(tx *types.Transaction) *RPCTransaction {
+// NewRPCPendingTransaction returns a pending transaction that will serialize to the RPC representation.
+func NewRPCPendingTransaction(tx *types.Transaction) *RPCTransaction {
 	var signer types.Signer = types.FrontierSigner{}
 	if tx.Protected() {
 		signer = types.NewEIP155Signer(tx.ChainId())
@@ -784,12 +1031,14 @@ func newRPCTransaction(b *types.Block, txHash common.Hash) (*RPCTransaction, err
 
 // PublicTransactionPoolAPI exposes methods for the RPC interface
 type PublicTransactionPoolAPI struct {
-	b Backend
+	b         Backend
+	nonceLock *AddrLocker
 }
 
 // NewPublicTransactionPoolAPI creates a new RPC service with methods specific for the transaction pool.
-func NewPublicTransactionPoolAPI(b Backend) *PublicTransactionPoolAPI {
-	return &PublicTransactionPoolAPI{b}
+// The nonce lock is shared with the other APIs sending transactions from the node's accounts.
+func NewPublicTransactionPoolAPI(b Backend, nonceLock *AddrLocker) *PublicTransactionPoolAPI {
+	return &PublicTransactionPoolAPI{b, nonceLock}
 }
 
 func getTransaction(chainDb ethdb.Database, b Backend, txHash common.Hash) (*types.Transaction, bool, error) {
@@ -858,8 +1107,16 @@ func (s *PublicTransactionPoolAPI) GetRawTransactionByBlockHashAndIndex(ctx cont
 	return nil, nil
 }
 
-// GetTransactionCount returns the number of transactions the given address has sent for the given block number
+// GetTransactionCount returns the number of transactions the given address has sent for the given block number.
+// For the pending block it is the next nonce of the address, counting the executable transactions in the pool.
 func (s *PublicTransactionPoolAPI) GetTransactionCount(ctx context.Context, address common.Address, blockNr rpc.BlockNumber) (*rpc.HexNumber, error) {
+	if blockNr == rpc.PendingBlockNumber {
+		nonce, err := s.b.GetPoolNonce(ctx, address)
+		if err != nil {
+			return nil, err
+		}
+		return rpc.NewHexNumber(nonce), nil
+	}
 	state, _, err := s.b.StateAndHeaderByNumber(ctx, blockNr)
 	if state == nil || err != nil {
 		return nil, err
@@ -907,7 +1164,7 @@ func (s *PublicTransactionPoolAPI) GetTransactionByHash(ctx context.Context, txH
 	}
 
 	if isPending {
-		return newRPCPendingTransaction(tx), nil
+		return NewRPCPendingTransaction(tx), nil
 	}
 
 	blockHash, _, _, err := getTransactionBlockData(s.b.ChainDb(), txHash)
@@ -1038,7 +1295,7 @@ func submitTransaction(ctx context.Context, b Backend, tx *types.Transaction, si
 	}
 
 	if err := b.SendTx(ctx, signedTx); err != nil {
-		return common.Hash{}, err
+		return common.Hash{}, rpcError(err)
 	}
 
 	if signedTx.To() == nil {
@@ -1055,6 +1312,9 @@ func submitTransaction(ctx context.Context, b Backend, tx *types.Transaction, si
 // SendTransaction creates a transaction for the given argument, sign it and submit it to the
 // transaction pool.
 func (s *PublicTransactionPoolAPI) SendTransaction(ctx context.Context, args SendTxArgs) (common.Hash, error) {
+	s.nonceLock.LockAddr(args.From)
+	defer s.nonceLock.UnlockAddr(args.From)
+
 	var err error
 	args, err = prepareSendTxArgs(ctx, args, s.b)
 	if err != nil {
@@ -1079,7 +1339,7 @@ func (s *PublicTransactionPoolAPI) SendTransaction(ctx context.Context, args Sen
 	signer := types.MakeSigner(s.b.ChainConfig(), s.b.CurrentBlock().Number())
 	signature, err := s.b.AccountManager().SignEthereum(args.From, signer.Hash(tx).Bytes())
 	if err != nil {
-		return common.Hash{}, err
+		return common.Hash{}, rpcError(err)
 	}
 
 	return submitTransaction(ctx, s.b, tx, signature)
@@ -1094,7 +1354,7 @@ func (s *PublicTransactionPoolAPI) SendRawTransaction(ctx context.Context, encod
 	}
 
 	if err := s.b.SendTx(ctx, tx); err != nil {
-		return "", err
+		return "", rpcError(err)
 	}
 
 	signer := types.MakeSigner(s.b.ChainConfig(), s.b.CurrentBlock().Number())
@@ -1285,7 +1545,7 @@ func (s *PublicTransactionPoolAPI) PendingTransactions() []*RPCTransaction {
 		}
 		from, _ := types.Sender(signer, tx)
 		if s.b.AccountManager().HasAddress(from) {
-			transactions = append(transactions, newRPCPendingTransaction(tx))
+			transactions = append(transactions, NewRPCPendingTransaction(tx))
 		}
 	}
 	return transactions
@@ -1318,12 +1578,12 @@ func (s *PublicTransactionPoolAPI) Resend(ctx context.Context, tx Tx, gasPrice,
 
 			signedTx, err := s.sign(tx.From, newTx)
 			if err != nil {
-				return common.Hash{}, err
+				return common.Hash{}, rpcError(err)
 			}
 
 			s.b.RemoveTx(tx.Hash)
 			if err = s.b.SendTx(ctx, signedTx); err != nil {
-				return common.Hash{}, err
+				return common.Hash{}, rpcError(err)
 			}
 
 			return signedTx.Hash(), nil
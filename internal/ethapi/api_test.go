@@ -0,0 +1,346 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ur-technology/go-ur/accounts"
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core"
+	"github.com/ur-technology/go-ur/core/state"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/core/vm"
+	"github.com/ur-technology/go-ur/ethdb"
+	"github.com/ur-technology/go-ur/event"
+	"github.com/ur-technology/go-ur/params"
+	"github.com/ur-technology/go-ur/rlp"
+	"github.com/ur-technology/go-ur/rpc"
+	"golang.org/x/net/context"
+)
+
+// testBackend is an API backend on top of a chain holding only the genesis
+// block, serving its state for every block number.
+type testBackend struct {
+	Backend
+	chain *core.BlockChain
+	am    *accounts.Manager
+
+	pending, queued map[common.Address]types.Transactions // Transaction pool content
+}
+
+// testState exposes the state of a testBackend.
+type testState struct {
+	state *state.StateDB
+}
+
+func (s testState) GetBalance(ctx context.Context, addr common.Address) (*big.Int, error) {
+	return s.state.GetBalance(addr), nil
+}
+
+func (s testState) GetCode(ctx context.Context, addr common.Address) ([]byte, error) {
+	return s.state.GetCode(addr), nil
+}
+
+func (s testState) GetState(ctx context.Context, a common.Address, b common.Hash) (common.Hash, error) {
+	return s.state.GetState(a, b), nil
+}
+
+func (s testState) GetNonce(ctx context.Context, addr common.Address) (uint64, error) {
+	return s.state.GetNonce(addr), nil
+}
+
+// newTestBackend creates a backend whose genesis state allocates the given
+// balances and contract codes, both keyed by address.
+func newTestBackend(t *testing.T, balances map[common.Address]*big.Int, codes map[common.Address]string) *testBackend {
+	var alloc []string
+	for addr, balance := range balances {
+		alloc = append(alloc, fmt.Sprintf(`"%x":{"balance":"%v"}`, addr, balance))
+	}
+	for addr, code := range codes {
+		alloc = append(alloc, fmt.Sprintf(`"%x":{"balance":"0","code":"%s"}`, addr, code))
+	}
+	genesis := fmt.Sprintf(`{
+	"config":{"homesteadBlock":0},
+	"nonce":"0x0000000000000042",
+	"gasLimit":"0x%x",
+	"difficulty":"0x%x",
+	"alloc":{%s}
+}`, params.GenesisGasLimit, params.GenesisDifficulty, strings.Join(alloc, ","))
+
+	db, _ := ethdb.NewMemDatabase()
+	if _, err := core.WriteGenesisBlock(db, strings.NewReader(genesis)); err != nil {
+		t.Fatalf("failed to write genesis: %v", err)
+	}
+	config := &params.ChainConfig{HomesteadBlock: big.NewInt(0)}
+	chain, err := core.NewBlockChain(db, config, new(core.FakePow), new(event.TypeMux))
+	if err != nil {
+		t.Fatalf("failed to create blockchain: %v", err)
+	}
+	return &testBackend{chain: chain}
+}
+
+func (b *testBackend) ChainConfig() *params.ChainConfig  { return b.chain.Config() }
+func (b *testBackend) CurrentBlock() *types.Block        { return b.chain.CurrentBlock() }
+func (b *testBackend) AccountManager() *accounts.Manager { return b.am }
+
+func (b *testBackend) HeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*types.Header, error) {
+	return b.chain.CurrentHeader(), nil
+}
+
+func (b *testBackend) BlockByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*types.Block, error) {
+	return b.chain.GetBlockByNumber(uint64(blockNr)), nil
+}
+
+func (b *testBackend) StateAndHeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (State, *types.Header, error) {
+	statedb, err := b.chain.State()
+	if err != nil {
+		return nil, nil, err
+	}
+	return testState{statedb}, b.chain.CurrentHeader(), nil
+}
+
+func (b *testBackend) GetVMEnv(ctx context.Context, msg core.Message, st State, header *types.Header) (vm.Environment, func() error, error) {
+	statedb := st.(testState).state
+	statedb.GetOrNewStateObject(msg.From()).SetBalance(common.MaxBig)
+	return core.NewEnv(statedb, b.chain.Config(), b.chain, msg, header, vm.Config{}), func() error { return nil }, nil
+}
+
+func (b *testBackend) TxPoolContent() (map[common.Address]types.Transactions, map[common.Address]types.Transactions) {
+	return b.pending, b.queued
+}
+
+// Tests that the transaction pool content and inspection key the transactions
+// of an account by their nonces, not by their position in the pool.
+func TestTxPoolContentNonces(t *testing.T) {
+	var (
+		from = common.HexToAddress("0x1000000000000000000000000000000000000001")
+		to   = common.HexToAddress("0x2000000000000000000000000000000000000002")
+	)
+	tx := func(nonce uint64) *types.Transaction {
+		return types.NewTransaction(nonce, to, big.NewInt(1), big.NewInt(21000), big.NewInt(1), nil)
+	}
+	api := NewPublicTxPoolAPI(&testBackend{
+		pending: map[common.Address]types.Transactions{from: {tx(3), tx(4)}},
+		queued:  map[common.Address]types.Transactions{from: {tx(7)}},
+	})
+	want := map[string][]string{"pending": {"3", "4"}, "queued": {"7"}}
+
+	content, inspect := api.Content(), api.Inspect()
+	for kind, nonces := range want {
+		if have := len(content[kind][from.Hex()]); have != len(nonces) {
+			t.Errorf("%s content count mismatch: have %d, want %d", kind, have, len(nonces))
+		}
+		if have := len(inspect[kind][from.Hex()]); have != len(nonces) {
+			t.Errorf("%s inspect count mismatch: have %d, want %d", kind, have, len(nonces))
+		}
+		for _, nonce := range nonces {
+			if tx := content[kind][from.Hex()][nonce]; tx == nil || fmt.Sprintf("%d", tx.Nonce.Uint64()) != nonce {
+				t.Errorf("%s content: transaction with nonce %s missing: %v", kind, nonce, tx)
+			}
+			if _, ok := inspect[kind][from.Hex()][nonce]; !ok {
+				t.Errorf("%s inspect: transaction with nonce %s missing", kind, nonce)
+			}
+		}
+	}
+}
+
+// Tests that personal_signTransaction signs with the unlocked key of the sender
+// and returns the transaction without submitting it.
+func TestSignTransaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ethapi-sign-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	backend := newTestBackend(t, nil, nil)
+	backend.am = accounts.NewManager(dir, accounts.LightScryptN, accounts.LightScryptP)
+	account, err := backend.am.NewAccount("secret")
+	if err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+	api := NewPrivateAccountAPI(backend, new(AddrLocker))
+
+	to := common.HexToAddress("0x2000000000000000000000000000000000000002")
+	args := SendTxArgs{
+		From:     account.Address,
+		To:       &to,
+		Nonce:    rpc.NewHexNumber(5),
+		Gas:      rpc.NewHexNumber(21000),
+		GasPrice: rpc.NewHexNumber(1),
+		Value:    rpc.NewHexNumber(100),
+	}
+	if _, err := api.SignTransaction(context.Background(), args, "wrong"); err == nil {
+		t.Errorf("signed with a wrong passphrase")
+	}
+	noNonce := args
+	noNonce.Nonce = nil
+	if _, err := api.SignTransaction(context.Background(), noNonce, "secret"); err == nil {
+		t.Errorf("signed without a nonce")
+	}
+	res, err := api.SignTransaction(context.Background(), args, "secret")
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(common.FromHex(res.Raw), tx); err != nil {
+		t.Fatalf("failed to decode signed transaction: %v", err)
+	}
+	signer := types.MakeSigner(backend.ChainConfig(), backend.CurrentBlock().Number())
+	if from, err := types.Sender(signer, tx); err != nil || from != account.Address {
+		t.Errorf("sender mismatch: have %x (%v), want %x", from, err, account.Address)
+	}
+	if tx.Nonce() != 5 || *tx.To() != to || tx.Value().Cmp(big.NewInt(100)) != 0 {
+		t.Errorf("transaction mismatch: nonce %d, to %x, value %v", tx.Nonce(), tx.To(), tx.Value())
+	}
+}
+
+// Tests that gas estimation executes the transaction for real, estimating the
+// intrinsic gas of plain transfers and the lowest gas limit code succeeds with.
+func TestEstimateGas(t *testing.T) {
+	var (
+		sender   = common.HexToAddress("0x1000000000000000000000000000000000000001")
+		receiver = common.HexToAddress("0x2000000000000000000000000000000000000002")
+		guarded  = common.HexToAddress("0x3000000000000000000000000000000000000003")
+		failing  = common.HexToAddress("0x4000000000000000000000000000000000000004")
+	)
+	// The guarded contract aborts unless at least 50000 gas remains when it
+	// starts, the failing one always aborts
+	api := NewPublicBlockChainAPI(newTestBackend(t, nil, map[common.Address]string{
+		guarded: "6200c3505a10600a57005bfe", // PUSH3 50000 GAS LT PUSH1 10 JUMPI STOP JUMPDEST INVALID
+		failing: "fe",                       // INVALID
+	}))
+	tests := []struct {
+		to   common.Address
+		want uint64 // Expected estimate, 0 if the estimation fails
+	}{
+		{receiver, 21000},
+		{guarded, (21000 + 3 + 2 + 50000) * (100 + gasEstimateMargin) / 100},
+		{failing, 0},
+	}
+	for i, tt := range tests {
+		to := tt.to
+		gas, err := api.EstimateGas(context.Background(), CallArgs{From: sender, To: &to})
+		if tt.want == 0 {
+			if coded, ok := err.(*codedError); !ok || coded.code != ErrCodeOutOfGas {
+				t.Errorf("test %d: error mismatch: have %v, want out of gas", i, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: estimation failed: %v", i, err)
+			continue
+		}
+		if gas.Uint64() != tt.want {
+			t.Errorf("test %d: estimate mismatch: have %d, want %d", i, gas.Uint64(), tt.want)
+		}
+	}
+}
+
+// Tests that gas estimation finds the lowest sufficient gas limit even if the
+// execution uses less gas than it needs to be given, as with contracts checking
+// the gas remaining before a call.
+func TestSearchGas(t *testing.T) {
+	const intrinsic, allowance = 21000, 4712388
+
+	tests := []struct {
+		required uint64 // Lowest gas limit the transaction succeeds with
+		want     uint64 // Expected estimate
+	}{
+		{21000, 21000},       // Plain transfer, no margin
+		{50000, 55000},       // Code execution, 10% margin
+		{4500000, allowance}, // Margin capped by the allowance
+		{allowance + 1, 0},   // Never succeeds
+	}
+	for i, tt := range tests {
+		executable := func(gas uint64) (bool, error) {
+			if gas < intrinsic {
+				return false, core.InvalidTxError(vm.OutOfGasError)
+			}
+			return gas >= tt.required, nil
+		}
+		gas, err := searchGas(intrinsic, allowance, executable)
+		if tt.want == 0 {
+			if coded, ok := err.(*codedError); !ok || coded.code != ErrCodeOutOfGas {
+				t.Errorf("test %d: error mismatch: have %v, want out of gas", i, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: estimation failed: %v", i, err)
+			continue
+		}
+		if gas != tt.want {
+			t.Errorf("test %d: estimate mismatch: have %d, want %d", i, gas, tt.want)
+		}
+	}
+}
+
+// Tests that the uncle rewards are served in the ur namespace.
+func TestGetUncleRewardsNamespace(t *testing.T) {
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", NewPublicBlockChainAPI(newTestBackend(t, nil, nil))); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	var rewards []*RPCUncleReward
+	if err := client.Call(&rewards, "ur_getUncleRewards", common.Address{}, "0x0", "0x0"); err != nil {
+		t.Fatalf("failed to call ur_getUncleRewards: %v", err)
+	}
+	if rewards == nil || len(rewards) != 0 {
+		t.Errorf("uncle rewards mismatch: have %v, want none", rewards)
+	}
+}
+
+// Tests that the balances of many accounts are returned in the order of the
+// requested addresses, and that oversized requests are rejected.
+func TestGetBalances(t *testing.T) {
+	var (
+		rich  = common.Address{0x01}
+		poor  = common.Address{0x02}
+		empty = common.Address{0x03}
+	)
+	api := NewPublicBlockChainAPI(newTestBackend(t, map[common.Address]*big.Int{
+		rich: big.NewInt(1000000),
+		poor: big.NewInt(1),
+	}, nil))
+
+	balances, err := api.GetBalances(context.Background(), []common.Address{poor, empty, rich, poor}, rpc.LatestBlockNumber)
+	if err != nil {
+		t.Fatalf("failed to get balances: %v", err)
+	}
+	want := []int64{1, 0, 1000000, 1}
+	if len(balances) != len(want) {
+		t.Fatalf("balance count mismatch: have %d, want %d", len(balances), len(want))
+	}
+	for i, balance := range balances {
+		if balance.BigInt().Int64() != want[i] {
+			t.Errorf("balance %d mismatch: have %v, want %d", i, balance.BigInt(), want[i])
+		}
+	}
+	if _, err := api.GetBalances(context.Background(), make([]common.Address, maxBalanceAddresses+1), rpc.LatestBlockNumber); err == nil {
+		t.Errorf("accepted %d addresses, limit %d", maxBalanceAddresses+1, maxBalanceAddresses)
+	}
+}
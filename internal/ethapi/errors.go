@@ -0,0 +1,116 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"github.com/ur-technology/go-ur/accounts"
+	"github.com/ur-technology/go-ur/core"
+	"github.com/ur-technology/go-ur/core/vm"
+)
+
+// Error codes returned in the JSON-RPC error objects of failed transaction
+// submissions and calls. They are part of the public API: existing codes must
+// never be renumbered, new ones are only ever appended. Errors without a more
+// specific code are reported with the generic -32000 server error code.
+const (
+	ErrCodeInsufficientFunds   = -32010 // Sender can't pay for value + gas * price
+	ErrCodeNonceTooLow         = -32011 // Nonce already used by the sender
+	ErrCodeReplaceUnderpriced  = -32012 // Same nonce transaction pending, gas price not bumped enough
+	ErrCodeGasPriceTooLow      = -32013 // Gas price below the node's minimum
+	ErrCodeIntrinsicGas        = -32014 // Gas limit below the transaction's intrinsic gas
+	ErrCodeGasLimitExceeded    = -32015 // Gas limit above the block gas limit
+	ErrCodeInvalidSender       = -32016 // Signature doesn't recover to a valid sender
+	ErrCodeNegativeValue       = -32017 // Negative transaction value
+	ErrCodeKnownTransaction    = -32018 // Transaction already in the pool
+	ErrCodeRewardRuleRejected  = -32019 // Signup transaction not honoured by the reward rules
+	ErrCodeOutOfGas            = -32020 // Execution ran out of gas
+	ErrCodeAccountLocked       = -32021 // Signing account is locked
+	ErrCodeUnknownAccount      = -32022 // No key for the signing account
+	ErrCodeInvalidPassphrase   = -32023 // Passphrase can't decrypt the signing key
+	ErrCodeNonExistentAccount  = -32024 // Sender account doesn't exist
+	ErrCodeInsufficientBalance = -32025 // Sender balance too low
+)
+
+// codedError is an error reported to RPC clients along with a stable code.
+type codedError struct {
+	code int
+	err  error
+}
+
+func (e *codedError) Error() string  { return e.err.Error() }
+func (e *codedError) ErrorCode() int { return e.code }
+
+// errorCode returns the stable RPC error code of err, or 0 if it has none.
+func errorCode(err error) int {
+	switch err {
+	case core.ErrInsufficientFunds:
+		return ErrCodeInsufficientFunds
+	case core.ErrNonce:
+		return ErrCodeNonceTooLow
+	case core.ErrReplaceUnderpriced:
+		return ErrCodeReplaceUnderpriced
+	case core.ErrCheap:
+		return ErrCodeGasPriceTooLow
+	case core.ErrIntrinsicGas:
+		return ErrCodeIntrinsicGas
+	case core.ErrGasLimit:
+		return ErrCodeGasLimitExceeded
+	case core.ErrInvalidSender:
+		return ErrCodeInvalidSender
+	case core.ErrNegativeValue:
+		return ErrCodeNegativeValue
+	case core.ErrNonExistentAccount:
+		return ErrCodeNonExistentAccount
+	case core.ErrBalance:
+		return ErrCodeInsufficientBalance
+	case vm.OutOfGasError, vm.CodeStoreOutOfGasError:
+		return ErrCodeOutOfGas
+	case accounts.ErrLocked:
+		return ErrCodeAccountLocked
+	case accounts.ErrNoMatch:
+		return ErrCodeUnknownAccount
+	case accounts.ErrDecrypt:
+		return ErrCodeInvalidPassphrase
+	}
+	switch {
+	case core.IsKnownTxErr(err):
+		return ErrCodeKnownTransaction
+	case core.IsRewardRuleErr(err):
+		return ErrCodeRewardRuleRejected
+	case core.IsNonceErr(err):
+		return ErrCodeNonceTooLow
+	case core.IsGasLimitErr(err):
+		return ErrCodeGasLimitExceeded
+	case core.IsInvalidTxErr(err):
+		if cause := err.(*core.InvalidTxErr).Err; cause != nil {
+			return errorCode(cause)
+		}
+	}
+	return 0
+}
+
+// rpcError attaches the stable RPC error code to err if it has one, leaving it
+// untouched otherwise.
+func rpcError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if code := errorCode(err); code != 0 {
+		return &codedError{code, err}
+	}
+	return err
+}
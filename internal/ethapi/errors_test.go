@@ -0,0 +1,67 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core"
+	"github.com/ur-technology/go-ur/core/vm"
+	"github.com/ur-technology/go-ur/rpc"
+)
+
+// Tests that transaction errors are reported with their stable codes and that
+// errors without one are left untouched.
+func TestRPCErrorCodes(t *testing.T) {
+	tests := []struct {
+		err  error
+		code int
+	}{
+		{core.ErrInsufficientFunds, ErrCodeInsufficientFunds},
+		{core.ErrNonce, ErrCodeNonceTooLow},
+		{core.NonceError(1, 2), ErrCodeNonceTooLow},
+		{core.ErrReplaceUnderpriced, ErrCodeReplaceUnderpriced},
+		{core.ErrCheap, ErrCodeGasPriceTooLow},
+		{&core.KnownTxErr{Hash: common.Hash{1}}, ErrCodeKnownTransaction},
+		{&core.RewardRuleErr{Message: "signup rejected"}, ErrCodeRewardRuleRejected},
+		{core.InvalidTxError(vm.OutOfGasError), ErrCodeOutOfGas},
+		{vm.CodeStoreOutOfGasError, ErrCodeOutOfGas},
+	}
+	for i, tt := range tests {
+		err := rpcError(tt.err)
+		coded, ok := err.(rpc.Error)
+		if !ok {
+			t.Errorf("test %d: error %q has no code", i, tt.err)
+			continue
+		}
+		if coded.ErrorCode() != tt.code {
+			t.Errorf("test %d: code mismatch: have %d, want %d", i, coded.ErrorCode(), tt.code)
+		}
+		if coded.Error() != tt.err.Error() {
+			t.Errorf("test %d: message mismatch: have %q, want %q", i, coded.Error(), tt.err.Error())
+		}
+	}
+	plain := errors.New("something else")
+	if err := rpcError(plain); err != plain {
+		t.Errorf("uncoded error modified: have %v, want %v", err, plain)
+	}
+	if err := rpcError(nil); err != nil {
+		t.Errorf("nil error turned into %v", err)
+	}
+}
@@ -298,7 +298,7 @@ func (self *JSRE) loadScript(call otto.FunctionCall) otto.Value {
 }
 
 // Evaluate executes code and pretty prints the result to the specified output
-// stream.
+// stream. Exceptions thrown by the code are printed and returned as well.
 func (self *JSRE) Evaluate(code string, w io.Writer) error {
 	var fail error
 
@@ -306,6 +306,7 @@ func (self *JSRE) Evaluate(code string, w io.Writer) error {
 		val, err := vm.Run(code)
 		if err != nil {
 			prettyError(vm, err, w)
+			fail = err
 		} else {
 			prettyPrint(vm, val, w)
 		}
@@ -30,6 +30,7 @@ var Modules = map[string]string{
 	"rpc":        RPC_JS,
 	"shh":        Shh_JS,
 	"txpool":     TxPool_JS,
+	"watchlist":  Watchlist_JS,
 }
 
 const Bzz_JS = `
@@ -174,6 +175,16 @@ web3._extend({
 			call: 'admin_removePeer',
 			params: 1
 		}),
+		new web3._extend.Method({
+			name: 'addTrustedPeer',
+			call: 'admin_addTrustedPeer',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'removeTrustedPeer',
+			call: 'admin_removeTrustedPeer',
+			params: 1
+		}),
 		new web3._extend.Method({
 			name: 'exportChain',
 			call: 'admin_exportChain',
@@ -214,6 +225,14 @@ web3._extend({
 		new web3._extend.Method({
 			name: 'stopWS',
 			call: 'admin_stopWS'
+		}),
+		new web3._extend.Method({
+			name: 'reloadConfig',
+			call: 'admin_reloadConfig'
+		}),
+		new web3._extend.Method({
+			name: 'reloadPeers',
+			call: 'admin_reloadPeers'
 		})
 	],
 	properties:
@@ -254,6 +273,11 @@ web3._extend({
 			call: 'debug_setHead',
 			params: 1
 		}),
+		new web3._extend.Method({
+			name: 'getBadBlocks',
+			call: 'debug_getBadBlocks',
+			params: 0
+		}),
 		new web3._extend.Method({
 			name: 'traceBlock',
 			call: 'debug_traceBlock',
@@ -438,6 +462,30 @@ web3._extend({
 			},
 			params: 2,
 			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter, web3._extend.utils.toHex]
+		}),
+		new web3._extend.Method({
+			name: 'getBalances',
+			call: 'eth_getBalances',
+			params: 2,
+			inputFormatter: [null, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getUncleRewards',
+			call: 'ur_getUncleRewards',
+			params: 3,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter, web3._extend.formatters.inputBlockNumberFormatter, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'blockStats',
+			call: 'eth_blockStats',
+			params: 2,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'getBalanceProvenance',
+			call: 'eth_getBalanceProvenance',
+			params: 3,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter, web3._extend.formatters.inputBlockNumberFormatter, web3._extend.formatters.inputBlockNumberFormatter]
 		})
 	],
 	properties:
@@ -473,6 +521,20 @@ web3._extend({
 			name: 'stop',
 			call: 'miner_stop'
 		}),
+		new web3._extend.Method({
+			name: 'setThreads',
+			call: 'miner_setThreads',
+			params: 1,
+			inputFormatter: [web3._extend.utils.fromDecimal]
+		}),
+		new web3._extend.Method({
+			name: 'pause',
+			call: 'miner_pause'
+		}),
+		new web3._extend.Method({
+			name: 'resume',
+			call: 'miner_resume'
+		}),
 		new web3._extend.Method({
 			name: 'setEtherbase',
 			call: 'miner_setEtherbase',
@@ -490,6 +552,12 @@ web3._extend({
 			params: 1,
 			inputFormatter: [web3._extend.utils.fromDecimal]
 		}),
+		new web3._extend.Method({
+			name: 'setGasLimit',
+			call: 'miner_setGasLimit',
+			params: 1,
+			inputFormatter: [web3._extend.utils.fromDecimal]
+		}),
 		new web3._extend.Method({
 			name: 'startAutoDAG',
 			call: 'miner_startAutoDAG',
@@ -505,9 +573,28 @@ web3._extend({
 			call: 'miner_makeDAG',
 			params: 1,
 			inputFormatter: [web3._extend.formatters.inputDefaultBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'pendingBlockProfile',
+			call: 'miner_pendingBlockProfile',
+			params: 0
 		})
 	],
-	properties: []
+	properties:
+	[
+		new web3._extend.Property({
+			name: 'workers',
+			getter: 'miner_workers'
+		}),
+		new web3._extend.Property({
+			name: 'hashrate',
+			getter: 'miner_hashrate'
+		}),
+		new web3._extend.Property({
+			name: 'payouts',
+			getter: 'miner_payouts'
+		})
+	]
 });
 `
 
@@ -541,6 +628,12 @@ web3._extend({
 			params: 2,
 			inputFormatter: [web3._extend.formatters.inputTransactionFormatter, null]
 		}),
+		new web3._extend.Method({
+			name: 'signTransaction',
+			call: 'personal_signTransaction',
+			params: 2,
+			inputFormatter: [web3._extend.formatters.inputTransactionFormatter, null]
+		}),
 		new web3._extend.Method({
 			name: 'sign',
 			call: 'personal_sign',
@@ -607,6 +700,37 @@ web3._extend({
 				status.queued = web3._extend.utils.toDecimal(status.queued);
 				return status;
 			}
+		}),
+		new web3._extend.Property({
+			name: 'queueAges',
+			getter: 'txpool_queueAges'
+		})
+	]
+});
+`
+
+const Watchlist_JS = `
+web3._extend({
+	property: 'watchlist',
+	methods:
+	[
+		new web3._extend.Method({
+			name: 'add',
+			call: 'watchlist_add',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'remove',
+			call: 'watchlist_remove',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter]
+		})
+	],
+	properties:
+	[
+		new web3._extend.Property({
+			name: 'list',
+			getter: 'watchlist_list'
 		})
 	]
 });
@@ -17,6 +17,7 @@
 package les
 
 import (
+	"errors"
 	"math/big"
 
 	"github.com/ur-technology/go-ur/accounts"
@@ -84,6 +85,15 @@ func (b *LesApiBackend) GetReceipts(ctx context.Context, blockHash common.Hash)
 	return light.GetBlockReceipts(ctx, b.eth.odr, blockHash, core.GetBlockNumber(b.eth.chainDb, blockHash))
 }
 
+// BloomStatus reports an empty bloom bits index, light clients don't build one.
+func (b *LesApiBackend) BloomStatus() (uint64, uint64) {
+	return core.BloomBitsSectionSize, 0
+}
+
+func (b *LesApiBackend) GetBloomBits(ctx context.Context, bit uint, section uint64) ([]byte, error) {
+	return nil, errors.New("bloom bits index not available")
+}
+
 func (b *LesApiBackend) GetTd(blockHash common.Hash) *big.Int {
 	return b.eth.blockchain.GetTdByHash(blockHash)
 }
@@ -124,6 +134,12 @@ func (b *LesApiBackend) Stats() (pending int, queued int) {
 	return b.eth.txPool.Stats(), 0
 }
 
+// QueueAges returns no buckets, as the light transaction pool doesn't queue
+// non-executable transactions.
+func (b *LesApiBackend) QueueAges() core.TxAgeStats {
+	return core.TxAgeStats{}
+}
+
 func (b *LesApiBackend) TxPoolContent() (map[common.Address]types.Transactions, map[common.Address]types.Transactions) {
 	return b.eth.txPool.Content()
 }
@@ -144,6 +160,10 @@ func (b *LesApiBackend) ChainDb() ethdb.Database {
 	return b.eth.chainDb
 }
 
+func (b *LesApiBackend) StateDb() ethdb.Database {
+	return b.eth.chainDb
+}
+
 func (b *LesApiBackend) EventMux() *event.TypeMux {
 	return b.eth.eventMux
 }
@@ -22,7 +22,6 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/ur-technology/urhash"
 	"github.com/ur-technology/go-ur/accounts"
 	"github.com/ur-technology/go-ur/common"
 	"github.com/ur-technology/go-ur/common/compiler"
@@ -41,6 +40,7 @@ import (
 	"github.com/ur-technology/go-ur/node"
 	"github.com/ur-technology/go-ur/p2p"
 	"github.com/ur-technology/go-ur/params"
+	"github.com/ur-technology/go-ur/pow"
 	rpc "github.com/ur-technology/go-ur/rpc"
 )
 
@@ -60,7 +60,7 @@ type LightEthereum struct {
 	ApiBackend *LesApiBackend
 
 	eventMux       *event.TypeMux
-	pow            *urhash.Ethash
+	pow            pow.PoW
 	accountManager *accounts.Manager
 	solcPath       string
 	solc           *compiler.Solidity
@@ -69,6 +69,8 @@ type LightEthereum struct {
 	PowTest       bool
 	netVersionId  int
 	netRPCService *ethapi.PublicNetAPI
+
+	rpcLogsCap int
 }
 
 func New(ctx *node.ServiceContext, config *eth.Config) (*LightEthereum, error) {
@@ -98,13 +100,14 @@ func New(ctx *node.ServiceContext, config *eth.Config) (*LightEthereum, error) {
 		NatSpec:        config.NatSpec,
 		PowTest:        config.PowTest,
 		solcPath:       config.SolcPath,
+		rpcLogsCap:     config.RPCLogsCap,
 	}
 
 	if config.ChainConfig == nil {
 		return nil, errors.New("missing chain config")
 	}
 	eth.chainConfig = config.ChainConfig
-	eth.blockchain, err = light.NewLightChain(odr, eth.chainConfig, eth.pow, eth.eventMux)
+	eth.blockchain, err = light.NewLightChain(odr, eth.chainConfig, config.BlockChain.Pow, core.NewPowEngine(eth.pow), eth.eventMux)
 	if err != nil {
 		if err == core.ErrNoGenesis {
 			return nil, fmt.Errorf(`Genesis block not found. Please supply a genesis block with the "--genesis /path/to/file" argument`)
@@ -116,6 +119,12 @@ func New(ctx *node.ServiceContext, config *eth.Config) (*LightEthereum, error) {
 	if eth.protocolManager, err = NewProtocolManager(eth.chainConfig, config.LightMode, config.NetworkId, eth.eventMux, eth.pow, eth.blockchain, nil, chainDb, odr, relay); err != nil {
 		return nil, err
 	}
+	if cp := config.Checkpoint; cp != nil {
+		if hash := core.GetCanonicalHash(chainDb, cp.Number); hash != (common.Hash{}) && hash != cp.Hash {
+			return nil, fmt.Errorf("local chain conflicts with checkpoint #%d [%x…], resync required", cp.Number, cp.Hash[:4])
+		}
+		eth.protocolManager.downloader.SetCheckpoint(cp)
+	}
 
 	eth.ApiBackend = &LesApiBackend{eth, nil}
 	eth.ApiBackend.gpo = gasprice.NewLightPriceOracle(eth.ApiBackend)
@@ -161,7 +170,7 @@ func (s *LightEthereum) APIs() []rpc.API {
 		}, {
 			Namespace: "eth",
 			Version:   "1.0",
-			Service:   filters.NewPublicFilterAPI(s.ApiBackend, true),
+			Service:   filters.NewPublicFilterAPI(s.ApiBackend, true, s.rpcLogsCap),
 			Public:    true,
 		}, {
 			Namespace: "net",
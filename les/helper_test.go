@@ -140,7 +140,7 @@ func newTestProtocolManager(lightSync bool, blocks int, generator func(int, *cor
 
 	if lightSync {
 		odr = NewLesOdr(db)
-		chain, _ = light.NewLightChain(odr, chainConfig, pow, evmux)
+		chain, _ = light.NewLightChain(odr, chainConfig, core.PowConfig{}, pow, evmux)
 	} else {
 		blockchain, _ := core.NewBlockChain(db, chainConfig, pow, evmux)
 		gchain, _ := core.GenerateChain(chainConfig, blockchain, genesis, db, blocks, generator)
@@ -23,6 +23,7 @@ import (
 	"time"
 
 	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/consensus"
 	"github.com/ur-technology/go-ur/core"
 	"github.com/ur-technology/go-ur/core/types"
 	"github.com/ur-technology/go-ur/ethdb"
@@ -30,7 +31,6 @@ import (
 	"github.com/ur-technology/go-ur/logger"
 	"github.com/ur-technology/go-ur/logger/glog"
 	"github.com/ur-technology/go-ur/params"
-	"github.com/ur-technology/go-ur/pow"
 	"github.com/ur-technology/go-ur/rlp"
 	"github.com/hashicorp/golang-lru"
 	"golang.org/x/net/context"
@@ -65,14 +65,15 @@ type LightChain struct {
 	procInterrupt int32 // interrupt signaler for block processing
 	wg            sync.WaitGroup
 
-	pow       pow.PoW
+	engine    consensus.Engine
 	validator core.HeaderValidator
 }
 
 // NewLightChain returns a fully initialised light chain using information
 // available in the database. It initialises the default Ethereum header
-// validator.
-func NewLightChain(odr OdrBackend, config *params.ChainConfig, pow pow.PoW, mux *event.TypeMux) (*LightChain, error) {
+// validator, which verifies headers with the given consensus engine according
+// to the proof of work verification settings.
+func NewLightChain(odr OdrBackend, config *params.ChainConfig, powConfig core.PowConfig, engine consensus.Engine, mux *event.TypeMux) (*LightChain, error) {
 	bodyCache, _ := lru.New(bodyCacheLimit)
 	bodyRLPCache, _ := lru.New(bodyCacheLimit)
 	blockCache, _ := lru.New(blockCacheLimit)
@@ -85,12 +86,12 @@ func NewLightChain(odr OdrBackend, config *params.ChainConfig, pow pow.PoW, mux
 		bodyCache:    bodyCache,
 		bodyRLPCache: bodyRLPCache,
 		blockCache:   blockCache,
-		pow:          pow,
+		engine:       engine,
 	}
 
 	var err error
-	bc.hc, err = core.NewHeaderChain(odr.Database(), config, bc.Validator, bc.getProcInterrupt)
-	bc.SetValidator(core.NewHeaderValidator(config, bc.hc, pow))
+	bc.hc, err = core.NewHeaderChain(odr.Database(), config, powConfig, bc.Validator, bc.getProcInterrupt)
+	bc.SetValidator(core.NewHeaderValidator(config, bc.hc, engine))
 	if err != nil {
 		return nil, err
 	}
@@ -252,7 +252,7 @@ func testChainOdr(t *testing.T, protocol int, expFail uint64, fn odrTestFn) {
 	}
 
 	odr := &testOdr{sdb: sdb, ldb: ldb}
-	lightchain, _ := NewLightChain(odr, testChainConfig(), pow, evmux)
+	lightchain, _ := NewLightChain(odr, testChainConfig(), core.PowConfig{}, pow, evmux)
 	lightchain.SetValidator(bproc{})
 	headers := make([]*types.Header, len(gchain))
 	for i, block := range gchain {
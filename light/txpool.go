@@ -17,7 +17,6 @@
 package light
 
 import (
-	"fmt"
 	"sync"
 	"time"
 
@@ -405,7 +404,7 @@ func (self *TxPool) add(ctx context.Context, tx *types.Transaction) error {
 	hash := tx.Hash()
 
 	if self.pending[hash] != nil {
-		return fmt.Errorf("Known transaction (%x)", hash[:4])
+		return &core.KnownTxErr{Hash: hash}
 	}
 	err := self.validateTx(ctx, tx)
 	if err != nil {
@@ -95,7 +95,7 @@ func TestTxPool(t *testing.T) {
 
 	odr := &testOdr{sdb: sdb, ldb: ldb}
 	relay := &testTxRelay{}
-	lightchain, _ := NewLightChain(odr, testChainConfig(), pow, evmux)
+	lightchain, _ := NewLightChain(odr, testChainConfig(), core.PowConfig{}, pow, evmux)
 	lightchain.SetValidator(bproc{})
 	txPermanent = 50
 	pool := NewTxPool(testChainConfig(), evmux, lightchain, relay)
@@ -394,6 +394,10 @@ func (t *TraceLocation) String() string {
 	// Lock because the type is not atomic. TODO: clean this up.
 	logging.mu.Lock()
 	defer logging.mu.Unlock()
+	// An unset location prints as empty, which Set accepts to unset it again
+	if !t.isSet() {
+		return ""
+	}
 	return fmt.Sprintf("%s:%d", t.file, t.line)
 }
 
@@ -75,6 +75,22 @@ func NewTimer(name string) metrics.Timer {
 	return metrics.GetOrRegisterTimer(name, metrics.DefaultRegistry)
 }
 
+// NewFunctionalGauge registers a gauge whose value is computed by f whenever it
+// is read. Since it costs nothing until queried, it is registered even if the
+// metrics collection is disabled, replacing any previous gauge of the same name.
+func NewFunctionalGauge(name string, f func() int64) metrics.Gauge {
+	gauge := metrics.NewFunctionalGauge(f)
+	metrics.DefaultRegistry.Unregister(name)
+	metrics.DefaultRegistry.Register(name, gauge)
+	return gauge
+}
+
+// Unregister removes a metric from the registry, releasing the ones of transient
+// entities like connected peers.
+func Unregister(name string) {
+	metrics.DefaultRegistry.Unregister(name)
+}
+
 // CollectProcessMetrics periodically collects various metrics about the running
 // process.
 func CollectProcessMetrics(refresh time.Duration) {
@@ -21,7 +21,7 @@ import (
 
 	"sync/atomic"
 
-	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/consensus"
 	"github.com/ur-technology/go-ur/logger"
 	"github.com/ur-technology/go-ur/logger/glog"
 	"github.com/ur-technology/go-ur/pow"
@@ -35,15 +35,15 @@ type CpuAgent struct {
 	quitCurrentOp chan struct{}
 	returnCh      chan<- *Result
 
-	index int
-	pow   pow.PoW
+	index  int
+	engine consensus.Engine
 
 	isMining int32 // isMining indicates whether the agent is currently mining
 }
 
-func NewCpuAgent(index int, pow pow.PoW) *CpuAgent {
+func NewCpuAgent(index int, engine consensus.Engine) *CpuAgent {
 	miner := &CpuAgent{
-		pow:    pow,
+		engine: engine,
 		index:  index,
 		quit:   make(chan struct{}),
 		workCh: make(chan *Work, 1),
@@ -52,8 +52,14 @@ func NewCpuAgent(index int, pow pow.PoW) *CpuAgent {
 	return miner
 }
 
+type cpuAgentsByIndex []*CpuAgent
+
+func (s cpuAgentsByIndex) Len() int           { return len(s) }
+func (s cpuAgentsByIndex) Less(i, j int) bool { return s[i].index < s[j].index }
+func (s cpuAgentsByIndex) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
 func (self *CpuAgent) Work() chan<- *Work            { return self.workCh }
-func (self *CpuAgent) Pow() pow.PoW                  { return self.pow }
+func (self *CpuAgent) Engine() consensus.Engine      { return self.engine }
 func (self *CpuAgent) SetReturnCh(ch chan<- *Result) { self.returnCh = ch }
 
 func (self *CpuAgent) Stop() {
@@ -110,15 +116,22 @@ func (self *CpuAgent) mine(work *Work, stop <-chan struct{}) {
 	glog.V(logger.Debug).Infof("(re)started agent[%d]. mining...\n", self.index)
 
 	// Mine
-	nonce, mixDigest := self.pow.Search(work.Block, stop, self.index)
-	if nonce != 0 {
-		block := work.Block.WithMiningResult(nonce, common.BytesToHash(mixDigest))
+	block, err := self.engine.Seal(work.Block, stop, self.index)
+	if err != nil {
+		glog.V(logger.Warn).Infof("agent[%d] failed to seal block #%v: %v", self.index, work.Block.Number(), err)
+	}
+	if block != nil {
 		self.returnCh <- &Result{work, block}
 	} else {
 		self.returnCh <- nil
 	}
 }
 
+// GetHashRate returns the hashrate of the proof of work sealing blocks, zero if
+// the consensus engine doesn't search for any.
 func (self *CpuAgent) GetHashRate() int64 {
-	return self.pow.GetHashrate()
+	if pow, ok := self.engine.(pow.PoW); ok {
+		return pow.GetHashrate()
+	}
+	return 0
 }
@@ -0,0 +1,82 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// InstantAgent seals every work containing transactions right away, without
+// searching for a proof of work. Empty work is never sealed, so the chain only
+// advances when there is something to include. It is meant for development
+// chains whose blocks aren't verified against a proof of work.
+type InstantAgent struct {
+	mu sync.Mutex
+
+	workCh   chan *Work
+	quit     chan struct{}
+	returnCh chan<- *Result
+
+	isMining int32 // isMining indicates whether the agent is currently sealing
+}
+
+func NewInstantAgent() *InstantAgent {
+	return &InstantAgent{
+		workCh: make(chan *Work, 1),
+	}
+}
+
+func (self *InstantAgent) Work() chan<- *Work            { return self.workCh }
+func (self *InstantAgent) SetReturnCh(ch chan<- *Result) { self.returnCh = ch }
+func (self *InstantAgent) GetHashRate() int64            { return 0 }
+
+func (self *InstantAgent) Start() {
+	if !atomic.CompareAndSwapInt32(&self.isMining, 0, 1) {
+		return // agent already started
+	}
+	self.mu.Lock()
+	self.quit = make(chan struct{})
+	self.mu.Unlock()
+
+	go self.update(self.quit)
+}
+
+func (self *InstantAgent) Stop() {
+	if !atomic.CompareAndSwapInt32(&self.isMining, 1, 0) {
+		return
+	}
+	self.mu.Lock()
+	close(self.quit)
+	self.mu.Unlock()
+}
+
+func (self *InstantAgent) update(quit chan struct{}) {
+	for {
+		select {
+		case work := <-self.workCh:
+			// Results are always returned, the worker counts the pending ones
+			if len(work.Block.Transactions()) == 0 {
+				self.returnCh <- nil
+			} else {
+				self.returnCh <- &Result{work, work.Block}
+			}
+		case <-quit:
+			return
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core/types"
+)
+
+// Tests that the instant agent seals work with transactions right away and
+// hands back empty work unsealed.
+func TestInstantAgentSealing(t *testing.T) {
+	agent := NewInstantAgent()
+	results := make(chan *Result, 1)
+	agent.SetReturnCh(results)
+	agent.Start()
+	defer agent.Stop()
+
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(1)}
+	tx := types.NewTransaction(0, common.Address{}, big.NewInt(1), big.NewInt(21000), big.NewInt(1), nil)
+
+	empty := &Work{Block: types.NewBlock(header, nil, nil, nil)}
+	agent.Work() <- empty
+	select {
+	case res := <-results:
+		if res != nil {
+			t.Fatalf("empty work sealed: block #%v", res.Block.Number())
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no result for empty work")
+	}
+
+	full := &Work{Block: types.NewBlock(header, []*types.Transaction{tx}, nil, []*types.Receipt{types.NewReceipt(nil, big.NewInt(21000))})}
+	agent.Work() <- full
+	select {
+	case res := <-results:
+		if res == nil {
+			t.Fatalf("work with transactions not sealed")
+		}
+		if res.Work != full || res.Block != full.Block {
+			t.Fatalf("sealed result mismatch")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no result for work with transactions")
+	}
+}
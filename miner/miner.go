@@ -18,9 +18,12 @@
 package miner
 
 import (
+	"errors"
 	"fmt"
 	"math/big"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/ur-technology/go-ur/accounts"
 	"github.com/ur-technology/go-ur/common"
@@ -50,11 +53,14 @@ type Miner struct {
 
 	worker *worker
 
-	threads  int
+	threads  int32
 	coinbase common.Address
 	mining   int32
+	paused   int32      // Whether the CPU agents stopped sealing while mining
+	agentsMu sync.Mutex // Serialises the adjustments of the CPU agents
 	eth      Backend
 	pow      pow.PoW
+	instant  bool // Seal with an instant agent instead of CPU agents
 
 	canStart    int32 // can start indicates whether we can start the mining operation
 	shouldStart int32 // should start indicates whether we should start after sync
@@ -95,7 +101,7 @@ out:
 			atomic.StoreInt32(&self.canStart, 1)
 			atomic.StoreInt32(&self.shouldStart, 0)
 			if shouldStart {
-				self.Start(self.coinbase, self.threads)
+				self.Start(self.coinbase, self.Threads())
 			}
 			// unsubscribe. we're only interested in this event once
 			events.Unsubscribe()
@@ -106,6 +112,9 @@ out:
 }
 
 func (m *Miner) GasPrice() *big.Int {
+	m.worker.mu.Lock()
+	defer m.worker.mu.Unlock()
+
 	return new(big.Int).Set(m.worker.gasPrice)
 }
 
@@ -117,9 +126,43 @@ func (m *Miner) SetGasPrice(price *big.Int) {
 	m.worker.setGasPrice(price)
 }
 
+// SetGasLimits sets the gas limit the mined blocks vote toward, and the ceiling
+// they never exceed. A nil target votes toward params.TargetGasLimit, a nil
+// limit leaves the blocks without ceiling.
+func (self *Miner) SetGasLimits(target, limit *big.Int) error {
+	for _, gas := range []*big.Int{target, limit} {
+		if gas != nil && gas.Cmp(params.MinGasLimit) < 0 {
+			return fmt.Errorf("gas limit %v below the minimum %v", gas, params.MinGasLimit)
+		}
+	}
+	self.worker.setGasLimits(target, limit)
+	return nil
+}
+
+// GasLimits returns the gas limit target and ceiling of the mined blocks.
+func (self *Miner) GasLimits() (target, limit *big.Int) {
+	return self.worker.gasLimits()
+}
+
+// Start starts mining to the given coinbase with the given number of CPU agents.
+// If already mining, the CPU agents are resumed if paused and their number is
+// adjusted.
 func (self *Miner) Start(coinbase common.Address, threads int) {
+	if self.Mining() {
+		self.SetEtherbase(coinbase)
+
+		self.agentsMu.Lock()
+		defer self.agentsMu.Unlock()
+
+		atomic.StoreInt32(&self.threads, int32(threads))
+		if atomic.CompareAndSwapInt32(&self.paused, 1, 0) {
+			glog.V(logger.Info).Infoln("Mining operation resumed")
+		}
+		self.updateAgents()
+		return
+	}
 	atomic.StoreInt32(&self.shouldStart, 1)
-	self.threads = threads
+	atomic.StoreInt32(&self.threads, int32(threads))
 	self.worker.coinbase = coinbase
 	self.coinbase = coinbase
 
@@ -129,9 +172,14 @@ func (self *Miner) Start(coinbase common.Address, threads int) {
 	}
 
 	atomic.StoreInt32(&self.mining, 1)
+	atomic.StoreInt32(&self.paused, 0)
 
-	for i := 0; i < threads; i++ {
-		self.worker.register(NewCpuAgent(i, self.pow))
+	if self.instant {
+		self.worker.register(NewInstantAgent())
+	} else {
+		for i := 0; i < threads; i++ {
+			self.worker.register(NewCpuAgent(i, self.eth.BlockChain().Engine()))
+		}
 	}
 
 	glog.V(logger.Info).Infof("Starting mining operation (CPU=%d TOT=%d)\n", threads, len(self.worker.agents))
@@ -141,12 +189,139 @@ func (self *Miner) Start(coinbase common.Address, threads int) {
 	self.worker.commitNewWork()
 }
 
+// SetInstant switches between sealing blocks with proof of work searching CPU
+// agents, and sealing them instantly whenever transactions are pending. It must
+// be called while not mining.
+func (self *Miner) SetInstant(instant bool) {
+	self.instant = instant
+	if instant {
+		atomic.StoreInt32(&self.worker.instant, 1)
+	} else {
+		atomic.StoreInt32(&self.worker.instant, 0)
+	}
+}
+
+// SetSignupPriority sets whether the valid signup transactions of the privileged
+// accounts are placed at the front of the mined blocks, ahead of any better paying
+// transaction, so that onboarding doesn't stall when the pool is congested.
+func (self *Miner) SetSignupPriority(priority bool) {
+	if priority {
+		atomic.StoreInt32(&self.worker.signups, 1)
+	} else {
+		atomic.StoreInt32(&self.worker.signups, 0)
+	}
+}
+
+// SetCoinbaseRotation sets the coinbases the mined blocks rotate through, each
+// receiving the rewards of the given number of consecutive blocks, so that they
+// are split across payout addresses. An empty list mines to the etherbase.
+func (self *Miner) SetCoinbaseRotation(coinbases []common.Address, rotation uint64) error {
+	if len(coinbases) > 0 && rotation == 0 {
+		return errors.New("coinbase rotation of zero blocks")
+	}
+	self.worker.setCoinbaseRotation(coinbases, rotation)
+	return nil
+}
+
+// SetRecommitInterval sets how often the mined block is rebuilt to include the
+// transactions arrived since it was built, rather than only on new chain heads.
+// Signups trigger a rebuild right away. Zero disables rebuilding.
+func (self *Miner) SetRecommitInterval(interval time.Duration) {
+	atomic.StoreInt64(&self.worker.recommit, int64(interval))
+}
+
 func (self *Miner) Stop() {
 	self.worker.stop()
 	atomic.StoreInt32(&self.mining, 0)
+	atomic.StoreInt32(&self.paused, 0)
 	atomic.StoreInt32(&self.shouldStart, 0)
 }
 
+// SetThreads sets the number of CPU agents searching for the proof of work,
+// starting or stopping agents right away if mining and not paused. Zero leaves
+// the sealing to the registered external agents.
+func (self *Miner) SetThreads(threads int) error {
+	if threads < 0 {
+		return fmt.Errorf("invalid number of mining threads %d", threads)
+	}
+	self.agentsMu.Lock()
+	defer self.agentsMu.Unlock()
+
+	atomic.StoreInt32(&self.threads, int32(threads))
+	self.updateAgents()
+	return nil
+}
+
+// updateAgents starts or stops CPU agents to match the number of threads if
+// mining and not paused. The agents lock must be held.
+func (self *Miner) updateAgents() {
+	threads := self.Threads()
+	if !self.Mining() || self.Paused() || self.instant {
+		return
+	}
+	agents := self.worker.cpuAgents()
+	for i := len(agents) - 1; i >= threads; i-- {
+		self.worker.unregister(agents[i])
+	}
+	for i := len(agents); i < threads; i++ {
+		agent := NewCpuAgent(i, self.eth.BlockChain().Engine())
+		self.worker.register(agent)
+		agent.Start()
+	}
+	glog.V(logger.Info).Infof("Mining threads set to %d (was %d)", threads, len(agents))
+
+	// Hand the current work to the new agents
+	if threads > len(agents) {
+		self.worker.commitNewWork()
+	}
+}
+
+// Threads returns the number of CPU agents used for mining.
+func (self *Miner) Threads() int {
+	return int(atomic.LoadInt32(&self.threads))
+}
+
+// Pause stops the CPU agents searching for the proof of work, without stopping
+// the worker: the pending block keeps being built and handed to the external
+// agents.
+func (self *Miner) Pause() error {
+	if !self.Mining() {
+		return errors.New("not mining")
+	}
+	self.agentsMu.Lock()
+	defer self.agentsMu.Unlock()
+
+	if !atomic.CompareAndSwapInt32(&self.paused, 0, 1) {
+		return nil
+	}
+	for _, agent := range self.worker.cpuAgents() {
+		self.worker.unregister(agent)
+	}
+	glog.V(logger.Info).Infoln("Mining operation paused")
+	return nil
+}
+
+// Resume restarts the CPU agents stopped by Pause.
+func (self *Miner) Resume() error {
+	if !self.Mining() {
+		return errors.New("not mining")
+	}
+	self.agentsMu.Lock()
+	defer self.agentsMu.Unlock()
+
+	if !atomic.CompareAndSwapInt32(&self.paused, 1, 0) {
+		return nil
+	}
+	glog.V(logger.Info).Infoln("Mining operation resumed")
+	self.updateAgents()
+	return nil
+}
+
+// Paused returns whether the CPU agents are paused while mining.
+func (self *Miner) Paused() bool {
+	return atomic.LoadInt32(&self.paused) > 0
+}
+
 func (self *Miner) Register(agent Agent) {
 	if self.Mining() {
 		agent.Start()
@@ -162,6 +337,65 @@ func (self *Miner) Mining() bool {
 	return atomic.LoadInt32(&self.mining) > 0
 }
 
+// AgentHashrate is the hashrate last reported by an external miner.
+type AgentHashrate struct {
+	Hashrate uint64    `json:"hashrate"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// HashrateDetail is the hashrate of the miner broken down by source.
+type HashrateDetail struct {
+	Total   int64                    `json:"total"`
+	Local   int64                    `json:"local"`   // Proof of work searched by the node itself
+	Remote  map[string]AgentHashrate `json:"remote"`  // External miners by eth_submitHashrate identifier
+	Stratum map[string]AgentHashrate `json:"stratum"` // Stratum workers by worker name
+}
+
+// hashrateReporter is implemented by the agents handing work out to external
+// miners that report their hashrates under an identifier.
+type hashrateReporter interface {
+	Hashrates() map[string]AgentHashrate
+}
+
+// HashrateDetail returns the hashrate of the miner, attributing the share of the
+// external miners to the identifiers they reported it under.
+func (self *Miner) HashrateDetail() *HashrateDetail {
+	detail := &HashrateDetail{
+		Local:   self.pow.GetHashrate(),
+		Remote:  make(map[string]AgentHashrate),
+		Stratum: make(map[string]AgentHashrate),
+	}
+	// Copy the agents out, the reporters take their own locks
+	self.worker.mu.Lock()
+	agents := make([]Agent, 0, len(self.worker.agents))
+	for agent := range self.worker.agents {
+		agents = append(agents, agent)
+	}
+	self.worker.mu.Unlock()
+
+	for _, agent := range agents {
+		// The CPU agents search with the node's own proof of work, counted above
+		if _, ok := agent.(*CpuAgent); ok {
+			continue
+		}
+		reporter, ok := agent.(hashrateReporter)
+		if !ok {
+			detail.Local += agent.GetHashRate()
+			continue
+		}
+		rates := detail.Remote
+		if _, ok := agent.(*StratumServer); ok {
+			rates = detail.Stratum
+		}
+		for id, rate := range reporter.Hashrates() {
+			rates[id] = rate
+			detail.Total += int64(rate.Hashrate)
+		}
+	}
+	detail.Total += detail.Local
+	return detail
+}
+
 func (self *Miner) HashRate() (tot int64) {
 	tot += self.pow.GetHashrate()
 	// do we care this might race? is it worth we're rewriting some
@@ -178,7 +412,7 @@ func (self *Miner) SetExtra(extra []byte) error {
 		return fmt.Errorf("Extra exceeds max length. %d > %v", len(extra), params.MaximumExtraDataSize)
 	}
 
-	self.worker.extra = extra
+	self.worker.setExtra(extra)
 	return nil
 }
 
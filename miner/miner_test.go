@@ -0,0 +1,96 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"testing"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/consensus"
+)
+
+// hashrateTestPow is a consensus engine searching for the proof of work at a
+// fixed hashrate, shared by all the CPU agents using it.
+type hashrateTestPow struct {
+	consensus.Engine
+	stratumTestPow
+}
+
+func (hashrateTestPow) GetHashrate() int64 { return 100 }
+
+// Tests that the hashrate detail counts the node's own proof of work once, and
+// keeps the remote and stratum miners apart even under the same identifier.
+func TestHashrateDetail(t *testing.T) {
+	engine := hashrateTestPow{}
+
+	remote := NewRemoteAgent()
+	id := common.HexToHash("0x01")
+	remote.SubmitHashrate(id, 10)
+
+	stratum := NewStratumServer(StratumConfig{}, stratumTestPow{})
+	stratum.SubmitHashrate(id.Hex(), 20)
+	stratum.SubmitHashrate("rig", 30)
+
+	miner := &Miner{
+		pow: engine,
+		worker: &worker{agents: map[Agent]struct{}{
+			NewCpuAgent(0, engine): {},
+			NewCpuAgent(1, engine): {},
+			remote:                 {},
+			stratum:                {},
+		}},
+	}
+	detail := miner.HashrateDetail()
+
+	if detail.Local != 100 {
+		t.Errorf("local hashrate mismatch: have %d, want 100", detail.Local)
+	}
+	if detail.Total != 160 {
+		t.Errorf("total hashrate mismatch: have %d, want 160", detail.Total)
+	}
+	if len(detail.Remote) != 1 || detail.Remote[id.Hex()].Hashrate != 10 {
+		t.Errorf("remote hashrates mismatch: have %v, want %s: 10", detail.Remote, id.Hex())
+	}
+	if len(detail.Stratum) != 2 || detail.Stratum[id.Hex()].Hashrate != 20 || detail.Stratum["rig"].Hashrate != 30 {
+		t.Errorf("stratum hashrates mismatch: have %v, want %s: 20, rig: 30", detail.Stratum, id.Hex())
+	}
+}
+
+// Tests that starting a paused miner resumes it, with the thread count set while
+// paused overridden by the one it's started with.
+func TestMinerStartResumes(t *testing.T) {
+	miner := &Miner{worker: &worker{agents: make(map[Agent]struct{})}, mining: 1}
+	if err := miner.Pause(); err != nil {
+		t.Fatalf("failed to pause: %v", err)
+	}
+	if err := miner.SetThreads(2); err != nil {
+		t.Fatalf("failed to set threads: %v", err)
+	}
+	if agents := miner.worker.cpuAgents(); len(agents) != 0 {
+		t.Fatalf("agents started while paused: %d", len(agents))
+	}
+	miner.Start(common.Address{0x01}, 0)
+	if miner.Paused() {
+		t.Errorf("miner still paused after start")
+	}
+	if threads := miner.Threads(); threads != 0 {
+		t.Errorf("threads mismatch: have %d, want 0", threads)
+	}
+	if coinbase := miner.worker.coinbase; coinbase != (common.Address{0x01}) {
+		t.Errorf("coinbase mismatch: have %x, want %x", coinbase, common.Address{0x01})
+	}
+}
@@ -0,0 +1,399 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/event"
+	"github.com/ur-technology/go-ur/logger"
+	"github.com/ur-technology/go-ur/logger/glog"
+	"github.com/ur-technology/go-ur/params"
+)
+
+// PayoutConfig is the configuration of the pool reward splitting.
+type PayoutConfig struct {
+	Account   common.Address // Unlocked coinbase paying the rewards out (zero = disabled)
+	Depth     uint64         // Confirmations a sealed block needs before its rewards are split
+	Threshold *big.Int       // Minimum balance of a worker issued in a payout (nil = any)
+	State     string         // File the share state is persisted to (empty = in memory only)
+}
+
+// payoutRound is a block sealed by the pool, with the shares of the workers
+// submitted while it was mined.
+type payoutRound struct {
+	Number uint64
+	Hash   common.Hash
+	Shares map[common.Address]*big.Int
+}
+
+// PayoutStats is the share state of the pool reward splitting.
+type PayoutStats struct {
+	Shares   map[string]*big.Int `json:"shares"`   // Share difficulty of the round being mined, per worker address
+	Pending  []uint64            `json:"pending"`  // Numbers of the sealed blocks waiting to mature
+	Balances map[string]*big.Int `json:"balances"` // Split rewards not paid out yet, per worker address
+}
+
+// Payouter splits the rewards of the blocks sealed by a mining pool across the
+// worker addresses, in proportion of the share difficulty they submitted, and
+// pays them out from the pool's coinbase once the blocks matured.
+//
+// The workers register their address as their name, optionally followed by a
+// rig identifier (e.g. 0x1234….rig1). Shares of other workers are not rewarded.
+type Payouter struct {
+	config      PayoutConfig
+	chainConfig *params.ChainConfig
+	eth         Backend
+	mux         *event.TypeMux
+	gasPrice    func() *big.Int
+
+	mu       sync.Mutex
+	shares   map[common.Address]*big.Int // Share difficulty of the round being mined
+	rounds   []*payoutRound              // Sealed blocks waiting to mature
+	balances map[common.Address]*big.Int // Split rewards not paid out yet
+
+	events event.Subscription
+	wg     sync.WaitGroup
+}
+
+// NewPayouter creates a reward splitter paying out from the configured account
+// with transactions of the given gas price.
+func NewPayouter(config PayoutConfig, chainConfig *params.ChainConfig, eth Backend, mux *event.TypeMux, gasPrice func() *big.Int) *Payouter {
+	return &Payouter{
+		config:      config,
+		chainConfig: chainConfig,
+		eth:         eth,
+		mux:         mux,
+		gasPrice:    gasPrice,
+		shares:      make(map[common.Address]*big.Int),
+		balances:    make(map[common.Address]*big.Int),
+	}
+}
+
+// Start restores the persisted share state and starts splitting the rewards of
+// the sealed blocks.
+func (p *Payouter) Start() error {
+	if err := p.load(); err != nil {
+		return err
+	}
+	p.events = p.mux.Subscribe(core.NewMinedBlockEvent{}, core.ChainHeadEvent{})
+	p.wg.Add(1)
+	go p.loop()
+	return nil
+}
+
+// Stop terminates the reward splitting and persists the share state.
+func (p *Payouter) Stop() {
+	p.events.Unsubscribe()
+	p.wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.save(); err != nil {
+		glog.V(logger.Warn).Infof("Failed to save payout state: %v", err)
+	}
+}
+
+// RecordShare accounts a valid share submitted by a worker to the round being
+// mined.
+func (p *Payouter) RecordShare(worker string, difficulty *big.Int) {
+	addr, ok := workerAddress(worker)
+	if !ok {
+		glog.V(logger.Debug).Infof("Share of worker %q without payout address", worker)
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	addShares(p.shares, addr, difficulty)
+}
+
+// Stats returns a copy of the share state.
+func (p *Payouter) Stats() *PayoutStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := &PayoutStats{
+		Shares:   make(map[string]*big.Int, len(p.shares)),
+		Balances: make(map[string]*big.Int, len(p.balances)),
+	}
+	for addr, shares := range p.shares {
+		stats.Shares[addr.Hex()] = new(big.Int).Set(shares)
+	}
+	for _, round := range p.rounds {
+		stats.Pending = append(stats.Pending, round.Number)
+	}
+	for addr, balance := range p.balances {
+		stats.Balances[addr.Hex()] = new(big.Int).Set(balance)
+	}
+	return stats
+}
+
+// workerAddress parses the payout address out of a worker name.
+func workerAddress(worker string) (common.Address, bool) {
+	if i := strings.IndexByte(worker, '.'); i >= 0 {
+		worker = worker[:i]
+	}
+	if !common.IsHexAddress(worker) {
+		return common.Address{}, false
+	}
+	return common.HexToAddress(worker), true
+}
+
+func addShares(shares map[common.Address]*big.Int, addr common.Address, amount *big.Int) {
+	if shares[addr] == nil {
+		shares[addr] = new(big.Int)
+	}
+	shares[addr].Add(shares[addr], amount)
+}
+
+func (p *Payouter) loop() {
+	defer p.wg.Done()
+
+	for ev := range p.events.Chan() {
+		p.mu.Lock()
+		switch ev := ev.Data.(type) {
+		case core.NewMinedBlockEvent:
+			p.seal(ev.Block)
+		case core.ChainHeadEvent:
+			p.mature(ev.Block.NumberU64())
+		}
+		p.mu.Unlock()
+	}
+}
+
+// seal closes the round being mined with a block sealed to the pool's coinbase.
+// The lock must be held.
+func (p *Payouter) seal(block *types.Block) {
+	if block.Coinbase() != p.config.Account || len(p.shares) == 0 {
+		return
+	}
+	p.rounds = append(p.rounds, &payoutRound{Number: block.NumberU64(), Hash: block.Hash(), Shares: p.shares})
+	p.shares = make(map[common.Address]*big.Int)
+
+	if err := p.save(); err != nil {
+		glog.V(logger.Warn).Infof("Failed to save payout state: %v", err)
+	}
+}
+
+// mature splits the rewards of the rounds deep enough in the chain, returning the
+// shares of the rounds that didn't make it to the canonical chain to the round
+// being mined, and pays the balances out. The lock must be held.
+func (p *Payouter) mature(head uint64) {
+	var (
+		pending []*payoutRound
+		split   bool
+	)
+	for _, round := range p.rounds {
+		if round.Number+p.config.Depth > head {
+			pending = append(pending, round)
+			continue
+		}
+		if core.GetCanonicalHash(p.eth.ChainDb(), round.Number) != round.Hash {
+			glog.V(logger.Info).Infof("Sealed block #%d [%x…] orphaned, shares carried over", round.Number, round.Hash[:4])
+			for addr, shares := range round.Shares {
+				addShares(p.shares, addr, shares)
+			}
+			split = true
+			continue
+		}
+		reward, err := p.reward(round.Number)
+		if err != nil {
+			glog.V(logger.Warn).Infof("Failed to retrieve reward of block #%d, retrying on the next head: %v", round.Number, err)
+			pending = append(pending, round)
+			continue
+		}
+		split = true
+		total := new(big.Int)
+		for _, shares := range round.Shares {
+			total.Add(total, shares)
+		}
+		for addr, shares := range round.Shares {
+			addShares(p.balances, addr, new(big.Int).Div(new(big.Int).Mul(reward, shares), total))
+		}
+		glog.V(logger.Info).Infof("Split reward of block #%d across %d workers: %v wei", round.Number, len(round.Shares), reward)
+	}
+	p.rounds = pending
+	if !split {
+		return
+	}
+	p.payout()
+	if err := p.save(); err != nil {
+		glog.V(logger.Warn).Infof("Failed to save payout state: %v", err)
+	}
+}
+
+// reward returns the block, signup and gas rewards credited to the pool's
+// coinbase by a canonical block. The gas the pool collects from its own payout
+// transactions is no reward, it paid for it itself.
+func (p *Payouter) reward(number uint64) (*big.Int, error) {
+	entries, err := p.eth.BlockChain().BalanceProvenance(p.config.Account, number, number)
+	if err != nil {
+		return nil, err
+	}
+	reward := new(big.Int)
+	for _, entry := range entries {
+		if entry.Amount.Sign() <= 0 {
+			continue
+		}
+		switch {
+		case entry.Kind == core.BalanceBlockReward:
+			reward.Add(reward, entry.Amount)
+		case entry.Kind == core.BalanceGas && entry.Counterparty != p.config.Account:
+			reward.Add(reward, entry.Amount)
+		}
+	}
+	return reward, nil
+}
+
+// payout issues a transaction from the pool's coinbase for every balance above
+// the threshold. The lock must be held.
+func (p *Payouter) payout() {
+	addrs := make([]common.Address, 0, len(p.balances))
+	for addr, balance := range p.balances {
+		if balance.Sign() > 0 && (p.config.Threshold == nil || balance.Cmp(p.config.Threshold) >= 0) {
+			addrs = append(addrs, addr)
+		}
+	}
+	sort.Sort(addressesByHex(addrs))
+
+	var (
+		pool   = p.eth.TxPool()
+		signer = types.MakeSigner(p.chainConfig, p.eth.BlockChain().CurrentBlock().Number())
+	)
+	for _, addr := range addrs {
+		nonce := pool.State().GetNonce(p.config.Account)
+		tx := types.NewTransaction(nonce, addr, p.balances[addr], params.TxGas, p.gasPrice(), nil)
+		signature, err := p.eth.AccountManager().SignEthereum(p.config.Account, signer.Hash(tx).Bytes())
+		if err == nil {
+			tx, err = tx.WithSignature(signer, signature)
+		}
+		if err == nil {
+			err = pool.AddLocal(tx)
+		}
+		if err != nil {
+			glog.V(logger.Warn).Infof("Failed to pay out %v wei to %x: %v", p.balances[addr], addr, err)
+			return
+		}
+		glog.V(logger.Info).Infof("Paid out %v wei to %x in %x", p.balances[addr], addr, tx.Hash())
+		delete(p.balances, addr)
+	}
+}
+
+type addressesByHex []common.Address
+
+func (s addressesByHex) Len() int           { return len(s) }
+func (s addressesByHex) Less(i, j int) bool { return s[i].Hex() < s[j].Hex() }
+func (s addressesByHex) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// payoutAmount is a share difficulty or balance of a worker address as persisted.
+type payoutAmount struct {
+	Address common.Address `json:"address"`
+	Amount  *big.Int       `json:"amount"`
+}
+
+// payoutRoundJSON is a sealed block waiting to mature as persisted.
+type payoutRoundJSON struct {
+	Number uint64         `json:"number"`
+	Hash   common.Hash    `json:"hash"`
+	Shares []payoutAmount `json:"shares"`
+}
+
+// payoutState is the share state as persisted.
+type payoutState struct {
+	Shares   []payoutAmount    `json:"shares"`
+	Rounds   []payoutRoundJSON `json:"rounds"`
+	Balances []payoutAmount    `json:"balances"`
+}
+
+func encodeAmounts(amounts map[common.Address]*big.Int) []payoutAmount {
+	enc := make([]payoutAmount, 0, len(amounts))
+	for addr, amount := range amounts {
+		enc = append(enc, payoutAmount{addr, amount})
+	}
+	return enc
+}
+
+func decodeAmounts(enc []payoutAmount) map[common.Address]*big.Int {
+	amounts := make(map[common.Address]*big.Int, len(enc))
+	for _, amount := range enc {
+		if amount.Amount != nil {
+			addShares(amounts, amount.Address, amount.Amount)
+		}
+	}
+	return amounts
+}
+
+// load restores the persisted share state, a missing file is not an error.
+func (p *Payouter) load() error {
+	if p.config.State == "" {
+		return nil
+	}
+	blob, err := ioutil.ReadFile(p.config.State)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var state payoutState
+	if err := json.Unmarshal(blob, &state); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.shares, p.balances, p.rounds = decodeAmounts(state.Shares), decodeAmounts(state.Balances), nil
+	for _, round := range state.Rounds {
+		p.rounds = append(p.rounds, &payoutRound{Number: round.Number, Hash: round.Hash, Shares: decodeAmounts(round.Shares)})
+	}
+	glog.V(logger.Info).Infof("Loaded payout state: %d rounds pending, %d balances", len(p.rounds), len(p.balances))
+	return nil
+}
+
+// save persists the share state, replacing the previous file atomically. The
+// lock must be held.
+func (p *Payouter) save() error {
+	if p.config.State == "" {
+		return nil
+	}
+	state := payoutState{
+		Shares:   encodeAmounts(p.shares),
+		Rounds:   make([]payoutRoundJSON, 0, len(p.rounds)),
+		Balances: encodeAmounts(p.balances),
+	}
+	for _, round := range p.rounds {
+		state.Rounds = append(state.Rounds, payoutRoundJSON{round.Number, round.Hash, encodeAmounts(round.Shares)})
+	}
+	blob, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(p.config.State+".new", blob, 0600); err != nil {
+		return err
+	}
+	return os.Rename(p.config.State+".new", p.config.State)
+}
@@ -0,0 +1,268 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/crypto"
+	"github.com/ur-technology/go-ur/event"
+	"github.com/ur-technology/go-ur/params"
+)
+
+var (
+	payoutWorkerA = common.HexToAddress("0x000000000000000000000000000000000000000a")
+	payoutWorkerB = common.HexToAddress("0x000000000000000000000000000000000000000b")
+)
+
+// newTestPayouter creates a reward splitter of the given configuration on top of
+// a chain of n blocks mined to its unlocked account, the second one including a
+// transfer of 1000 wei from the account.
+func newTestPayouter(t *testing.T, config PayoutConfig, n int) (*Payouter, *testBackend) {
+	key, _ := crypto.GenerateKey()
+	config.Account = crypto.PubkeyToAddress(key.PublicKey)
+
+	backend := newTestBackend(t, params.TestChainConfig, core.GenesisAccount{Address: config.Account, Balance: common.Ether})
+	account, err := backend.accman.ImportECDSA(key, "")
+	if err != nil {
+		t.Fatalf("failed to import account: %v", err)
+	}
+	if err := backend.accman.Unlock(account, ""); err != nil {
+		t.Fatalf("failed to unlock account: %v", err)
+	}
+	blocks, _ := core.GenerateChain(params.TestChainConfig, backend.chain, backend.chain.Genesis(), backend.db, n, func(i int, gen *core.BlockGen) {
+		gen.SetCoinbase(config.Account)
+		if i == 1 {
+			gen.AddTx(signTx(t, params.TestChainConfig, key, 0, common.Address{0xff}, 1000, nil))
+		}
+	})
+	if _, err := backend.chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	// Reset the pool onto the new head, the payouts are issued on top of it
+	backend.txmux.Post(core.ChainHeadEvent{Block: backend.chain.CurrentBlock()})
+	for i := 0; ; i++ {
+		if state := backend.txpool.State(); state != nil && state.GetNonce(config.Account) == 1 {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("transaction pool not reset onto the chain head")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	payouter := NewPayouter(config, params.TestChainConfig, backend, new(event.TypeMux), func() *big.Int { return big.NewInt(1) })
+	return payouter, backend
+}
+
+// blockIssuance returns the balance credited to addr by a canonical block.
+func blockIssuance(t *testing.T, backend *testBackend, addr common.Address, number uint64) *big.Int {
+	balance := func(number uint64) *big.Int {
+		statedb, err := backend.chain.StateAt(backend.chain.GetBlockByNumber(number).Root())
+		if err != nil {
+			t.Fatalf("failed to retrieve state of block #%d: %v", number, err)
+		}
+		return statedb.GetBalance(addr)
+	}
+	return new(big.Int).Sub(balance(number), balance(number-1))
+}
+
+// payouts returns the payout transactions pending in the pool, by recipient.
+func payouts(backend *testBackend, account common.Address) map[common.Address]*big.Int {
+	pending, _ := backend.txpool.Content()
+
+	amounts := make(map[common.Address]*big.Int)
+	for _, tx := range pending[account] {
+		amounts[*tx.To()] = tx.Value()
+	}
+	return amounts
+}
+
+// Tests that the reward of a matured block is split in proportion of the shares,
+// leaving out the gas the pool collected from its own transactions.
+func TestPayoutSplit(t *testing.T) {
+	p, backend := newTestPayouter(t, PayoutConfig{Depth: 2}, 4)
+	defer backend.close()
+
+	p.RecordShare(payoutWorkerA.Hex()+".rig1", big.NewInt(1))
+	p.RecordShare(payoutWorkerB.Hex(), big.NewInt(3))
+	p.RecordShare("rig", big.NewInt(100))
+
+	p.seal(backend.chain.GetBlockByNumber(2))
+	if len(p.shares) != 0 {
+		t.Fatalf("shares not reset by the sealed block: %v", p.shares)
+	}
+	p.mature(3)
+	if len(p.rounds) != 1 || len(p.balances) != 0 {
+		t.Fatalf("immature round split: %d rounds, balances %v", len(p.rounds), p.balances)
+	}
+	p.mature(4)
+	if len(p.rounds) != 0 {
+		t.Fatalf("matured round still pending")
+	}
+	// The pool's own transfer paid the gas it collected, only the transfer is gone
+	reward := blockIssuance(t, backend, p.config.Account, 2)
+	reward.Add(reward, big.NewInt(1000))
+
+	want := map[common.Address]*big.Int{
+		payoutWorkerA: new(big.Int).Div(reward, big.NewInt(4)),
+		payoutWorkerB: new(big.Int).Div(new(big.Int).Mul(reward, big.NewInt(3)), big.NewInt(4)),
+	}
+	have := payouts(backend, p.config.Account)
+	if len(have) != len(want) {
+		t.Fatalf("payout count mismatch: have %v, want %v", have, want)
+	}
+	for addr, amount := range want {
+		if have[addr] == nil || have[addr].Cmp(amount) != 0 {
+			t.Errorf("payout of %x mismatch: have %v, want %v", addr, have[addr], amount)
+		}
+	}
+	if len(p.balances) != 0 {
+		t.Errorf("paid out balances not cleared: %v", p.balances)
+	}
+}
+
+// Tests that the shares of a sealed block not making it to the canonical chain
+// are carried over to the round being mined.
+func TestPayoutOrphanCarryOver(t *testing.T) {
+	p, backend := newTestPayouter(t, PayoutConfig{Depth: 2}, 4)
+	defer backend.close()
+
+	p.RecordShare(payoutWorkerA.Hex(), big.NewInt(2))
+	p.seal(types.NewBlock(&types.Header{Number: big.NewInt(2), Coinbase: p.config.Account, Extra: []byte("orphan")}, nil, nil, nil))
+	p.RecordShare(payoutWorkerA.Hex(), big.NewInt(1))
+
+	p.mature(4)
+	if len(p.rounds) != 0 {
+		t.Fatalf("orphaned round still pending")
+	}
+	if shares := p.shares[payoutWorkerA]; shares == nil || shares.Cmp(big.NewInt(3)) != 0 {
+		t.Errorf("carried over shares mismatch: have %v, want 3", shares)
+	}
+	if len(p.balances) != 0 || len(payouts(backend, p.config.Account)) != 0 {
+		t.Errorf("orphaned round rewarded: balances %v", p.balances)
+	}
+}
+
+// Tests that a matured round whose reward can't be retrieved is kept pending
+// and split once it can.
+func TestPayoutRewardRetry(t *testing.T) {
+	p, backend := newTestPayouter(t, PayoutConfig{Depth: 2}, 5)
+	defer backend.close()
+
+	block := backend.chain.GetBlockByNumber(2)
+	receipts := core.GetBlockReceipts(backend.db, block.Hash(), block.NumberU64())
+	core.DeleteBlockReceipts(backend.db, block.Hash(), block.NumberU64())
+
+	p.RecordShare(payoutWorkerA.Hex(), big.NewInt(1))
+	p.seal(block)
+	p.mature(4)
+	if len(p.rounds) != 1 || len(p.balances) != 0 {
+		t.Fatalf("round without reward not kept pending: %d rounds, balances %v", len(p.rounds), p.balances)
+	}
+	if err := core.WriteBlockReceipts(backend.db, block.Hash(), block.NumberU64(), receipts); err != nil {
+		t.Fatalf("failed to restore receipts: %v", err)
+	}
+	p.mature(5)
+	if len(p.rounds) != 0 {
+		t.Fatalf("round still pending after its reward got available")
+	}
+	if payout := payouts(backend, p.config.Account)[payoutWorkerA]; payout == nil || payout.Sign() <= 0 {
+		t.Errorf("retried round not paid out: have %v", payout)
+	}
+}
+
+// Tests that only the balances reaching the threshold are paid out, the others
+// accumulating until they do.
+func TestPayoutThreshold(t *testing.T) {
+	p, backend := newTestPayouter(t, PayoutConfig{Depth: 1}, 3)
+	defer backend.close()
+
+	reward := blockIssuance(t, backend, p.config.Account, 1)
+	p.config.Threshold = new(big.Int).Div(reward, big.NewInt(2))
+
+	p.RecordShare(payoutWorkerA.Hex(), big.NewInt(1))
+	p.RecordShare(payoutWorkerB.Hex(), big.NewInt(3))
+	p.seal(backend.chain.GetBlockByNumber(1))
+	p.mature(3)
+
+	have := payouts(backend, p.config.Account)
+	if len(have) != 1 || have[payoutWorkerB] == nil {
+		t.Fatalf("payouts mismatch: have %v, want %x only", have, payoutWorkerB)
+	}
+	want := new(big.Int).Div(reward, big.NewInt(4))
+	if balance := p.balances[payoutWorkerA]; balance == nil || balance.Cmp(want) != 0 {
+		t.Errorf("balance below threshold mismatch: have %v, want %v", balance, want)
+	}
+	if _, ok := p.balances[payoutWorkerB]; ok {
+		t.Errorf("paid out balance not cleared")
+	}
+}
+
+// Tests that the share state persisted by a splitter is restored by the next.
+func TestPayoutStatePersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "payout-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := PayoutConfig{Account: common.Address{0x01}, State: filepath.Join(dir, "payouts.json")}
+
+	p := NewPayouter(config, params.TestChainConfig, nil, new(event.TypeMux), nil)
+	p.shares[payoutWorkerA] = big.NewInt(1)
+	p.rounds = []*payoutRound{{Number: 7, Hash: common.Hash{0x07}, Shares: map[common.Address]*big.Int{payoutWorkerB: big.NewInt(2)}}}
+	p.balances[payoutWorkerA] = big.NewInt(3)
+	p.balances[payoutWorkerB] = big.NewInt(4)
+	if err := p.save(); err != nil {
+		t.Fatalf("failed to save state: %v", err)
+	}
+	q := NewPayouter(config, params.TestChainConfig, nil, new(event.TypeMux), nil)
+	if err := q.load(); err != nil {
+		t.Fatalf("failed to load state: %v", err)
+	}
+	checkAmounts := func(name string, have, want map[common.Address]*big.Int) {
+		if len(have) != len(want) {
+			t.Errorf("%s mismatch: have %v, want %v", name, have, want)
+			return
+		}
+		for addr, amount := range want {
+			if have[addr] == nil || have[addr].Cmp(amount) != 0 {
+				t.Errorf("%s of %x mismatch: have %v, want %v", name, addr, have[addr], amount)
+			}
+		}
+	}
+	checkAmounts("shares", q.shares, p.shares)
+	checkAmounts("balances", q.balances, p.balances)
+	if len(q.rounds) != 1 || q.rounds[0].Number != 7 || q.rounds[0].Hash != (common.Hash{0x07}) {
+		t.Fatalf("rounds mismatch: have %v, want %v", q.rounds, p.rounds)
+	}
+	checkAmounts("round shares", q.rounds[0].Shares, p.rounds[0].Shares)
+
+	// A missing state file starts afresh
+	config.State = filepath.Join(dir, "missing.json")
+	if err := NewPayouter(config, params.TestChainConfig, nil, new(event.TypeMux), nil).load(); err != nil {
+		t.Errorf("missing state file failed to load: %v", err)
+	}
+}
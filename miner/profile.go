@@ -0,0 +1,172 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/common/hexutil"
+	"github.com/ur-technology/go-ur/core"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/event"
+)
+
+// BlockProfile describes how the next block would be assembled out of the
+// current transaction pool contents.
+type BlockProfile struct {
+	Number     *hexutil.Big   `json:"number"`
+	ParentHash common.Hash    `json:"parentHash"`
+	Coinbase   common.Address `json:"coinbase"`
+	GasLimit   *hexutil.Big   `json:"gasLimit"`
+	GasUsed    *hexutil.Big   `json:"gasUsed"`
+	GasPrice   *hexutil.Big   `json:"gasPrice"` // Minimum gas price accepted by the miner
+
+	Transactions []*TxProfile  `json:"transactions"`
+	Underpriced  int           `json:"underpriced"` // Transactions skipped for their gas price
+	Failed       int           `json:"failed"`      // Transactions skipped for failing to apply
+	Uncles       []common.Hash `json:"uncles"`
+	Signups      int           `json:"signups"`
+
+	Rewards BlockRewards `json:"rewards"`
+}
+
+// TxProfile describes a transaction included in a profiled block, in inclusion
+// order.
+type TxProfile struct {
+	Hash     common.Hash     `json:"hash"`
+	From     common.Address  `json:"from"`
+	To       *common.Address `json:"to"`
+	GasPrice *hexutil.Big    `json:"gasPrice"`
+	Gas      *hexutil.Big    `json:"gas"`
+	GasUsed  *hexutil.Big    `json:"gasUsed"`
+	Fee      *hexutil.Big    `json:"fee"`
+	Signup   bool            `json:"signup"`
+}
+
+// BlockRewards is the breakdown of what the coinbase of a block is paid.
+type BlockRewards struct {
+	Block   *hexutil.Big `json:"block"`   // Static block reward
+	Uncles  *hexutil.Big `json:"uncles"`  // Uncle inclusion rewards
+	Signups *hexutil.Big `json:"signups"` // Block rewards of the included signups
+	Fees    *hexutil.Big `json:"fees"`    // Transaction fees
+	Total   *hexutil.Big `json:"total"`
+}
+
+// PendingBlockProfile assembles the block which would be mined next out of the
+// current transaction pool contents and reports how it was done. It is a dry
+// run: neither the pool nor the pending block are modified.
+func (self *Miner) PendingBlockProfile() (*BlockProfile, error) {
+	return self.worker.profile()
+}
+
+// profile assembles a throwaway block on top of the current head the same way
+// commitNewWork does, returning its profile.
+func (self *worker) profile() (*BlockProfile, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.uncleMu.Lock()
+	defer self.uncleMu.Unlock()
+
+	parent := self.chain.CurrentBlock()
+	tstamp := time.Now().Unix()
+	if parent.Time().Cmp(new(big.Int).SetInt64(tstamp)) >= 0 {
+		tstamp = parent.Time().Int64() + 1
+	}
+	header := self.makeHeader(parent, tstamp)
+
+	work, err := self.makeWork(parent, header)
+	if err != nil {
+		return nil, err
+	}
+	if self.config.DAOForkSupport && self.config.DAOForkBlock != nil && self.config.DAOForkBlock.Cmp(header.Number) == 0 {
+		core.ApplyDAOHardFork(work.state)
+	}
+	// Events of the dry run must not reach the live subscribers
+	txs := types.NewTransactionsByPriceAndNonce(self.eth.TxPool().Pending())
+	work.commitTransactions(new(event.TypeMux), txs, self.gasPrice, self.chain)
+
+	profile := &BlockProfile{
+		Number:       (*hexutil.Big)(header.Number),
+		ParentHash:   header.ParentHash,
+		Coinbase:     header.Coinbase,
+		GasLimit:     (*hexutil.Big)(header.GasLimit),
+		GasUsed:      (*hexutil.Big)(header.GasUsed),
+		GasPrice:     (*hexutil.Big)(new(big.Int).Set(self.gasPrice)),
+		Transactions: make([]*TxProfile, len(work.txs)),
+		Underpriced:  len(work.lowGasTxs),
+		Failed:       len(work.failedTxs),
+		Uncles:       []common.Hash{},
+	}
+	for hash, uncle := range self.possibleUncles {
+		if len(profile.Uncles) == 2 {
+			break
+		}
+		if err := self.commitUncle(work, uncle.Header()); err == nil {
+			profile.Uncles = append(profile.Uncles, hash)
+		}
+	}
+	fees := new(big.Int)
+	for i, tx := range work.txs {
+		msg, err := tx.AsMessage(types.MakeSigner(self.config, header.Number))
+		if err != nil {
+			return nil, err
+		}
+		gasUsed := work.receipts[i].GasUsed
+		fee := new(big.Int).Mul(gasUsed, tx.GasPrice())
+		fees.Add(fees, fee)
+
+		// Signups without a valid signup chain are processed as plain transfers
+		signup := core.IsSignupTransaction(self.config, msg)
+		if signup {
+			if _, err := core.SignupChain(self.chain, tx); err != nil {
+				signup = false
+			}
+		}
+		if signup {
+			profile.Signups++
+		}
+		profile.Transactions[i] = &TxProfile{
+			Hash:     tx.Hash(),
+			From:     msg.From(),
+			To:       tx.To(),
+			GasPrice: (*hexutil.Big)(tx.GasPrice()),
+			Gas:      (*hexutil.Big)(tx.Gas()),
+			GasUsed:  (*hexutil.Big)(gasUsed),
+			Fee:      (*hexutil.Big)(fee),
+			Signup:   signup,
+		}
+	}
+	var (
+		reward  = core.Rewards(self.config).BlockReward
+		uncles  = new(big.Int).Mul(core.UncleInclusionReward(self.config, header.Number), big.NewInt(int64(len(profile.Uncles))))
+		signups = new(big.Int).Mul(reward, big.NewInt(int64(profile.Signups)))
+		total   = new(big.Int).Add(reward, uncles)
+	)
+	total.Add(total, signups)
+	total.Add(total, fees)
+
+	profile.Rewards = BlockRewards{
+		Block:   (*hexutil.Big)(new(big.Int).Set(reward)),
+		Uncles:  (*hexutil.Big)(uncles),
+		Signups: (*hexutil.Big)(signups),
+		Fees:    (*hexutil.Big)(fees),
+		Total:   (*hexutil.Big)(total),
+	}
+	return profile, nil
+}
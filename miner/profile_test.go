@@ -0,0 +1,158 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"crypto/ecdsa"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ur-technology/go-ur/accounts"
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/crypto"
+	"github.com/ur-technology/go-ur/ethdb"
+	"github.com/ur-technology/go-ur/event"
+	"github.com/ur-technology/go-ur/params"
+)
+
+// testBackend is a miner backend on top of an in-memory chain.
+type testBackend struct {
+	db     ethdb.Database
+	chain  *core.BlockChain
+	txpool *core.TxPool
+	txmux  *event.TypeMux
+	accman *accounts.Manager
+	keydir string
+}
+
+// newTestBackend creates a chain with the given genesis allocations, along with
+// a transaction pool on top of it.
+func newTestBackend(t *testing.T, config *params.ChainConfig, alloc ...core.GenesisAccount) *testBackend {
+	db, _ := ethdb.NewMemDatabase()
+	core.WriteGenesisBlockForTesting(db, alloc...)
+
+	chain, err := core.NewBlockChain(db, config, core.FakePow{}, new(event.TypeMux))
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	keydir, err := ioutil.TempDir("", "miner-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	txmux := new(event.TypeMux)
+	return &testBackend{
+		db:     db,
+		chain:  chain,
+		txpool: core.NewTxPool(config, txmux, chain.State, chain.GasLimit, nil),
+		txmux:  txmux,
+		accman: accounts.NewManager(keydir, accounts.LightScryptN, accounts.LightScryptP),
+		keydir: keydir,
+	}
+}
+
+func (b *testBackend) AccountManager() *accounts.Manager { return b.accman }
+func (b *testBackend) BlockChain() *core.BlockChain      { return b.chain }
+func (b *testBackend) TxPool() *core.TxPool              { return b.txpool }
+func (b *testBackend) ChainDb() ethdb.Database           { return b.db }
+
+func (b *testBackend) close() {
+	b.txpool.Stop()
+	b.chain.Stop()
+	os.RemoveAll(b.keydir)
+}
+
+// newTestWorker creates a worker on top of the backend, without starting its
+// event loops.
+func newTestWorker(config *params.ChainConfig, backend *testBackend, coinbase common.Address) *worker {
+	return &worker{
+		config:         config,
+		eth:            backend,
+		mux:            new(event.TypeMux),
+		chainDb:        backend.db,
+		gasPrice:       new(big.Int),
+		chain:          backend.chain,
+		proc:           backend.chain.Validator(),
+		possibleUncles: make(map[common.Hash]*types.Block),
+		coinbase:       coinbase,
+		txQueue:        make(map[common.Hash]*types.Transaction),
+		agents:         make(map[Agent]struct{}),
+	}
+}
+
+// signTx creates a transaction of the given value and data, signed by key.
+func signTx(t *testing.T, config *params.ChainConfig, key *ecdsa.PrivateKey, nonce uint64, to common.Address, value int64, data []byte) *types.Transaction {
+	tx := types.NewTransaction(nonce, to, big.NewInt(value), big.NewInt(100000), big.NewInt(1), data)
+	signed, err := tx.SignECDSA(types.NewEIP155Signer(config.ChainId), key)
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	return signed
+}
+
+// Tests that the block profile only counts the signups with a valid signup
+// chain, as the others are processed as plain transfers.
+func TestPendingBlockProfileSignups(t *testing.T) {
+	var (
+		key, _    = crypto.GenerateKey()
+		sender    = crypto.PubkeyToAddress(key.PublicKey)
+		coinbase  = common.Address{0xc0}
+		member    = common.Address{0x01}
+		unchained = common.Address{0x02}
+		config    = *params.TestChainConfig
+	)
+	config.UR = &params.URConfig{Privileged: []params.URPrivilegedSender{{Address: sender, Receiver: common.Address{0xaa}, URFF: common.Address{0xbb}}}}
+
+	backend := newTestBackend(t, &config, core.GenesisAccount{Address: sender, Balance: new(big.Int).Mul(common.Ether, big.NewInt(1000000))})
+	defer backend.close()
+
+	backend.txpool.AddBatch([]*types.Transaction{
+		signTx(t, &config, key, 0, member, 1, []byte{1}),                      // signup by the privileged sender
+		signTx(t, &config, key, 1, unchained, 1, []byte{1, 0xde, 0xad, 0xbe}), // signup with an invalid chain
+		signTx(t, &config, key, 2, member, 1000, nil),                         // plain transfer
+	})
+	profile, err := newTestWorker(&config, backend, coinbase).profile()
+	if err != nil {
+		t.Fatalf("failed to profile block: %v", err)
+	}
+	if len(profile.Transactions) != 3 {
+		t.Fatalf("transaction count mismatch: have %d, want %d", len(profile.Transactions), 3)
+	}
+	for i, want := range []bool{true, false, false} {
+		if have := profile.Transactions[i].Signup; have != want {
+			t.Errorf("transaction %d: signup mismatch: have %v, want %v", i, have, want)
+		}
+	}
+	if profile.Signups != 1 {
+		t.Errorf("signup count mismatch: have %d, want %d", profile.Signups, 1)
+	}
+	reward := core.Rewards(&config).BlockReward
+	if have := (*big.Int)(profile.Rewards.Signups); have.Cmp(reward) != 0 {
+		t.Errorf("signup rewards mismatch: have %v, want %v", have, reward)
+	}
+	total := new(big.Int).Add(reward, reward)
+	total.Add(total, (*big.Int)(profile.Rewards.Fees))
+	if have := (*big.Int)(profile.Rewards.Total); have.Cmp(total) != 0 {
+		t.Errorf("total rewards mismatch: have %v, want %v", have, total)
+	}
+	if profile.Coinbase != coinbase {
+		t.Errorf("coinbase mismatch: have %x, want %x", profile.Coinbase, coinbase)
+	}
+}
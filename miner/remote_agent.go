@@ -17,8 +17,11 @@
 package miner
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"math/big"
+	"net/http"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -29,6 +32,10 @@ import (
 	"github.com/ur-technology/go-ur/logger/glog"
 )
 
+// notifyTimeout is the time a work notification URL has to accept a new work
+// package before the request is abandoned.
+const notifyTimeout = time.Second
+
 type hashrate struct {
 	ping time.Time
 	rate uint64
@@ -47,6 +54,9 @@ type RemoteAgent struct {
 	hashrateMu sync.RWMutex
 	hashrate   map[common.Hash]hashrate
 
+	notify []string     // URLs new work packages are posted to
+	client *http.Client // Client posting the work notifications
+
 	running int32 // running indicates whether the agent is active. Call atomically
 }
 
@@ -57,6 +67,14 @@ func NewRemoteAgent() *RemoteAgent {
 	}
 }
 
+// SetNotify sets the URLs that every new work package is posted to as a JSON
+// array in the eth_getWork format, so external miners don't have to poll for it.
+// It must be called before the agent is started.
+func (a *RemoteAgent) SetNotify(urls []string) {
+	a.notify = urls
+	a.client = &http.Client{Timeout: notifyTimeout}
+}
+
 func (a *RemoteAgent) SubmitHashrate(id common.Hash, rate uint64) {
 	a.hashrateMu.Lock()
 	defer a.hashrateMu.Unlock()
@@ -91,6 +109,19 @@ func (a *RemoteAgent) Stop() {
 	close(a.workCh)
 }
 
+// Hashrates returns the hashrate last reported by each identifier that submitted
+// one recently.
+func (a *RemoteAgent) Hashrates() map[string]AgentHashrate {
+	a.hashrateMu.RLock()
+	defer a.hashrateMu.RUnlock()
+
+	rates := make(map[string]AgentHashrate, len(a.hashrate))
+	for id, hashrate := range a.hashrate {
+		rates[id.Hex()] = AgentHashrate{Hashrate: hashrate.rate, LastSeen: hashrate.ping}
+	}
+	return rates
+}
+
 // GetHashRate returns the accumulated hashrate of all identifier combined
 func (a *RemoteAgent) GetHashRate() (tot int64) {
 	a.hashrateMu.RLock()
@@ -107,25 +138,54 @@ func (a *RemoteAgent) GetWork() ([3]string, error) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
+	if a.currentWork != nil {
+		a.work[a.currentWork.Block.HashNoNonce()] = a.currentWork
+		return workPackage(a.currentWork), nil
+	}
+	return [3]string{}, errors.New("No work available yet, don't panic.")
+}
+
+// workPackage returns the header hash, seed hash and target of a work, as handed
+// out to external miners.
+func workPackage(work *Work) [3]string {
 	var res [3]string
+	block := work.Block
+
+	res[0] = block.HashNoNonce().Hex()
+	seedHash, _ := urhash.GetSeedHash(block.NumberU64())
+	res[1] = common.BytesToHash(seedHash).Hex()
+	// Calculate the "target" to be returned to the external miner
+	n := big.NewInt(1)
+	n.Lsh(n, 255)
+	n.Div(n, block.Difficulty())
+	n.Lsh(n, 1)
+	res[2] = common.BytesToHash(n.Bytes()).Hex()
+
+	return res
+}
 
-	if a.currentWork != nil {
-		block := a.currentWork.Block
-
-		res[0] = block.HashNoNonce().Hex()
-		seedHash, _ := urhash.GetSeedHash(block.NumberU64())
-		res[1] = common.BytesToHash(seedHash).Hex()
-		// Calculate the "target" to be returned to the external miner
-		n := big.NewInt(1)
-		n.Lsh(n, 255)
-		n.Div(n, block.Difficulty())
-		n.Lsh(n, 1)
-		res[2] = common.BytesToHash(n.Bytes()).Hex()
-
-		a.work[block.HashNoNonce()] = a.currentWork
-		return res, nil
+// notifyWork posts a new work package to the notification URLs, registering the
+// work so that the solutions found for it are accepted.
+func (a *RemoteAgent) notifyWork(work *Work) {
+	a.mu.Lock()
+	a.work[work.Block.HashNoNonce()] = work
+	a.mu.Unlock()
+
+	blob, err := json.Marshal(workPackage(work))
+	if err != nil {
+		glog.V(logger.Error).Infof("Failed to encode work package: %v", err)
+		return
+	}
+	for _, url := range a.notify {
+		go func(url string) {
+			res, err := a.client.Post(url, "application/json", bytes.NewReader(blob))
+			if err != nil {
+				glog.V(logger.Warn).Infof("Failed to notify %s of new work: %v", url, err)
+				return
+			}
+			res.Body.Close()
+		}(url)
 	}
-	return res, errors.New("No work available yet, don't panic.")
 }
 
 // Returns true or false, but does not indicate if the PoW was correct
@@ -160,6 +220,10 @@ out:
 			a.mu.Lock()
 			a.currentWork = work
 			a.mu.Unlock()
+
+			if len(a.notify) > 0 {
+				a.notifyWork(work)
+			}
 		case <-ticker:
 			// cleanup
 			a.mu.Lock()
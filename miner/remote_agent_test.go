@@ -0,0 +1,79 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ur-technology/go-ur/core/types"
+)
+
+// Tests that new work packages are posted to every notification URL, and that
+// the notified work accepts solutions.
+func TestRemoteAgentNotify(t *testing.T) {
+	posts := make(chan [3]string, 2)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Errorf("notification method mismatch: have %s, want POST", r.Method)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("notification content type mismatch: have %s, want application/json", ct)
+		}
+		blob, _ := ioutil.ReadAll(r.Body)
+
+		var work [3]string
+		if err := json.Unmarshal(blob, &work); err != nil {
+			t.Errorf("failed to decode notification %q: %v", blob, err)
+		}
+		posts <- work
+	})
+	first, second := httptest.NewServer(handler), httptest.NewServer(handler)
+	defer first.Close()
+	defer second.Close()
+
+	agent := NewRemoteAgent()
+	agent.SetNotify([]string{first.URL, second.URL})
+	agent.Start()
+	defer agent.Stop()
+
+	work := &Work{Block: types.NewBlock(&types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(1000)}, nil, nil, nil)}
+	agent.Work() <- work
+
+	want := workPackage(work)
+	for i := 0; i < 2; i++ {
+		select {
+		case have := <-posts:
+			if have != want {
+				t.Errorf("notification %d mismatch: have %v, want %v", i, have, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("notification %d not posted", i)
+		}
+	}
+	agent.mu.Lock()
+	registered := agent.work[work.Block.HashNoNonce()]
+	agent.mu.Unlock()
+	if registered != work {
+		t.Fatalf("notified work not registered for solutions")
+	}
+}
@@ -0,0 +1,560 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/common/hexutil"
+	"github.com/ur-technology/go-ur/logger"
+	"github.com/ur-technology/go-ur/logger/glog"
+	"github.com/ur-technology/go-ur/pow"
+	"github.com/ur-technology/urhash"
+)
+
+const (
+	stratumWorkTTL      = 7 * 12 * time.Second // Time a work package accepts shares after being replaced
+	stratumHashrateTTL  = 10 * time.Second     // Time a submitted hashrate counts towards the total
+	stratumMaxLine      = 4096                 // Maximum size of a stratum request
+	stratumReadTimeout  = 10 * time.Minute     // Idle time after which a stratum client is dropped
+	stratumWriteTimeout = 10 * time.Second
+)
+
+var (
+	errNoWork       = errors.New("no work available yet")
+	errUnknownWork  = errors.New("stale or unknown work")
+	errDuplicate    = errors.New("duplicate share")
+	errInvalidShare = errors.New("invalid proof of work")
+)
+
+// StratumConfig is the configuration of the stratum server.
+type StratumConfig struct {
+	Addr            string   // Listen address of the stratum server (empty = disabled)
+	HTTPAddr        string   // Listen address of the getwork HTTP server (empty = disabled)
+	ShareDifficulty *big.Int // Difficulty of the shares, capped at the block difficulty (nil = block difficulty)
+}
+
+// WorkerStats is the share accounting of an external miner.
+type WorkerStats struct {
+	Accepted  uint64    `json:"accepted"` // Valid shares
+	Rejected  uint64    `json:"rejected"` // Invalid or duplicate shares
+	Stale     uint64    `json:"stale"`    // Shares of unknown or expired work
+	Blocks    uint64    `json:"blocks"`   // Shares sealing a block
+	Hashrate  uint64    `json:"hashrate"` // Last reported hashrate
+	LastShare time.Time `json:"lastShare"`
+
+	ping time.Time // Time the hashrate was reported
+}
+
+// stratumWork is a work package handed out to the external miners.
+type stratumWork struct {
+	work   *Work
+	shares map[uint64]struct{} // Nonces already submitted, to reject duplicates
+	until  time.Time           // Expiry once replaced by newer work, zero while current
+}
+
+// StratumServer is a mining agent handing work out to external miners over the
+// stratum protocol and a getwork compatible HTTP endpoint, verifying the shares
+// they submit and accounting them per worker.
+type StratumServer struct {
+	config StratumConfig
+	pow    pow.PoW
+
+	mu       sync.Mutex
+	current  *Work
+	work     map[common.Hash]*stratumWork
+	workers  map[string]*WorkerStats
+	sessions map[*stratumSession]struct{}
+
+	workCh   chan *Work
+	returnCh chan<- *Result
+	shareFn  func(worker string, difficulty *big.Int) // Callback of the valid shares (nil = none)
+	quit     chan struct{}
+	running  int32
+
+	listener     net.Listener
+	httpListener net.Listener
+}
+
+// NewStratumServer creates a stratum server verifying the shares with the given
+// proof of work. It must be registered with the miner and start listening for
+// miners to get work.
+func NewStratumServer(config StratumConfig, pow pow.PoW) *StratumServer {
+	return &StratumServer{
+		config:   config,
+		pow:      pow,
+		work:     make(map[common.Hash]*stratumWork),
+		workers:  make(map[string]*WorkerStats),
+		sessions: make(map[*stratumSession]struct{}),
+	}
+}
+
+func (s *StratumServer) Work() chan<- *Work {
+	return s.workCh
+}
+
+func (s *StratumServer) SetReturnCh(returnCh chan<- *Result) {
+	s.returnCh = returnCh
+}
+
+// SetShareCallback sets the function the valid shares are reported to, with the
+// name of the submitting worker and the share difficulty.
+func (s *StratumServer) SetShareCallback(fn func(worker string, difficulty *big.Int)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.shareFn = fn
+}
+
+func (s *StratumServer) Start() {
+	if !atomic.CompareAndSwapInt32(&s.running, 0, 1) {
+		return
+	}
+	s.quit = make(chan struct{})
+	s.workCh = make(chan *Work, 1)
+	go s.loop()
+}
+
+func (s *StratumServer) Stop() {
+	if !atomic.CompareAndSwapInt32(&s.running, 1, 0) {
+		return
+	}
+	close(s.quit)
+	close(s.workCh)
+
+	s.mu.Lock()
+	s.current = nil
+	s.mu.Unlock()
+}
+
+// GetHashRate returns the combined hashrate reported by the workers.
+func (s *StratumServer) GetHashRate() (tot int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, stats := range s.workers {
+		if time.Since(stats.ping) < stratumHashrateTTL {
+			tot += int64(stats.Hashrate)
+		}
+	}
+	return tot
+}
+
+// Workers returns a copy of the share accounting of every worker.
+func (s *StratumServer) Workers() map[string]*WorkerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	workers := make(map[string]*WorkerStats, len(s.workers))
+	for name, stats := range s.workers {
+		cpy := *stats
+		workers[name] = &cpy
+	}
+	return workers
+}
+
+// Hashrates returns the hashrate last reported by each worker that submitted one
+// recently.
+func (s *StratumServer) Hashrates() map[string]AgentHashrate {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rates := make(map[string]AgentHashrate)
+	for name, stats := range s.workers {
+		if time.Since(stats.ping) < stratumHashrateTTL {
+			rates[name] = AgentHashrate{Hashrate: stats.Hashrate, LastSeen: stats.ping}
+		}
+	}
+	return rates
+}
+
+// Listen starts accepting stratum and HTTP connections on the configured
+// addresses.
+func (s *StratumServer) Listen() error {
+	if s.config.Addr != "" {
+		listener, err := net.Listen("tcp", s.config.Addr)
+		if err != nil {
+			return err
+		}
+		s.listener = listener
+		go s.accept()
+		glog.V(logger.Info).Infof("Stratum server listening on %v", listener.Addr())
+	}
+	if s.config.HTTPAddr != "" {
+		listener, err := net.Listen("tcp", s.config.HTTPAddr)
+		if err != nil {
+			s.Close()
+			return err
+		}
+		s.httpListener = listener
+		go http.Serve(listener, s)
+		glog.V(logger.Info).Infof("Getwork server listening on %v", listener.Addr())
+	}
+	return nil
+}
+
+// Close stops accepting connections and drops the connected stratum clients.
+func (s *StratumServer) Close() {
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	if s.httpListener != nil {
+		s.httpListener.Close()
+	}
+	s.mu.Lock()
+	for session := range s.sessions {
+		session.conn.Close()
+	}
+	s.mu.Unlock()
+}
+
+// loop tracks the current work, notifies the stratum clients about it and
+// expires the work replaced long enough ago.
+func (s *StratumServer) loop() {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case work, ok := <-s.workCh:
+			if !ok {
+				return
+			}
+			s.mu.Lock()
+			for _, w := range s.work {
+				if w.until.IsZero() {
+					w.until = time.Now().Add(stratumWorkTTL)
+				}
+			}
+			s.current = work
+			s.work[work.Block.HashNoNonce()] = &stratumWork{work: work, shares: make(map[uint64]struct{})}
+			pkg := s.workPackage(work)
+			for session := range s.sessions {
+				go session.notify(pkg)
+			}
+			s.mu.Unlock()
+
+		case <-ticker.C:
+			s.mu.Lock()
+			for hash, w := range s.work {
+				if !w.until.IsZero() && time.Now().After(w.until) {
+					delete(s.work, hash)
+				}
+			}
+			s.mu.Unlock()
+
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// shareDifficulty returns the difficulty of the shares of a work package.
+func (s *StratumServer) shareDifficulty(work *Work) *big.Int {
+	diff := work.Block.Difficulty()
+	if s.config.ShareDifficulty != nil && s.config.ShareDifficulty.Sign() > 0 && s.config.ShareDifficulty.Cmp(diff) < 0 {
+		return s.config.ShareDifficulty
+	}
+	return diff
+}
+
+// workPackage assembles the getwork package of a work: the pow hash, the seed
+// hash and the share target. The lock must be held.
+func (s *StratumServer) workPackage(work *Work) [3]string {
+	block := work.Block
+	seedHash, _ := urhash.GetSeedHash(block.NumberU64())
+	target := new(big.Int).Div(maxUint256, s.shareDifficulty(work))
+	return [3]string{
+		block.HashNoNonce().Hex(),
+		common.BytesToHash(seedHash).Hex(),
+		common.BytesToHash(target.Bytes()).Hex(),
+	}
+}
+
+// GetWork returns the package of the current work.
+func (s *StratumServer) GetWork() ([3]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.current == nil {
+		return [3]string{}, errNoWork
+	}
+	return s.workPackage(s.current), nil
+}
+
+// shareBlock is a solved block checked against the share difficulty.
+type shareBlock struct {
+	pow.Block
+	difficulty *big.Int
+}
+
+func (b *shareBlock) Difficulty() *big.Int { return b.difficulty }
+
+// SubmitWork verifies a share submitted by a worker, accounting it and sealing
+// the block if the share meets the block difficulty.
+func (s *StratumServer) SubmitWork(worker string, nonce uint64, hash, mixDigest common.Hash) error {
+	s.mu.Lock()
+	stats := s.worker(worker)
+	w := s.work[hash]
+	if w == nil {
+		stats.Stale++
+		s.mu.Unlock()
+		return errUnknownWork
+	}
+	if _, ok := w.shares[nonce]; ok {
+		stats.Rejected++
+		s.mu.Unlock()
+		return errDuplicate
+	}
+	w.shares[nonce] = struct{}{}
+	diff := s.shareDifficulty(w.work)
+	s.mu.Unlock()
+
+	// Verify outside of the lock, it may need to generate a cache
+	block := w.work.Block.WithMiningResult(nonce, mixDigest)
+	valid := s.pow.Verify(&shareBlock{block, diff})
+	sealed := valid && (diff.Cmp(block.Difficulty()) == 0 || s.pow.Verify(block))
+
+	s.mu.Lock()
+	if !valid {
+		stats.Rejected++
+		s.mu.Unlock()
+		return errInvalidShare
+	}
+	stats.Accepted++
+	stats.LastShare = time.Now()
+	sealed = sealed && atomic.LoadInt32(&s.running) == 1
+	if sealed {
+		stats.Blocks++
+	}
+	shareFn, returnCh := s.shareFn, s.returnCh
+	s.mu.Unlock()
+
+	// Report outside of the lock, the receivers may query the server back
+	if shareFn != nil {
+		shareFn(worker, diff)
+	}
+	if sealed {
+		glog.V(logger.Info).Infof("Worker %q sealed block #%d [%x…]", worker, block.NumberU64(), block.Hash().Bytes()[:4])
+		returnCh <- &Result{w.work, block}
+	}
+	return nil
+}
+
+// SubmitHashrate records the hashrate reported by a worker.
+func (s *StratumServer) SubmitHashrate(worker string, rate uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := s.worker(worker)
+	stats.Hashrate, stats.ping = rate, time.Now()
+}
+
+// worker returns the accounting of a worker, creating it if needed. The lock
+// must be held.
+func (s *StratumServer) worker(name string) *WorkerStats {
+	if name == "" {
+		name = "default"
+	}
+	stats := s.workers[name]
+	if stats == nil {
+		stats = new(WorkerStats)
+		s.workers[name] = stats
+	}
+	return stats
+}
+
+// stratumRequest is a JSON-RPC request of the stratum and getwork protocols.
+type stratumRequest struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params []string        `json:"params"`
+	Worker string          `json:"worker"`
+}
+
+type stratumError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type stratumResponse struct {
+	ID      json.RawMessage `json:"id"`
+	Version string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result"`
+	Error   *stratumError   `json:"error,omitempty"`
+}
+
+// handle executes a request on behalf of a worker.
+func (s *StratumServer) handle(worker string, req *stratumRequest) *stratumResponse {
+	res := &stratumResponse{ID: req.ID, Version: "2.0"}
+	fail := func(err error) *stratumResponse {
+		res.Result, res.Error = false, &stratumError{-32000, err.Error()}
+		return res
+	}
+	if req.Worker != "" {
+		worker = req.Worker
+	}
+	switch req.Method {
+	case "eth_submitLogin":
+		res.Result = true
+
+	case "eth_getWork":
+		work, err := s.GetWork()
+		if err != nil {
+			return fail(err)
+		}
+		res.Result = work
+
+	case "eth_submitWork":
+		if len(req.Params) != 3 {
+			return fail(errors.New("expected nonce, pow hash and mix digest"))
+		}
+		nonce, err := hexutil.DecodeUint64(req.Params[0])
+		if err != nil {
+			return fail(err)
+		}
+		err = s.SubmitWork(worker, nonce, common.HexToHash(req.Params[1]), common.HexToHash(req.Params[2]))
+		if err == errInvalidShare || err == errUnknownWork || err == errDuplicate {
+			res.Result = false
+		} else if err != nil {
+			return fail(err)
+		} else {
+			res.Result = true
+		}
+
+	case "eth_submitHashrate":
+		if len(req.Params) < 1 {
+			return fail(errors.New("expected hashrate"))
+		}
+		rate, err := hexutil.DecodeUint64(req.Params[0])
+		if err != nil {
+			return fail(err)
+		}
+		s.SubmitHashrate(worker, rate)
+		res.Result = true
+
+	default:
+		res.Error = &stratumError{-32601, "method not found: " + req.Method}
+	}
+	return res
+}
+
+// ServeHTTP implements the getwork endpoint, taking the worker name from the
+// request path like the common miners do (http://host:port/<worker>).
+func (s *StratumServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	req := new(stratumRequest)
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, stratumMaxLine)).Decode(req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.handle(strings.Trim(r.URL.Path, "/"), req))
+}
+
+// accept serves the stratum clients until the listener is closed.
+func (s *StratumServer) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		session := &stratumSession{server: s, conn: conn}
+		s.mu.Lock()
+		s.sessions[session] = struct{}{}
+		s.mu.Unlock()
+
+		go session.serve()
+	}
+}
+
+// stratumSession is the connection of a stratum client.
+type stratumSession struct {
+	server *StratumServer
+	conn   net.Conn
+	worker string // Worker name given at login
+	lock   sync.Mutex
+}
+
+// serve executes the requests of the client until it disconnects.
+func (c *stratumSession) serve() {
+	defer func() {
+		c.server.mu.Lock()
+		delete(c.server.sessions, c)
+		c.server.mu.Unlock()
+		c.conn.Close()
+	}()
+	reader := bufio.NewReaderSize(c.conn, stratumMaxLine)
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(stratumReadTimeout))
+		line, isPrefix, err := reader.ReadLine()
+		if err != nil || isPrefix {
+			return
+		}
+		if len(line) == 0 {
+			continue
+		}
+		req := new(stratumRequest)
+		if err := json.Unmarshal(line, req); err != nil {
+			glog.V(logger.Debug).Infof("Stratum client %v sent invalid request: %v", c.conn.RemoteAddr(), err)
+			return
+		}
+		if req.Method == "eth_submitLogin" {
+			c.worker = req.Worker
+			if c.worker == "" && len(req.Params) > 0 {
+				c.worker = req.Params[0]
+			}
+		}
+		if err := c.send(c.server.handle(c.worker, req)); err != nil {
+			return
+		}
+	}
+}
+
+// notify pushes a new work package to the client.
+func (c *stratumSession) notify(work [3]string) {
+	c.send(&stratumResponse{ID: json.RawMessage("0"), Version: "2.0", Result: work})
+}
+
+func (c *stratumSession) send(res *stratumResponse) error {
+	blob, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(stratumWriteTimeout))
+	_, err = c.conn.Write(append(blob, '\n'))
+	return err
+}
+
+// maxUint256 is the upper bound of the proof of work results.
+var maxUint256 = new(big.Int).Exp(big.NewInt(2), big.NewInt(256), big.NewInt(0))
@@ -0,0 +1,282 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/common/hexutil"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/pow"
+)
+
+// stratumTestPow is a proof of work accepting the nonces at least as large as
+// the difficulty, to submit shares of a known quality.
+type stratumTestPow struct{}
+
+func (stratumTestPow) Search(pow.Block, <-chan struct{}, int) (uint64, []byte) { return 0, nil }
+func (stratumTestPow) Verify(block pow.Block) bool {
+	return block.Nonce() >= block.Difficulty().Uint64()
+}
+func (stratumTestPow) GetHashrate() int64 { return 0 }
+func (stratumTestPow) Turbo(bool)         {}
+
+// newStratumTestServer creates a running stratum server with shares of
+// difficulty 10, sealing into the returned channel.
+func newStratumTestServer() (*StratumServer, chan *Result) {
+	results := make(chan *Result)
+	server := NewStratumServer(StratumConfig{ShareDifficulty: big.NewInt(10)}, stratumTestPow{})
+	server.SetReturnCh(results)
+	server.Start()
+	return server, results
+}
+
+// pushStratumWork hands a new block of difficulty 1000 to the server and waits
+// for it to become the current work.
+func pushStratumWork(t *testing.T, server *StratumServer) *Work {
+	work := &Work{Block: types.NewBlock(&types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(1000)}, nil, nil, nil)}
+	server.Work() <- work
+
+	for i := 0; i < 100; i++ {
+		if pkg, err := server.GetWork(); err == nil && pkg[0] == work.Block.HashNoNonce().Hex() {
+			return work
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("work not picked up by the server")
+	return nil
+}
+
+// Tests that the submitted shares are verified against the share difficulty,
+// accounted per worker and that the ones meeting the block difficulty seal.
+func TestStratumSubmitWork(t *testing.T) {
+	server, results := newStratumTestServer()
+	defer server.Stop()
+
+	if _, err := server.GetWork(); err != errNoWork {
+		t.Fatalf("work before any pushed: have %v, want %v", err, errNoWork)
+	}
+	// Report the shares into a callback querying the server back
+	shares := make(chan *big.Int, 10)
+	server.SetShareCallback(func(worker string, difficulty *big.Int) {
+		server.Workers()
+		shares <- difficulty
+	})
+	work := pushStratumWork(t, server)
+	hash := work.Block.HashNoNonce()
+
+	if err := server.SubmitWork("rig", 50, common.Hash{1}, common.Hash{}); err != errUnknownWork {
+		t.Errorf("unknown work: have %v, want %v", err, errUnknownWork)
+	}
+	if err := server.SubmitWork("rig", 5, hash, common.Hash{}); err != errInvalidShare {
+		t.Errorf("invalid share: have %v, want %v", err, errInvalidShare)
+	}
+	if err := server.SubmitWork("rig", 50, hash, common.Hash{}); err != nil {
+		t.Errorf("valid share: have %v, want nil", err)
+	}
+	if err := server.SubmitWork("rig", 50, hash, common.Hash{}); err != errDuplicate {
+		t.Errorf("duplicate share: have %v, want %v", err, errDuplicate)
+	}
+	select {
+	case diff := <-shares:
+		if diff.Cmp(big.NewInt(10)) != 0 {
+			t.Errorf("share difficulty mismatch: have %v, want 10", diff)
+		}
+	default:
+		t.Errorf("valid share not reported")
+	}
+	// Seal a block and check that the server stays usable until it's collected
+	errc := make(chan error)
+	go func() { errc <- server.SubmitWork("rig", 5000, hash, common.Hash{}) }()
+
+	done := make(chan struct{})
+	go func() {
+		server.Workers()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("server locked while returning the sealed block")
+	}
+	select {
+	case result := <-results:
+		if result.Work != work || result.Block.Nonce() != 5000 {
+			t.Errorf("sealed result mismatch: have nonce %d", result.Block.Nonce())
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("sealed block not returned")
+	}
+	if err := <-errc; err != nil {
+		t.Errorf("sealing share: have %v, want nil", err)
+	}
+	stats := server.Workers()["rig"]
+	if stats == nil {
+		t.Fatalf("worker not accounted")
+	}
+	if stats.Accepted != 2 || stats.Rejected != 2 || stats.Stale != 1 || stats.Blocks != 1 {
+		t.Errorf("worker stats mismatch: have %+v, want 2 accepted, 2 rejected, 1 stale, 1 block", stats)
+	}
+}
+
+// Tests the stratum protocol over a TCP connection: login, work notifications,
+// work requests, share and hashrate submissions.
+func TestStratumProtocol(t *testing.T) {
+	server, results := newStratumTestServer()
+	defer server.Stop()
+
+	server.config.Addr = "127.0.0.1:0"
+	if err := server.Listen(); err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	reader := bufio.NewReader(conn)
+	call := func(method string, params ...string) *stratumTestResponse {
+		blob, _ := json.Marshal(&stratumRequest{ID: json.RawMessage("1"), Method: method, Params: params})
+		if _, err := conn.Write(append(blob, '\n')); err != nil {
+			t.Fatalf("%s: failed to send: %v", method, err)
+		}
+		return readStratumResponse(t, reader)
+	}
+	if res := call("eth_submitLogin", "rig"); string(res.Result) != "true" {
+		t.Fatalf("login failed: %s", res.Result)
+	}
+	// New work is pushed to the logged in clients
+	work := pushStratumWork(t, server)
+	want := server.workPackage(work)
+
+	var pkg [3]string
+	if res := readStratumResponse(t, reader); string(res.ID) != "0" {
+		t.Fatalf("notification id mismatch: have %s, want 0", res.ID)
+	} else if err := json.Unmarshal(res.Result, &pkg); err != nil || pkg != want {
+		t.Fatalf("notified work mismatch: have %s, want %v", res.Result, want)
+	}
+	if res := call("eth_getWork"); json.Unmarshal(res.Result, &pkg) != nil || pkg != want {
+		t.Fatalf("requested work mismatch: have %s, want %v", res.Result, want)
+	}
+	hash := work.Block.HashNoNonce().Hex()
+	if res := call("eth_submitWork", hexutil.EncodeUint64(5), hash, common.Hash{}.Hex()); string(res.Result) != "false" {
+		t.Errorf("invalid share accepted: %s", res.Result)
+	}
+	if res := call("eth_submitWork", hexutil.EncodeUint64(50), hash, common.Hash{}.Hex()); string(res.Result) != "true" {
+		t.Errorf("valid share rejected: %s", res.Result)
+	}
+	if res := call("eth_submitWork", hexutil.EncodeUint64(50)); res.Error == nil {
+		t.Errorf("malformed share accepted")
+	}
+	if res := call("eth_submitHashrate", hexutil.EncodeUint64(1000)); string(res.Result) != "true" {
+		t.Errorf("hashrate rejected: %s", res.Result)
+	}
+	if res := call("eth_unknown"); res.Error == nil || res.Error.Code != -32601 {
+		t.Errorf("unknown method error mismatch: have %+v, want -32601", res.Error)
+	}
+	// Seal a block over the connection
+	go func() { <-results }()
+	if res := call("eth_submitWork", hexutil.EncodeUint64(5000), hash, common.Hash{}.Hex()); string(res.Result) != "true" {
+		t.Errorf("sealing share rejected: %s", res.Result)
+	}
+	stats := server.Workers()["rig"]
+	if stats == nil {
+		t.Fatalf("logged in worker not accounted")
+	}
+	if stats.Accepted != 2 || stats.Rejected != 1 || stats.Blocks != 1 || stats.Hashrate != 1000 {
+		t.Errorf("worker stats mismatch: have %+v", stats)
+	}
+	if rate := server.GetHashRate(); rate != 1000 {
+		t.Errorf("hashrate mismatch: have %d, want 1000", rate)
+	}
+}
+
+// Tests the getwork HTTP endpoint, naming the workers after the request path.
+func TestStratumGetwork(t *testing.T) {
+	server, _ := newStratumTestServer()
+	defer server.Stop()
+
+	httpsrv := httptest.NewServer(server)
+	defer httpsrv.Close()
+
+	post := func(path, method string, params ...string) *stratumTestResponse {
+		blob, _ := json.Marshal(&stratumRequest{ID: json.RawMessage("1"), Method: method, Params: params})
+		resp, err := http.Post(httpsrv.URL+path, "application/json", bytes.NewReader(blob))
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", method, err)
+		}
+		defer resp.Body.Close()
+
+		res := new(stratumTestResponse)
+		if err := json.NewDecoder(resp.Body).Decode(res); err != nil {
+			t.Fatalf("%s: failed to decode response: %v", method, err)
+		}
+		return res
+	}
+	if res := post("/rig", "eth_getWork"); res.Error == nil {
+		t.Errorf("work served before any pushed: %s", res.Result)
+	}
+	work := pushStratumWork(t, server)
+
+	var pkg [3]string
+	if res := post("/rig", "eth_getWork"); json.Unmarshal(res.Result, &pkg) != nil || pkg != server.workPackage(work) {
+		t.Fatalf("requested work mismatch: have %s", res.Result)
+	}
+	if res := post("/rig", "eth_submitWork", hexutil.EncodeUint64(50), work.Block.HashNoNonce().Hex(), common.Hash{}.Hex()); string(res.Result) != "true" {
+		t.Errorf("valid share rejected: %s", res.Result)
+	}
+	if stats := server.Workers()["rig"]; stats == nil || stats.Accepted != 1 {
+		t.Errorf("share not accounted to the worker of the path: %+v", stats)
+	}
+	if resp, err := http.Get(httpsrv.URL); err != nil {
+		t.Fatalf("GET request failed: %v", err)
+	} else if resp.Body.Close(); resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET status mismatch: have %d, want %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
+
+// stratumTestResponse is a stratum response with the result left encoded.
+type stratumTestResponse struct {
+	ID     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *stratumError   `json:"error"`
+}
+
+func readStratumResponse(t *testing.T, reader *bufio.Reader) *stratumTestResponse {
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+	res := new(stratumTestResponse)
+	if err := json.Unmarshal(line, res); err != nil {
+		t.Fatalf("failed to decode response %q: %v", line, err)
+	}
+	return res
+}
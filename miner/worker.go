@@ -18,8 +18,8 @@ package miner
 
 import (
 	"bytes"
-	"fmt"
 	"math/big"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -42,8 +42,9 @@ import (
 var jsonlogger = logger.NewJsonLogger()
 
 const (
-	resultQueueSize  = 10
-	miningLogAtDepth = 5
+	resultQueueSize       = 10
+	miningLogAtDepth      = 5
+	recommitCheckInterval = time.Second // Time between checks whether the mined block is due a rebuild
 )
 
 // Agent can register themself with the worker
@@ -110,9 +111,13 @@ type worker struct {
 	proc    core.Validator
 	chainDb ethdb.Database
 
-	coinbase common.Address
-	gasPrice *big.Int
-	extra    []byte
+	coinbase  common.Address
+	coinbases []common.Address // Coinbases the mined blocks rotate through (empty = coinbase)
+	rotation  uint64           // Number of consecutive blocks mined to each rotated coinbase
+	gasPrice  *big.Int
+	gasTarget *big.Int // Gas limit the mined blocks vote toward (nil = params.TargetGasLimit)
+	gasLimit  *big.Int // Gas limit the mined blocks never exceed (nil = no ceiling)
+	extra     []byte
 
 	currentMu sync.Mutex
 	current   *Work
@@ -124,8 +129,14 @@ type worker struct {
 	txQueue   map[common.Hash]*types.Transaction
 
 	// atomic status counters
-	mining int32
-	atWork int32
+	mining  int32
+	atWork  int32
+	instant int32 // Seal new transactions right away instead of with the next block
+	signups int32 // Commit the signup transactions of the privileged accounts before any other
+
+	recommit int64 // Interval of rebuilding the mined block with new transactions (0 = on new heads only)
+	fresh    int32 // Set when transactions arrived since the mined block was built
+	urgent   int32 // Set when signups arrived since the mined block was built
 
 	fullValidation bool
 }
@@ -161,6 +172,28 @@ func (self *worker) setEtherbase(addr common.Address) {
 	self.coinbase = addr
 }
 
+func (self *worker) setExtra(extra []byte) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.extra = extra
+}
+
+func (self *worker) setCoinbaseRotation(coinbases []common.Address, rotation uint64) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.coinbases, self.rotation = coinbases, rotation
+}
+
+// blockCoinbase returns the coinbase of the mined block with the given number.
+//
+// Note, this method assumes the worker lock is held!
+func (self *worker) blockCoinbase(number uint64) common.Address {
+	if len(self.coinbases) == 0 {
+		return self.coinbase
+	}
+	return self.coinbases[(number/self.rotation)%uint64(len(self.coinbases))]
+}
+
 func (self *worker) pending() (*types.Block, *state.StateDB) {
 	self.currentMu.Lock()
 	defer self.currentMu.Unlock()
@@ -197,8 +230,9 @@ func (self *worker) stop() {
 		// Stop all agents.
 		for agent := range self.agents {
 			agent.Stop()
-			// Remove CPU agents.
-			if _, ok := agent.(*CpuAgent); ok {
+			// Remove CPU and instant agents.
+			switch agent.(type) {
+			case *CpuAgent, *InstantAgent:
 				delete(self.agents, agent)
 			}
 		}
@@ -215,6 +249,21 @@ func (self *worker) register(agent Agent) {
 	agent.SetReturnCh(self.recv)
 }
 
+// cpuAgents returns the registered CPU agents, ordered by index.
+func (self *worker) cpuAgents() []*CpuAgent {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	var agents []*CpuAgent
+	for agent := range self.agents {
+		if agent, ok := agent.(*CpuAgent); ok {
+			agents = append(agents, agent)
+		}
+	}
+	sort.Sort(cpuAgentsByIndex(agents))
+	return agents
+}
+
 func (self *worker) unregister(agent Agent) {
 	self.mu.Lock()
 	defer self.mu.Unlock()
@@ -223,9 +272,24 @@ func (self *worker) unregister(agent Agent) {
 }
 
 func (self *worker) update() {
-	for event := range self.events.Chan() {
+	recommit := time.NewTicker(recommitCheckInterval)
+	defer recommit.Stop()
+
+	for {
+		var obj *event.Event
+		select {
+		case obj = <-self.events.Chan():
+			if obj == nil {
+				return
+			}
+		case <-recommit.C:
+			if self.recommitDue() {
+				self.commitNewWork()
+			}
+			continue
+		}
 		// A real event arrived, process interesting content
-		switch ev := event.Data.(type) {
+		switch ev := obj.Data.(type) {
 		case core.ChainHeadEvent:
 			self.commitNewWork()
 		case core.ChainSideEvent:
@@ -243,11 +307,40 @@ func (self *worker) update() {
 
 				self.current.commitTransactions(self.mux, txset, self.gasPrice, self.chain)
 				self.currentMu.Unlock()
+			} else if atomic.LoadInt32(&self.instant) == 1 {
+				// Seal a block with the new transaction right away
+				self.commitNewWork()
+			} else {
+				// Pick the transaction up with the next rebuild of the mined block,
+				// right away for signups if they are prioritized
+				atomic.StoreInt32(&self.fresh, 1)
+				if atomic.LoadInt32(&self.signups) == 1 {
+					if msg, err := ev.Tx.AsMessage(types.MakeSigner(self.config, self.chain.CurrentBlock().Number())); err == nil && core.IsSignupTransaction(self.config, msg) {
+						atomic.StoreInt32(&self.urgent, 1)
+					}
+				}
 			}
 		}
 	}
 }
 
+// recommitDue reports whether the mined block should be rebuilt to include the
+// transactions that arrived since: once the recommit interval elapsed, or right
+// away for signups when prioritized so that they make it into the next block.
+func (self *worker) recommitDue() bool {
+	interval := time.Duration(atomic.LoadInt64(&self.recommit))
+	if interval == 0 || atomic.LoadInt32(&self.mining) == 0 || atomic.LoadInt32(&self.fresh) == 0 {
+		return false
+	}
+	if atomic.LoadInt32(&self.urgent) == 1 && atomic.LoadInt32(&self.signups) == 1 {
+		return true
+	}
+	self.currentMu.Lock()
+	defer self.currentMu.Unlock()
+
+	return self.current != nil && time.Since(self.current.createdAt) >= interval
+}
+
 func newLocalMinedBlock(blockNumber uint64, prevMinedBlocks *uint64RingBuffer) (minedBlocks *uint64RingBuffer) {
 	if prevMinedBlocks == nil {
 		minedBlocks = &uint64RingBuffer{next: 0, ints: make([]uint64, miningLogAtDepth+1)}
@@ -279,6 +372,9 @@ func (self *worker) wait() {
 				}
 				go self.mux.Post(core.NewMinedBlockEvent{Block: block})
 			} else {
+				if self.chain.ReverseDiffBlocks() > 0 {
+					work.state.RecordReverseDiff()
+				}
 				work.state.Commit(self.config.IsEIP158(block.Number()))
 				parent := self.chain.GetBlock(block.ParentHash(), block.NumberU64()-1)
 				if parent == nil {
@@ -286,8 +382,7 @@ func (self *worker) wait() {
 					continue
 				}
 
-				auxValidator := self.eth.BlockChain().AuxValidator()
-				if err := core.ValidateHeader(self.config, auxValidator, block.Header(), parent.Header(), true, false); err != nil && err != core.BlockFutureErr {
+				if err := self.chain.Engine().VerifyHeader(self.chain, block.Header(), parent.Header(), true, false); err != nil && err != core.BlockFutureErr {
 					glog.V(logger.Error).Infoln("Invalid header on mined block:", err)
 					continue
 				}
@@ -297,6 +392,7 @@ func (self *worker) wait() {
 					glog.V(logger.Error).Infoln("error writing block to chain", err)
 					continue
 				}
+				self.chain.WriteReverseDiff(block, work.state.ReverseDiff())
 
 				// update block hash since it is now available and not when the receipt/log of individual transactions were created
 				for _, r := range work.receipts {
@@ -311,7 +407,7 @@ func (self *worker) wait() {
 				// check if canon block and write transactions
 				if stat == core.CanonStatTy {
 					// This puts transactions in a extra db for rpc
-					core.WriteTransactions(self.chainDb, block)
+					self.chain.WriteTxLookups(block)
 					// store the receipts
 					core.WriteReceipts(self.chainDb, work.receipts)
 					// Write map map bloom filters
@@ -368,10 +464,24 @@ func (self *worker) push(work *Work) {
 
 // makeCurrent creates a new environment for the current cycle.
 func (self *worker) makeCurrent(parent *types.Block, header *types.Header) error {
-	state, err := self.chain.StateAt(parent.Root())
+	work, err := self.makeWork(parent, header)
 	if err != nil {
 		return err
 	}
+	if self.current != nil {
+		work.localMinedBlocks = self.current.localMinedBlocks
+	}
+	self.current = work
+	return nil
+}
+
+// makeWork creates a new environment for assembling a block with the given
+// header on top of parent.
+func (self *worker) makeWork(parent *types.Block, header *types.Header) (*Work, error) {
+	state, err := self.chain.StateAt(parent.Root())
+	if err != nil {
+		return nil, err
+	}
 	work := &Work{
 		config:    self.config,
 		signer:    types.NewEIP155Signer(self.config.ChainId),
@@ -396,11 +506,7 @@ func (self *worker) makeCurrent(parent *types.Block, header *types.Header) error
 	// Keep track of transactions which return errors so they can be removed
 	work.tcount = 0
 	work.ownedAccounts = accountAddressesSet(accounts)
-	if self.current != nil {
-		work.localMinedBlocks = self.current.localMinedBlocks
-	}
-	self.current = work
-	return nil
+	return work, nil
 }
 
 func (w *worker) setGasPrice(p *big.Int) {
@@ -414,6 +520,24 @@ func (w *worker) setGasPrice(p *big.Int) {
 	w.mux.Post(core.GasPriceChanged{Price: w.gasPrice})
 }
 
+// setGasLimits sets the gas limit target and ceiling the mined blocks vote
+// toward, nil restoring the defaults.
+func (w *worker) setGasLimits(target, limit *big.Int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.gasTarget, w.gasLimit = target, limit
+}
+
+// gasLimits returns the gas limit target and ceiling the mined blocks vote
+// toward.
+func (w *worker) gasLimits() (target, limit *big.Int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.gasTarget, w.gasLimit
+}
+
 func (self *worker) isBlockLocallyMined(current *Work, deepBlockNum uint64) bool {
 	//Did this instance mine a block at {deepBlockNum} ?
 	var isLocal = false
@@ -431,7 +555,7 @@ func (self *worker) isBlockLocallyMined(current *Work, deepBlockNum uint64) bool
 
 	//Does the block at {deepBlockNum} send earnings to my coinbase?
 	var block = self.chain.GetBlockByNumber(deepBlockNum)
-	return block != nil && block.Coinbase() == self.coinbase
+	return block != nil && block.Coinbase() == self.blockCoinbase(deepBlockNum)
 }
 
 func (self *worker) logLocalMinedBlocks(current, previous *Work) {
@@ -455,6 +579,8 @@ func (self *worker) commitNewWork() {
 	defer self.currentMu.Unlock()
 
 	tstart := time.Now()
+	atomic.StoreInt32(&self.fresh, 0)
+	atomic.StoreInt32(&self.urgent, 0)
 	parent := self.chain.CurrentBlock()
 
 	tstamp := tstart.Unix()
@@ -468,32 +594,7 @@ func (self *worker) commitNewWork() {
 		time.Sleep(wait)
 	}
 
-	num := parent.Number()
-	header := &types.Header{
-		ParentHash: parent.Hash(),
-		Number:     num.Add(num, common.Big1),
-		Difficulty: core.CalcDifficulty(self.config, uint64(tstamp), parent.Time().Uint64(), parent.Number(), parent.Difficulty()),
-		GasLimit:   core.CalcGasLimit(parent),
-		GasUsed:    new(big.Int),
-		Coinbase:   self.coinbase,
-		Extra:      self.extra,
-		Time:       big.NewInt(tstamp),
-		TotalWei:   parent.TotalWei(),
-		NSignups:   parent.NSignups(),
-	}
-	// If we are care about TheDAO hard-fork check whether to override the extra-data or not
-	if daoBlock := self.config.DAOForkBlock; daoBlock != nil {
-		// Check whether the block is among the fork extra-override range
-		limit := new(big.Int).Add(daoBlock, params.DAOForkExtraRange)
-		if header.Number.Cmp(daoBlock) >= 0 && header.Number.Cmp(limit) < 0 {
-			// Depending whether we support or oppose the fork, override differently
-			if self.config.DAOForkSupport {
-				header.Extra = common.CopyBytes(params.DAOForkBlockExtra)
-			} else if bytes.Compare(header.Extra, params.DAOForkBlockExtra) == 0 {
-				header.Extra = []byte{} // If miner opposes, don't let it use the reserved extra-data
-			}
-		}
-	}
+	header := self.makeHeader(parent, tstamp)
 	previous := self.current
 	// Could potentially happen if starting to mine in an odd state.
 	err := self.makeCurrent(parent, header)
@@ -506,8 +607,27 @@ func (self *worker) commitNewWork() {
 	if self.config.DAOForkSupport && self.config.DAOForkBlock != nil && self.config.DAOForkBlock.Cmp(header.Number) == 0 {
 		core.ApplyDAOHardFork(work.state)
 	}
-	txs := types.NewTransactionsByPriceAndNonce(self.eth.TxPool().Pending())
-	commitedTxs := work.commitTransactions(self.mux, txs, self.gasPrice, self.chain)
+	pending := self.eth.TxPool().Pending()
+
+	var commitedTxs types.Transactions
+	if atomic.LoadInt32(&self.signups) == 1 {
+		signups := splitSignups(work.config, pending, work.signer)
+		commitedTxs = work.commitTransactions(self.mux, types.NewTransactionsByPriceAndNonce(copyPending(signups)), self.gasPrice, self.chain)
+
+		// Accounts with signups left out can't have their later transactions included
+		commited := make(map[common.Address]int)
+		for _, tx := range commitedTxs {
+			from, _ := types.Sender(work.signer, tx)
+			commited[from]++
+		}
+		for addr, txs := range signups {
+			if commited[addr] < len(txs) {
+				delete(pending, addr)
+			}
+		}
+	}
+	txs := types.NewTransactionsByPriceAndNonce(pending)
+	commitedTxs = append(commitedTxs, work.commitTransactions(self.mux, txs, self.gasPrice, self.chain)...)
 
 	self.eth.TxPool().RemoveBatch(work.lowGasTxs)
 	self.eth.TxPool().RemoveBatch(work.failedTxs)
@@ -540,11 +660,11 @@ func (self *worker) commitNewWork() {
 	if err != nil {
 		panic(err)
 	}
-	core.UpdateBlockTotals(parent.Header(), header, uncles, msgs)
+	core.UpdateBlockTotals(self.config, parent.Header(), header, uncles, msgs)
 
 	if atomic.LoadInt32(&self.mining) == 1 {
 		// commit state root after all state transitions.
-		core.AccumulateRewards(work.state, header, uncles)
+		self.chain.Engine().Finalize(self.chain, work.state, header, uncles)
 		header.Root = work.state.IntermediateRoot(self.config.IsEIP158(header.Number))
 	}
 
@@ -559,21 +679,108 @@ func (self *worker) commitNewWork() {
 	self.push(work)
 }
 
+// makeHeader assembles the header of the block to mine on top of parent with
+// the given timestamp.
+func (self *worker) makeHeader(parent *types.Block, tstamp int64) *types.Header {
+	num := parent.Number()
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     num.Add(num, common.Big1),
+		Difficulty: core.CalcDifficulty(self.config, uint64(tstamp), parent.Time().Uint64(), parent.Number(), parent.Difficulty()),
+		GasLimit:   self.calcGasLimit(parent),
+		GasUsed:    new(big.Int),
+		Coinbase:   self.blockCoinbase(num.Uint64()),
+		Extra:      self.extra,
+		Time:       big.NewInt(tstamp),
+		TotalWei:   parent.TotalWei(),
+		NSignups:   parent.NSignups(),
+	}
+	// If we are care about TheDAO hard-fork check whether to override the extra-data or not
+	if daoBlock := self.config.DAOForkBlock; daoBlock != nil {
+		// Check whether the block is among the fork extra-override range
+		limit := new(big.Int).Add(daoBlock, params.DAOForkExtraRange)
+		if header.Number.Cmp(daoBlock) >= 0 && header.Number.Cmp(limit) < 0 {
+			// Depending whether we support or oppose the fork, override differently
+			if self.config.DAOForkSupport {
+				header.Extra = common.CopyBytes(params.DAOForkBlockExtra)
+			} else if bytes.Compare(header.Extra, params.DAOForkBlockExtra) == 0 {
+				header.Extra = []byte{} // If miner opposes, don't let it use the reserved extra-data
+			}
+		}
+	}
+	return header
+}
+
+// calcGasLimit computes the gas limit of the block to mine on top of parent,
+// voting toward the configured target and ceiling.
+func (self *worker) calcGasLimit(parent *types.Block) *big.Int {
+	target := self.gasTarget
+	if target == nil {
+		target = params.TargetGasLimit
+	}
+	return core.CalcGasLimitTarget(parent, target, self.gasLimit)
+}
+
 func (self *worker) commitUncle(work *Work, uncle *types.Header) error {
 	hash := uncle.Hash()
 	if work.uncles.Has(hash) {
 		return core.UncleError("Uncle not unique")
 	}
+	if policy := work.config.UnclePolicyAt(work.header.Number); policy != nil && policy.NoUncles {
+		return core.UncleError("Uncles disabled")
+	}
+	if depth := new(big.Int).Sub(work.header.Number, uncle.Number); depth.Cmp(new(big.Int).SetUint64(core.MaxUncleDepth(work.config, work.header.Number))) > 0 {
+		return core.UncleError("Uncle too deep (%v blocks)", depth)
+	}
 	if !work.ancestors.Has(uncle.ParentHash) {
-		return core.UncleError(fmt.Sprintf("Uncle's parent unknown (%x)", uncle.ParentHash[0:4]))
+		return core.UncleError("Uncle's parent unknown (%x)", uncle.ParentHash[0:4])
 	}
 	if work.family.Has(hash) {
-		return core.UncleError(fmt.Sprintf("Uncle already in family (%x)", hash))
+		return core.UncleError("Uncle already in family (%x)", hash)
 	}
 	work.uncles.Add(uncle.Hash())
 	return nil
 }
 
+// splitSignups moves the leading signup transactions of the privileged accounts
+// out of the pending ones, returning them so that they can be committed first.
+func splitSignups(config *params.ChainConfig, pending map[common.Address]types.Transactions, signer types.Signer) map[common.Address]types.Transactions {
+	signups := make(map[common.Address]types.Transactions)
+	for addr, txs := range pending {
+		if !core.IsPrivilegedAddress(config, addr) {
+			continue
+		}
+		n := 0
+		for _, tx := range txs {
+			msg, err := tx.AsMessage(signer)
+			if err != nil || !core.IsSignupTransaction(config, msg) {
+				break
+			}
+			n++
+		}
+		if n == 0 {
+			continue
+		}
+		signups[addr] = txs[:n]
+		if n == len(txs) {
+			delete(pending, addr)
+		} else {
+			pending[addr] = txs[n:]
+		}
+	}
+	return signups
+}
+
+// copyPending returns a copy of a set of pending transactions, as ordering them
+// by price reowns the set.
+func copyPending(pending map[common.Address]types.Transactions) map[common.Address]types.Transactions {
+	cpy := make(map[common.Address]types.Transactions, len(pending))
+	for addr, txs := range pending {
+		cpy[addr] = txs
+	}
+	return cpy
+}
+
 func (env *Work) commitTransactions(mux *event.TypeMux, txs *types.TransactionsByPriceAndNonce, gasPrice *big.Int, bc *core.BlockChain) types.Transactions {
 	gp := new(core.GasPool).AddGas(env.header.GasLimit)
 
@@ -600,6 +807,15 @@ func (env *Work) commitTransactions(mux *event.TypeMux, txs *types.TransactionsB
 			continue
 		}
 
+		// Transactions under the chain's gas price floor would invalidate the block
+		if floor := env.config.MinGasPriceAt(env.header.Number); floor != nil && tx.GasPrice().Cmp(floor) < 0 {
+			glog.V(logger.Detail).Infof("Transaction (%x) below chain minimum gas price (tx=%v min=%v). All sequential txs from this address(%x) will be ignored\n", tx.Hash().Bytes()[:4], common.CurrencyToString(tx.GasPrice()), common.CurrencyToString(floor), from[:4])
+
+			env.lowGasTxs = append(env.lowGasTxs, tx)
+			txs.Pop()
+
+			continue
+		}
 		// Ignore any transactions (and accounts subsequently) with low gas limits
 		if tx.GasPrice().Cmp(gasPrice) < 0 && !env.ownedAccounts.Has(from) {
 			// Pop the current low-priced transaction without shifting in the next from the account
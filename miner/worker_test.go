@@ -0,0 +1,179 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/crypto"
+	"github.com/ur-technology/go-ur/params"
+)
+
+// signupTx creates a signup transaction, or a plain transfer if not a signup.
+func signupTx(t *testing.T, signer types.Signer, key *ecdsa.PrivateKey, nonce uint64, signup bool) *types.Transaction {
+	value, data := big.NewInt(2), []byte(nil)
+	if signup {
+		value, data = big.NewInt(1), []byte{1}
+	}
+	tx, err := types.NewTransaction(nonce, common.Address{0xff}, value, big.NewInt(100000), big.NewInt(1), data).SignECDSA(signer, key)
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	return tx
+}
+
+// Tests that only the leading signup transactions of privileged accounts are
+// split off the pending ones.
+func TestSplitSignups(t *testing.T) {
+	var (
+		mixedKey, _    = crypto.GenerateKey()
+		signupKey, _   = crypto.GenerateKey()
+		otherKey, _    = crypto.GenerateKey()
+		transferKey, _ = crypto.GenerateKey()
+
+		mixed    = crypto.PubkeyToAddress(mixedKey.PublicKey)
+		signup   = crypto.PubkeyToAddress(signupKey.PublicKey)
+		other    = crypto.PubkeyToAddress(otherKey.PublicKey)
+		transfer = crypto.PubkeyToAddress(transferKey.PublicKey)
+
+		signer = types.HomesteadSigner{}
+		config = *params.TestChainConfig
+	)
+	config.UR = &params.URConfig{Privileged: []params.URPrivilegedSender{{Address: mixed}, {Address: signup}, {Address: transfer}}}
+
+	pending := map[common.Address]types.Transactions{
+		mixed: {
+			signupTx(t, signer, mixedKey, 0, true),
+			signupTx(t, signer, mixedKey, 1, true),
+			signupTx(t, signer, mixedKey, 2, false),
+			signupTx(t, signer, mixedKey, 3, true),
+		},
+		signup:   {signupTx(t, signer, signupKey, 0, true)},
+		other:    {signupTx(t, signer, otherKey, 0, true)},
+		transfer: {signupTx(t, signer, transferKey, 0, false), signupTx(t, signer, transferKey, 1, true)},
+	}
+	signups := splitSignups(&config, pending, signer)
+
+	// Leading signups of privileged accounts are split off
+	if len(signups) != 2 {
+		t.Fatalf("signup account count mismatch: have %d, want %d", len(signups), 2)
+	}
+	if txs := signups[mixed]; len(txs) != 2 || txs[0].Nonce() != 0 || txs[1].Nonce() != 1 {
+		t.Errorf("mixed account signups mismatch: have %v", txs)
+	}
+	if txs := signups[signup]; len(txs) != 1 {
+		t.Errorf("signup account signups mismatch: have %d, want %d", len(txs), 1)
+	}
+	// The rest remains pending in order, accounts without leftovers are removed
+	if txs := pending[mixed]; len(txs) != 2 || txs[0].Nonce() != 2 || txs[1].Nonce() != 3 {
+		t.Errorf("mixed account leftovers mismatch: have %v", txs)
+	}
+	if _, ok := pending[signup]; ok {
+		t.Errorf("signup only account still pending")
+	}
+	if txs := pending[other]; len(txs) != 1 {
+		t.Errorf("unprivileged account transactions mismatch: have %d, want %d", len(txs), 1)
+	}
+	if txs := pending[transfer]; len(txs) != 2 {
+		t.Errorf("transfer first account transactions mismatch: have %d, want %d", len(txs), 2)
+	}
+}
+
+// Tests when the mined block is due to be rebuilt with new transactions.
+func TestRecommitDue(t *testing.T) {
+	w := &worker{current: &Work{createdAt: time.Now()}}
+
+	// Nothing is due while not mining, without interval or new transactions
+	atomic.StoreInt32(&w.fresh, 1)
+	atomic.StoreInt64(&w.recommit, int64(time.Millisecond))
+	if w.recommitDue() {
+		t.Fatalf("recommit due while not mining")
+	}
+	atomic.StoreInt32(&w.mining, 1)
+	atomic.StoreInt64(&w.recommit, 0)
+	if w.recommitDue() {
+		t.Fatalf("recommit due without interval")
+	}
+	atomic.StoreInt64(&w.recommit, int64(time.Hour))
+	if w.recommitDue() {
+		t.Fatalf("recommit due before the interval elapsed")
+	}
+	// Signups are committed right away, but only when prioritized
+	atomic.StoreInt32(&w.urgent, 1)
+	if w.recommitDue() {
+		t.Fatalf("recommit due with new signups not prioritized")
+	}
+	atomic.StoreInt32(&w.signups, 1)
+	if !w.recommitDue() {
+		t.Fatalf("recommit not due with new signups")
+	}
+	atomic.StoreInt32(&w.urgent, 0)
+
+	// Other transactions once the interval elapsed
+	w.current.createdAt = time.Now().Add(-2 * time.Hour)
+	if !w.recommitDue() {
+		t.Fatalf("recommit not due after the interval elapsed")
+	}
+	atomic.StoreInt32(&w.fresh, 0)
+	if w.recommitDue() {
+		t.Fatalf("recommit due without new transactions")
+	}
+}
+
+// Tests that the mined blocks rotate through the coinbases, each of which being
+// mined to for the configured number of consecutive blocks.
+func TestBlockCoinbaseRotation(t *testing.T) {
+	var (
+		etherbase = common.Address{0x01}
+		a         = common.Address{0xaa}
+		b         = common.Address{0xbb}
+		c         = common.Address{0xcc}
+	)
+	w := &worker{coinbase: etherbase}
+	for number := uint64(0); number < 4; number++ {
+		if have := w.blockCoinbase(number); have != etherbase {
+			t.Errorf("block %d: coinbase mismatch without rotation: have %x, want %x", number, have, etherbase)
+		}
+	}
+	tests := []struct {
+		rotation  uint64
+		coinbases []common.Address
+	}{
+		{1, []common.Address{a, b, c, a, b, c, a}},
+		{2, []common.Address{a, a, b, b, c, c, a}},
+		{3, []common.Address{a, a, a, b, b, b, c}},
+	}
+	for i, tt := range tests {
+		w.setCoinbaseRotation([]common.Address{a, b, c}, tt.rotation)
+		for number, want := range tt.coinbases {
+			if have := w.blockCoinbase(uint64(number)); have != want {
+				t.Errorf("test %d, block %d: coinbase mismatch: have %x, want %x", i, number, have, want)
+			}
+		}
+	}
+	// Clearing the rotation mines to the etherbase again
+	w.setCoinbaseRotation(nil, 0)
+	if have := w.blockCoinbase(5); have != etherbase {
+		t.Errorf("coinbase mismatch after clearing the rotation: have %x, want %x", have, etherbase)
+	}
+}
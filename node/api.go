@@ -25,6 +25,7 @@ import (
 	"github.com/ur-technology/go-ur/crypto"
 	"github.com/ur-technology/go-ur/p2p"
 	"github.com/ur-technology/go-ur/p2p/discover"
+	"github.com/ur-technology/go-ur/params"
 	"github.com/ur-technology/go-ur/rpc"
 	"github.com/rcrowley/go-metrics"
 )
@@ -74,6 +75,37 @@ func (api *PrivateAdminAPI) RemovePeer(url string) (bool, error) {
 	return true, nil
 }
 
+// AddTrustedPeer allows a remote node to always connect, even if slots are full.
+func (api *PrivateAdminAPI) AddTrustedPeer(url string) (bool, error) {
+	// Make sure the server is running, fail otherwise
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	node, err := discover.ParseNode(url)
+	if err != nil {
+		return false, fmt.Errorf("invalid enode: %v", err)
+	}
+	server.AddTrustedPeer(node)
+	return true, nil
+}
+
+// RemoveTrustedPeer removes a remote node from the trusted peer set, but it
+// does not disconnect it automatically.
+func (api *PrivateAdminAPI) RemoveTrustedPeer(url string) (bool, error) {
+	// Make sure the server is running, fail otherwise
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	node, err := discover.ParseNode(url)
+	if err != nil {
+		return false, fmt.Errorf("invalid enode: %v", err)
+	}
+	server.RemoveTrustedPeer(node)
+	return true, nil
+}
+
 // StartRPC starts the HTTP RPC API server.
 func (api *PrivateAdminAPI) StartRPC(host *string, port *rpc.HexNumber, cors *string, apis *string) (bool, error) {
 	api.node.lock.Lock()
@@ -172,6 +204,25 @@ func (api *PrivateAdminAPI) StopWS() (bool, error) {
 	return true, nil
 }
 
+// ReloadConfig reloads the runtime adjustable options (log levels, transaction
+// pool limits, gas price oracle parameters and RPC limits) from the config file.
+func (api *PrivateAdminAPI) ReloadConfig() (bool, error) {
+	if err := api.node.ReloadConfig(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ReloadPeers re-reads the static and trusted node lists of the data directory
+// and the configuration, connecting to the added static nodes and dropping the
+// removed ones.
+func (api *PrivateAdminAPI) ReloadPeers() (bool, error) {
+	if err := api.node.ReloadPeers(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // PublicAdminAPI is the collection of administrative API methods exposed over
 // both secure and unsecure RPC channels.
 type PublicAdminAPI struct {
@@ -194,14 +245,23 @@ func (api *PublicAdminAPI) Peers() ([]*p2p.PeerInfo, error) {
 	return server.PeersInfo(), nil
 }
 
+// NodeInfo is the information about the host node reported by admin_nodeInfo:
+// the networking details and build metadata along with the status of the
+// services reporting one.
+type NodeInfo struct {
+	*p2p.NodeInfo
+	Build    *params.BuildInfo      `json:"build,omitempty"`
+	Services map[string]interface{} `json:"services,omitempty"`
+}
+
 // NodeInfo retrieves all the information we know about the host node at the
 // protocol granularity.
-func (api *PublicAdminAPI) NodeInfo() (*p2p.NodeInfo, error) {
+func (api *PublicAdminAPI) NodeInfo() (*NodeInfo, error) {
 	server := api.node.Server()
 	if server == nil {
 		return nil, ErrNodeStopped
 	}
-	return server.NodeInfo(), nil
+	return &NodeInfo{NodeInfo: server.NodeInfo(), Build: api.node.config.Build, Services: api.node.serviceInfos()}, nil
 }
 
 // Datadir retrieves the current data directory the node is using.
@@ -260,6 +320,12 @@ func (api *PublicDebugAPI) Metrics(raw bool) (map[string]interface{}, error) {
 					"Overall":      float64(metric.Count()),
 				}
 
+			case metrics.Counter:
+				root[name] = float64(metric.Count())
+
+			case metrics.Gauge:
+				root[name] = float64(metric.Value())
+
 			case metrics.Timer:
 				root[name] = map[string]interface{}{
 					"AvgRate01Min": metric.Rate1(),
@@ -289,6 +355,12 @@ func (api *PublicDebugAPI) Metrics(raw bool) (map[string]interface{}, error) {
 					"Overall":  format(float64(metric.Count()), metric.RateMean()),
 				}
 
+			case metrics.Counter:
+				root[name] = round(float64(metric.Count()), 0)
+
+			case metrics.Gauge:
+				root[name] = round(float64(metric.Value()), 0)
+
 			case metrics.Timer:
 				root[name] = map[string]interface{}{
 					"Avg01Min": format(metric.Rate1()*60, metric.Rate1()),
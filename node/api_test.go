@@ -0,0 +1,62 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package node
+
+import (
+	"testing"
+
+	gometrics "github.com/rcrowley/go-metrics"
+	"github.com/ur-technology/go-ur/metrics"
+)
+
+// Tests that debug_metrics reports counters and gauges, including functional
+// gauges computing their value when read, both raw and formatted.
+func TestDebugMetricsCountersAndGauges(t *testing.T) {
+	counter := gometrics.GetOrRegisterCounter("test/metrics/counter", gometrics.DefaultRegistry)
+	defer gometrics.DefaultRegistry.Unregister("test/metrics/counter")
+	counter.Inc(1500)
+
+	size := int64(7)
+	metrics.NewFunctionalGauge("test/metrics/gauge", func() int64 { return size })
+	defer gometrics.DefaultRegistry.Unregister("test/metrics/gauge")
+
+	// Registering a gauge of the same name replaces the previous one
+	metrics.NewFunctionalGauge("test/metrics/gauge", func() int64 { return 2 * size })
+	size = 21
+
+	api := NewPublicDebugAPI(nil)
+	tests := []struct {
+		raw            bool
+		counter, gauge interface{}
+	}{
+		{true, float64(1500), float64(42)},
+		{false, "1.50K", "42"},
+	}
+	for _, tt := range tests {
+		all, err := api.Metrics(tt.raw)
+		if err != nil {
+			t.Fatalf("raw %v: failed to retrieve metrics: %v", tt.raw, err)
+		}
+		reported := all["test"].(map[string]interface{})["metrics"].(map[string]interface{})
+		if reported["counter"] != tt.counter {
+			t.Errorf("raw %v: counter mismatch: have %v, want %v", tt.raw, reported["counter"], tt.counter)
+		}
+		if reported["gauge"] != tt.gauge {
+			t.Errorf("raw %v: gauge mismatch: have %v, want %v", tt.raw, reported["gauge"], tt.gauge)
+		}
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/ur-technology/go-ur/accounts"
 	"github.com/ur-technology/go-ur/common"
@@ -35,6 +36,7 @@ import (
 	"github.com/ur-technology/go-ur/p2p/discv5"
 	"github.com/ur-technology/go-ur/p2p/nat"
 	"github.com/ur-technology/go-ur/p2p/netutil"
+	"github.com/ur-technology/go-ur/params"
 )
 
 var (
@@ -61,6 +63,10 @@ type Config struct {
 	// in the devp2p node identifier.
 	Version string
 
+	// Build, if set, is the build and packaging metadata of the program reported
+	// by admin_nodeInfo.
+	Build *params.BuildInfo
+
 	// DataDir is the file system folder the node should use for any data storage
 	// requirements. The configured data directory will not be directly shared with
 	// registered services, instead those can use utility methods to create/access
@@ -68,6 +74,11 @@ type Config struct {
 	// in memory.
 	DataDir string
 
+	// DatabaseKey is the secret the databases opened in the data directory are
+	// encrypted at rest with. If empty, the databases are stored in plaintext.
+	// Key files in the key store are encrypted with their own passphrases.
+	DatabaseKey []byte
+
 	// KeyStoreDir is the file system folder that contains private keys. The directory can
 	// be specified as a relative path, in which case it is resolved relative to the
 	// current directory.
@@ -115,6 +126,14 @@ type Config struct {
 	// using the V5 discovery protocol.
 	BootstrapNodesV5 []*discv5.Node
 
+	// StaticNodeURLs lists the enode URLs of the nodes to always stay connected
+	// to, in addition to the static-nodes.json file of the data directory.
+	StaticNodeURLs []string
+
+	// TrustedNodeURLs lists the enode URLs of the nodes always allowed to connect,
+	// in addition to the trusted-nodes.json file of the data directory.
+	TrustedNodeURLs []string
+
 	// Network interface address on which the node should listen for inbound peers.
 	ListenAddr string
 
@@ -175,6 +194,31 @@ type Config struct {
 	// If the module list is empty, all RPC API endpoints designated public will be
 	// exposed.
 	WSModules []string
+
+	// RPCTimeouts is the maximum execution time of a method call, keyed by API
+	// namespace. It applies to all RPC endpoints; namespaces not listed have no
+	// deadline. This allows slow calls (e.g. debug traces) to be cut off without
+	// affecting latency sensitive ones sharing the same server.
+	RPCTimeouts map[string]time.Duration
+
+	// RPCBatchRequestLimit is the maximum number of requests accepted in a single
+	// JSON-RPC batch. Zero means no limit.
+	RPCBatchRequestLimit int
+
+	// RPCBatchResponseMaxSize is the maximum number of bytes returned in response
+	// to a single JSON-RPC batch. Zero means no limit.
+	RPCBatchResponseMaxSize int
+
+	// RPCUpstreams is a list of RPC endpoints of full nodes, in order of preference,
+	// that calls to methods not served locally are forwarded to. This allows a node
+	// (e.g. a light one) to act as a gateway in front of full nodes. The first
+	// healthy endpoint is used, failing over to the next ones. Only the calls within
+	// the namespaces an endpoint exposes are forwarded.
+	RPCUpstreams []string
+
+	// RPCUpstreamForward is a list of namespaces or methods that are forwarded to
+	// the upstream endpoints even though they are served locally.
+	RPCUpstreamForward []string
 }
 
 // IPCEndpoint resolves an IPC endpoint based on a configured value, taking into
@@ -320,6 +364,12 @@ func (c *Config) instanceDir() string {
 	return filepath.Join(c.DataDir, c.name())
 }
 
+// NodeKeyFile returns the path of the persistent node key within the data
+// directory, or an empty string if no data directory is used.
+func (c *Config) NodeKeyFile() string {
+	return c.resolvePath(datadirPrivateKey)
+}
+
 // NodeKey retrieves the currently configured private key of the node, checking
 // first any manually set key, falling back to the one found in the configured
 // data folder. If no key can be found, a new one is generated.
@@ -358,14 +408,16 @@ func (c *Config) NodeKey() *ecdsa.PrivateKey {
 	return key
 }
 
-// StaticNodes returns a list of node enode URLs configured as static nodes.
+// StaticNodes returns a list of node enode URLs configured as static nodes,
+// both in the data directory and in the configuration.
 func (c *Config) StaticNodes() []*discover.Node {
-	return c.parsePersistentNodes(c.resolvePath(datadirStaticNodes))
+	return mergeNodes(c.parsePersistentNodes(c.resolvePath(datadirStaticNodes)), parseNodeURLs(c.StaticNodeURLs))
 }
 
-// TrusterNodes returns a list of node enode URLs configured as trusted nodes.
+// TrusterNodes returns a list of node enode URLs configured as trusted nodes,
+// both in the data directory and in the configuration.
 func (c *Config) TrusterNodes() []*discover.Node {
-	return c.parsePersistentNodes(c.resolvePath(datadirTrustedNodes))
+	return mergeNodes(c.parsePersistentNodes(c.resolvePath(datadirTrustedNodes)), parseNodeURLs(c.TrustedNodeURLs))
 }
 
 // parsePersistentNodes parses a list of discovery node URLs loaded from a .json
@@ -384,9 +436,14 @@ func (c *Config) parsePersistentNodes(path string) []*discover.Node {
 		glog.V(logger.Error).Infof("Can't load node file %s: %v", path, err)
 		return nil
 	}
-	// Interpret the list as a discovery node array
+	return parseNodeURLs(nodelist)
+}
+
+// parseNodeURLs interprets a list of enode URLs as a discovery node array,
+// skipping the invalid ones.
+func parseNodeURLs(urls []string) []*discover.Node {
 	var nodes []*discover.Node
-	for _, url := range nodelist {
+	for _, url := range urls {
 		if url == "" {
 			continue
 		}
@@ -400,6 +457,23 @@ func (c *Config) parsePersistentNodes(path string) []*discover.Node {
 	return nodes
 }
 
+// mergeNodes concatenates node lists, dropping the duplicates.
+func mergeNodes(lists ...[]*discover.Node) []*discover.Node {
+	var (
+		nodes []*discover.Node
+		seen  = make(map[string]bool)
+	)
+	for _, list := range lists {
+		for _, node := range list {
+			if url := node.String(); !seen[url] {
+				seen[url] = true
+				nodes = append(nodes, node)
+			}
+		}
+	}
+	return nodes
+}
+
 func makeAccountManager(conf *Config) (am *accounts.Manager, ephemeralKeystore string, err error) {
 	scryptN := accounts.StandardScryptN
 	scryptP := accounts.StandardScryptP
@@ -148,3 +148,32 @@ func TestNodeKeyPersistency(t *testing.T) {
 		t.Fatalf("ephemeral node key persisted to disk")
 	}
 }
+
+// Tests that the static nodes of the data directory and of the configuration
+// are merged, dropping the duplicates.
+func TestStaticNodesMerge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "node-test")
+	if err != nil {
+		t.Fatalf("failed to create temporary data directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		first  = "enode://a979fb575495b8d6db44f750317d0f4622bf4c2aa3365d6af7c284339968eef29b69ad0dce72a4d8db5ebb4968de0e3bec910127f134779fbcb0cb6d3331163c@52.16.188.185:30303"
+		second = "enode://de471bccee3d042261d52e9bff31458daecc406142b401d4cd848f677479f73104b9fdeb090af9583d3391b7f10cb2ba9e26865dd5fca4fcdc0fb1e3b723c786@54.94.239.50:30303"
+	)
+	if err := os.MkdirAll(filepath.Join(dir, "unit-test"), 0700); err != nil {
+		t.Fatalf("failed to create instance directory: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "unit-test", datadirStaticNodes), []byte(`["`+first+`"]`), 0600); err != nil {
+		t.Fatalf("failed to write static node list: %v", err)
+	}
+	config := &Config{Name: "unit-test", DataDir: dir, StaticNodeURLs: []string{first, second}}
+	nodes := config.StaticNodes()
+	if len(nodes) != 2 || nodes[0].String() != first || nodes[1].String() != second {
+		t.Errorf("static nodes mismatch: have %v, want [%s %s]", nodes, first, second)
+	}
+	if nodes := config.TrusterNodes(); len(nodes) != 0 {
+		t.Errorf("trusted nodes mismatch: have %v, want none", nodes)
+	}
+}
@@ -18,6 +18,7 @@ package node
 
 import (
 	"errors"
+	"fmt"
 	"net"
 	"os"
 	"path/filepath"
@@ -25,16 +26,19 @@ import (
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 
+	"github.com/syndtr/goleveldb/leveldb/storage"
 	"github.com/ur-technology/go-ur/accounts"
 	"github.com/ur-technology/go-ur/ethdb"
 	"github.com/ur-technology/go-ur/event"
 	"github.com/ur-technology/go-ur/internal/debug"
 	"github.com/ur-technology/go-ur/logger"
 	"github.com/ur-technology/go-ur/logger/glog"
+	"github.com/ur-technology/go-ur/metrics"
 	"github.com/ur-technology/go-ur/p2p"
+	"github.com/ur-technology/go-ur/p2p/discover"
 	"github.com/ur-technology/go-ur/rpc"
-	"github.com/syndtr/goleveldb/leveldb/storage"
 )
 
 var (
@@ -42,10 +46,14 @@ var (
 	ErrNodeStopped    = errors.New("node not started")
 	ErrNodeRunning    = errors.New("node already running")
 	ErrServiceUnknown = errors.New("unknown service")
+	ErrNoReloader     = errors.New("configuration reload not supported")
 
 	datadirInUseErrnos = map[uint]bool{11: true, 32: true, 35: true}
 )
 
+// upstreamHealthInterval is the time between health checks of upstream RPC endpoints.
+const upstreamHealthInterval = 15 * time.Second
+
 // Node is a container on which services can be registered.
 type Node struct {
 	eventmux *event.TypeMux // Event multiplexer used between the services of a stack
@@ -61,8 +69,9 @@ type Node struct {
 	serviceFuncs []ServiceConstructor     // Service constructors (in dependency order)
 	services     map[reflect.Type]Service // Currently running services
 
-	rpcAPIs       []rpc.API   // List of APIs currently provided by the node
-	inprocHandler *rpc.Server // In-process RPC request handler to process the API requests
+	rpcAPIs       []rpc.API           // List of APIs currently provided by the node
+	inprocHandler *rpc.Server         // In-process RPC request handler to process the API requests
+	rpcUpstream   *rpc.FailoverClient // Upstream endpoints calls not served locally are forwarded to (nil = none)
 
 	ipcEndpoint string       // IPC endpoint to listen at (empty = IPC disabled)
 	ipcListener net.Listener // IPC RPC listener socket to serve API requests
@@ -77,6 +86,9 @@ type Node struct {
 	wsListener net.Listener // Websocket RPC listener socket to server API requests
 	wsHandler  *rpc.Server  // Websocket RPC request handler to process the API requests
 
+	reloader   func() error // Reloads the runtime adjustable configuration (nil = unsupported)
+	reloadLock sync.Mutex   // Serializes configuration reloads
+
 	stop chan struct{} // Channel to wait for termination notifications
 	lock sync.RWMutex
 }
@@ -237,6 +249,10 @@ func (n *Node) Start() error {
 	n.server = running
 	n.stop = make(chan struct{})
 
+	metrics.NewFunctionalGauge("p2p/peers", func() int64 {
+		return int64(running.PeerCount())
+	})
+
 	return nil
 }
 
@@ -269,23 +285,31 @@ func (n *Node) startRPC(services map[reflect.Type]Service) error {
 	for _, service := range services {
 		apis = append(apis, service.APIs()...)
 	}
+	// Connect to the upstream endpoints, if the node acts as a gateway
+	if len(n.config.RPCUpstreams) > 0 {
+		n.rpcUpstream = rpc.NewFailoverClient(n.config.RPCUpstreams, upstreamHealthInterval)
+	}
 	// Start the various API endpoints, terminating all in case of errors
 	if err := n.startInProc(apis); err != nil {
+		n.stopUpstream()
 		return err
 	}
 	if err := n.startIPC(apis); err != nil {
 		n.stopInProc()
+		n.stopUpstream()
 		return err
 	}
 	if err := n.startHTTP(n.httpEndpoint, apis, n.config.HTTPModules, n.config.HTTPCors); err != nil {
 		n.stopIPC()
 		n.stopInProc()
+		n.stopUpstream()
 		return err
 	}
 	if err := n.startWS(n.wsEndpoint, apis, n.config.WSModules, n.config.WSOrigins); err != nil {
 		n.stopHTTP()
 		n.stopIPC()
 		n.stopInProc()
+		n.stopUpstream()
 		return err
 	}
 	// All API endpoints started successfully
@@ -293,10 +317,48 @@ func (n *Node) startRPC(services map[reflect.Type]Service) error {
 	return nil
 }
 
+// newRPCServer creates an RPC server with the configured per namespace execution
+// deadlines applied, passing the calls within the exposed namespaces it can't
+// serve to the upstreams (nil = all namespaces).
+func (n *Node) newRPCServer(exposed []string) *rpc.Server {
+	handler := rpc.NewServer()
+	for namespace, timeout := range n.config.RPCTimeouts {
+		handler.SetTimeout(namespace, timeout)
+	}
+	handler.SetBatchLimits(n.config.RPCBatchRequestLimit, n.config.RPCBatchResponseMaxSize)
+	if n.rpcUpstream != nil {
+		handler.SetFallback(n.rpcUpstream, n.config.RPCUpstreamForward, exposed)
+	}
+	return handler
+}
+
+// exposedModules returns the namespaces an endpoint with the given whitelist of
+// modules exposes: the whitelisted ones, or the public ones if none are.
+func exposedModules(apis []rpc.API, modules []string) []string {
+	if len(modules) > 0 {
+		return modules
+	}
+	exposed := []string{}
+	for _, api := range apis {
+		if api.Public {
+			exposed = append(exposed, api.Namespace)
+		}
+	}
+	return exposed
+}
+
+// stopUpstream disconnects from the upstream RPC endpoints.
+func (n *Node) stopUpstream() {
+	if n.rpcUpstream != nil {
+		n.rpcUpstream.Close()
+		n.rpcUpstream = nil
+	}
+}
+
 // startInProc initializes an in-process RPC endpoint.
 func (n *Node) startInProc(apis []rpc.API) error {
 	// Register all the APIs exposed by the services
-	handler := rpc.NewServer()
+	handler := n.newRPCServer(nil)
 	for _, api := range apis {
 		if err := handler.RegisterName(api.Namespace, api.Service); err != nil {
 			return err
@@ -322,7 +384,7 @@ func (n *Node) startIPC(apis []rpc.API) error {
 		return nil
 	}
 	// Register all the APIs exposed by the services
-	handler := rpc.NewServer()
+	handler := n.newRPCServer(nil)
 	for _, api := range apis {
 		if err := handler.RegisterName(api.Namespace, api.Service); err != nil {
 			return err
@@ -390,7 +452,7 @@ func (n *Node) startHTTP(endpoint string, apis []rpc.API, modules []string, cors
 		whitelist[module] = true
 	}
 	// Register all the APIs exposed by the services
-	handler := rpc.NewServer()
+	handler := n.newRPCServer(exposedModules(apis, modules))
 	for _, api := range apis {
 		if whitelist[api.Namespace] || (len(whitelist) == 0 && api.Public) {
 			if err := handler.RegisterName(api.Namespace, api.Service); err != nil {
@@ -444,7 +506,7 @@ func (n *Node) startWS(endpoint string, apis []rpc.API, modules []string, wsOrig
 		whitelist[module] = true
 	}
 	// Register all the APIs exposed by the services
-	handler := rpc.NewServer()
+	handler := n.newRPCServer(exposedModules(apis, modules))
 	for _, api := range apis {
 		if whitelist[api.Namespace] || (len(whitelist) == 0 && api.Public) {
 			if err := handler.RegisterName(api.Namespace, api.Service); err != nil {
@@ -501,6 +563,7 @@ func (n *Node) Stop() error {
 	n.stopWS()
 	n.stopHTTP()
 	n.stopIPC()
+	n.stopUpstream()
 	n.rpcAPIs = nil
 	failure := &StopError{
 		Services: make(map[reflect.Type]error),
@@ -602,6 +665,144 @@ func (n *Node) Service(service interface{}) error {
 	return ErrServiceUnknown
 }
 
+// SetConfigReloader sets the function reloading the runtime adjustable parts of
+// the node configuration, called by ReloadConfig.
+func (n *Node) SetConfigReloader(reload func() error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.reloader = reload
+}
+
+// ReloadConfig reloads the runtime adjustable parts of the node configuration,
+// e.g. upon SIGHUP or admin_reloadConfig. Concurrent reloads are serialized.
+func (n *Node) ReloadConfig() error {
+	n.lock.RLock()
+	reload := n.reloader
+	n.lock.RUnlock()
+
+	if reload == nil {
+		return ErrNoReloader
+	}
+	n.reloadLock.Lock()
+	defer n.reloadLock.Unlock()
+
+	return reload()
+}
+
+// SetPersistentNodes replaces the enode URLs of the static and trusted nodes
+// configured in addition to the lists of the data directory, and reloads the
+// peers.
+func (n *Node) SetPersistentNodes(static, trusted []string) error {
+	for _, urls := range [][]string{static, trusted} {
+		for _, url := range urls {
+			if _, err := discover.ParseNode(url); err != nil {
+				return fmt.Errorf("node URL %s: %v", url, err)
+			}
+		}
+	}
+	n.lock.Lock()
+	n.config.StaticNodeURLs, n.config.TrustedNodeURLs = static, trusted
+	n.lock.Unlock()
+
+	return n.ReloadPeers()
+}
+
+// ReloadPeers re-reads the static and trusted node lists, connecting to the
+// static nodes added since the node started or was last reloaded, dropping the
+// removed ones, and updating the set of trusted nodes.
+func (n *Node) ReloadPeers() error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if n.server == nil {
+		return ErrNodeStopped
+	}
+	static, trusted := n.config.StaticNodes(), n.config.TrusterNodes()
+
+	added, removed := diffNodes(n.serverConfig.StaticNodes, static)
+	for _, node := range removed {
+		n.server.RemovePeer(node)
+	}
+	for _, node := range added {
+		n.server.AddPeer(node)
+	}
+	glog.V(logger.Info).Infof("Reloaded %d static nodes: %d added, %d removed", len(static), len(added), len(removed))
+
+	added, removed = diffNodes(n.serverConfig.TrustedNodes, trusted)
+	for _, node := range removed {
+		n.server.RemoveTrustedPeer(node)
+	}
+	for _, node := range added {
+		n.server.AddTrustedPeer(node)
+	}
+	glog.V(logger.Info).Infof("Reloaded %d trusted nodes: %d added, %d removed", len(trusted), len(added), len(removed))
+
+	n.serverConfig.StaticNodes, n.serverConfig.TrustedNodes = static, trusted
+	return nil
+}
+
+// diffNodes returns the nodes of next missing from prev, and those of prev
+// missing from next.
+func diffNodes(prev, next []*discover.Node) (added, removed []*discover.Node) {
+	known := make(map[string]bool, len(prev))
+	for _, node := range prev {
+		known[node.String()] = true
+	}
+	for _, node := range next {
+		if !known[node.String()] {
+			added = append(added, node)
+		}
+		delete(known, node.String())
+	}
+	for _, node := range prev {
+		if known[node.String()] {
+			removed = append(removed, node)
+		}
+	}
+	return added, removed
+}
+
+// SetRPCLimits replaces the per namespace execution deadlines and batch limits
+// of the RPC endpoints, applying them to running endpoints right away.
+func (n *Node) SetRPCLimits(timeouts map[string]time.Duration, batchRequestLimit, batchResponseMaxSize int) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	for _, handler := range []*rpc.Server{n.inprocHandler, n.ipcHandler, n.httpHandler, n.wsHandler} {
+		if handler == nil {
+			continue
+		}
+		for namespace := range n.config.RPCTimeouts {
+			handler.SetTimeout(namespace, 0)
+		}
+		for namespace, timeout := range timeouts {
+			handler.SetTimeout(namespace, timeout)
+		}
+		handler.SetBatchLimits(batchRequestLimit, batchResponseMaxSize)
+	}
+	n.config.RPCTimeouts = timeouts
+	n.config.RPCBatchRequestLimit, n.config.RPCBatchResponseMaxSize = batchRequestLimit, batchResponseMaxSize
+}
+
+// serviceInfos gathers the status reported by the running info services.
+func (n *Node) serviceInfos() map[string]interface{} {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	var infos map[string]interface{}
+	for _, service := range n.services {
+		if reporter, ok := service.(InfoService); ok {
+			if infos == nil {
+				infos = make(map[string]interface{})
+			}
+			name, info := reporter.NodeInfo()
+			infos[name] = info
+		}
+	}
+	return infos
+}
+
 // DataDir retrieves the current datadir used by the protocol stack.
 // Deprecated: No files should be stored in this directory, use InstanceDir instead.
 func (n *Node) DataDir() string {
@@ -646,6 +847,9 @@ func (n *Node) OpenDatabase(name string, cache, handles int) (ethdb.Database, er
 	if n.config.DataDir == "" {
 		return ethdb.NewMemDatabase()
 	}
+	if len(n.config.DatabaseKey) > 0 {
+		return ethdb.NewEncryptedLDBDatabase(n.config.resolvePath(name), cache, handles, n.config.DatabaseKey)
+	}
 	return ethdb.NewLDBDatabase(n.config.resolvePath(name), cache, handles)
 }
 
@@ -43,9 +43,19 @@ func (ctx *ServiceContext) OpenDatabase(name string, cache int, handles int) (et
 	if ctx.config.DataDir == "" {
 		return ethdb.NewMemDatabase()
 	}
+	if len(ctx.config.DatabaseKey) > 0 {
+		return ethdb.NewEncryptedLDBDatabase(ctx.config.resolvePath(name), cache, handles, ctx.config.DatabaseKey)
+	}
 	return ethdb.NewLDBDatabase(ctx.config.resolvePath(name), cache, handles)
 }
 
+// ResolvePath resolves a user path into the data directory if that was relative
+// and if the user actually uses persistent storage. It will return an empty string
+// for emphemeral storage and the user's own input for absolute paths.
+func (ctx *ServiceContext) ResolvePath(path string) string {
+	return ctx.config.resolvePath(path)
+}
+
 // Service retrieves a currently running service registered of a specific type.
 func (ctx *ServiceContext) Service(service interface{}) error {
 	element := reflect.ValueOf(service).Elem()
@@ -85,3 +95,12 @@ type Service interface {
 	// are all terminated.
 	Stop() error
 }
+
+// InfoService is a Service reporting its status through the admin_nodeInfo RPC
+// call, e.g. the outcome of periodic background checks.
+type InfoService interface {
+	Service
+
+	// NodeInfo returns the name to report the status under, and the status.
+	NodeInfo() (string, interface{})
+}
@@ -64,6 +64,16 @@ func checkClockDrift() {
 	}
 }
 
+// ClockDrift measures the drift of the system clock against an NTP server, also
+// reporting whether it's large enough to prevent network connectivity.
+func ClockDrift() (time.Duration, bool, error) {
+	drift, err := sntpDrift(ntpChecks)
+	if err != nil {
+		return 0, false, err
+	}
+	return drift, drift < -driftThreshold || drift > driftThreshold, nil
+}
+
 // sntpDrift does a naive time resolution against an NTP server and returns the
 // measured drift. This method uses the simple version of NTP. It's not precise
 // but should be fine for these purposes.
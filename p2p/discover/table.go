@@ -68,6 +68,9 @@ type Table struct {
 
 	nodeAddedHook func(*Node) // for testing
 
+	added   uint64 // Number of nodes added to the table, protected by mutex
+	removed uint64 // Number of nodes deleted or replaced, protected by mutex
+
 	net  transport
 	self *Node // metadata of the local node
 }
@@ -416,6 +419,21 @@ func (tab *Table) closest(target common.Hash, nresults int) *nodesByDistance {
 	return close
 }
 
+// TableStats is a summary of the contents and churn of the node table.
+type TableStats struct {
+	Size    int    `json:"size"`    // Number of nodes in the table
+	Added   uint64 `json:"added"`   // Number of nodes added since the table was created
+	Removed uint64 `json:"removed"` // Number of nodes deleted or replaced since the table was created
+}
+
+// Stats returns the current size of the table along with its churn so far.
+func (tab *Table) Stats() TableStats {
+	tab.mutex.Lock()
+	defer tab.mutex.Unlock()
+
+	return TableStats{Size: tab.len(), Added: tab.added, Removed: tab.removed}
+}
+
 func (tab *Table) len() (n int) {
 	for _, b := range tab.buckets {
 		n += len(b.entries)
@@ -579,9 +597,16 @@ func (tab *Table) add(new *Node) {
 			return
 		}
 	}
+	full := len(b.entries) == bucketSize
 	added := b.replace(new, oldest)
-	if added && tab.nodeAddedHook != nil {
-		tab.nodeAddedHook(new)
+	if added {
+		tab.added++
+		if full {
+			tab.removed++
+		}
+		if tab.nodeAddedHook != nil {
+			tab.nodeAddedHook(new)
+		}
 	}
 }
 
@@ -601,6 +626,7 @@ outer:
 		}
 		if len(bucket.entries) < bucketSize {
 			bucket.entries = append(bucket.entries, n)
+			tab.added++
 			if tab.nodeAddedHook != nil {
 				tab.nodeAddedHook(n)
 			}
@@ -617,6 +643,7 @@ func (tab *Table) delete(node *Node) {
 	for i := range bucket.entries {
 		if bucket.entries[i].ID == node.ID {
 			bucket.entries = append(bucket.entries[:i], bucket.entries[i+1:]...)
+			tab.removed++
 			return
 		}
 	}
@@ -88,6 +88,36 @@ func TestTable_pingReplace(t *testing.T) {
 	doit(false, false)
 }
 
+// Tests that the table churn is accounted for in its stats.
+func TestTable_stats(t *testing.T) {
+	transport := newPingRecorder()
+	tab, _ := newTable(transport, NodeID{}, &net.UDPAddr{}, "")
+	defer tab.Close()
+
+	// Nodes added to a bucket with space and deleted again
+	n := nodeAtDistance(tab.self.sha, 200)
+	n.ID[0] = 1
+	tab.add(n)
+	if stats := tab.Stats(); stats != (TableStats{Size: 1, Added: 1}) {
+		t.Errorf("stats mismatch after add: %+v", stats)
+	}
+	tab.delete(n)
+	if stats := tab.Stats(); stats != (TableStats{Size: 0, Added: 1, Removed: 1}) {
+		t.Errorf("stats mismatch after delete: %+v", stats)
+	}
+	// Nodes replacing an unresponsive one in a full bucket
+	fillBucket(tab, 253)
+	for i, entry := range tab.buckets[253].entries {
+		entry.ID[0], entry.ID[1] = 2, byte(i)
+	}
+	n = nodeAtDistance(tab.self.sha, 253)
+	n.ID[0] = 3
+	tab.add(n)
+	if stats := tab.Stats(); stats != (TableStats{Size: bucketSize, Added: 2, Removed: 2}) {
+		t.Errorf("stats mismatch after replace: %+v", stats)
+	}
+}
+
 func TestBucket_bumpNoDuplicates(t *testing.T) {
 	t.Parallel()
 	cfg := &quick.Config{
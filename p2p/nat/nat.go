@@ -25,9 +25,10 @@ import (
 	"sync"
 	"time"
 
+	"github.com/jackpal/go-nat-pmp"
 	"github.com/ur-technology/go-ur/logger"
 	"github.com/ur-technology/go-ur/logger/glog"
-	"github.com/jackpal/go-nat-pmp"
+	"github.com/ur-technology/go-ur/p2p/netutil"
 )
 
 // An implementation of nat.Interface can map local ports to ports
@@ -54,12 +55,13 @@ type Interface interface {
 // The following formats are currently accepted.
 // Note that mechanism names are not case-sensitive.
 //
-//     "" or "none"         return nil
-//     "extip:77.12.33.4"   will assume the local machine is reachable on the given IP
-//     "any"                uses the first auto-detected mechanism
-//     "upnp"               uses the Universal Plug and Play protocol
-//     "pmp"                uses NAT-PMP with an auto-detected gateway address
-//     "pmp:192.168.0.1"    uses NAT-PMP with the given gateway address
+//	"" or "none"         return nil
+//	"extip:77.12.33.4"   will assume the local machine is reachable on the given IP
+//	"any"                uses the first auto-detected mechanism
+//	"auto"               uses the local address if it is public, "any" otherwise
+//	"upnp"               uses the Universal Plug and Play protocol
+//	"pmp"                uses NAT-PMP with an auto-detected gateway address
+//	"pmp:192.168.0.1"    uses NAT-PMP with the given gateway address
 func Parse(spec string) (Interface, error) {
 	var (
 		parts = strings.SplitN(spec, ":", 2)
@@ -75,8 +77,10 @@ func Parse(spec string) (Interface, error) {
 	switch mech {
 	case "", "none", "off":
 		return nil, nil
-	case "any", "auto", "on":
+	case "any", "on":
 		return Any(), nil
+	case "auto":
+		return Auto(), nil
 	case "extip", "ip":
 		if ip == nil {
 			return nil, errors.New("missing IP address")
@@ -163,6 +167,44 @@ func Any() Interface {
 	})
 }
 
+// Auto returns a port mapper suiting the local network setup: if the local
+// machine has an Internet-class address it is assumed reachable on it, otherwise
+// any supported mechanism is discovered on the local network.
+func Auto() Interface {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return Any()
+	}
+	if ip := publicIP(addrs); ip != nil {
+		return ExtIP(ip)
+	}
+	return Any()
+}
+
+// cgnat is the shared address space of carrier-grade NATs (RFC 6598), which is
+// not reachable from the Internet either.
+var cgnat = net.IPNet{IP: net.IP{100, 64, 0, 0}, Mask: net.CIDRMask(10, 32)}
+
+// publicIP returns the first Internet-class IPv4 address among the given
+// interface addresses, or nil if the machine is on a private network.
+func publicIP(addrs []net.Addr) net.IP {
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		ip := ipnet.IP.To4()
+		if ip == nil || !ip.IsGlobalUnicast() {
+			continue
+		}
+		if netutil.IsLAN(ip) || netutil.IsSpecialNetwork(ip) || cgnat.Contains(ip) {
+			continue
+		}
+		return ip
+	}
+	return nil
+}
+
 // UPnP returns a port mapper that uses UPnP. It will attempt to
 // discover the address of your router using UDP broadcasts.
 func UPnP() Interface {
@@ -234,8 +276,10 @@ func (n *autodisc) String() string {
 // wait blocks until auto-discovery has been performed.
 func (n *autodisc) wait() error {
 	n.once.Do(func() {
+		// Don't hold the lock while discovering, String must not block
+		found := n.doit()
 		n.mu.Lock()
-		n.found = n.doit()
+		n.found = found
 		n.mu.Unlock()
 	})
 	if n.found == nil {
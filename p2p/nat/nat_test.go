@@ -62,3 +62,24 @@ func TestAutoDiscRace(t *testing.T) {
 		}
 	}
 }
+
+// Tests that only Internet-class addresses are detected as public.
+func TestPublicIP(t *testing.T) {
+	addr := func(ip string) net.Addr {
+		return &net.IPNet{IP: net.ParseIP(ip), Mask: net.CIDRMask(24, 32)}
+	}
+	tests := []struct {
+		addrs []net.Addr
+		want  net.IP
+	}{
+		{nil, nil},
+		{[]net.Addr{addr("127.0.0.1"), addr("192.168.1.10"), addr("10.0.0.2")}, nil},
+		{[]net.Addr{addr("172.16.5.4"), addr("100.64.0.1"), addr("fe80::1")}, nil},
+		{[]net.Addr{addr("192.168.1.10"), addr("77.12.33.4")}, net.IP{77, 12, 33, 4}},
+	}
+	for i, tt := range tests {
+		if ip := publicIP(tt.addrs); !ip.Equal(tt.want) {
+			t.Errorf("test %d: public IP mismatch: have %v, want %v", i, ip, tt.want)
+		}
+	}
+}
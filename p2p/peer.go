@@ -67,6 +67,8 @@ type protoHandshake struct {
 // Peer represents a connected remote node.
 type Peer struct {
 	rw      *conn
+	out     MsgWriter    // Metered writer of the connection
+	traffic *peerTraffic // Traffic exchanged with the peer
 	running map[string]*protoRW
 
 	wg       sync.WaitGroup
@@ -125,17 +127,30 @@ func (p *Peer) String() string {
 }
 
 func newPeer(conn *conn, protocols []Protocol) *Peer {
-	protomap := matchProtocols(protocols, conn.caps, conn)
 	p := &Peer{
-		rw:       conn,
-		running:  protomap,
-		disc:     make(chan DiscReason),
-		protoErr: make(chan error, len(protomap)+1), // protocols + pingLoop
-		closed:   make(chan struct{}),
+		rw:     conn,
+		disc:   make(chan DiscReason),
+		closed: make(chan struct{}),
 	}
+	p.traffic = newPeerTraffic(fmt.Sprintf("%x", conn.id[:8]), p.msgName)
+	p.out = &meteredMsgWriter{MsgWriter: conn, traffic: p.traffic}
+	p.running = matchProtocols(protocols, conn.caps, p.out)
+	p.protoErr = make(chan error, len(p.running)+1) // protocols + pingLoop
 	return p
 }
 
+// msgName returns the name of a message code in the traffic stats, made of the
+// protocol name and the code within the protocol.
+func (p *Peer) msgName(code uint64) string {
+	if code < baseProtocolLength {
+		return fmt.Sprintf("p2p/%d", code)
+	}
+	if proto, err := p.getProto(code); err == nil {
+		return fmt.Sprintf("%s/%d", proto.Name, code-proto.offset)
+	}
+	return fmt.Sprintf("unknown/%d", code)
+}
+
 func (p *Peer) run() DiscReason {
 	var (
 		writeStart = make(chan struct{}, 1)
@@ -188,6 +203,7 @@ loop:
 	close(p.closed)
 	p.rw.close(reason)
 	p.wg.Wait()
+	p.traffic.close()
 	if requested {
 		reason = DiscRequested
 	}
@@ -201,7 +217,7 @@ func (p *Peer) pingLoop() {
 	for {
 		select {
 		case <-ping.C:
-			if err := SendItems(p.rw, pingMsg); err != nil {
+			if err := SendItems(p.out, pingMsg); err != nil {
 				p.protoErr <- err
 				return
 			}
@@ -220,6 +236,7 @@ func (p *Peer) readLoop(errc chan<- error) {
 			return
 		}
 		msg.ReceivedAt = time.Now()
+		p.traffic.mark(true, msg.Code, msg.Size)
 		if err = p.handle(msg); err != nil {
 			errc <- err
 			return
@@ -231,7 +248,7 @@ func (p *Peer) handle(msg Msg) error {
 	switch {
 	case msg.Code == pingMsg:
 		msg.Discard()
-		go SendItems(p.rw, pongMsg)
+		go SendItems(p.out, pongMsg)
 	case msg.Code == discMsg:
 		var reason [1]DiscReason
 		// This is the last message. We don't need to discard or
@@ -270,7 +287,7 @@ func countMatchingProtocols(protocols []Protocol, caps []Cap) int {
 }
 
 // matchProtocols creates structures for matching named subprotocols.
-func matchProtocols(protocols []Protocol, caps []Cap, rw MsgReadWriter) map[string]*protoRW {
+func matchProtocols(protocols []Protocol, caps []Cap, rw MsgWriter) map[string]*protoRW {
 	sort.Sort(capsByNameAndVersion(caps))
 	offset := baseProtocolLength
 	result := make(map[string]*protoRW)
@@ -377,6 +394,7 @@ type PeerInfo struct {
 		LocalAddress  string `json:"localAddress"`  // Local endpoint of the TCP data connection
 		RemoteAddress string `json:"remoteAddress"` // Remote endpoint of the TCP data connection
 	} `json:"network"`
+	Traffic   *PeerTraffic           `json:"traffic"`   // Traffic exchanged since the peer connected
 	Protocols map[string]interface{} `json:"protocols"` // Sub-protocol specific metadata fields
 }
 
@@ -392,6 +410,7 @@ func (p *Peer) Info() *PeerInfo {
 		ID:        p.ID().String(),
 		Name:      p.Name(),
 		Caps:      caps,
+		Traffic:   p.traffic.info(),
 		Protocols: make(map[string]interface{}),
 	}
 	info.Network.LocalAddress = p.LocalAddr().String()
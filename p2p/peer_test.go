@@ -118,6 +118,44 @@ func TestPeerProtoEncodeMsg(t *testing.T) {
 	}
 }
 
+// Tests that the messages exchanged with a peer are metered per message code.
+func TestPeerTraffic(t *testing.T) {
+	done := make(chan struct{})
+	proto := Protocol{
+		Name:   "a",
+		Length: 5,
+		Run: func(peer *Peer, rw MsgReadWriter) error {
+			if err := ExpectMsg(rw, 2, []uint{1}); err != nil {
+				t.Error(err)
+			}
+			if err := SendItems(rw, 3, "foo"); err != nil {
+				t.Error(err)
+			}
+			close(done)
+			return nil
+		},
+	}
+	closer, rw, peer, _ := testPeer([]Protocol{proto})
+	defer closer()
+
+	Send(rw, baseProtocolLength+2, []uint{1})
+	if err := ExpectMsg(rw, baseProtocolLength+3, []string{"foo"}); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+
+	traffic := peer.Info().Traffic
+	if have, want := traffic.IngressCodes["a/2"], (MsgTraffic{Messages: 1, Bytes: 2}); have != want {
+		t.Errorf("ingress mismatch: have %+v, want %+v", have, want)
+	}
+	if have, want := traffic.EgressCodes["a/3"], (MsgTraffic{Messages: 1, Bytes: 5}); have != want {
+		t.Errorf("egress mismatch: have %+v, want %+v", have, want)
+	}
+	if traffic.Ingress.Messages < 1 || traffic.Egress.Messages < 1 {
+		t.Errorf("totals missing: %+v", traffic)
+	}
+}
+
 func TestPeerPing(t *testing.T) {
 	closer, rw, _, _ := testPeer(nil)
 	defer closer()
@@ -0,0 +1,153 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ur-technology/go-ur/metrics"
+)
+
+// MsgTraffic is the traffic of some kind of messages exchanged with a peer.
+type MsgTraffic struct {
+	Messages uint64 `json:"messages"` // Number of messages
+	Bytes    uint64 `json:"bytes"`    // Total size of the message payloads
+}
+
+// PeerTraffic is the traffic exchanged with a peer since it connected, in total
+// and per protocol message code. Message codes are named after their protocol,
+// e.g. "ur/7" for the block propagations, the base protocol being "p2p".
+type PeerTraffic struct {
+	Ingress      MsgTraffic            `json:"ingress"`      // Traffic received from the peer
+	Egress       MsgTraffic            `json:"egress"`       // Traffic sent to the peer
+	IngressCodes map[string]MsgTraffic `json:"ingressCodes"` // Traffic received per message code
+	EgressCodes  map[string]MsgTraffic `json:"egressCodes"`  // Traffic sent per message code
+}
+
+// peerTraffic meters the messages exchanged with a peer. If the metrics system
+// is enabled, the traffic is also reported to the registry as the gauges
+//
+//	p2p/peers/<id>/{in,out}/<protocol>/<code>/{packets,traffic}
+//
+// which are unregistered when the peer disconnects. Gauges are used instead of
+// meters as the latter can't be released.
+type peerTraffic struct {
+	id      string                   // Short identifier of the peer in the gauge names
+	name    func(code uint64) string // Resolves a message code into its protocol name and code
+	ingress map[uint64]*MsgTraffic   // Traffic received per message code
+	egress  map[uint64]*MsgTraffic   // Traffic sent per message code
+	gauges  []string                 // Names of the gauges registered for the peer
+	closed  bool                     // Whether the peer disconnected, registering no more gauges
+	lock    sync.Mutex
+}
+
+func newPeerTraffic(id string, name func(code uint64) string) *peerTraffic {
+	return &peerTraffic{
+		id:      id,
+		name:    name,
+		ingress: make(map[uint64]*MsgTraffic),
+		egress:  make(map[uint64]*MsgTraffic),
+	}
+}
+
+// mark accounts for a message received from or sent to the peer.
+func (t *peerTraffic) mark(ingress bool, code uint64, size uint32) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	codes, dir := t.egress, "out"
+	if ingress {
+		codes, dir = t.ingress, "in"
+	}
+	traffic := codes[code]
+	if traffic == nil {
+		traffic = new(MsgTraffic)
+		codes[code] = traffic
+		if metrics.Enabled && !t.closed {
+			t.register(fmt.Sprintf("p2p/peers/%s/%s/%s", t.id, dir, t.name(code)), traffic)
+		}
+	}
+	traffic.Messages++
+	traffic.Bytes += uint64(size)
+}
+
+// register reports the traffic of a message code to the metrics registry. The
+// lock must be held.
+func (t *peerTraffic) register(prefix string, traffic *MsgTraffic) {
+	metrics.NewFunctionalGauge(prefix+"/packets", func() int64 {
+		t.lock.Lock()
+		defer t.lock.Unlock()
+		return int64(traffic.Messages)
+	})
+	metrics.NewFunctionalGauge(prefix+"/traffic", func() int64 {
+		t.lock.Lock()
+		defer t.lock.Unlock()
+		return int64(traffic.Bytes)
+	})
+	t.gauges = append(t.gauges, prefix+"/packets", prefix+"/traffic")
+}
+
+// close unregisters the registry gauges of the peer.
+func (t *peerTraffic) close() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, name := range t.gauges {
+		metrics.Unregister(name)
+	}
+	t.gauges, t.closed = nil, true
+}
+
+// info returns the traffic exchanged with the peer so far.
+func (t *peerTraffic) info() *PeerTraffic {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	info := &PeerTraffic{
+		IngressCodes: make(map[string]MsgTraffic),
+		EgressCodes:  make(map[string]MsgTraffic),
+	}
+	for code, traffic := range t.ingress {
+		info.IngressCodes[t.name(code)] = *traffic
+		info.Ingress.Messages += traffic.Messages
+		info.Ingress.Bytes += traffic.Bytes
+	}
+	for code, traffic := range t.egress {
+		info.EgressCodes[t.name(code)] = *traffic
+		info.Egress.Messages += traffic.Messages
+		info.Egress.Bytes += traffic.Bytes
+	}
+	return info
+}
+
+// meteredMsgWriter is a wrapper around the message writer of a peer connection,
+// accounting for the messages sent in the traffic of the peer.
+type meteredMsgWriter struct {
+	MsgWriter
+	traffic *peerTraffic
+}
+
+// WriteMsg delegates the message write to the connection, metering it if sent.
+func (w *meteredMsgWriter) WriteMsg(msg Msg) error {
+	code, size := msg.Code, msg.Size
+	if err := w.MsgWriter.WriteMsg(msg); err != nil {
+		return err
+	}
+	w.traffic.mark(false, code, size)
+	return nil
+}
@@ -22,6 +22,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"strconv"
 	"sync"
 	"time"
 
@@ -147,8 +148,9 @@ type Server struct {
 	newTransport func(net.Conn) transport
 	newPeerHook  func(*Peer)
 
-	lock    sync.Mutex // protects running
+	lock    sync.Mutex // protects running and natIP
 	running bool
+	natIP   net.IP // External IP resolved through the NAT port mapper
 
 	ntab         discoverTable
 	listener     net.Listener
@@ -163,6 +165,8 @@ type Server struct {
 	quit          chan struct{}
 	addstatic     chan *discover.Node
 	removestatic  chan *discover.Node
+	addtrusted    chan *discover.Node
+	removetrusted chan *discover.Node
 	posthandshake chan *conn
 	addpeer       chan *conn
 	delpeer       chan *Peer
@@ -286,6 +290,23 @@ func (srv *Server) RemovePeer(node *discover.Node) {
 	}
 }
 
+// AddTrustedPeer adds the given node to the reserved whitelist which allows it
+// to always connect, even if the peer slots are full.
+func (srv *Server) AddTrustedPeer(node *discover.Node) {
+	select {
+	case srv.addtrusted <- node:
+	case <-srv.quit:
+	}
+}
+
+// RemoveTrustedPeer removes the given node from the trusted peer set.
+func (srv *Server) RemoveTrustedPeer(node *discover.Node) {
+	select {
+	case srv.removetrusted <- node:
+	case <-srv.quit:
+	}
+}
+
 // Self returns the local node's endpoint information.
 func (srv *Server) Self() *discover.Node {
 	srv.lock.Lock()
@@ -301,11 +322,15 @@ func (srv *Server) Self() *discover.Node {
 		if srv.listener == nil {
 			return &discover.Node{IP: net.ParseIP("0.0.0.0"), ID: discover.PubkeyID(&srv.PrivateKey.PublicKey)}
 		}
-		// Otherwise inject the listener address too
+		// Otherwise inject the listener address too, external if known
 		addr := srv.listener.Addr().(*net.TCPAddr)
+		ip := addr.IP
+		if srv.natIP != nil {
+			ip = srv.natIP
+		}
 		return &discover.Node{
 			ID:  discover.PubkeyID(&srv.PrivateKey.PublicKey),
-			IP:  addr.IP,
+			IP:  ip,
 			TCP: uint16(addr.Port),
 		}
 	}
@@ -357,6 +382,8 @@ func (srv *Server) Start() (err error) {
 	srv.posthandshake = make(chan *conn)
 	srv.addstatic = make(chan *discover.Node)
 	srv.removestatic = make(chan *discover.Node)
+	srv.addtrusted = make(chan *discover.Node)
+	srv.removetrusted = make(chan *discover.Node)
 	srv.peerOp = make(chan peerOpFunc)
 	srv.peerOpDone = make(chan struct{})
 
@@ -429,9 +456,29 @@ func (srv *Server) startListening() error {
 			srv.loopWG.Done()
 		}()
 	}
+	if srv.NAT != nil {
+		go srv.resolveNAT(srv.NAT)
+	}
 	return nil
 }
 
+// resolveNAT retrieves the external IP address from the NAT port mapper, which
+// may take a while if the mechanism is being auto-discovered.
+func (srv *Server) resolveNAT(natm nat.Interface) {
+	ip, err := natm.ExternalIP()
+	if err != nil {
+		glog.V(logger.Warn).Infof("Failed to resolve external IP using %v: %v", natm, err)
+		return
+	}
+	glog.V(logger.Info).Infof("External IP resolved using %v: %v", natm, ip)
+
+	srv.lock.Lock()
+	srv.natIP = ip
+	srv.lock.Unlock()
+
+	glog.V(logger.Info).Infof("Node enode URL: %v", srv.Self())
+}
+
 type dialer interface {
 	newTasks(running int, peers map[discover.NodeID]*Peer, now time.Time) []task
 	taskDone(task, time.Time)
@@ -449,8 +496,8 @@ func (srv *Server) run(dialstate dialer) {
 		queuedTasks  []task // tasks that can't run yet
 	)
 	// Put trusted nodes into a map to speed up checks.
-	// Trusted peers are loaded on startup and cannot be
-	// modified while the server is running.
+	// Trusted peers are loaded on startup and can be
+	// modified at runtime via AddTrustedPeer/RemoveTrustedPeer.
 	for _, n := range srv.TrustedNodes {
 		trusted[n.ID] = true
 	}
@@ -509,6 +556,22 @@ running:
 			if p, ok := peers[n.ID]; ok {
 				p.Disconnect(DiscRequested)
 			}
+		case n := <-srv.addtrusted:
+			// This channel is used by AddTrustedPeer to add a node
+			// to the trusted node set.
+			glog.V(logger.Detail).Infoln("<-addtrusted:", n)
+			trusted[n.ID] = true
+			if p, ok := peers[n.ID]; ok {
+				p.rw.flags |= trustedConn
+			}
+		case n := <-srv.removetrusted:
+			// This channel is used by RemoveTrustedPeer to remove a
+			// node from the trusted node set.
+			glog.V(logger.Detail).Infoln("<-removetrusted:", n)
+			delete(trusted, n.ID)
+			if p, ok := peers[n.ID]; ok {
+				p.rw.flags &^= trustedConn
+			}
 		case op := <-srv.peerOp:
 			// This channel is used by Peers and PeerCount.
 			op(peers)
@@ -778,9 +841,17 @@ type NodeInfo struct {
 		Listener  int `json:"listener"`  // TCP listening port for RLPx
 	} `json:"ports"`
 	ListenAddr string                 `json:"listenAddr"`
+	NAT        *NATInfo               `json:"nat,omitempty"` // Port mapping state, if NAT traversal is enabled
 	Protocols  map[string]interface{} `json:"protocols"`
 }
 
+// NATInfo represents the state of the NAT traversal of the host.
+type NATInfo struct {
+	Mechanism  string `json:"mechanism"`            // Port mapping mechanism in use (or being discovered)
+	ExternalIP string `json:"externalIP,omitempty"` // External IP address, once resolved
+	Endpoint   string `json:"endpoint,omitempty"`   // External endpoint remote peers may connect to
+}
+
 // NodeInfo gathers and returns a collection of metadata known about the host.
 func (srv *Server) NodeInfo() *NodeInfo {
 	node := srv.Self()
@@ -797,6 +868,22 @@ func (srv *Server) NodeInfo() *NodeInfo {
 	info.Ports.Discovery = int(node.UDP)
 	info.Ports.Listener = int(node.TCP)
 
+	// Report the external endpoint discovered through the NAT port mapper
+	if srv.NAT != nil {
+		info.NAT = &NATInfo{Mechanism: srv.NAT.String()}
+
+		srv.lock.Lock()
+		ip := srv.natIP
+		srv.lock.Unlock()
+
+		if ip != nil {
+			info.NAT.ExternalIP = ip.String()
+			if node.TCP != 0 {
+				info.NAT.Endpoint = net.JoinHostPort(ip.String(), strconv.Itoa(int(node.TCP)))
+			}
+		}
+	}
+
 	// Gather all the running protocol infos (only once per protocol type)
 	for _, proto := range srv.Protocols {
 		if _, ok := info.Protocols[proto.Name]; !ok {
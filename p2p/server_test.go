@@ -19,6 +19,7 @@ package p2p
 import (
 	"crypto/ecdsa"
 	"errors"
+	"fmt"
 	"math/rand"
 	"net"
 	"reflect"
@@ -28,6 +29,7 @@ import (
 	"github.com/ur-technology/go-ur/crypto"
 	"github.com/ur-technology/go-ur/crypto/sha3"
 	"github.com/ur-technology/go-ur/p2p/discover"
+	"github.com/ur-technology/go-ur/p2p/nat"
 )
 
 func init() {
@@ -122,6 +124,46 @@ func TestServerListen(t *testing.T) {
 	}
 }
 
+// Tests that the external endpoint resolved through the NAT port mapper is
+// reported in the node infos.
+func TestServerNodeInfoNAT(t *testing.T) {
+	srv := &Server{
+		Config: Config{
+			Name:       "test",
+			MaxPeers:   10,
+			ListenAddr: "127.0.0.1:0",
+			PrivateKey: newkey(),
+			NAT:        nat.ExtIP(net.IP{77, 12, 33, 4}),
+		},
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("could not start server: %v", err)
+	}
+	defer srv.Stop()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		info := srv.NodeInfo()
+		if info.NAT == nil {
+			t.Fatalf("missing NAT infos")
+		}
+		if info.NAT.ExternalIP != "" {
+			port := srv.listener.Addr().(*net.TCPAddr).Port
+			if want := fmt.Sprintf("77.12.33.4:%d", port); info.NAT.Endpoint != want {
+				t.Errorf("endpoint mismatch: have %s, want %s", info.NAT.Endpoint, want)
+			}
+			if info.IP != "77.12.33.4" {
+				t.Errorf("IP mismatch: have %s, want 77.12.33.4", info.IP)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("external IP not resolved")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 func TestServerDial(t *testing.T) {
 	// run a one-shot TCP server to handle the connection.
 	listener, err := net.Listen("tcp", "127.0.0.1:0")
@@ -358,6 +400,22 @@ func TestServerAtCap(t *testing.T) {
 		t.Error("Server did not set trusted flag")
 	}
 
+	// Remove the trusted node and check that it's rejected.
+	srv.RemoveTrustedPeer(&discover.Node{ID: trustedID})
+	c = newconn(trustedID)
+	if err := srv.checkpoint(c, srv.posthandshake); err != DiscTooManyPeers {
+		t.Error("wrong error for insert of removed trusted node:", err)
+	}
+	// Add a new trusted node at runtime and check that it's accepted.
+	id := randomID()
+	srv.AddTrustedPeer(&discover.Node{ID: id})
+	c = newconn(id)
+	if err := srv.checkpoint(c, srv.posthandshake); err != nil {
+		t.Error("unexpected error for runtime trusted conn @posthandshake:", err)
+	}
+	if !c.is(trustedConn) {
+		t.Error("Server did not set trusted flag for runtime trusted node")
+	}
 }
 
 func TestServerSetupConn(t *testing.T) {
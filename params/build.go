@@ -0,0 +1,62 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package params
+
+import (
+	"runtime"
+	"strings"
+)
+
+// Release packaging metadata, set via linker flags by the official build
+// scripts. Self-compiled binaries leave them empty.
+var (
+	BuildChannel    = "" // Packaging channel of the release, e.g. "archive", "ppa", "docker"
+	BuildSignerKeys = "" // Comma separated fingerprints of the keys verifying the release signatures
+)
+
+// BuildInfo describes how the running binary was built and packaged, so that
+// official releases can be told apart from self-compiled forks.
+type BuildInfo struct {
+	Version    string   `json:"version"`              // Version of the release
+	Commit     string   `json:"commit,omitempty"`     // Git commit the binary was built from
+	OS         string   `json:"os"`                   // Target operating system
+	Arch       string   `json:"arch"`                 // Target architecture
+	GoVersion  string   `json:"goVersion"`            // Go compiler the binary was built with
+	Channel    string   `json:"channel,omitempty"`    // Packaging channel of an official release
+	SignerKeys []string `json:"signerKeys,omitempty"` // Fingerprints of the release signature verification keys
+	Official   bool     `json:"official"`             // Whether built by the official release scripts
+}
+
+// Build returns the build and packaging metadata of the running binary, built
+// from the given git commit.
+func Build(commit string) *BuildInfo {
+	info := &BuildInfo{
+		Version:   Version,
+		Commit:    commit,
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		GoVersion: runtime.Version(),
+		Channel:   BuildChannel,
+	}
+	for _, key := range strings.Split(BuildSignerKeys, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			info.SignerKeys = append(info.SignerKeys, key)
+		}
+	}
+	info.Official = info.Commit != "" && info.Channel != "" && len(info.SignerKeys) > 0
+	return info
+}
@@ -0,0 +1,53 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package params
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// Tests that the build metadata reports the linked in packaging metadata, and
+// only flags the builds carrying all of it as official.
+func TestBuild(t *testing.T) {
+	defer func(channel, keys string) { BuildChannel, BuildSignerKeys = channel, keys }(BuildChannel, BuildSignerKeys)
+
+	// Self-compiled binaries have no packaging metadata
+	BuildChannel, BuildSignerKeys = "", ""
+	info := Build("abcdef")
+	if info.Version != Version || info.Commit != "abcdef" || info.OS != runtime.GOOS || info.Arch != runtime.GOARCH {
+		t.Errorf("build metadata mismatch: have %+v", info)
+	}
+	if info.Channel != "" || info.SignerKeys != nil || info.Official {
+		t.Errorf("self-compiled build reported as packaged: %+v", info)
+	}
+	// Official builds have the channel and signer keys linked in
+	BuildChannel, BuildSignerKeys = "archive", " AAAA, BBBB ,,"
+	info = Build("abcdef")
+	if info.Channel != "archive" || !reflect.DeepEqual(info.SignerKeys, []string{"AAAA", "BBBB"}) || !info.Official {
+		t.Errorf("official build metadata mismatch: have %+v", info)
+	}
+	// Builds missing any of the metadata aren't official
+	if info = Build(""); info.Official {
+		t.Errorf("build without commit reported as official")
+	}
+	BuildSignerKeys = ","
+	if info = Build("abcdef"); info.Official {
+		t.Errorf("build without signer keys reported as official")
+	}
+}
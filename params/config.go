@@ -65,11 +65,85 @@ type ChainConfig struct {
 
 	EIP155Block *big.Int `json:"eip155Block"` // EIP155 HF block
 	EIP158Block *big.Int `json:"eip158Block"` // EIP158 HF block
+
+	MinGasPriceBlock *big.Int `json:"minGasPriceBlock"` // Gas price floor switch block (nil = no floor)
+	MinGasPrice      *big.Int `json:"minGasPrice"`      // Minimum gas price of block transactions after the switch
+
+	FeeContractBlock *big.Int `json:"feeContractBlock"` // Contract fee receivers switch block (nil = no fork)
+
+	DifficultyForks []DifficultyFork `json:"difficultyForks,omitempty"` // Difficulty algorithm switches in block order (nil = by Homestead block)
+
+	UnclePolicyBlock *big.Int     `json:"unclePolicyBlock"`      // Uncle policy switch block (nil = Ethereum uncle rules)
+	UnclePolicy      *UnclePolicy `json:"unclePolicy,omitempty"` // Uncle inclusion and rewards of the blocks after the switch
+
+	UR *URConfig `json:"ur,omitempty"` // UR reward parameters of private networks (nil = compiled in defaults)
+}
+
+// Difficulty algorithms selectable by the difficulty forks.
+const (
+	DifficultyFrontier  = "frontier"  // Fixed step adjustment around the block time
+	DifficultyHomestead = "homestead" // Proportional adjustment to the block time (EIP-2)
+)
+
+// DifficultyFork switches the difficulty calculation of the blocks from Block on
+// to a given algorithm, allowing to retune the block times of a live network.
+type DifficultyFork struct {
+	Block     *big.Int `json:"block"`               // Switch block
+	Algorithm string   `json:"algorithm"`           // Difficulty algorithm of the blocks from the switch on
+	BlockTime uint64   `json:"blockTime,omitempty"` // Target block time in seconds (0 = algorithm default)
+	NoBomb    bool     `json:"noBomb,omitempty"`    // Whether the exponential difficulty bomb is removed
+}
+
+// equal returns whether two difficulty forks select the same calculation.
+func (f *DifficultyFork) equal(other *DifficultyFork) bool {
+	return configNumEqual(f.Block, other.Block) && f.Algorithm == other.Algorithm && f.BlockTime == other.BlockTime && f.NoBomb == other.NoBomb
+}
+
+// UnclePolicy governs whether blocks may include uncles and how the uncles and
+// their includers are rewarded. Fields left unset keep the Ethereum rules.
+type UnclePolicy struct {
+	NoUncles     bool     `json:"noUncles,omitempty"`     // Whether blocks may not include uncles at all
+	MaxDepth     uint64   `json:"maxDepth,omitempty"`     // Maximum distance of an uncle from the including block (0 = 6)
+	UncleReward  *big.Int `json:"uncleReward,omitempty"`  // Uncle reward before scaling by (8 - depth) / 8 (nil = block reward)
+	NephewReward *big.Int `json:"nephewReward,omitempty"` // Reward of the includer for every uncle (nil = 1/32 of the block reward)
+}
+
+// equal returns whether two uncle policies set the same rules.
+func (p *UnclePolicy) equal(other *UnclePolicy) bool {
+	if p == nil || other == nil {
+		return p == other
+	}
+	return p.NoUncles == other.NoUncles && p.MaxDepth == other.MaxDepth &&
+		configNumEqual(p.UncleReward, other.UncleReward) &&
+		configNumEqual(p.NephewReward, other.NephewReward)
+}
+
+// URConfig overrides the UR reward parameters compiled into the binary, allowing
+// private networks to run with their own rewards and privileged senders. Fields
+// left unset keep their compiled in values.
+type URConfig struct {
+	BlockReward          *big.Int   `json:"blockReward,omitempty"`          // Reward of mined blocks and of every signup they include
+	SignupReward         *big.Int   `json:"signupReward,omitempty"`         // Reward of a newly signed up member
+	MembersSignupRewards []*big.Int `json:"membersSignupRewards,omitempty"` // Reward tiers of the referring members, one per signup chain level
+	TotalSignupRewards   *big.Int   `json:"totalSignupRewards,omitempty"`   // Budget of the member rewards, the remainder goes to the receiver
+	URFutureFundFee      *big.Int   `json:"urFutureFundFee,omitempty"`      // Fee paid to the UR Future Fund for every signup
+	ManagementFee        *big.Int   `json:"managementFee,omitempty"`        // Fee paid to the receiver for every signup
+	ManagementFeeCap     *big.Int   `json:"managementFeeCap,omitempty"`     // Average wei per signup above which no management fee is paid
+
+	Privileged []URPrivilegedSender `json:"privileged,omitempty"` // Replaces the compiled in privileged senders if set
+}
+
+// URPrivilegedSender is an address allowed to sign up members, along with the
+// addresses its signup fees are paid to.
+type URPrivilegedSender struct {
+	Address  common.Address `json:"address"`
+	Receiver common.Address `json:"receiver"`
+	URFF     common.Address `json:"urff"`
 }
 
 // String implements the Stringer interface.
 func (c *ChainConfig) String() string {
-	return fmt.Sprintf("{ChainID: %v Homestead: %v DAO: %v DAOSupport: %v EIP150: %v EIP155: %v EIP158: %v}",
+	return fmt.Sprintf("{ChainID: %v Homestead: %v DAO: %v DAOSupport: %v EIP150: %v EIP155: %v EIP158: %v MinGasPrice: %v@%v FeeContract: %v}",
 		c.ChainId,
 		c.HomesteadBlock,
 		c.DAOForkBlock,
@@ -77,11 +151,14 @@ func (c *ChainConfig) String() string {
 		c.EIP150Block,
 		c.EIP155Block,
 		c.EIP158Block,
+		c.MinGasPrice,
+		c.MinGasPriceBlock,
+		c.FeeContractBlock,
 	)
 }
 
 var (
-	TestChainConfig = &ChainConfig{big.NewInt(1), new(big.Int), new(big.Int), true, new(big.Int), common.Hash{}, new(big.Int), new(big.Int)}
+	TestChainConfig = &ChainConfig{big.NewInt(1), new(big.Int), new(big.Int), true, new(big.Int), common.Hash{}, new(big.Int), new(big.Int), nil, nil, nil, nil, nil, nil, nil}
 	TestRules       = TestChainConfig.Rules(new(big.Int))
 )
 
@@ -135,6 +212,213 @@ func (c *ChainConfig) IsEIP158(num *big.Int) bool {
 
 }
 
+// IsFeeContract returns whether contract fee receivers are notified of credited
+// signup fees at block num.
+func (c *ChainConfig) IsFeeContract(num *big.Int) bool {
+	if c.FeeContractBlock == nil || num == nil {
+		return false
+	}
+	return num.Cmp(c.FeeContractBlock) >= 0
+}
+
+// MinGasPriceAt returns the minimum gas price every transaction included in
+// block num must pay, or nil if no floor is enforced at that height.
+func (c *ChainConfig) MinGasPriceAt(num *big.Int) *big.Int {
+	if c.MinGasPriceBlock == nil || c.MinGasPrice == nil || num == nil {
+		return nil
+	}
+	if num.Cmp(c.MinGasPriceBlock) < 0 {
+		return nil
+	}
+	return c.MinGasPrice
+}
+
+// DifficultyForkAt returns the difficulty fork governing block num, or nil if
+// the difficulty algorithm is selected by the Homestead block.
+func (c *ChainConfig) DifficultyForkAt(num *big.Int) *DifficultyFork {
+	if num == nil {
+		return nil
+	}
+	var fork *DifficultyFork
+	for i := range c.DifficultyForks {
+		if isForked(c.DifficultyForks[i].Block, num) {
+			fork = &c.DifficultyForks[i]
+		}
+	}
+	return fork
+}
+
+// UnclePolicyAt returns the uncle policy governing block num, or nil if the
+// Ethereum uncle rules apply at that height.
+func (c *ChainConfig) UnclePolicyAt(num *big.Int) *UnclePolicy {
+	if !isForked(c.UnclePolicyBlock, num) {
+		return nil
+	}
+	return c.UnclePolicy
+}
+
+// CheckCompatible checks whether a chain with its head at the given height can
+// switch from the configuration c to newcfg, i.e. whether they agree on all the
+// rules applied to the blocks already processed. Forks scheduled beyond the head
+// may be added, moved or removed freely.
+func (c *ChainConfig) CheckCompatible(newcfg *ChainConfig, height uint64) *ConfigCompatError {
+	head := new(big.Int).SetUint64(height)
+
+	if isForkIncompatible(c.HomesteadBlock, newcfg.HomesteadBlock, head) {
+		return newCompatError("Homestead fork block", c.HomesteadBlock, newcfg.HomesteadBlock)
+	}
+	if isForkIncompatible(c.DAOForkBlock, newcfg.DAOForkBlock, head) {
+		return newCompatError("DAO fork block", c.DAOForkBlock, newcfg.DAOForkBlock)
+	}
+	if isForked(c.DAOForkBlock, head) && c.DAOForkSupport != newcfg.DAOForkSupport {
+		return newCompatError("DAO fork support flag", c.DAOForkBlock, newcfg.DAOForkBlock)
+	}
+	if isForkIncompatible(c.EIP150Block, newcfg.EIP150Block, head) {
+		return newCompatError("EIP150 fork block", c.EIP150Block, newcfg.EIP150Block)
+	}
+	if isForkIncompatible(c.EIP155Block, newcfg.EIP155Block, head) {
+		return newCompatError("EIP155 fork block", c.EIP155Block, newcfg.EIP155Block)
+	}
+	if isForked(c.EIP155Block, head) && !configNumEqual(c.ChainId, newcfg.ChainId) {
+		return newCompatError("EIP155 chain ID", c.EIP155Block, newcfg.EIP155Block)
+	}
+	if isForkIncompatible(c.EIP158Block, newcfg.EIP158Block, head) {
+		return newCompatError("EIP158 fork block", c.EIP158Block, newcfg.EIP158Block)
+	}
+	if isForkIncompatible(c.MinGasPriceBlock, newcfg.MinGasPriceBlock, head) {
+		return newCompatError("minimum gas price block", c.MinGasPriceBlock, newcfg.MinGasPriceBlock)
+	}
+	if isForked(c.MinGasPriceBlock, head) && !configNumEqual(c.MinGasPrice, newcfg.MinGasPrice) {
+		return newCompatError("minimum gas price", c.MinGasPriceBlock, newcfg.MinGasPriceBlock)
+	}
+	if isForkIncompatible(c.FeeContractBlock, newcfg.FeeContractBlock, head) {
+		return newCompatError("fee contract fork block", c.FeeContractBlock, newcfg.FeeContractBlock)
+	}
+	if isForkIncompatible(c.UnclePolicyBlock, newcfg.UnclePolicyBlock, head) {
+		return newCompatError("uncle policy block", c.UnclePolicyBlock, newcfg.UnclePolicyBlock)
+	}
+	if isForked(c.UnclePolicyBlock, head) && !c.UnclePolicy.equal(newcfg.UnclePolicy) {
+		return newCompatError("uncle policy", c.UnclePolicyBlock, newcfg.UnclePolicyBlock)
+	}
+	if err := checkDifficultyForksCompatible(c.DifficultyForks, newcfg.DifficultyForks, head); err != nil {
+		return err
+	}
+	// The UR rewards are paid from the first block on, there's no rewinding past them
+	if height > 0 && !c.UR.equal(newcfg.UR) {
+		return &ConfigCompatError{What: "UR reward parameters"}
+	}
+	return nil
+}
+
+// checkDifficultyForksCompatible checks that two difficulty fork schedules agree
+// on all the forks up to the head block.
+func checkDifficultyForksCompatible(stored, updated []DifficultyFork, head *big.Int) *ConfigCompatError {
+	for i := 0; ; i++ {
+		var s1, s2 *DifficultyFork
+		if i < len(stored) && isForked(stored[i].Block, head) {
+			s1 = &stored[i]
+		}
+		if i < len(updated) && isForked(updated[i].Block, head) {
+			s2 = &updated[i]
+		}
+		switch {
+		case s1 == nil && s2 == nil:
+			return nil
+		case s1 == nil:
+			return newCompatError("difficulty fork", nil, s2.Block)
+		case s2 == nil:
+			return newCompatError("difficulty fork", s1.Block, nil)
+		case !s1.equal(s2):
+			return newCompatError("difficulty fork", s1.Block, s2.Block)
+		}
+	}
+}
+
+// isForkIncompatible returns whether a fork scheduled at block s1 can't be
+// rescheduled to block s2 because head is already on one of them.
+func isForkIncompatible(s1, s2, head *big.Int) bool {
+	return (isForked(s1, head) || isForked(s2, head)) && !configNumEqual(s1, s2)
+}
+
+// isForked returns whether a fork scheduled at block s is active at the given
+// head block.
+func isForked(s, head *big.Int) bool {
+	if s == nil || head == nil {
+		return false
+	}
+	return s.Cmp(head) <= 0
+}
+
+func configNumEqual(x, y *big.Int) bool {
+	if x == nil {
+		return y == nil
+	}
+	if y == nil {
+		return false
+	}
+	return x.Cmp(y) == 0
+}
+
+// equal returns whether two UR reward configurations set the same parameters.
+func (c *URConfig) equal(other *URConfig) bool {
+	if c == nil || other == nil {
+		return c == other
+	}
+	if len(c.MembersSignupRewards) != len(other.MembersSignupRewards) || len(c.Privileged) != len(other.Privileged) {
+		return false
+	}
+	for i := range c.MembersSignupRewards {
+		if !configNumEqual(c.MembersSignupRewards[i], other.MembersSignupRewards[i]) {
+			return false
+		}
+	}
+	for i := range c.Privileged {
+		if c.Privileged[i] != other.Privileged[i] {
+			return false
+		}
+	}
+	return configNumEqual(c.BlockReward, other.BlockReward) &&
+		configNumEqual(c.SignupReward, other.SignupReward) &&
+		configNumEqual(c.TotalSignupRewards, other.TotalSignupRewards) &&
+		configNumEqual(c.URFutureFundFee, other.URFutureFundFee) &&
+		configNumEqual(c.ManagementFee, other.ManagementFee) &&
+		configNumEqual(c.ManagementFeeCap, other.ManagementFeeCap)
+}
+
+// ConfigCompatError is raised if the locally stored blockchain is initialised
+// with a chain configuration that would alter the past.
+type ConfigCompatError struct {
+	What string
+	// block numbers of the stored and new configurations
+	StoredConfig, NewConfig *big.Int
+	// the block number to which the local chain must be rewound to correct the error
+	RewindTo uint64
+}
+
+func newCompatError(what string, storedblock, newblock *big.Int) *ConfigCompatError {
+	var rew *big.Int
+	switch {
+	case storedblock == nil:
+		rew = newblock
+	case newblock == nil || storedblock.Cmp(newblock) < 0:
+		rew = storedblock
+	default:
+		rew = newblock
+	}
+	err := &ConfigCompatError{what, storedblock, newblock, 0}
+	if rew != nil && rew.Sign() > 0 {
+		err.RewindTo = rew.Uint64() - 1
+	}
+	return err
+}
+
+func (err *ConfigCompatError) Error() string {
+	if err.StoredConfig == nil && err.NewConfig == nil {
+		return fmt.Sprintf("mismatching %s in database (rewind to %d)", err.What, err.RewindTo)
+	}
+	return fmt.Sprintf("mismatching %s in database (have %v, want %v, rewind to %d)", err.What, err.StoredConfig, err.NewConfig, err.RewindTo)
+}
+
 // Rules wraps ChainConfig and is merely syntatic sugar or can be used for functions
 // that do not have or require information about the block.
 //
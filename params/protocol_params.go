@@ -70,4 +70,6 @@ var (
 	TxDataNonZeroGas     = big.NewInt(68)     // Per byte of data attached to a transaction that is not equal to zero. NOTE: Not payable on data of calls between transactions.
 
 	MaxCodeSize = 24576
+
+	FeeReceiverGas = big.NewInt(100000) // Gas stipend given to contract fee receivers when signup fees are credited.
 )
@@ -0,0 +1,268 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package rewardmon implements a monitoring-only circuit breaker of the reward
+// engine, cross-checking the issuance of every imported block against a ceiling
+// derived from the reward schedule. Violations never affect block processing,
+// they raise critical alerts as an early warning of reward logic exploits.
+package rewardmon
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/common/hexutil"
+	"github.com/ur-technology/go-ur/core"
+	"github.com/ur-technology/go-ur/core/state"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/eth"
+	"github.com/ur-technology/go-ur/event"
+	"github.com/ur-technology/go-ur/logger"
+	"github.com/ur-technology/go-ur/logger/glog"
+	"github.com/ur-technology/go-ur/metrics"
+	"github.com/ur-technology/go-ur/p2p"
+	"github.com/ur-technology/go-ur/rpc"
+)
+
+const maxViolations = 64 // Number of most recent violations kept for the RPC API
+
+var (
+	checkedCounter   = metrics.NewCounter("rewards/checked")
+	violationCounter = metrics.NewCounter("rewards/violations")
+)
+
+// Violation is a block whose issuance broke the reward schedule.
+type Violation struct {
+	Number  *rpc.HexNumber `json:"number"`
+	Hash    common.Hash    `json:"hash"`
+	Issued  *hexutil.Big   `json:"issued"`  // Wei issued by the block, per the account balances
+	Ceiling *hexutil.Big   `json:"ceiling"` // Most wei the block was allowed to issue
+	Reason  string         `json:"reason"`
+	Time    time.Time      `json:"time"`
+}
+
+// Service implements the reward engine circuit breaker, following the imported
+// blocks and alerting on every one issuing more than the ceiling.
+type Service struct {
+	chain   *core.BlockChain
+	mux     *event.TypeMux
+	ceiling *big.Int // Fixed per-block ceiling overriding the schedule, nil if derived
+
+	lock       sync.RWMutex
+	checked    uint64       // Number of blocks cross-checked
+	violations []*Violation // Most recent violations, oldest first
+	total      uint64       // Number of violations since startup
+
+	sub  event.Subscription
+	quit chan struct{}
+	done chan struct{}
+}
+
+// New returns a reward engine circuit breaker following the chain of the given
+// full node. A nil ceiling derives the one of every block from the schedule.
+func New(ethServ *eth.Ethereum, ceiling *big.Int) (*Service, error) {
+	if ethServ == nil {
+		return nil, errors.New("reward monitoring requires a full node")
+	}
+	return newService(ethServ.BlockChain(), ethServ.EventMux(), ceiling)
+}
+
+func newService(chain *core.BlockChain, mux *event.TypeMux, ceiling *big.Int) (*Service, error) {
+	if ceiling != nil && ceiling.Sign() < 0 {
+		return nil, fmt.Errorf("negative issuance ceiling %v", ceiling)
+	}
+	return &Service{
+		chain:   chain,
+		mux:     mux,
+		ceiling: ceiling,
+	}, nil
+}
+
+// Protocols implements node.Service, returning the P2P network protocols used
+// by the monitor (nil as it has none).
+func (s *Service) Protocols() []p2p.Protocol { return nil }
+
+// APIs implements node.Service, returning the RPC API endpoints reporting the
+// detected violations.
+func (s *Service) APIs() []rpc.API {
+	return []rpc.API{
+		{
+			Namespace: "rewardmon",
+			Version:   "1.0",
+			Service:   &PublicRewardMonitorAPI{s},
+			Public:    true,
+		},
+	}
+}
+
+// Start implements node.Service, starting to follow the imported blocks.
+func (s *Service) Start(server *p2p.Server) error {
+	s.sub = s.mux.Subscribe(core.ChainEvent{})
+	s.quit = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.loop()
+
+	if s.ceiling != nil {
+		glog.V(logger.Info).Infof("Reward monitoring started, issuance ceiling %v wei per block", s.ceiling)
+	} else {
+		glog.V(logger.Info).Infoln("Reward monitoring started, issuance ceiling derived from the reward schedule")
+	}
+	return nil
+}
+
+// Stop implements node.Service, terminating the monitor.
+func (s *Service) Stop() error {
+	s.sub.Unsubscribe()
+	close(s.quit)
+	<-s.done
+
+	glog.V(logger.Info).Infoln("Reward monitoring stopped")
+	return nil
+}
+
+// loop cross-checks every imported block until termination.
+func (s *Service) loop() {
+	defer close(s.done)
+
+	for {
+		select {
+		case ev, ok := <-s.sub.Chan():
+			if !ok {
+				return
+			}
+			if chainEv, ok := ev.Data.(core.ChainEvent); ok {
+				s.check(chainEv.Block)
+			}
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// check cross-checks the issuance of a block against its ceiling, raising an
+// alert if the block broke it. The violation is returned, nil if none.
+//
+// The issuance is measured on the state, as the change of the sum of the account
+// balances over the parent, so that it doesn't trust the reward code it checks.
+func (s *Service) check(block *types.Block) *Violation {
+	parent := s.chain.GetHeader(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		glog.V(logger.Debug).Infof("Skipping issuance check of block #%d: parent unknown", block.NumberU64())
+		return nil
+	}
+	header := block.Header()
+	issued, err := state.BalanceDelta(s.chain.StateDatabase(), parent.Root, header.Root)
+	if err != nil {
+		glog.V(logger.Debug).Infof("Skipping issuance check of block #%d: %v", block.NumberU64(), err)
+		return nil
+	}
+	ceiling := s.ceiling
+	if ceiling == nil {
+		ceiling = core.MaxBlockIssuance(s.chain.Config(), header, s.signups(block))
+	}
+	declared := new(big.Int).Sub(header.TotalWei, parent.TotalWei)
+	signups := new(big.Int).Sub(header.NSignups, parent.NSignups)
+
+	var reason string
+	switch {
+	case issued.Cmp(ceiling) > 0:
+		reason = "issuance above ceiling"
+	case issued.Cmp(declared) > 0:
+		reason = "issuance above signup totals"
+	case signups.Sign() < 0 || signups.Cmp(big.NewInt(int64(len(block.Transactions())))) > 0:
+		reason = fmt.Sprintf("%v signups from %d transactions", signups, len(block.Transactions()))
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.checked++
+	checkedCounter.Inc(1)
+	if reason == "" {
+		return nil
+	}
+	violation := &Violation{
+		Number:  rpc.NewHexNumber(block.Number()),
+		Hash:    block.Hash(),
+		Issued:  (*hexutil.Big)(issued),
+		Ceiling: (*hexutil.Big)(ceiling),
+		Reason:  reason,
+		Time:    time.Now(),
+	}
+	if len(s.violations) == maxViolations {
+		s.violations = s.violations[1:]
+	}
+	s.violations = append(s.violations, violation)
+	s.total++
+	violationCounter.Inc(1)
+
+	glog.V(logger.Error).Infof("CRITICAL: reward engine violation in block #%d [%x…]: %s (issued %v wei, ceiling %v wei)", block.NumberU64(), block.Hash().Bytes()[:4], reason, issued, ceiling)
+	return violation
+}
+
+// signups returns the number of signups of a block carrying a valid signup
+// chain, the others being processed as plain transfers without any reward.
+func (s *Service) signups(block *types.Block) int {
+	var (
+		config = s.chain.Config()
+		signer = types.MakeSigner(config, block.Number())
+		count  int
+	)
+	for _, tx := range block.Transactions() {
+		msg, err := tx.AsMessage(signer)
+		if err != nil || !core.IsSignupTransaction(config, msg) {
+			continue
+		}
+		if _, err := core.SignupChain(s.chain, tx); err == nil {
+			count++
+		}
+	}
+	return count
+}
+
+// PublicRewardMonitorAPI reports the issuance violations detected by the reward
+// engine circuit breaker.
+type PublicRewardMonitorAPI struct {
+	s *Service
+}
+
+// Status returns the number of blocks cross-checked and violations detected
+// since startup, along with the most recent violation, if any.
+func (api *PublicRewardMonitorAPI) Status() map[string]interface{} {
+	api.s.lock.RLock()
+	defer api.s.lock.RUnlock()
+
+	status := map[string]interface{}{
+		"checked":    api.s.checked,
+		"violations": api.s.total,
+		"tripped":    api.s.total > 0,
+	}
+	if len(api.s.violations) > 0 {
+		status["last"] = api.s.violations[len(api.s.violations)-1]
+	}
+	return status
+}
+
+// Violations returns the most recent violations, oldest first.
+func (api *PublicRewardMonitorAPI) Violations() []*Violation {
+	api.s.lock.RLock()
+	defer api.s.lock.RUnlock()
+
+	return append([]*Violation{}, api.s.violations...)
+}
@@ -0,0 +1,126 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package rewardmon
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core"
+	"github.com/ur-technology/go-ur/core/state"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/crypto"
+	"github.com/ur-technology/go-ur/ethdb"
+	"github.com/ur-technology/go-ur/event"
+	"github.com/ur-technology/go-ur/params"
+)
+
+// Tests that blocks issuing within the schedule pass the cross-check, while
+// blocks minting more than it allows or than their totals declare, or inflating
+// their signup counts, raise violations.
+func TestIssuanceCheck(t *testing.T) {
+	var (
+		key, _  = crypto.GenerateKey()
+		sender  = crypto.PubkeyToAddress(key.PublicKey)
+		config  = *params.TestChainConfig
+		signer  = types.NewEIP155Signer(config.ChainId)
+		db, _   = ethdb.NewMemDatabase()
+		mux     = new(event.TypeMux)
+		balance = new(big.Int).Mul(common.Ether, big.NewInt(1000000))
+	)
+	config.UR = &params.URConfig{Privileged: []params.URPrivilegedSender{{Address: sender, Receiver: common.Address{0xaa}, URFF: common.Address{0xbb}}}}
+	genesis := core.WriteGenesisBlockForTesting(db, core.GenesisAccount{Address: sender, Balance: balance})
+
+	chain, _ := core.NewBlockChain(db, &config, core.FakePow{}, mux)
+	defer chain.Stop()
+
+	// Generate an empty block, one with a signup and one with a signup whose
+	// signup chain is invalid, paying no rewards. The blocks are inserted one
+	// by one as the signups are paid based on the parent in the chain.
+	var blocks []*types.Block
+	for i, data := range [][]byte{nil, {1}, {1, 0xde, 0xad}} {
+		parent := genesis
+		if i > 0 {
+			parent = blocks[i-1]
+		}
+		generated, _ := core.GenerateChain(&config, chain, parent, db, 1, func(_ int, gen *core.BlockGen) {
+			if data != nil {
+				tx, _ := types.NewTransaction(gen.TxNonce(sender), common.Address{byte(i)}, big.NewInt(1), big.NewInt(100000), big.NewInt(1), data).SignECDSA(signer, key)
+				gen.AddTx(tx)
+			}
+		})
+		if _, err := chain.InsertChain(generated); err != nil {
+			t.Fatalf("failed to insert block #%d: %v", i+1, err)
+		}
+		blocks = append(blocks, generated[0])
+	}
+	s, err := newService(chain, mux, nil)
+	if err != nil {
+		t.Fatalf("failed to create monitor: %v", err)
+	}
+	for _, block := range blocks {
+		if v := s.check(block); v != nil {
+			t.Errorf("block #%d: unexpected violation: %s", block.NumberU64(), v.Reason)
+		}
+	}
+	// The signup with a valid chain must have been allowed its rewards
+	issued, _ := state.BalanceDelta(chain.StateDatabase(), blocks[0].Root(), blocks[1].Root())
+	if issued.Cmp(core.MaxBlockIssuance(&config, blocks[1].Header(), 0)) <= 0 {
+		t.Fatalf("signup issued %v wei, within the ceiling of no signups", issued)
+	}
+	// Forge blocks breaking the schedule on top of the generated states
+	forge := func(block *types.Block, mint *big.Int, totalWei, nSignups int64) *types.Block {
+		header := types.CopyHeader(block.Header())
+		if mint != nil {
+			statedb, _ := state.New(header.Root, chain.StateDatabase())
+			statedb.AddBalance(common.Address{0xff}, mint)
+			header.Root, _ = statedb.Commit(false)
+		}
+		header.TotalWei = new(big.Int).Add(header.TotalWei, big.NewInt(totalWei))
+		header.NSignups = new(big.Int).Add(header.NSignups, big.NewInt(nSignups))
+		return types.NewBlock(header, block.Transactions(), nil, nil)
+	}
+	signup := new(big.Int).Sub(core.MaxBlockIssuance(&config, blocks[2].Header(), 1), core.MaxBlockIssuance(&config, blocks[2].Header(), 0))
+
+	tests := []struct {
+		block  *types.Block
+		reason string
+	}{
+		// Minting the rewards of the signup with an invalid chain
+		{forge(blocks[2], signup, 0, 0), "issuance above ceiling"},
+		// Minting more than the totals declare
+		{forge(blocks[0], big.NewInt(1), 0, 0), "issuance above signup totals"},
+		// Declaring more signups than transactions
+		{forge(blocks[0], nil, 0, 1), "1 signups from 0 transactions"},
+	}
+	for i, tt := range tests {
+		v := s.check(tt.block)
+		if v == nil || v.Reason != tt.reason {
+			t.Errorf("test %d: violation mismatch: have %v, want %q", i, v, tt.reason)
+		}
+	}
+	api := &PublicRewardMonitorAPI{s}
+	if status := api.Status(); status["checked"] != uint64(6) || status["violations"] != uint64(3) {
+		t.Errorf("status mismatch: have %v, want 6 checked and 3 violations", status)
+	}
+	// A fixed ceiling overrides the schedule
+	s.ceiling = new(big.Int)
+	if v := s.check(blocks[0]); v == nil || v.Reason != "issuance above ceiling" {
+		t.Errorf("fixed ceiling violation mismatch: have %v", v)
+	}
+}
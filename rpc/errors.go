@@ -16,7 +16,10 @@
 
 package rpc
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 // request is for an unknown service
 type methodNotFoundError struct {
@@ -64,3 +67,25 @@ type shutdownError struct{}
 func (e *shutdownError) ErrorCode() int { return -32000 }
 
 func (e *shutdownError) Error() string { return "server is shutting down" }
+
+// issued when a batch response grows beyond the configured size limit.
+type responseTooLargeError struct{ limit int }
+
+func (e *responseTooLargeError) ErrorCode() int { return -32003 }
+
+func (e *responseTooLargeError) Error() string {
+	return fmt.Sprintf("batch response exceeds the %d bytes size limit", e.limit)
+}
+
+// issued when a method call exceeds the execution deadline of its namespace.
+type timeoutError struct {
+	service string
+	method  string
+	timeout time.Duration
+}
+
+func (e *timeoutError) ErrorCode() int { return -32002 }
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("%s%s%s exceeded the %v execution deadline", e.service, serviceMethodSeparator, e.method, e.timeout)
+}
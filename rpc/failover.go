@@ -0,0 +1,238 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ur-technology/go-ur/logger"
+	"github.com/ur-technology/go-ur/logger/glog"
+	"golang.org/x/net/context"
+)
+
+// healthCheckMethod is called on upstream endpoints to check their health. It is
+// served by every server, whatever APIs it exposes.
+const healthCheckMethod = MetadataApi + serviceMethodSeparator + "modules"
+
+// ErrNoUpstream is returned when none of the upstream endpoints could be reached.
+var ErrNoUpstream = errors.New("no upstream endpoint reachable")
+
+// FailoverClient forwards calls to a list of equivalent upstream endpoints in
+// order of preference. Endpoints are health checked in the background, calls go
+// to the first healthy one and fail over to the next whenever an endpoint can't
+// be reached. It implements Fallback, allowing a Server to act as a gateway.
+type FailoverClient struct {
+	endpoints []string
+	clients   []*Client // connections to the endpoints, nil until dialed
+	healthy   []bool    // health of the endpoints as of the last check or call
+
+	lock sync.Mutex
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewFailoverClient creates a client for the given upstream endpoints, checking
+// their health every interval until closed.
+func NewFailoverClient(endpoints []string, interval time.Duration) *FailoverClient {
+	fc := &FailoverClient{
+		endpoints: endpoints,
+		clients:   make([]*Client, len(endpoints)),
+		healthy:   make([]bool, len(endpoints)),
+		quit:      make(chan struct{}),
+	}
+	// Endpoints are assumed healthy until proven otherwise
+	for i := range fc.healthy {
+		fc.healthy[i] = true
+	}
+	fc.wg.Add(1)
+	go fc.loop(interval)
+	return fc
+}
+
+// Close stops the health checks and disconnects from all endpoints.
+func (fc *FailoverClient) Close() {
+	close(fc.quit)
+	fc.wg.Wait()
+
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+
+	for i, client := range fc.clients {
+		if client != nil {
+			client.Close()
+			fc.clients[i] = nil
+		}
+	}
+}
+
+// Healthy returns the endpoints deemed healthy, in order of preference.
+func (fc *FailoverClient) Healthy() []string {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+
+	var endpoints []string
+	for i, healthy := range fc.healthy {
+		if healthy {
+			endpoints = append(endpoints, fc.endpoints[i])
+		}
+	}
+	return endpoints
+}
+
+// CallRaw implements Fallback, executing the call on the first healthy endpoint
+// able to answer it. Errors returned by an endpoint are passed on as is, only
+// connection failures fail over. If no endpoint is healthy, all are tried.
+func (fc *FailoverClient) CallRaw(ctx context.Context, method string, params json.RawMessage) (json.RawMessage, error) {
+	var args []interface{}
+	if len(params) > 0 {
+		var raw []json.RawMessage
+		if err := json.Unmarshal(params, &raw); err != nil {
+			return nil, &invalidParamsError{err.Error()}
+		}
+		for _, arg := range raw {
+			args = append(args, arg)
+		}
+	}
+	for _, i := range fc.candidates() {
+		client, err := fc.client(ctx, i)
+		if err == nil {
+			var result json.RawMessage
+			switch err = client.CallContext(ctx, &result, method, args...); err {
+			case nil:
+				return result, nil
+			case ErrNoResult:
+				return json.RawMessage("null"), nil
+			}
+			if _, ok := err.(Error); ok {
+				return nil, err
+			}
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		fc.fail(i, err)
+	}
+	return nil, ErrNoUpstream
+}
+
+// candidates returns the indexes of the endpoints to try a call on.
+func (fc *FailoverClient) candidates() []int {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+
+	var healthy, all []int
+	for i := range fc.endpoints {
+		if fc.healthy[i] {
+			healthy = append(healthy, i)
+		}
+		all = append(all, i)
+	}
+	if len(healthy) == 0 {
+		return all
+	}
+	return healthy
+}
+
+// client returns the connection to the i'th endpoint, dialing it if needed.
+func (fc *FailoverClient) client(ctx context.Context, i int) (*Client, error) {
+	fc.lock.Lock()
+	client := fc.clients[i]
+	fc.lock.Unlock()
+
+	if client != nil {
+		return client, nil
+	}
+	// Dial without holding the lock, unreachable endpoints may take a while
+	client, err := DialContext(ctx, fc.endpoints[i])
+	if err != nil {
+		return nil, err
+	}
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+
+	if fc.clients[i] != nil {
+		client.Close()
+		return fc.clients[i], nil
+	}
+	fc.clients[i] = client
+	return client, nil
+}
+
+// fail marks the i'th endpoint unhealthy and drops its connection.
+func (fc *FailoverClient) fail(i int, err error) {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+
+	if fc.clients[i] != nil {
+		fc.clients[i].Close()
+		fc.clients[i] = nil
+	}
+	if fc.healthy[i] {
+		glog.V(logger.Warn).Infof("RPC upstream %s unhealthy: %v", fc.endpoints[i], err)
+		fc.healthy[i] = false
+	}
+}
+
+// revive marks the i'th endpoint healthy again.
+func (fc *FailoverClient) revive(i int) {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+
+	if !fc.healthy[i] {
+		glog.V(logger.Info).Infof("RPC upstream %s healthy", fc.endpoints[i])
+		fc.healthy[i] = true
+	}
+}
+
+// loop checks the health of all endpoints every interval.
+func (fc *FailoverClient) loop(interval time.Duration) {
+	defer fc.wg.Done()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			for i := range fc.endpoints {
+				fc.check(i, interval)
+			}
+			timer.Reset(interval)
+		case <-fc.quit:
+			return
+		}
+	}
+}
+
+// check calls healthCheckMethod on the i'th endpoint, updating its health.
+func (fc *FailoverClient) check(i int, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	client, err := fc.client(ctx, i)
+	if err == nil {
+		err = client.CallContext(ctx, nil, healthCheckMethod)
+	}
+	if err != nil {
+		fc.fail(i, err)
+		return
+	}
+	fc.revive(i)
+}
@@ -0,0 +1,116 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestUpstream starts an HTTP server exposing the test service.
+func newTestUpstream(t *testing.T) *httptest.Server {
+	server := NewServer()
+	if err := server.RegisterName("test", new(Service)); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.RegisterName("personal", new(Service)); err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(server)
+}
+
+// Tests that a server with a fallback forwards the calls it can't serve to the
+// first reachable upstream, failing over when one goes down.
+func TestServerFallback(t *testing.T) {
+	primary, secondary := newTestUpstream(t), newTestUpstream(t)
+	defer secondary.Close()
+
+	upstream := NewFailoverClient([]string{primary.URL, secondary.URL}, time.Hour)
+	defer upstream.Close()
+
+	gateway := NewServer()
+	if err := gateway.RegisterName("local", new(Service)); err != nil {
+		t.Fatal(err)
+	}
+	gateway.SetFallback(upstream, []string{"local_rets"}, nil)
+	client := DialInProc(gateway)
+	defer client.Close()
+
+	// Local methods are served locally, unknown ones upstream
+	var result Result
+	if err := client.Call(&result, "local_echo", "local", 1, &Args{"x"}); err != nil || result.String != "local" {
+		t.Fatalf("local call failed: %v %+v", err, result)
+	}
+	if err := client.Call(&result, "test_echo", "forwarded", 2, &Args{"y"}); err != nil {
+		t.Fatalf("forwarded call failed: %v", err)
+	}
+	if want := (Result{"forwarded", 2, &Args{"y"}}); !reflect.DeepEqual(result, want) {
+		t.Errorf("forwarded result mismatch: have %+v, want %+v", result, want)
+	}
+	// Upstream errors are passed on with their codes
+	err := client.Call(nil, "test_fail", true)
+	if coded, ok := err.(Error); !ok || coded.ErrorCode() != -32042 {
+		t.Errorf("forwarded error mismatch: have %v, want code -32042", err)
+	}
+	// Forced methods go upstream even though served locally
+	err = client.Call(nil, "local_rets")
+	if coded, ok := err.(Error); !ok || coded.ErrorCode() != -32601 {
+		t.Errorf("forced call error mismatch: have %v, want code -32601", err)
+	}
+	// Calls fail over once the primary goes down
+	primary.Close()
+	if err := client.Call(&result, "test_echo", "failover", 3, nil); err != nil || result.String != "failover" {
+		t.Fatalf("failover call failed: %v %+v", err, result)
+	}
+	if healthy := upstream.Healthy(); !reflect.DeepEqual(healthy, []string{secondary.URL}) {
+		t.Errorf("healthy upstreams mismatch: have %v, want %v", healthy, []string{secondary.URL})
+	}
+	secondary.Close()
+	if err := client.Call(nil, "test_echo", "none", 4, nil); err == nil || err.Error() != ErrNoUpstream.Error() {
+		t.Errorf("unreachable upstream error mismatch: have %v, want %v", err, ErrNoUpstream)
+	}
+}
+
+// Tests that a server only forwards the calls within the namespaces it exposes,
+// so that the upstreams can't serve modules the endpoint isn't whitelisted for.
+func TestServerFallbackWhitelist(t *testing.T) {
+	upstream := newTestUpstream(t)
+	defer upstream.Close()
+
+	client := NewFailoverClient([]string{upstream.URL}, time.Hour)
+	defer client.Close()
+
+	gateway := NewServer()
+	if err := gateway.RegisterName("local", new(Service)); err != nil {
+		t.Fatal(err)
+	}
+	gateway.SetFallback(client, []string{"personal"}, []string{"local", "test"})
+	inproc := DialInProc(gateway)
+	defer inproc.Close()
+
+	var result Result
+	if err := inproc.Call(&result, "test_echo", "exposed", 1, nil); err != nil || result.String != "exposed" {
+		t.Fatalf("exposed call failed: %v %+v", err, result)
+	}
+	// Calls outside the exposed namespaces are rejected, even if forced
+	err := inproc.Call(&result, "personal_echo", "unexposed", 2, nil)
+	if coded, ok := err.(Error); !ok || coded.ErrorCode() != -32601 {
+		t.Errorf("unexposed call error mismatch: have %v, want code -32601", err)
+	}
+}
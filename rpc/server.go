@@ -17,10 +17,13 @@
 package rpc
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"runtime"
+	"strings"
 	"sync/atomic"
+	"time"
 
 	"github.com/ur-technology/go-ur/logger"
 	"github.com/ur-technology/go-ur/logger/glog"
@@ -127,6 +130,123 @@ func (s *Server) RegisterName(name string, rcvr interface{}) error {
 	return nil
 }
 
+// SetTimeout configures the maximum time a method call in the given namespace
+// may execute before the request is answered with a timeout error. The deadline
+// is enforced through the request context, methods accepting a context should
+// abort once it is cancelled. A zero or negative duration removes the deadline.
+// It may be called while the server is serving requests, calls in progress keep
+// their original deadline.
+func (s *Server) SetTimeout(namespace string, timeout time.Duration) {
+	s.limitsMu.Lock()
+	defer s.limitsMu.Unlock()
+
+	if s.timeouts == nil {
+		s.timeouts = make(map[string]time.Duration)
+	}
+	if timeout <= 0 {
+		delete(s.timeouts, namespace)
+		return
+	}
+	s.timeouts[namespace] = timeout
+}
+
+// SetBatchLimits configures the maximum number of requests accepted in a single
+// batch and the maximum accumulated size in bytes of a batch response. Batches
+// with too many requests are rejected as a whole, while requests whose results
+// would push the response beyond the size limit are answered with an error. A
+// zero limit disables the corresponding check. It may be called while the
+// server is serving requests, batches in progress keep their original limits.
+func (s *Server) SetBatchLimits(itemLimit, maxResponseSize int) {
+	s.limitsMu.Lock()
+	defer s.limitsMu.Unlock()
+
+	s.batchItemLimit = itemLimit
+	s.batchResponseLimit = maxResponseSize
+}
+
+// timeout returns the execution deadline of the given namespace, 0 if none.
+func (s *Server) timeout(namespace string) time.Duration {
+	s.limitsMu.RLock()
+	defer s.limitsMu.RUnlock()
+
+	return s.timeouts[namespace]
+}
+
+// batchLimits returns the current batch request and response size limits.
+func (s *Server) batchLimits() (int, int) {
+	s.limitsMu.RLock()
+	defer s.limitsMu.RUnlock()
+
+	return s.batchItemLimit, s.batchResponseLimit
+}
+
+// Fallback executes the method calls a Server has no callback for, e.g. by passing
+// them on to another node.
+type Fallback interface {
+	// CallRaw executes method with the given JSON encoded positional parameters
+	// and returns the JSON encoded result. Errors implementing Error are passed
+	// to the caller with their code.
+	CallRaw(ctx context.Context, method string, params json.RawMessage) (json.RawMessage, error)
+}
+
+// SetFallback configures the server to pass the calls of methods it doesn't serve
+// to fallback. Only calls within the namespaces listed in exposed are passed on,
+// nil exposing every namespace, so that the fallback can't serve namespaces the
+// endpoint is not whitelisted for. Namespaces or fully qualified methods listed
+// in forward are passed on even if served locally. Subscriptions are never
+// forwarded. It must be called before the server starts serving requests.
+func (s *Server) SetFallback(fallback Fallback, forward []string, exposed []string) {
+	s.fallback, s.forward = fallback, make(map[string]bool)
+	for _, name := range forward {
+		elems := strings.SplitN(name, serviceMethodSeparator, 2)
+		elems[0] = replaceServiceAliasWithTarget(elems[0])
+		s.forward[strings.Join(elems, serviceMethodSeparator)] = true
+	}
+	s.exposed = nil
+	if exposed != nil {
+		s.exposed = make(map[string]bool)
+		for _, namespace := range exposed {
+			s.exposed[replaceServiceAliasWithTarget(namespace)] = true
+		}
+	}
+}
+
+// forwards reports whether the call r is to be executed by the fallback.
+func (s *Server) forwards(r rpcRequest) bool {
+	if s.fallback == nil || r.isPubSub {
+		return false
+	}
+	if s.exposed != nil && !s.exposed[r.service] {
+		return false
+	}
+	if s.forward[r.service] || s.forward[r.service+serviceMethodSeparator+r.method] {
+		return true
+	}
+	svc, ok := s.services[r.service]
+	if !ok {
+		return true
+	}
+	_, ok = svc.callbacks[r.method]
+	return !ok
+}
+
+// callFallback executes a forwarded request and returns the response.
+func (s *Server) callFallback(ctx context.Context, codec ServerCodec, req *serverRequest) interface{} {
+	if timeout := s.timeout(req.svcname); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	result, err := s.fallback.CallRaw(ctx, req.svcname+serviceMethodSeparator+req.method, req.params)
+	if err != nil {
+		if coded, ok := err.(Error); ok {
+			return codec.CreateErrorResponse(&req.id, coded)
+		}
+		return codec.CreateErrorResponse(&req.id, &callbackError{err.Error()})
+	}
+	return codec.CreateResponse(req.id, result)
+}
+
 // hasOption returns true if option is included in options, otherwise false
 func hasOption(option CodecOption, options []CodecOption) bool {
 	for _, o := range options {
@@ -266,6 +386,10 @@ func (s *Server) handle(ctx context.Context, codec ServerCodec, req *serverReque
 		return codec.CreateErrorResponse(&req.id, req.err), nil
 	}
 
+	if req.fallback {
+		return s.callFallback(ctx, codec, req), nil
+	}
+
 	if req.isUnsubscribe { // cancel subscription, first param must be the subscription id
 		if len(req.args) >= 1 && req.args[0].Kind() == reflect.String {
 			notifier, supported := NotifierFromContext(ctx)
@@ -289,6 +413,8 @@ func (s *Server) handle(ctx context.Context, codec ServerCodec, req *serverReque
 			return codec.CreateErrorResponse(&req.id, &callbackError{err.Error()}), nil
 		}
 
+		req.subid = subid
+
 		// active the subscription after the sub id was successfully sent to the client
 		activateSub := func() {
 			notifier, _ := NotifierFromContext(ctx)
@@ -306,6 +432,14 @@ func (s *Server) handle(ctx context.Context, codec ServerCodec, req *serverReque
 		return codec.CreateErrorResponse(&req.id, rpcErr), nil
 	}
 
+	// apply the execution deadline of the namespace, if one was configured
+	timeout := s.timeout(req.svcname)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
 	arguments := []reflect.Value{req.callb.rcvr}
 	if req.callb.hasCtx {
 		arguments = append(arguments, reflect.ValueOf(ctx))
@@ -314,8 +448,13 @@ func (s *Server) handle(ctx context.Context, codec ServerCodec, req *serverReque
 		arguments = append(arguments, req.args...)
 	}
 
-	// execute RPC method and return result
+	// execute RPC method and return result, methods taking a context are
+	// cancelled through it once the deadline of the namespace passes
 	reply := req.callb.method.Func.Call(arguments)
+	if timeout > 0 && ctx.Err() == context.DeadlineExceeded {
+		rpcErr := &timeoutError{req.svcname, req.callb.method.Name, timeout}
+		return codec.CreateErrorResponse(&req.id, rpcErr), nil
+	}
 	if len(reply) == 0 {
 		return codec.CreateResponse(req.id, nil), nil
 	}
@@ -323,6 +462,11 @@ func (s *Server) handle(ctx context.Context, codec ServerCodec, req *serverReque
 	if req.callb.errPos >= 0 { // test if method returned an error
 		if !reply[req.callb.errPos].IsNil() {
 			e := reply[req.callb.errPos].Interface().(error)
+			// Errors carrying their own code are returned as is, anything else is
+			// reported as a generic callback failure
+			if coded, ok := e.(Error); ok {
+				return codec.CreateErrorResponse(&req.id, coded), nil
+			}
 			res := codec.CreateErrorResponse(&req.id, &callbackError{e.Error()})
 			return res, nil
 		}
@@ -354,17 +498,52 @@ func (s *Server) exec(ctx context.Context, codec ServerCodec, req *serverRequest
 // execBatch executes the given requests and writes the result back using the codec.
 // It will only write the response back when the last request is processed.
 func (s *Server) execBatch(ctx context.Context, codec ServerCodec, requests []*serverRequest) {
+	itemLimit, responseLimit := s.batchLimits()
+	if itemLimit > 0 && len(requests) > itemLimit {
+		err := &invalidRequestError{fmt.Sprintf("batch of %d requests exceeds the limit of %d", len(requests), itemLimit)}
+		if err := codec.Write(codec.CreateErrorResponse(nil, err)); err != nil {
+			glog.V(logger.Error).Infof("%v\n", err)
+			codec.Close()
+		}
+		return
+	}
+
 	responses := make([]interface{}, len(requests))
-	var callbacks []func()
+	var (
+		callbacks []func()
+		size      int
+	)
+	// Execute the requests in order, so that their side effects happen in the
+	// order they were requested (e.g. nonce ordered transactions). Once the
+	// responses exceed the size limit the remaining requests are not executed.
 	for i, req := range requests {
+		if responseLimit > 0 && size > responseLimit {
+			responses[i] = codec.CreateErrorResponse(&req.id, &responseTooLargeError{responseLimit})
+			continue
+		}
+		var callback func()
 		if req.err != nil {
 			responses[i] = codec.CreateErrorResponse(&req.id, req.err)
 		} else {
-			var callback func()
-			if responses[i], callback = s.handle(ctx, codec, req); callback != nil {
-				callbacks = append(callbacks, callback)
+			responses[i], callback = s.handle(ctx, codec, req)
+		}
+		if responseLimit > 0 {
+			if blob, err := json.Marshal(responses[i]); err == nil {
+				size += len(blob)
+			}
+			if size > responseLimit {
+				// The subscription ID won't reach the client, drop the subscription
+				if req.subid != "" {
+					if notifier, ok := NotifierFromContext(ctx); ok {
+						notifier.discard(req.subid)
+					}
+				}
+				responses[i], callback = codec.CreateErrorResponse(&req.id, &responseTooLargeError{responseLimit}), nil
 			}
 		}
+		if callback != nil {
+			callbacks = append(callbacks, callback)
+		}
 	}
 
 	if err := codec.Write(responses); err != nil {
@@ -410,6 +589,18 @@ func (s *Server) readRequest(codec ServerCodec) ([]*serverRequest, bool, Error)
 			continue
 		}
 
+		if s.forwards(r) { // method is served by the fallback
+			requests[i] = &serverRequest{id: r.id, svcname: r.service, fallback: true, method: r.method}
+			if r.params != nil {
+				if params, ok := r.params.(json.RawMessage); ok {
+					requests[i].params = params
+				} else {
+					requests[i].err = &invalidParamsError{"Invalid params supplied"}
+				}
+			}
+			continue
+		}
+
 		if svc, ok = s.services[r.service]; !ok { // rpc method isn't available
 			requests[i] = &serverRequest{id: r.id, err: &methodNotFoundError{r.service, r.method}}
 			continue
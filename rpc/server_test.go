@@ -18,8 +18,11 @@ package rpc
 
 import (
 	"encoding/json"
+	"errors"
 	"net"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -60,6 +63,18 @@ func (s *Service) Rets() (string, error) {
 	return "", nil
 }
 
+type codedError struct{}
+
+func (e *codedError) Error() string  { return "coded failure" }
+func (e *codedError) ErrorCode() int { return -32042 }
+
+func (s *Service) Fail(coded bool) error {
+	if coded {
+		return &codedError{}
+	}
+	return errors.New("plain failure")
+}
+
 func (s *Service) InvalidRets1() (error, string) {
 	return nil, ""
 }
@@ -93,8 +108,8 @@ func TestServerRegisterName(t *testing.T) {
 		t.Fatalf("Expected service calc to be registered")
 	}
 
-	if len(svc.callbacks) != 5 {
-		t.Errorf("Expected 5 callbacks for service 'calc', got %d", len(svc.callbacks))
+	if len(svc.callbacks) != 6 {
+		t.Errorf("Expected 6 callbacks for service 'calc', got %d", len(svc.callbacks))
 	}
 
 	if len(svc.subscriptions) != 1 {
@@ -161,3 +176,218 @@ func TestServerMethodExecution(t *testing.T) {
 func TestServerMethodWithCtx(t *testing.T) {
 	testServerMethodExecution(t, "echoWithCtx")
 }
+
+func TestServerMethodTimeout(t *testing.T) {
+	server := NewServer()
+	if err := server.RegisterName("test", new(Service)); err != nil {
+		t.Fatalf("%v", err)
+	}
+	server.SetTimeout("test", 50*time.Millisecond)
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+
+	go server.ServeCodec(NewJSONCodec(serverConn), OptionMethodInvocation)
+
+	out := json.NewEncoder(clientConn)
+	in := json.NewDecoder(clientConn)
+
+	for i, sleep := range []time.Duration{time.Millisecond, time.Minute} {
+		start := time.Now()
+		request := map[string]interface{}{
+			"id":      i,
+			"method":  "test_sleep",
+			"version": "2.0",
+			"params":  []interface{}{sleep},
+		}
+		if err := out.Encode(request); err != nil {
+			t.Fatal(err)
+		}
+		var response jsonErrResponse
+		if err := in.Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		if sleep < 50*time.Millisecond && response.Error.Code != 0 {
+			t.Errorf("call %d: unexpected error: %v", i, response.Error.Message)
+		}
+		if sleep > 50*time.Millisecond && response.Error.Code != -32002 {
+			t.Errorf("call %d: error code mismatch: have %d, want %d", i, response.Error.Code, -32002)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("call %d: method not cancelled at the deadline, took %v", i, elapsed)
+		}
+	}
+}
+
+func TestServerBatchLimits(t *testing.T) {
+	server := NewServer()
+	if err := server.RegisterName("test", new(Service)); err != nil {
+		t.Fatalf("%v", err)
+	}
+	server.SetBatchLimits(3, 150)
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+
+	go server.ServeCodec(NewJSONCodec(serverConn), OptionMethodInvocation)
+
+	out := json.NewEncoder(clientConn)
+	in := json.NewDecoder(clientConn)
+
+	makeBatch := func(n int, str string) []map[string]interface{} {
+		batch := make([]map[string]interface{}, n)
+		for i := range batch {
+			batch[i] = map[string]interface{}{
+				"id":      i,
+				"method":  "test_echo",
+				"version": "2.0",
+				"params":  []interface{}{str, i, &Args{"abc"}},
+			}
+		}
+		return batch
+	}
+
+	// A batch with too many requests must be rejected as a whole
+	if err := out.Encode(makeBatch(4, "x")); err != nil {
+		t.Fatal(err)
+	}
+	var rejected jsonErrResponse
+	if err := in.Decode(&rejected); err != nil {
+		t.Fatal(err)
+	}
+	if rejected.Error.Code != -32600 {
+		t.Errorf("oversized batch: error code mismatch: have %d, want %d", rejected.Error.Code, -32600)
+	}
+
+	// Requests after the response outgrew its size limit must fail
+	if err := out.Encode(makeBatch(3, strings.Repeat("x", 40))); err != nil {
+		t.Fatal(err)
+	}
+	var responses []jsonErrResponse
+	if err := in.Decode(&responses); err != nil {
+		t.Fatal(err)
+	}
+	if len(responses) != 3 {
+		t.Fatalf("response count mismatch: have %d, want 3", len(responses))
+	}
+	if responses[0].Error.Code != 0 {
+		t.Errorf("response 0: unexpected error: %v", responses[0].Error.Message)
+	}
+	for i := 1; i < len(responses); i++ {
+		if responses[i].Error.Code != -32003 {
+			t.Errorf("response %d: error code mismatch: have %d, want %d", i, responses[i].Error.Code, -32003)
+		}
+	}
+}
+
+// RecordService records the order its method is invoked in.
+type RecordService struct {
+	mu    sync.Mutex
+	calls []int
+}
+
+func (s *RecordService) Record(i int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls = append(s.calls, i)
+	return strings.Repeat("x", 40)
+}
+
+// Tests that the requests of a batch are executed in order, and that requests
+// after the response outgrew its size limit are not executed at all.
+func TestServerBatchOrder(t *testing.T) {
+	for _, limit := range []int{0, 200} {
+		service := new(RecordService)
+		server := NewServer()
+		if err := server.RegisterName("test", service); err != nil {
+			t.Fatalf("%v", err)
+		}
+		server.SetBatchLimits(0, limit)
+
+		clientConn, serverConn := net.Pipe()
+		go server.ServeCodec(NewJSONCodec(serverConn), OptionMethodInvocation)
+
+		batch := make([]map[string]interface{}, 32)
+		for i := range batch {
+			batch[i] = map[string]interface{}{
+				"id":      i,
+				"method":  "test_record",
+				"version": "2.0",
+				"params":  []interface{}{i},
+			}
+		}
+		if err := json.NewEncoder(clientConn).Encode(batch); err != nil {
+			t.Fatal(err)
+		}
+		var responses []jsonErrResponse
+		if err := json.NewDecoder(clientConn).Decode(&responses); err != nil {
+			t.Fatal(err)
+		}
+		clientConn.Close()
+
+		executed := len(batch)
+		if limit > 0 {
+			executed = 3 // Third response exceeds the limit, the rest never run
+		}
+		if len(service.calls) != executed {
+			t.Errorf("limit %d: executed request count mismatch: have %d, want %d", limit, len(service.calls), executed)
+		}
+		for i, call := range service.calls {
+			if call != i {
+				t.Errorf("limit %d: call %d out of order: executed request %d", limit, i, call)
+			}
+		}
+		for i, response := range responses {
+			if failed := response.Error.Code != 0; failed != (i >= executed-1 && limit > 0) {
+				t.Errorf("limit %d: response %d: unexpected error state: %v", limit, i, response.Error.Message)
+			}
+		}
+	}
+}
+
+// Tests that errors implementing Error keep their own code, while any other
+// error is reported with the generic callback error code.
+func TestServerErrorCodes(t *testing.T) {
+	server := NewServer()
+	if err := server.RegisterName("test", new(Service)); err != nil {
+		t.Fatalf("%v", err)
+	}
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+
+	go server.ServeCodec(NewJSONCodec(serverConn), OptionMethodInvocation)
+
+	out := json.NewEncoder(clientConn)
+	in := json.NewDecoder(clientConn)
+
+	tests := []struct {
+		coded   bool
+		code    int
+		message string
+	}{
+		{true, -32042, "coded failure"},
+		{false, -32000, "plain failure"},
+	}
+	for i, tt := range tests {
+		request := map[string]interface{}{
+			"id":      i,
+			"method":  "test_fail",
+			"version": "2.0",
+			"params":  []interface{}{tt.coded},
+		}
+		if err := out.Encode(request); err != nil {
+			t.Fatal(err)
+		}
+		var response jsonErrResponse
+		if err := in.Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		if response.Error.Code != tt.code {
+			t.Errorf("test %d: error code mismatch: have %d, want %d", i, response.Error.Code, tt.code)
+		}
+		if response.Error.Message != tt.message {
+			t.Errorf("test %d: error message mismatch: have %q, want %q", i, response.Error.Message, tt.message)
+		}
+	}
+}
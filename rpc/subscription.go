@@ -121,6 +121,17 @@ func (n *Notifier) unsubscribe(id ID) error {
 	return ErrSubscriptionNotFound
 }
 
+// discard removes a subscription whose ID never reached the client, e.g. because
+// the batch response carrying it was too large, stopping the callback serving it.
+func (n *Notifier) discard(id ID) {
+	n.subMu.Lock()
+	defer n.subMu.Unlock()
+	if s, found := n.inactive[id]; found {
+		close(s.err)
+		delete(n.inactive, id)
+	}
+}
+
 // activate enables a subscription. Until a subscription is enabled all
 // notifications are dropped. This method is called by the RPC server after
 // the subscription ID was sent to client. This prevents notifications being
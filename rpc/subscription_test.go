@@ -163,3 +163,61 @@ func TestNotifications(t *testing.T) {
 		t.Error("unsubscribe callback not called after closing connection")
 	}
 }
+
+// DiscardTestService reports the end of its subscriptions.
+type DiscardTestService struct {
+	ended chan ID
+}
+
+func (s *DiscardTestService) Echo(str string) string {
+	return str
+}
+
+func (s *DiscardTestService) Sub(ctx context.Context) (*Subscription, error) {
+	notifier, supported := NotifierFromContext(ctx)
+	if !supported {
+		return nil, ErrNotificationsUnsupported
+	}
+	subscription := notifier.CreateSubscription()
+	go func() {
+		<-subscription.Err()
+		s.ended <- subscription.ID
+	}()
+	return subscription, nil
+}
+
+// Tests that a subscription created by a batch request whose response is dropped
+// for exceeding the batch size limit is ended, as its ID never reaches the client.
+func TestSubscriptionDiscardedInOversizedBatch(t *testing.T) {
+	server := NewServer()
+	service := &DiscardTestService{ended: make(chan ID, 1)}
+	if err := server.RegisterName("eth", service); err != nil {
+		t.Fatalf("unable to register test service %v", err)
+	}
+	server.SetBatchLimits(0, 50)
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+
+	go server.ServeCodec(NewJSONCodec(serverConn), OptionMethodInvocation|OptionSubscriptions)
+
+	batch := []map[string]interface{}{
+		{"id": 1, "method": "eth_echo", "version": "2.0", "params": []interface{}{"x"}},
+		{"id": 2, "method": "eth_subscribe", "version": "2.0", "params": []interface{}{"sub"}},
+	}
+	if err := json.NewEncoder(clientConn).Encode(batch); err != nil {
+		t.Fatal(err)
+	}
+	var responses []jsonErrResponse
+	if err := json.NewDecoder(clientConn).Decode(&responses); err != nil {
+		t.Fatal(err)
+	}
+	if len(responses) != 2 || responses[0].Error.Code != 0 || responses[1].Error.Code != -32003 {
+		t.Fatalf("unexpected responses: %+v", responses)
+	}
+	select {
+	case <-service.ended:
+	case <-time.After(time.Second):
+		t.Fatal("subscription of the dropped response not ended")
+	}
+}
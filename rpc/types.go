@@ -19,12 +19,14 @@ package rpc
 import (
 	"bytes"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"math"
 	"math/big"
 	"reflect"
 	"strings"
 	"sync"
+	"time"
 
 	"gopkg.in/fatih/set.v0"
 )
@@ -64,7 +66,12 @@ type serverRequest struct {
 	callb         *callback
 	args          []reflect.Value
 	isUnsubscribe bool
+	subid         ID // subscription created by the request, if any
 	err           Error
+
+	fallback bool            // request is executed by the server's fallback
+	method   string          // name of the forwarded method within svcname
+	params   json.RawMessage // raw parameters of the forwarded call
 }
 
 type serviceRegistry map[string]*service       // collection of services
@@ -78,6 +85,15 @@ type Server struct {
 	muSubcriptions sync.Mutex // protects subscriptions
 	subscriptions  subscriptionRegistry
 
+	limitsMu           sync.RWMutex             // protects the timeouts and batch limits
+	timeouts           map[string]time.Duration // per namespace method execution deadlines
+	batchItemLimit     int                      // maximum number of requests in a batch, 0 = unlimited
+	batchResponseLimit int                      // maximum accumulated size of a batch response in bytes, 0 = unlimited
+
+	fallback Fallback        // executes the calls the server has no callback for, nil = none
+	forward  map[string]bool // namespaces and methods always passed to the fallback
+	exposed  map[string]bool // namespaces the fallback may serve, nil = all
+
 	run      int32
 	codecsMu sync.Mutex
 	codecs   *set.Set
@@ -0,0 +1,199 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package signupcast implements a service broadcasting the signups of the
+// imported blocks over a well-known whisper topic, so that lightweight clients
+// can follow new signups without any RPC connection to a node.
+package signupcast
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/eth"
+	"github.com/ur-technology/go-ur/event"
+	"github.com/ur-technology/go-ur/logger"
+	"github.com/ur-technology/go-ur/logger/glog"
+	"github.com/ur-technology/go-ur/p2p"
+	"github.com/ur-technology/go-ur/params"
+	"github.com/ur-technology/go-ur/rlp"
+	"github.com/ur-technology/go-ur/rpc"
+	whisper "github.com/ur-technology/go-ur/whisper/whisperv2"
+)
+
+// TopicName is the whisper topic the signup notifications are broadcast on.
+const TopicName = "ur-signups"
+
+// Topic is the whisper topic of the signup notifications.
+var Topic = whisper.NewTopicFromString(TopicName)
+
+const notificationTTL = 10 * time.Minute // Time the notifications are kept in the whisper pool
+
+// Notification is the whisper payload announcing the signups of a block.
+type Notification struct {
+	Block   uint64
+	Hash    common.Hash
+	Members []common.Address
+}
+
+// DecodeNotification decodes a message received on the signup topic, returning
+// it along with the public key of the node that signed it.
+func DecodeNotification(msg *whisper.Message) (*Notification, *ecdsa.PublicKey, error) {
+	signer := msg.Recover()
+	if signer == nil {
+		return nil, nil, errors.New("unsigned signup notification")
+	}
+	n := new(Notification)
+	if err := rlp.DecodeBytes(msg.Payload, n); err != nil {
+		return nil, nil, fmt.Errorf("invalid signup notification: %v", err)
+	}
+	return n, signer, nil
+}
+
+// Service implements the signup broadcaster, which follows the imported blocks
+// and posts a notification signed with the node key for every block containing
+// signups.
+type Service struct {
+	config *params.ChainConfig
+	mux    *event.TypeMux
+	shh    *whisper.Whisper
+
+	key  *ecdsa.PrivateKey
+	sub  event.Subscription
+	quit chan struct{}
+	done chan struct{}
+}
+
+// New returns a signup broadcaster posting through the given whisper service.
+func New(ethServ *eth.Ethereum, shh *whisper.Whisper) (*Service, error) {
+	if ethServ == nil {
+		return nil, errors.New("signup broadcasting requires a full node")
+	}
+	if shh == nil {
+		return nil, errors.New("signup broadcasting requires whisper")
+	}
+	return &Service{
+		config: ethServ.BlockChain().Config(),
+		mux:    ethServ.EventMux(),
+		shh:    shh,
+	}, nil
+}
+
+// Protocols implements node.Service, returning the P2P network protocols used
+// by the broadcaster (nil as it posts through the whisper protocol).
+func (s *Service) Protocols() []p2p.Protocol { return nil }
+
+// APIs implements node.Service, returning the RPC API endpoints provided by the
+// broadcaster (nil as it has none).
+func (s *Service) APIs() []rpc.API { return nil }
+
+// Start implements node.Service, starting to follow the imported blocks and
+// signing the notifications with the node key.
+func (s *Service) Start(server *p2p.Server) error {
+	s.key = server.PrivateKey
+	s.sub = s.mux.Subscribe(core.ChainEvent{})
+	s.quit = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.loop()
+
+	glog.V(logger.Info).Infof("Signup broadcasting started on whisper topic %q", TopicName)
+	return nil
+}
+
+// Stop implements node.Service, terminating the broadcaster.
+func (s *Service) Stop() error {
+	s.sub.Unsubscribe()
+	close(s.quit)
+	<-s.done
+
+	glog.V(logger.Info).Infoln("Signup broadcasting stopped")
+	return nil
+}
+
+// loop broadcasts the signups of every imported block until termination.
+func (s *Service) loop() {
+	defer close(s.done)
+
+	for {
+		select {
+		case ev, ok := <-s.sub.Chan():
+			if !ok {
+				return
+			}
+			chainEv, ok := ev.Data.(core.ChainEvent)
+			if !ok {
+				continue
+			}
+			envelope, err := s.envelope(chainEv.Block)
+			if envelope == nil {
+				if err != nil {
+					glog.V(logger.Warn).Infof("Failed to assemble signup notification of block #%d: %v", chainEv.Block.NumberU64(), err)
+				}
+				continue
+			}
+			if err := s.shh.Send(envelope); err != nil {
+				glog.V(logger.Warn).Infof("Failed to broadcast signup notification of block #%d: %v", chainEv.Block.NumberU64(), err)
+			}
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// envelope assembles the signed whisper envelope announcing the signups of the
+// given block, nil if the block has none.
+func (s *Service) envelope(block *types.Block) (*whisper.Envelope, error) {
+	members := signups(s.config, block)
+	if len(members) == 0 {
+		return nil, nil
+	}
+	payload, err := rlp.EncodeToBytes(&Notification{
+		Block:   block.NumberU64(),
+		Hash:    block.Hash(),
+		Members: members,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return whisper.NewMessage(payload).Wrap(whisper.DefaultPoW, whisper.Options{
+		From:   s.key,
+		TTL:    notificationTTL,
+		Topics: []whisper.Topic{Topic},
+	})
+}
+
+// signups returns the addresses of the members signed up in the block.
+func signups(config *params.ChainConfig, block *types.Block) []common.Address {
+	var (
+		members []common.Address
+		signer  = types.MakeSigner(config, block.Number())
+	)
+	for _, tx := range block.Transactions() {
+		msg, err := tx.AsMessage(signer)
+		if err != nil {
+			continue
+		}
+		if core.IsSignupTransaction(config, msg) && tx.To() != nil {
+			members = append(members, *tx.To())
+		}
+	}
+	return members
+}
@@ -0,0 +1,85 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package signupcast
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/crypto"
+	"github.com/ur-technology/go-ur/params"
+	whisper "github.com/ur-technology/go-ur/whisper/whisperv2"
+)
+
+// Tests that the signups of a block are announced in a notification signed by
+// the node, and that blocks without signups aren't announced.
+func TestSignupNotification(t *testing.T) {
+	var (
+		privileged, _ = crypto.GenerateKey()
+		plain, _      = crypto.GenerateKey()
+		nodeKey, _    = crypto.GenerateKey()
+		members       = []common.Address{{0x01}, {0x02}}
+		signer        = types.HomesteadSigner{}
+	)
+	sender := crypto.PubkeyToAddress(privileged.PublicKey)
+	core.PrivilegedAddressesReceivers[sender] = core.ReceiverAddressPair{}
+	defer delete(core.PrivilegedAddressesReceivers, sender)
+
+	var txs []*types.Transaction
+	for i, member := range members {
+		tx, _ := types.NewTransaction(uint64(i), member, big.NewInt(1), params.TxGas, nil, []byte{1}).SignECDSA(signer, privileged)
+		txs = append(txs, tx)
+	}
+	// Neither a transfer from an unprivileged sender nor one of another value is a signup
+	tx, _ := types.NewTransaction(0, common.Address{0x03}, big.NewInt(1), params.TxGas, nil, []byte{1}).SignECDSA(signer, plain)
+	txs = append(txs, tx)
+	tx, _ = types.NewTransaction(2, common.Address{0x04}, big.NewInt(2), params.TxGas, nil, []byte{1}).SignECDSA(signer, privileged)
+	txs = append(txs, tx)
+
+	s := &Service{config: params.TestChainConfig, key: nodeKey}
+	block := types.NewBlock(&types.Header{Number: big.NewInt(42)}, txs, nil, nil)
+	envelope, err := s.envelope(block)
+	if err != nil || envelope == nil {
+		t.Fatalf("failed to assemble notification: %v, %v", envelope, err)
+	}
+	if !reflect.DeepEqual(envelope.Topics, []whisper.Topic{Topic}) {
+		t.Errorf("topic mismatch: have %v, want %v", envelope.Topics, Topic)
+	}
+	msg, err := envelope.Open(nil)
+	if err != nil {
+		t.Fatalf("failed to open envelope: %v", err)
+	}
+	n, pub, err := DecodeNotification(msg)
+	if err != nil {
+		t.Fatalf("failed to decode notification: %v", err)
+	}
+	if crypto.PubkeyToAddress(*pub) != crypto.PubkeyToAddress(nodeKey.PublicKey) {
+		t.Errorf("signer mismatch")
+	}
+	if n.Block != 42 || n.Hash != block.Hash() || !reflect.DeepEqual(n.Members, members) {
+		t.Errorf("notification mismatch: have %+v, want block 42 (%x) members %v", n, block.Hash(), members)
+	}
+	// A block without signups mustn't be announced
+	block = types.NewBlock(&types.Header{Number: big.NewInt(43)}, txs[2:], nil, nil)
+	if envelope, err := s.envelope(block); envelope != nil || err != nil {
+		t.Errorf("block without signups announced: %v, %v", envelope, err)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"fmt"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/swarm/storage"
+)
+
+// maxAuditManifestSize is the size above which an audited root isn't tried as
+// a manifest, sparing reading large files into memory.
+const maxAuditManifestSize = 4 * 1024 * 1024
+
+// AuditResult is the integrity audit of one tree under an audited root: the
+// root itself, a manifest or a file referenced by a manifest.
+type AuditResult struct {
+	Path     string // Path of the tree in the manifests, empty for the root
+	Key      storage.Key
+	Manifest bool // Whether the tree is a manifest
+	*storage.AuditReport
+}
+
+// Audit verifies the integrity of the content under a root key. If the root is
+// a manifest, the trees of all its entries are audited recursively. The result
+// of every tree is passed to the callback in manifest order.
+func (self *Api) Audit(key storage.Key, cb func(*AuditResult)) error {
+	return self.audit(key, "", true, cb)
+}
+
+func (self *Api) audit(key storage.Key, path string, manifest bool, cb func(*AuditResult)) error {
+	report, err := self.dpa.Audit(key)
+	if err != nil {
+		return err
+	}
+	result := &AuditResult{Path: path, Key: key, AuditReport: report}
+	if !manifest || len(report.Faults) > 0 || report.Size > maxAuditManifestSize {
+		cb(result)
+		return nil
+	}
+	trie, err := loadManifest(self.dpa, key, nil)
+	if err != nil {
+		// The root may be plain content, but entries must be what they claim
+		if path != "" {
+			return fmt.Errorf("manifest %s at %q: %v", key.Log(), path, err)
+		}
+		cb(result)
+		return nil
+	}
+	result.Manifest = true
+	cb(result)
+
+	for _, entry := range trie.entries {
+		if entry == nil {
+			continue
+		}
+		hash := storage.Key(common.Hex2Bytes(entry.Hash))
+		if err := self.audit(hash, path+entry.Path, entry.ContentType == manifestType, cb); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/swarm/storage"
+)
+
+// Tests that auditing an uploaded directory reports every file by its path.
+func TestApiAudit(t *testing.T) {
+	testFileSystem(t, func(fs *FileSystem) {
+		bzzhash, err := fs.Upload(filepath.Join("testdata", "test0"), "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var files []string
+		err = fs.api.Audit(storage.Key(common.Hex2Bytes(bzzhash)), func(result *AuditResult) {
+			if len(result.Faults) > 0 {
+				t.Errorf("%q: unexpected faults: %v", result.Path, result.Faults)
+			}
+			if result.Path == "" && !result.Manifest {
+				t.Errorf("root not recognised as manifest")
+			}
+			if !result.Manifest {
+				files = append(files, result.Path)
+			}
+		})
+		if err != nil {
+			t.Fatalf("audit failed: %v", err)
+		}
+		sort.Strings(files)
+		if want := []string{"img/logo.png", "index.css", "index.html"}; !reflect.DeepEqual(files, want) {
+			t.Errorf("audited files mismatch: have %v, want %v", files, want)
+		}
+		// Plain content must be audited as a single tree
+		var results int
+		wg := new(sync.WaitGroup)
+		key, err := fs.api.Store(strings.NewReader("not a manifest"), 14, wg)
+		if err != nil {
+			t.Fatalf("failed to store content: %v", err)
+		}
+		wg.Wait()
+		fs.api.Audit(key, func(result *AuditResult) {
+			if results++; result.Manifest || result.Chunks != 1 {
+				t.Errorf("plain content audit mismatch: manifest %v, %d chunks", result.Manifest, result.Chunks)
+			}
+		})
+		if results != 1 {
+			t.Errorf("plain content result count mismatch: have %d, want 1", results)
+		}
+	})
+}
@@ -119,6 +119,23 @@ func NewConfig(path string, contract common.Address, prvKey *ecdsa.PrivateKey, n
 	return
 }
 
+// LoadConfig reads the config file of an existing swarm directory, without
+// requiring the account key of the node, for offline access to its stores.
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(filepath.Join(path, "config.json"))
+	if err != nil {
+		return nil, err
+	}
+	self := new(Config)
+	if err := json.Unmarshal(data, self); err != nil {
+		return nil, fmt.Errorf("unable to parse config: %v", err)
+	}
+	if self.StoreParams == nil || self.ChunkerParams == nil {
+		return nil, fmt.Errorf("config %s lacks the store parameters", path)
+	}
+	return self, nil
+}
+
 func (self *Config) Save() error {
 	data, err := json.MarshalIndent(self, "", "    ")
 	if err != nil {
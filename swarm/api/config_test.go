@@ -31,6 +31,8 @@ var (
 	hexprvkey     = "65138b2aa745041b372153550584587da326ab440576b2a1191dd95cee30039c"
 	defaultConfig = `{
     "ChunkDbPath": "` + filepath.Join("TMPDIR", "chunks") + `",
+    "ChunkStore": "leveldb",
+    "ChunkDataPath": "` + filepath.Join("TMPDIR", "chunkdata") + `",
     "DbCapacity": 5000000,
     "CacheCapacity": 5000,
     "Radius": 0,
@@ -0,0 +1,218 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/common/hexutil"
+	"github.com/ur-technology/go-ur/logger"
+	"github.com/ur-technology/go-ur/logger/glog"
+	"github.com/ur-technology/go-ur/rpc"
+	"github.com/ur-technology/go-ur/swarm/storage"
+)
+
+const (
+	replicateKeyBatch   = 1024 // Number of chunk keys reconciled in one request
+	replicateChunkBatch = 256  // Number of chunks transferred in one request
+)
+
+// Replica is the destination of a replication, a node able to tell which chunks
+// it lacks and to accept the missing ones.
+type Replica interface {
+	// Missing returns the subset of the keys not present in the replica.
+	Missing(keys []storage.Key) ([]storage.Key, error)
+
+	// Put stores chunks given by their raw data, keyed by the hash of the data.
+	Put(chunks []hexutil.Bytes) error
+}
+
+// ReplicationStats summarises a replication.
+type ReplicationStats struct {
+	Chunks      int   // Number of distinct chunks in the replicated trees
+	Transferred int   // Number of chunks the replica lacked and was sent
+	Bytes       int64 // Size of the chunk data sent
+}
+
+// Replicate copies the content under a root key to a replica, recursing into
+// manifests. The chunk keys of the trees are reconciled with the replica first,
+// so that only the chunks it lacks are transferred. The content must be intact
+// locally or retrievable from the network.
+func (self *Api) Replicate(key storage.Key, dest Replica) (*ReplicationStats, error) {
+	var (
+		keys  []storage.Key
+		seen  = make(map[string]bool)
+		fault error
+	)
+	err := self.Audit(key, func(result *AuditResult) {
+		if len(result.Faults) > 0 && fault == nil {
+			f := result.Faults[0]
+			fault = fmt.Errorf("chunk %s of %q at offset %d: %v", f.Key.Log(), result.Path, f.Offset, f.Err)
+		}
+		for _, key := range result.Keys {
+			if !seen[string(key)] {
+				seen[string(key)] = true
+				keys = append(keys, key)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if fault != nil {
+		return nil, fault
+	}
+	stats := &ReplicationStats{Chunks: len(keys)}
+	for len(keys) > 0 {
+		n := replicateKeyBatch
+		if n > len(keys) {
+			n = len(keys)
+		}
+		missing, err := dest.Missing(keys[:n])
+		if err != nil {
+			return stats, fmt.Errorf("reconciliation failed: %v", err)
+		}
+		keys = keys[n:]
+
+		for len(missing) > 0 {
+			n := replicateChunkBatch
+			if n > len(missing) {
+				n = len(missing)
+			}
+			chunks := make([]hexutil.Bytes, n)
+			for i, key := range missing[:n] {
+				chunk, err := self.dpa.Get(key)
+				if err != nil {
+					return stats, fmt.Errorf("chunk %s: %v", key.Log(), err)
+				}
+				chunks[i] = chunk.SData
+				stats.Bytes += int64(len(chunk.SData))
+			}
+			if err := dest.Put(chunks); err != nil {
+				return stats, fmt.Errorf("transfer failed: %v", err)
+			}
+			stats.Transferred += n
+			missing = missing[n:]
+		}
+	}
+	glog.V(logger.Debug).Infof("replicated %s: %d chunks, %d transferred (%d bytes)", key.Log(), stats.Chunks, stats.Transferred, stats.Bytes)
+	return stats, nil
+}
+
+// localReplica is a replica backed by the local chunk store of a node.
+type localReplica struct {
+	store storage.ChunkStore
+	hash  storage.Hasher
+}
+
+// NewLocalReplica returns a replica storing chunks in the given chunk store,
+// which mustn't fall back to the network when looking chunks up.
+func NewLocalReplica(store storage.ChunkStore, hash storage.Hasher) Replica {
+	return &localReplica{store, hash}
+}
+
+func (self *localReplica) Missing(keys []storage.Key) ([]storage.Key, error) {
+	var missing []storage.Key
+	for _, key := range keys {
+		if chunk, err := self.store.Get(key); err != nil || chunk.SData == nil {
+			missing = append(missing, key)
+		}
+	}
+	return missing, nil
+}
+
+func (self *localReplica) Put(chunks []hexutil.Bytes) error {
+	for i, data := range chunks {
+		if len(data) < 8 {
+			return fmt.Errorf("chunk %d too short: %d bytes", i, len(data))
+		}
+		hasher := self.hash()
+		hasher.Write(data)
+		chunk := &storage.Chunk{
+			Key:   storage.Key(hasher.Sum(nil)),
+			SData: common.CopyBytes(data),
+			Size:  int64(binary.LittleEndian.Uint64(data[0:8])),
+		}
+		self.store.Put(chunk)
+	}
+	return nil
+}
+
+// rpcReplica is a replica on a remote node reached through its RPC interface.
+type rpcReplica struct {
+	client *rpc.Client
+}
+
+func (self *rpcReplica) Missing(keys []storage.Key) ([]storage.Key, error) {
+	var missing []storage.Key
+	if err := self.client.Call(&missing, "bzz_missingChunks", keys); err != nil {
+		return nil, err
+	}
+	// Only trust the keys that were asked about
+	asked := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		asked[string(key)] = true
+	}
+	for _, key := range missing {
+		if !asked[string(key)] {
+			return nil, fmt.Errorf("replica reported unknown chunk %s", key.Log())
+		}
+	}
+	return missing, nil
+}
+
+func (self *rpcReplica) Put(chunks []hexutil.Bytes) error {
+	return self.client.Call(nil, "bzz_putChunks", chunks)
+}
+
+// Replication is the admin RPC service reconciling and transferring chunks
+// between swarm nodes, used to keep mirrored gateways in sync.
+type Replication struct {
+	api   *Api
+	local Replica
+}
+
+func NewReplication(api *Api, local storage.ChunkStore, hash storage.Hasher) *Replication {
+	return &Replication{api, NewLocalReplica(local, hash)}
+}
+
+// MissingChunks returns the keys of the given chunks not stored locally.
+func (self *Replication) MissingChunks(keys []storage.Key) ([]storage.Key, error) {
+	return self.local.Missing(keys)
+}
+
+// PutChunks stores chunks given by their raw data locally.
+func (self *Replication) PutChunks(chunks []hexutil.Bytes) error {
+	return self.local.Put(chunks)
+}
+
+// Replicate copies the content under rootHash to the node listening on the
+// RPC endpoint, sending only the chunks it lacks.
+func (self *Replication) Replicate(rootHash, endpoint string) (*ReplicationStats, error) {
+	if !hashMatcher.MatchString(rootHash) {
+		return nil, fmt.Errorf("invalid root hash %q", rootHash)
+	}
+	key := storage.Key(common.Hex2Bytes(rootHash))
+	client, err := rpc.Dial(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %v", endpoint, err)
+	}
+	defer client.Close()
+	return self.api.Replicate(key, &rpcReplica{client})
+}
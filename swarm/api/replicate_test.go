@@ -0,0 +1,69 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/swarm/storage"
+)
+
+// Tests that replicating a manifest tree transfers every chunk once, that a
+// second replication transfers nothing, and that the copy is intact.
+func TestApiReplicate(t *testing.T) {
+	testFileSystem(t, func(fs *FileSystem) {
+		testApi(t, func(dst *Api) {
+			bzzhash, err := fs.Upload(filepath.Join("testdata", "test0"), "")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			root := storage.Key(common.Hex2Bytes(bzzhash))
+			replica := NewLocalReplica(dst.dpa.ChunkStore, storage.MakeHashFunc(storage.NewChunkerParams().Hash))
+
+			stats, err := fs.api.Replicate(root, replica)
+			if err != nil {
+				t.Fatalf("replication failed: %v", err)
+			}
+			if stats.Chunks == 0 || stats.Transferred != stats.Chunks {
+				t.Errorf("first replication mismatch: %d chunks, %d transferred", stats.Chunks, stats.Transferred)
+			}
+			stats, err = fs.api.Replicate(root, replica)
+			if err != nil {
+				t.Fatalf("repeated replication failed: %v", err)
+			}
+			if stats.Transferred != 0 || stats.Bytes != 0 {
+				t.Errorf("repeated replication transferred %d chunks, %d bytes", stats.Transferred, stats.Bytes)
+			}
+			var have, want int
+			fs.api.Audit(root, func(*AuditResult) { want++ })
+			err = dst.Audit(root, func(result *AuditResult) {
+				have++
+				if len(result.Faults) > 0 {
+					t.Errorf("%q: replica faults: %v", result.Path, result.Faults)
+				}
+			})
+			if err != nil {
+				t.Fatalf("replica audit failed: %v", err)
+			}
+			if have != want {
+				t.Errorf("replica tree count mismatch: have %d, want %d", have, want)
+			}
+		})
+	})
+}
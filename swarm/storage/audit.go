@@ -0,0 +1,114 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var (
+	ErrChunkMissing   = errors.New("chunk missing")
+	ErrChunkCorrupted = errors.New("chunk corrupted")
+)
+
+// AuditFault is a chunk of a tree failing the integrity audit.
+type AuditFault struct {
+	Key    Key   // Key of the faulty chunk
+	Offset int64 // Offset of the data covered by the chunk within the tree
+	Err    error // ErrChunkMissing or ErrChunkCorrupted
+}
+
+// AuditReport is the outcome of auditing a chunk tree.
+type AuditReport struct {
+	Size   int64 // Size of the data covered by the tree, zero if the root is faulty
+	Chunks int   // Number of chunks found intact
+	Keys   []Key // Keys of the intact chunks, in tree order
+	Faults []*AuditFault
+}
+
+// Auditor is implemented by the chunkers able to verify the integrity of the
+// trees they produce.
+type Auditor interface {
+	Audit(key Key, store ChunkStore) *AuditReport
+}
+
+// Audit walks the tree rooted at key, retrieving every chunk from the store and
+// re-hashing it. The subtrees of missing or corrupted chunks are not visited.
+func (self *TreeChunker) Audit(key Key, store ChunkStore) *AuditReport {
+	report := new(AuditReport)
+	if chunk := self.auditChunk(key, 0, -1, store, report); chunk != nil {
+		report.Size = chunk.Size
+	}
+	return report
+}
+
+// auditChunk checks a chunk expected to cover size bytes (any size if negative)
+// at the given offset, then descends into its children. It returns the chunk if
+// intact, nil otherwise.
+func (self *TreeChunker) auditChunk(key Key, offset, size int64, store ChunkStore, report *AuditReport) *Chunk {
+	fault := func(err error) *Chunk {
+		report.Faults = append(report.Faults, &AuditFault{Key: key, Offset: offset, Err: err})
+		return nil
+	}
+	chunk, err := store.Get(key)
+	if err == notFound {
+		return fault(ErrChunkMissing)
+	}
+	if err != nil || len(chunk.SData) < 8 {
+		return fault(ErrChunkCorrupted)
+	}
+	hasher := self.hashFunc()
+	hasher.Write(chunk.SData)
+	if !bytes.Equal(hasher.Sum(nil), key) {
+		return fault(ErrChunkCorrupted)
+	}
+	chunk.Size = int64(binary.LittleEndian.Uint64(chunk.SData[0:8]))
+	if size >= 0 && chunk.Size != size {
+		return fault(ErrChunkCorrupted)
+	}
+	// Find the level of the chunk the same way the chunker does
+	depth, treeSize := 0, self.chunkSize
+	for ; treeSize < chunk.Size; treeSize *= self.branches {
+		depth++
+	}
+	if depth == 0 {
+		if int64(len(chunk.SData)) != 8+chunk.Size {
+			return fault(ErrChunkCorrupted)
+		}
+		report.Chunks++
+		report.Keys = append(report.Keys, key)
+		return chunk
+	}
+	treeSize /= self.branches
+	branchCnt := (chunk.Size + treeSize - 1) / treeSize
+	if int64(len(chunk.SData)) != 8+branchCnt*self.hashSize {
+		return fault(ErrChunkCorrupted)
+	}
+	report.Chunks++
+	report.Keys = append(report.Keys, key)
+	for i := int64(0); i < branchCnt; i++ {
+		secSize := treeSize
+		if chunk.Size-i*treeSize < treeSize {
+			secSize = chunk.Size - i*treeSize
+		}
+		child := Key(chunk.SData[8+i*self.hashSize : 8+(i+1)*self.hashSize])
+		self.auditChunk(child, offset+i*treeSize, secSize, store, report)
+	}
+	return chunk
+}
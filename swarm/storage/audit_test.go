@@ -0,0 +1,102 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"sync"
+	"testing"
+)
+
+// mapChunkStore is a chunk store without integrity checks, storing the chunks
+// by key in a map.
+type mapChunkStore struct {
+	chunks map[string]*Chunk
+	lock   sync.Mutex
+}
+
+func (m *mapChunkStore) Put(chunk *Chunk) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.chunks[string(chunk.Key)] = chunk
+}
+
+func (m *mapChunkStore) Get(key Key) (*Chunk, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if chunk, ok := m.chunks[string(key)]; ok {
+		return chunk, nil
+	}
+	return nil, notFound
+}
+
+// Tests that the audit of a tree visits every chunk, and reports the missing
+// and corrupted ones without descending into their subtrees.
+func TestTreeChunkerAudit(t *testing.T) {
+	const size = 3*512 + 100 // three full 512 byte subtrees and a lone leaf at the top level
+
+	store := &mapChunkStore{chunks: make(map[string]*Chunk)}
+	chunker := NewTreeChunker(&ChunkerParams{Branches: 4, Hash: defaultHash})
+
+	chunkC := make(chan *Chunk)
+	swg := new(sync.WaitGroup)
+	go func() {
+		for chunk := range chunkC {
+			store.Put(chunk)
+			chunk.wg.Done()
+		}
+	}()
+	key, err := chunker.Split(testDataReader(size), size, chunkC, swg, nil)
+	swg.Wait()
+	close(chunkC)
+	if err != nil {
+		t.Fatalf("failed to split: %v", err)
+	}
+	total := len(store.chunks)
+
+	report := chunker.Audit(key, store)
+	if report.Size != size || report.Chunks != total || len(report.Faults) != 0 {
+		t.Fatalf("intact audit mismatch: have size %d, %d chunks, %d faults; want %d, %d, 0", report.Size, report.Chunks, len(report.Faults), size, total)
+	}
+	// Drop the second top level subtree and corrupt a leaf of the third one
+	root := store.chunks[string(key)]
+	missing := Key(root.SData[8+32 : 8+64])
+	delete(store.chunks, string(missing))
+
+	branch := store.chunks[string(root.SData[8+64:8+96])]
+	leaf := store.chunks[string(branch.SData[8+32:8+64])]
+	store.chunks[string(leaf.Key)] = &Chunk{Key: leaf.Key, SData: append([]byte{0xff}, leaf.SData[1:]...)}
+
+	report = chunker.Audit(key, store)
+	if len(report.Faults) != 2 {
+		t.Fatalf("fault count mismatch: have %d, want 2", len(report.Faults))
+	}
+	if fault := report.Faults[0]; fault.Err != ErrChunkMissing || !fault.Key.isEqual(missing) || fault.Offset != 512 {
+		t.Errorf("missing fault mismatch: have %v at %d (%x), want %v at 512 (%x)", fault.Err, fault.Offset, fault.Key, ErrChunkMissing, missing)
+	}
+	if fault := report.Faults[1]; fault.Err != ErrChunkCorrupted || !fault.Key.isEqual(leaf.Key) || fault.Offset != 1024+128 {
+		t.Errorf("corrupted fault mismatch: have %v at %d (%x), want %v at 1152 (%x)", fault.Err, fault.Offset, fault.Key, ErrChunkCorrupted, leaf.Key)
+	}
+	// The dropped subtree holds a branch chunk and its four leaves
+	if want := total - 5 - 1; report.Chunks != want {
+		t.Errorf("intact chunk count mismatch: have %d, want %d", report.Chunks, want)
+	}
+	// A missing root must be reported as a single fault
+	delete(store.chunks, string(key))
+	if report = chunker.Audit(key, store); report.Size != 0 || len(report.Faults) != 1 || report.Faults[0].Err != ErrChunkMissing {
+		t.Errorf("missing root audit mismatch: have size %d, faults %v", report.Size, report.Faults)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// Chunk store backends, selecting where the DbStore keeps the chunk data. The
+// index, access counters and sync state always live in LevelDB.
+const (
+	ChunkStoreLevelDB = "leveldb" // chunk data stored in the LevelDB database
+	ChunkStoreFiles   = "files"   // one file per chunk in a directory tree
+)
+
+// chunkData is the storage of the chunk data of a DbStore. Chunks are addressed
+// both by key and by the storage index assigned by the DbStore, leaving the
+// choice of naming to the backend. Modifications to the index are passed in
+// batch, so that backends keeping the data in LevelDB update both atomically.
+type chunkData interface {
+	put(batch *leveldb.Batch, key Key, idx uint64, data []byte) error
+	get(key Key, idx uint64) ([]byte, error)
+	delete(batch *leveldb.Batch, key Key, idx uint64)
+}
+
+// ldbChunkData keeps the chunk data in the LevelDB database of the index.
+type ldbChunkData struct {
+	db *LDBDatabase
+}
+
+func (d *ldbChunkData) put(batch *leveldb.Batch, key Key, idx uint64, data []byte) error {
+	batch.Put(getDataKey(idx), data)
+	return nil
+}
+
+func (d *ldbChunkData) get(key Key, idx uint64) ([]byte, error) {
+	return d.db.Get(getDataKey(idx))
+}
+
+func (d *ldbChunkData) delete(batch *leveldb.Batch, key Key, idx uint64) {
+	batch.Delete(getDataKey(idx))
+}
+
+// fileChunkData keeps every chunk in its own file named by the hex chunk key,
+// spread over subdirectories by the first key byte to keep directories small.
+// Files are written before the index referencing them, so that the index never
+// points to partially written data.
+type fileChunkData struct {
+	dir string
+}
+
+func newFileChunkData(dir string) (*fileChunkData, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &fileChunkData{dir: dir}, nil
+}
+
+// path returns the file of a chunk.
+func (d *fileChunkData) path(key Key) string {
+	name := hex.EncodeToString(key)
+	if len(name) < 2 {
+		return filepath.Join(d.dir, name)
+	}
+	return filepath.Join(d.dir, name[:2], name)
+}
+
+func (d *fileChunkData) put(batch *leveldb.Batch, key Key, idx uint64, data []byte) error {
+	path := d.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	// Write to a temporary file first, as renames are atomic
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (d *fileChunkData) get(key Key, idx uint64) ([]byte, error) {
+	return ioutil.ReadFile(d.path(key))
+}
+
+func (d *fileChunkData) delete(batch *leveldb.Batch, key Key, idx uint64) {
+	os.Remove(d.path(key))
+}
@@ -23,6 +23,8 @@ import (
 	"hash"
 	"io"
 	"sync"
+
+	"github.com/ur-technology/go-ur/common/workers"
 )
 
 /*
@@ -119,7 +121,7 @@ func (self *TreeChunker) Split(data io.Reader, size int64, chunkC chan *Chunk, s
 		panic("chunker must be initialised")
 	}
 
-	jobC := make(chan *hashJob, 2*processors)
+	jobC := make(chan *hashJob, 2*workers.Limit())
 	wg := &sync.WaitGroup{}
 	errC := make(chan error)
 	quitC := make(chan bool)
@@ -224,7 +226,7 @@ func (self *TreeChunker) split(depth int, treeSize int64, key Key, data io.Reade
 	// parentWg.Add(1)
 	// go func() {
 	childrenWg.Wait()
-	if len(jobC) > self.workerCount && self.workerCount < processors {
+	if len(jobC) > self.workerCount && self.workerCount < workers.Limit() {
 		if wwg != nil {
 			wwg.Add(1)
 		}
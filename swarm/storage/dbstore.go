@@ -61,7 +61,8 @@ type gcItem struct {
 }
 
 type DbStore struct {
-	db *LDBDatabase
+	db   *LDBDatabase
+	data chunkData // storage of the chunk data, the index being kept in db
 
 	// this should be stored in db, accessed transactionally
 	entryCnt, accessCnt, dataIdx, capacity uint64
@@ -74,7 +75,24 @@ type DbStore struct {
 	lock sync.Mutex
 }
 
+// NewDbStore creates a chunk store keeping both the index and the chunk data in
+// the LevelDB database at path.
 func NewDbStore(path string, hash Hasher, capacity uint64, radius int) (s *DbStore, err error) {
+	return newDbStore(path, nil, hash, capacity, radius)
+}
+
+// NewFileDbStore creates a chunk store keeping the index in the LevelDB database
+// at path and every chunk in its own file below dataPath, e.g. on mounts where
+// LevelDB performs poorly.
+func NewFileDbStore(path, dataPath string, hash Hasher, capacity uint64, radius int) (s *DbStore, err error) {
+	data, err := newFileChunkData(dataPath)
+	if err != nil {
+		return nil, err
+	}
+	return newDbStore(path, data, hash, capacity, radius)
+}
+
+func newDbStore(path string, chunks chunkData, hash Hasher, capacity uint64, radius int) (s *DbStore, err error) {
 	s = new(DbStore)
 
 	s.hashfunc = hash
@@ -83,6 +101,10 @@ func NewDbStore(path string, hash Hasher, capacity uint64, radius int) (s *DbSto
 	if err != nil {
 		return
 	}
+	s.data = chunks
+	if s.data == nil {
+		s.data = &ldbChunkData{s.db}
+	}
 
 	s.setCapacity(capacity)
 
@@ -227,7 +249,7 @@ func (s *DbStore) collectGarbage(ratio float32) {
 		}
 
 		gci := new(gcItem)
-		gci.idxKey = s.gcPos
+		gci.idxKey = append([]byte(nil), s.gcPos...) // the iterator may reuse its key buffer
 		var index dpaDBIndex
 		decodeIndex(it.Value(), &index)
 		gci.idx = index.Idx
@@ -254,7 +276,7 @@ func (s *DbStore) collectGarbage(ratio float32) {
 		if s.gcArray[i].value <= cutval {
 			batch := new(leveldb.Batch)
 			batch.Delete(s.gcArray[i].idxKey)
-			batch.Delete(getDataKey(s.gcArray[i].idx))
+			s.data.delete(batch, Key(s.gcArray[i].idxKey[1:]), s.gcArray[i].idx)
 			s.entryCnt--
 			batch.Put(keyEntryCnt, U64ToBytes(s.entryCnt))
 			s.db.Write(batch)
@@ -295,7 +317,13 @@ func (s *DbStore) Put(chunk *Chunk) {
 
 	batch := new(leveldb.Batch)
 
-	batch.Put(getDataKey(s.dataIdx), data)
+	if err := s.data.put(batch, chunk.Key, s.dataIdx, data); err != nil {
+		glog.V(logger.Error).Infof("DbStore.Put: failed to store chunk %v: %v", chunk.Key.Log(), err)
+		if chunk.dbStored != nil {
+			close(chunk.dbStored)
+		}
+		return
+	}
 
 	index.Idx = s.dataIdx
 	s.updateIndexAccess(&index)
@@ -346,7 +374,7 @@ func (s *DbStore) Get(key Key) (chunk *Chunk, err error) {
 
 	if s.tryAccessIdx(getIndexKey(key), &index) {
 		var data []byte
-		data, err = s.db.Get(getDataKey(index.Idx))
+		data, err = s.data.get(key, index.Idx)
 		if err != nil {
 			return
 		}
@@ -355,7 +383,9 @@ func (s *DbStore) Get(key Key) (chunk *Chunk, err error) {
 		hasher.Write(data)
 		hash := hasher.Sum(nil)
 		if bytes.Compare(hash, key) != 0 {
-			s.db.Delete(getDataKey(index.Idx))
+			batch := new(leveldb.Batch)
+			s.data.delete(batch, key, index.Idx)
+			s.db.Write(batch)
 			err = fmt.Errorf("invalid chunk. hash=%x, key=%v", hash, key[:])
 			return
 		}
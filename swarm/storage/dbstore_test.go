@@ -18,7 +18,10 @@ package storage
 
 import (
 	"bytes"
+	"encoding/binary"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/ur-technology/go-ur/common"
@@ -189,3 +192,102 @@ func TestDbStoreSyncIterator(t *testing.T) {
 		t.Fatalf("Expected %v chunk, got %v", keys[3], res[0])
 	}
 }
+
+func initFileDbStore(t *testing.T) (*DbStore, string) {
+	dir, err := ioutil.TempDir("", "bzz-storage-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewFileDbStore(filepath.Join(dir, "chunks"), filepath.Join(dir, "chunkdata"), MakeHashFunc(defaultHash), defaultDbCapacity, defaultRadius)
+	if err != nil {
+		t.Fatal("can't create store:", err)
+	}
+	return m, dir
+}
+
+func TestFileDbStore128_10000_(t *testing.T) {
+	m, dir := initFileDbStore(t)
+	defer os.RemoveAll(dir)
+	defer m.close()
+	testStore(m, 10000, 128, t)
+}
+
+// Tests that the chunk files are written one per chunk, survive reopening the
+// store and are removed by garbage collection.
+func TestFileDbStoreFiles(t *testing.T) {
+	m, dir := initFileDbStore(t)
+	defer os.RemoveAll(dir)
+
+	hasher := MakeHashFunc(defaultHash)
+	chunks := make([]*Chunk, 20)
+	for i := range chunks {
+		data := make([]byte, 8+i)
+		binary.LittleEndian.PutUint64(data, uint64(i))
+		h := hasher()
+		h.Write(data)
+		chunks[i] = &Chunk{Key: h.Sum(nil), SData: data, Size: int64(i)}
+		m.Put(chunks[i])
+	}
+	count := func() (files int) {
+		filepath.Walk(filepath.Join(dir, "chunkdata"), func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				files++
+			}
+			return nil
+		})
+		return files
+	}
+	if files := count(); files != len(chunks) {
+		t.Fatalf("chunk file count mismatch: have %d, want %d", files, len(chunks))
+	}
+	m.close()
+
+	if m, err := NewFileDbStore(filepath.Join(dir, "chunks"), filepath.Join(dir, "chunkdata"), hasher, defaultDbCapacity, defaultRadius); err != nil {
+		t.Fatal("can't reopen store:", err)
+	} else {
+		defer m.close()
+		for i, chunk := range chunks {
+			have, err := m.Get(chunk.Key)
+			if err != nil {
+				t.Fatalf("chunk %d: failed to retrieve: %v", i, err)
+			}
+			if !bytes.Equal(have.SData, chunk.SData) || have.Size != chunk.Size {
+				t.Errorf("chunk %d: data mismatch: have %x, want %x", i, have.SData, chunk.SData)
+			}
+		}
+		// Shrinking the store must remove the collected chunk files too
+		m.setCapacity(10)
+		stored := 0
+		for _, chunk := range chunks {
+			if _, err := m.Get(chunk.Key); err == nil {
+				stored++
+			}
+		}
+		if files := count(); files != stored || stored >= len(chunks) {
+			t.Errorf("chunk files mismatch after garbage collection: have %d files, %d chunks stored", files, stored)
+		}
+	}
+}
+
+func TestLocalStoreBackends(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bzz-storage-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	params := NewStoreParams(dir)
+	params.ChunkStore = "unknown"
+	if _, err := NewLocalStore(MakeHashFunc(defaultHash), params); err == nil {
+		t.Errorf("unknown chunk store accepted")
+	}
+	params.ChunkStore = ChunkStoreFiles
+	store, err := NewLocalStore(MakeHashFunc(defaultHash), params)
+	if err != nil {
+		t.Fatalf("failed to create file backed store: %v", err)
+	}
+	if _, ok := store.DbStore.(*DbStore).data.(*fileChunkData); !ok {
+		t.Errorf("chunk data backend mismatch: have %T", store.DbStore.(*DbStore).data)
+	}
+	store.DbStore.(*DbStore).close()
+}
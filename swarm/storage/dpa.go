@@ -101,6 +101,16 @@ func (self *DPA) Store(data io.Reader, size int64, swg *sync.WaitGroup, wwg *syn
 	return self.Chunker.Split(data, size, self.storeC, swg, wwg)
 }
 
+// Audit verifies the integrity of the tree rooted at key in the chunk store of
+// the DPA.
+func (self *DPA) Audit(key Key) (*AuditReport, error) {
+	auditor, ok := self.Chunker.(Auditor)
+	if !ok {
+		return nil, errors.New("chunker doesn't support audits")
+	}
+	return auditor.Audit(key, self.ChunkStore), nil
+}
+
 func (self *DPA) Start() {
 	self.lock.Lock()
 	defer self.lock.Unlock()
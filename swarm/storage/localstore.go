@@ -18,6 +18,7 @@ package storage
 
 import (
 	"encoding/binary"
+	"fmt"
 )
 
 // LocalStore is a combination of inmemory db over a disk persisted db
@@ -27,9 +28,21 @@ type LocalStore struct {
 	DbStore  ChunkStore
 }
 
-// This constructor uses MemStore and DbStore as components
+// This constructor uses MemStore and DbStore as components, the DbStore keeping
+// the chunk data in the backend selected by params.ChunkStore
 func NewLocalStore(hash Hasher, params *StoreParams) (*LocalStore, error) {
-	dbStore, err := NewDbStore(params.ChunkDbPath, hash, params.DbCapacity, params.Radius)
+	var (
+		dbStore *DbStore
+		err     error
+	)
+	switch params.ChunkStore {
+	case "", ChunkStoreLevelDB:
+		dbStore, err = NewDbStore(params.ChunkDbPath, hash, params.DbCapacity, params.Radius)
+	case ChunkStoreFiles:
+		dbStore, err = NewFileDbStore(params.ChunkDbPath, params.ChunkDataPath, hash, params.DbCapacity, params.Radius)
+	default:
+		err = fmt.Errorf("unknown chunk store %q, must be %q or %q", params.ChunkStore, ChunkStoreLevelDB, ChunkStoreFiles)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -54,6 +54,8 @@ type CloudStore interface {
 
 type StoreParams struct {
 	ChunkDbPath   string
+	ChunkStore    string // backend of the chunk data, ChunkStoreLevelDB or ChunkStoreFiles
+	ChunkDataPath string // directory of the chunk files of the ChunkStoreFiles backend
 	DbCapacity    uint64
 	CacheCapacity uint
 	Radius        int
@@ -62,6 +64,8 @@ type StoreParams struct {
 func NewStoreParams(path string) (self *StoreParams) {
 	return &StoreParams{
 		ChunkDbPath:   filepath.Join(path, "chunks"),
+		ChunkStore:    ChunkStoreLevelDB,
+		ChunkDataPath: filepath.Join(path, "chunkdata"),
 		DbCapacity:    defaultDbCapacity,
 		CacheCapacity: defaultCacheCapacity,
 		Radius:        defaultRadius,
@@ -25,10 +25,7 @@ import (
 	"sync"
 
 	"github.com/ur-technology/go-ur/common"
-)
-
-const (
-	processors = 8
+	"github.com/ur-technology/go-ur/common/workers"
 )
 
 type Tree struct {
@@ -90,6 +87,7 @@ func (self *PyramidChunker) Split(data io.Reader, size int64, chunkC chan *Chunk
 		results.Levels[i] = make(map[int64]*Node)
 	}
 	// Create a pool of workers to crunch through the file
+	processors := workers.Limit()
 	tasks := make(chan *Task, 2*processors)
 	pend := new(sync.WaitGroup)
 	abortC := make(chan bool)
@@ -45,6 +45,7 @@ type Swarm struct {
 	api         *api.Api               // high level api layer (fs/manifest)
 	dns         api.Resolver           // DNS registrar
 	dbAccess    *network.DbAccess      // access to local chunk db iterator and storage counter
+	lstore      *storage.LocalStore    // local chunk store, without network fallback
 	storage     storage.ChunkStore     // internal access to storage, common interface to cloud storage backends
 	dpa         *storage.DPA           // distributed preimage archive, the local API to the storage with document level storage/retrieval support
 	depo        network.StorageHandler // remote request handler, interface between bzz protocol and the storage
@@ -96,6 +97,7 @@ func NewSwarm(ctx *node.ServiceContext, backend chequebook.Backend, config *api.
 	// setup local store
 	glog.V(logger.Debug).Infof("Set up local storage")
 
+	self.lstore = lstore
 	self.dbAccess = network.NewDbAccess(lstore)
 	glog.V(logger.Debug).Infof("Set up local db access (iterator/counter)")
 
@@ -245,6 +247,12 @@ func (self *Swarm) APIs() []rpc.API {
 			Service:   api.NewControl(self.api, self.hive),
 			Public:    false,
 		},
+		{
+			Namespace: "bzz",
+			Version:   "0.1",
+			Service:   api.NewReplication(self.api, self.lstore, storage.MakeHashFunc(self.config.ChunkerParams.Hash)),
+			Public:    false,
+		},
 		{
 			Namespace: "chequebook",
 			Version:   chequebook.Version,
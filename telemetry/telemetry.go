@@ -0,0 +1,233 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package telemetry implements the opt-in anonymized node statistics reporting
+// service.
+package telemetry
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"runtime"
+	"time"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/crypto"
+	"github.com/ur-technology/go-ur/eth"
+	"github.com/ur-technology/go-ur/eth/downloader"
+	"github.com/ur-technology/go-ur/les"
+	"github.com/ur-technology/go-ur/logger"
+	"github.com/ur-technology/go-ur/logger/glog"
+	"github.com/ur-technology/go-ur/p2p"
+	"github.com/ur-technology/go-ur/params"
+	"github.com/ur-technology/go-ur/rpc"
+)
+
+const (
+	reportInterval = time.Hour        // Time interval between two consecutive reports
+	reportTimeout  = 30 * time.Second // Maximum time allowed for a single report upload
+)
+
+// Service implements a telemetry daemon that periodically pushes anonymized
+// statistics about the local node up to a collection endpoint. Reports are
+// signed with a dedicated identity key, unrelated to the node's p2p key, so the
+// endpoint can tell nodes apart without learning anything about them.
+type Service struct {
+	server *p2p.Server        // Peer-to-peer server to retrieve the peer count
+	eth    *eth.Ethereum      // Full Ethereum service if reporting a full node
+	les    *les.LightEthereum // Light Ethereum service if reporting a light node
+
+	url    string            // HTTPS endpoint to submit the reports to
+	key    *ecdsa.PrivateKey // Identity key to sign the reports with
+	client *http.Client      // HTTP client to submit the reports with
+	quit   chan struct{}     // Channel to signal the reporting loop to terminate
+}
+
+// Report is the set of anonymized statistics submitted to the telemetry endpoint.
+type Report struct {
+	Id      common.Address `json:"id"`      // Address derived from the telemetry identity key
+	Version string         `json:"version"` // Client version string
+	OS      string         `json:"os"`      // Operating system the node runs on
+	Arch    string         `json:"arch"`    // Processor architecture the node runs on
+	Go      string         `json:"go"`      // Go runtime version the node was built with
+	Light   bool           `json:"light"`   // Whether the node is a light client
+	Peers   int            `json:"peers"`   // Number of connected peers
+	Syncing bool           `json:"syncing"` // Whether the node is currently synchronising
+	Head    uint64         `json:"head"`    // Number of the current head block
+	Highest uint64         `json:"highest"` // Highest block number known from the network
+	Time    int64          `json:"time"`    // Unix timestamp of the report
+}
+
+// envelope is the signed wrapper around a report submitted to the endpoint.
+type envelope struct {
+	Report    json.RawMessage `json:"report"`
+	Signature string          `json:"signature"`
+}
+
+// New returns a telemetry service ready for reporting to the given endpoint. The
+// identity key is loaded from keyfile, generating and persisting a new one if it
+// doesn't exist yet. An empty keyfile results in an ephemeral identity.
+func New(endpoint string, keyfile string, ethServ *eth.Ethereum, lesServ *les.LightEthereum) (*Service, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid telemetry url: %v", err)
+	}
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid telemetry url: \"%s\", reports are only sent over https", endpoint)
+	}
+	if ethServ == nil && lesServ == nil {
+		return nil, errors.New("telemetry requires an Ethereum service")
+	}
+	key, err := loadIdentity(keyfile)
+	if err != nil {
+		return nil, err
+	}
+	return &Service{
+		eth:    ethServ,
+		les:    lesServ,
+		url:    endpoint,
+		key:    key,
+		client: &http.Client{Timeout: reportTimeout},
+		quit:   make(chan struct{}),
+	}, nil
+}
+
+// loadIdentity loads the telemetry identity key from the given file, generating
+// and storing a new one if none can be found.
+func loadIdentity(keyfile string) (*ecdsa.PrivateKey, error) {
+	if keyfile == "" {
+		return crypto.GenerateKey()
+	}
+	if key, err := crypto.LoadECDSA(keyfile); err == nil {
+		return key, nil
+	}
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := crypto.SaveECDSA(keyfile, key); err != nil {
+		glog.V(logger.Warn).Infof("Failed to persist telemetry identity: %v", err)
+	}
+	return key, nil
+}
+
+// Protocols implements node.Service, returning the P2P network protocols used
+// by the telemetry service (nil as it doesn't use the devp2p overlay network).
+func (s *Service) Protocols() []p2p.Protocol { return nil }
+
+// APIs implements node.Service, returning the RPC API endpoints provided by the
+// telemetry service (nil as it doesn't provide any user callable APIs).
+func (s *Service) APIs() []rpc.API { return nil }
+
+// Start implements node.Service, starting up the reporting daemon.
+func (s *Service) Start(server *p2p.Server) error {
+	s.server = server
+	go s.loop()
+
+	glog.V(logger.Info).Infof("Telemetry daemon started, identity %x", s.identity())
+	return nil
+}
+
+// Stop implements node.Service, terminating the reporting daemon.
+func (s *Service) Stop() error {
+	close(s.quit)
+	glog.V(logger.Info).Infoln("Telemetry daemon stopped")
+	return nil
+}
+
+// identity returns the anonymous identifier of the local node.
+func (s *Service) identity() common.Address {
+	return crypto.PubkeyToAddress(s.key.PublicKey)
+}
+
+// loop submits a report right after startup and then periodically until
+// termination.
+func (s *Service) loop() {
+	ticker := time.NewTicker(reportInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.submit(s.assemble()); err != nil {
+			glog.V(logger.Debug).Infof("Telemetry report failed: %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// assemble gathers the current statistics of the local node.
+func (s *Service) assemble() *Report {
+	report := &Report{
+		Id:      s.identity(),
+		Version: params.Version,
+		OS:      runtime.GOOS,
+		Arch:    runtime.GOARCH,
+		Go:      runtime.Version(),
+		Light:   s.eth == nil,
+		Time:    time.Now().Unix(),
+	}
+	if s.server != nil {
+		report.Peers = s.server.PeerCount()
+	}
+	var sync *downloader.Downloader
+	if s.eth != nil {
+		report.Head = s.eth.BlockChain().CurrentBlock().NumberU64()
+		sync = s.eth.Downloader()
+	} else {
+		report.Head = s.les.BlockChain().CurrentHeader().Number.Uint64()
+		sync = s.les.Downloader()
+	}
+	report.Syncing = sync.Synchronising()
+	report.Highest = sync.Progress().HighestBlock
+	if report.Highest < report.Head {
+		report.Highest = report.Head
+	}
+	return report
+}
+
+// submit signs the report with the identity key and uploads it to the endpoint.
+func (s *Service) submit(report *Report) error {
+	blob, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	sig, err := crypto.Sign(crypto.Keccak256(blob), s.key)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(&envelope{Report: blob, Signature: common.ToHex(sig)})
+	if err != nil {
+		return err
+	}
+	res, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response status: %s", res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package telemetry
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/crypto"
+)
+
+// Tests that the telemetry identity is persisted and reused across restarts.
+func TestIdentityPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "telemetry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyfile := filepath.Join(dir, "telemetrykey")
+	first, err := loadIdentity(keyfile)
+	if err != nil {
+		t.Fatalf("failed to create identity: %v", err)
+	}
+	second, err := loadIdentity(keyfile)
+	if err != nil {
+		t.Fatalf("failed to load identity: %v", err)
+	}
+	if crypto.PubkeyToAddress(first.PublicKey) != crypto.PubkeyToAddress(second.PublicKey) {
+		t.Errorf("identity changed across loads")
+	}
+}
+
+// Tests that only HTTPS endpoints are accepted for reporting.
+func TestEndpointValidation(t *testing.T) {
+	for _, endpoint := range []string{"http://example.com/report", "example.com/report", "ws://example.com"} {
+		if _, err := New(endpoint, "", nil, nil); err == nil || !strings.Contains(err.Error(), "https") {
+			t.Errorf("endpoint %q: have error %v, want https rejection", endpoint, err)
+		}
+	}
+}
+
+// Tests that submitted reports are signed by the telemetry identity.
+func TestSignedSubmission(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+
+	received := make(chan *envelope, 1)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		env := new(envelope)
+		if err := json.NewDecoder(r.Body).Decode(env); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		received <- env
+	}))
+	defer server.Close()
+
+	s := &Service{url: server.URL, key: key, client: server.Client()}
+	if err := s.submit(&Report{Id: s.identity(), Version: "test", Peers: 3}); err != nil {
+		t.Fatalf("failed to submit report: %v", err)
+	}
+	env := <-received
+
+	pubkey, err := crypto.Ecrecover(crypto.Keccak256(env.Report), common.FromHex(env.Signature))
+	if err != nil {
+		t.Fatalf("failed to recover signer: %v", err)
+	}
+	signer := common.BytesToAddress(crypto.Keccak256(pubkey[1:])[12:])
+
+	var report Report
+	if err := json.Unmarshal(env.Report, &report); err != nil {
+		t.Fatalf("failed to decode report: %v", err)
+	}
+	if signer != report.Id || signer != s.identity() {
+		t.Errorf("signer mismatch: have %x, want %x", signer, s.identity())
+	}
+	if report.Peers != 3 {
+		t.Errorf("peer count mismatch: have %d, want %d", report.Peers, 3)
+	}
+}
@@ -52,6 +52,12 @@ func (it *Iterator) Next() bool {
 	return false
 }
 
+// Err returns the failure that terminated the iteration, if any. A nil error
+// after Next returned false means the entire trie was traversed.
+func (it *Iterator) Err() error {
+	return it.nodeIt.Error
+}
+
 func (it *Iterator) makeKey() []byte {
 	key := it.keyBuf[:0]
 	for _, se := range it.nodeIt.stack {
@@ -112,6 +112,39 @@ func mustDecodeNode(hash, buf []byte, cachegen uint16) node {
 	return n
 }
 
+// NodeChildren decodes the RLP encoding of a trie node, returning the hashes of
+// the nodes it references and the values it holds, looking into the children
+// embedded in it too.
+func NodeChildren(buf []byte) ([]common.Hash, [][]byte, error) {
+	n, err := decodeNode(nil, buf, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	var (
+		hashes []common.Hash
+		values [][]byte
+	)
+	var walk func(n node)
+	walk = func(n node) {
+		switch n := n.(type) {
+		case *shortNode:
+			walk(n.Val)
+		case *fullNode:
+			for _, child := range n.Children {
+				if child != nil {
+					walk(child)
+				}
+			}
+		case hashNode:
+			hashes = append(hashes, common.BytesToHash(n))
+		case valueNode:
+			values = append(values, n)
+		}
+	}
+	walk(n)
+	return hashes, values, nil
+}
+
 // decodeNode parses the RLP encoding of a trie node.
 func decodeNode(hash, buf []byte, cachegen uint16) (node, error) {
 	if len(buf) == 0 {
@@ -0,0 +1,318 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package urext implements the UR specific extensions of the wire protocol.
+// Every extension is negotiated as a separate devp2p capability with its own
+// versions, so that nodes lacking an extension, or speaking another version of
+// it, keep interoperating on the base protocols during rollouts.
+package urext
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core"
+	"github.com/ur-technology/go-ur/eth"
+	"github.com/ur-technology/go-ur/logger"
+	"github.com/ur-technology/go-ur/logger/glog"
+	"github.com/ur-technology/go-ur/p2p"
+	"github.com/ur-technology/go-ur/p2p/discover"
+	"github.com/ur-technology/go-ur/rpc"
+	"github.com/ur-technology/go-ur/signupcast"
+)
+
+// Capability names of the extensions.
+const (
+	RewardSpecName  = "urspec"   // Exchange of the reward spec hashes
+	SignupTopicName = "ursignup" // Advertisement of the whisper signup topic
+)
+
+// Supported versions of the extensions (first is primary).
+var (
+	RewardSpecVersions  = []uint{1}
+	SignupTopicVersions = []uint{1}
+)
+
+const (
+	statusMsg        = 0x00 // Only message of the extensions, exchanged on connection
+	protocolLength   = 1
+	maxMsgSize       = 1024
+	handshakeTimeout = 5 * time.Second
+)
+
+var (
+	errExtraStatus     = errors.New("extra status message")
+	errSpecMismatch    = errors.New("reward spec mismatch")
+	errGenesisMismatch = errors.New("genesis block mismatch")
+)
+
+// rewardSpecStatus is the handshake of the reward spec extension.
+type rewardSpecStatus struct {
+	Genesis  common.Hash
+	SpecHash common.Hash
+}
+
+// signupTopicStatus is the handshake of the signup topic extension.
+type signupTopicStatus struct {
+	Topic        string
+	Broadcasting bool // Whether the node broadcasts signups on the topic
+}
+
+// PeerInfo is the state of the extensions negotiated with a peer.
+type PeerInfo struct {
+	RewardSpec   uint        `json:"rewardSpec,omitempty"` // Negotiated version, 0 if not supported
+	SpecHash     common.Hash `json:"specHash"`
+	SignupTopic  uint        `json:"signupTopic,omitempty"` // Negotiated version, 0 if not supported
+	Topic        string      `json:"topic,omitempty"`
+	Broadcasting bool        `json:"broadcasting"`
+}
+
+// Service implements the UR wire extensions, tracking which extensions every
+// connected peer speaks.
+type Service struct {
+	genesis      common.Hash
+	specHash     common.Hash
+	broadcasting bool
+
+	peers map[discover.NodeID]*PeerInfo
+	lock  sync.RWMutex
+}
+
+// New returns the extensions of a full node, advertising whether the node
+// broadcasts signups over whisper.
+func New(ethServ *eth.Ethereum, broadcasting bool) (*Service, error) {
+	if ethServ == nil {
+		return nil, errors.New("UR extensions require a full node")
+	}
+	return newService(ethServ.BlockChain().Genesis().Hash(), core.RewardSpecHash(ethServ.BlockChain().Config()), broadcasting), nil
+}
+
+func newService(genesis, specHash common.Hash, broadcasting bool) *Service {
+	return &Service{
+		genesis:      genesis,
+		specHash:     specHash,
+		broadcasting: broadcasting,
+		peers:        make(map[discover.NodeID]*PeerInfo),
+	}
+}
+
+// Protocols implements node.Service, returning a capability for every version
+// of every extension.
+func (s *Service) Protocols() []p2p.Protocol {
+	var protos []p2p.Protocol
+	for _, version := range RewardSpecVersions {
+		version := version
+		protos = append(protos, p2p.Protocol{
+			Name:    RewardSpecName,
+			Version: version,
+			Length:  protocolLength,
+			Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+				return s.runRewardSpec(p, rw, version)
+			},
+			NodeInfo: func() interface{} { return &rewardSpecStatus{s.genesis, s.specHash} },
+			PeerInfo: s.peerInfo,
+		})
+	}
+	for _, version := range SignupTopicVersions {
+		version := version
+		protos = append(protos, p2p.Protocol{
+			Name:    SignupTopicName,
+			Version: version,
+			Length:  protocolLength,
+			Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+				return s.runSignupTopic(p, rw, version)
+			},
+			NodeInfo: func() interface{} { return &signupTopicStatus{signupcast.TopicName, s.broadcasting} },
+			PeerInfo: s.peerInfo,
+		})
+	}
+	return protos
+}
+
+// APIs implements node.Service, returning the RPC API endpoints reporting the
+// extensions of the peers.
+func (s *Service) APIs() []rpc.API {
+	return []rpc.API{
+		{
+			Namespace: "urext",
+			Version:   "1.0",
+			Service:   &PublicExtensionsAPI{s},
+			Public:    true,
+		},
+	}
+}
+
+// Start implements node.Service, the extensions only run along with the peers.
+func (s *Service) Start(server *p2p.Server) error { return nil }
+
+// Stop implements node.Service.
+func (s *Service) Stop() error { return nil }
+
+// runRewardSpec exchanges the reward spec hashes with a peer, disconnecting it
+// if they differ, as the two nodes would compute different states.
+func (s *Service) runRewardSpec(p *p2p.Peer, rw p2p.MsgReadWriter, version uint) error {
+	var status rewardSpecStatus
+	if err := handshake(rw, &rewardSpecStatus{s.genesis, s.specHash}, &status); err != nil {
+		return err
+	}
+	if status.Genesis != s.genesis {
+		return fmt.Errorf("%v: %x (!= %x)", errGenesisMismatch, status.Genesis, s.genesis)
+	}
+	if status.SpecHash != s.specHash {
+		glog.V(logger.Debug).Infof("%v: reward spec %x differs from ours %x", p, status.SpecHash, s.specHash)
+		return fmt.Errorf("%v: %x (!= %x)", errSpecMismatch, status.SpecHash, s.specHash)
+	}
+	defer s.update(p.ID(), func(info *PeerInfo) { info.RewardSpec = 0 })
+	s.update(p.ID(), func(info *PeerInfo) { info.RewardSpec, info.SpecHash = version, status.SpecHash })
+	return idle(rw)
+}
+
+// runSignupTopic exchanges the whisper signup topics with a peer.
+func (s *Service) runSignupTopic(p *p2p.Peer, rw p2p.MsgReadWriter, version uint) error {
+	var status signupTopicStatus
+	if err := handshake(rw, &signupTopicStatus{signupcast.TopicName, s.broadcasting}, &status); err != nil {
+		return err
+	}
+	defer s.update(p.ID(), func(info *PeerInfo) { info.SignupTopic = 0 })
+	s.update(p.ID(), func(info *PeerInfo) {
+		info.SignupTopic, info.Topic, info.Broadcasting = version, status.Topic, status.Broadcasting
+	})
+	return idle(rw)
+}
+
+// update modifies the extension state of a peer, dropping it once no extension
+// runs with the peer anymore.
+func (s *Service) update(id discover.NodeID, fn func(*PeerInfo)) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	info := s.peers[id]
+	if info == nil {
+		info = new(PeerInfo)
+		s.peers[id] = info
+	}
+	fn(info)
+	if info.RewardSpec == 0 && info.SignupTopic == 0 {
+		delete(s.peers, id)
+	}
+}
+
+// peerInfo returns a copy of the extension state of a peer, nil if none runs.
+func (s *Service) peerInfo(id discover.NodeID) interface{} {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if info, ok := s.peers[id]; ok {
+		cpy := *info
+		return &cpy
+	}
+	return nil
+}
+
+// handshake sends the local status of an extension and reads the one of the
+// peer concurrently.
+func handshake(rw p2p.MsgReadWriter, local, remote interface{}) error {
+	errc := make(chan error, 2)
+	go func() {
+		errc <- p2p.Send(rw, statusMsg, local)
+	}()
+	go func() {
+		errc <- readStatus(rw, remote)
+	}()
+	timeout := time.NewTimer(handshakeTimeout)
+	defer timeout.Stop()
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errc:
+			if err != nil {
+				return err
+			}
+		case <-timeout.C:
+			return p2p.DiscReadTimeout
+		}
+	}
+	return nil
+}
+
+func readStatus(rw p2p.MsgReadWriter, status interface{}) error {
+	msg, err := rw.ReadMsg()
+	if err != nil {
+		return err
+	}
+	defer msg.Discard()
+
+	if msg.Code != statusMsg {
+		return fmt.Errorf("first message has code %x (!= %x)", msg.Code, statusMsg)
+	}
+	if msg.Size > maxMsgSize {
+		return fmt.Errorf("status too large: %v > %v", msg.Size, maxMsgSize)
+	}
+	if err := msg.Decode(status); err != nil {
+		return fmt.Errorf("invalid status: %v", err)
+	}
+	return nil
+}
+
+// idle keeps an extension running after its handshake until the connection is
+// closed. Later versions may add messages, current ones only expect none.
+func idle(rw p2p.MsgReadWriter) error {
+	msg, err := rw.ReadMsg()
+	if err != nil {
+		return err
+	}
+	msg.Discard()
+	if msg.Code == statusMsg {
+		return errExtraStatus
+	}
+	return fmt.Errorf("invalid message code %x", msg.Code)
+}
+
+// PublicExtensionsAPI provides an API to inspect the UR extensions spoken by
+// the connected peers.
+type PublicExtensionsAPI struct {
+	s *Service
+}
+
+// Peers returns the extensions negotiated with every peer speaking any.
+func (api *PublicExtensionsAPI) Peers() map[string]*PeerInfo {
+	api.s.lock.RLock()
+	defer api.s.lock.RUnlock()
+
+	peers := make(map[string]*PeerInfo, len(api.s.peers))
+	for id, info := range api.s.peers {
+		cpy := *info
+		peers[id.String()] = &cpy
+	}
+	return peers
+}
+
+// Broadcasters returns the ids of the peers broadcasting signups on the given
+// whisper topic.
+func (api *PublicExtensionsAPI) Broadcasters(topic string) []string {
+	api.s.lock.RLock()
+	defer api.s.lock.RUnlock()
+
+	var ids []string
+	for id, info := range api.s.peers {
+		if info.SignupTopic > 0 && info.Broadcasting && info.Topic == topic {
+			ids = append(ids, id.String())
+		}
+	}
+	return ids
+}
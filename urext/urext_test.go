@@ -0,0 +1,132 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package urext
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/p2p"
+	"github.com/ur-technology/go-ur/p2p/discover"
+	"github.com/ur-technology/go-ur/signupcast"
+)
+
+// testPeers connects two services over a message pipe with the given extension,
+// returning the channels their protocol runs terminate on and the pipe.
+func testPeers(a, b *Service, name string) (chan error, chan error, *p2p.MsgPipeRW) {
+	run := func(s *Service) func(*p2p.Peer, p2p.MsgReadWriter) error {
+		for _, proto := range s.Protocols() {
+			if proto.Name == name {
+				return proto.Run
+			}
+		}
+		panic("unknown extension " + name)
+	}
+	rwa, rwb := p2p.MsgPipe()
+	erra, errb := make(chan error, 1), make(chan error, 1)
+	go func() {
+		erra <- run(a)(p2p.NewPeer(discover.NodeID{0xb}, "b", nil), rwa)
+	}()
+	go func() {
+		errb <- run(b)(p2p.NewPeer(discover.NodeID{0xa}, "a", nil), rwb)
+	}()
+	return erra, errb, rwa
+}
+
+// waitPeer waits until the service tracks the extension state of a peer.
+func waitPeer(t *testing.T, s *Service, id discover.NodeID, ready func(*PeerInfo) bool) *PeerInfo {
+	for i := 0; i < 100; i++ {
+		if info, ok := s.peerInfo(id).(*PeerInfo); ok && ready(info) {
+			return info
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("peer %x not tracked", id[:1])
+	return nil
+}
+
+// Tests that peers agreeing on the reward spec keep the extension running, and
+// that the peer state is dropped when the connection is closed.
+func TestRewardSpecMatch(t *testing.T) {
+	a := newService(common.Hash{1}, common.Hash{2}, false)
+	b := newService(common.Hash{1}, common.Hash{2}, false)
+	erra, errb, pipe := testPeers(a, b, RewardSpecName)
+
+	info := waitPeer(t, a, discover.NodeID{0xb}, func(info *PeerInfo) bool { return info.RewardSpec > 0 })
+	if info.RewardSpec != RewardSpecVersions[0] || info.SpecHash != (common.Hash{2}) {
+		t.Errorf("peer state mismatch: %+v", info)
+	}
+	pipe.Close()
+	<-erra
+	<-errb
+	if info := a.peerInfo(discover.NodeID{0xb}); info != nil {
+		t.Errorf("disconnected peer still tracked: %+v", info)
+	}
+}
+
+// Tests that peers disagreeing on the reward spec or the genesis are dropped.
+func TestRewardSpecMismatch(t *testing.T) {
+	tests := []struct {
+		genesis, spec common.Hash
+		err           error
+	}{
+		{common.Hash{1}, common.Hash{3}, errSpecMismatch},
+		{common.Hash{4}, common.Hash{2}, errGenesisMismatch},
+	}
+	for i, tt := range tests {
+		a := newService(common.Hash{1}, common.Hash{2}, false)
+		b := newService(tt.genesis, tt.spec, false)
+		erra, errb, _ := testPeers(a, b, RewardSpecName)
+
+		for _, errc := range []chan error{erra, errb} {
+			select {
+			case err := <-errc:
+				if err == nil || !strings.HasPrefix(err.Error(), tt.err.Error()) {
+					t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("test %d: mismatching peer not dropped", i)
+			}
+		}
+		if len(a.peers) != 0 || len(b.peers) != 0 {
+			t.Errorf("test %d: mismatching peers tracked", i)
+		}
+	}
+}
+
+// Tests that the signup broadcasters are advertised to the peers.
+func TestSignupTopic(t *testing.T) {
+	a := newService(common.Hash{1}, common.Hash{2}, false)
+	b := newService(common.Hash{1}, common.Hash{2}, true)
+	_, _, pipe := testPeers(a, b, SignupTopicName)
+	defer pipe.Close()
+
+	info := waitPeer(t, a, discover.NodeID{0xb}, func(info *PeerInfo) bool { return info.SignupTopic > 0 })
+	if !info.Broadcasting || info.Topic != signupcast.TopicName {
+		t.Errorf("broadcaster state mismatch: %+v", info)
+	}
+	waitPeer(t, b, discover.NodeID{0xa}, func(info *PeerInfo) bool { return info.SignupTopic > 0 })
+
+	if ids := (&PublicExtensionsAPI{a}).Broadcasters(signupcast.TopicName); len(ids) != 1 || ids[0] != (discover.NodeID{0xb}).String() {
+		t.Errorf("broadcasters mismatch: %v", ids)
+	}
+	if ids := (&PublicExtensionsAPI{b}).Broadcasters(signupcast.TopicName); len(ids) != 0 {
+		t.Errorf("non-broadcasting peer listed: %v", ids)
+	}
+}
@@ -0,0 +1,469 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package watchlist implements a node-managed list of watched addresses which
+// triggers webhooks whenever transactions or rewards involving them are imported.
+package watchlist
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/common/hexutil"
+	"github.com/ur-technology/go-ur/core"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/eth"
+	"github.com/ur-technology/go-ur/event"
+	"github.com/ur-technology/go-ur/logger"
+	"github.com/ur-technology/go-ur/logger/glog"
+	"github.com/ur-technology/go-ur/p2p"
+	"github.com/ur-technology/go-ur/rpc"
+)
+
+// Events a watched address can trigger webhooks on.
+const (
+	EventIncoming = "incoming" // Transaction sent to the address
+	EventOutgoing = "outgoing" // Transaction sent from the address
+	EventReward   = "reward"   // Block, uncle, signup or referral reward credited to the address
+)
+
+const (
+	deliveryQueueSize = 1024             // Maximum number of notifications waiting to be delivered
+	deliveryTimeout   = 10 * time.Second // Maximum time allowed for a single webhook call
+	deliveryAttempts  = 3                // Number of times a failing webhook is called
+)
+
+// deliveryBackoff is the delay before retrying a failed webhook call, doubled on
+// every further attempt.
+var deliveryBackoff = 2 * time.Second
+
+// Entry is a watched address along with the webhook to notify.
+type Entry struct {
+	Address common.Address `json:"address"`
+	Webhook string         `json:"webhook"`         // HTTP(S) endpoint the notifications are posted to
+	Events  []string       `json:"events"`          // Events to notify about, all if empty
+	Label   string         `json:"label,omitempty"` // Free form description echoed in the notifications
+}
+
+// wants reports whether the entry subscribes to the given event.
+func (e *Entry) wants(event string) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+	for _, ev := range e.Events {
+		if ev == event {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks that the entry can be watched.
+func (e *Entry) validate() error {
+	u, err := url.Parse(e.Webhook)
+	if err != nil {
+		return fmt.Errorf("invalid webhook: %v", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook %q, want an http or https url", e.Webhook)
+	}
+	for _, ev := range e.Events {
+		if ev != EventIncoming && ev != EventOutgoing && ev != EventReward {
+			return fmt.Errorf("unknown event %q, want %q, %q or %q", ev, EventIncoming, EventOutgoing, EventReward)
+		}
+	}
+	return nil
+}
+
+// Notification is the JSON payload posted to the webhook of a watched address.
+type Notification struct {
+	Address     common.Address  `json:"address"`
+	Label       string          `json:"label,omitempty"`
+	Event       string          `json:"event"`
+	Reward      string          `json:"reward,omitempty"` // Kind of reward: block, uncle, signup or referral
+	BlockNumber hexutil.Uint64  `json:"blockNumber"`
+	BlockHash   common.Hash     `json:"blockHash"`
+	TxHash      *common.Hash    `json:"txHash,omitempty"`
+	From        *common.Address `json:"from,omitempty"`
+	To          *common.Address `json:"to,omitempty"`
+	Value       *hexutil.Big    `json:"value"`
+}
+
+// delivery is a notification queued for posting to a webhook.
+type delivery struct {
+	webhook      string
+	notification *Notification
+}
+
+// Service implements the watchlist daemon, which follows the imported blocks and
+// notifies the webhooks of the watched addresses involved.
+type Service struct {
+	chain *core.BlockChain
+	mux   *event.TypeMux
+	file  string // File the watchlist is persisted in, empty for an ephemeral one
+
+	entries map[common.Address]*Entry
+	lock    sync.RWMutex
+
+	client *http.Client
+	queue  chan *delivery
+	sub    event.Subscription
+	quit   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// New returns a watchlist service persisting the watched addresses in the given
+// file, loading any existing ones.
+func New(file string, ethServ *eth.Ethereum) (*Service, error) {
+	if ethServ == nil {
+		return nil, errors.New("watchlist requires a full node")
+	}
+	return newService(file, ethServ.BlockChain(), ethServ.EventMux())
+}
+
+func newService(file string, chain *core.BlockChain, mux *event.TypeMux) (*Service, error) {
+	s := &Service{
+		chain:   chain,
+		mux:     mux,
+		file:    file,
+		entries: make(map[common.Address]*Entry),
+		client:  &http.Client{Timeout: deliveryTimeout},
+		queue:   make(chan *delivery, deliveryQueueSize),
+		quit:    make(chan struct{}),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load reads the persisted watchlist, if any.
+func (s *Service) load() error {
+	if s.file == "" {
+		return nil
+	}
+	blob, err := ioutil.ReadFile(s.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var entries []*Entry
+	if err := json.Unmarshal(blob, &entries); err != nil {
+		return fmt.Errorf("invalid watchlist %s: %v", s.file, err)
+	}
+	for _, entry := range entries {
+		s.entries[entry.Address] = entry
+	}
+	return nil
+}
+
+// save persists the watchlist, the lock must be held.
+func (s *Service) save() error {
+	if s.file == "" {
+		return nil
+	}
+	blob, err := json.MarshalIndent(s.list(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.file + ".tmp"
+	if err := ioutil.WriteFile(tmp, blob, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.file)
+}
+
+// list returns the watched entries, the lock must be held.
+func (s *Service) list() []*Entry {
+	entries := make([]*Entry, 0, len(s.entries))
+	for _, entry := range s.entries {
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// add watches an address, replacing any previous entry of it.
+func (s *Service) add(entry *Entry) error {
+	if err := entry.validate(); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	prev := s.entries[entry.Address]
+	s.entries[entry.Address] = entry
+	if err := s.save(); err != nil {
+		if prev != nil {
+			s.entries[entry.Address] = prev
+		} else {
+			delete(s.entries, entry.Address)
+		}
+		return err
+	}
+	return nil
+}
+
+// remove stops watching an address, returning whether it was watched.
+func (s *Service) remove(addr common.Address) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	prev, ok := s.entries[addr]
+	if !ok {
+		return false, nil
+	}
+	delete(s.entries, addr)
+	if err := s.save(); err != nil {
+		s.entries[addr] = prev
+		return false, err
+	}
+	return true, nil
+}
+
+// Protocols implements node.Service, returning the P2P network protocols used
+// by the watchlist (nil as it doesn't use the devp2p overlay network).
+func (s *Service) Protocols() []p2p.Protocol { return nil }
+
+// APIs implements node.Service, returning the RPC API endpoints managing the
+// watchlist.
+func (s *Service) APIs() []rpc.API {
+	return []rpc.API{
+		{
+			Namespace: "watchlist",
+			Version:   "1.0",
+			Service:   &PrivateWatchlistAPI{s},
+			Public:    false,
+		},
+	}
+}
+
+// Start implements node.Service, starting to follow the imported blocks.
+func (s *Service) Start(server *p2p.Server) error {
+	s.sub = s.mux.Subscribe(core.ChainEvent{})
+
+	s.wg.Add(2)
+	go s.loop()
+	go s.deliver()
+
+	s.lock.RLock()
+	glog.V(logger.Info).Infof("Watchlist started, %d addresses watched", len(s.entries))
+	s.lock.RUnlock()
+	return nil
+}
+
+// Stop implements node.Service, terminating the watchlist daemon. Notifications
+// not delivered yet are dropped.
+func (s *Service) Stop() error {
+	s.sub.Unsubscribe()
+	close(s.quit)
+	s.wg.Wait()
+
+	glog.V(logger.Info).Infoln("Watchlist stopped")
+	return nil
+}
+
+// loop queues the notifications of every imported block until termination.
+func (s *Service) loop() {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case ev, ok := <-s.sub.Chan():
+			if !ok {
+				return
+			}
+			if chainEv, ok := ev.Data.(core.ChainEvent); ok {
+				for _, d := range s.notifications(chainEv.Block) {
+					select {
+					case s.queue <- d:
+					default:
+						glog.V(logger.Warn).Infof("Watchlist notification queue full, dropping %s notification of %x", d.notification.Event, d.notification.Address)
+					}
+				}
+			}
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// notifications assembles the notifications of the watched addresses involved
+// in the given block.
+func (s *Service) notifications(block *types.Block) []*delivery {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if len(s.entries) == 0 {
+		return nil
+	}
+	var (
+		deliveries []*delivery
+		signer     = types.MakeSigner(s.chain.Config(), block.Number())
+		rewards    = core.Rewards(s.chain.Config())
+		signups    int64
+	)
+	notify := func(addr common.Address, event string, fill func(*Notification)) {
+		entry, ok := s.entries[addr]
+		if !ok || !entry.wants(event) {
+			return
+		}
+		n := &Notification{
+			Address:     addr,
+			Label:       entry.Label,
+			Event:       event,
+			BlockNumber: hexutil.Uint64(block.NumberU64()),
+			BlockHash:   block.Hash(),
+		}
+		fill(n)
+		deliveries = append(deliveries, &delivery{webhook: entry.Webhook, notification: n})
+	}
+	reward := func(addr common.Address, kind string, amount *big.Int, tx *common.Hash) {
+		notify(addr, EventReward, func(n *Notification) {
+			n.Reward, n.Value, n.TxHash = kind, (*hexutil.Big)(new(big.Int).Set(amount)), tx
+		})
+	}
+	// Notify about the transfers and the signup rewards they credit
+	for _, tx := range block.Transactions() {
+		msg, err := tx.AsMessage(signer)
+		if err != nil {
+			continue
+		}
+		var (
+			hash = tx.Hash()
+			from = msg.From()
+			to   = tx.To()
+		)
+		transfer := func(n *Notification) {
+			n.TxHash, n.From, n.To, n.Value = &hash, &from, to, (*hexutil.Big)(tx.Value())
+		}
+		notify(from, EventOutgoing, transfer)
+		if to != nil {
+			notify(*to, EventIncoming, transfer)
+		}
+		if core.IsSignupTransaction(s.chain.Config(), msg) {
+			members, err := core.SignupChain(s.chain, tx)
+			if err != nil {
+				continue
+			}
+			signups++
+			reward(*to, "signup", rewards.SignupReward, &hash)
+			for i, member := range members {
+				reward(member, "referral", rewards.MembersSignupRewards[i], &hash)
+			}
+		}
+	}
+	// Notify about the mining rewards
+	var (
+		header = block.Header()
+		uncles = block.Uncles()
+		total  = new(big.Int).Mul(rewards.BlockReward, big.NewInt(signups+1))
+	)
+	total.Add(total, new(big.Int).Mul(core.UncleInclusionReward(s.chain.Config(), header.Number), big.NewInt(int64(len(uncles)))))
+	reward(header.Coinbase, "block", total, nil)
+	for _, uncle := range uncles {
+		reward(uncle.Coinbase, "uncle", core.UncleReward(s.chain.Config(), header, uncle), nil)
+	}
+	return deliveries
+}
+
+// deliver posts the queued notifications to their webhooks until termination.
+func (s *Service) deliver() {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case d := <-s.queue:
+			backoff := deliveryBackoff
+			for attempt := 1; ; attempt++ {
+				err := s.post(d)
+				if err == nil {
+					break
+				}
+				if attempt == deliveryAttempts {
+					glog.V(logger.Warn).Infof("Watchlist webhook %s failed, dropping notification: %v", d.webhook, err)
+					break
+				}
+				glog.V(logger.Debug).Infof("Watchlist webhook %s failed, retrying in %v: %v", d.webhook, backoff, err)
+				select {
+				case <-time.After(backoff):
+					backoff *= 2
+				case <-s.quit:
+					return
+				}
+			}
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// post delivers a single notification to its webhook.
+func (s *Service) post(d *delivery) error {
+	body, err := json.Marshal(d.notification)
+	if err != nil {
+		return err
+	}
+	res, err := s.client.Post(d.webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response status: %s", res.Status)
+	}
+	return nil
+}
+
+// PrivateWatchlistAPI manages the watched addresses over RPC.
+type PrivateWatchlistAPI struct {
+	s *Service
+}
+
+// Add watches an address, posting notifications about the selected events (all
+// if none are given) to the webhook. Watching an already watched address
+// replaces its previous entry.
+func (api *PrivateWatchlistAPI) Add(entry Entry) (bool, error) {
+	if err := api.s.add(&entry); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Remove stops watching an address, returning whether it was watched at all.
+func (api *PrivateWatchlistAPI) Remove(addr common.Address) (bool, error) {
+	return api.s.remove(addr)
+}
+
+// List returns the watched addresses along with their webhooks.
+func (api *PrivateWatchlistAPI) List() []*Entry {
+	api.s.lock.RLock()
+	defer api.s.lock.RUnlock()
+
+	return api.s.list()
+}
@@ -0,0 +1,160 @@
+// Copyright 2016 The go-ur Authors
+// This file is part of the go-ur library.
+//
+// The go-ur library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ur library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ur library. If not, see <http://www.gnu.org/licenses/>.
+
+package watchlist
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ur-technology/go-ur/common"
+	"github.com/ur-technology/go-ur/core"
+	"github.com/ur-technology/go-ur/core/types"
+	"github.com/ur-technology/go-ur/crypto"
+	"github.com/ur-technology/go-ur/ethdb"
+	"github.com/ur-technology/go-ur/event"
+	"github.com/ur-technology/go-ur/params"
+)
+
+// Tests that the watchlist is validated, persisted and reloaded.
+func TestWatchlistPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watchlist-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "watchlist.json")
+
+	s, err := newService(file, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create watchlist: %v", err)
+	}
+	api := &PrivateWatchlistAPI{s}
+
+	invalid := []Entry{
+		{Address: common.Address{1}, Webhook: "ftp://example.com"},
+		{Address: common.Address{1}, Webhook: "not a url"},
+		{Address: common.Address{1}, Webhook: "http://example.com", Events: []string{"mined"}},
+	}
+	for i, entry := range invalid {
+		if _, err := api.Add(entry); err == nil {
+			t.Errorf("invalid entry %d accepted", i)
+		}
+	}
+	for i := byte(1); i <= 3; i++ {
+		if _, err := api.Add(Entry{Address: common.Address{i}, Webhook: "http://example.com", Events: []string{EventIncoming}}); err != nil {
+			t.Fatalf("failed to add entry %d: %v", i, err)
+		}
+	}
+	if ok, err := api.Remove(common.Address{2}); !ok || err != nil {
+		t.Fatalf("failed to remove entry: %v, %v", ok, err)
+	}
+	if ok, _ := api.Remove(common.Address{2}); ok {
+		t.Fatalf("removed unwatched address")
+	}
+	// Reload the watchlist and check the contents
+	s, err = newService(file, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to reload watchlist: %v", err)
+	}
+	if entries := (&PrivateWatchlistAPI{s}).List(); len(entries) != 2 {
+		t.Fatalf("entry count mismatch: have %d, want 2", len(entries))
+	}
+	for _, addr := range []common.Address{{1}, {3}} {
+		if entry := s.entries[addr]; entry == nil || !entry.wants(EventIncoming) || entry.wants(EventOutgoing) {
+			t.Errorf("entry %x mismatch: %v", addr, entry)
+		}
+	}
+}
+
+// Tests that the webhooks of the watched addresses are notified about imported
+// transfers and rewards.
+func TestWatchlistNotifications(t *testing.T) {
+	received := make(chan *Notification, 16)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := new(Notification)
+		if err := json.NewDecoder(r.Body).Decode(n); err != nil {
+			t.Errorf("invalid notification: %v", err)
+		}
+		received <- n
+	}))
+	defer server.Close()
+
+	var (
+		key, _   = crypto.GenerateKey()
+		sender   = crypto.PubkeyToAddress(key.PublicKey)
+		receiver = common.Address{0xaa}
+		coinbase = common.Address{0xbb}
+		db, _    = ethdb.NewMemDatabase()
+		genesis  = core.WriteGenesisBlockForTesting(db, core.GenesisAccount{Address: sender, Balance: big.NewInt(1000000000)})
+		mux      = new(event.TypeMux)
+	)
+	chain, _ := core.NewBlockChain(db, params.TestChainConfig, core.FakePow{}, mux)
+	defer chain.Stop()
+
+	blocks, _ := core.GenerateChain(params.TestChainConfig, chain, genesis, db, 1, func(i int, gen *core.BlockGen) {
+		gen.SetCoinbase(coinbase)
+		tx, _ := types.NewTransaction(gen.TxNonce(sender), receiver, big.NewInt(1000), params.TxGas, nil, nil).SignECDSA(types.HomesteadSigner{}, key)
+		gen.AddTx(tx)
+	})
+	s, err := newService("", chain, mux)
+	if err != nil {
+		t.Fatalf("failed to create watchlist: %v", err)
+	}
+	s.add(&Entry{Address: sender, Webhook: server.URL, Events: []string{EventOutgoing}})
+	s.add(&Entry{Address: receiver, Webhook: server.URL, Events: []string{EventIncoming, EventReward}, Label: "shop"})
+	s.add(&Entry{Address: coinbase, Webhook: server.URL, Events: []string{EventReward}})
+
+	s.Start(nil)
+	defer s.Stop()
+
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	want := map[common.Address]string{sender: EventOutgoing, receiver: EventIncoming, coinbase: EventReward}
+	for len(want) > 0 {
+		select {
+		case n := <-received:
+			if event, ok := want[n.Address]; !ok || event != n.Event {
+				t.Fatalf("unexpected notification: %+v", n)
+			}
+			delete(want, n.Address)
+
+			switch n.Event {
+			case EventIncoming:
+				if n.Label != "shop" || n.Value.ToInt().Cmp(big.NewInt(1000)) != 0 || *n.From != sender {
+					t.Errorf("incoming notification mismatch: %+v", n)
+				}
+			case EventReward:
+				if n.Reward != "block" || n.Value.ToInt().Cmp(core.BlockReward) != 0 {
+					t.Errorf("reward notification mismatch: %+v", n)
+				}
+			}
+			if n.BlockHash != blocks[0].Hash() {
+				t.Errorf("block hash mismatch: have %x, want %x", n.BlockHash, blocks[0].Hash())
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("missing notifications: %v", want)
+		}
+	}
+}